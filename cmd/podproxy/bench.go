@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/xlab/closer"
+
+	"github.com/entwico/podproxy/internal/kube"
+)
+
+const (
+	// benchChunkSize is the size of the writes when measuring throughput.
+	benchChunkSize = 32 * 1024
+	// benchProbeTimeout bounds waiting for the first byte.
+	benchProbeTimeout = 30 * time.Second
+)
+
+// runBench implements the "bench" subcommand, measuring the port-forward
+// path to a target:
+//
+//	podproxy bench --mode echo podproxy-echo.staging:7
+//
+// Each of --count connections records the dial latency and, unless the mode
+// is dial, the first-byte latency: the round trip of one byte to an echo
+// server, or the time to the first byte of an HTTP response. A final
+// connection then measures throughput for --duration.
+func runBench(args []string) {
+	fs := pflag.NewFlagSet("bench", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	mode := fs.String("mode", "http", "dial, http (GET --path) or echo (the target echoes what it receives)")
+	path := fs.String("path", "/", "request path in http mode")
+	count := fs.Int("count", 20, "number of connections measuring latency")
+	duration := fs.Duration("duration", 10*time.Second, "how long to measure throughput (0 skips it)")
+	standalone := fs.Bool("standalone", false, "dial clusters directly instead of through a running instance")
+	user := fs.String("user", "", "proxy username for a running instance (password from PODPROXY_PASSWORD)")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: podproxy bench [flags] HOST:PORT")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if *mode != "dial" && *mode != "http" && *mode != "echo" {
+		fatalf("unknown mode %q (expected dial, http or echo)", *mode)
+	}
+
+	if *count < 1 {
+		fatalf("--count must be at least 1")
+	}
+
+	target := fs.Arg(0)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	defer closer.Close()
+
+	dial, _ := clientDialer(ctx, *configPath, *standalone, *user)
+
+	b := &bench{dial: dial, target: target, mode: *mode, path: *path}
+
+	var dials, firstBytes []time.Duration
+
+	for range *count {
+		dialTime, firstByte, err := b.probe(ctx)
+		if err != nil {
+			fatalf("%v", err)
+		}
+
+		dials = append(dials, dialTime)
+
+		if *mode != "dial" {
+			firstBytes = append(firstBytes, firstByte)
+		}
+	}
+
+	fmt.Printf("%s, %d connections\n", target, *count)
+	printLatencies("dial", dials)
+
+	if len(firstBytes) > 0 {
+		printLatencies("first byte", firstBytes)
+	}
+
+	if *duration <= 0 || *mode == "dial" {
+		return
+	}
+
+	n, elapsed, err := b.throughput(ctx, *duration)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	fmt.Printf("%-12s %s/s (%s in %s)\n", "throughput", kube.FormatBytes(int64(float64(n)/elapsed.Seconds())), kube.FormatBytes(n), elapsed.Round(time.Millisecond))
+}
+
+// bench measures connections to target.
+type bench struct {
+	dial   func(ctx context.Context, network, addr string) (net.Conn, error)
+	target string
+	mode   string
+	path   string
+}
+
+// probe opens a connection and returns the dial and first-byte latencies.
+func (b *bench) probe(ctx context.Context) (dialTime, firstByte time.Duration, err error) {
+	start := time.Now()
+
+	conn, err := b.dial(ctx, "tcp", b.target)
+	if err != nil {
+		return 0, 0, fmt.Errorf("dialing %s: %w", b.target, err)
+	}
+	defer conn.Close()
+
+	dialTime = time.Since(start)
+
+	if b.mode == "dial" {
+		return dialTime, 0, nil
+	}
+
+	// tunnels don't support deadlines; closing the connection unblocks
+	// reads as well.
+	ctx, cancel := context.WithTimeout(ctx, benchProbeTimeout)
+	defer cancel()
+
+	defer context.AfterFunc(ctx, func() { _ = conn.Close() })()
+
+	start = time.Now()
+
+	switch b.mode {
+	case "echo":
+		_, err = conn.Write([]byte{'x'})
+	default:
+		_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", b.path, b.target)
+	}
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		return 0, 0, fmt.Errorf("waiting for the first byte: %w", err)
+	}
+
+	return dialTime, time.Since(start), nil
+}
+
+// throughput transfers data for up to d and returns the number of bytes
+// received: echoed back in echo mode, the response in http mode.
+func (b *bench) throughput(ctx context.Context, d time.Duration) (int64, time.Duration, error) {
+	conn, err := b.dial(ctx, "tcp", b.target)
+	if err != nil {
+		return 0, 0, fmt.Errorf("dialing %s: %w", b.target, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	defer context.AfterFunc(ctx, func() { _ = conn.Close() })()
+
+	start := time.Now()
+
+	var body io.Reader = conn
+
+	switch b.mode {
+	case "echo":
+		go func() {
+			chunk := make([]byte, benchChunkSize)
+			for {
+				if _, err := conn.Write(chunk); err != nil {
+					return
+				}
+			}
+		}()
+	default:
+		if _, err := fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", b.path, b.target); err != nil {
+			return 0, 0, err
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return 0, 0, fmt.Errorf("reading response: %w", err)
+		}
+		defer resp.Body.Close()
+
+		body = resp.Body
+	}
+
+	n, err := io.Copy(io.Discard, body)
+	elapsed := time.Since(start)
+
+	// closing the connection at the end of d is expected.
+	if err != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return 0, 0, err
+	}
+
+	return n, elapsed, nil
+}
+
+// printLatencies prints the percentiles of samples on one line.
+func printLatencies(name string, samples []time.Duration) {
+	slices.Sort(samples)
+
+	fmt.Printf("%-12s min %-9s p50 %-9s p90 %-9s p99 %-9s max %s\n", name,
+		formatLatency(samples[0]),
+		formatLatency(percentile(samples, 50)),
+		formatLatency(percentile(samples, 90)),
+		formatLatency(percentile(samples, 99)),
+		formatLatency(samples[len(samples)-1]))
+}
+
+// percentile returns the p-th percentile of sorted samples, by the nearest
+// rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+
+	return sorted[max(rank, 1)-1]
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(10 * time.Microsecond).String()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"github.com/entwico/podproxy/internal/config"
+)
+
+// runConfig implements the "config" subcommand. "config schema" prints a JSON
+// Schema of the config file for editors and CI checks; "config dump" prints
+// the effective configuration and the resolved clusters.
+func runConfig(args []string) {
+	fs := pflag.NewFlagSet("config", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file (dump)")
+	pidFile := fs.String("pid-file", "", "PID file path, overriding pidFile from the config (dump)")
+
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: podproxy config [flags] schema|dump")
+		os.Exit(2)
+	}
+
+	switch fs.Arg(0) {
+	case "schema":
+		schema, err := config.Schema()
+		if err != nil {
+			fatalf("%v", err)
+		}
+
+		fmt.Println(string(schema))
+	case "dump":
+		dumpConfig(*configPath, *pidFile)
+	default:
+		fatalf("unknown action %q (expected schema or dump)", fs.Arg(0))
+	}
+}
+
+// clusterDump is a resolved cluster as printed by "config dump".
+type clusterDump struct {
+	Name       string                 `yaml:"name"`
+	Source     string                 `yaml:"source"`
+	Kubeconfig string                 `yaml:"kubeconfig,omitempty"`
+	Context    string                 `yaml:"context,omitempty"`
+	Namespace  string                 `yaml:"namespace"`
+	InCluster  bool                   `yaml:"inCluster,omitempty"`
+	Settings   config.ClusterSettings `yaml:"settings"`
+}
+
+// dumpConfig prints the configuration podproxy would run with, resolved the
+// same way as at startup, with passwords redacted. The clusters follow as a
+// second YAML document, with their merged settings and where they were
+// found.
+func dumpConfig(configPath, pidFile string) {
+	cfg, clusters, err := config.LoadConfig(configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if pidFile != "" {
+		cfg.PIDFile = pidFile
+	}
+
+	dump := struct {
+		Clusters []clusterDump `yaml:"clusters"`
+	}{Clusters: make([]clusterDump, 0, len(clusters))}
+
+	for _, rc := range clusters {
+		dump.Clusters = append(dump.Clusters, clusterDump{
+			Name:       rc.Name,
+			Source:     rc.Source,
+			Kubeconfig: rc.Kubeconfig,
+			Context:    rc.Context,
+			Namespace:  rc.Namespace,
+			InCluster:  rc.InCluster,
+			Settings:   rc.Settings,
+		})
+	}
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+
+	fmt.Printf("# effective configuration: %s over the built-in defaults\n", configPath)
+
+	if err := enc.Encode(cfg.Redacted()); err != nil {
+		fatalf("%v", err)
+	}
+
+	if err := enc.Encode(dump); err != nil {
+		fatalf("%v", err)
+	}
+
+	if err := enc.Close(); err != nil {
+		fatalf("%v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/pidfile"
+)
+
+const (
+	defaultPIDFile   = "~/.podproxy/podproxy.pid"
+	defaultDaemonLog = "~/.podproxy/podproxy.log"
+
+	daemonStartTimeout = 10 * time.Second
+	daemonStopTimeout  = 15 * time.Second
+)
+
+// daemonFlags are shared by the start, stop, restart and status subcommands.
+type daemonFlags struct {
+	configPath *string
+	pidFile    *string
+}
+
+func addDaemonFlags(fs *pflag.FlagSet) daemonFlags {
+	return daemonFlags{
+		configPath: fs.String("config", "config.yaml", "path to YAML config file"),
+		pidFile:    fs.String("pid-file", "", "PID file path (default: pidFile from the config, or "+defaultPIDFile+")"),
+	}
+}
+
+// resolvePIDFile returns the PID file used to manage the instance, from the
+// flag, the config, or the default location.
+func (f daemonFlags) resolvePIDFile() string {
+	if *f.pidFile != "" {
+		return *f.pidFile
+	}
+
+	cfg, err := config.Load(*f.configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if cfg.PIDFile != "" {
+		return cfg.PIDFile
+	}
+
+	return config.ExpandTilde(defaultPIDFile)
+}
+
+// runStart implements the "start" subcommand. Without --daemon it runs the
+// proxy in the foreground like the bare command.
+func runStart(args []string) {
+	fs := pflag.NewFlagSet("start", pflag.ExitOnError)
+	flags := addDaemonFlags(fs)
+	daemon := fs.Bool("daemon", false, "run in the background")
+	logPath := fs.String("log", "", "file receiving the background process output (default: "+defaultDaemonLog+")")
+	replace := fs.Bool("replace", false, "stop the instance holding the PID file and take over")
+
+	_ = fs.Parse(args)
+
+	if !*daemon {
+		runServe(*flags.configPath, *flags.pidFile, *replace, false)
+		return
+	}
+
+	startDaemon(flags, *logPath, *replace)
+}
+
+// runStop implements the "stop" subcommand.
+func runStop(args []string) {
+	fs := pflag.NewFlagSet("stop", pflag.ExitOnError)
+	flags := addDaemonFlags(fs)
+
+	_ = fs.Parse(args)
+
+	stopDaemon(flags.resolvePIDFile())
+}
+
+// runRestart implements the "restart" subcommand, starting a new background
+// instance that takes over from the running one (if any) as with --replace.
+// The old instance stops accepting right away and keeps serving its open
+// connections for up to drainTimeout.
+func runRestart(args []string) {
+	fs := pflag.NewFlagSet("restart", pflag.ExitOnError)
+	flags := addDaemonFlags(fs)
+	logPath := fs.String("log", "", "file receiving the background process output (default: "+defaultDaemonLog+")")
+
+	_ = fs.Parse(args)
+
+	startDaemon(flags, *logPath, true)
+}
+
+// runStatus implements the "status" subcommand. It exits with status 3 when
+// no instance is running, following the LSB init script convention.
+func runStatus(args []string) {
+	fs := pflag.NewFlagSet("status", pflag.ExitOnError)
+	flags := addDaemonFlags(fs)
+
+	_ = fs.Parse(args)
+
+	pid, ok, err := pidfile.Running(flags.resolvePIDFile())
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if !ok {
+		fmt.Println("podproxy is not running")
+		os.Exit(3)
+	}
+
+	fmt.Printf("podproxy is running (pid %d)\n", pid)
+}
+
+// startDaemon re-executes podproxy detached from the terminal and waits until
+// it holds the PID file.
+func startDaemon(flags daemonFlags, logPath string, replace bool) {
+	pidPath := flags.resolvePIDFile()
+
+	if !replace {
+		if pid, ok, err := pidfile.Running(pidPath); err == nil && ok {
+			fatalf("podproxy is already running (pid %d)", pid)
+		}
+	}
+
+	configPath, err := filepath.Abs(*flags.configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if logPath == "" {
+		logPath = defaultDaemonLog
+	}
+
+	logPath = config.ExpandTilde(logPath)
+
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+		fatalf("%v", err)
+	}
+
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer logFile.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	childArgs := []string{"--config", configPath, "--pid-file", pidPath}
+	if replace {
+		childArgs = append(childArgs, "--replace")
+	}
+
+	cmd := exec.Command(exe, childArgs...)
+	cmd.Dir = filepath.Dir(configPath)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedProcAttr()
+
+	if err := cmd.Start(); err != nil {
+		fatalf("starting podproxy: %v", err)
+	}
+
+	exited := make(chan error, 1)
+
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	deadline := time.After(daemonStartTimeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-exited:
+			fatalf("podproxy exited during startup (%v), see %s", err, logPath)
+		case <-deadline:
+			fatalf("podproxy did not start within %s, see %s", daemonStartTimeout, logPath)
+		case <-ticker.C:
+			if pid, ok, _ := pidfile.Running(pidPath); ok && pid == cmd.Process.Pid {
+				fmt.Printf("podproxy started (pid %d), logging to %s\n", pid, logPath)
+				return
+			}
+		}
+	}
+}
+
+func stopDaemon(pidPath string) {
+	pid, _, _ := pidfile.Running(pidPath)
+
+	err := pidfile.Stop(pidPath, daemonStopTimeout)
+	if errors.Is(err, pidfile.ErrNotRunning) {
+		fmt.Println("podproxy is not running")
+		return
+	}
+
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	fmt.Printf("podproxy stopped (pid %d)\n", pid)
+}
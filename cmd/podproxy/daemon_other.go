@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func detachedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// terminateProcess stops p; there is no portable graceful signal.
+func terminateProcess(p *os.Process) error {
+	return p.Kill()
+}
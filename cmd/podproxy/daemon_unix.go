@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// detachedProcAttr starts the background process in its own session, so it
+// survives the terminal closing.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// terminateProcess asks p to shut down gracefully.
+func terminateProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"github.com/entwico/podproxy/internal/config"
+)
+
+// dockerHost is the name containers reach the Docker host under. Docker
+// Desktop provides it; elsewhere it is mapped with host-gateway.
+const dockerHost = "host.docker.internal"
+
+// runDockerEnv implements the "docker-env" subcommand, printing configuration
+// that points containers at the configured listeners via host.docker.internal.
+func runDockerEnv(args []string) {
+	fs := pflag.NewFlagSet("docker-env", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	format := fs.String("format", "env", "output format: env (for docker --env-file), compose, or devcontainer")
+	user := fs.String("user", "", "proxy username to embed in the proxy URLs (password from PODPROXY_PASSWORD)")
+
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	var userinfo *url.Userinfo
+	if *user != "" {
+		userinfo = url.UserPassword(*user, os.Getenv("PODPROXY_PASSWORD"))
+	}
+
+	vars := proxyEnv(cfg, userinfo, dockerHostAddr)
+
+	var pacURL string
+	if cfg.PACListenAddress != "" {
+		pacURL = "http://" + dockerHostAddr(cfg.PACListenAddress) + "/proxy.pac?host=" + dockerHost
+	}
+
+	switch *format {
+	case "env":
+		fmt.Println("# docker run --add-host=" + dockerHost + ":host-gateway --env-file <this file>")
+
+		if pacURL != "" {
+			fmt.Println("# PAC: " + pacURL)
+		}
+
+		for _, v := range vars {
+			fmt.Printf("%s=%s\n", v.Name, v.Value)
+		}
+	case "compose":
+		if pacURL != "" {
+			fmt.Println("# PAC: " + pacURL)
+		}
+
+		fmt.Println("services:")
+		fmt.Println("  app:")
+		fmt.Println("    extra_hosts:")
+		fmt.Printf("      - %q\n", dockerHost+":host-gateway")
+		fmt.Println("    environment:")
+
+		for _, v := range vars {
+			fmt.Printf("      %s: %q\n", v.Name, v.Value)
+		}
+	case "devcontainer":
+		devcontainer := struct {
+			RunArgs      []string          `json:"runArgs"`
+			ContainerEnv map[string]string `json:"containerEnv"`
+		}{
+			RunArgs:      []string{"--add-host=" + dockerHost + ":host-gateway"},
+			ContainerEnv: make(map[string]string, len(vars)),
+		}
+
+		for _, v := range vars {
+			devcontainer.ContainerEnv[v.Name] = v.Value
+		}
+
+		data, err := json.MarshalIndent(devcontainer, "", "  ")
+		if err != nil {
+			fatalf("%v", err)
+		}
+
+		// devcontainer.json allows comments.
+		if pacURL != "" {
+			fmt.Println("// PAC: " + pacURL)
+		}
+
+		fmt.Println(string(data))
+	default:
+		fatalf("unsupported format %q (expected env, compose or devcontainer)", *format)
+	}
+
+	if !cfg.DockerBridge.Enabled && isLoopbackAddress(cfg.ListenAddress) {
+		fmt.Fprintln(os.Stderr, "note: the listeners are bound to loopback; on Linux, set dockerBridge.enabled so containers can reach them")
+	}
+}
+
+// dockerHostAddr returns the address containers reach a listener bound to
+// listenAddr under.
+func dockerHostAddr(listenAddr string) string {
+	_, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return listenAddr
+	}
+
+	return net.JoinHostPort(dockerHost, port)
+}
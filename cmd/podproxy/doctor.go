@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/kube"
+	"github.com/entwico/podproxy/internal/proxy"
+)
+
+const (
+	// doctorEchoPort is the port the echo server of the test pod listens on.
+	doctorEchoPort = 7
+	// doctorPodLabel marks the pods and Services created by the pod test.
+	doctorPodLabel = "podproxy.entwico.com/doctor"
+)
+
+// checkStatus is the outcome of a doctor check.
+type checkStatus int
+
+const (
+	checkPassed checkStatus = iota
+	checkWarning
+	checkFailed
+	checkSkipped
+)
+
+// runDoctor implements the "doctor" subcommand, a self test of everything
+// podproxy needs at startup:
+//
+//	podproxy doctor --pod-test staging
+//
+// It parses the config, loads the kubeconfigs, probes every cluster, binds
+// and releases the listen addresses and generates the PAC file. With
+// --pod-test it also starts an echo pod and Service in the cluster,
+// exchanges data with them through a port-forward and deletes them again.
+// The exit code is 1 if a check failed.
+func runDoctor(args []string) {
+	fs := pflag.NewFlagSet("doctor", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of each cluster probe")
+	podCluster := fs.String("pod-test", "", "cluster to run a port-forward test against a temporary echo pod in")
+	podNamespace := fs.String("pod-namespace", "", "namespace of the test pod (default: the cluster's default namespace)")
+	podImage := fs.String("pod-image", "alpine/socat", "image of the test pod, running socat")
+	podTimeout := fs.Duration("pod-timeout", 2*time.Minute, "how long to wait for the test pod to become ready")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: podproxy doctor [flags]")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	r := &doctorReport{w: os.Stdout, color: colorOutput(os.Stdout)}
+
+	defer func() {
+		if r.failed {
+			os.Exit(1)
+		}
+	}()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		r.add("config", checkFailed, err.Error())
+		return
+	}
+
+	r.add("config", checkPassed, *configPath)
+
+	_, clusters, err := config.LoadConfig(*configPath)
+	if err != nil {
+		r.add("kubeconfig", checkFailed, err.Error())
+	} else {
+		r.add("kubeconfig", checkPassed, fmt.Sprintf("%d clusters", len(clusters)))
+	}
+
+	forwarders := newForwarders(ctx, cfg, clusters, nil, nil, &kube.OnCallFlag{}, config.Logger)
+	if err == nil && len(forwarders) == 0 {
+		r.add("clusters", checkFailed, "no usable clusters found")
+	}
+
+	for _, res := range probeClusters(ctx, forwarders, *timeout) {
+		name := "cluster " + res.Cluster
+		if !res.Reachable {
+			r.add(name, checkFailed, res.Err.Error())
+			continue
+		}
+
+		detail := fmt.Sprintf("%s, %s", res.Latency.Round(time.Millisecond), res.AuthMethod)
+		if res.Proxy != "" {
+			detail += ", via " + res.Proxy
+		}
+
+		r.add(name, checkPassed, detail)
+	}
+
+	switch fwd, ok := forwarders[*podCluster]; {
+	case *podCluster == "":
+		r.add("port-forward", checkSkipped, "--pod-test not set")
+	case !ok:
+		r.add("port-forward", checkFailed, fmt.Sprintf("unknown cluster %q", *podCluster))
+	default:
+		namespace := *podNamespace
+		if namespace == "" {
+			namespace = fwd.DefaultNamespace
+		}
+
+		pt := &podTest{fwd: fwd, namespace: namespace, image: *podImage, timeout: *podTimeout}
+		if elapsed, err := pt.run(ctx, forwarders); err != nil {
+			r.add("port-forward "+fwd.Name, checkFailed, err.Error())
+		} else {
+			r.add("port-forward "+fwd.Name, checkPassed, fmt.Sprintf("echo round trip via %s/%s in %s", namespace, pt.name, elapsed.Round(time.Millisecond)))
+		}
+	}
+
+	running := instanceReachable(cfg.ListenAddress)
+
+	for _, addr := range listenAddresses(cfg) {
+		name := "listen " + addr
+
+		ln, err := net.Listen("tcp", addr)
+		switch {
+		case err == nil:
+			ln.Close()
+			r.add(name, checkPassed, "")
+		case running:
+			r.add(name, checkWarning, "in use, podproxy is running")
+		default:
+			r.add(name, checkFailed, err.Error())
+		}
+	}
+
+	if cfg.PACListenAddress == "" {
+		r.add("pac", checkSkipped, "pacListenAddress not set")
+		return
+	}
+
+	if detail, err := checkPAC(cfg, clusters, forwarders); err != nil {
+		r.add("pac", checkFailed, err.Error())
+	} else {
+		r.add("pac", checkPassed, detail)
+	}
+}
+
+// listenAddresses returns the addresses podproxy listens on. Ports of 0 are
+// left out, since they can't be taken.
+func listenAddresses(cfg *config.Config) []string {
+	addrs := []string{cfg.ListenAddress, cfg.HTTPListenAddress, cfg.PACListenAddress, cfg.AdminListenAddress}
+	for _, l := range cfg.Listeners {
+		addrs = append(addrs, l.Address)
+	}
+
+	var listen []string
+
+	for _, addr := range addrs {
+		if _, port, err := net.SplitHostPort(addr); err == nil && port != "0" {
+			listen = append(listen, addr)
+		}
+	}
+
+	return listen
+}
+
+// checkPAC generates the PAC file like the PAC listener serves it and
+// returns the number of cluster domains it routes.
+func checkPAC(cfg *config.Config, clusters []config.ResolvedCluster, forwarders map[string]*kube.PortForwarder) (string, error) {
+	pac := &proxy.PACServer{
+		ClusterNames:     clusterNames(clusters),
+		SOCKSAddress:     cfg.ListenAddress,
+		HTTPProxyAddress: cfg.HTTPListenAddress,
+		Bypass:           noProxyList(cfg, loopbackAddr, apiServerHosts(forwarders)),
+	}
+
+	rec := httptest.NewRecorder()
+	pac.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy.pac", nil))
+
+	if rec.Code != http.StatusOK {
+		return "", fmt.Errorf("generating PAC file: status %d", rec.Code)
+	}
+
+	if !strings.Contains(rec.Body.String(), "function FindProxyForURL") {
+		return "", fmt.Errorf("generated PAC file lacks FindProxyForURL")
+	}
+
+	return fmt.Sprintf("%d cluster domains, %d bytes", len(pac.ClusterNames), rec.Body.Len()), nil
+}
+
+// podTest port-forwards to a temporary echo pod behind a Service.
+type podTest struct {
+	fwd       *kube.PortForwarder
+	namespace string
+	image     string
+	timeout   time.Duration
+	name      string
+}
+
+// run creates the pod and Service, sends a line through the cluster
+// dialer, and deletes both again. It returns the round-trip time.
+func (p *podTest) run(ctx context.Context, forwarders map[string]*kube.PortForwarder) (time.Duration, error) {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	p.name = "podproxy-doctor-" + hex.EncodeToString(suffix)
+
+	labels := map[string]string{doctorPodLabel: p.name}
+	meta := metav1.ObjectMeta{Name: p.name, Namespace: p.namespace, Labels: labels}
+
+	_, clientset := p.fwd.Clients()
+	pods := clientset.CoreV1().Pods(p.namespace)
+	services := clientset.CoreV1().Services(p.namespace)
+
+	_, err := pods.Create(ctx, &corev1.Pod{
+		ObjectMeta: meta,
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{{
+				Name:  "echo",
+				Image: p.image,
+				Args:  []string{fmt.Sprintf("TCP-LISTEN:%d,fork,reuseaddr", doctorEchoPort), "EXEC:cat"},
+				Ports: []corev1.ContainerPort{{ContainerPort: doctorEchoPort}},
+			}},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("creating pod: %w", err)
+	}
+
+	// clean up even after an interrupt.
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_ = services.Delete(cleanupCtx, p.name, metav1.DeleteOptions{})
+		_ = pods.Delete(cleanupCtx, p.name, metav1.DeleteOptions{})
+	}()
+
+	_, err = services.Create(ctx, &corev1.Service{
+		ObjectMeta: meta,
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports:    []corev1.ServicePort{{Port: doctorEchoPort, TargetPort: intstr.FromInt32(doctorEchoPort)}},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("creating service: %w", err)
+	}
+
+	if err := p.waitReady(ctx); err != nil {
+		return 0, err
+	}
+
+	return p.echo(ctx, (&kube.ClusterDialer{Forwarders: forwarders}).DialContext)
+}
+
+// waitReady polls the pod until it is ready.
+func (p *podTest) waitReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		_, clientset := p.fwd.Clients()
+
+		pod, err := clientset.CoreV1().Pods(p.namespace).Get(ctx, p.name, metav1.GetOptions{})
+		if err == nil && kube.PodReady(pod) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("waiting for pod %s/%s: %w", p.namespace, p.name, err)
+			}
+
+			return fmt.Errorf("pod %s/%s not ready after %s (phase %s)", p.namespace, p.name, p.timeout, pod.Status.Phase)
+		case <-ticker.C:
+		}
+	}
+}
+
+// echo dials the Service through dial and waits for a line to come back.
+func (p *podTest) echo(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error)) (time.Duration, error) {
+	addr := net.JoinHostPort(p.name+"."+p.namespace+"."+p.fwd.Name, fmt.Sprint(doctorEchoPort))
+	start := time.Now()
+
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return 0, fmt.Errorf("dialing %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	// tunnels don't support deadlines; closing the connection unblocks
+	// reads as well.
+	ctx, cancel := context.WithTimeout(ctx, benchProbeTimeout)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	const line = "podproxy doctor\n"
+
+	if _, err := io.WriteString(conn, line); err != nil {
+		return 0, fmt.Errorf("writing to %s: %w", addr, err)
+	}
+
+	buf := make([]byte, len(line))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return 0, fmt.Errorf("reading from %s: %w", addr, err)
+	}
+
+	if string(buf) != line {
+		return 0, fmt.Errorf("%s echoed %q, want %q", addr, buf, line)
+	}
+
+	return time.Since(start), nil
+}
+
+// doctorReport prints the checks as they complete.
+type doctorReport struct {
+	w      io.Writer
+	color  bool
+	failed bool
+}
+
+func (r *doctorReport) add(name string, status checkStatus, detail string) {
+	mark, color := "✓", "\033[32m"
+
+	switch status {
+	case checkWarning:
+		mark, color = "!", "\033[33m"
+	case checkFailed:
+		mark, color = "✗", "\033[31m"
+		r.failed = true
+	case checkSkipped:
+		mark, color = "-", "\033[2m"
+	}
+
+	line := strings.TrimRight(fmt.Sprintf("%s %-28s %s", mark, name, detail), " ")
+	if r.color {
+		line = color + line + "\033[0m"
+	}
+
+	_, _ = fmt.Fprintln(r.w, line)
+}
+
+// colorOutput reports whether f is a terminal that should get colors.
+func colorOutput(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/entwico/podproxy/internal/config"
+)
+
+// envVar is a single proxy environment variable.
+type envVar struct {
+	Name  string
+	Value string
+}
+
+// runEnv implements the "env" subcommand, printing shell commands that point
+// proxy-aware CLIs at the configured listeners:
+//
+//	eval "$(podproxy env)"
+func runEnv(args []string) {
+	fs := pflag.NewFlagSet("env", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	shell := fs.String("shell", "sh", "shell syntax: sh, fish, or powershell")
+	unset := fs.Bool("unset", false, "print commands that remove the variables instead")
+	user := fs.String("user", "", "proxy username to embed in the proxy URLs (password from PODPROXY_PASSWORD)")
+
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	var userinfo *url.Userinfo
+	if *user != "" {
+		userinfo = url.UserPassword(*user, os.Getenv("PODPROXY_PASSWORD"))
+	}
+
+	vars := proxyEnv(cfg, userinfo, loopbackAddr)
+
+	for _, v := range vars {
+		var line string
+
+		switch *shell {
+		case "sh":
+			line = shellLine(v, *unset, "export %s=%s", "unset %s", shQuote)
+		case "fish":
+			line = shellLine(v, *unset, "set -gx %s %s", "set -e %s", shQuote)
+		case "powershell":
+			line = shellLine(v, *unset, "$env:%s = %s", "Remove-Item Env:%s -ErrorAction SilentlyContinue", psQuote)
+		default:
+			fatalf("unsupported shell %q (expected sh, fish or powershell)", *shell)
+		}
+
+		fmt.Println(line)
+	}
+}
+
+// proxyEnv returns the proxy variables for cfg in both upper and lower case,
+// since tools disagree on which they read. HTTP(S)_PROXY is only set when the
+// HTTP proxy listener is enabled. clientAddr maps a listen address to the
+// address clients connect to.
+func proxyEnv(cfg *config.Config, userinfo *url.Userinfo, clientAddr func(string) string) []envVar {
+	var vars []envVar
+
+	add := func(name, value string) {
+		vars = append(vars, envVar{name, value}, envVar{strings.ToLower(name), value})
+	}
+
+	if cfg.HTTPListenAddress != "" {
+		httpURL := (&url.URL{Scheme: "http", User: userinfo, Host: clientAddr(cfg.HTTPListenAddress)}).String()
+		add("HTTP_PROXY", httpURL)
+		add("HTTPS_PROXY", httpURL)
+	}
+
+	add("ALL_PROXY", (&url.URL{Scheme: "socks5h", User: userinfo, Host: clientAddr(cfg.ListenAddress)}).String())
+	add("NO_PROXY", strings.Join(noProxyList(cfg, clientAddr, nil), ","))
+
+	return vars
+}
+
+func shellLine(v envVar, unset bool, setFormat, unsetFormat string, quote func(string) string) string {
+	if unset {
+		return fmt.Sprintf(unsetFormat, v.Name)
+	}
+
+	return fmt.Sprintf(setFormat, v.Name, quote(v.Value))
+}
+
+// shQuote single-quotes s for POSIX shells and fish.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// psQuote single-quotes s for PowerShell.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
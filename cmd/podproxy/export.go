@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/entwico/podproxy/internal/admin"
+	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/history"
+)
+
+// runExport implements the "export" subcommand, dumping connection history
+// records for offline analysis. Records are fetched from the running
+// instance's admin API, which holds the history database open; when no
+// instance is running the database is read directly.
+func runExport(args []string) {
+	fs := pflag.NewFlagSet("export", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	since := fs.Duration("since", 24*time.Hour, "only export connections started within this duration (0 for all)")
+	format := fs.String("format", "jsonl", "output format: jsonl or csv")
+	cluster := fs.String("cluster", "", "only export connections to this cluster")
+	namespace := fs.String("namespace", "", "only export connections to this namespace")
+	user := fs.String("user", "", "only export connections made by this proxy user")
+
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if cfg.History.File == "" {
+		fatalf("connection history is disabled (set history.file in the config)")
+	}
+
+	filter := history.Filter{
+		Cluster:   *cluster,
+		Namespace: *namespace,
+		User:      *user,
+	}
+
+	records, err := queryHistory(cfg, *since, filter)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	switch *format {
+	case "jsonl":
+		err = history.WriteJSONL(os.Stdout, records)
+	case "csv":
+		err = history.WriteCSV(os.Stdout, records)
+	default:
+		err = fmt.Errorf("unsupported format %q (expected jsonl or csv)", *format)
+	}
+
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func queryHistory(cfg *config.Config, since time.Duration, filter history.Filter) ([]history.Record, error) {
+	if cfg.AdminListenAddress != "" {
+		records, err := newAdminClient(cfg).History(context.Background(), since, filter)
+		if err == nil || !admin.IsUnreachable(err) {
+			return records, err
+		}
+	}
+
+	store, err := history.OpenBoltStore(cfg.History.File, true)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	if since > 0 {
+		filter.Since = time.Now().Add(-since)
+	}
+
+	return store.Query(filter)
+}
+
+// newAdminClient returns a client for the running instance's admin listener,
+// authenticating as the first configured admin user, preferring one with
+// full access so commands that change state work.
+func newAdminClient(cfg *config.Config) *admin.Client {
+	client := admin.NewClient(adminAddress(cfg))
+	if len(cfg.Admin.Users) == 0 {
+		return client
+	}
+
+	user := cfg.Admin.Users[0]
+
+	if i := slices.IndexFunc(cfg.Admin.Users, func(u config.AdminUserConfig) bool {
+		return admin.Role(u.Role) != admin.RoleObserver
+	}); i >= 0 {
+		user = cfg.Admin.Users[i]
+	}
+
+	client.Username, client.Password = user.Username, user.Password
+
+	return client
+}
+
+// adminAddress returns the admin listener address of the running instance,
+// read from the port file when the configured port is ephemeral.
+func adminAddress(cfg *config.Config) string {
+	_, port, err := net.SplitHostPort(cfg.AdminListenAddress)
+	if err != nil || port != "0" || cfg.PortFile == "" {
+		return cfg.AdminListenAddress
+	}
+
+	ports, err := admin.ReadPortFile(cfg.PortFile)
+	if err != nil || ports.Admin == "" {
+		return cfg.AdminListenAddress
+	}
+
+	return ports.Admin
+}
+
+// fatalf prints an error to stderr and exits with status 1.
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	os.Exit(1)
+}
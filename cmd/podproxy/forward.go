@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/xlab/closer"
+	xproxy "golang.org/x/net/proxy"
+
+	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/kube"
+	"github.com/entwico/podproxy/internal/proxy"
+)
+
+// portMapping is a parsed [LOCAL:]REMOTE port argument.
+type portMapping struct {
+	Local  int
+	Remote int
+}
+
+// runForward implements the "forward" subcommand, a kubectl port-forward
+// style tunnel for one-off access without editing the config:
+//
+//	podproxy forward postgres.db.production 5432:5432
+//
+// Connections go through the running instance's SOCKS5 listener when it is
+// reachable; otherwise the clusters are loaded from the config and dialed
+// directly.
+func runForward(args []string) {
+	fs := pflag.NewFlagSet("forward", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	address := fs.String("address", "127.0.0.1", "local address to listen on")
+	standalone := fs.Bool("standalone", false, "dial clusters directly instead of through a running instance")
+	user := fs.String("user", "", "proxy username for a running instance (password from PODPROXY_PASSWORD)")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: podproxy forward [flags] HOST [LOCAL:]REMOTE...")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	host := fs.Arg(0)
+
+	mappings := make([]portMapping, 0, fs.NArg()-1)
+	for _, spec := range fs.Args()[1:] {
+		m, err := parsePortMapping(spec)
+		if err != nil {
+			fatalf("%v", err)
+		}
+
+		mappings = append(mappings, m)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	defer closer.Close()
+
+	dial, logger := clientDialer(ctx, *configPath, *standalone, *user)
+
+	var wg sync.WaitGroup
+
+	for _, m := range mappings {
+		ln, err := net.Listen("tcp", net.JoinHostPort(*address, strconv.Itoa(m.Local)))
+		if err != nil {
+			fatalf("%v", err)
+		}
+
+		fwd := &proxy.LocalForward{
+			Target:      net.JoinHostPort(host, strconv.Itoa(m.Remote)),
+			DialContext: dial,
+			Logger:      logger,
+		}
+
+		fmt.Printf("Forwarding from %s -> %s\n", ln.Addr(), fwd.Target)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := fwd.Serve(ctx, ln); err != nil {
+				logger.Error("forward listener failed", "addr", ln.Addr(), "error", err)
+				stop()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// clientDialer returns a dial function through the SOCKS5 listener of the
+// running instance when it is reachable, or else one loading the clusters
+// from the config and dialing them directly, along with the logger to use.
+// user authenticates at the instance, with the password from
+// PODPROXY_PASSWORD.
+func clientDialer(ctx context.Context, configPath string, standalone bool, user string) (func(ctx context.Context, network, addr string) (net.Conn, error), *slog.Logger) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if !standalone && instanceReachable(cfg.ListenAddress) {
+		dial, err := socksDialer(cfg.ListenAddress, user, os.Getenv("PODPROXY_PASSWORD"))
+		if err != nil {
+			fatalf("%v", err)
+		}
+
+		slog.Info("dialing through running instance", "addr", cfg.ListenAddress)
+
+		return dial, slog.Default()
+	}
+
+	cfg, clusters, err := config.LoadConfig(configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	forwarders := newForwarders(ctx, cfg, clusters, nil, nil, &kube.OnCallFlag{}, config.Logger)
+	if len(forwarders) == 0 {
+		fatalf("no usable clusters found")
+	}
+
+	return (&kube.ClusterDialer{Forwarders: forwarders}).DialContext, config.Logger
+}
+
+// parsePortMapping parses "REMOTE", "LOCAL:REMOTE" or ":REMOTE". An empty
+// local port picks a free port.
+func parsePortMapping(spec string) (portMapping, error) {
+	local, remote, found := strings.Cut(spec, ":")
+	if !found {
+		local = spec
+		remote = spec
+	}
+
+	var (
+		m   portMapping
+		err error
+	)
+
+	if m.Remote, err = parsePort(remote, false); err != nil {
+		return portMapping{}, fmt.Errorf("invalid port mapping %q: %w", spec, err)
+	}
+
+	if m.Local, err = parsePort(local, true); err != nil {
+		return portMapping{}, fmt.Errorf("invalid port mapping %q: %w", spec, err)
+	}
+
+	return m, nil
+}
+
+func parsePort(s string, allowEmpty bool) (int, error) {
+	if s == "" && allowEmpty {
+		return 0, nil
+	}
+
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port %q must be between 1 and 65535", s)
+	}
+
+	return port, nil
+}
+
+// loopbackAddr rewrites wildcard listen hosts to loopback so the address can
+// be dialed locally.
+func loopbackAddr(listenAddr string) string {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+
+	return listenAddr
+}
+
+// instanceReachable reports whether a podproxy instance accepts connections
+// on its SOCKS5 listen address.
+func instanceReachable(listenAddr string) bool {
+	conn, err := net.DialTimeout("tcp", loopbackAddr(listenAddr), 500*time.Millisecond)
+	if err != nil {
+		return false
+	}
+
+	conn.Close()
+
+	return true
+}
+
+// socksDialer returns a dial function that tunnels through the SOCKS5
+// listener of a running instance. Hostnames are sent unresolved so the
+// instance performs cluster routing.
+func socksDialer(listenAddr, user, password string) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	var socksAuth *xproxy.Auth
+	if user != "" {
+		socksAuth = &xproxy.Auth{User: user, Password: password}
+	}
+
+	d, err := xproxy.SOCKS5("tcp", loopbackAddr(listenAddr), socksAuth, xproxy.Direct)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.(xproxy.ContextDialer).DialContext, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/entwico/podproxy/internal/admin"
+	"github.com/entwico/podproxy/internal/kube"
+	"github.com/entwico/podproxy/internal/notify"
+)
+
+// pendingLogins returns the clusters awaiting an interactive login, sorted
+// by name.
+func pendingLogins(forwarders map[string]*kube.PortForwarder) []admin.Login {
+	logins := []admin.Login{}
+
+	for name, fwd := range forwarders {
+		if state, ok := fwd.LoginRequired(); ok {
+			logins = append(logins, admin.Login{Cluster: name, Since: state.Since, Error: state.Error, LoginURL: state.LoginURL})
+		}
+	}
+
+	slices.SortFunc(logins, func(a, b admin.Login) int { return strings.Compare(a.Cluster, b.Cluster) })
+
+	return logins
+}
+
+// unhealthyTargets returns the targets of all clusters whose connections
+// keep failing, sorted by cluster, namespace and target.
+func unhealthyTargets(forwarders map[string]*kube.PortForwarder) []admin.UnhealthyTarget {
+	targets := []admin.UnhealthyTarget{}
+
+	for _, fwd := range forwarders {
+		for _, t := range fwd.Unhealthy() {
+			u := admin.UnhealthyTarget{
+				Cluster:   t.Cluster,
+				Namespace: t.Namespace,
+				Target:    t.Target,
+				Failures:  t.Failures,
+				Since:     t.Since,
+				LastError: t.LastError,
+				Classes:   t.Classes,
+			}
+
+			for _, ep := range t.Endpoints {
+				u.Endpoints = append(u.Endpoints, admin.Endpoint{Pod: ep.Pod, Ready: ep.Ready, Terminating: ep.Terminating})
+			}
+
+			targets = append(targets, u)
+		}
+	}
+
+	// each forwarder's targets are sorted already.
+	slices.SortStableFunc(targets, func(a, b admin.UnhealthyTarget) int { return strings.Compare(a.Cluster, b.Cluster) })
+
+	return targets
+}
+
+// openBreakers returns the tripped circuit breakers of all clusters, sorted
+// by cluster, namespace and target.
+func openBreakers(forwarders map[string]*kube.PortForwarder) []admin.Breaker {
+	breakers := []admin.Breaker{}
+
+	for name, fwd := range forwarders {
+		for _, b := range fwd.Breakers() {
+			breakers = append(breakers, admin.Breaker{
+				Cluster:   name,
+				Namespace: b.Namespace,
+				Target:    b.Target,
+				Failures:  b.Failures,
+				Opened:    b.Opened,
+				Until:     b.Until,
+				LastError: b.LastError,
+			})
+		}
+	}
+
+	// each forwarder's breakers are sorted already.
+	slices.SortStableFunc(breakers, func(a, b admin.Breaker) int { return strings.Compare(a.Cluster, b.Cluster) })
+
+	return breakers
+}
+
+// clusterReachability returns whether the API server of each cluster is
+// reachable, sorted by cluster.
+func clusterReachability(forwarders map[string]*kube.PortForwarder) []admin.Cluster {
+	clusters := make([]admin.Cluster, 0, len(forwarders))
+
+	for _, fwd := range forwarders {
+		h := fwd.Reachability()
+		clusters = append(clusters, admin.Cluster{
+			Name:      h.Cluster,
+			Reachable: h.Reachable,
+			Since:     h.Since,
+			Checked:   h.Checked,
+			Latency:   h.Latency,
+			LastError: h.LastError,
+		})
+	}
+
+	slices.SortFunc(clusters, func(a, b admin.Cluster) int { return strings.Compare(a.Name, b.Name) })
+
+	return clusters
+}
+
+// notifyLoginRequired shows a desktop notification asking to log in to the
+// cluster.
+func notifyLoginRequired(logger *slog.Logger) func(cluster string, state kube.LoginState) {
+	return func(cluster string, state kube.LoginState) {
+		body := "Connections to " + cluster + " fail until you log in again."
+		if state.LoginURL != "" {
+			body += " Open " + state.LoginURL
+		}
+
+		if err := notify.Send("podproxy: login required", body); err != nil {
+			logger.Warn("failed to show login notification", "cluster", cluster, "error", err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/entwico/podproxy/internal/admin"
+	"github.com/entwico/podproxy/internal/config"
+)
+
+// runLogs implements the "logs" subcommand, printing the recent log events
+// of the running instance from its admin API and, with --follow, streaming
+// new ones until interrupted.
+func runLogs(args []string) {
+	fs := pflag.NewFlagSet("logs", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	follow := fs.BoolP("follow", "f", false, "keep streaming new log events")
+	tail := fs.IntP("tail", "n", 100, "number of buffered events to print first (0 for all)")
+	component := fs.String("component", "", "only show events of this component (e.g. admin, http-proxy)")
+	cluster := fs.String("cluster", "", "only show events of this cluster")
+	conn := fs.String("conn", "", "only show events of this connection ID")
+	jsonOutput := fs.Bool("json", false, "print events as JSON lines")
+
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if cfg.AdminListenAddress == "" {
+		fatalf("the admin listener is disabled (set adminListenAddress in the config)")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	filter := admin.LogFilter{Component: *component, Cluster: *cluster, Conn: *conn}
+
+	output := func(e admin.LogEvent) error {
+		return printLogEvent(os.Stdout, e)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		output = func(e admin.LogEvent) error {
+			return enc.Encode(e)
+		}
+	}
+
+	err = newAdminClient(cfg).Logs(ctx, filter, *tail, *follow, output)
+	if admin.IsUnreachable(err) {
+		fatalf("podproxy is not running (no admin listener at %s)", adminAddress(cfg))
+	}
+
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// printLogEvent writes e as one line: time, level, message and the
+// attributes sorted by key.
+func printLogEvent(w io.Writer, e admin.LogEvent) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s %-5s %s", e.Time.Local().Format(time.DateTime), e.Level, e.Message)
+
+	keys := make([]string, 0, len(e.Attrs))
+	for key := range e.Attrs {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		value := e.Attrs[key]
+		if value == "" || strings.ContainsAny(value, " \"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+
+		fmt.Fprintf(&b, " %s=%s", key, value)
+	}
+
+	b.WriteByte('\n')
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
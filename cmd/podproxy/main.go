@@ -1,35 +1,115 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/things-go/go-socks5"
 	"github.com/xlab/closer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
 
+	"github.com/entwico/podproxy/internal/admin"
+	"github.com/entwico/podproxy/internal/auth"
 	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/history"
 	"github.com/entwico/podproxy/internal/kube"
+	"github.com/entwico/podproxy/internal/metrics"
 	"github.com/entwico/podproxy/internal/nodeproxy"
+	"github.com/entwico/podproxy/internal/pidfile"
 	"github.com/entwico/podproxy/internal/proxy"
+	"github.com/entwico/podproxy/internal/proxyproto"
+	"github.com/entwico/podproxy/internal/reuseport"
+	"github.com/entwico/podproxy/internal/state"
+	"github.com/entwico/podproxy/internal/sysproxy"
 	"github.com/entwico/podproxy/internal/version"
 )
 
 func main() {
-	if len(os.Args) > 1 && os.Args[1] == "init" {
-		runInit()
-		return
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "init":
+			runInit()
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "env":
+			runEnv(os.Args[2:])
+			return
+		case "forward":
+			runForward(os.Args[2:])
+			return
+		case "start":
+			runStart(os.Args[2:])
+			return
+		case "stop":
+			runStop(os.Args[2:])
+			return
+		case "restart":
+			runRestart(os.Args[2:])
+			return
+		case "status":
+			runStatus(os.Args[2:])
+			return
+		case "sysproxy":
+			runSysproxy(os.Args[2:])
+			return
+		case "docker-env":
+			runDockerEnv(os.Args[2:])
+			return
+		case "logs":
+			runLogs(os.Args[2:])
+			return
+		case "hostnames":
+			runHostnames(os.Args[2:])
+			return
+		case "traffic":
+			runTraffic(os.Args[2:])
+			return
+		case "top":
+			runTop(os.Args[2:])
+			return
+		case "config":
+			runConfig(os.Args[2:])
+			return
+		case "run":
+			runRun(os.Args[2:])
+			return
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		case "doctor":
+			runDoctor(os.Args[2:])
+			return
+		}
 	}
 
 	showVersion := pflag.Bool("version", false, "print version information and exit")
 	configPath := pflag.String("config", "", "path to YAML config file (default: config.yaml in working directory)")
+	replace := pflag.Bool("replace", false, "stop the instance holding the PID file and take over")
+	pidFile := pflag.String("pid-file", "", "PID file path, overriding pidFile from the config")
+	printPorts := pflag.Bool("print-ports", false, "print the bound listener addresses to stdout as a JSON line once listening")
 
 	pflag.Parse()
 
@@ -42,34 +122,147 @@ func main() {
 		*configPath = "config.yaml"
 	}
 
-	cfg, clusters, err := config.LoadConfig(*configPath)
+	runServe(*configPath, *pidFile, *replace, *printPorts)
+}
+
+// runServe runs the proxy in the foreground until SIGINT or SIGTERM.
+func runServe(configPath, pidFile string, replace, printPorts bool) {
+	cfg, clusters, err := config.LoadConfig(configPath)
 	if err != nil {
 		slog.Error("configuration error", "error", err)
 		os.Exit(1)
 	}
 
+	if pidFile != "" {
+		cfg.PIDFile = pidFile
+	}
+
 	logger := config.Logger
 
+	var logBuffer *admin.LogBuffer
+
+	if cfg.Log.Buffer > 0 {
+		var level slog.Level
+		_ = level.UnmarshalText([]byte(cfg.Log.Level))
+
+		logBuffer = admin.NewLogBuffer(cfg.Log.Buffer, level)
+		logger = slog.New(logBuffer.Handler(logger.Handler()))
+		slog.SetDefault(logger)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	defer closer.Close()
 
-	forwarders := make(map[string]*kube.PortForwarder, len(clusters))
+	// with SO_REUSEPORT the listeners can be bound while the instance being
+	// replaced still serves them, so it is only stopped once this one is ready.
+	var ln *listeners
 
-	for _, rc := range clusters {
-		restCfg, clientset, err := kube.NewKubeClient(rc.Kubeconfig, rc.Context)
+	if cfg.ReusePort {
+		ln = mustOpenListeners(cfg, logger)
+	}
+
+	var pf *pidfile.File
+
+	if cfg.PIDFile != "" {
+		acquire := pidfile.Acquire
+		if replace {
+			// the instance being replaced drains its connections before it
+			// releases the PID file.
+			acquire = func(path string) (*pidfile.File, error) {
+				return pidfile.Takeover(path, 15*time.Second+cfg.DrainTimeout)
+			}
+		}
+
+		pf, err = acquire(cfg.PIDFile)
 		if err != nil {
-			logger.Warn("skipping cluster due to client error", "cluster", rc.Name, "error", err)
-			continue
+			logger.Error("pid file error", "error", err)
+			os.Exit(1)
+		}
+
+		// without SIGTERM, as on Windows, stop asks through the pid file.
+		if stopRequested := pf.StopRequested(); stopRequested != nil {
+			go func() {
+				<-stopRequested
+				stop()
+			}()
+		}
+	}
+
+	if !cfg.ReusePort {
+		ln = mustOpenListeners(cfg, logger)
+	}
+
+	// from here on the config holds the bound addresses, so the PAC file and
+	// logs show ephemeral ports as assigned.
+	ports := ln.boundPorts(cfg)
+
+	if printPorts {
+		_ = json.NewEncoder(os.Stdout).Encode(ports)
+	}
+
+	if cfg.PortFile != "" {
+		if err := admin.WritePortFile(cfg.PortFile, ports); err != nil {
+			logger.Error("port file error", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	var (
+		historyStore history.Store
+		boltStore    *history.BoltStore
+	)
+
+	if cfg.History.File != "" {
+		boltStore, err = history.OpenBoltStore(cfg.History.File, false)
+		if err != nil {
+			logger.Error("connection history error", "error", err)
+			os.Exit(1)
 		}
 
-		forwarders[rc.Name] = &kube.PortForwarder{
-			Config:           restCfg,
-			Clientset:        clientset,
-			DefaultNamespace: rc.Namespace,
-			Logger:           logger.With("cluster", rc.Name),
+		closer.Bind(func() {
+			_ = boltStore.Close()
+		})
+
+		go boltStore.RunRetention(ctx, cfg.History.Retention, time.Hour, logger.With("component", "history"))
+
+		historyStore = boltStore
+	}
+
+	// state outlives a restart only with a file; hot restarts hand it over
+	// like the history database.
+	var stateStore state.Store = &state.Memory{}
+
+	if cfg.State.File != "" {
+		boltState, err := state.OpenBoltStore(cfg.State.File)
+		if err != nil {
+			logger.Error("state error", "error", err)
+			os.Exit(1)
 		}
+
+		closer.Bind(func() {
+			_ = boltState.Close()
+		})
+
+		stateStore = boltState
+	}
+
+	users := authStore(cfg.Auth, logger)
+
+	// shared by all proxy listeners, so a client has one budget.
+	var limiter *proxy.ConnRateLimiter
+	if cfg.ClientRateLimit.QPS > 0 {
+		limiter = &proxy.ConnRateLimiter{Rate: float64(cfg.ClientRateLimit.QPS), Burst: cfg.ClientRateLimit.Burst}
+	}
+
+	onCall := &kube.OnCallFlag{}
+
+	traffic := &kube.Traffic{}
+
+	forwarders := newForwarders(ctx, cfg, clusters, users, historyStore, onCall, logger)
+	for _, fwd := range forwarders {
+		fwd.Traffic = traffic
 	}
 
 	if len(forwarders) == 0 {
@@ -77,45 +270,255 @@ func main() {
 		os.Exit(1)
 	}
 
-	dialer := &kube.ClusterDialer{Forwarders: forwarders}
+	var catalog *kube.ServiceCatalog
 
-	server := socks5.NewServer(
-		socks5.WithDial(dialer.DialContext),
-		socks5.WithResolver(kube.Resolver{}),
-		socks5.WithLogger(&slogErrorLogger{logger: logger.With("component", "socks5")}),
-	)
+	if cfg.ServiceDiscovery.Enabled {
+		catalog = &kube.ServiceCatalog{Forwarders: forwarders}
+		catalog.Start(ctx)
+
+		for _, fwd := range forwarders {
+			fwd.Catalog = catalog
+		}
+	}
+
+	cachedEndpoints := make(map[string]*kube.PortForwarder)
+
+	for _, rc := range clusters {
+		if fwd, ok := forwarders[rc.Name]; ok && config.Enabled(rc.Settings.EndpointCache) {
+			cachedEndpoints[rc.Name] = fwd
+		}
+	}
+
+	if len(cachedEndpoints) > 0 {
+		endpoints := &kube.EndpointCache{Forwarders: cachedEndpoints}
+		endpoints.Start(ctx)
+
+		for _, fwd := range cachedEndpoints {
+			fwd.Endpoints = endpoints
+		}
+	}
+
+	for _, p := range cfg.Prewarm {
+		if fwd, ok := forwarders[p.Cluster]; ok {
+			go fwd.Prewarm(ctx, p.Namespace, p.Service)
+		}
+	}
+
+	if cfg.Notifications.Enabled {
+		setupNotifications(cfg.Notifications, forwarders, logger)
+	}
+
+	if cfg.StartupProbe.Enabled {
+		printProbeSummary(os.Stderr, probeClusters(ctx, forwarders, cfg.StartupProbe.Timeout))
+	}
+
+	var fakeIPs *kube.FakeIPPool
+
+	if cfg.FakeIP.Enabled {
+		fakeIPs, err = kube.NewFakeIPPool(cfg.FakeIP.Range, cfg.FakeIP.TTL)
+		if err != nil {
+			logger.Error("fake IP error", "error", err)
+			os.Exit(1)
+		}
+
+		if n, err := fakeIPs.Load(stateStore); err != nil {
+			logger.Warn("restoring fake IPs failed", "error", err)
+		} else if n > 0 {
+			logger.Info("restored fake IPs", "count", n)
+		}
+
+		if cfg.FakeIP.TTL > 0 {
+			go fakeIPs.RunExpiry(ctx, min(cfg.FakeIP.TTL, time.Minute), logger.With("component", "fakeip"))
+		}
+	}
+
+	routes := passthroughRoutes(cfg.PassthroughRoutes)
+	selectors := selectorTargets(cfg.SelectorTargets)
+	namespaceFor := userNamespaces(cfg.Auth.Namespaces)
+
+	var affinity *kube.SessionAffinity
+	if cfg.SessionAffinity.Enabled {
+		affinity = &kube.SessionAffinity{Timeout: cfg.SessionAffinity.Timeout}
+	}
+
+	passthroughLogger := logger.With("component", "passthrough")
+
+	dialer := &kube.ClusterDialer{
+		Forwarders:      forwarders,
+		FakeIPs:         fakeIPs,
+		Routes:          routes,
+		UserNamespace:   namespaceFor,
+		SessionAffinity: affinity,
+		Selectors:       selectors,
+		Listener:        cfg.ListenAddress,
+		Logger:          passthroughLogger,
+		History:         historyStore,
+	}
+	resolver := kube.Resolver{FakeIPs: fakeIPs}
+
+	tracker := proxy.ConnTracker{
+		Limit:        cfg.ConnectionLimit.Max,
+		Policy:       proxy.LimitPolicy(cfg.ConnectionLimit.Policy),
+		QueueTimeout: cfg.ConnectionLimit.QueueTimeout,
+		ShedIdle:     cfg.ConnectionLimit.ShedIdle,
+		Logger:       logger.With("component", "conntrack"),
+	}
+
+	if cfg.LeakReaper.Enabled {
+		reaper := &kube.Reaper{
+			Traffic:         traffic,
+			Idle:            cfg.LeakReaper.Idle,
+			ClientConnected: tracker.Connected,
+			Logger:          logger.With("component", "reaper"),
+		}
+		go reaper.Run(ctx)
+	}
+
+	if cfg.HealthCheck.Enabled {
+		checker := &kube.HealthChecker{
+			Forwarders: slices.Collect(maps.Values(forwarders)),
+			Interval:   cfg.HealthCheck.Interval,
+			Timeout:    cfg.HealthCheck.Timeout,
+		}
+		go checker.Run(ctx)
+	}
+
+	upstream := upstreamRoutes(cfg.Routes, logger)
+	pairPorts := upstream.PairPorts()
+
+	if len(upstream) > 0 {
+		dialer.Use(upstream.OriginateTLS, upstream.Keepalive(tracker.SetKeepAlive), pairPorts)
+	}
 
 	logger.Info("starting socks5 proxy server", "addr", cfg.ListenAddress)
 
-	go func() {
-		if err := server.ListenAndServe("tcp", cfg.ListenAddress); err != nil {
-			logger.Error("socks5 server failed", "error", err)
-			stop()
+	socksServer := newSOCKSServer(dialer.DialContext, resolver, users, limiter, logger)
+	serveSOCKS(socksServer, tracker.Listener(ln.socks, proxy.RejectSOCKS), logger, stop)
+
+	if ln.dockerSOCKS != nil {
+		serveSOCKS(socksServer, tracker.Listener(ln.dockerSOCKS, proxy.RejectSOCKS), logger, stop)
+	}
+
+	var ingressRouter *kube.IngressRouter
+
+	if cfg.IngressRouting.Enabled {
+		ingressRouter = &kube.IngressRouter{
+			Forwarders:      forwarders,
+			Clusters:        cfg.IngressRouting.Clusters,
+			RefreshInterval: cfg.IngressRouting.RefreshInterval,
+			ServiceSelector: cfg.IngressRouting.ServiceSelector,
+			Logger:          logger.With("component", "ingress"),
 		}
-	}()
+	}
 
-	if cfg.HTTPListenAddress != "" {
-		httpProxy := &proxy.HTTPProxy{
-			DialContext: dialer.DialContext,
-			Logger:      logger.With("component", "http-proxy"),
+	var httpCache *proxy.HTTPCache
+
+	if cfg.HTTPCache.Enabled {
+		httpCache, err = newHTTPCache(cfg.HTTPCache)
+		if err != nil {
+			logger.Error("http cache error", "error", err)
+			os.Exit(1)
 		}
+	}
+
+	if cfg.HTTPListenAddress != "" {
+		httpProxy := newHTTPProxy(cfg, dialer.DialContext, ingressRouter, httpCache, forwarders, users, limiter, logger)
+		httpProxy.TargetChecker = connectTargets(dialer.CheckTarget)
+		httpProxy.LocalhostTargets = dialer
+		httpProxy.Protocols = upstreamProtocols(upstream)
 		defer httpProxy.Close()
 
-		httpServer := &http.Server{
-			Addr:              cfg.HTTPListenAddress,
-			Handler:           httpProxy,
-			ReadHeaderTimeout: 10 * time.Second,
+		logger.Info("starting http proxy server", "addr", cfg.HTTPListenAddress)
+		serveHTTPProxy(ctx, httpProxy, []net.Listener{ln.http, ln.dockerHTTP}, &tracker, logger, stop)
+	}
+
+	var listenerProxies []*proxy.HTTPProxy
+
+	for i, lc := range cfg.Listeners {
+		var (
+			dial       func(context.Context, string, string) (net.Conn, error)
+			check      func(context.Context, string) error
+			targets    proxy.ClusterTargets
+			router     *kube.IngressRouter
+			visibility *kube.Visibility
+		)
+
+		if len(lc.Clusters) > 0 || len(lc.Namespaces) > 0 {
+			visibility = &kube.Visibility{Clusters: lc.Clusters, Namespaces: lc.Namespaces}
 		}
 
-		logger.Info("starting http proxy server", "addr", cfg.HTTPListenAddress)
-		gracefulShutdown(ctx, httpServer, logger, "http server")
+		if lc.Cluster != "" {
+			fwd := forwarders[lc.Cluster]
+			if fwd == nil {
+				logger.Warn("skipping listener of unusable cluster", "addr", lc.Address, "cluster", lc.Cluster)
+				_ = ln.extra[i].Close()
 
-		go func() {
-			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				logger.Error("http connect server failed", "error", err)
-				stop()
+				continue
 			}
-		}()
+
+			pinned := &kube.PinnedDialer{Forwarder: fwd, Namespace: lc.Namespace, FakeIPs: fakeIPs, Visibility: visibility, UserNamespace: namespaceFor, SessionAffinity: affinity}
+			if len(upstream) > 0 {
+				pinned.Use(upstream.OriginateTLS, upstream.Keepalive(tracker.SetKeepAlive), pairPorts)
+			}
+
+			dial, check, targets = pinned.DialContext, pinned.CheckTarget, pinned
+		} else {
+			listenerDialer := &kube.ClusterDialer{
+				Forwarders:      forwarders,
+				FakeIPs:         fakeIPs,
+				Visibility:      visibility,
+				Routes:          routes,
+				UserNamespace:   namespaceFor,
+				SessionAffinity: affinity,
+				Selectors:       selectors,
+				Listener:        lc.Address,
+				Logger:          passthroughLogger,
+				History:         historyStore,
+			}
+			if len(upstream) > 0 {
+				listenerDialer.Use(upstream.OriginateTLS, upstream.Keepalive(tracker.SetKeepAlive), pairPorts)
+			}
+
+			dial, check, targets = listenerDialer.DialContext, listenerDialer.CheckTarget, listenerDialer
+			router = ingressRouter
+		}
+
+		logger.Info("starting listener", "addr", lc.Address, "protocol", cmp.Or(lc.Protocol, "socks5"),
+			"cluster", lc.Cluster, "clusters", lc.Clusters, "namespaces", lc.Namespaces)
+
+		if lc.Protocol == "sni" {
+			sni := &proxy.SNIProxy{Suffix: lc.SNISuffix, Port: lc.TargetPort, DialContext: dial, Logger: logger.With("component", "sni-proxy")}
+			serveSNI(ctx, sni, tracker.Listener(ln.extra[i], nil), logger, stop)
+
+			continue
+		}
+
+		if lc.Protocol == "http" {
+			httpProxy := newHTTPProxy(cfg, dial, router, httpCache, forwarders, users, limiter, logger)
+			httpProxy.TargetChecker = connectTargets(check)
+			httpProxy.LocalhostTargets = targets
+			httpProxy.Protocols = upstreamProtocols(upstream)
+			listenerProxies = append(listenerProxies, httpProxy)
+
+			serveHTTPProxy(ctx, httpProxy, []net.Listener{ln.extra[i]}, &tracker, logger, stop)
+
+			continue
+		}
+
+		serveSOCKS(newSOCKSServer(dial, resolver, users, limiter, logger), tracker.Listener(ln.extra[i], proxy.RejectSOCKS), logger, stop)
+	}
+
+	defer func() {
+		for _, p := range listenerProxies {
+			p.Close()
+		}
+	}()
+
+	for i, f := range cfg.Forwards {
+		fwd := &proxy.LocalForward{Target: f.Target, DialContext: dialer.DialContext, Logger: logger.With("component", "forward")}
+
+		logger.Info("starting forward", "addr", f.Address, "target", f.Target)
+		serveForward(ctx, fwd, tracker.Listener(ln.forwards[i], nil), logger, stop)
 	}
 
 	if cfg.PACListenAddress != "" {
@@ -125,49 +528,1061 @@ func main() {
 			HTTPProxyAddress: cfg.HTTPListenAddress,
 		}
 
+		if ingressRouter != nil {
+			pacServer.Hostnames = ingressRouter.Hostnames
+		}
+
+		pacServer.Bypass = noProxyList(cfg, loopbackAddr, apiServerHosts(forwarders))
+
+		var pacHandler http.Handler = pacServer
+
+		if cfg.PACCompanion {
+			pacHandler = &proxy.Companion{
+				PAC:         pacServer,
+				Version:     version.Version,
+				PACURL:      sysproxy.PACURL(cfg.PACListenAddress),
+				Connections: tracker.Active,
+			}
+		}
+
 		pacHTTPServer := &http.Server{
-			Addr:              cfg.PACListenAddress,
-			Handler:           pacServer,
+			Handler:           pacHandler,
 			ReadHeaderTimeout: 10 * time.Second,
 		}
 
 		logger.Info("starting proxy auto-configuration server", "addr", cfg.PACListenAddress, "clusters", clusterNames(clusters))
 		gracefulShutdown(ctx, pacHTTPServer, logger, "pac server")
 
+		for _, l := range []net.Listener{ln.pac, ln.dockerPAC} {
+			if l == nil {
+				continue
+			}
+
+			go func() {
+				if err := pacHTTPServer.Serve(l); !isServerClosed(err) {
+					logger.Error("pac server failed", "error", err)
+					stop()
+				}
+			}()
+		}
+	}
+
+	if cfg.AdminListenAddress != "" {
+		adminHandler := &admin.Server{
+			History: historyStore,
+			Logger:  logger.With("component", "admin"),
+			Pprof:   cfg.Admin.Pprof,
+			Ports:   &ports,
+			Logs:    logBuffer,
+		}
+
+		if catalog != nil {
+			adminHandler.Services = serviceCatalog{catalog: catalog}
+		}
+
+		adminHandler.Hostnames = func(ctx context.Context) []string {
+			return routedHostnames(ctx, forwarders, catalog, ingressRouter)
+		}
+
+		adminHandler.Members = func(ctx context.Context, cluster, namespace, service string) ([]admin.Member, error) {
+			return serviceMembers(ctx, forwarders, cluster, namespace, service)
+		}
+
+		adminHandler.NoProxy = func() []string {
+			return noProxyList(cfg, loopbackAddr, apiServerHosts(forwarders))
+		}
+
+		for _, rc := range clusters {
+			if config.Enabled(rc.Settings.Access.OnCall) {
+				adminHandler.OnCall = revokingOnCall{OnCallFlag: onCall, traffic: traffic, forwarders: forwarders, logger: logger}
+				break
+			}
+		}
+
+		adminHandler.Traffic = func() []admin.NamespaceTraffic {
+			return namespaceTraffic(traffic)
+		}
+
+		adminHandler.Connections = func() []admin.Connection {
+			return openConnections(traffic)
+		}
+		adminHandler.TraceConnection = traffic.SetTrace
+		adminHandler.CloseConnections = func(filter admin.ConnectionFilter, reason string) int {
+			return closeConnections(traffic, filter, reason)
+		}
+
+		adminHandler.Logins = func() []admin.Login {
+			return pendingLogins(forwarders)
+		}
+		adminHandler.Health = func() []admin.UnhealthyTarget {
+			return unhealthyTargets(forwarders)
+		}
+		adminHandler.Breakers = func() []admin.Breaker {
+			return openBreakers(forwarders)
+		}
+		adminHandler.Clusters = func() []admin.Cluster {
+			return clusterReachability(forwarders)
+		}
+
+		if adminUsers := adminUsers(cfg.Admin); adminUsers != nil {
+			adminHandler.Credentials = adminUsers
+			adminHandler.Roles = adminRoles(cfg.Admin)
+		} else if !isLoopbackAddress(cfg.AdminListenAddress) {
+			logger.Warn("admin server is reachable beyond loopback without authentication, set admin.users", "addr", cfg.AdminListenAddress)
+		}
+
+		adminServer := &http.Server{
+			Handler:           adminHandler,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		logger.Info("starting admin server", "addr", cfg.AdminListenAddress)
+		gracefulShutdown(ctx, adminServer, logger, "admin server")
+
 		go func() {
-			if err := pacHTTPServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				logger.Error("pac server failed", "error", err)
+			if err := adminServer.Serve(ln.admin); !isServerClosed(err) {
+				logger.Error("admin server failed", "error", err)
 				stop()
 			}
 		}()
 	}
 
+	var restoreSystemProxy func() error
+
+	if cfg.SystemProxy.Enabled {
+		restoreSystemProxy, err = sysproxy.Apply(systemProxySettings(cfg))
+		if err != nil {
+			logger.Warn("system proxy configuration failed", "error", err)
+		} else {
+			logger.Info("configured system proxy", "mode", cfg.SystemProxy.Mode)
+		}
+	}
+
+	var pushDone chan struct{}
+
+	if pg := cfg.Metrics.Pushgateway; pg.URL != "" {
+		pusher := &metrics.Pusher{
+			URL:      pg.URL,
+			Job:      pg.Job,
+			Interval: pg.Interval,
+			Logger:   logger.With("component", "pushgateway"),
+		}
+
+		logger.Info("pushing metrics to pushgateway", "url", pg.URL, "interval", pg.Interval)
+
+		pushDone = make(chan struct{})
+
+		go func() {
+			defer close(pushDone)
+			pusher.Run(ctx)
+		}()
+	}
+
 	<-ctx.Done()
+	// restore the default signal handling so a second signal exits
+	// immediately instead of waiting for the drain.
+	stop()
 	logger.Info("shutting down")
+
+	if restoreSystemProxy != nil {
+		if err := restoreSystemProxy(); err != nil {
+			logger.Warn("restoring system proxy failed", "error", err)
+		}
+	}
+
+	// hand over to a replacement instance: stop accepting and drain the open
+	// connections, which record their history as they close, then release
+	// the history and state databases and the PID file it is waiting on.
+	ln.close()
+
+	if cfg.PortFile != "" {
+		_ = admin.RemovePortFile(cfg.PortFile, os.Getpid())
+	}
+
+	drainConnections(&tracker, cfg.DrainTimeout, logger)
+
+	if boltStore != nil {
+		_ = boltStore.Close()
+	}
+
+	if fakeIPs != nil {
+		if err := fakeIPs.Save(stateStore); err != nil {
+			logger.Warn("saving fake IPs failed", "error", err)
+		}
+	}
+
+	_ = stateStore.Close()
+
+	if pf != nil {
+		_ = pf.Release()
+	}
+
+	// wait for the final metrics push before exiting.
+	if pushDone != nil {
+		<-pushDone
+	}
 }
 
-// slogErrorLogger adapts *slog.Logger to the socks5.Logger interface.
-type slogErrorLogger struct {
-	logger *slog.Logger
+// systemProxySettings returns the system proxy settings pointing at the
+// listeners of cfg.
+func systemProxySettings(cfg *config.Config) sysproxy.Settings {
+	if cfg.SystemProxy.Mode == "pac" {
+		return sysproxy.Settings{PACURL: sysproxy.PACURL(cfg.PACListenAddress)}
+	}
+
+	s := sysproxy.Settings{SOCKSProxy: sysproxy.ClientAddress(cfg.ListenAddress)}
+	if cfg.HTTPListenAddress != "" {
+		s.HTTPProxy = sysproxy.ClientAddress(cfg.HTTPListenAddress)
+	}
+
+	return s
 }
 
-func (l *slogErrorLogger) Errorf(format string, args ...any) {
-	l.logger.Error(fmt.Sprintf(format, args...))
+// newHTTPCache returns the HTTP response cache configured by cfg, on disk when
+// cfg.Dir is set.
+func newHTTPCache(cfg config.HTTPCacheConfig) (*proxy.HTTPCache, error) {
+	maxSize := int64(cfg.MaxSizeMB) << 20
+
+	var store proxy.CacheStore = proxy.NewMemoryCacheStore(maxSize)
+
+	if cfg.Dir != "" {
+		disk, err := proxy.NewDiskCacheStore(cfg.Dir, maxSize)
+		if err != nil {
+			return nil, err
+		}
+
+		store = disk
+	}
+
+	return &proxy.HTTPCache{Store: store, Hosts: cfg.Hosts, MaxEntrySize: int64(cfg.MaxEntrySizeKB) << 10}, nil
 }
 
-// gracefulShutdown starts a background goroutine that shuts down the server
-// when the context is cancelled.
-func gracefulShutdown(ctx context.Context, server *http.Server, logger *slog.Logger, name string) {
-	go func() {
-		<-ctx.Done()
+// newHTTPProxy returns an HTTP proxy dialing with dial, configured by cfg.
+// router, cache and limiter may be nil.
+func newHTTPProxy(cfg *config.Config, dial func(context.Context, string, string) (net.Conn, error), router *kube.IngressRouter, cache *proxy.HTTPCache,
+	forwarders map[string]*kube.PortForwarder, users auth.Store, limiter *proxy.ConnRateLimiter, logger *slog.Logger,
+) *proxy.HTTPProxy {
+	httpProxy := &proxy.HTTPProxy{
+		DialContext: dial,
+		Logger:      logger.With("component", "http-proxy"),
+		Transport: proxy.TransportOptions{
+			MaxIdleConnsPerHost:   cfg.HTTPTransport.MaxIdleConnsPerHost,
+			IdleConnTimeout:       cfg.HTTPTransport.IdleConnTimeout,
+			ResponseHeaderTimeout: cfg.HTTPTransport.ResponseHeaderTimeout,
+			DisableCompression:    cfg.HTTPTransport.DisableCompression,
+		},
+		Cache:   cache,
+		Limiter: limiter,
+	}
 
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	if router != nil {
+		httpProxy.Router = router
+	}
 
-		if err := server.Shutdown(shutdownCtx); err != nil {
-			logger.Error(name+" shutdown error", "error", err)
+	if cfg.LocalhostRouting.Enabled {
+		httpProxy.LocalhostPort = cfg.LocalhostRouting.Port
+	}
+
+	if len(cfg.HostRewrites) > 0 {
+		rewriter := &kube.HostRewriter{Forwarders: forwarders}
+		for _, rw := range cfg.HostRewrites {
+			rewriter.Rules = append(rewriter.Rules, kube.HostRewriteRule{Match: rw.Match, Host: rw.Host})
 		}
-	}()
+
+		httpProxy.HostRewriter = rewriter
+	}
+
+	if users != nil {
+		httpProxy.Credentials = users
+	}
+
+	return httpProxy
+}
+
+// connectTargets checks CONNECT targets with a dialer, marking the targets
+// hidden from the listener or closed by an access policy as denied.
+type connectTargets func(ctx context.Context, addr string) error
+
+func (c connectTargets) CheckTarget(ctx context.Context, addr string) error {
+	err := c(ctx, addr)
+	if errors.Is(err, kube.ErrNotVisible) || errors.Is(err, kube.ErrAccessDenied) {
+		return fmt.Errorf("%w: %w", proxy.ErrTargetDenied, err)
+	}
+
+	return err
+}
+
+// upstreamProtocols reports the protocols declared by routes to the HTTP
+// proxy.
+type upstreamProtocols kube.Routes
+
+func (u upstreamProtocols) UpstreamProtocol(addr string) string {
+	return string(kube.Routes(u).Protocol(addr))
+}
+
+// serveHTTPProxy serves httpProxy on the non-nil listeners until ctx is
+// cancelled.
+func serveHTTPProxy(ctx context.Context, httpProxy *proxy.HTTPProxy, listeners []net.Listener, tracker *proxy.ConnTracker, logger *slog.Logger, stop func()) {
+	httpServer := &http.Server{
+		Handler:           httpProxy,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	gracefulShutdown(ctx, httpServer, logger, "http server")
+
+	for _, l := range listeners {
+		if l == nil {
+			continue
+		}
+
+		go func() {
+			if err := httpServer.Serve(tracker.Listener(l, proxy.RejectHTTP)); !isServerClosed(err) {
+				logger.Error("http connect server failed", "error", err)
+				stop()
+			}
+		}()
+	}
+}
+
+// slogErrorLogger adapts *slog.Logger to the socks5.Logger interface.
+type slogErrorLogger struct {
+	logger *slog.Logger
+}
+
+func (l *slogErrorLogger) Errorf(format string, args ...any) {
+	l.logger.Error(fmt.Sprintf(format, args...))
+}
+
+// listeners holds the bound server sockets. Servers disabled in the config
+// have a nil listener.
+type listeners struct {
+	socks, http, pac, admin net.Listener
+	// extra holds the listeners of cfg.Listeners, in order.
+	extra []net.Listener
+	// forwards holds the listeners of cfg.Forwards, in order.
+	forwards []net.Listener
+	// docker* are the proxy listeners bound to the Docker bridge, if any.
+	dockerSOCKS, dockerHTTP, dockerPAC net.Listener
+}
+
+// mustOpenListeners binds every configured server address, exiting on
+// failure.
+func mustOpenListeners(cfg *config.Config, logger *slog.Logger) *listeners {
+	listen := listenFunc(cfg, net.ListenConfig{})
+	// the proxy listeners keep idle client connections alive through NAT
+	// and firewalls between the client and a remote instance.
+	listenProxy := listenFunc(cfg, net.ListenConfig{KeepAlive: -1, KeepAliveConfig: clientKeepAlive(cfg.ClientKeepAlive)})
+
+	ln := &listeners{}
+
+	for _, l := range []struct {
+		addr   string
+		target *net.Listener
+		listen func(string, string) (net.Listener, error)
+	}{
+		{cfg.ListenAddress, &ln.socks, listenProxy},
+		{cfg.HTTPListenAddress, &ln.http, listenProxy},
+		{cfg.PACListenAddress, &ln.pac, listen},
+		{cfg.AdminListenAddress, &ln.admin, listen},
+	} {
+		if l.addr == "" {
+			continue
+		}
+
+		var err error
+
+		*l.target, err = l.listen("tcp", l.addr)
+		if err != nil {
+			ln.close()
+			logger.Error("listen error", "addr", l.addr, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, lc := range cfg.Listeners {
+		l, err := listenProxy("tcp", lc.Address)
+		if err != nil {
+			ln.close()
+			logger.Error("listen error", "addr", lc.Address, "error", err)
+			os.Exit(1)
+		}
+
+		ln.extra = append(ln.extra, l)
+	}
+
+	for _, f := range cfg.Forwards {
+		l, err := listenProxy("tcp", f.Address)
+		if err != nil {
+			ln.close()
+			logger.Error("listen error", "addr", f.Address, "error", err)
+			os.Exit(1)
+		}
+
+		ln.forwards = append(ln.forwards, l)
+	}
+
+	if cfg.DockerBridge.Enabled {
+		ln.openDockerBridge(cfg, listen, listenProxy, logger)
+	}
+
+	return ln
+}
+
+// listenFunc returns a function binding listeners with the settings of lc,
+// and SO_REUSEPORT if the config sets reusePort.
+func listenFunc(cfg *config.Config, lc net.ListenConfig) func(string, string) (net.Listener, error) {
+	if cfg.ReusePort {
+		return func(network, address string) (net.Listener, error) {
+			return reuseport.ListenWith(lc, network, address)
+		}
+	}
+
+	return func(network, address string) (net.Listener, error) {
+		return lc.Listen(context.Background(), network, address)
+	}
+}
+
+// clientKeepAlive converts the keepalive settings of accepted client
+// connections.
+func clientKeepAlive(ka config.KeepAliveConfig) net.KeepAliveConfig {
+	if !ka.Enabled {
+		return net.KeepAliveConfig{}
+	}
+
+	return net.KeepAliveConfig{Enable: true, Idle: ka.Idle, Interval: ka.Interval, Count: ka.Count}
+}
+
+// openDockerBridge binds the proxy listeners to the Docker bridge address as
+// well, on the ports bound already. Failures are only logged, since the bridge
+// comes and goes with the Docker daemon.
+func (ln *listeners) openDockerBridge(cfg *config.Config, listen, listenProxy func(string, string) (net.Listener, error), logger *slog.Logger) {
+	host := cfg.DockerBridge.Address
+	if host == "" {
+		var err error
+
+		host, err = dockerBridgeAddress()
+		if err != nil {
+			logger.Warn("docker bridge not found, containers cannot reach podproxy", "error", err)
+			return
+		}
+	}
+
+	for _, l := range []struct {
+		bound  net.Listener
+		addr   string
+		target *net.Listener
+		listen func(string, string) (net.Listener, error)
+	}{
+		{ln.socks, cfg.ListenAddress, &ln.dockerSOCKS, listenProxy},
+		{ln.http, cfg.HTTPListenAddress, &ln.dockerHTTP, listenProxy},
+		{ln.pac, cfg.PACListenAddress, &ln.dockerPAC, listen},
+	} {
+		if l.bound == nil || isWildcardAddress(l.addr) {
+			continue
+		}
+
+		_, port, _ := net.SplitHostPort(l.bound.Addr().String())
+		addr := net.JoinHostPort(host, port)
+
+		bl, err := l.listen("tcp", addr)
+		if err != nil {
+			logger.Warn("docker bridge listen error", "addr", addr, "error", err)
+			continue
+		}
+
+		logger.Info("listening on docker bridge", "addr", addr)
+
+		*l.target = bl
+	}
+}
+
+// dockerBridgeAddress returns the IPv4 address of the docker0 interface.
+func dockerBridgeAddress() (string, error) {
+	iface, err := net.InterfaceByName("docker0")
+	if err != nil {
+		return "", err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+	}
+
+	return "", errors.New("docker0 has no IPv4 address")
+}
+
+// isWildcardAddress reports whether the listen address accepts connections on
+// every interface.
+func isWildcardAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+
+	return host == "" || (ip != nil && ip.IsUnspecified())
+}
+
+// boundPorts replaces ephemeral ports in the listen addresses of cfg with the
+// ports actually bound and returns the resulting addresses.
+func (ln *listeners) boundPorts(cfg *config.Config) admin.Ports {
+	cfg.ListenAddress = boundAddress(cfg.ListenAddress, ln.socks)
+	cfg.HTTPListenAddress = boundAddress(cfg.HTTPListenAddress, ln.http)
+	cfg.PACListenAddress = boundAddress(cfg.PACListenAddress, ln.pac)
+	cfg.AdminListenAddress = boundAddress(cfg.AdminListenAddress, ln.admin)
+
+	ports := admin.Ports{
+		PID:   os.Getpid(),
+		SOCKS: cfg.ListenAddress,
+		HTTP:  cfg.HTTPListenAddress,
+		PAC:   cfg.PACListenAddress,
+		Admin: cfg.AdminListenAddress,
+	}
+
+	for i := range cfg.Listeners {
+		cfg.Listeners[i].Address = boundAddress(cfg.Listeners[i].Address, ln.extra[i])
+		ports.Listeners = append(ports.Listeners, admin.ListenerPort{
+			Cluster:  cfg.Listeners[i].Cluster,
+			Protocol: cmp.Or(cfg.Listeners[i].Protocol, "socks5"),
+			Address:  cfg.Listeners[i].Address,
+		})
+	}
+
+	return ports
+}
+
+// boundAddress returns the configured listen address with its port replaced
+// by the one l is bound to. The configured host is kept, so wildcard
+// addresses stay wildcards.
+func boundAddress(configured string, l net.Listener) string {
+	if l == nil {
+		return configured
+	}
+
+	host, _, err := net.SplitHostPort(configured)
+	if err != nil {
+		return l.Addr().String()
+	}
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		return configured
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// close closes all bound listeners. Connections already accepted stay open.
+func (ln *listeners) close() {
+	for _, l := range slices.Concat([]net.Listener{ln.socks, ln.http, ln.pac, ln.admin, ln.dockerSOCKS, ln.dockerHTTP, ln.dockerPAC}, ln.extra, ln.forwards) {
+		if l != nil {
+			_ = l.Close()
+		}
+	}
+}
+
+// newSOCKSServer creates a SOCKS5 server that dials through dial and, when
+// users is non-nil, requires authentication. limiter may be nil.
+func newSOCKSServer(dial func(context.Context, string, string) (net.Conn, error), resolver kube.Resolver, users auth.Store, limiter *proxy.ConnRateLimiter, logger *slog.Logger) *socks5.Server {
+	opts := []socks5.Option{
+		socks5.WithDial(dial),
+		socks5.WithResolver(resolver),
+		socks5.WithRewriter(proxy.SOCKSRewriter{}),
+		socks5.WithRule(proxy.SOCKSRules{Limiter: limiter, Logger: logger.With("component", "socks5")}),
+		socks5.WithLogger(&slogErrorLogger{logger: logger.With("component", "socks5")}),
+	}
+
+	if users != nil {
+		opts = append(opts, socks5.WithCredential(users))
+	}
+
+	return socks5.NewServer(opts...)
+}
+
+// serveSOCKS serves l in the background and calls stop if serving fails for
+// any reason other than the listener being closed.
+func serveSOCKS(server *socks5.Server, l net.Listener, logger *slog.Logger, stop func()) {
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Error("socks5 server failed", "addr", l.Addr().String(), "error", err)
+			stop()
+		}
+	}()
+}
+
+// serveSNI serves sni on l until ctx is cancelled.
+func serveSNI(ctx context.Context, sni *proxy.SNIProxy, l net.Listener, logger *slog.Logger, stop func()) {
+	go func() {
+		if err := sni.Serve(ctx, l); err != nil {
+			logger.Error("sni proxy failed", "addr", l.Addr().String(), "error", err)
+			stop()
+		}
+	}()
+}
+
+// serveForward serves the static forward fwd on l until ctx is cancelled.
+func serveForward(ctx context.Context, fwd *proxy.LocalForward, l net.Listener, logger *slog.Logger, stop func()) {
+	go func() {
+		if err := fwd.Serve(ctx, l); err != nil {
+			logger.Error("forward listener failed", "addr", l.Addr().String(), "error", err)
+			stop()
+		}
+	}()
+}
+
+// isServerClosed reports whether err from http.Server.Serve is the result of
+// a shutdown or of closing the listener, rather than a failure.
+func isServerClosed(err error) bool {
+	return err == nil || errors.Is(err, http.ErrServerClosed) || errors.Is(err, net.ErrClosed)
+}
+
+// drainConnections waits up to timeout for the open proxy connections to
+// finish. Whatever is still open afterwards is closed when the process exits.
+func drainConnections(tracker *proxy.ConnTracker, timeout time.Duration, logger *slog.Logger) {
+	active := tracker.Active()
+	if active == 0 || timeout <= 0 {
+		return
+	}
+
+	logger.Info("waiting for open connections to finish", "connections", active, "timeout", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := tracker.Wait(ctx); err != nil {
+		logger.Warn("closing connections still open after drain timeout", "connections", tracker.Active())
+	}
+}
+
+// gracefulShutdown starts a background goroutine that shuts down the server
+// when the context is cancelled.
+func gracefulShutdown(ctx context.Context, server *http.Server, logger *slog.Logger, name string) {
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error(name+" shutdown error", "error", err)
+		}
+	}()
+}
+
+// newForwarders builds a PortForwarder for every resolved cluster. Clients are
+// created by a bounded pool of workers, so contexts behind unreachable networks
+// don't serialize startup. Clusters whose client cannot be created within the
+// configured timeout are logged and skipped.
+func newForwarders(ctx context.Context, cfg *config.Config, clusters []config.ResolvedCluster, users auth.Store, historyStore history.Store, onCall *kube.OnCallFlag, logger *slog.Logger) map[string]*kube.PortForwarder {
+	var sharedLimiter flowcontrol.RateLimiter
+	if cfg.SharedRateLimit.QPS > 0 {
+		sharedLimiter = flowcontrol.NewTokenBucketRateLimiter(cfg.SharedRateLimit.QPS, cfg.SharedRateLimit.Burst)
+	}
+
+	forwarders := make(map[string]*kube.PortForwarder, len(clusters))
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, max(cfg.ClientInit.Concurrency, 1))
+	)
+
+	for _, rc := range clusters {
+		sem <- struct{}{}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			vault, err := newVaultCredentials(rc, logger.With("cluster", rc.Name))
+			if err != nil {
+				logger.Warn("skipping cluster due to client error", "cluster", rc.Name, "error", err)
+				return
+			}
+
+			restCfg, clientset, err := newKubeClient(rc, sharedLimiter, vault, cfg.ClientInit.Timeout)
+			if err != nil {
+				logger.Warn("skipping cluster due to client error", "cluster", rc.Name, "error", err)
+				return
+			}
+
+			if vault != nil {
+				go vault.Run(ctx)
+			}
+
+			fwd := &kube.PortForwarder{
+				Name:                 rc.Name,
+				Config:               restCfg,
+				Clientset:            clientset,
+				DefaultNamespace:     rc.Namespace,
+				Logger:               logger.With("cluster", rc.Name),
+				History:              historyStore,
+				DialTimeout:          rc.Settings.DialTimeout,
+				NegativeCacheTTL:     config.Value(rc.Settings.NegativeCacheTTL),
+				Preflight:            config.Enabled(rc.Settings.Preflight),
+				LoadBalancing:        kube.LoadBalancing(rc.Settings.LoadBalancing),
+				Transport:            kube.PortForwardTransport(rc.Settings.PortForwardTransport),
+				MultiplexIdleTimeout: config.Value(rc.Settings.MultiplexIdleTimeout),
+				UnhealthyAfter:       config.Value(rc.Settings.UnhealthyAfter),
+				BreakerThreshold:     config.Value(rc.Settings.CircuitBreaker.Failures),
+				BreakerCooldown:      config.Value(rc.Settings.CircuitBreaker.Cooldown),
+				Trace:                cfg.Log.Trace,
+				Retry: kube.RetryPolicy{
+					Errors:      rc.Settings.Retry.Errors,
+					StatusCodes: rc.Settings.Retry.StatusCodes,
+					Fatal:       rc.Settings.Retry.Fatal,
+				},
+			}
+
+			// expired exec plugin tokens and rotated kubeconfig credentials
+			// are picked up by loading the kubeconfig again.
+			fwd.Reauthenticate = func() (*rest.Config, kubernetes.Interface, error) {
+				return newKubeClient(rc, sharedLimiter, vault, cfg.ClientInit.Timeout)
+			}
+
+			for _, p := range rc.Settings.PortForwardProtocols {
+				fwd.Protocols = append(fwd.Protocols, kube.PortForwardProtocol(p))
+			}
+
+			// the CIDRs were validated with the config.
+			for _, cidr := range rc.Settings.PodCIDRs {
+				fwd.PodCIDRs = append(fwd.PodCIDRs, netip.MustParsePrefix(cidr).Masked())
+			}
+
+			if rc.Settings.Access.Restricted() {
+				fwd.Policy = accessPolicy(rc.Settings.Access, onCall)
+			}
+
+			if config.Enabled(rc.Settings.Impersonate) && users != nil {
+				fwd.Impersonate = func(user string) rest.ImpersonationConfig {
+					imp := users.ImpersonationFor(user)
+					return rest.ImpersonationConfig{UserName: imp.User, Groups: imp.Groups}
+				}
+			}
+
+			mu.Lock()
+			forwarders[rc.Name] = fwd
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	return forwarders
+}
+
+// newKubeClient creates the client of a single cluster. A non-zero timeout
+// abandons clients that take longer to build; the abandoned attempt finishes
+// in the background and its result is discarded.
+func newKubeClient(rc config.ResolvedCluster, sharedLimiter flowcontrol.RateLimiter, vault *kube.VaultCredentials, timeout time.Duration) (*rest.Config, *kubernetes.Clientset, error) {
+	type result struct {
+		restCfg   *rest.Config
+		clientset *kubernetes.Clientset
+		err       error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		opts := kube.ClientOptions{
+			QPS:         rc.Settings.QPS,
+			Burst:       rc.Settings.Burst,
+			RateLimiter: sharedLimiter,
+			CAFile:      rc.Settings.CertificateAuthority,
+			CAData:      []byte(rc.Settings.CertificateAuthorityData),
+			ServerName:  rc.Settings.TLSServerName,
+			Insecure:    config.Enabled(rc.Settings.InsecureSkipTLSVerify),
+			ProxyURL:    rc.Settings.ProxyURL,
+			Vault:       vault,
+		}
+
+		var r result
+		if rc.InCluster {
+			r.restCfg, r.clientset, r.err = kube.NewInClusterClient(opts)
+		} else {
+			r.restCfg, r.clientset, r.err = kube.NewKubeClient(rc.Kubeconfig, rc.Context, opts)
+		}
+
+		done <- r
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		expired = timer.C
+	}
+
+	select {
+	case r := <-done:
+		return r.restCfg, r.clientset, r.err
+	case <-expired:
+		return nil, nil, fmt.Errorf("client initialization timed out after %v", timeout)
+	}
+}
+
+// selectorTargets maps the configured virtual hostnames to their label
+// selectors.
+func selectorTargets(cfg []config.SelectorTargetConfig) map[string]kube.SelectorTarget {
+	if len(cfg) == 0 {
+		return nil
+	}
+
+	targets := make(map[string]kube.SelectorTarget, len(cfg))
+	for _, st := range cfg {
+		targets[strings.ToLower(strings.TrimSuffix(st.Host, "."))] = kube.SelectorTarget{Namespace: st.Namespace, Selector: st.Selector}
+	}
+
+	return targets
+}
+
+// passthroughRoutes converts the validated passthrough routes for the dialer.
+func passthroughRoutes(cfg []config.PassthroughRouteConfig) []kube.PassthroughRoute {
+	routes := make([]kube.PassthroughRoute, 0, len(cfg))
+	for _, rc := range cfg {
+		r := kube.PassthroughRoute{Match: rc.Match, Listeners: rc.Listeners, Users: rc.Users, Label: rc.Label}
+		if rc.ProxyProtocol != "" {
+			r.ProxyProtocol, _ = proxyproto.ParseVersion(rc.ProxyProtocol)
+		}
+
+		routes = append(routes, r)
+	}
+
+	return routes
+}
+
+// upstreamRoutes converts the validated routes for the dialers, exiting if a
+// CA file can't be read.
+func upstreamRoutes(cfg []config.RouteConfig, logger *slog.Logger) kube.Routes {
+	routes := make(kube.Routes, 0, len(cfg))
+
+	for _, rc := range cfg {
+		r := kube.Route{
+			Match:             rc.Match,
+			Protocol:          kube.Protocol(rc.Protocol),
+			ClientKeepalive:   rc.Keepalive.Client,
+			UpstreamKeepalive: rc.Keepalive.Upstream,
+			PairedPorts:       rc.PairedPorts,
+		}
+
+		if rc.TLS.Enabled {
+			r.TLS = &tls.Config{
+				ServerName:         rc.TLS.ServerName,
+				InsecureSkipVerify: rc.TLS.InsecureSkipVerify, //nolint:gosec // opted into per route
+				MinVersion:         tls.VersionTLS12,
+			}
+
+			// the HTTP proxy and clients speak HTTP/1.1 over the tunnel.
+			if r.Protocol == kube.ProtocolHTTPS {
+				r.TLS.NextProtos = []string{"http/1.1"}
+			}
+
+			if rc.TLS.CertificateAuthority != "" {
+				pem, err := os.ReadFile(rc.TLS.CertificateAuthority)
+				if err != nil {
+					logger.Error("reading route CA file", "match", rc.Match, "error", err)
+					os.Exit(1)
+				}
+
+				r.TLS.RootCAs = x509.NewCertPool()
+				if !r.TLS.RootCAs.AppendCertsFromPEM(pem) {
+					logger.Error("route CA file has no PEM certificates", "match", rc.Match, "file", rc.TLS.CertificateAuthority)
+					os.Exit(1)
+				}
+			}
+		}
+
+		routes = append(routes, r)
+	}
+
+	return routes
+}
+
+// userNamespaces returns the dialers' lookup of the per-user default
+// namespaces, or nil if none are configured.
+func userNamespaces(namespaces map[string]string) func(user string) string {
+	if len(namespaces) == 0 {
+		return nil
+	}
+
+	return func(user string) string { return namespaces[user] }
+}
+
+// accessPolicy converts a validated access config to the policy enforced by
+// the cluster's forwarder.
+func accessPolicy(cfg config.AccessConfig, onCall *kube.OnCallFlag) *kube.AccessPolicy {
+	policy := &kube.AccessPolicy{}
+
+	for _, w := range cfg.Windows {
+		days, from, to, _ := w.Parse()
+		policy.Windows = append(policy.Windows, kube.AccessWindow{Days: days, From: from, To: to})
+	}
+
+	if cfg.Timezone != "" {
+		policy.Location, _ = time.LoadLocation(cfg.Timezone)
+	}
+
+	if config.Enabled(cfg.OnCall) {
+		policy.OnCall = onCall.OnCall
+	}
+
+	return policy
+}
+
+// newVaultCredentials returns the Vault credential source of a cluster, or
+// nil if its credentials come from the kubeconfig.
+func newVaultCredentials(rc config.ResolvedCluster, logger *slog.Logger) (*kube.VaultCredentials, error) {
+	v := rc.Settings.Vault
+	if v.Role == "" {
+		return nil, nil
+	}
+
+	address := cmp.Or(v.Address, os.Getenv("VAULT_ADDR"))
+	if address == "" {
+		return nil, errors.New("vault.address is required when VAULT_ADDR is not set")
+	}
+
+	return &kube.VaultCredentials{
+		Address:   address,
+		Mount:     v.Mount,
+		Role:      v.Role,
+		Namespace: cmp.Or(v.KubernetesNamespace, rc.Namespace, "default"),
+		TTL:       v.TTL,
+		TokenFile: v.TokenFile,
+		Logger:    logger,
+	}, nil
+}
+
+// authStore returns the credential store of the configured authentication
+// provider, exiting if it can't be set up. Returns nil when authentication is
+// disabled.
+func authStore(cfg config.AuthConfig, logger *slog.Logger) auth.Store {
+	var provider auth.Provider
+
+	switch {
+	case cfg.LDAP.URL != "":
+		provider = newLDAPProvider(cfg.LDAP, logger)
+	case cfg.Htpasswd.File != "":
+		htpasswd, err := auth.NewHtpasswd(cfg.Htpasswd.File, logger.With("component", "htpasswd"))
+		if err != nil {
+			logger.Error("loading htpasswd file", "error", err)
+			os.Exit(1)
+		}
+
+		provider = htpasswd
+	case cfg.OIDC.Issuer != "":
+		provider = &auth.OIDC{
+			Issuer:        cfg.OIDC.Issuer,
+			ClientID:      cfg.OIDC.ClientID,
+			UsernameClaim: cfg.OIDC.UsernameClaim,
+			GroupsClaim:   cfg.OIDC.GroupsClaim,
+		}
+	case len(cfg.Users) > 0:
+		users := make(auth.Users, len(cfg.Users))
+		for _, u := range cfg.Users {
+			users[u.Username] = auth.User{
+				Password: u.Password,
+				Impersonate: auth.Impersonation{
+					User:   u.Impersonate.User,
+					Groups: u.Impersonate.Groups,
+				},
+			}
+		}
+
+		provider = users
+	default:
+		return nil
+	}
+
+	return auth.NewAuthenticator(provider, logger.With("component", "auth"))
+}
+
+// newLDAPProvider returns a provider verifying credentials against the
+// directory, exiting if the CA file can't be read.
+func newLDAPProvider(cfg config.LDAPConfig, logger *slog.Logger) *auth.LDAP {
+	store := &auth.LDAP{
+		URL:            cfg.URL,
+		Plaintext:      cfg.InsecurePlaintext,
+		BindDN:         cfg.BindDN,
+		BindPassword:   cfg.BindPassword,
+		BaseDN:         cfg.BaseDN,
+		UserAttribute:  cfg.UserAttribute,
+		GroupAttribute: cfg.GroupAttribute,
+		Groups:         cfg.Groups,
+		CacheTTL:       cfg.CacheTTL,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			logger.Error("reading ldap CA file", "error", err)
+			os.Exit(1)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			logger.Error("ldap CA file has no PEM certificates", "file", cfg.CAFile)
+			os.Exit(1)
+		}
+
+		store.TLSConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return store
+}
+
+// adminUsers converts the configured admin users into a credential store.
+// Returns nil when the admin listener is unauthenticated.
+func adminUsers(cfg config.AdminConfig) auth.Users {
+	if len(cfg.Users) == 0 {
+		return nil
+	}
+
+	users := make(auth.Users, len(cfg.Users))
+	for _, u := range cfg.Users {
+		users[u.Username] = auth.User{Password: u.Password}
+	}
+
+	return users
+}
+
+// adminRoles returns the roles of the configured admin users.
+func adminRoles(cfg config.AdminConfig) func(user string) admin.Role {
+	roles := make(map[string]admin.Role, len(cfg.Users))
+	for _, u := range cfg.Users {
+		roles[u.Username] = admin.Role(u.Role)
+	}
+
+	return func(user string) admin.Role {
+		return roles[user]
+	}
+}
+
+// isLoopbackAddress reports whether the listen address only accepts
+// connections from the local host.
+func isLoopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
 }
 
 func clusterNames(clusters []config.ResolvedCluster) []string {
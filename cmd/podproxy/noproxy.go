@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/kube"
+)
+
+// noProxyList returns the entries clients should exclude from proxying:
+// loopback, the hosts clients reach podproxy's own listeners under, the
+// clusters' API servers and cfg.NoProxy, in that order and without
+// duplicates. Everything else reaches podproxy, which passes non-cluster
+// addresses through. clientAddr maps a listen address to the address
+// clients connect to.
+func noProxyList(cfg *config.Config, clientAddr func(string) string, apiServers []string) []string {
+	entries := []string{"localhost", "127.0.0.1", "::1"}
+
+	listenAddrs := []string{cfg.ListenAddress, cfg.HTTPListenAddress, cfg.PACListenAddress, cfg.AdminListenAddress}
+	for _, l := range cfg.Listeners {
+		listenAddrs = append(listenAddrs, l.Address)
+	}
+
+	for _, addr := range listenAddrs {
+		if addr == "" {
+			continue
+		}
+
+		if host, _, err := net.SplitHostPort(clientAddr(addr)); err == nil && host != "" {
+			entries = append(entries, host)
+		}
+	}
+
+	entries = append(entries, apiServers...)
+	entries = append(entries, cfg.NoProxy...)
+
+	var unique []string
+
+	for _, e := range entries {
+		if !slices.Contains(unique, e) {
+			unique = append(unique, e)
+		}
+	}
+
+	return unique
+}
+
+// apiServerHosts returns the hosts of the clusters' API servers, sorted, so
+// kubectl and client libraries under a proxy environment talk to them
+// directly rather than through passthrough.
+func apiServerHosts(forwarders map[string]*kube.PortForwarder) []string {
+	var hosts []string
+
+	for _, fwd := range forwarders {
+		server := fwd.Config.Host
+		if !strings.Contains(server, "://") {
+			server = "https://" + server
+		}
+
+		if u, err := url.Parse(server); err == nil && u.Hostname() != "" {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+
+	slices.Sort(hosts)
+
+	return slices.Compact(hosts)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log/slog"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/kube"
+	"github.com/entwico/podproxy/internal/notify"
+)
+
+// connectNotifyInterval is how often opening connections to the same address
+// notifies, so a client opening a pool of connections shows one.
+const connectNotifyInterval = time.Minute
+
+// setupNotifications sets the callbacks of the forwarders that show desktop
+// notifications for the events enabled in cfg.
+func setupNotifications(cfg config.NotificationsConfig, forwarders map[string]*kube.PortForwarder, logger *slog.Logger) {
+	connect := &connectNotifier{logger: logger, last: make(map[string]time.Time)}
+
+	for name, fwd := range forwarders {
+		if slices.Contains(cfg.Events, "loginRequired") {
+			fwd.OnLoginRequired = notifyLoginRequired(logger)
+		}
+
+		if slices.Contains(cfg.Events, "clusterUnreachable") {
+			fwd.OnUnreachable = notifyUnreachable(logger)
+		}
+
+		if slices.Contains(cfg.Events, "connectionOpened") && matchesCluster(cfg.Connections, name) {
+			fwd.OnConnect = connect.notify
+		}
+	}
+}
+
+// matchesCluster reports whether name matches one of patterns, or patterns
+// is empty.
+func matchesCluster(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(patterns, func(p string) bool {
+		ok, _ := path.Match(p, name)
+		return ok
+	})
+}
+
+// notifyUnreachable shows a desktop notification that the cluster can't be
+// reached.
+func notifyUnreachable(logger *slog.Logger) func(cluster string, err error) {
+	return func(cluster string, err error) {
+		body := "Connections to " + cluster + " fail: " + err.Error()
+
+		if err := notify.Send("podproxy: cluster unreachable", body); err != nil {
+			logger.Warn("failed to show unreachable notification", "cluster", cluster, "error", err)
+		}
+	}
+}
+
+// connectNotifier shows a desktop notification when a connection is opened,
+// at most once per connectNotifyInterval and address.
+type connectNotifier struct {
+	logger *slog.Logger
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func (n *connectNotifier) notify(cluster, addr, target, user string) {
+	now := time.Now()
+
+	n.mu.Lock()
+	if now.Sub(n.last[addr]) < connectNotifyInterval {
+		n.mu.Unlock()
+		return
+	}
+
+	for a, t := range n.last {
+		if now.Sub(t) >= connectNotifyInterval {
+			delete(n.last, a)
+		}
+	}
+
+	n.last[addr] = now
+	n.mu.Unlock()
+
+	body := addr + " → " + target
+	if user != "" {
+		body += " for " + user
+	}
+
+	// the notification tool takes a while to start; the connection
+	// shouldn't wait for it.
+	go func() {
+		if err := notify.Send("podproxy: connection to "+cluster+" opened", body); err != nil {
+			n.logger.Warn("failed to show connection notification", "cluster", cluster, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/entwico/podproxy/internal/kube"
+)
+
+// probeClusters probes the API server of every cluster in parallel. A
+// non-zero timeout bounds each probe. Results are sorted by cluster name.
+func probeClusters(ctx context.Context, forwarders map[string]*kube.PortForwarder, timeout time.Duration) []kube.ProbeResult {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make([]kube.ProbeResult, 0, len(forwarders))
+	)
+
+	for _, fwd := range forwarders {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			probeCtx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				probeCtx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			res := fwd.Probe(probeCtx)
+
+			mu.Lock()
+			results = append(results, res)
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Cluster < results[j].Cluster })
+
+	return results
+}
+
+// printProbeSummary writes the probe results as a table.
+func printProbeSummary(w io.Writer, results []kube.ProbeResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "CLUSTER\tREACHABLE\tLATENCY\tAUTH\tERROR")
+
+	for _, res := range results {
+		reachable, errText := "yes", ""
+		if !res.Reachable {
+			reachable, errText = "no", res.Err.Error()
+		}
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", res.Cluster, reachable, res.Latency.Round(time.Millisecond), res.AuthMethod, errText)
+	}
+
+	_ = tw.Flush()
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/entwico/podproxy/internal/admin"
+	"github.com/entwico/podproxy/internal/config"
+)
+
+// runRun implements the "run" subcommand, running a command with the proxy
+// variables pointing at podproxy:
+//
+//	podproxy run -- ./integration-tests.sh
+//
+// A running instance is used when its SOCKS5 listener is reachable;
+// otherwise podproxy starts one for the lifetime of the command. It exits
+// with the command's exit status.
+func runRun(args []string) {
+	fs := pflag.NewFlagSet("run", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	user := fs.String("user", "", "proxy username to embed in the proxy URLs (password from PODPROXY_PASSWORD)")
+	logPath := fs.String("log", "", "file receiving the output of a started instance (default: "+defaultDaemonLog+")")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: podproxy run [flags] -- COMMAND [ARG...]")
+		fs.PrintDefaults()
+	}
+
+	// flags after the command belong to it.
+	fs.SetInterspersed(false)
+
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	var instance *runInstance
+
+	if addr := instanceSOCKSAddress(cfg); instanceReachable(addr) {
+		cfg.ListenAddress = addr
+	} else {
+		instance = startInstance(*configPath, *logPath)
+		cfg.ListenAddress = instance.ports.SOCKS
+		cfg.HTTPListenAddress = instance.ports.HTTP
+	}
+
+	var userinfo *url.Userinfo
+	if *user != "" {
+		userinfo = url.UserPassword(*user, os.Getenv("PODPROXY_PASSWORD"))
+	}
+
+	cmd := exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	for _, v := range proxyEnv(cfg, userinfo, loopbackAddr) {
+		cmd.Env = append(cmd.Env, v.Name+"="+v.Value)
+	}
+
+	code, err := runCommand(cmd)
+
+	if instance != nil {
+		instance.stop()
+	}
+
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	os.Exit(code)
+}
+
+// instanceSOCKSAddress returns the SOCKS5 address of the running instance,
+// read from the port file when the configured port is ephemeral.
+func instanceSOCKSAddress(cfg *config.Config) string {
+	_, port, err := net.SplitHostPort(cfg.ListenAddress)
+	if err != nil || port != "0" || cfg.PortFile == "" {
+		return cfg.ListenAddress
+	}
+
+	ports, err := admin.ReadPortFile(cfg.PortFile)
+	if err != nil || ports.SOCKS == "" {
+		return cfg.ListenAddress
+	}
+
+	return ports.SOCKS
+}
+
+// runCommand runs cmd, passing on the signals podproxy receives, and returns
+// its exit status.
+func runCommand(cmd *exec.Cmd) (int, error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	for {
+		select {
+		case sig := <-signals:
+			// a terminal Ctrl-C already reached the command through the
+			// process group; sending it again is harmless.
+			_ = cmd.Process.Signal(sig)
+		case err := <-done:
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return exitErr.ExitCode(), nil
+			}
+
+			return 0, err
+		}
+	}
+}
+
+// runInstance is a podproxy process started for "run".
+type runInstance struct {
+	cmd   *exec.Cmd
+	ports admin.Ports
+	// exited is closed when the process exits.
+	exited chan struct{}
+}
+
+// startInstance starts podproxy with the config at configPath and waits
+// until it listens.
+func startInstance(configPath, logPath string) *runInstance {
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if logPath == "" {
+		logPath = defaultDaemonLog
+	}
+
+	logPath = config.ExpandTilde(logPath)
+
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+		fatalf("%v", err)
+	}
+
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer logFile.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	cmd := exec.Command(exe, "--config", configPath, "--print-ports")
+	cmd.Dir = filepath.Dir(configPath)
+	cmd.Stderr = logFile
+	// in its own session, a Ctrl-C meant for the command doesn't stop the
+	// proxy under it.
+	cmd.SysProcAttr = detachedProcAttr()
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		fatalf("starting podproxy: %v", err)
+	}
+
+	instance := &runInstance{cmd: cmd, exited: make(chan struct{})}
+	found := make(chan admin.Ports, 1)
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			var ports admin.Ports
+			if json.Unmarshal(scanner.Bytes(), &ports) == nil && ports.SOCKS != "" {
+				found <- ports
+				break
+			}
+		}
+
+		// keep draining, so the instance never blocks writing to stdout.
+		_, _ = io.Copy(io.Discard, stdout)
+	}()
+
+	go func() {
+		_ = cmd.Wait()
+		close(instance.exited)
+	}()
+
+	select {
+	case instance.ports = <-found:
+		return instance
+	case <-instance.exited:
+		fatalf("podproxy exited during startup, see %s", logPath)
+	case <-time.After(daemonStartTimeout):
+		instance.stop()
+		fatalf("podproxy did not start within %s, see %s", daemonStartTimeout, logPath)
+	}
+
+	return nil
+}
+
+// stop terminates the instance, and kills it if it doesn't exit within
+// daemonStopTimeout.
+func (i *runInstance) stop() {
+	_ = terminateProcess(i.cmd.Process)
+
+	select {
+	case <-i.exited:
+	case <-time.After(daemonStopTimeout):
+		_ = i.cmd.Process.Kill()
+		<-i.exited
+	}
+}
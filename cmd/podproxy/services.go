@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/entwico/podproxy/internal/admin"
+	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/kube"
+)
+
+// serviceCatalog serves the informer-cached Services of a kube.ServiceCatalog
+// on the admin API, grouped by namespace.
+type serviceCatalog struct {
+	catalog *kube.ServiceCatalog
+}
+
+func (c serviceCatalog) Services(cluster, namespace string) []admin.ClusterServices {
+	clusters := c.catalog.Clusters()
+
+	if cluster != "" {
+		if !slices.Contains(clusters, cluster) {
+			return nil
+		}
+
+		clusters = []string{cluster}
+	}
+
+	out := make([]admin.ClusterServices, 0, len(clusters))
+
+	for _, name := range clusters {
+		cs := admin.ClusterServices{Cluster: name, Synced: c.catalog.Synced(name), Namespaces: []admin.NamespaceServices{}}
+
+		// services are sorted by namespace, so each namespace is contiguous.
+		for _, svc := range c.catalog.Services(name, namespace) {
+			if n := len(cs.Namespaces); n == 0 || cs.Namespaces[n-1].Namespace != svc.Namespace {
+				cs.Namespaces = append(cs.Namespaces, admin.NamespaceServices{Namespace: svc.Namespace})
+			}
+
+			ports := make([]admin.ServicePort, 0, len(svc.Ports))
+			for _, p := range svc.Ports {
+				ports = append(ports, admin.ServicePort{Name: p.Name, Port: p.Port, Protocol: p.Protocol})
+			}
+
+			ns := &cs.Namespaces[len(cs.Namespaces)-1]
+			ns.Services = append(ns.Services, admin.Service{Name: svc.Name, Address: svc.Addr(), Ports: ports})
+		}
+
+		out = append(out, cs)
+	}
+
+	return out
+}
+
+// serviceMembers lists the pods behind a headless Service for the admin API,
+// with the address each is reachable at.
+func serviceMembers(ctx context.Context, forwarders map[string]*kube.PortForwarder, cluster, namespace, service string) ([]admin.Member, error) {
+	fwd := forwarders[cluster]
+	if fwd == nil {
+		return nil, fmt.Errorf("%w: cluster %s", admin.ErrNotFound, cluster)
+	}
+
+	if namespace == "" {
+		namespace = fwd.DefaultNamespace
+	}
+
+	members, err := fwd.Members(ctx, namespace, service)
+	if errors.Is(err, kube.ErrServiceNotFound) || errors.Is(err, kube.ErrNotHeadless) {
+		return nil, fmt.Errorf("%w: %w", admin.ErrNotFound, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]admin.Member, 0, len(members))
+	for _, m := range members {
+		out = append(out, admin.Member{
+			Pod:      m.Pod,
+			Address:  strings.Join([]string{m.Pod, service, namespace, cluster}, "."),
+			Hostname: m.Hostname,
+			Ready:    m.Ready,
+		})
+	}
+
+	return out, nil
+}
+
+// routedHostnames returns the hostnames podproxy currently routes, sorted:
+// the cluster names, the address of every discovered Service (also without
+// the namespace for the cluster's default namespace) and the Ingress
+// hostnames. catalog and router may be nil.
+func routedHostnames(ctx context.Context, forwarders map[string]*kube.PortForwarder, catalog *kube.ServiceCatalog, router *kube.IngressRouter) []string {
+	var hostnames []string
+
+	for name, fwd := range forwarders {
+		hostnames = append(hostnames, name)
+
+		if catalog == nil {
+			continue
+		}
+
+		for _, svc := range catalog.Services(name, "") {
+			hostnames = append(hostnames, svc.Addr())
+
+			if svc.Namespace == fwd.DefaultNamespace {
+				hostnames = append(hostnames, svc.Name+"."+name)
+			}
+		}
+	}
+
+	if router != nil {
+		for _, h := range router.Hostnames(ctx) {
+			// wildcards are patterns, not hostnames.
+			if !strings.HasPrefix(h, "*.") {
+				hostnames = append(hostnames, h)
+			}
+		}
+	}
+
+	slices.Sort(hostnames)
+
+	return slices.Compact(hostnames)
+}
+
+// runHostnames implements the "hostnames" subcommand, printing the hostnames
+// the running instance routes, for shell completion and editor plugins.
+func runHostnames(args []string) {
+	fs := pflag.NewFlagSet("hostnames", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if cfg.AdminListenAddress == "" {
+		fatalf("the admin listener is disabled (set adminListenAddress in the config)")
+	}
+
+	hostnames, err := newAdminClient(cfg).Hostnames(context.Background(), fs.Arg(0))
+	if admin.IsUnreachable(err) {
+		fatalf("podproxy is not running (no admin listener at %s)", adminAddress(cfg))
+	}
+
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	for _, h := range hostnames {
+		fmt.Println(h)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/sysproxy"
+)
+
+// runSysproxy implements the "sysproxy" subcommand, pointing the desktop
+// proxy settings at the configured listeners or switching them off. Unlike
+// systemProxy.enabled, the settings persist after podproxy exits.
+func runSysproxy(args []string) {
+	fs := pflag.NewFlagSet("sysproxy", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	mode := fs.String("mode", "", "pac or static (default: systemProxy.mode from the config)")
+
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: podproxy sysproxy [flags] enable|disable")
+		os.Exit(2)
+	}
+
+	switch fs.Arg(0) {
+	case "enable":
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fatalf("%v", err)
+		}
+
+		if *mode != "" {
+			cfg.SystemProxy.Mode = *mode
+		}
+
+		cfg.SystemProxy.Enabled = true
+		if err := cfg.Validate(); err != nil {
+			fatalf("%v", err)
+		}
+
+		settings := systemProxySettings(cfg)
+		if _, err := sysproxy.Apply(settings); err != nil {
+			fatalf("%v", err)
+		}
+
+		if settings.PACURL != "" {
+			fmt.Printf("system proxy uses %s\n", settings.PACURL)
+		} else {
+			fmt.Println("system proxy uses podproxy for all traffic")
+		}
+	case "disable":
+		if err := sysproxy.Disable(); err != nil {
+			fatalf("%v", err)
+		}
+
+		fmt.Println("system proxy disabled")
+	default:
+		fatalf("unknown action %q (expected enable or disable)", fs.Arg(0))
+	}
+}
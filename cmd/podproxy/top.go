@@ -0,0 +1,181 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/entwico/podproxy/internal/admin"
+	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/kube"
+)
+
+// topTarget is one row of "podproxy top": the open connections to an
+// address and their throughput since the previous sample.
+type topTarget struct {
+	Cluster string
+	Addr    string
+	Conns   int
+	// RxRate and TxRate are in bytes per second.
+	RxRate, TxRate float64
+	Rx, Tx         int64
+}
+
+// runTop implements the "top" subcommand, a live view of the running
+// instance's targets sorted by current throughput and connection count,
+// refreshed until interrupted.
+func runTop(args []string) {
+	fs := pflag.NewFlagSet("top", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	cluster := fs.String("cluster", "", "only show targets of this cluster")
+	interval := fs.DurationP("interval", "d", 2*time.Second, "refresh interval")
+	limit := fs.IntP("limit", "n", 20, "number of targets to show (0 for all)")
+
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if cfg.AdminListenAddress == "" {
+		fatalf("the admin listener is disabled (set adminListenAddress in the config)")
+	}
+
+	if *interval <= 0 {
+		fatalf("--interval must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	client := newAdminClient(cfg)
+
+	var (
+		prev     map[uint64]admin.Connection
+		prevTime time.Time
+	)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		conns, err := client.Connections(ctx, *cluster)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if admin.IsUnreachable(err) {
+			fatalf("podproxy is not running (no admin listener at %s)", adminAddress(cfg))
+		}
+
+		if err != nil {
+			fatalf("%v", err)
+		}
+
+		now := time.Now()
+		targets := topTargets(prev, conns, prevTime, now.Sub(prevTime))
+
+		// clear the screen and move the cursor home before redrawing.
+		fmt.Print("\033[H\033[2J")
+		printTop(os.Stdout, now, len(conns), targets, *limit)
+
+		prev = make(map[uint64]admin.Connection, len(conns))
+		for _, c := range conns {
+			prev[c.ID] = c
+		}
+
+		prevTime = now
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// topTargets groups conns by cluster and address, with the bytes they
+// transferred since the previous sample at prevTime, elapsed ago, as rates.
+// Connections opened since the previous sample count with all their bytes;
+// on the first sample, without prev, all rates are zero.
+func topTargets(prev map[uint64]admin.Connection, conns []admin.Connection, prevTime time.Time, elapsed time.Duration) []topTarget {
+	type key struct{ cluster, addr string }
+
+	byKey := make(map[key]*topTarget)
+
+	var targets []*topTarget
+
+	for _, c := range conns {
+		k := key{c.Cluster, c.Addr}
+
+		t := byKey[k]
+		if t == nil {
+			t = &topTarget{Cluster: c.Cluster, Addr: c.Addr}
+			byKey[k] = t
+			targets = append(targets, t)
+		}
+
+		t.Conns++
+		t.Rx += c.BytesRead
+		t.Tx += c.BytesWritten
+
+		if prev == nil || elapsed <= 0 {
+			continue
+		}
+
+		before, seen := prev[c.ID]
+		if !seen && c.Start.Before(prevTime) {
+			// opened before the previous sample but missed by it.
+			continue
+		}
+
+		t.RxRate += float64(c.BytesRead-before.BytesRead) / elapsed.Seconds()
+		t.TxRate += float64(c.BytesWritten-before.BytesWritten) / elapsed.Seconds()
+	}
+
+	out := make([]topTarget, 0, len(targets))
+	for _, t := range targets {
+		out = append(out, *t)
+	}
+
+	slices.SortFunc(out, func(a, b topTarget) int {
+		return cmp.Or(
+			cmp.Compare(b.RxRate+b.TxRate, a.RxRate+a.TxRate),
+			cmp.Compare(b.Conns, a.Conns),
+			cmp.Compare(a.Cluster, b.Cluster),
+			cmp.Compare(a.Addr, b.Addr),
+		)
+	})
+
+	return out
+}
+
+// printTop writes a header line and the first limit targets as a table.
+func printTop(w io.Writer, now time.Time, conns int, targets []topTarget, limit int) {
+	_, _ = fmt.Fprintf(w, "podproxy top - %s - %d connections to %d targets\n\n", now.Format(time.TimeOnly), conns, len(targets))
+
+	if limit > 0 && len(targets) > limit {
+		targets = targets[:limit]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "CLUSTER\tTARGET\tCONNS\tRX/S\tTX/S\tRX\tTX")
+
+	for _, t := range targets {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", t.Cluster, t.Addr, t.Conns,
+			kube.FormatBytes(int64(t.RxRate)), kube.FormatBytes(int64(t.TxRate)), kube.FormatBytes(t.Rx), kube.FormatBytes(t.Tx))
+	}
+
+	_ = tw.Flush()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+
+	"github.com/entwico/podproxy/internal/admin"
+	"github.com/entwico/podproxy/internal/config"
+	"github.com/entwico/podproxy/internal/kube"
+)
+
+// runTraffic implements the "traffic" subcommand, printing the bytes the
+// running instance transferred per cluster and namespace since it started.
+func runTraffic(args []string) {
+	fs := pflag.NewFlagSet("traffic", pflag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to YAML config file")
+	cluster := fs.String("cluster", "", "only show namespaces of this cluster")
+
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if cfg.AdminListenAddress == "" {
+		fatalf("the admin listener is disabled (set adminListenAddress in the config)")
+	}
+
+	namespaces, err := newAdminClient(cfg).Traffic(context.Background(), *cluster)
+	if admin.IsUnreachable(err) {
+		fatalf("podproxy is not running (no admin listener at %s)", adminAddress(cfg))
+	}
+
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	printTraffic(os.Stdout, namespaces)
+}
+
+// printTraffic writes the traffic by namespace as a table.
+func printTraffic(w io.Writer, namespaces []admin.NamespaceTraffic) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "CLUSTER\tNAMESPACE\tCONNS\tACTIVE\tRX\tTX\tTOTAL")
+
+	for _, nt := range namespaces {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n", nt.Cluster, nt.Namespace, nt.Connections, nt.Active,
+			kube.FormatBytes(nt.BytesRead), kube.FormatBytes(nt.BytesWritten), kube.FormatBytes(nt.BytesRead+nt.BytesWritten))
+	}
+
+	_ = tw.Flush()
+}
+
+// namespaceTraffic converts the traffic accounting for the admin API.
+func namespaceTraffic(traffic *kube.Traffic) []admin.NamespaceTraffic {
+	namespaces := traffic.Namespaces()
+
+	out := make([]admin.NamespaceTraffic, 0, len(namespaces))
+	for _, nt := range namespaces {
+		out = append(out, admin.NamespaceTraffic{
+			Cluster:      nt.Cluster,
+			Namespace:    nt.Namespace,
+			BytesRead:    nt.BytesRead,
+			BytesWritten: nt.BytesWritten,
+			Connections:  nt.Connections,
+			Active:       nt.Active,
+		})
+	}
+
+	return out
+}
+
+// openConnections converts the open connections for the admin API.
+func openConnections(traffic *kube.Traffic) []admin.Connection {
+	conns := traffic.Open()
+
+	out := make([]admin.Connection, 0, len(conns))
+	for _, c := range conns {
+		out = append(out, adminConnection(c))
+	}
+
+	return out
+}
+
+func adminConnection(c kube.OpenConn) admin.Connection {
+	return admin.Connection{
+		ID:           c.ID,
+		Cluster:      c.Cluster,
+		Namespace:    c.Namespace,
+		Addr:         c.Addr,
+		Target:       c.Target,
+		User:         c.User,
+		Start:        c.Start,
+		BytesRead:    c.BytesRead,
+		BytesWritten: c.BytesWritten,
+		Idle:         c.Idle,
+	}
+}
+
+// closeConnections revokes the open connections filter selects.
+func closeConnections(traffic *kube.Traffic, filter admin.ConnectionFilter, reason string) int {
+	return traffic.Revoke(func(c kube.OpenConn) error {
+		if !filter.Matches(adminConnection(c)) {
+			return nil
+		}
+
+		return errors.New(reason)
+	})
+}
+
+// revokingOnCall is the on-call switch of the admin API. Clearing it closes
+// the connections only the flag allowed, instead of leaving them open until
+// the clients disconnect.
+type revokingOnCall struct {
+	*kube.OnCallFlag
+
+	traffic    *kube.Traffic
+	forwarders map[string]*kube.PortForwarder
+	logger     *slog.Logger
+}
+
+func (o revokingOnCall) SetOnCall(on bool) {
+	o.OnCallFlag.SetOnCall(on)
+
+	if on {
+		return
+	}
+
+	if n := o.traffic.RevokeDenied(o.forwarders); n > 0 {
+		o.logger.Warn("closed connections outside their access windows", "connections", n)
+	}
+}
@@ -0,0 +1,219 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/entwico/podproxy/internal/history"
+	"github.com/entwico/podproxy/internal/metrics"
+)
+
+// CredentialStore validates admin credentials.
+type CredentialStore interface {
+	Valid(user, password, userAddr string) bool
+}
+
+// Role is the access an admin user has.
+type Role string
+
+const (
+	// RoleAdmin has full access, the default.
+	RoleAdmin Role = "admin"
+	// RoleObserver may only read: it can view clusters, connections, logs
+	// and metrics, but not close connections or change state.
+	RoleObserver Role = "observer"
+)
+
+// Server serves the admin API, Prometheus metrics and, optionally, the Go
+// runtime profiler.
+type Server struct {
+	History history.Store
+	Logger  *slog.Logger
+
+	// Credentials, if set, requires Basic authentication on every endpoint.
+	Credentials CredentialStore
+	// Roles, if set, returns the role of an authenticated user. Users
+	// without one are admins.
+	Roles func(user string) Role
+	// Pprof exposes the runtime profiler under /debug/pprof/.
+	Pprof bool
+	// Ports, if set, is served under /api/ports.
+	Ports *Ports
+	// Logs, if set, is served under /api/logs.
+	Logs *LogBuffer
+	// Services, if set, is served under /api/services.
+	Services ServiceCatalog
+	// Hostnames, if set, returns the hostnames served under /api/hostnames,
+	// sorted.
+	Hostnames func(ctx context.Context) []string
+	// Members, if set, lists the pods behind a headless Service, served
+	// under /api/members. Errors for unknown clusters or Services wrap
+	// ErrNotFound.
+	Members func(ctx context.Context, cluster, namespace, service string) ([]Member, error)
+	// NoProxy, if set, returns the entries served under /api/noproxy: hosts,
+	// domains and CIDRs clients should not send through the proxy.
+	NoProxy func() []string
+	// Logins, if set, returns the clusters served under /api/logins, sorted.
+	Logins func() []Login
+	// Health, if set, returns the unhealthy targets served under
+	// /api/health, sorted.
+	Health func() []UnhealthyTarget
+	// Breakers, if set, returns the tripped circuit breakers served under
+	// /api/breakers, sorted.
+	Breakers func() []Breaker
+	// Clusters, if set, returns the reachability of the clusters served
+	// under /api/clusters, sorted by name.
+	Clusters func() []Cluster
+	// Traffic, if set, returns the namespaces served under /api/traffic,
+	// most bytes first.
+	Traffic func() []NamespaceTraffic
+	// Connections, if set, returns the open cluster connections served under
+	// /api/connections.
+	Connections func() []Connection
+	// TraceConnection, if set, turns tracing of the open connection with the
+	// given ID on or off, reporting false if it isn't open.
+	TraceConnection func(id uint64, on bool) bool
+	// CloseConnections, if set, closes the open connections the filter
+	// selects, recording reason, and returns how many it closed.
+	CloseConnections func(filter ConnectionFilter, reason string) int
+	// OnCall, if set, is served under /api/oncall.
+	OnCall OnCallSwitch
+
+	initOnce sync.Once
+	mux      *http.ServeMux
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.initOnce.Do(func() {
+		s.mux = s.routes()
+	})
+
+	if s.Credentials != nil {
+		user, password, ok := r.BasicAuth()
+		if !ok || !s.Credentials.Valid(user, password, r.RemoteAddr) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="podproxy admin"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+
+			return
+		}
+
+		if s.role(user) == RoleObserver && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "read-only access: the observer role cannot change state", http.StatusForbidden)
+			return
+		}
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// role returns the role of the authenticated user.
+func (s *Server) role(user string) Role {
+	if s.Roles == nil {
+		return RoleAdmin
+	}
+
+	if role := s.Roles(user); role != "" {
+		return role
+	}
+
+	return RoleAdmin
+}
+
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /api/history", s.handleHistory)
+	mux.HandleFunc("GET /api/ports", s.handlePorts)
+	mux.HandleFunc("GET /api/logs", s.handleLogs)
+	mux.HandleFunc("GET /api/services", s.handleServices)
+	mux.HandleFunc("GET /api/hostnames", s.handleHostnames)
+	mux.HandleFunc("GET /api/members", s.handleMembers)
+	mux.HandleFunc("GET /api/noproxy", s.handleNoProxy)
+	mux.HandleFunc("GET /api/logins", s.handleLogins)
+	mux.HandleFunc("GET /api/health", s.handleHealth)
+	mux.HandleFunc("GET /api/breakers", s.handleBreakers)
+	mux.HandleFunc("GET /api/clusters", s.handleClusters)
+	mux.HandleFunc("GET /api/traffic", s.handleTraffic)
+	mux.HandleFunc("GET /api/connections", s.handleConnections)
+	mux.HandleFunc("PUT /api/connections/{id}/trace", s.handleTraceConnection)
+	mux.HandleFunc("DELETE /api/connections", s.handleCloseConnections)
+	mux.HandleFunc("DELETE /api/connections/{id}", s.handleCloseConnection)
+	mux.HandleFunc("GET /api/oncall", s.handleOnCall)
+	mux.HandleFunc("PUT /api/oncall", s.handleSetOnCall)
+
+	if s.Pprof {
+		mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+		mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	}
+
+	return mux
+}
+
+// handleHistory returns connection history records as a JSON array. Query
+// parameters: since (Go duration), cluster, namespace, user.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if s.History == nil {
+		http.Error(w, "connection history is disabled", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := history.Filter{
+		Cluster:   q.Get("cluster"),
+		Namespace: q.Get("namespace"),
+		User:      q.Get("user"),
+	}
+
+	if since := q.Get("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if d > 0 {
+			filter.Since = time.Now().Add(-d)
+		}
+	}
+
+	records, err := s.History.Query(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if records == nil {
+		records = []history.Record{}
+	}
+
+	writeJSON(w, records, s.Logger)
+}
+
+// handlePorts returns the bound listener addresses.
+func (s *Server) handlePorts(w http.ResponseWriter, _ *http.Request) {
+	if s.Ports == nil {
+		http.Error(w, "listener ports are not available", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, s.Ports, s.Logger)
+}
+
+func writeJSON(w http.ResponseWriter, v any, logger *slog.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil && logger != nil {
+		logger.Warn("writing admin response", "error", err)
+	}
+}
@@ -0,0 +1,634 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/history"
+)
+
+// memoryHistory is an in-memory history.Store for tests.
+type memoryHistory struct {
+	records []history.Record
+}
+
+func (m *memoryHistory) Append(r history.Record) error {
+	m.records = append(m.records, r)
+	return nil
+}
+
+func (m *memoryHistory) Query(f history.Filter) ([]history.Record, error) {
+	var out []history.Record
+
+	for _, r := range m.records {
+		if f.Match(r) {
+			out = append(out, r)
+		}
+	}
+
+	return out, nil
+}
+
+func (m *memoryHistory) Close() error { return nil }
+
+func TestHistoryEndpoint(t *testing.T) {
+	store := &memoryHistory{records: []history.Record{
+		{Start: time.Now().Add(-48 * time.Hour), Cluster: "production"},
+		{Start: time.Now().Add(-time.Hour), Cluster: "production", User: "alice"},
+		{Start: time.Now().Add(-time.Hour), Cluster: "staging"},
+	}}
+
+	srv := httptest.NewServer(&Server{History: store})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	records, err := client.History(context.Background(), 24*time.Hour, history.Filter{Cluster: "production"})
+	if err != nil {
+		t.Fatalf("History() error: %v", err)
+	}
+
+	if len(records) != 1 || records[0].User != "alice" {
+		t.Errorf("History() = %+v, want the single recent production record", records)
+	}
+}
+
+func TestHistoryEndpointDisabled(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&Server{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHistoryEndpointInvalidSince(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&Server{History: &memoryHistory{}}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history?since=yesterday", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&Server{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "go_goroutines") {
+		t.Errorf("status = %d, want metrics output", rec.Code)
+	}
+}
+
+func TestClientUnreachable(t *testing.T) {
+	_, err := NewClient("127.0.0.1:1").History(context.Background(), 0, history.Filter{})
+	if !IsUnreachable(err) {
+		t.Errorf("IsUnreachable(%v) = false, want true", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	srv := httptest.NewServer(&Server{
+		History:     &memoryHistory{},
+		Credentials: auth.Users{"ops": {Password: "s3cret"}},
+	})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	if _, err := client.History(context.Background(), 0, history.Filter{}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("History() without credentials error = %v, want 401", err)
+	}
+
+	client.Username, client.Password = "ops", "s3cret"
+
+	if _, err := client.History(context.Background(), 0, history.Filter{}); err != nil {
+		t.Errorf("History() with credentials error: %v", err)
+	}
+}
+
+func TestObserverRole(t *testing.T) {
+	var closed int
+
+	srv := httptest.NewServer(&Server{
+		History:     &memoryHistory{},
+		Credentials: auth.Users{"ops": {Password: "s3cret"}, "support": {Password: "hunter2"}},
+		Roles: func(user string) Role {
+			if user == "support" {
+				return RoleObserver
+			}
+
+			return ""
+		},
+		Connections: func() []Connection { return nil },
+		CloseConnections: func(ConnectionFilter, string) int {
+			closed++
+			return 1
+		},
+	})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client(), Username: "support", Password: "hunter2"}
+
+	if _, err := client.Connections(context.Background(), ""); err != nil {
+		t.Errorf("Connections() as observer error: %v", err)
+	}
+
+	if _, err := client.CloseConnections(context.Background(), ConnectionFilter{User: "alice"}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("CloseConnections() as observer error = %v, want 403", err)
+	}
+
+	client.Username, client.Password = "ops", "s3cret"
+
+	if _, err := client.CloseConnections(context.Background(), ConnectionFilter{User: "alice"}); err != nil {
+		t.Errorf("CloseConnections() as admin error: %v", err)
+	}
+
+	if closed != 1 {
+		t.Errorf("closed %d times, want once by the admin", closed)
+	}
+}
+
+func TestPprofEndpoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		pprof  bool
+		status int
+	}{
+		{name: "disabled", pprof: false, status: http.StatusNotFound},
+		{name: "enabled", pprof: true, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			(&Server{Pprof: tt.pprof}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestPortsEndpoint(t *testing.T) {
+	ports := &Ports{PID: 42, SOCKS: "127.0.0.1:53211", Listeners: []ListenerPort{{Cluster: "production", Protocol: "socks5", Address: "127.0.0.1:53212"}}}
+
+	srv := httptest.NewServer(&Server{Ports: ports})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	got, err := client.Ports(context.Background())
+	if err != nil {
+		t.Fatalf("Ports() error: %v", err)
+	}
+
+	if got.SOCKS != ports.SOCKS || len(got.Listeners) != 1 || got.Listeners[0] != ports.Listeners[0] {
+		t.Errorf("Ports() = %+v, want %+v", got, *ports)
+	}
+}
+
+func TestPortFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "podproxy.ports")
+
+	if err := WritePortFile(path, Ports{PID: 42, SOCKS: "127.0.0.1:53211"}); err != nil {
+		t.Fatalf("WritePortFile() error: %v", err)
+	}
+
+	ports, err := ReadPortFile(path)
+	if err != nil {
+		t.Fatalf("ReadPortFile() error: %v", err)
+	}
+
+	if ports.SOCKS != "127.0.0.1:53211" {
+		t.Errorf("SOCKS = %q, want 127.0.0.1:53211", ports.SOCKS)
+	}
+
+	// a file written by another process is left in place.
+	if err := RemovePortFile(path, 7); err != nil {
+		t.Fatalf("RemovePortFile() error: %v", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("port file of another process was removed: %v", err)
+	}
+
+	if err := RemovePortFile(path, 42); err != nil {
+		t.Fatalf("RemovePortFile() error: %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("port file still exists: %v", err)
+	}
+}
+
+// staticCatalog serves a fixed service list, filtered by cluster.
+type staticCatalog []ClusterServices
+
+func (c staticCatalog) Services(cluster, _ string) []ClusterServices {
+	var out []ClusterServices
+
+	for _, cs := range c {
+		if cluster == "" || cs.Cluster == cluster {
+			out = append(out, cs)
+		}
+	}
+
+	return out
+}
+
+func TestServicesEndpoint(t *testing.T) {
+	catalog := staticCatalog{
+		{Cluster: "production", Synced: true, Namespaces: []NamespaceServices{{
+			Namespace: "db",
+			Services:  []Service{{Name: "postgres", Address: "postgres.db.production", Ports: []ServicePort{{Port: 5432, Protocol: "TCP"}}}},
+		}}},
+		{Cluster: "staging"},
+	}
+
+	srv := httptest.NewServer(&Server{Services: catalog})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	clusters, err := client.Services(context.Background(), "production", "")
+	if err != nil {
+		t.Fatalf("Services() error: %v", err)
+	}
+
+	if len(clusters) != 1 || clusters[0].Namespaces[0].Services[0].Ports[0].Port != 5432 {
+		t.Errorf("Services() = %+v, want the production services", clusters)
+	}
+
+	rec := httptest.NewRecorder()
+	(&Server{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/services", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status without catalog = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHostnamesEndpoint(t *testing.T) {
+	srv := httptest.NewServer(&Server{Hostnames: func(context.Context) []string {
+		return []string{"postgres.db.production", "production", "redis.cache.staging", "staging"}
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	hostnames, err := client.Hostnames(context.Background(), "Post")
+	if err != nil {
+		t.Fatalf("Hostnames() error: %v", err)
+	}
+
+	if len(hostnames) != 1 || hostnames[0] != "postgres.db.production" {
+		t.Errorf("Hostnames() = %v, want [postgres.db.production]", hostnames)
+	}
+
+	resp, err := srv.Client().Get(srv.URL + "/api/hostnames?prefix=s")
+	if err != nil {
+		t.Fatalf("GET /api/hostnames: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "staging\n" {
+		t.Errorf("body = %q, want %q", body, "staging\n")
+	}
+}
+
+func TestNoProxyEndpoint(t *testing.T) {
+	srv := httptest.NewServer(&Server{NoProxy: func() []string {
+		return []string{"localhost", "127.0.0.1", ".npmjs.org", "10.0.0.0/8"}
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	entries, err := client.NoProxy(context.Background())
+	if err != nil {
+		t.Fatalf("NoProxy() error: %v", err)
+	}
+
+	if len(entries) != 4 || entries[2] != ".npmjs.org" {
+		t.Errorf("NoProxy() = %v", entries)
+	}
+
+	resp, err := srv.Client().Get(srv.URL + "/api/noproxy")
+	if err != nil {
+		t.Fatalf("GET /api/noproxy: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if want := "localhost,127.0.0.1,.npmjs.org,10.0.0.0/8\n"; string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestMembersEndpoint(t *testing.T) {
+	srv := httptest.NewServer(&Server{Members: func(_ context.Context, cluster, namespace, service string) ([]Member, error) {
+		if service != "mongo" {
+			return nil, fmt.Errorf("%w: service %s/%s", ErrNotFound, namespace, service)
+		}
+
+		return []Member{
+			{Pod: "mongo-0", Address: "mongo-0.mongo." + namespace + "." + cluster, Ready: true},
+			{Pod: "mongo-1", Address: "mongo-1.mongo." + namespace + "." + cluster},
+		}, nil
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	members, err := client.Members(context.Background(), "production", "db", "mongo")
+	if err != nil {
+		t.Fatalf("Members() error: %v", err)
+	}
+
+	if len(members) != 2 || members[1].Address != "mongo-1.mongo.db.production" || members[1].Ready {
+		t.Errorf("Members() = %+v", members)
+	}
+
+	for path, status := range map[string]int{
+		"/api/members?cluster=production&namespace=db&service=redis": http.StatusNotFound,
+		"/api/members?cluster=production":                            http.StatusBadRequest,
+	} {
+		resp, err := srv.Client().Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Errorf("GET %s status = %d, want %d", path, resp.StatusCode, status)
+		}
+	}
+}
+
+func TestLoginsEndpoint(t *testing.T) {
+	since := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	srv := httptest.NewServer(&Server{Logins: func() []Login {
+		return []Login{{Cluster: "production", Since: since, Error: "getting credentials", LoginURL: "http://localhost:8000"}}
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	logins, err := client.Logins(context.Background())
+	if err != nil {
+		t.Fatalf("Logins() error: %v", err)
+	}
+
+	if len(logins) != 1 || logins[0].Cluster != "production" || !logins[0].Since.Equal(since) || logins[0].LoginURL != "http://localhost:8000" {
+		t.Errorf("Logins() = %+v", logins)
+	}
+}
+
+func TestLoginsEndpointDisabled(t *testing.T) {
+	srv := httptest.NewServer(&Server{})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	if _, err := client.Logins(context.Background()); err == nil {
+		t.Error("Logins() error = nil, want an error when disabled")
+	}
+}
+
+func TestHealthEndpoint(t *testing.T) {
+	srv := httptest.NewServer(&Server{Health: func() []UnhealthyTarget {
+		return []UnhealthyTarget{{
+			Cluster: "production", Namespace: "cache", Target: "service/redis", Failures: 5,
+			Classes: []string{"connectionRefused"}, Endpoints: []Endpoint{{Pod: "redis-0"}},
+		}}
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	targets, err := client.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health() error: %v", err)
+	}
+
+	if len(targets) != 1 || targets[0].Target != "service/redis" || targets[0].Failures != 5 || len(targets[0].Endpoints) != 1 || targets[0].Endpoints[0].Ready {
+		t.Errorf("Health() = %+v", targets)
+	}
+}
+
+func TestBreakersEndpoint(t *testing.T) {
+	until := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	srv := httptest.NewServer(&Server{Breakers: func() []Breaker {
+		return []Breaker{{Cluster: "production", Namespace: "cache", Target: "service/redis", Failures: 3, Until: until}}
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	breakers, err := client.Breakers(context.Background())
+	if err != nil {
+		t.Fatalf("Breakers() error: %v", err)
+	}
+
+	if len(breakers) != 1 || breakers[0].Target != "service/redis" || breakers[0].Failures != 3 || !breakers[0].Until.Equal(until) {
+		t.Errorf("Breakers() = %+v", breakers)
+	}
+}
+
+func TestClustersEndpoint(t *testing.T) {
+	srv := httptest.NewServer(&Server{Clusters: func() []Cluster {
+		return []Cluster{
+			{Name: "production", Reachable: true, Latency: 20 * time.Millisecond},
+			{Name: "staging", LastError: "dial tcp: lookup api.staging.example.com: no such host"},
+		}
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	clusters, err := client.Clusters(context.Background())
+	if err != nil {
+		t.Fatalf("Clusters() error: %v", err)
+	}
+
+	if len(clusters) != 2 || !clusters[0].Reachable || clusters[0].Latency != 20*time.Millisecond || clusters[1].Reachable || clusters[1].LastError == "" {
+		t.Errorf("Clusters() = %+v", clusters)
+	}
+}
+
+// onCallFlag is an OnCallSwitch for tests.
+type onCallFlag struct{ on bool }
+
+func (f *onCallFlag) OnCall() bool      { return f.on }
+func (f *onCallFlag) SetOnCall(on bool) { f.on = on }
+
+func TestOnCallEndpoint(t *testing.T) {
+	flag := &onCallFlag{}
+
+	srv := httptest.NewServer(&Server{OnCall: flag})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	if err := client.SetOnCall(context.Background(), true); err != nil {
+		t.Fatalf("SetOnCall() error: %v", err)
+	}
+
+	if !flag.on {
+		t.Error("flag not set after SetOnCall(true)")
+	}
+
+	on, err := client.OnCall(context.Background())
+	if err != nil || !on {
+		t.Errorf("OnCall() = %v, %v, want true", on, err)
+	}
+}
+
+func TestTrafficEndpoint(t *testing.T) {
+	srv := httptest.NewServer(&Server{Traffic: func() []NamespaceTraffic {
+		return []NamespaceTraffic{
+			{Cluster: "production", Namespace: "db", BytesRead: 2048, BytesWritten: 512, Connections: 3, Active: 1},
+			{Cluster: "staging", Namespace: "web", BytesRead: 100, Connections: 1},
+		}
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	namespaces, err := client.Traffic(context.Background(), "production")
+	if err != nil {
+		t.Fatalf("Traffic() error: %v", err)
+	}
+
+	want := NamespaceTraffic{Cluster: "production", Namespace: "db", BytesRead: 2048, BytesWritten: 512, Connections: 3, Active: 1}
+	if len(namespaces) != 1 || namespaces[0] != want {
+		t.Errorf("Traffic() = %+v, want [%+v]", namespaces, want)
+	}
+}
+
+func TestConnectionsEndpoint(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	srv := httptest.NewServer(&Server{Connections: func() []Connection {
+		return []Connection{
+			{ID: 1, Cluster: "production", Namespace: "db", Addr: "postgres.db.production:5432", Target: "10.0.0.5:5432", Start: start, BytesRead: 2048, BytesWritten: 512, Idle: 90 * time.Second},
+			{ID: 2, Cluster: "staging", Namespace: "web", Addr: "web.web.staging:80", Target: "10.1.0.7:8080", Start: start},
+		}
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	conns, err := client.Connections(context.Background(), "production")
+	if err != nil {
+		t.Fatalf("Connections() error: %v", err)
+	}
+
+	want := Connection{ID: 1, Cluster: "production", Namespace: "db", Addr: "postgres.db.production:5432", Target: "10.0.0.5:5432", Start: start, BytesRead: 2048, BytesWritten: 512, Idle: 90 * time.Second}
+	if len(conns) != 1 || conns[0] != want {
+		t.Errorf("Connections() = %+v, want [%+v]", conns, want)
+	}
+}
+
+func TestTraceConnectionEndpoint(t *testing.T) {
+	traced := map[uint64]bool{}
+
+	srv := httptest.NewServer(&Server{TraceConnection: func(id uint64, on bool) bool {
+		if id != 7 {
+			return false
+		}
+
+		traced[id] = on
+
+		return true
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	if err := client.TraceConnection(context.Background(), 7, true); err != nil {
+		t.Fatalf("TraceConnection(7) error: %v", err)
+	}
+
+	if !traced[7] {
+		t.Error("connection 7 not traced")
+	}
+
+	if err := client.TraceConnection(context.Background(), 8, true); err == nil {
+		t.Error("TraceConnection(8) for an unknown connection: want error")
+	}
+}
+
+func TestCloseConnectionsEndpoint(t *testing.T) {
+	open := []Connection{
+		{ID: 1, Cluster: "production", User: "alice"},
+		{ID: 2, Cluster: "production", User: "bob"},
+		{ID: 3, Cluster: "staging", User: "alice"},
+	}
+
+	var reasons []string
+
+	srv := httptest.NewServer(&Server{CloseConnections: func(filter ConnectionFilter, reason string) int {
+		n := 0
+
+		for _, c := range open {
+			if filter.Matches(c) {
+				n++
+			}
+		}
+
+		reasons = append(reasons, reason)
+
+		return n
+	}})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client(), Username: "ops"}
+
+	tests := []struct {
+		filter ConnectionFilter
+		want   int
+	}{
+		{ConnectionFilter{ID: 2}, 1},
+		{ConnectionFilter{User: "alice"}, 2},
+		{ConnectionFilter{Cluster: "production", User: "alice"}, 1},
+		{ConnectionFilter{Cluster: "dev"}, 0},
+	}
+
+	for _, tt := range tests {
+		n, err := client.CloseConnections(context.Background(), tt.filter)
+		if err != nil {
+			t.Fatalf("CloseConnections(%+v) error: %v", tt.filter, err)
+		}
+
+		if n != tt.want {
+			t.Errorf("CloseConnections(%+v) = %d, want %d", tt.filter, n, tt.want)
+		}
+	}
+
+	if reasons[0] != "closed through the admin API by ops" {
+		t.Errorf("reason = %q", reasons[0])
+	}
+
+	if _, err := client.CloseConnections(context.Background(), ConnectionFilter{ID: 9}); err == nil {
+		t.Error("CloseConnections() for an unknown connection: want error")
+	}
+
+	// closing everything at once needs an explicit filter.
+	if _, err := client.CloseConnections(context.Background(), ConnectionFilter{}); err == nil {
+		t.Error("CloseConnections() without a filter: want error")
+	}
+}
@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Breaker is a target whose circuit breaker tripped: new connections to it
+// fail fast until Until, when the next one tries the target again.
+type Breaker struct {
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	Target    string    `json:"target"`
+	Failures  int       `json:"failures"`
+	Opened    time.Time `json:"opened"`
+	Until     time.Time `json:"until"`
+	LastError string    `json:"lastError"`
+}
+
+// handleBreakers returns the tripped circuit breakers as JSON.
+func (s *Server) handleBreakers(w http.ResponseWriter, _ *http.Request) {
+	if s.Breakers == nil {
+		http.Error(w, "circuit breakers are not available", http.StatusNotFound)
+		return
+	}
+
+	breakers := s.Breakers()
+	if breakers == nil {
+		breakers = []Breaker{}
+	}
+
+	writeJSON(w, breakers, s.Logger)
+}
+
+// Breakers lists the running instance's targets whose circuit breaker
+// tripped.
+func (c *Client) Breakers(ctx context.Context) ([]Breaker, error) {
+	var breakers []Breaker
+	if err := c.getJSON(ctx, "/api/breakers", &breakers); err != nil {
+		return nil, err
+	}
+
+	return breakers, nil
+}
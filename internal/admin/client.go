@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/entwico/podproxy/internal/history"
+)
+
+// Client talks to the admin API of a running podproxy instance.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Username and Password, if set, are sent as Basic authentication.
+	Username string
+	Password string
+}
+
+// NewClient returns a client for the admin listener at listenAddr. Wildcard
+// listen hosts are contacted via loopback.
+func NewClient(listenAddr string) *Client {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+		listenAddr = net.JoinHostPort("127.0.0.1", port)
+	}
+
+	return &Client{
+		BaseURL:    "http://" + listenAddr,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// History queries connection history records.
+func (c *Client) History(ctx context.Context, since time.Duration, f history.Filter) ([]history.Record, error) {
+	q := url.Values{}
+	if since > 0 {
+		q.Set("since", since.String())
+	}
+
+	for key, value := range map[string]string{"cluster": f.Cluster, "namespace": f.Namespace, "user": f.User} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+
+	var records []history.Record
+	if err := c.getJSON(ctx, "/api/history?"+q.Encode(), &records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, v any) error {
+	return c.doJSON(ctx, http.MethodGet, path, nil, v)
+}
+
+// doJSON sends in, unless nil, as the JSON body of a method request to path
+// and decodes the response into v.
+func (c *Client) doJSON(ctx context.Context, method, path string, in, v any) error {
+	var body io.Reader
+
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("admin API %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding admin API response: %w", err)
+	}
+
+	return nil
+}
+
+// IsUnreachable reports whether err means no instance is listening on the
+// admin address.
+func IsUnreachable(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
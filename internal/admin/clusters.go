@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Cluster is the reachability of a cluster's API server.
+type Cluster struct {
+	Name      string `json:"name"`
+	Reachable bool   `json:"reachable"`
+	// Since is when the cluster last turned reachable or unreachable.
+	Since time.Time `json:"since"`
+	// Checked is when the API server was last probed, and Latency how long
+	// the probe took.
+	Checked   time.Time     `json:"checked"`
+	Latency   time.Duration `json:"latency"`
+	LastError string        `json:"lastError"`
+}
+
+// handleClusters returns the reachability of the clusters as JSON.
+func (s *Server) handleClusters(w http.ResponseWriter, _ *http.Request) {
+	if s.Clusters == nil {
+		http.Error(w, "cluster health is not available", http.StatusNotFound)
+		return
+	}
+
+	clusters := s.Clusters()
+	if clusters == nil {
+		clusters = []Cluster{}
+	}
+
+	writeJSON(w, clusters, s.Logger)
+}
+
+// Clusters lists whether the running instance reaches the API servers of its
+// clusters.
+func (c *Client) Clusters(ctx context.Context) ([]Cluster, error) {
+	var clusters []Cluster
+	if err := c.getJSON(ctx, "/api/clusters", &clusters); err != nil {
+		return nil, err
+	}
+
+	return clusters, nil
+}
@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// UnhealthyTarget is a target whose last attempts to connect all failed,
+// e.g. because its pods crash or don't listen on the port.
+type UnhealthyTarget struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	// Target is the Service, pod, workload or selector dialed, e.g.
+	// service/redis.
+	Target    string    `json:"target"`
+	Failures  int       `json:"failures"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"lastError"`
+	// Classes are the error classes of the last failed attempts, oldest
+	// first.
+	Classes []string `json:"classes"`
+	// Endpoints are the pods of a Service target's EndpointSlices when it
+	// turned unhealthy.
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+}
+
+// Endpoint is a pod in a Service's EndpointSlices.
+type Endpoint struct {
+	Pod         string `json:"pod"`
+	Ready       bool   `json:"ready"`
+	Terminating bool   `json:"terminating,omitempty"`
+}
+
+// handleHealth returns the unhealthy targets as JSON.
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	if s.Health == nil {
+		http.Error(w, "target health is not available", http.StatusNotFound)
+		return
+	}
+
+	targets := s.Health()
+	if targets == nil {
+		targets = []UnhealthyTarget{}
+	}
+
+	writeJSON(w, targets, s.Logger)
+}
+
+// Health lists the running instance's targets whose connections keep
+// failing.
+func (c *Client) Health(ctx context.Context) ([]UnhealthyTarget, error) {
+	var targets []UnhealthyTarget
+	if err := c.getJSON(ctx, "/api/health", &targets); err != nil {
+		return nil, err
+	}
+
+	return targets, nil
+}
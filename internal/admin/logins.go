@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Login is a cluster whose credentials need an interactive login, e.g.
+// because the OIDC refresh token expired. Connections to it fail until the
+// login completes.
+type Login struct {
+	Cluster string    `json:"cluster"`
+	Since   time.Time `json:"since"`
+	Error   string    `json:"error"`
+	// LoginURL is the URL the credential plugin asked to open, if any.
+	LoginURL string `json:"loginURL,omitempty"`
+}
+
+// handleLogins returns the clusters awaiting login as JSON.
+func (s *Server) handleLogins(w http.ResponseWriter, _ *http.Request) {
+	if s.Logins == nil {
+		http.Error(w, "login states are not available", http.StatusNotFound)
+		return
+	}
+
+	logins := s.Logins()
+	if logins == nil {
+		logins = []Login{}
+	}
+
+	writeJSON(w, logins, s.Logger)
+}
+
+// Logins lists the running instance's clusters that await an interactive
+// login.
+func (c *Client) Logins(ctx context.Context) ([]Login, error) {
+	var logins []Login
+	if err := c.getJSON(ctx, "/api/logins", &logins); err != nil {
+		return nil, err
+	}
+
+	return logins, nil
+}
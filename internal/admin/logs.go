@@ -0,0 +1,370 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogEvent is a log record kept by a LogBuffer.
+type LogEvent struct {
+	Seq     uint64            `json:"seq"`
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"msg"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// LogFilter selects log events by attribute. Empty fields match everything.
+type LogFilter struct {
+	Component string
+	Cluster   string
+	// Conn is the connection ID logged with dials and closes.
+	Conn string
+}
+
+// Match reports whether e satisfies the filter.
+func (f LogFilter) Match(e LogEvent) bool {
+	for key, want := range map[string]string{"component": f.Component, "cluster": f.Cluster, "conn": f.Conn} {
+		if want != "" && e.Attrs[key] != want {
+			return false
+		}
+	}
+
+	return true
+}
+
+// logSubscriberBuffer is how many events a follower may lag behind before
+// events are dropped for it.
+const logSubscriberBuffer = 256
+
+// LogBuffer keeps the most recent log events in memory and fans new ones out
+// to followers, so a running instance's logs can be read over the admin API
+// without access to its log file.
+type LogBuffer struct {
+	level slog.Leveler
+
+	mu     sync.Mutex
+	events []LogEvent
+	start  int
+	seq    uint64
+	subs   map[chan LogEvent]struct{}
+}
+
+// NewLogBuffer creates a buffer keeping the last size events at or above
+// level.
+func NewLogBuffer(size int, level slog.Leveler) *LogBuffer {
+	return &LogBuffer{
+		level:  level,
+		events: make([]LogEvent, 0, max(size, 1)),
+		subs:   make(map[chan LogEvent]struct{}),
+	}
+}
+
+// Handler returns a slog.Handler that records events into the buffer and
+// passes them on to next.
+func (b *LogBuffer) Handler(next slog.Handler) slog.Handler {
+	return &logBufferHandler{buf: b, next: next}
+}
+
+func (b *LogBuffer) add(e LogEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e.Seq = b.seq
+
+	if len(b.events) < cap(b.events) {
+		b.events = append(b.events, e)
+	} else {
+		b.events[b.start] = e
+		b.start = (b.start + 1) % len(b.events)
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// slow follower: drop rather than block logging.
+		}
+	}
+}
+
+// Recent returns up to limit of the most recent buffered events matching f,
+// oldest first. A limit of zero or less returns all of them.
+func (b *LogBuffer) Recent(f LogFilter, limit int) []LogEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []LogEvent
+
+	for i := range b.events {
+		if e := b.events[(b.start+i)%len(b.events)]; f.Match(e) {
+			out = append(out, e)
+		}
+	}
+
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+
+	return out
+}
+
+// Subscribe returns a channel receiving every new event and a function that
+// ends the subscription. Events are dropped for subscribers that fall behind.
+func (b *LogBuffer) Subscribe() (<-chan LogEvent, func()) {
+	ch := make(chan LogEvent, logSubscriberBuffer)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+// logBufferHandler tees records into a LogBuffer. Attributes are flattened
+// to strings, with group names joined by dots.
+type logBufferHandler struct {
+	buf    *LogBuffer
+	next   slog.Handler
+	attrs  []slog.Attr
+	prefix string
+}
+
+func (h *logBufferHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.buf.level.Level() || h.next.Enabled(ctx, level)
+}
+
+func (h *logBufferHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= h.buf.level.Level() {
+		attrs := make(map[string]string, len(h.attrs)+r.NumAttrs())
+		for _, a := range h.attrs {
+			flattenAttr(attrs, "", a)
+		}
+
+		r.Attrs(func(a slog.Attr) bool {
+			flattenAttr(attrs, h.prefix, a)
+			return true
+		})
+
+		h.buf.add(LogEvent{Time: r.Time, Level: r.Level.String(), Message: r.Message, Attrs: attrs})
+	}
+
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+
+	return h.next.Handle(ctx, r)
+}
+
+func (h *logBufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.next = h.next.WithAttrs(attrs)
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+
+	for _, a := range attrs {
+		if h.prefix != "" {
+			a.Key = h.prefix + a.Key
+		}
+
+		c.attrs = append(c.attrs, a)
+	}
+
+	return &c
+}
+
+func (h *logBufferHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	c := *h
+	c.next = h.next.WithGroup(name)
+	c.prefix = h.prefix + name + "."
+
+	return &c
+}
+
+func flattenAttr(out map[string]string, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+
+		for _, ga := range a.Value.Group() {
+			flattenAttr(out, prefix, ga)
+		}
+
+		return
+	}
+
+	if a.Key != "" {
+		out[prefix+a.Key] = a.Value.String()
+	}
+}
+
+// handleLogs streams buffered log events as JSON lines. Query parameters:
+// tail (number of buffered events, default all), follow (keep streaming new
+// events), component, cluster, conn.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if s.Logs == nil {
+		http.Error(w, "log buffer is disabled", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := LogFilter{
+		Component: q.Get("component"),
+		Cluster:   q.Get("cluster"),
+		Conn:      q.Get("conn"),
+	}
+
+	tail := 0
+
+	if v := q.Get("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid tail: "+v, http.StatusBadRequest)
+			return
+		}
+
+		tail = n
+	}
+
+	follow := q.Get("follow") == "true"
+
+	flusher, ok := w.(http.Flusher)
+	if follow && !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// subscribe before reading the buffer, so no event falls between the two;
+	// events seen in both are skipped by sequence number.
+	var (
+		events      <-chan LogEvent
+		unsubscribe = func() {}
+	)
+
+	if follow {
+		events, unsubscribe = s.Logs.Subscribe()
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	enc := json.NewEncoder(w)
+
+	var last uint64
+
+	for _, e := range s.Logs.Recent(filter, tail) {
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+
+		last = e.Seq
+	}
+
+	if !follow {
+		return
+	}
+
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events:
+			if e.Seq <= last || !filter.Match(e) {
+				continue
+			}
+
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+
+			flusher.Flush()
+		}
+	}
+}
+
+// Logs fetches buffered log events matching f, the last tail of them when
+// tail is positive, and passes each to fn. With follow set it keeps
+// streaming new events until ctx is cancelled or fn returns an error.
+func (c *Client) Logs(ctx context.Context, f LogFilter, tail int, follow bool, fn func(LogEvent) error) error {
+	q := url.Values{}
+	if tail > 0 {
+		q.Set("tail", strconv.Itoa(tail))
+	}
+
+	if follow {
+		q.Set("follow", "true")
+	}
+
+	for key, value := range map[string]string{"component": f.Component, "cluster": f.Cluster, "conn": f.Conn} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/logs?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	// the client timeout would cut off a followed stream.
+	httpClient := *c.HTTPClient
+	if follow {
+		httpClient.Timeout = 0
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("admin API /api/logs: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+
+	for {
+		var e LogEvent
+		if err := dec.Decode(&e); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("decoding log stream: %w", err)
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLogBuffer(t *testing.T) {
+	buf := NewLogBuffer(3, slog.LevelInfo)
+	logger := slog.New(buf.Handler(slog.NewTextHandler(io.Discard, nil)))
+
+	logger.Debug("not buffered")
+	logger.Info("one", "component", "admin")
+	logger.With("cluster", "production").Info("two", "conn", 7)
+	logger.WithGroup("req").Info("three", "id", "a")
+	logger.Warn("four", "component", "admin")
+
+	all := buf.Recent(LogFilter{}, 0)
+	if len(all) != 3 || all[0].Message != "two" || all[2].Message != "four" {
+		t.Fatalf("Recent() = %+v, want the last three events", all)
+	}
+
+	if all[0].Attrs["cluster"] != "production" || all[0].Attrs["conn"] != "7" || all[1].Attrs["req.id"] != "a" {
+		t.Errorf("attrs = %v, %v", all[0].Attrs, all[1].Attrs)
+	}
+
+	if got := buf.Recent(LogFilter{Component: "admin"}, 0); len(got) != 1 || got[0].Message != "four" {
+		t.Errorf("Recent(component) = %+v, want four", got)
+	}
+
+	if got := buf.Recent(LogFilter{}, 1); len(got) != 1 || got[0].Message != "four" {
+		t.Errorf("Recent(limit 1) = %+v, want four", got)
+	}
+}
+
+func TestLogsEndpointFollow(t *testing.T) {
+	buf := NewLogBuffer(100, slog.LevelInfo)
+	logger := slog.New(buf.Handler(slog.NewTextHandler(io.Discard, nil)))
+
+	logger.Info("old", "cluster", "staging")
+	logger.Info("buffered", "cluster", "production")
+
+	srv := httptest.NewServer(&Server{Logs: buf})
+	defer srv.Close()
+
+	client := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errDone := errors.New("done")
+
+	var got []string
+
+	err := client.Logs(ctx, LogFilter{Cluster: "production"}, 0, true, func(e LogEvent) error {
+		got = append(got, e.Message)
+
+		if e.Message == "buffered" {
+			go func() {
+				logger.Info("skipped", "cluster", "staging")
+				logger.Info("live", "cluster", "production")
+			}()
+		}
+
+		if e.Message == "live" {
+			return errDone
+		}
+
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("Logs() error: %v", err)
+	}
+
+	if len(got) != 2 || got[0] != "buffered" || got[1] != "live" {
+		t.Errorf("Logs() = %v, want [buffered live]", got)
+	}
+}
+
+func TestLogsEndpointDisabled(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&Server{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/logs", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// ErrNotFound is wrapped by Server.Members errors for clusters and Services
+// that don't exist, answered with 404 Not Found.
+var ErrNotFound = errors.New("not found")
+
+// Member is a pod behind a headless Service and the podproxy address it is
+// reachable at.
+type Member struct {
+	Pod     string `json:"pod"`
+	Address string `json:"address"`
+	// Hostname is the pod's hostname in the Service's DNS records, if set.
+	Hostname string `json:"hostname,omitempty"`
+	Ready    bool   `json:"ready"`
+}
+
+// handleMembers returns the pods behind a headless Service as JSON. Query
+// parameters: cluster and service (required), namespace.
+func (s *Server) handleMembers(w http.ResponseWriter, r *http.Request) {
+	if s.Members == nil {
+		http.Error(w, "service members are not available", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+
+	if q.Get("cluster") == "" || q.Get("service") == "" {
+		http.Error(w, "cluster and service are required", http.StatusBadRequest)
+		return
+	}
+
+	members, err := s.Members(r.Context(), q.Get("cluster"), q.Get("namespace"), q.Get("service"))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if members == nil {
+		members = []Member{}
+	}
+
+	writeJSON(w, members, s.Logger)
+}
+
+// Members lists the pods behind the headless Service of the running
+// instance's cluster. An empty namespace is the cluster's default.
+func (c *Client) Members(ctx context.Context, cluster, namespace, service string) ([]Member, error) {
+	q := url.Values{"cluster": {cluster}, "service": {service}}
+	if namespace != "" {
+		q.Set("namespace", namespace)
+	}
+
+	var members []Member
+	if err := c.getJSON(ctx, "/api/members?"+q.Encode(), &members); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// handleNoProxy returns the entries clients should exclude from proxying as
+// a NO_PROXY value, or as a JSON array with format=json.
+func (s *Server) handleNoProxy(w http.ResponseWriter, r *http.Request) {
+	if s.NoProxy == nil {
+		http.Error(w, "no_proxy list is not available", http.StatusNotFound)
+		return
+	}
+
+	entries := s.NoProxy()
+	if entries == nil {
+		entries = []string{}
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		writeJSON(w, entries, s.Logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, strings.Join(entries, ","))
+}
+
+// NoProxy returns the entries the running instance recommends for NO_PROXY.
+func (c *Client) NoProxy(ctx context.Context) ([]string, error) {
+	var entries []string
+	if err := c.getJSON(ctx, "/api/noproxy?format=json", &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// OnCallSwitch is the on-call flag that opens clusters whose access policy
+// allows on-call access.
+type OnCallSwitch interface {
+	OnCall() bool
+	SetOnCall(on bool)
+}
+
+// OnCallStatus is the state of the on-call flag.
+type OnCallStatus struct {
+	OnCall bool `json:"onCall"`
+}
+
+// handleOnCall returns the on-call flag as JSON.
+func (s *Server) handleOnCall(w http.ResponseWriter, _ *http.Request) {
+	if s.OnCall == nil {
+		http.Error(w, "no cluster allows on-call access", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, OnCallStatus{OnCall: s.OnCall.OnCall()}, s.Logger)
+}
+
+// handleSetOnCall sets the on-call flag from an OnCallStatus body and
+// returns the new state.
+func (s *Server) handleSetOnCall(w http.ResponseWriter, r *http.Request) {
+	if s.OnCall == nil {
+		http.Error(w, "no cluster allows on-call access", http.StatusNotFound)
+		return
+	}
+
+	var status OnCallStatus
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&status); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.OnCall.SetOnCall(status.OnCall)
+
+	if s.Logger != nil {
+		user, _, _ := r.BasicAuth()
+		s.Logger.Warn("on-call access changed", "on_call", status.OnCall, "user", user, "remote", r.RemoteAddr)
+	}
+
+	writeJSON(w, status, s.Logger)
+}
+
+// OnCall reports whether the running instance's on-call flag is set.
+func (c *Client) OnCall(ctx context.Context) (bool, error) {
+	var status OnCallStatus
+	if err := c.getJSON(ctx, "/api/oncall", &status); err != nil {
+		return false, err
+	}
+
+	return status.OnCall, nil
+}
+
+// SetOnCall sets or clears the running instance's on-call flag.
+func (c *Client) SetOnCall(ctx context.Context, on bool) error {
+	var status OnCallStatus
+	return c.doJSON(ctx, http.MethodPut, "/api/oncall", OnCallStatus{OnCall: on}, &status)
+}
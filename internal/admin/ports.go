@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Ports holds the addresses the listeners of a running instance are bound to,
+// with ephemeral (":0") ports replaced by the ports actually assigned.
+// Disabled listeners are left empty.
+type Ports struct {
+	PID       int            `json:"pid"`
+	SOCKS     string         `json:"socks"`
+	HTTP      string         `json:"http,omitempty"`
+	PAC       string         `json:"pac,omitempty"`
+	Admin     string         `json:"admin,omitempty"`
+	Listeners []ListenerPort `json:"listeners,omitempty"`
+}
+
+// ListenerPort is the bound address of an additional listener. Cluster is
+// set for listeners pinned to a cluster.
+type ListenerPort struct {
+	Cluster  string `json:"cluster,omitempty"`
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+}
+
+// WritePortFile atomically writes ports as JSON to path.
+func WritePortFile(path string, ports Ports) error {
+	data, err := json.Marshal(ports)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating port file directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing port file: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("writing port file: %w", err)
+	}
+
+	return nil
+}
+
+// ReadPortFile reads a port file written by WritePortFile.
+func ReadPortFile(path string) (Ports, error) {
+	var ports Ports
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ports, fmt.Errorf("reading port file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &ports); err != nil {
+		return ports, fmt.Errorf("parsing port file %s: %w", path, err)
+	}
+
+	return ports, nil
+}
+
+// RemovePortFile removes the port file at path if it was written by the
+// process pid, so an instance shutting down after a handover leaves its
+// replacement's file alone.
+func RemovePortFile(path string, pid int) error {
+	ports, err := ReadPortFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if ports.PID != pid {
+		return nil
+	}
+
+	return os.Remove(path)
+}
+
+// Ports queries the bound listener addresses.
+func (c *Client) Ports(ctx context.Context) (Ports, error) {
+	var ports Ports
+	err := c.getJSON(ctx, "/api/ports", &ports)
+
+	return ports, err
+}
@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ClusterServices lists the Services of one cluster by namespace.
+type ClusterServices struct {
+	Cluster string `json:"cluster"`
+	// Synced is false while the cluster's Services are still being listed.
+	Synced     bool                `json:"synced"`
+	Namespaces []NamespaceServices `json:"namespaces"`
+}
+
+// NamespaceServices lists the Services of one namespace.
+type NamespaceServices struct {
+	Namespace string    `json:"namespace"`
+	Services  []Service `json:"services"`
+}
+
+// Service is a Service and the podproxy address it is reachable at.
+type Service struct {
+	Name    string        `json:"name"`
+	Address string        `json:"address"`
+	Ports   []ServicePort `json:"ports"`
+}
+
+// ServicePort is a port of a Service.
+type ServicePort struct {
+	Name     string `json:"name,omitempty"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// ServiceCatalog lists the Services of the clusters. An empty cluster or
+// namespace matches all of them.
+type ServiceCatalog interface {
+	Services(cluster, namespace string) []ClusterServices
+}
+
+// handleServices returns the Services of the clusters as JSON. Query
+// parameters: cluster, namespace.
+func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
+	if s.Services == nil {
+		http.Error(w, "service discovery is disabled", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+
+	clusters := s.Services.Services(q.Get("cluster"), q.Get("namespace"))
+	if clusters == nil {
+		clusters = []ClusterServices{}
+	}
+
+	writeJSON(w, clusters, s.Logger)
+}
+
+// Services lists the Services of the running instance's clusters. An empty
+// cluster or namespace matches all of them.
+func (c *Client) Services(ctx context.Context, cluster, namespace string) ([]ClusterServices, error) {
+	q := url.Values{}
+	if cluster != "" {
+		q.Set("cluster", cluster)
+	}
+
+	if namespace != "" {
+		q.Set("namespace", namespace)
+	}
+
+	var clusters []ClusterServices
+	if err := c.getJSON(ctx, "/api/services?"+q.Encode(), &clusters); err != nil {
+		return nil, err
+	}
+
+	return clusters, nil
+}
+
+// handleHostnames lists the hostnames the instance currently routes, one per
+// line, or as a JSON array with format=json. Query parameters: prefix.
+func (s *Server) handleHostnames(w http.ResponseWriter, r *http.Request) {
+	if s.Hostnames == nil {
+		http.Error(w, "hostnames are not available", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	prefix := strings.ToLower(q.Get("prefix"))
+
+	hostnames := []string{}
+
+	for _, h := range s.Hostnames(r.Context()) {
+		if strings.HasPrefix(h, prefix) {
+			hostnames = append(hostnames, h)
+		}
+	}
+
+	if q.Get("format") == "json" {
+		writeJSON(w, hostnames, s.Logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	for _, h := range hostnames {
+		fmt.Fprintln(w, h)
+	}
+}
+
+// Hostnames lists the hostnames the running instance routes that start
+// with prefix.
+func (c *Client) Hostnames(ctx context.Context, prefix string) ([]string, error) {
+	q := url.Values{"format": {"json"}}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+
+	var hostnames []string
+	if err := c.getJSON(ctx, "/api/hostnames?"+q.Encode(), &hostnames); err != nil {
+		return nil, err
+	}
+
+	return hostnames, nil
+}
@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// NamespaceTraffic is the traffic of one namespace of a cluster since the
+// instance started, including open connections.
+type NamespaceTraffic struct {
+	Cluster      string `json:"cluster"`
+	Namespace    string `json:"namespace"`
+	BytesRead    int64  `json:"rx"`
+	BytesWritten int64  `json:"tx"`
+	Connections  int64  `json:"connections"`
+	Active       int    `json:"active"`
+}
+
+// handleTraffic returns the traffic by cluster and namespace as JSON, most
+// bytes first. Query parameters: cluster.
+func (s *Server) handleTraffic(w http.ResponseWriter, r *http.Request) {
+	if s.Traffic == nil {
+		http.Error(w, "traffic accounting is not available", http.StatusNotFound)
+		return
+	}
+
+	cluster := r.URL.Query().Get("cluster")
+
+	namespaces := []NamespaceTraffic{}
+
+	for _, nt := range s.Traffic() {
+		if cluster == "" || nt.Cluster == cluster {
+			namespaces = append(namespaces, nt)
+		}
+	}
+
+	writeJSON(w, namespaces, s.Logger)
+}
+
+// Traffic returns the running instance's traffic by cluster and namespace,
+// most bytes first. An empty cluster matches all of them.
+func (c *Client) Traffic(ctx context.Context, cluster string) ([]NamespaceTraffic, error) {
+	path := "/api/traffic"
+	if cluster != "" {
+		path += "?cluster=" + url.QueryEscape(cluster)
+	}
+
+	var namespaces []NamespaceTraffic
+	if err := c.getJSON(ctx, path, &namespaces); err != nil {
+		return nil, err
+	}
+
+	return namespaces, nil
+}
+
+// Connection is an open cluster connection.
+type Connection struct {
+	ID           uint64    `json:"id"`
+	Cluster      string    `json:"cluster"`
+	Namespace    string    `json:"namespace"`
+	Addr         string    `json:"addr"`
+	Target       string    `json:"target"`
+	User         string    `json:"user,omitempty"`
+	Start        time.Time `json:"start"`
+	BytesRead    int64     `json:"rx"`
+	BytesWritten int64     `json:"tx"`
+	// Idle is how long the connection transferred no data.
+	Idle time.Duration `json:"idle"`
+}
+
+// handleConnections returns the open cluster connections as JSON, oldest
+// first. Query parameters: cluster.
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	if s.Connections == nil {
+		http.Error(w, "connection tracking is not available", http.StatusNotFound)
+		return
+	}
+
+	cluster := r.URL.Query().Get("cluster")
+
+	conns := []Connection{}
+
+	for _, c := range s.Connections() {
+		if cluster == "" || c.Cluster == cluster {
+			conns = append(conns, c)
+		}
+	}
+
+	writeJSON(w, conns, s.Logger)
+}
+
+// Connections returns the running instance's open cluster connections,
+// oldest first. An empty cluster matches all of them.
+func (c *Client) Connections(ctx context.Context, cluster string) ([]Connection, error) {
+	path := "/api/connections"
+	if cluster != "" {
+		path += "?cluster=" + url.QueryEscape(cluster)
+	}
+
+	var conns []Connection
+	if err := c.getJSON(ctx, path, &conns); err != nil {
+		return nil, err
+	}
+
+	return conns, nil
+}
+
+// ConnectionFilter selects open connections to close. Zero-valued fields
+// match everything.
+type ConnectionFilter struct {
+	ID      uint64
+	Cluster string
+	User    string
+}
+
+// Matches reports whether the filter selects c.
+func (f ConnectionFilter) Matches(c Connection) bool {
+	return (f.ID == 0 || c.ID == f.ID) &&
+		(f.Cluster == "" || c.Cluster == f.Cluster) &&
+		(f.User == "" || c.User == f.User)
+}
+
+// ClosedConnections is the number of connections a close request closed.
+type ClosedConnections struct {
+	Closed int `json:"closed"`
+}
+
+// handleCloseConnection closes the open connection with the given ID.
+func (s *Server) handleCloseConnection(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		http.Error(w, "invalid connection ID", http.StatusBadRequest)
+		return
+	}
+
+	s.closeConnections(w, r, ConnectionFilter{ID: id})
+}
+
+// handleCloseConnections closes the open connections of a cluster, a user,
+// or both. Query parameters: cluster, user; at least one is required.
+func (s *Server) handleCloseConnections(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := ConnectionFilter{Cluster: q.Get("cluster"), User: q.Get("user")}
+
+	if filter.Cluster == "" && filter.User == "" {
+		http.Error(w, "cluster or user is required", http.StatusBadRequest)
+		return
+	}
+
+	s.closeConnections(w, r, filter)
+}
+
+func (s *Server) closeConnections(w http.ResponseWriter, r *http.Request, filter ConnectionFilter) {
+	if s.CloseConnections == nil {
+		http.Error(w, "connection tracking is not available", http.StatusNotFound)
+		return
+	}
+
+	reason := "closed through the admin API"
+
+	user, _, _ := r.BasicAuth()
+	if user != "" {
+		reason += " by " + user
+	}
+
+	n := s.CloseConnections(filter, reason)
+
+	if s.Logger != nil {
+		s.Logger.Warn("connections closed", "closed", n, "id", filter.ID, "cluster", filter.Cluster,
+			"proxy_user", filter.User, "user", user, "remote", r.RemoteAddr)
+	}
+
+	if n == 0 && filter.ID != 0 {
+		http.Error(w, "no open connection "+r.PathValue("id"), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, ClosedConnections{Closed: n}, s.Logger)
+}
+
+// CloseConnections closes the running instance's open connections the
+// filter selects and returns how many it closed. The filter must set the ID,
+// cluster or user.
+func (c *Client) CloseConnections(ctx context.Context, filter ConnectionFilter) (int, error) {
+	path := "/api/connections"
+
+	if filter.ID != 0 {
+		path += "/" + strconv.FormatUint(filter.ID, 10)
+	} else {
+		q := url.Values{}
+
+		if filter.Cluster != "" {
+			q.Set("cluster", filter.Cluster)
+		}
+
+		if filter.User != "" {
+			q.Set("user", filter.User)
+		}
+
+		path += "?" + q.Encode()
+	}
+
+	var closed ClosedConnections
+	if err := c.doJSON(ctx, http.MethodDelete, path, nil, &closed); err != nil {
+		return 0, err
+	}
+
+	return closed.Closed, nil
+}
+
+// TraceStatus is the tracing state of a connection.
+type TraceStatus struct {
+	Trace bool `json:"trace"`
+}
+
+// handleTraceConnection turns tracing of an open connection on or off from a
+// TraceStatus body and returns the new state.
+func (s *Server) handleTraceConnection(w http.ResponseWriter, r *http.Request) {
+	if s.TraceConnection == nil {
+		http.Error(w, "connection tracing is not available", http.StatusNotFound)
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid connection ID", http.StatusBadRequest)
+		return
+	}
+
+	var status TraceStatus
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&status); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.TraceConnection(id, status.Trace) {
+		http.Error(w, "no open connection "+r.PathValue("id"), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, status, s.Logger)
+}
+
+// TraceConnection turns tracing of the running instance's open connection
+// with the given ID on or off.
+func (c *Client) TraceConnection(ctx context.Context, id uint64, on bool) error {
+	var status TraceStatus
+	return c.doJSON(ctx, http.MethodPut, "/api/connections/"+strconv.FormatUint(id, 10)+"/trace", TraceStatus{Trace: on}, &status)
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+)
+
+// Impersonation is the Kubernetes identity a proxy user acts as.
+type Impersonation struct {
+	User   string
+	Groups []string
+}
+
+// Store verifies proxy credentials and maps users to the Kubernetes identity
+// they act as. It satisfies the go-socks5 CredentialStore interface. An
+// Authenticator implements it for any Provider.
+type Store interface {
+	Valid(user, password, userAddr string) bool
+	ImpersonationFor(user string) Impersonation
+}
+
+// User is a statically configured proxy user.
+type User struct {
+	Password    string
+	Impersonate Impersonation
+}
+
+// Users is a static credential store keyed by username. It satisfies the
+// go-socks5 CredentialStore interface.
+type Users map[string]User
+
+// Valid reports whether password matches the configured user's password.
+func (u Users) Valid(user, password, _ string) bool {
+	entry, ok := u[user]
+	if !ok {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(entry.Password), []byte(password)) == 1
+}
+
+// Validate implements Provider.
+func (u Users) Validate(_ context.Context, creds Credentials) (Identity, error) {
+	if !u.Valid(creds.Username, creds.Password, creds.ClientAddr) {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	return Identity{User: creds.Username, Impersonate: u.ImpersonationFor(creds.Username)}, nil
+}
+
+// ImpersonationFor returns the Kubernetes identity for user. Users without an
+// explicit mapping impersonate their own proxy username.
+func (u Users) ImpersonationFor(user string) Impersonation {
+	imp := u[user].Impersonate
+	if imp.User == "" {
+		imp.User = user
+	}
+
+	return imp
+}
+
+type userKey struct{}
+
+// WithUser returns a context carrying the authenticated proxy username.
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the authenticated proxy username, or "" when the
+// connection is unauthenticated.
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// ParseProxyAuthorization parses a Basic Proxy-Authorization header value.
+func ParseProxyAuthorization(header string) (user, password string, ok bool) {
+	const prefix = "Basic "
+
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(header[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+
+	user, password, ok = strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	return user, password, true
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestUsersValid(t *testing.T) {
+	users := Users{"alice": {Password: "secret"}}
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		want     bool
+	}{
+		{name: "valid", user: "alice", password: "secret", want: true},
+		{name: "wrong password", user: "alice", password: "nope", want: false},
+		{name: "unknown user", user: "bob", password: "secret", want: false},
+		{name: "empty password", user: "alice", password: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := users.Valid(tt.user, tt.password, ""); got != tt.want {
+				t.Errorf("Valid(%q, %q) = %v, want %v", tt.user, tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsersImpersonationFor(t *testing.T) {
+	users := Users{
+		"alice": {Impersonate: Impersonation{User: "alice@example.com", Groups: []string{"devs"}}},
+		"bob":   {},
+	}
+
+	if got := users.ImpersonationFor("alice"); got.User != "alice@example.com" || len(got.Groups) != 1 {
+		t.Errorf("ImpersonationFor(alice) = %+v", got)
+	}
+
+	if got := users.ImpersonationFor("bob"); got.User != "bob" {
+		t.Errorf("ImpersonationFor(bob).User = %q, want %q", got.User, "bob")
+	}
+}
+
+func TestUserContext(t *testing.T) {
+	if got := UserFromContext(context.Background()); got != "" {
+		t.Errorf("UserFromContext(empty) = %q, want empty", got)
+	}
+
+	if got := UserFromContext(WithUser(context.Background(), "alice")); got != "alice" {
+		t.Errorf("UserFromContext() = %q, want %q", got, "alice")
+	}
+}
+
+func TestParseProxyAuthorization(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte("alice:pa:ss"))
+
+	tests := []struct {
+		name     string
+		header   string
+		wantUser string
+		wantPass string
+		wantOK   bool
+	}{
+		{name: "basic", header: "Basic " + encoded, wantUser: "alice", wantPass: "pa:ss", wantOK: true},
+		{name: "lowercase scheme", header: "basic " + encoded, wantUser: "alice", wantPass: "pa:ss", wantOK: true},
+		{name: "empty", header: "", wantOK: false},
+		{name: "bearer", header: "Bearer abc", wantOK: false},
+		{name: "invalid base64", header: "Basic !!!", wantOK: false},
+		{name: "missing colon", header: "Basic " + base64.StdEncoding.EncodeToString([]byte("alice")), wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, pass, ok := ParseProxyAuthorization(tt.header)
+			if ok != tt.wantOK || user != tt.wantUser || pass != tt.wantPass {
+				t.Errorf("ParseProxyAuthorization() = %q, %q, %v, want %q, %q, %v",
+					user, pass, ok, tt.wantUser, tt.wantPass, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	a := NewAuthenticator(Users{
+		"alice": {Password: "secret", Impersonate: Impersonation{User: "alice@example.com", Groups: []string{"devs"}}},
+	}, nil)
+
+	if got := a.ImpersonationFor("alice"); got.User != "alice" {
+		t.Errorf("ImpersonationFor(alice) before login = %+v, want the username", got)
+	}
+
+	if a.Valid("alice", "nope", "127.0.0.1:1234") {
+		t.Error("Valid(alice, nope) = true, want false")
+	}
+
+	if !a.Valid("alice", "secret", "127.0.0.1:1234") {
+		t.Fatal("Valid(alice, secret) = false, want true")
+	}
+
+	if got := a.ImpersonationFor("alice"); got.User != "alice@example.com" || len(got.Groups) != 1 {
+		t.Errorf("ImpersonationFor(alice) = %+v, want the identity of the login", got)
+	}
+}
+
+func TestUsersValidate(t *testing.T) {
+	users := Users{"alice": {Password: "secret"}}
+
+	id, err := users.Validate(context.Background(), Credentials{Username: "alice", Password: "secret"})
+	if err != nil || id.User != "alice" || id.Impersonate.User != "alice" {
+		t.Errorf("Validate(alice) = %+v, %v", id, err)
+	}
+
+	if _, err := users.Validate(context.Background(), Credentials{Username: "alice", Password: "nope"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Validate(alice, nope) error = %v, want ErrInvalidCredentials", err)
+	}
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Basic Encoding Rules for the few LDAP (RFC 4511) messages the LDAP store
+// exchanges. Only definite lengths and non-negative integers are supported.
+
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+
+	// maxBERLength bounds a received element, so a misbehaving server
+	// can't make podproxy allocate arbitrary amounts of memory.
+	maxBERLength = 1 << 20
+)
+
+var errMalformedBER = errors.New("malformed BER element")
+
+// berElement is a decoded element: its identifier octet and content.
+type berElement struct {
+	tag     byte
+	content []byte
+}
+
+// berEncode returns an element with the concatenated contents.
+func berEncode(tag byte, contents ...[]byte) []byte {
+	n := 0
+	for _, c := range contents {
+		n += len(c)
+	}
+
+	b := appendBERLength([]byte{tag}, n)
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+
+	return b
+}
+
+func appendBERLength(b []byte, n int) []byte {
+	if n < 0x80 {
+		return append(b, byte(n))
+	}
+
+	var l []byte
+	for ; n > 0; n >>= 8 {
+		l = append([]byte{byte(n)}, l...)
+	}
+
+	return append(append(b, 0x80|byte(len(l))), l...)
+}
+
+// berInt encodes a non-negative integer or enumeration.
+func berInt(tag byte, v int) []byte {
+	var c []byte
+	for {
+		c = append([]byte{byte(v)}, c...)
+		v >>= 8
+
+		if v == 0 {
+			break
+		}
+	}
+
+	// keep the value positive in two's complement.
+	if c[0]&0x80 != 0 {
+		c = append([]byte{0}, c...)
+	}
+
+	return berEncode(tag, c)
+}
+
+func berString(tag byte, s string) []byte {
+	return berEncode(tag, []byte(s))
+}
+
+// readBER reads one element from r.
+func readBER(r *bufio.Reader) (berElement, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return berElement{}, err
+	}
+
+	n, err := readBERLength(r)
+	if err != nil {
+		return berElement{}, err
+	}
+
+	content := make([]byte, n)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return berElement{}, err
+	}
+
+	return berElement{tag: tag, content: content}, nil
+}
+
+func readBERLength(r io.ByteReader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if first&0x80 == 0 {
+		return int(first), nil
+	}
+
+	octets := int(first & 0x7f)
+	if octets == 0 || octets > 3 {
+		return 0, fmt.Errorf("%w: unsupported length", errMalformedBER)
+	}
+
+	n := 0
+
+	for range octets {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		n = n<<8 | int(b)
+	}
+
+	if n > maxBERLength {
+		return 0, fmt.Errorf("%w: length %d exceeds %d", errMalformedBER, n, maxBERLength)
+	}
+
+	return n, nil
+}
+
+// children decodes the elements of a constructed element.
+func (e berElement) children() ([]berElement, error) {
+	var out []berElement
+
+	r := bufio.NewReader(bytes.NewReader(e.content))
+
+	for {
+		if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+			return out, nil
+		}
+
+		child, err := readBER(r)
+		if err != nil {
+			return nil, errMalformedBER
+		}
+
+		out = append(out, child)
+	}
+}
+
+// int decodes a non-negative integer or enumeration.
+func (e berElement) int() int {
+	n := 0
+	for _, b := range e.content {
+		n = n<<8 | int(b)
+	}
+
+	return n
+}
+
+func (e berElement) string() string {
+	return string(e.content)
+}
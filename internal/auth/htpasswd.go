@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"  //nolint:gosec // apr1 hashes are MD5-based by definition
+	"crypto/sha1" //nolint:gosec // {SHA} hashes are SHA-1 by definition
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Htpasswd verifies proxy credentials against an Apache htpasswd file. It
+// supports the MD5 ($apr1$, htpasswd -m, the default) and SHA-1 ({SHA},
+// htpasswd -s) formats. Users impersonate their own username. The file is
+// reloaded when it changes; if the new version can't be read, the previous
+// one stays in use.
+type Htpasswd struct {
+	Path   string
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	entries map[string]string
+	modTime time.Time
+	size    int64
+}
+
+// NewHtpasswd loads the htpasswd file at path.
+func NewHtpasswd(path string, logger *slog.Logger) (*Htpasswd, error) {
+	h := &Htpasswd{Path: path, Logger: logger}
+
+	if err := h.reload(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Validate implements Provider.
+func (h *Htpasswd) Validate(_ context.Context, creds Credentials) (Identity, error) {
+	h.mu.Lock()
+
+	if err := h.reload(); err != nil && h.Logger != nil {
+		h.Logger.Warn("reloading htpasswd file, keeping the previous version", "file", h.Path, "error", err)
+	}
+
+	hash, ok := h.entries[creds.Username]
+	h.mu.Unlock()
+
+	if !ok || creds.Password == "" || !checkHtpasswdHash(hash, creds.Password) {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	return Identity{User: creds.Username, Impersonate: Impersonation{User: creds.Username}}, nil
+}
+
+// reload reads the file if its size or modification time changed. h.mu must
+// be held, or h not yet shared.
+func (h *Htpasswd) reload() error {
+	info, err := os.Stat(h.Path)
+	if err != nil {
+		return err
+	}
+
+	if h.entries != nil && info.ModTime().Equal(h.modTime) && info.Size() == h.size {
+		return nil
+	}
+
+	f, err := os.Open(h.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := parseHtpasswd(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", h.Path, err)
+	}
+
+	h.entries, h.modTime, h.size = entries, info.ModTime(), info.Size()
+
+	return nil
+}
+
+// parseHtpasswd reads user:hash lines, skipping blank lines and comments.
+func parseHtpasswd(r io.Reader) (map[string]string, error) {
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("line %d: want user:hash", n)
+		}
+
+		if !strings.HasPrefix(hash, apr1Magic) && !strings.HasPrefix(hash, shaPrefix) {
+			return nil, fmt.Errorf("line %d: user %q has an unsupported hash format, only MD5 (htpasswd -m) and SHA-1 (htpasswd -s) are supported", n, user)
+		}
+
+		entries[user] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+const (
+	apr1Magic = "$apr1$"
+	shaPrefix = "{SHA}"
+)
+
+// checkHtpasswdHash reports whether password matches hash.
+func checkHtpasswdHash(hash, password string) bool {
+	var want string
+
+	switch {
+	case strings.HasPrefix(hash, shaPrefix):
+		sum := sha1.Sum([]byte(password)) //nolint:gosec // see import
+		want = shaPrefix + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, apr1Magic):
+		salt, _, _ := strings.Cut(hash[len(apr1Magic):], "$")
+		want = apr1(password, salt)
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(want)) == 1
+}
+
+// apr1 returns the Apache variant of the MD5-based crypt(3) hash of password
+// with salt.
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	pw := []byte(password)
+
+	alt := md5.New() //nolint:gosec // see import
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	d := md5.New() //nolint:gosec // see import
+	d.Write(pw)
+	d.Write([]byte(apr1Magic + salt))
+
+	for i := len(pw); i > 0; i -= 16 {
+		d.Write(altSum[:min(i, 16)])
+	}
+
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+
+	sum := d.Sum(nil)
+
+	for i := range 1000 {
+		d := md5.New() //nolint:gosec // see import
+
+		if i&1 != 0 {
+			d.Write(pw)
+		} else {
+			d.Write(sum)
+		}
+
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+
+		if i&1 != 0 {
+			d.Write(sum)
+		} else {
+			d.Write(pw)
+		}
+
+		sum = d.Sum(nil)
+	}
+
+	var b strings.Builder
+
+	b.WriteString(apr1Magic + salt + "$")
+
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		cryptBase64(&b, uint(sum[g[0]])<<16|uint(sum[g[1]])<<8|uint(sum[g[2]]), 4)
+	}
+
+	cryptBase64(&b, uint(sum[11]), 2)
+
+	return b.String()
+}
+
+// cryptBase64 writes the low 6*n bits of v in the crypt(3) alphabet, least
+// significant first.
+func cryptBase64(b *strings.Builder, v uint, n int) {
+	const alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	for range n {
+		b.WriteByte(alphabet[v&0x3f])
+		v >>= 6
+	}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPR1(t *testing.T) {
+	// expected values from openssl passwd -apr1.
+	tests := []struct {
+		password, salt, want string
+	}{
+		{"secret", "r31.....", "$apr1$r31.....$G/cElGhD0cboYkZN5h5Ne/"},
+		{"a much longer password than sixteen", "Zx9kLm2Q", "$apr1$Zx9kLm2Q$pZSsT1VvVAX08bbWzEzYT0"},
+		{"", "ab", "$apr1$ab$S8K6Sgp3W8c9Jb6LxgywZ."},
+	}
+
+	for _, tt := range tests {
+		if got := apr1(tt.password, tt.salt); got != tt.want {
+			t.Errorf("apr1(%q, %q) = %q, want %q", tt.password, tt.salt, got, tt.want)
+		}
+	}
+}
+
+func TestHtpasswdValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeFile(t, path, "# proxy users\n"+
+		"alice:$apr1$r31.....$G/cElGhD0cboYkZN5h5Ne/\n"+
+		"\n"+
+		"bob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+
+	h, err := NewHtpasswd(path, nil)
+	if err != nil {
+		t.Fatalf("NewHtpasswd() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		user, password string
+		want           bool
+	}{
+		{"md5", "alice", "secret", true},
+		{"sha1", "bob", "secret", true},
+		{"wrong password", "alice", "nope", false},
+		{"empty password", "alice", "", false},
+		{"unknown user", "mallory", "secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := h.Validate(context.Background(), Credentials{Username: tt.user, Password: tt.password})
+			if got := err == nil; got != tt.want {
+				t.Fatalf("Validate(%q, %q) error = %v, want valid %v", tt.user, tt.password, err, tt.want)
+			}
+
+			if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Validate() error = %v, want ErrInvalidCredentials", err)
+			}
+
+			if err == nil && id.Impersonate.User != tt.user {
+				t.Errorf("Validate().Impersonate.User = %q, want %q", id.Impersonate.User, tt.user)
+			}
+		})
+	}
+}
+
+func TestHtpasswdReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeFile(t, path, "alice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+
+	h, err := NewHtpasswd(path, nil)
+	if err != nil {
+		t.Fatalf("NewHtpasswd() error = %v", err)
+	}
+
+	writeFile(t, path, "bob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+	// make the change visible on file systems with coarse timestamps.
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.Validate(context.Background(), Credentials{Username: "bob", Password: "secret"}); err != nil {
+		t.Errorf("Validate(bob) after reload error = %v", err)
+	}
+
+	// a broken file keeps the previous version in use.
+	writeFile(t, path, "carol:$2y$10$abcdefghijklmnopqrstuv\n")
+
+	if _, err := h.Validate(context.Background(), Credentials{Username: "bob", Password: "secret"}); err != nil {
+		t.Errorf("Validate(bob) after a broken reload error = %v", err)
+	}
+}
+
+func TestParseHtpasswdErrors(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"bcrypt", "alice:$2y$05$abcdefghijklmnopqrstuv\n", "unsupported hash format"},
+		{"crypt", "alice:rl0uE2ZkAqU4M\n", "unsupported hash format"},
+		{"missing hash", "alice\n", "line 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseHtpasswd(strings.NewReader(tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseHtpasswd() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
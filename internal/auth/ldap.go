@@ -0,0 +1,511 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LDAP protocol operations (RFC 4511), as BER identifier octets.
+const (
+	ldapBindRequest      = 0x60
+	ldapBindResponse     = 0x61
+	ldapUnbindRequest    = 0x42
+	ldapSearchRequest    = 0x63
+	ldapSearchEntry      = 0x64
+	ldapSearchDone       = 0x65
+	ldapSearchReference  = 0x73
+	ldapExtendedRequest  = 0x77
+	ldapExtendedResponse = 0x78
+
+	ldapSimpleAuth    = 0x80 // [0] simple, in a BindRequest
+	ldapEqualityMatch = 0xa3 // [3] equalityMatch, in a SearchRequest filter
+	ldapRequestName   = 0x80 // [0] requestName, in an ExtendedRequest
+
+	// ldapStartTLS is the OID of the StartTLS extended operation (RFC 4511
+	// section 4.14).
+	ldapStartTLS = "1.3.6.1.4.1.1466.20037"
+
+	ldapSizeLimitExceeded  = 4
+	ldapInvalidCredentials = 49
+)
+
+// ErrLDAPUserNotFound means the directory has no entry for the username.
+var ErrLDAPUserNotFound = errors.New("user not found in directory")
+
+// LDAP verifies proxy credentials against an LDAP or Active Directory
+// server. It looks up the user's entry, binds as it with the password, and
+// maps the groups listed in the entry to the Kubernetes groups the user
+// impersonates. Successful logins are cached for CacheTTL, so a proxy
+// connection doesn't cost a directory round trip.
+//
+// Connections to ldap:// URLs are upgraded with StartTLS before the first
+// bind, so passwords never cross the network in cleartext unless Plaintext
+// is set.
+type LDAP struct {
+	// URL of the server, ldap://host[:389] or ldaps://host[:636].
+	URL string
+	// Plaintext binds over ldap:// URLs without StartTLS, for servers that
+	// don't support it on a trusted network.
+	Plaintext bool
+	// BindDN and BindPassword authenticate the user lookup. An empty BindDN
+	// searches anonymously.
+	BindDN       string
+	BindPassword string
+	// BaseDN is the subtree searched for the user's entry.
+	BaseDN string
+	// UserAttribute holds the username, e.g. uid or sAMAccountName.
+	UserAttribute string
+	// GroupAttribute lists the DNs of the groups of a user entry, e.g.
+	// memberOf.
+	GroupAttribute string
+	// Groups maps group DNs to the Kubernetes groups their members
+	// impersonate. When set, users in none of the groups are rejected.
+	Groups   map[string][]string
+	CacheTTL time.Duration
+	// TLSConfig is used for ldaps:// URLs and StartTLS. Nil uses the system
+	// roots.
+	TLSConfig *tls.Config
+	// Timeout bounds a whole login. Zero means 10 seconds.
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	logins map[string]ldapLogin
+
+	// test override — if nil, time.Now is used.
+	now func() time.Time
+}
+
+// ldapLogin is a cached successful login.
+type ldapLogin struct {
+	secret  [sha256.Size]byte
+	groups  []string
+	expires time.Time
+}
+
+// Validate implements Provider. It binds as the user's entry with the
+// password, or answers from the cache of successful logins.
+func (l *LDAP) Validate(ctx context.Context, creds Credentials) (Identity, error) {
+	user := creds.Username
+
+	// an empty password is an unauthenticated bind, which servers accept
+	// for any DN.
+	if user == "" || creds.Password == "" {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	secret := sha256.Sum256([]byte(creds.Password))
+
+	l.mu.Lock()
+	login, ok := l.logins[user]
+	l.mu.Unlock()
+
+	if ok && l.clock().Before(login.expires) && subtle.ConstantTimeCompare(login.secret[:], secret[:]) == 1 {
+		return Identity{User: user, Impersonate: Impersonation{User: user, Groups: login.groups}}, nil
+	}
+
+	groups, err := l.authenticate(ctx, user, creds.Password)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.logins == nil {
+		l.logins = make(map[string]ldapLogin)
+	}
+
+	now := l.clock()
+
+	// logins of users who don't come back would otherwise stay forever.
+	for name, login := range l.logins {
+		if !now.Before(login.expires) {
+			delete(l.logins, name)
+		}
+	}
+
+	l.logins[user] = ldapLogin{secret: secret, groups: groups, expires: now.Add(l.CacheTTL)}
+
+	return Identity{User: user, Impersonate: Impersonation{User: user, Groups: groups}}, nil
+}
+
+// authenticate logs user in and returns its Kubernetes groups.
+func (l *LDAP) authenticate(ctx context.Context, user, password string) ([]string, error) {
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c, err := l.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.conn.Close()
+
+	if l.BindDN != "" {
+		if err := c.bind(l.BindDN, l.BindPassword); err != nil {
+			return nil, fmt.Errorf("binding as %s: %w", l.BindDN, err)
+		}
+	}
+
+	dn, memberOf, err := c.findUser(l.BaseDN, l.UserAttribute, user, l.GroupAttribute, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.bind(dn, password); err != nil {
+		return nil, fmt.Errorf("binding as %s: %w", dn, err)
+	}
+
+	c.unbind()
+
+	groups, ok := l.mapGroups(memberOf)
+	if !ok {
+		return nil, fmt.Errorf("%s is in none of the configured groups", dn)
+	}
+
+	return groups, nil
+}
+
+// mapGroups returns the Kubernetes groups of the directory groups, sorted,
+// and whether the user may log in.
+func (l *LDAP) mapGroups(memberOf []string) ([]string, bool) {
+	if len(l.Groups) == 0 {
+		return nil, true
+	}
+
+	var (
+		groups []string
+		member bool
+	)
+
+	for dn, mapped := range l.Groups {
+		// DNs compare case-insensitively in practice.
+		if slices.ContainsFunc(memberOf, func(m string) bool { return strings.EqualFold(m, dn) }) {
+			member = true
+			groups = append(groups, mapped...)
+		}
+	}
+
+	slices.Sort(groups)
+
+	return slices.Compact(groups), member
+}
+
+// dial connects to the server until the deadline of ctx, upgrading ldap://
+// connections with StartTLS unless Plaintext is set.
+func (l *LDAP) dial(ctx context.Context) (*ldapConn, error) {
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap url: %w", err)
+	}
+
+	port := "389"
+	if u.Scheme == "ldaps" {
+		port = "636"
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if l.TLSConfig != nil {
+		cfg = l.TLSConfig.Clone()
+	}
+
+	if cfg.ServerName == "" {
+		cfg.ServerName = u.Hostname()
+	}
+
+	var conn net.Conn
+	if u.Scheme == "ldaps" {
+		conn, err = (&tls.Dialer{Config: cfg}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	c := &ldapConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if u.Scheme != "ldaps" && !l.Plaintext {
+		if err := c.startTLS(ctx, cfg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starting tls: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+func (l *LDAP) clock() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+
+	return time.Now()
+}
+
+// ldapConn is a connection to an LDAP server, used for one login.
+type ldapConn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	msgID int
+}
+
+// send writes a request with the next message ID.
+func (c *ldapConn) send(op []byte) error {
+	c.msgID++
+
+	_, err := c.conn.Write(berEncode(berSequence, berInt(berInteger, c.msgID), op))
+
+	return err
+}
+
+// receive reads the protocol operation of the next response.
+func (c *ldapConn) receive() (berElement, error) {
+	msg, err := readBER(c.r)
+	if err != nil {
+		return berElement{}, fmt.Errorf("reading ldap response: %w", err)
+	}
+
+	parts, err := msg.children()
+	if err != nil || msg.tag != berSequence || len(parts) < 2 {
+		return berElement{}, fmt.Errorf("reading ldap response: %w", errMalformedBER)
+	}
+
+	if id := parts[0].int(); id != c.msgID {
+		return berElement{}, fmt.Errorf("ldap response for message %d, want %d", id, c.msgID)
+	}
+
+	return parts[1], nil
+}
+
+// startTLS upgrades the connection to TLS with the StartTLS extended
+// operation.
+func (c *ldapConn) startTLS(ctx context.Context, cfg *tls.Config) error {
+	if err := c.send(berEncode(ldapExtendedRequest, berString(ldapRequestName, ldapStartTLS))); err != nil {
+		return err
+	}
+
+	op, err := c.receive()
+	if err != nil {
+		return err
+	}
+
+	if op.tag != ldapExtendedResponse {
+		return fmt.Errorf("unexpected ldap response 0x%02x to starttls", op.tag)
+	}
+
+	if err := ldapResult(op); err != nil {
+		return err
+	}
+
+	conn := tls.Client(c.conn, cfg)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return err
+	}
+
+	c.conn, c.r = conn, bufio.NewReader(conn)
+
+	return nil
+}
+
+// bind authenticates the connection as dn with a simple bind.
+func (c *ldapConn) bind(dn, password string) error {
+	err := c.send(berEncode(ldapBindRequest,
+		berInt(berInteger, 3),
+		berString(berOctetString, dn),
+		berString(ldapSimpleAuth, password),
+	))
+	if err != nil {
+		return err
+	}
+
+	op, err := c.receive()
+	if err != nil {
+		return err
+	}
+
+	if op.tag != ldapBindResponse {
+		return fmt.Errorf("unexpected ldap response 0x%02x to bind", op.tag)
+	}
+
+	return ldapResult(op)
+}
+
+// findUser returns the DN and the groupAttr values of the single entry below
+// baseDN whose userAttr equals user.
+func (c *ldapConn) findUser(baseDN, userAttr, user, groupAttr string, timeout time.Duration) (string, []string, error) {
+	err := c.send(berEncode(ldapSearchRequest,
+		berString(berOctetString, baseDN),
+		berInt(berEnumerated, 2), // wholeSubtree
+		berInt(berEnumerated, 0), // neverDerefAliases
+		berInt(berInteger, 2),    // two entries tell an ambiguous username apart
+		berInt(berInteger, int(timeout.Seconds())),
+		berEncode(berBoolean, []byte{0}),
+		berEncode(ldapEqualityMatch, berString(berOctetString, userAttr), berString(berOctetString, user)),
+		berEncode(berSequence, berString(berOctetString, groupAttr)),
+	))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		dns    []string
+		groups []string
+	)
+
+	for {
+		op, err := c.receive()
+		if err != nil {
+			return "", nil, err
+		}
+
+		switch op.tag {
+		case ldapSearchEntry:
+			dn, values, err := parseSearchEntry(op, groupAttr)
+			if err != nil {
+				return "", nil, err
+			}
+
+			dns = append(dns, dn)
+			groups = values
+		case ldapSearchReference:
+			// referrals to other servers aren't followed.
+		case ldapSearchDone:
+			err := ldapResult(op)
+
+			var resultErr *ldapResultError
+			if (errors.As(err, &resultErr) && resultErr.code == ldapSizeLimitExceeded) || len(dns) > 1 {
+				return "", nil, fmt.Errorf("username %q matches more than one entry", user)
+			}
+
+			if err != nil {
+				return "", nil, fmt.Errorf("searching for %q: %w", user, err)
+			}
+
+			if len(dns) == 0 {
+				return "", nil, fmt.Errorf("%w: %w: %s", ErrInvalidCredentials, ErrLDAPUserNotFound, user)
+			}
+
+			return dns[0], groups, nil
+		default:
+			return "", nil, fmt.Errorf("unexpected ldap response 0x%02x to search", op.tag)
+		}
+	}
+}
+
+// unbind tells the server the connection is done.
+func (c *ldapConn) unbind() {
+	_ = c.send(berEncode(ldapUnbindRequest))
+}
+
+// parseSearchEntry returns the DN of a SearchResultEntry and the values of
+// its attribute attr.
+func parseSearchEntry(op berElement, attr string) (string, []string, error) {
+	parts, err := op.children()
+	if err != nil || len(parts) < 2 {
+		return "", nil, fmt.Errorf("search entry: %w", errMalformedBER)
+	}
+
+	attrs, err := parts[1].children()
+	if err != nil {
+		return "", nil, fmt.Errorf("search entry: %w", err)
+	}
+
+	var values []string
+
+	for _, a := range attrs {
+		pair, err := a.children()
+		if err != nil || len(pair) < 2 {
+			return "", nil, fmt.Errorf("search entry: %w", errMalformedBER)
+		}
+
+		if !strings.EqualFold(pair[0].string(), attr) {
+			continue
+		}
+
+		vals, err := pair[1].children()
+		if err != nil {
+			return "", nil, fmt.Errorf("search entry: %w", err)
+		}
+
+		for _, v := range vals {
+			values = append(values, v.string())
+		}
+	}
+
+	return parts[0].string(), values, nil
+}
+
+// ldapResultError is a non-success LDAPResult.
+type ldapResultError struct {
+	code    int
+	message string
+}
+
+func (e *ldapResultError) Error() string {
+	name := ldapResultNames[e.code]
+	if name == "" {
+		name = fmt.Sprintf("result code %d", e.code)
+	}
+
+	if e.message == "" {
+		return name
+	}
+
+	return name + ": " + e.message
+}
+
+// Unwrap maps the invalidCredentials result code to ErrInvalidCredentials.
+func (e *ldapResultError) Unwrap() error {
+	if e.code == ldapInvalidCredentials {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+var ldapResultNames = map[int]string{
+	ldapSizeLimitExceeded:  "size limit exceeded",
+	32:                     "no such object",
+	ldapInvalidCredentials: "invalid credentials",
+	50:                     "insufficient access rights",
+	53:                     "unwilling to perform",
+}
+
+// ldapResult returns the error of an LDAPResult, or nil on success.
+func ldapResult(op berElement) error {
+	parts, err := op.children()
+	if err != nil || len(parts) < 3 {
+		return fmt.Errorf("ldap result: %w", errMalformedBER)
+	}
+
+	if code := parts[0].int(); code != 0 {
+		return &ldapResultError{code: code, message: parts[2].string()}
+	}
+
+	return nil
+}
@@ -0,0 +1,349 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDirectory is an LDAP server with fixed entries, answering simple binds,
+// equality searches on uid and, with tls set, StartTLS.
+type fakeDirectory struct {
+	// entries maps uid to DN, password and memberOf values.
+	entries map[string]fakeEntry
+	tls     *tls.Config
+	logins  atomic.Int32
+	// plaintextBinds counts binds received before StartTLS.
+	plaintextBinds atomic.Int32
+}
+
+type fakeEntry struct {
+	dn, password string
+	memberOf     []string
+}
+
+const (
+	fakeServiceDN       = "cn=podproxy,ou=services,dc=example,dc=com"
+	fakeServicePassword = "service-secret"
+)
+
+func startFakeDirectory(t *testing.T, dir *fakeDirectory) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go dir.serve(conn)
+		}
+	}()
+
+	return "ldap://" + ln.Addr().String()
+}
+
+func (d *fakeDirectory) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	r := bufio.NewReader(conn)
+	secure := false
+
+	for {
+		msg, err := readBER(r)
+		if err != nil {
+			return
+		}
+
+		parts, err := msg.children()
+		if err != nil || len(parts) < 2 {
+			return
+		}
+
+		id := parts[0].int()
+		reply := func(op []byte) {
+			_, _ = conn.Write(berEncode(berSequence, berInt(berInteger, id), op))
+		}
+		result := func(tag byte, code int) {
+			reply(berEncode(tag, berInt(berEnumerated, code), berString(berOctetString, ""), berString(berOctetString, "")))
+		}
+
+		fields, _ := parts[1].children()
+
+		switch parts[1].tag {
+		case ldapExtendedRequest:
+			if d.tls == nil || len(fields) == 0 || fields[0].string() != ldapStartTLS {
+				result(ldapExtendedResponse, 2) // protocolError
+				continue
+			}
+
+			result(ldapExtendedResponse, 0)
+
+			conn = tls.Server(conn, d.tls)
+			r = bufio.NewReader(conn)
+			secure = true
+		case ldapBindRequest:
+			if !secure {
+				d.plaintextBinds.Add(1)
+			}
+
+			dn, password := fields[1].string(), fields[2].string()
+			if dn == fakeServiceDN && password == fakeServicePassword {
+				result(ldapBindResponse, 0)
+				continue
+			}
+
+			code := 49
+			for _, e := range d.entries {
+				if e.dn == dn && e.password == password {
+					d.logins.Add(1)
+					code = 0
+				}
+			}
+
+			result(ldapBindResponse, code)
+		case ldapSearchRequest:
+			filter, _ := fields[6].children()
+			if e, ok := d.entries[filter[1].string()]; ok && filter[0].string() == "uid" {
+				var groups [][]byte
+				for _, g := range e.memberOf {
+					groups = append(groups, berString(berOctetString, g))
+				}
+
+				reply(berEncode(ldapSearchEntry,
+					berString(berOctetString, e.dn),
+					berEncode(berSequence, berEncode(berSequence,
+						berString(berOctetString, "memberOf"),
+						berEncode(berSet, groups...),
+					)),
+				))
+			}
+
+			result(ldapSearchDone, 0)
+		default:
+			return
+		}
+	}
+}
+
+// testTLS returns a server config with the httptest certificate for
+// 127.0.0.1, and a client config trusting it.
+func testTLS(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	return srv.TLS, &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+}
+
+func newTestLDAP(t *testing.T) (*LDAP, *fakeDirectory) {
+	t.Helper()
+
+	serverTLS, clientTLS := testTLS(t)
+
+	dir := &fakeDirectory{tls: serverTLS, entries: map[string]fakeEntry{
+		"alice": {
+			dn:       "uid=alice,ou=people,dc=example,dc=com",
+			password: "alice-secret",
+			memberOf: []string{"cn=Platform,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+		},
+		"bob": {
+			dn:       "uid=bob,ou=people,dc=example,dc=com",
+			password: "bob-secret",
+			memberOf: []string{"cn=staff,ou=groups,dc=example,dc=com"},
+		},
+	}}
+
+	l := &LDAP{
+		URL:            startFakeDirectory(t, dir),
+		BindDN:         fakeServiceDN,
+		BindPassword:   fakeServicePassword,
+		BaseDN:         "ou=people,dc=example,dc=com",
+		UserAttribute:  "uid",
+		GroupAttribute: "memberOf",
+		Groups: map[string][]string{
+			"cn=platform,ou=groups,dc=example,dc=com": {"platform-admins"},
+		},
+		CacheTTL:  time.Minute,
+		TLSConfig: clientTLS,
+	}
+
+	return l, dir
+}
+
+func TestLDAPValidate(t *testing.T) {
+	l, _ := newTestLDAP(t)
+
+	tests := []struct {
+		name           string
+		user, password string
+		want           bool
+	}{
+		{"member of a mapped group", "alice", "alice-secret", true},
+		{"wrong password", "alice", "wrong", false},
+		{"empty password", "alice", "", false},
+		{"in no mapped group", "bob", "bob-secret", false},
+		{"unknown user", "mallory", "secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := l.Validate(context.Background(), Credentials{Username: tt.user, Password: tt.password, ClientAddr: "127.0.0.1:1234"})
+			if got := err == nil; got != tt.want {
+				t.Errorf("Validate(%q, %q) error = %v, want valid %v", tt.user, tt.password, err, tt.want)
+			}
+		})
+	}
+
+	id, err := l.Validate(context.Background(), Credentials{Username: "alice", Password: "alice-secret"})
+	if err != nil {
+		t.Fatalf("Validate(alice) error = %v", err)
+	}
+
+	if imp := id.Impersonate; imp.User != "alice" || !slices.Equal(imp.Groups, []string{"platform-admins"}) {
+		t.Errorf("Validate(alice).Impersonate = %+v, want alice in platform-admins", imp)
+	}
+
+	// a wrong password is reported as such, not as a directory failure.
+	if _, err := l.Validate(context.Background(), Credentials{Username: "alice", Password: "wrong"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Validate(alice, wrong) error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+// valid reports whether l accepts the credentials.
+func valid(l *LDAP, user, password string) bool {
+	_, err := l.Validate(context.Background(), Credentials{Username: user, Password: password})
+	return err == nil
+}
+
+func TestLDAPWithoutGroups(t *testing.T) {
+	l, _ := newTestLDAP(t)
+	l.Groups = nil
+
+	id, err := l.Validate(context.Background(), Credentials{Username: "bob", Password: "bob-secret"})
+	if err != nil {
+		t.Fatalf("Validate(bob) without configured groups error = %v", err)
+	}
+
+	if len(id.Impersonate.Groups) != 0 {
+		t.Errorf("Validate(bob).Impersonate.Groups = %v, want none", id.Impersonate.Groups)
+	}
+}
+
+func TestLDAPCache(t *testing.T) {
+	l, dir := newTestLDAP(t)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	for range 3 {
+		if !valid(l, "alice", "alice-secret") {
+			t.Fatal("Valid(alice) = false, want true")
+		}
+	}
+
+	if n := dir.logins.Load(); n != 1 {
+		t.Errorf("directory logins = %d, want 1 while cached", n)
+	}
+
+	// a different password isn't answered from the cache.
+	if valid(l, "alice", "wrong") {
+		t.Error("Valid(alice) with a wrong password = true, want false")
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	if !valid(l, "alice", "alice-secret") || dir.logins.Load() != 2 {
+		t.Errorf("directory logins after expiry = %d, want 2", dir.logins.Load())
+	}
+}
+
+func TestLDAPStartTLS(t *testing.T) {
+	l, dir := newTestLDAP(t)
+
+	if !valid(l, "alice", "alice-secret") {
+		t.Fatal("Valid(alice) = false, want true")
+	}
+
+	if n := dir.plaintextBinds.Load(); n != 0 {
+		t.Errorf("plaintext binds = %d, want 0 after StartTLS", n)
+	}
+
+	// a server without StartTLS is refused before any password is sent.
+	l, dir = newTestLDAP(t)
+	dir.tls = nil
+
+	if valid(l, "alice", "alice-secret") || dir.plaintextBinds.Load() != 0 {
+		t.Errorf("Valid(alice) without StartTLS sent %d plaintext binds, want refused", dir.plaintextBinds.Load())
+	}
+
+	l.Plaintext = true
+
+	if !valid(l, "alice", "alice-secret") || dir.plaintextBinds.Load() == 0 {
+		t.Error("Valid(alice) with Plaintext = false, want a plaintext login")
+	}
+}
+
+func TestLDAPCachePrunesExpired(t *testing.T) {
+	l, _ := newTestLDAP(t)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	if !valid(l, "alice", "alice-secret") {
+		t.Fatal("Valid(alice) = false, want true")
+	}
+
+	now = now.Add(2 * time.Minute)
+	l.Groups = nil
+
+	if !valid(l, "bob", "bob-secret") {
+		t.Fatal("Valid(bob) = false, want true")
+	}
+
+	if _, ok := l.logins["alice"]; ok || len(l.logins) != 1 {
+		t.Errorf("cached logins = %v, want only bob after alice's expired", slices.Collect(maps.Keys(l.logins)))
+	}
+}
+
+func TestLDAPUserNotFound(t *testing.T) {
+	l, _ := newTestLDAP(t)
+
+	_, err := l.authenticate(context.Background(), "mallory", "secret")
+	if !errors.Is(err, ErrLDAPUserNotFound) {
+		t.Errorf("authenticate(mallory) error = %v, want ErrLDAPUserNotFound", err)
+	}
+}
+
+func TestBERLength(t *testing.T) {
+	for _, n := range []int{0, 1, 127, 128, 255, 256, 70000} {
+		encoded := berEncode(berOctetString, make([]byte, n))
+
+		e, err := readBER(bufio.NewReader(bytes.NewReader(encoded)))
+		if err != nil || len(e.content) != n {
+			t.Errorf("round trip of %d bytes: got %d, %v", n, len(e.content), err)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers SHA-256 for crypto.Hash
+	_ "crypto/sha512" // registers SHA-384 and SHA-512 for crypto.Hash
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcKeysRefreshInterval is how often the signing keys may be fetched again
+// for a token signed with an unknown key.
+const oidcKeysRefreshInterval = time.Minute
+
+// oidcClockSkew is the leeway for the exp and nbf claims.
+const oidcClockSkew = time.Minute
+
+// OIDC verifies proxy credentials whose password is an ID token of an OpenID
+// Connect provider. The token must be signed with one of the provider's keys
+// (RS256, RS384, RS512, ES256, ES384 or ES512), be issued by Issuer for
+// ClientID and be unexpired, and the username must equal its UsernameClaim.
+// The values of GroupsClaim become the impersonated Kubernetes groups.
+type OIDC struct {
+	// Issuer is the provider URL; its discovery document lives below
+	// /.well-known/openid-configuration.
+	Issuer   string
+	ClientID string
+	// UsernameClaim holds the username, e.g. email or preferred_username.
+	UsernameClaim string
+	// GroupsClaim, if set, lists the groups of the user.
+	GroupsClaim string
+	// HTTPClient fetches the discovery document and keys. Nil uses
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+	// fetching is closed when the keys being fetched are stored.
+	fetching chan struct{}
+
+	// test override — if nil, time.Now is used.
+	now func() time.Time
+}
+
+// Validate implements Provider.
+func (o *OIDC) Validate(ctx context.Context, creds Credentials) (Identity, error) {
+	claims, err := o.verify(ctx, creds.Password)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	user, _ := claims[o.UsernameClaim].(string)
+	if user == "" || user != creds.Username {
+		return Identity{}, fmt.Errorf("%w: token is for %s %q", ErrInvalidCredentials, o.UsernameClaim, user)
+	}
+
+	imp := Impersonation{User: user}
+
+	if values, ok := claims[o.GroupsClaim].([]any); ok && o.GroupsClaim != "" {
+		for _, v := range values {
+			if group, ok := v.(string); ok {
+				imp.Groups = append(imp.Groups, group)
+			}
+		}
+	}
+
+	return Identity{User: user, Impersonate: imp}, nil
+}
+
+// verify checks the signature and the registered claims of token and
+// returns its claims.
+func (o *OIDC) verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: password is not a JWT", ErrInvalidCredentials)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: token header: %w", ErrInvalidCredentials, err)
+	}
+
+	hash, ok := jwtHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported token algorithm %q", ErrInvalidCredentials, header.Alg)
+	}
+
+	key, err := o.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: token signature: %w", ErrInvalidCredentials, err)
+	}
+
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+
+	if !verifyJWTSignature(key, header.Alg, hash, h.Sum(nil), sig) {
+		return nil, fmt.Errorf("%w: bad token signature", ErrInvalidCredentials)
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: token claims: %w", ErrInvalidCredentials, err)
+	}
+
+	if err := o.checkClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	return claims, nil
+}
+
+// checkClaims checks the issuer, audience and validity period.
+func (o *OIDC) checkClaims(claims map[string]any) error {
+	if iss, _ := claims["iss"].(string); iss != o.Issuer {
+		return fmt.Errorf("token issued by %q", iss)
+	}
+
+	var audience []string
+
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = []string{aud}
+	case []any:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+	}
+
+	if !slices.Contains(audience, o.ClientID) {
+		return fmt.Errorf("token not issued for client %q", o.ClientID)
+	}
+
+	now := o.clock()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+
+	if now.After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return errors.New("token expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(oidcClockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not valid yet")
+	}
+
+	return nil
+}
+
+// key returns the signing key kid, fetching the keys on first use and, at
+// most every oidcKeysRefreshInterval, when the provider rotated them. Logins
+// needing the keys while they are fetched wait for that fetch; others don't.
+func (o *OIDC) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	for {
+		o.mu.Lock()
+
+		if key, ok := signingKey(o.keys, kid); ok {
+			o.mu.Unlock()
+			return key, nil
+		}
+
+		if fetching := o.fetching; fetching != nil {
+			o.mu.Unlock()
+
+			select {
+			case <-fetching:
+				continue
+			case <-ctx.Done():
+				return nil, fmt.Errorf("fetching oidc signing keys: %w", ctx.Err())
+			}
+		}
+
+		if o.keys != nil && o.clock().Sub(o.keysFetched) < oidcKeysRefreshInterval {
+			o.mu.Unlock()
+			return nil, fmt.Errorf("%w: token signed with unknown key %q", ErrInvalidCredentials, kid)
+		}
+
+		o.keysFetched = o.clock()
+		fetching := make(chan struct{})
+		o.fetching = fetching
+		o.mu.Unlock()
+
+		keys, err := o.fetchKeys(ctx)
+
+		o.mu.Lock()
+		if err == nil {
+			o.keys = keys
+		}
+		o.fetching = nil
+		close(fetching)
+		o.mu.Unlock()
+
+		if err != nil {
+			return nil, fmt.Errorf("fetching oidc signing keys: %w", err)
+		}
+	}
+}
+
+// signingKey returns the key kid of keys. Tokens without kid are accepted
+// from providers with a single key.
+func signingKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+// fetchKeys reads the discovery document and the key set it points to.
+func (o *OIDC) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+
+	if err := o.getJSON(ctx, strings.TrimSuffix(o.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+
+	if discovery.Issuer != o.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q", discovery.Issuer)
+	}
+
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document has no jwks_uri")
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := o.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		// keys of unknown types are skipped, not fatal: providers publish
+		// them alongside the ones they sign with.
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("key set has no usable signing keys")
+	}
+
+	return keys, nil
+}
+
+func (o *OIDC) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	client := o.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: %w", url, err)
+	}
+
+	return nil
+}
+
+func (o *OIDC) clock() time.Time {
+	if o.now != nil {
+		return o.now()
+	}
+
+	return time.Now()
+}
+
+// jsonWebKey is an RSA or EC public key of a JWK set (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent too large")
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("ec coordinates have the wrong size")
+		}
+
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// jwtHashes maps the supported JWS algorithms to their hashes.
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// verifyJWTSignature checks sig over digest for the key type alg requires.
+func verifyJWTSignature(key crypto.PublicKey, alg string, hash crypto.Hash, digest, sig []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(key, hash, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		// JWS ECDSA signatures are r and s concatenated, each the size of
+		// the curve.
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(sig) != 2*size {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+
+		return ecdsa.Verify(key, digest, r, s)
+	default:
+		return false
+	}
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
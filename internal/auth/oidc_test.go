@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeIssuer is an OpenID provider publishing one RSA and one EC key.
+type fakeIssuer struct {
+	*httptest.Server
+	rsaKey     *rsa.PrivateKey
+	ecKey      *ecdsa.PrivateKey
+	keyFetches atomic.Int32
+	// rsaOnly publishes just the RSA key.
+	rsaOnly atomic.Bool
+	// hold makes key set requests wait until release is closed.
+	hold    atomic.Bool
+	release chan struct{}
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeIssuer{rsaKey: rsaKey, ecKey: ecKey, release: make(chan struct{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": f.URL, "jwks_uri": f.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		f.keyFetches.Add(1)
+
+		if f.hold.Load() {
+			<-f.release
+		}
+
+		point, _ := ecKey.PublicKey.Bytes()
+		size := (len(point) - 1) / 2
+
+		keys := []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(point[1 : 1+size]), "y": b64(point[1+size:])},
+			{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AA"},
+		}
+
+		if f.rsaOnly.Load() {
+			keys = keys[:1]
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+// token returns a JWT with claims signed by the key kid, "rsa" or "ec". An
+// empty kid signs with the RSA key and leaves kid out of the header.
+func (f *fakeIssuer) token(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+
+	fields := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if kid != "" {
+		fields["alg"] = map[string]string{"rsa": "RS256", "ec": "ES256"}[kid]
+		fields["kid"] = kid
+	}
+
+	header, _ := json.Marshal(fields)
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signed))
+
+	var sig []byte
+
+	switch kid {
+	case "ec":
+		r, s, err := ecdsa.Sign(rand.Reader, f.ecKey, digest.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		var err error
+
+		sig, err = rsa.SignPKCS1v15(rand.Reader, f.rsaKey, crypto.SHA256, digest.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return signed + "." + b64(sig)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestOIDCValidate(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	now := time.Now()
+
+	o := &OIDC{Issuer: issuer.URL, ClientID: "podproxy", UsernameClaim: "email", GroupsClaim: "groups"}
+
+	claims := func(edit func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss":    issuer.URL,
+			"aud":    []string{"podproxy", "other"},
+			"exp":    now.Add(time.Hour).Unix(),
+			"email":  "alice@example.com",
+			"groups": []string{"devs", "oncall"},
+		}
+
+		if edit != nil {
+			edit(c)
+		}
+
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		want     bool
+	}{
+		{"rsa", "alice@example.com", issuer.token(t, "rsa", claims(nil)), true},
+		{"ec", "alice@example.com", issuer.token(t, "ec", claims(nil)), true},
+		{"single audience", "alice@example.com", issuer.token(t, "rsa", claims(func(c map[string]any) { c["aud"] = "podproxy" })), true},
+		{"other user", "bob@example.com", issuer.token(t, "rsa", claims(nil)), false},
+		{"other audience", "alice@example.com", issuer.token(t, "rsa", claims(func(c map[string]any) { c["aud"] = "kubectl" })), false},
+		{"other issuer", "alice@example.com", issuer.token(t, "rsa", claims(func(c map[string]any) { c["iss"] = "https://evil.example.com" })), false},
+		{"expired", "alice@example.com", issuer.token(t, "rsa", claims(func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() })), false},
+		{"not yet valid", "alice@example.com", issuer.token(t, "rsa", claims(func(c map[string]any) { c["nbf"] = now.Add(time.Hour).Unix() })), false},
+		{"tampered", "alice@example.com", issuer.token(t, "rsa", claims(nil))[:40] + "x" + issuer.token(t, "rsa", claims(nil))[41:], false},
+		{"not a token", "alice@example.com", "secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := o.Validate(context.Background(), Credentials{Username: tt.user, Password: tt.password})
+			if got := err == nil; got != tt.want {
+				t.Fatalf("Validate() error = %v, want valid %v", err, tt.want)
+			}
+
+			if err != nil {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("Validate() error = %v, want ErrInvalidCredentials", err)
+				}
+
+				return
+			}
+
+			if id.User != "alice@example.com" || !slices.Equal(id.Impersonate.Groups, []string{"devs", "oncall"}) {
+				t.Errorf("Validate() = %+v, want alice in devs and oncall", id)
+			}
+		})
+	}
+
+	if n := issuer.keyFetches.Load(); n != 1 {
+		t.Errorf("key fetches = %d, want 1", n)
+	}
+}
+
+func TestOIDCUnknownKey(t *testing.T) {
+	issuer := newFakeIssuer(t)
+
+	now := time.Now()
+	o := &OIDC{Issuer: issuer.URL, ClientID: "podproxy", UsernameClaim: "sub", now: func() time.Time { return now }}
+
+	claims := map[string]any{"iss": issuer.URL, "aud": "podproxy", "exp": now.Add(time.Hour).Unix(), "sub": "alice"}
+	token := issuer.token(t, "rsa", claims)
+
+	// the same token naming a key the provider doesn't publish.
+	unknown := withHeader(token, map[string]string{"alg": "RS256", "kid": "rotated"})
+
+	if _, err := o.Validate(context.Background(), Credentials{Username: "alice", Password: token}); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for range 3 {
+		if _, err := o.Validate(context.Background(), Credentials{Username: "alice", Password: unknown}); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Validate(unknown key) error = %v, want ErrInvalidCredentials", err)
+		}
+	}
+
+	if n := issuer.keyFetches.Load(); n != 1 {
+		t.Errorf("key fetches = %d, want 1 within the refresh interval", n)
+	}
+
+	now = now.Add(2 * oidcKeysRefreshInterval)
+
+	_, _ = o.Validate(context.Background(), Credentials{Username: "alice", Password: unknown})
+
+	if n := issuer.keyFetches.Load(); n != 2 {
+		t.Errorf("key fetches after the refresh interval = %d, want 2", n)
+	}
+}
+
+// withHeader returns token with its header replaced by header.
+func withHeader(token string, header map[string]string) string {
+	h, _ := json.Marshal(header)
+	_, rest, _ := strings.Cut(token, ".")
+
+	return b64(h) + "." + rest
+}
+
+func TestOIDCTokenWithoutKid(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	issuer.rsaOnly.Store(true)
+
+	now := time.Now()
+	claims := map[string]any{"iss": issuer.URL, "aud": "podproxy", "exp": now.Add(time.Hour).Unix(), "sub": "alice"}
+	token := issuer.token(t, "rsa", claims)
+	noKid := issuer.token(t, "", claims)
+
+	// cold: the keys are fetched for the token without kid.
+	o := &OIDC{Issuer: issuer.URL, ClientID: "podproxy", UsernameClaim: "sub"}
+
+	if _, err := o.Validate(context.Background(), Credentials{Username: "alice", Password: noKid}); err != nil {
+		t.Errorf("Validate(no kid) with cold keys error = %v", err)
+	}
+
+	// warm: the keys were fetched for a token with kid.
+	o = &OIDC{Issuer: issuer.URL, ClientID: "podproxy", UsernameClaim: "sub"}
+
+	if _, err := o.Validate(context.Background(), Credentials{Username: "alice", Password: token}); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	if _, err := o.Validate(context.Background(), Credentials{Username: "alice", Password: noKid}); err != nil {
+		t.Errorf("Validate(no kid) with cached keys error = %v", err)
+	}
+
+	if n := issuer.keyFetches.Load(); n != 2 {
+		t.Errorf("key fetches = %d, want one per OIDC", n)
+	}
+}
+
+func TestOIDCFetchDoesNotBlockCachedKeys(t *testing.T) {
+	issuer := newFakeIssuer(t)
+
+	now := time.Now()
+	o := &OIDC{Issuer: issuer.URL, ClientID: "podproxy", UsernameClaim: "sub", now: func() time.Time { return now }}
+
+	claims := map[string]any{"iss": issuer.URL, "aud": "podproxy", "exp": now.Add(time.Hour).Unix(), "sub": "alice"}
+	token := issuer.token(t, "rsa", claims)
+	unknown := withHeader(token, map[string]string{"alg": "RS256", "kid": "rotated"})
+
+	if _, err := o.Validate(context.Background(), Credentials{Username: "alice", Password: token}); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	// a token with a new key refetches the keys from a stalled issuer.
+	now = now.Add(2 * oidcKeysRefreshInterval)
+	issuer.hold.Store(true)
+
+	fetched := make(chan struct{})
+
+	go func() {
+		defer close(fetched)
+		_, _ = o.Validate(context.Background(), Credentials{Username: "alice", Password: unknown})
+	}()
+
+	for issuer.keyFetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	validated := make(chan error, 1)
+
+	go func() {
+		_, err := o.Validate(context.Background(), Credentials{Username: "alice", Password: token})
+		validated <- err
+	}()
+
+	select {
+	case err := <-validated:
+		if err != nil {
+			t.Errorf("Validate() during the fetch error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Validate() with a cached key waited for the key fetch")
+	}
+
+	close(issuer.release)
+	<-fetched
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCredentials means the username or password is wrong.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Credentials are what a proxy client sent to authenticate.
+type Credentials struct {
+	Username string
+	Password string
+	// ClientAddr is the remote address of the client connection.
+	ClientAddr string
+}
+
+// Identity is an authenticated proxy user and the Kubernetes identity it acts
+// as on clusters with impersonation enabled.
+type Identity struct {
+	User        string
+	Impersonate Impersonation
+}
+
+// Provider verifies proxy credentials against one authentication backend:
+// static users, an htpasswd file, LDAP or OIDC. It returns
+// ErrInvalidCredentials, possibly wrapped, for wrong credentials, and other
+// errors when the backend couldn't decide.
+type Provider interface {
+	Validate(ctx context.Context, creds Credentials) (Identity, error)
+}
+
+// defaultValidateTimeout bounds a Validate call made by an Authenticator.
+const defaultValidateTimeout = 15 * time.Second
+
+// Authenticator puts a Provider behind the SOCKS5 and HTTP listeners: they
+// check credentials with Valid, and the dialer looks up the identity of the
+// user's last login with ImpersonationFor. It satisfies Store.
+type Authenticator struct {
+	Provider Provider
+	Logger   *slog.Logger
+	// Timeout bounds a validation. Zero means 15 seconds.
+	Timeout time.Duration
+
+	mu         sync.Mutex
+	identities map[string]Impersonation
+}
+
+// NewAuthenticator returns an Authenticator for p.
+func NewAuthenticator(p Provider, logger *slog.Logger) *Authenticator {
+	return &Authenticator{Provider: p, Logger: logger}
+}
+
+// Valid reports whether the provider accepts the credentials, and remembers
+// the identity for ImpersonationFor. It satisfies the go-socks5
+// CredentialStore interface.
+func (a *Authenticator) Valid(user, password, userAddr string) bool {
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = defaultValidateTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	id, err := a.Provider.Validate(ctx, Credentials{Username: user, Password: password, ClientAddr: userAddr})
+	if err != nil {
+		if a.Logger != nil {
+			level := slog.LevelWarn
+			if errors.Is(err, ErrInvalidCredentials) {
+				level = slog.LevelDebug
+			}
+
+			a.Logger.Log(ctx, level, "authentication failed", "user", user, "client", userAddr, "error", err)
+		}
+
+		return false
+	}
+
+	imp := id.Impersonate
+	if imp.User == "" {
+		imp.User = user
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.identities == nil {
+		a.identities = make(map[string]Impersonation)
+	}
+
+	a.identities[user] = imp
+
+	return true
+}
+
+// ImpersonationFor returns the Kubernetes identity of the last successful
+// login of user, or the username itself if there was none.
+func (a *Authenticator) ImpersonationFor(user string) Impersonation {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if imp, ok := a.identities[user]; ok {
+		return imp
+	}
+
+	return Impersonation{User: user}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AccessConfig limits when a cluster is reachable: during one of Windows, or
+// at any time while the on-call flag is set through the admin API. With
+// neither, the cluster is always reachable.
+type AccessConfig struct {
+	Windows []AccessWindowConfig `yaml:"windows"`
+	// OnCall allows connections outside the windows while the on-call flag
+	// is set. Without windows, the cluster is only reachable while on call.
+	// A pointer so a cluster can turn off a true clusterDefaults value.
+	OnCall *bool `yaml:"onCall"`
+	// Timezone the windows are evaluated in, e.g. Europe/Berlin. Defaults to
+	// the local time zone.
+	Timezone string `yaml:"timezone"`
+}
+
+// Restricted reports whether the access config limits connections.
+func (a AccessConfig) Restricted() bool {
+	return len(a.Windows) > 0 || Enabled(a.OnCall)
+}
+
+// AccessWindowConfig is a recurring time of the week, e.g. 09:00 to 18:00 on
+// weekdays. A window whose To is before its From ends on the next day.
+type AccessWindowConfig struct {
+	// Days the window starts on: mon, tue, wed, thu, fri, sat, sun. Empty
+	// means every day.
+	Days []string `yaml:"days"`
+	// From and To are times of day as HH:MM; To may be 24:00.
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// weekdays maps the day names of AccessWindowConfig.Days to weekdays.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Parse returns the days and the offsets from midnight of the window.
+func (w AccessWindowConfig) Parse() (days []time.Weekday, from, to time.Duration, err error) {
+	for _, name := range w.Days {
+		day, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return nil, 0, 0, fmt.Errorf("unknown day %q (must be one of mon, tue, wed, thu, fri, sat, sun)", name)
+		}
+
+		days = append(days, day)
+	}
+
+	if from, err = parseTimeOfDay(w.From); err != nil {
+		return nil, 0, 0, fmt.Errorf("from: %w", err)
+	}
+
+	if to, err = parseTimeOfDay(w.To); err != nil {
+		return nil, 0, 0, fmt.Errorf("to: %w", err)
+	}
+
+	if from == to {
+		return nil, 0, 0, errors.New("from and to must differ")
+	}
+
+	return days, from, to, nil
+}
+
+// parseTimeOfDay parses HH:MM, from 00:00 to 24:00, into an offset from
+// midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	var hours, minutes int
+
+	if n, err := fmt.Sscanf(s, "%d:%d", &hours, &minutes); err != nil || n != 2 || len(s) != len("00:00") {
+		return 0, fmt.Errorf("invalid time of day %q (must be HH:MM)", s)
+	}
+
+	d := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+	if hours < 0 || minutes < 0 || minutes > 59 || d > 24*time.Hour {
+		return 0, fmt.Errorf("invalid time of day %q (must be HH:MM)", s)
+	}
+
+	return d, nil
+}
+
+// validate checks the windows and the time zone.
+func (a AccessConfig) validate() error {
+	for i, w := range a.Windows {
+		if _, _, _, err := w.Parse(); err != nil {
+			return fmt.Errorf("access.windows[%d]: %w", i, err)
+		}
+	}
+
+	if a.Timezone != "" {
+		if _, err := time.LoadLocation(a.Timezone); err != nil {
+			return fmt.Errorf("access.timezone: %w", err)
+		}
+	}
+
+	return nil
+}
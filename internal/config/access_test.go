@@ -0,0 +1,34 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAccessWindowParse(t *testing.T) {
+	days, from, to, err := AccessWindowConfig{Days: []string{"Mon", "fri"}, From: "09:30", To: "24:00"}.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	if !slices.Equal(days, []time.Weekday{time.Monday, time.Friday}) {
+		t.Errorf("days = %v, want [Monday Friday]", days)
+	}
+
+	if from != 9*time.Hour+30*time.Minute || to != 24*time.Hour {
+		t.Errorf("from, to = %v, %v, want 9h30m, 24h", from, to)
+	}
+
+	for _, w := range []AccessWindowConfig{
+		{From: "9:00", To: "18:00"},
+		{From: "09:60", To: "18:00"},
+		{From: "09:00", To: "24:01"},
+		{From: "09:00", To: "09:00"},
+		{Days: []string{"weekday"}, From: "09:00", To: "18:00"},
+	} {
+		if _, _, _, err := w.Parse(); err == nil {
+			t.Errorf("Parse(%+v): want error", w)
+		}
+	}
+}
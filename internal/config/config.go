@@ -6,116 +6,2018 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/entwico/podproxy/internal/proxyproto"
 )
 
-//go:embed defaults.yaml
-var DefaultConfigData []byte
+//go:embed defaults.yaml
+var DefaultConfigData []byte
+
+// LogConfig holds logging configuration.
+type LogConfig struct {
+	Level     string `yaml:"level"`
+	File      string `yaml:"file"`
+	Formatter string `yaml:"formatter"`
+	Colors    bool   `yaml:"colors"`
+	Timestamp bool   `yaml:"timestamp"`
+	// Buffer is how many recent log events are kept in memory for
+	// `podproxy logs`. Zero disables the buffer.
+	Buffer int `yaml:"buffer"`
+	// Trace lists glob patterns of addresses, e.g. postgres.*.prod, whose
+	// connections log every read and write on the tunnel.
+	Trace []string `yaml:"trace"`
+}
+
+// HistoryConfig holds connection history settings.
+type HistoryConfig struct {
+	// File is the database completed connections are recorded to. Empty
+	// disables connection history.
+	File string `yaml:"file"`
+	// Retention is how long records are kept.
+	Retention time.Duration `yaml:"retention"`
+}
+
+// StateConfig holds where operational state, such as the fake IP
+// assignments, is kept across restarts.
+type StateConfig struct {
+	// File is the database state is saved to on shutdown and restored from
+	// on startup. Empty keeps state in memory only.
+	File string `yaml:"file"`
+}
+
+// ClusterSettings holds per-cluster client tuning. Values from
+// Config.ClusterDefaults apply to every cluster and are overridden field by
+// field by the matching Config.Clusters entry.
+type ClusterSettings struct {
+	// QPS and Burst configure client-go's per-cluster rate limiter for API
+	// calls such as EndpointSlice lookups. Zero keeps the client-go default.
+	QPS   float32 `yaml:"qps"`
+	Burst int     `yaml:"burst"`
+
+	// DialTimeout bounds the protocol upgrade and stream creation of each
+	// port-forward dial attempt, so a blackholed API server fails fast.
+	DialTimeout time.Duration `yaml:"dialTimeout"`
+
+	// NegativeCacheTTL is how long a service that is missing or has no ready
+	// pods fails new connections without querying the API again. A pointer
+	// so a cluster can turn off negative caching with 0.
+	NegativeCacheTTL *time.Duration `yaml:"negativeCacheTTL"`
+
+	// Preflight fails connections to Services missing from the service
+	// discovery cache before dialing. A pointer so a cluster can turn off a
+	// true clusterDefaults value.
+	Preflight *bool `yaml:"preflight"`
+
+	// LoadBalancing picks the ready pod of a Service each connection goes
+	// to: first, roundRobin, random or leastConnections.
+	LoadBalancing string `yaml:"loadBalancing"`
+
+	// PortForwardTransport is the protocol port-forwards are opened with:
+	// auto tries WebSockets and falls back to SPDY, websocket and spdy
+	// use only that protocol.
+	PortForwardTransport string `yaml:"portForwardTransport"`
+	// PortForwardProtocols, if set, are the port-forward protocol versions
+	// offered, in order, replacing PortForwardTransport: websocket/v2 and
+	// spdy/v1.
+	PortForwardProtocols []string `yaml:"portForwardProtocols"`
+
+	// MultiplexIdleTimeout, if set, opens the forwards to a pod over one
+	// shared connection, closed this long after its last forward. A pointer
+	// so a cluster can turn off multiplexing set in clusterDefaults with 0.
+	MultiplexIdleTimeout *time.Duration `yaml:"multiplexIdleTimeout"`
+
+	// UnhealthyAfter, if set, is how many attempts to connect to a target
+	// fail in a row before it is reported unhealthy. A pointer so a cluster
+	// can turn off the reports with 0.
+	UnhealthyAfter *int `yaml:"unhealthyAfter"`
+
+	// CircuitBreaker fails connections to targets that keep failing fast
+	// for a cooldown.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuitBreaker"`
+
+	// EndpointCache resolves Services from a watched EndpointSlice cache
+	// instead of with an API call per connection. A pointer so a cluster can
+	// turn off a true clusterDefaults value.
+	EndpointCache *bool `yaml:"endpointCache"`
+
+	// Retry adjusts which dial and resolve errors are retried, since
+	// clusters and CNIs fail transiently in different ways.
+	Retry RetryConfig `yaml:"retry"`
+
+	// TLS overrides applied on top of the kubeconfig cluster stanza, e.g. for
+	// TLS-intercepting middleboxes in front of the API server.
+	CertificateAuthority     string `yaml:"certificateAuthority"`
+	CertificateAuthorityData string `yaml:"certificateAuthorityData"`
+	TLSServerName            string `yaml:"tlsServerName"`
+	// InsecureSkipTLSVerify is a pointer so a cluster can turn off a true
+	// clusterDefaults value with an explicit false.
+	InsecureSkipTLSVerify *bool `yaml:"insecureSkipTLSVerify"`
+
+	// ProxyURL replaces the kubeconfig's proxy-url for API traffic, or is
+	// "direct" to bypass any proxy.
+	ProxyURL string `yaml:"proxyURL"`
+
+	// Access limits when the cluster is reachable.
+	Access AccessConfig `yaml:"access"`
+
+	// Vault replaces the kubeconfig's credentials with short-lived tokens
+	// issued by HashiCorp Vault.
+	Vault VaultConfig `yaml:"vault"`
+
+	// Impersonate makes API calls and port-forwards on behalf of authenticated
+	// proxy users impersonate their mapped Kubernetes identity. A pointer so
+	// a cluster can turn off a true clusterDefaults value.
+	Impersonate *bool `yaml:"impersonate"`
+
+	// InCluster declares a cluster that isn't backed by a kubeconfig context:
+	// the cluster podproxy itself runs in, reached with its service account.
+	// Only valid in Config.Clusters.
+	InCluster bool `yaml:"inCluster"`
+	// Namespace replaces the default namespace of the cluster's context. For
+	// in-cluster entries it defaults to the namespace of the pod.
+	Namespace string `yaml:"namespace"`
+	// PodCIDRs are the pod networks of the cluster, in CIDR notation. Bare
+	// IP addresses in them are dialed as the pod with that IP. Only valid in
+	// Config.Clusters.
+	PodCIDRs []string `yaml:"podCIDRs"`
+}
+
+// CircuitBreakerConfig fails new connections to a target without dialing
+// for Cooldown after Failures of its connections failed in a row. Zero
+// Failures disables it. Both are pointers so a cluster can set them to zero
+// over clusterDefaults.
+type CircuitBreakerConfig struct {
+	Failures *int           `yaml:"failures"`
+	Cooldown *time.Duration `yaml:"cooldown"`
+}
+
+// RetryConfig extends or narrows the errors retried on dial and resolve.
+type RetryConfig struct {
+	// Errors are error message substrings that are retried.
+	Errors []string `yaml:"errors"`
+	// StatusCodes are API server response codes that are retried.
+	StatusCodes []int `yaml:"statusCodes"`
+	// Fatal lists error classes that are retried by default but should fail
+	// immediately.
+	Fatal []string `yaml:"fatal"`
+}
+
+// VaultConfig requests a cluster's credentials from the Kubernetes secrets
+// engine of HashiCorp Vault. Setting Role enables it.
+type VaultConfig struct {
+	Role string `yaml:"role"`
+	// Address of Vault. Defaults to the VAULT_ADDR environment variable.
+	Address string `yaml:"address"`
+	// Mount is the path the secrets engine is mounted at.
+	Mount string `yaml:"mount"`
+	// KubernetesNamespace the token is issued for. Defaults to the cluster's
+	// namespace.
+	KubernetesNamespace string `yaml:"kubernetesNamespace"`
+	// TTL requested for the token. Zero uses the role's default.
+	TTL time.Duration `yaml:"ttl"`
+	// TokenFile holds the Vault token, as written by `vault login`. The
+	// VAULT_TOKEN environment variable takes precedence.
+	TokenFile string `yaml:"tokenFile"`
+}
+
+// retryClasses are the error classes retried by default, as named in
+// RetryConfig.Fatal.
+var retryClasses = []string{"brokenPipe", "connectionReset", "connectionRefused", "eof", "timeout", "noReadyEndpoints", "podGone"}
+
+// loadBalancingPolicies are the valid ClusterSettings.LoadBalancing values.
+var loadBalancingPolicies = []string{"first", "roundRobin", "random", "leastConnections"}
+
+// portForwardTransports are the valid ClusterSettings.PortForwardTransport
+// values.
+var portForwardTransports = []string{"auto", "websocket", "spdy"}
+
+// portForwardProtocols are the valid ClusterSettings.PortForwardProtocols
+// entries.
+var portForwardProtocols = []string{"websocket/v2", "spdy/v1"}
+
+// RateLimitConfig configures a token bucket rate limiter.
+type RateLimitConfig struct {
+	QPS   float32 `yaml:"qps"`
+	Burst int     `yaml:"burst"`
+}
+
+// ImpersonateConfig is the Kubernetes identity a proxy user acts as.
+type ImpersonateConfig struct {
+	User   string   `yaml:"user"`
+	Groups []string `yaml:"groups"`
+}
+
+// AuthUserConfig is a statically configured proxy user.
+type AuthUserConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Impersonate maps the user to a Kubernetes identity on clusters with
+	// impersonation enabled. Defaults to the proxy username.
+	Impersonate ImpersonateConfig `yaml:"impersonate"`
+}
+
+// LDAPConfig verifies proxy credentials against an LDAP or Active Directory
+// server instead of static users. It is enabled when URL is set.
+type LDAPConfig struct {
+	// URL of the server, ldap://host[:port] or ldaps://host[:port]. ldap://
+	// connections are upgraded with StartTLS.
+	URL string `yaml:"url"`
+	// InsecurePlaintext binds over ldap:// without StartTLS, sending
+	// passwords in cleartext.
+	InsecurePlaintext bool `yaml:"insecurePlaintext"`
+	// BindDN and BindPassword authenticate the user lookup. An empty BindDN
+	// searches anonymously.
+	BindDN       string `yaml:"bindDN"`
+	BindPassword string `yaml:"bindPassword"`
+	BaseDN       string `yaml:"baseDN"`
+	// UserAttribute holds the username, e.g. uid or sAMAccountName.
+	UserAttribute string `yaml:"userAttribute"`
+	// GroupAttribute lists the groups of a user entry, e.g. memberOf.
+	GroupAttribute string `yaml:"groupAttribute"`
+	// Groups maps group DNs to the Kubernetes groups their members
+	// impersonate. When set, only members of these groups may log in.
+	Groups map[string][]string `yaml:"groups"`
+	// CAFile, if set, verifies the certificate of the server against this
+	// PEM bundle instead of the system roots.
+	CAFile string `yaml:"caFile"`
+	// CacheTTL is how long a successful login is remembered.
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+}
+
+// HtpasswdConfig verifies proxy credentials against an Apache htpasswd file
+// instead of static users. It is enabled when File is set.
+type HtpasswdConfig struct {
+	// File holds MD5 (htpasswd -m) or SHA-1 (htpasswd -s) entries. It is
+	// reloaded when it changes.
+	File string `yaml:"file"`
+}
+
+// OIDCConfig accepts ID tokens of an OpenID Connect provider as proxy
+// passwords instead of static users. It is enabled when Issuer is set.
+type OIDCConfig struct {
+	// Issuer is the provider URL, as in the iss claim of its tokens.
+	Issuer string `yaml:"issuer"`
+	// ClientID is the audience the tokens must be issued for.
+	ClientID string `yaml:"clientID"`
+	// UsernameClaim holds the username, which the proxy username must
+	// equal.
+	UsernameClaim string `yaml:"usernameClaim"`
+	// GroupsClaim lists the Kubernetes groups the user impersonates. Empty
+	// impersonates no groups.
+	GroupsClaim string `yaml:"groupsClaim"`
+}
+
+// AuthConfig holds proxy authentication settings. Authentication is enabled
+// on the SOCKS5 and HTTP listeners when at least one user is configured, or
+// one of the other providers is.
+type AuthConfig struct {
+	Users    []AuthUserConfig `yaml:"users"`
+	LDAP     LDAPConfig       `yaml:"ldap"`
+	Htpasswd HtpasswdConfig   `yaml:"htpasswd"`
+	OIDC     OIDCConfig       `yaml:"oidc"`
+	// Namespaces maps usernames to the namespace used for their addresses
+	// without one, in place of the cluster's default.
+	Namespaces map[string]string `yaml:"namespaces"`
+}
+
+// providers returns the names of the configured authentication providers.
+func (a AuthConfig) providers() []string {
+	var names []string
+
+	for _, p := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"users", len(a.Users) > 0},
+		{"ldap", a.LDAP.URL != ""},
+		{"htpasswd", a.Htpasswd.File != ""},
+		{"oidc", a.OIDC.Issuer != ""},
+	} {
+		if p.enabled {
+			names = append(names, p.name)
+		}
+	}
+
+	return names
+}
+
+// HTTPTransportConfig tunes the transport the HTTP proxy forwards plain HTTP
+// requests with. CONNECT tunnels are not affected.
+type HTTPTransportConfig struct {
+	MaxIdleConnsPerHost   int           `yaml:"maxIdleConnsPerHost"`
+	IdleConnTimeout       time.Duration `yaml:"idleConnTimeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"responseHeaderTimeout"`
+	DisableCompression    bool          `yaml:"disableCompression"`
+}
+
+// HTTPCacheConfig configures caching of GET responses forwarded by the HTTP
+// proxy, honoring their Cache-Control and Expires headers.
+type HTTPCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Dir, if set, keeps the cache on disk across restarts instead of in
+	// memory.
+	Dir string `yaml:"dir"`
+	// Hosts limits caching to these hostnames, which may start with "*." to
+	// match every hostname ending in the rest. Empty caches all hosts.
+	Hosts          []string `yaml:"hosts"`
+	MaxSizeMB      int      `yaml:"maxSizeMB"`
+	MaxEntrySizeKB int      `yaml:"maxEntrySizeKB"`
+}
+
+// HostRewriteConfig sets the Host header of plain HTTP requests forwarded to
+// hosts matching Match, a hostname or "*." followed by a suffix. Host may
+// contain the placeholders {service}, {namespace} and {cluster}.
+type HostRewriteConfig struct {
+	Match string `yaml:"match"`
+	Host  string `yaml:"host"`
+}
+
+// SelectorTargetConfig routes connections to the virtual hostname Host,
+// <name>.<cluster> or <name>.<ns>.<cluster>, to a ready pod matching the
+// label selector Selector.
+type SelectorTargetConfig struct {
+	Host string `yaml:"host"`
+	// Namespace, if set, is the namespace of the pods, overriding the one in
+	// Host and the default namespace.
+	Namespace string `yaml:"namespace"`
+	Selector  string `yaml:"selector"`
+}
+
+// PrewarmConfig names a Service whose pods get port-forward connections kept
+// open.
+type PrewarmConfig struct {
+	Cluster string `yaml:"cluster"`
+	// Namespace defaults to the cluster's default namespace.
+	Namespace string `yaml:"namespace"`
+	Service   string `yaml:"service"`
+}
+
+// ForwardConfig is a static forward: a local port whose connections are
+// tunneled to a fixed address, like a kubectl port-forward kept running.
+type ForwardConfig struct {
+	// Address is the local host:port listened on.
+	Address string `yaml:"address"`
+	// Target is the address dialed for each connection, in any form the
+	// proxy accepts, e.g. postgres.db.production:5432.
+	Target string `yaml:"target"`
+}
+
+// PassthroughRouteConfig adjusts how passthrough connections to addresses
+// matching Match, a glob pattern with or without the port, are dialed.
+type PassthroughRouteConfig struct {
+	Match string `yaml:"match"`
+	// Listeners and Users, if set, restrict the route to connections
+	// received on listeners with matching addresses and from matching proxy
+	// users. Entries are glob patterns; the main SOCKS5 and HTTP listeners
+	// both have the listenAddress.
+	Listeners []string `yaml:"listeners"`
+	Users     []string `yaml:"users"`
+	// ProxyProtocol, if set, is the PROXY protocol version ("v1" or "v2")
+	// of a header sent to the upstream ahead of the client's data.
+	ProxyProtocol string `yaml:"proxyProtocol"`
+	// Label, if set, tags the matching connections in metrics, logs and the
+	// connection history, e.g. "internet".
+	Label string `yaml:"label"`
+}
+
+// RouteConfig declares the protocol of the upstream behind addresses
+// matching Match, a glob pattern with or without the port.
+type RouteConfig struct {
+	Match string `yaml:"match"`
+	// Protocol is "tcp" (the default), "http", "https" or "h2c".
+	Protocol  string               `yaml:"protocol"`
+	TLS       RouteTLSConfig       `yaml:"tls"`
+	Keepalive RouteKeepaliveConfig `yaml:"keepalive"`
+	// PairedPorts are ports, such as the control and data ports of a
+	// debugger, whose connections from one client go to the same pod.
+	PairedPorts []int `yaml:"pairedPorts"`
+}
+
+// RouteKeepaliveConfig keeps idle connections of a route alive behind NATs
+// and firewalls that drop them silently, e.g. long-idle database sessions.
+// Zero keeps the defaults.
+type RouteKeepaliveConfig struct {
+	// Client is the idle time after which TCP keepalive probes are sent to
+	// the proxy client, and their interval.
+	Client time.Duration `yaml:"client"`
+	// Upstream is the interval of SPDY pings on port-forwards, and of TCP
+	// keepalive probes on passthrough connections.
+	Upstream time.Duration `yaml:"upstream"`
+}
+
+// RouteTLSConfig makes podproxy originate TLS toward the upstream of a
+// route, so clients can speak plain text to it.
+type RouteTLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ServerName is sent as SNI and verified against the certificate.
+	// Empty uses the host of the address.
+	ServerName string `yaml:"serverName"`
+	// CertificateAuthority is a PEM bundle file verifying the upstream's
+	// certificate. Empty uses the system roots.
+	CertificateAuthority string `yaml:"certificateAuthority"`
+	InsecureSkipVerify   bool   `yaml:"insecureSkipVerify"`
+}
+
+// routeProtocols are the protocols RouteConfig.Protocol may name.
+var routeProtocols = []string{"tcp", "http", "https", "h2c"}
+
+// hostPlaceholders are the placeholders HostRewriteConfig.Host may contain.
+var hostPlaceholders = []string{"{service}", "{namespace}", "{cluster}"}
+
+// ListenerConfig is an additional SOCKS5 or HTTP listener, pinned to one
+// cluster or restricted to a subset of the clusters and namespaces.
+type ListenerConfig struct {
+	Address string `yaml:"address"`
+	// Protocol is "socks5" (the default), "http" or "sni", which tunnels
+	// TLS connections to the host their server name names.
+	Protocol string `yaml:"protocol"`
+	// Cluster pins the listener to one cluster: addresses received on it
+	// omit the cluster segment.
+	Cluster string `yaml:"cluster"`
+	// Namespace, if set, replaces the cluster's default namespace for
+	// addresses without one.
+	Namespace string `yaml:"namespace"`
+	// Clusters and Namespaces restrict the targets reachable through the
+	// listener. Entries are glob patterns; empty allows all.
+	Clusters   []string `yaml:"clusters"`
+	Namespaces []string `yaml:"namespaces"`
+	// SNISuffix, if set, is the domain the server names on an sni listener
+	// end in, stripped before dialing; other names are rejected.
+	SNISuffix string `yaml:"sniSuffix"`
+	// TargetPort is the port dialed for connections on an sni listener.
+	// Zero dials the listener's own port.
+	TargetPort int `yaml:"targetPort"`
+}
+
+// listenerProtocols are the valid values of ListenerConfig.Protocol.
+var listenerProtocols = []string{"", "socks5", "http", "sni"}
+
+// ClientInitConfig controls how cluster clients are created at startup.
+type ClientInitConfig struct {
+	// Concurrency is the number of clusters whose clients are created in
+	// parallel. Zero creates them one at a time.
+	Concurrency int `yaml:"concurrency"`
+	// Timeout skips a cluster whose client isn't ready in time. Zero waits
+	// indefinitely.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// StartupProbeConfig controls the API server connectivity check made for
+// every cluster at startup.
+type StartupProbeConfig struct {
+	// Enabled prints a summary of which clusters are reachable.
+	Enabled bool `yaml:"enabled"`
+	// Timeout bounds each probe. Zero waits indefinitely.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SystemProxyConfig controls pointing the per-user system proxy settings at
+// podproxy while it runs.
+type SystemProxyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Mode is "pac" to configure the PAC URL, or "static" to send all traffic
+	// through the HTTP proxy, or the SOCKS5 proxy without one.
+	Mode string `yaml:"mode"`
+}
+
+// DockerBridgeConfig makes the proxy listeners reachable from containers on
+// hosts where host.docker.internal maps to the Docker bridge.
+type DockerBridgeConfig struct {
+	// Enabled additionally binds the SOCKS5, HTTP and PAC listeners to the
+	// bridge address, on the same ports. Listeners bound to a wildcard
+	// address are reachable already and are left alone.
+	Enabled bool `yaml:"enabled"`
+	// Address of the bridge. Defaults to the IPv4 address of docker0.
+	Address string `yaml:"address"`
+}
+
+// NotificationsConfig controls desktop notifications, e.g. when a cluster's
+// OIDC login expired and connections fail until the user logs in again.
+type NotificationsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Events lists the events that notify, see notificationEvents.
+	Events []string `yaml:"events"`
+	// Connections lists glob patterns of the clusters whose opened
+	// connections notify with event connectionOpened. Empty means all.
+	Connections []string `yaml:"connections"`
+}
+
+// notificationEvents are the valid values of NotificationsConfig.Events.
+var notificationEvents = []string{"loginRequired", "clusterUnreachable", "connectionOpened"}
+
+// KeepAliveConfig holds the TCP keepalive settings of accepted client
+// connections, which keep NAT and firewall state alive while a tunnel idles.
+type KeepAliveConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Idle is how long a connection is idle before the first probe.
+	Idle time.Duration `yaml:"idle"`
+	// Interval between unanswered probes.
+	Interval time.Duration `yaml:"interval"`
+	// Count of unanswered probes after which the connection is dropped.
+	Count int `yaml:"count"`
+}
+
+// LeakReaperConfig controls closing leaked cluster connections.
+type LeakReaperConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Idle is how long a connection transfers no data before it is checked,
+	// and the interval between checks.
+	Idle time.Duration `yaml:"idle"`
+}
+
+// HealthCheckConfig controls probing the API servers of the clusters in the
+// background.
+type HealthCheckConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Interval is the time between probes of a cluster.
+	Interval time.Duration `yaml:"interval"`
+	// Timeout is how long a probe may take before the cluster counts as
+	// unreachable.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// ConnectionLimitConfig caps the open client connections of the proxy
+// listeners.
+type ConnectionLimitConfig struct {
+	// Max is the number of open connections; 0 disables the limit.
+	Max int `yaml:"max"`
+	// Policy handles connections beyond Max: queue, reject or shedIdle.
+	Policy string `yaml:"policy"`
+	// QueueTimeout is how long a queued connection waits for a slot.
+	QueueTimeout time.Duration `yaml:"queueTimeout"`
+	// ShedIdle is how long a connection must be idle to be closed for a new
+	// one under the shedIdle policy.
+	ShedIdle time.Duration `yaml:"shedIdle"`
+}
+
+// connectionLimitPolicies are the valid ConnectionLimitConfig.Policy values.
+var connectionLimitPolicies = []string{"queue", "reject", "shedIdle"}
+
+// FakeIPConfig controls synthetic IPs handed out to SOCKS5 clients that
+// resolve hostnames before connecting.
+type FakeIPConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Range is the CIDR addresses are assigned from, one per hostname.
+	Range string `yaml:"range"`
+	// TTL is how long an assignment is kept after its last use before the
+	// address may be reused. Zero keeps assignments forever.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// SessionAffinityConfig controls sticking the connections of a client to a
+// Service to one pod.
+type SessionAffinityConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Timeout is how long a client's pod is remembered after its last
+	// connection. Zero keeps it until the pod becomes unready.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// IngressRoutingConfig controls routing plain HTTP requests by Host header to
+// the Services that cluster Ingresses send them to.
+type IngressRoutingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Clusters whose Ingresses are matched. Empty matches all clusters.
+	Clusters []string `yaml:"clusters"`
+	// RefreshInterval is how long listed Ingresses are reused.
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+	// ServiceSelector, if set, selects Services that are routed under the
+	// hostnames of their external-dns hostname annotation.
+	ServiceSelector string `yaml:"serviceSelector"`
+}
+
+// LocalhostRoutingConfig controls forwarding requests to *.localhost names
+// that browsers send to the HTTP listener without a proxy.
+type LocalhostRoutingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Port is the target port of names without a leading port label.
+	Port int `yaml:"port"`
+}
+
+// ServiceDiscoveryConfig controls listing cluster Services on the admin API.
+type ServiceDiscoveryConfig struct {
+	// Enabled keeps the Services of every cluster in an informer cache and
+	// serves them under /api/services.
+	Enabled bool `yaml:"enabled"`
+}
+
+// AdminUserConfig is a user allowed to access the admin listener.
+type AdminUserConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Role is "admin" (the default), with full access, or "observer", which
+	// can only read.
+	Role string `yaml:"role"`
+}
+
+// adminRoles are the valid AdminUserConfig.Role values.
+var adminRoles = []string{"admin", "observer"}
+
+// AdminConfig holds settings of the admin listener. Its credentials are
+// independent of the proxy users in AuthConfig.
+type AdminConfig struct {
+	// Users, when non-empty, requires Basic authentication on every admin
+	// endpoint, including /metrics.
+	Users []AdminUserConfig `yaml:"users"`
+	// Pprof exposes the Go runtime profiler under /debug/pprof/.
+	Pprof bool `yaml:"pprof"`
+}
+
+// PushgatewayConfig configures periodic pushes to a Prometheus Pushgateway.
+type PushgatewayConfig struct {
+	// URL of the Pushgateway. Empty disables pushing.
+	URL      string        `yaml:"url"`
+	Job      string        `yaml:"job"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// MetricsConfig holds metrics settings.
+type MetricsConfig struct {
+	Pushgateway PushgatewayConfig `yaml:"pushgateway"`
+}
+
+// Config holds the top-level application configuration.
+type Config struct {
+	ListenAddress         string         `yaml:"listenAddress"`
+	HTTPListenAddress     string         `yaml:"httpListenAddress"`
+	PACListenAddress      string         `yaml:"pacListenAddress"`
+	AdminListenAddress    string         `yaml:"adminListenAddress"`
+	PIDFile               string         `yaml:"pidFile"`
+	PortFile              string         `yaml:"portFile"`
+	SkipDefaultKubeconfig bool           `yaml:"skipDefaultKubeconfig"`
+	SkipKubeconfigEnv     bool           `yaml:"skipKubeconfigEnv"`
+	Kubeconfigs           []string       `yaml:"kubeconfigs"`
+	Teleport              TeleportConfig `yaml:"teleport"`
+	Log                   LogConfig      `yaml:"log"`
+	History               HistoryConfig  `yaml:"history"`
+	State                 StateConfig    `yaml:"state"`
+	Auth                  AuthConfig     `yaml:"auth"`
+	Admin                 AdminConfig    `yaml:"admin"`
+	Metrics               MetricsConfig  `yaml:"metrics"`
+
+	ClusterDefaults ClusterSettings            `yaml:"clusterDefaults"`
+	Clusters        map[string]ClusterSettings `yaml:"clusters"`
+	// SharedRateLimit, when QPS is set, replaces the per-cluster rate limiters
+	// with a single token bucket shared by all clusters.
+	SharedRateLimit RateLimitConfig `yaml:"sharedRateLimit"`
+
+	ClientInit   ClientInitConfig   `yaml:"clientInit"`
+	StartupProbe StartupProbeConfig `yaml:"startupProbe"`
+
+	HTTPTransport HTTPTransportConfig `yaml:"httpTransport"`
+	HTTPCache     HTTPCacheConfig     `yaml:"httpCache"`
+	// HostRewrites are applied in order; the first match wins.
+	HostRewrites []HostRewriteConfig `yaml:"hostRewrites"`
+	// SelectorTargets name the pods matching label selectors under virtual
+	// hostnames.
+	SelectorTargets []SelectorTargetConfig `yaml:"selectorTargets"`
+	// Prewarm lists Services whose pods get port-forward connections kept
+	// open from startup, so the first connections to them are fast.
+	Prewarm []PrewarmConfig `yaml:"prewarm"`
+	// PassthroughRoutes apply to addresses outside the clusters; the first
+	// match wins.
+	PassthroughRoutes []PassthroughRouteConfig `yaml:"passthroughRoutes"`
+	// Routes declare the protocols of upstreams, in or outside the
+	// clusters; the first match wins.
+	Routes []RouteConfig `yaml:"routes"`
+
+	// Listeners are additional SOCKS5 listeners pinned to a single cluster.
+	Listeners []ListenerConfig `yaml:"listeners"`
+
+	// Forwards are local ports tunneled to fixed addresses.
+	Forwards []ForwardConfig `yaml:"forwards"`
+	// ForwardManifests are files of kubectl port-forward style forwards,
+	// imported into Forwards and Routes when the config is loaded.
+	ForwardManifests []string `yaml:"forwardManifests"`
+
+	// NoProxy lists hosts, domains (".example.com") and CIDRs that clients
+	// should reach directly, added to the generated NO_PROXY value and the
+	// PAC file.
+	NoProxy []string `yaml:"noProxy"`
+
+	SystemProxy  SystemProxyConfig  `yaml:"systemProxy"`
+	DockerBridge DockerBridgeConfig `yaml:"dockerBridge"`
+	// PACCompanion serves endpoints for browser extensions and bookmarklets
+	// under /companion on the PAC listener.
+	PACCompanion bool `yaml:"pacCompanion"`
+
+	Notifications NotificationsConfig `yaml:"notifications"`
+
+	FakeIP FakeIPConfig `yaml:"fakeIP"`
+
+	SessionAffinity SessionAffinityConfig `yaml:"sessionAffinity"`
+
+	IngressRouting   IngressRoutingConfig   `yaml:"ingressRouting"`
+	LocalhostRouting LocalhostRoutingConfig `yaml:"localhostRouting"`
+	ServiceDiscovery ServiceDiscoveryConfig `yaml:"serviceDiscovery"`
+
+	// ClientKeepAlive configures TCP keepalives on connections accepted by
+	// the SOCKS5 and HTTP proxy listeners.
+	ClientKeepAlive KeepAliveConfig `yaml:"clientKeepAlive"`
+	// ClientRateLimit, when QPS is set, limits how fast each client IP, or
+	// user when authenticated, may open proxy connections.
+	ClientRateLimit RateLimitConfig `yaml:"clientRateLimit"`
+	// ConnectionLimit caps the open client connections.
+	ConnectionLimit ConnectionLimitConfig `yaml:"connectionLimit"`
+	// LeakReaper closes cluster connections left open after their tunnel or
+	// client went away.
+	LeakReaper LeakReaperConfig `yaml:"leakReaper"`
+
+	// HealthCheck probes the API server of every cluster, failing
+	// connections to unreachable ones fast.
+	HealthCheck HealthCheckConfig `yaml:"healthCheck"`
+
+	// ReusePort binds the listeners with SO_REUSEPORT, so a replacement
+	// instance started with --replace can bind them before this one stops.
+	ReusePort bool `yaml:"reusePort"`
+	// DrainTimeout is how long open connections may keep running after the
+	// listeners close on shutdown. Zero closes them immediately.
+	DrainTimeout time.Duration `yaml:"drainTimeout"`
+}
+
+// defaultKubeconfigPathFunc returns the path to the default kubeconfig file.
+// overridden in tests to point at a temp file.
+var defaultKubeconfigPathFunc = func() string {
+	return ExpandTilde("~/.kube/config")
+}
+
+// inClusterNamespaceFile holds the namespace of the pod podproxy runs in.
+// overridden in tests.
+var inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// ResolvedCluster holds per-cluster settings derived from kubeconfig contexts
+// or in-cluster entries.
+type ResolvedCluster struct {
+	Name       string
+	Kubeconfig string
+	Context    string
+	Namespace  string
+	// Source is where the cluster was found: "default", "KUBECONFIG env",
+	// "config", "config glob", "teleport" or "inCluster".
+	Source string
+	// InCluster clusters are reached with the pod's service account instead
+	// of a kubeconfig.
+	InCluster bool
+	Settings  ClusterSettings
+}
+
+// LoadConfig reads a YAML config file and returns a validated Config
+// along with the resolved clusters derived from kubeconfig discovery.
+func LoadConfig(path string) (*Config, []ResolvedCluster, error) {
+	cfg, err := parseConfig(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// set up the global logger early so resolve output uses the configured logger
+	if err := SetupGlobalLogger(cfg); err != nil {
+		return nil, nil, fmt.Errorf("setting up logger: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	clusters, err := resolveKubeconfigs(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving kubeconfigs: %w", err)
+	}
+
+	if err := ValidateClusters(clusters); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := validateListenerClusters(cfg.Listeners, clusters); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := validateIngressClusters(cfg.IngressRouting.Clusters, clusters); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := validateSelectorClusters(cfg.SelectorTargets, clusters); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := validatePrewarmClusters(cfg.Prewarm, clusters); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	applyClusterSettings(cfg, clusters)
+
+	return cfg, clusters, nil
+}
+
+// Load reads and validates a YAML config file without setting up the global
+// logger or resolving kubeconfigs. It is meant for client subcommands that
+// only need the static settings of a (possibly running) instance.
+func Load(path string) (*Config, error) {
+	cfg, err := parseConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// parseConfig applies the embedded defaults and overlays the config file at
+// path on top of them. A missing file yields the defaults.
+func parseConfig(path string) (*Config, error) {
+	var cfg Config
+
+	// apply embedded defaults first
+	if err := yaml.Unmarshal(DefaultConfigData, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing default config: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	if len(data) > 0 {
+		// overlay user config on top of defaults
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parsing config file: %w", err)
+		}
+	}
+
+	cfg.PIDFile = ExpandTilde(cfg.PIDFile)
+	cfg.PortFile = ExpandTilde(cfg.PortFile)
+	cfg.History.File = ExpandTilde(cfg.History.File)
+	cfg.State.File = ExpandTilde(cfg.State.File)
+	cfg.Auth.LDAP.CAFile = ExpandTilde(cfg.Auth.LDAP.CAFile)
+	cfg.Auth.Htpasswd.File = ExpandTilde(cfg.Auth.Htpasswd.File)
+	cfg.HTTPCache.Dir = ExpandTilde(cfg.HTTPCache.Dir)
+	cfg.Teleport.Kubeconfig = ExpandTilde(cfg.Teleport.Kubeconfig)
+	cfg.ClusterDefaults.CertificateAuthority = ExpandTilde(cfg.ClusterDefaults.CertificateAuthority)
+	cfg.ClusterDefaults.Vault.TokenFile = ExpandTilde(cfg.ClusterDefaults.Vault.TokenFile)
+
+	for i := range cfg.Routes {
+		cfg.Routes[i].TLS.CertificateAuthority = ExpandTilde(cfg.Routes[i].TLS.CertificateAuthority)
+	}
+
+	for name, cs := range cfg.Clusters {
+		cs.CertificateAuthority = ExpandTilde(cs.CertificateAuthority)
+		cs.Vault.TokenFile = ExpandTilde(cs.Vault.TokenFile)
+		cfg.Clusters[name] = cs
+	}
+
+	// routes of the config file come first, so they win over imported ones.
+	for _, manifest := range cfg.ForwardManifests {
+		forwards, routes, err := importForwardManifest(ExpandTilde(manifest))
+		if err != nil {
+			return nil, fmt.Errorf("importing forward manifest %s: %w", manifest, err)
+		}
+
+		cfg.Forwards = append(cfg.Forwards, forwards...)
+		cfg.Routes = append(cfg.Routes, routes...)
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks that the static config fields are well-formed.
+func (c *Config) Validate() error {
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		return fmt.Errorf("invalid listenAddress %q: %w", c.ListenAddress, err)
+	}
+
+	if c.HTTPListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.HTTPListenAddress); err != nil {
+			return fmt.Errorf("invalid httpListenAddress %q: %w", c.HTTPListenAddress, err)
+		}
+	}
+
+	if err := c.HTTPTransport.validate(); err != nil {
+		return fmt.Errorf("invalid httpTransport: %w", err)
+	}
+
+	if c.PACListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.PACListenAddress); err != nil {
+			return fmt.Errorf("invalid pacListenAddress %q: %w", c.PACListenAddress, err)
+		}
+	}
+
+	if c.Teleport.Enabled && (c.Teleport.Tsh == "" || c.Teleport.Kubeconfig == "") {
+		return errors.New("teleport requires tsh and kubeconfig")
+	}
+
+	if c.Teleport.Timeout < 0 {
+		return fmt.Errorf("teleport.timeout %v must not be negative", c.Teleport.Timeout)
+	}
+
+	if c.PACCompanion && c.PACListenAddress == "" {
+		return errors.New("pacCompanion requires pacListenAddress")
+	}
+
+	if c.AdminListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.AdminListenAddress); err != nil {
+			return fmt.Errorf("invalid adminListenAddress %q: %w", c.AdminListenAddress, err)
+		}
+
+		// keep operational endpoints off the proxy ports, where they would be
+		// exposed to every proxy client.
+		for _, other := range []struct{ name, addr string }{
+			{"listenAddress", c.ListenAddress},
+			{"httpListenAddress", c.HTTPListenAddress},
+			{"pacListenAddress", c.PACListenAddress},
+		} {
+			if listenAddressesOverlap(c.AdminListenAddress, other.addr) {
+				return fmt.Errorf("adminListenAddress %q must differ from %s %q", c.AdminListenAddress, other.name, other.addr)
+			}
+		}
+	}
+
+	if err := c.validateListeners(); err != nil {
+		return err
+	}
+
+	if err := c.validateForwards(); err != nil {
+		return err
+	}
+
+	for i, entry := range c.NoProxy {
+		if entry == "" || strings.ContainsAny(entry, ", \t") {
+			return fmt.Errorf("noProxy[%d] %q must be a single host, domain or CIDR", i, entry)
+		}
+
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("noProxy[%d]: %w", i, err)
+			}
+		}
+	}
+
+	if err := c.validateSystemProxy(); err != nil {
+		return fmt.Errorf("invalid systemProxy: %w", err)
+	}
+
+	if err := c.Notifications.validate(); err != nil {
+		return fmt.Errorf("invalid notifications: %w", err)
+	}
+
+	if addr := c.DockerBridge.Address; addr != "" && net.ParseIP(addr) == nil {
+		return fmt.Errorf("invalid dockerBridge.address %q: not an IP address", addr)
+	}
+
+	if c.FakeIP.Enabled {
+		if _, err := netip.ParsePrefix(c.FakeIP.Range); err != nil {
+			return fmt.Errorf("invalid fakeIP.range %q: %w", c.FakeIP.Range, err)
+		}
+	}
+
+	if c.FakeIP.TTL < 0 {
+		return fmt.Errorf("fakeIP.ttl %v must not be negative", c.FakeIP.TTL)
+	}
+
+	if c.SessionAffinity.Timeout < 0 {
+		return fmt.Errorf("sessionAffinity.timeout %v must not be negative", c.SessionAffinity.Timeout)
+	}
+
+	if c.IngressRouting.Enabled && c.IngressRouting.RefreshInterval <= 0 {
+		return fmt.Errorf("ingressRouting.refreshInterval %v must be positive", c.IngressRouting.RefreshInterval)
+	}
+
+	if _, err := labels.Parse(c.IngressRouting.ServiceSelector); err != nil {
+		return fmt.Errorf("invalid ingressRouting.serviceSelector: %w", err)
+	}
+
+	if c.LocalhostRouting.Enabled {
+		if c.LocalhostRouting.Port < 1 || c.LocalhostRouting.Port > 65535 {
+			return fmt.Errorf("localhostRouting.port %d must be 1-65535", c.LocalhostRouting.Port)
+		}
+
+		// browsers send requests to *.localhost without proxy credentials.
+		if len(c.Auth.providers()) > 0 {
+			return errors.New("localhostRouting can't authenticate clients, so it can't be combined with auth")
+		}
+	}
+
+	if c.HTTPCache.Enabled && c.HTTPCache.MaxSizeMB <= 0 {
+		return fmt.Errorf("httpCache.maxSizeMB %d must be positive", c.HTTPCache.MaxSizeMB)
+	}
+
+	if c.HTTPCache.Enabled && c.HTTPCache.MaxEntrySizeKB <= 0 {
+		return fmt.Errorf("httpCache.maxEntrySizeKB %d must be positive", c.HTTPCache.MaxEntrySizeKB)
+	}
+
+	for i, rw := range c.HostRewrites {
+		if err := rw.validate(); err != nil {
+			return fmt.Errorf("hostRewrites[%d]: %w", i, err)
+		}
+	}
+
+	hosts := make(map[string]bool, len(c.SelectorTargets))
+
+	for i, st := range c.SelectorTargets {
+		if err := st.validate(); err != nil {
+			return fmt.Errorf("selectorTargets[%d]: %w", i, err)
+		}
+
+		host := strings.ToLower(st.Host)
+		if hosts[host] {
+			return fmt.Errorf("selectorTargets[%d]: duplicate host %q", i, st.Host)
+		}
+
+		hosts[host] = true
+	}
+
+	for i, p := range c.Prewarm {
+		if p.Cluster == "" || p.Service == "" {
+			return fmt.Errorf("prewarm[%d]: cluster and service are required", i)
+		}
+	}
+
+	for i, r := range c.PassthroughRoutes {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("passthroughRoutes[%d]: %w", i, err)
+		}
+	}
+
+	for i, r := range c.Routes {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("routes[%d]: %w", i, err)
+		}
+	}
+
+	if c.Log.Buffer < 0 {
+		return fmt.Errorf("log.buffer %d must not be negative", c.Log.Buffer)
+	}
+
+	for _, pattern := range c.Log.Trace {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("log.trace: invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	if c.DrainTimeout < 0 {
+		return fmt.Errorf("drainTimeout %v must not be negative", c.DrainTimeout)
+	}
+
+	if ka := c.ClientKeepAlive; ka.Enabled && (ka.Idle <= 0 || ka.Interval <= 0 || ka.Count <= 0) {
+		return fmt.Errorf("clientKeepAlive idle %v, interval %v and count %d must be positive", ka.Idle, ka.Interval, ka.Count)
+	}
+
+	if c.ClientRateLimit.QPS < 0 || c.ClientRateLimit.Burst < 0 {
+		return errors.New("invalid clientRateLimit: qps and burst must not be negative")
+	}
+
+	if c.ClientRateLimit.QPS > 0 && c.ClientRateLimit.Burst < 1 {
+		return errors.New("invalid clientRateLimit: burst must be at least 1 when qps is set")
+	}
+
+	if err := c.ConnectionLimit.validate(); err != nil {
+		return fmt.Errorf("invalid connectionLimit: %w", err)
+	}
+
+	if c.LeakReaper.Enabled && c.LeakReaper.Idle <= 0 {
+		return fmt.Errorf("leakReaper idle %v must be positive", c.LeakReaper.Idle)
+	}
+
+	if c.HealthCheck.Enabled && c.HealthCheck.Interval <= 0 {
+		return fmt.Errorf("healthCheck.interval %v must be positive", c.HealthCheck.Interval)
+	}
+
+	if c.HealthCheck.Timeout < 0 {
+		return fmt.Errorf("healthCheck.timeout %v must not be negative", c.HealthCheck.Timeout)
+	}
+
+	if c.History.File != "" && c.History.Retention <= 0 {
+		return fmt.Errorf("history.retention %v must be positive", c.History.Retention)
+	}
+
+	if c.State.File != "" && c.State.File == c.History.File {
+		return errors.New("state.file must differ from history.file")
+	}
+
+	if err := c.ClusterDefaults.validate(); err != nil {
+		return fmt.Errorf("invalid clusterDefaults: %w", err)
+	}
+
+	if c.ClusterDefaults.InCluster || c.ClusterDefaults.Namespace != "" || len(c.ClusterDefaults.PodCIDRs) > 0 {
+		return errors.New("invalid clusterDefaults: inCluster, namespace and podCIDRs can only be set for a single cluster")
+	}
+
+	for name, cs := range c.Clusters {
+		if err := cs.validate(); err != nil {
+			return fmt.Errorf("invalid clusters.%s: %w", name, err)
+		}
+
+		if Enabled(cs.Preflight) && !c.ServiceDiscovery.Enabled {
+			return fmt.Errorf("invalid clusters.%s: preflight requires serviceDiscovery.enabled", name)
+		}
+	}
+
+	if err := validatePodCIDRs(c.Clusters); err != nil {
+		return err
+	}
+
+	if Enabled(c.ClusterDefaults.Preflight) && !c.ServiceDiscovery.Enabled {
+		return errors.New("invalid clusterDefaults: preflight requires serviceDiscovery.enabled")
+	}
+
+	if c.ClientInit.Concurrency < 0 {
+		return fmt.Errorf("clientInit.concurrency %d must not be negative", c.ClientInit.Concurrency)
+	}
+
+	if c.ClientInit.Timeout < 0 {
+		return fmt.Errorf("clientInit.timeout %v must not be negative", c.ClientInit.Timeout)
+	}
+
+	if c.StartupProbe.Timeout < 0 {
+		return fmt.Errorf("startupProbe.timeout %v must not be negative", c.StartupProbe.Timeout)
+	}
+
+	if c.SharedRateLimit.QPS < 0 || c.SharedRateLimit.Burst < 0 {
+		return errors.New("invalid sharedRateLimit: qps and burst must not be negative")
+	}
+
+	if c.SharedRateLimit.QPS > 0 && c.SharedRateLimit.Burst < 1 {
+		return errors.New("invalid sharedRateLimit: burst must be at least 1 when qps is set")
+	}
+
+	if err := c.Auth.validate(); err != nil {
+		return fmt.Errorf("invalid auth: %w", err)
+	}
+
+	if err := c.Admin.validate(); err != nil {
+		return fmt.Errorf("invalid admin: %w", err)
+	}
+
+	if pg := c.Metrics.Pushgateway; pg.URL != "" {
+		if _, err := url.Parse(pg.URL); err != nil {
+			return fmt.Errorf("invalid metrics.pushgateway.url %q: %w", pg.URL, err)
+		}
+
+		if pg.Job == "" {
+			return errors.New("metrics.pushgateway.job must not be empty")
+		}
+
+		if pg.Interval <= 0 {
+			return fmt.Errorf("metrics.pushgateway.interval %v must be positive", pg.Interval)
+		}
+	}
+
+	return nil
+}
+
+// validateListeners checks the pinned listeners. Their clusters are checked by
+// validateListenerClusters once kubeconfigs are resolved.
+func (c *Config) validateListeners() error {
+	for i, l := range c.Listeners {
+		if _, _, err := net.SplitHostPort(l.Address); err != nil {
+			return fmt.Errorf("invalid listeners[%d].address %q: %w", i, l.Address, err)
+		}
+
+		if !slices.Contains(listenerProtocols, l.Protocol) {
+			return fmt.Errorf("listeners[%d].protocol %q must be socks5, http or sni", i, l.Protocol)
+		}
+
+		if l.Protocol != "sni" && (l.SNISuffix != "" || l.TargetPort != 0) {
+			return fmt.Errorf("listeners[%d]: sniSuffix and targetPort require protocol sni", i)
+		}
+
+		if l.TargetPort < 0 || l.TargetPort > 65535 {
+			return fmt.Errorf("listeners[%d].targetPort %d must be 1-65535", i, l.TargetPort)
+		}
+
+		// TLS passes through untouched, so there are no proxy credentials
+		// to check.
+		if l.Protocol == "sni" && len(c.Auth.providers()) > 0 {
+			return fmt.Errorf("listeners[%d]: protocol sni can't authenticate clients, so it can't be combined with auth", i)
+		}
+
+		if l.Cluster != "" && len(l.Clusters) > 0 {
+			return fmt.Errorf("listeners[%d]: cluster and clusters are mutually exclusive", i)
+		}
+
+		if l.Namespace != "" && l.Cluster == "" {
+			return fmt.Errorf("listeners[%d].namespace requires cluster", i)
+		}
+
+		for _, pattern := range slices.Concat(l.Clusters, l.Namespaces) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("listeners[%d]: invalid pattern %q: %w", i, pattern, err)
+			}
+		}
+
+		others := []struct{ name, addr string }{
+			{"listenAddress", c.ListenAddress},
+			{"httpListenAddress", c.HTTPListenAddress},
+			{"pacListenAddress", c.PACListenAddress},
+			{"adminListenAddress", c.AdminListenAddress},
+		}
+
+		for j, other := range c.Listeners[:i] {
+			others = append(others, struct{ name, addr string }{fmt.Sprintf("listeners[%d].address", j), other.Address})
+		}
+
+		for _, other := range others {
+			if listenAddressesOverlap(l.Address, other.addr) {
+				return fmt.Errorf("listeners[%d].address %q must differ from %s %q", i, l.Address, other.name, other.addr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateForwards checks that every forward has a target and a local
+// address of its own.
+func (c *Config) validateForwards() error {
+	for i, f := range c.Forwards {
+		if _, _, err := net.SplitHostPort(f.Address); err != nil {
+			return fmt.Errorf("invalid forwards[%d].address %q: %w", i, f.Address, err)
+		}
+
+		host, port, err := net.SplitHostPort(f.Target)
+		if err != nil || host == "" {
+			return fmt.Errorf("forwards[%d].target %q must be host:port", i, f.Target)
+		}
+
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("forwards[%d].target %q: port must be 1-65535", i, f.Target)
+		}
+
+		others := []struct{ name, addr string }{
+			{"listenAddress", c.ListenAddress},
+			{"httpListenAddress", c.HTTPListenAddress},
+			{"pacListenAddress", c.PACListenAddress},
+			{"adminListenAddress", c.AdminListenAddress},
+		}
+
+		for j, l := range c.Listeners {
+			others = append(others, struct{ name, addr string }{fmt.Sprintf("listeners[%d].address", j), l.Address})
+		}
+
+		for j, other := range c.Forwards[:i] {
+			others = append(others, struct{ name, addr string }{fmt.Sprintf("forwards[%d].address", j), other.Address})
+		}
+
+		for _, other := range others {
+			if listenAddressesOverlap(f.Address, other.addr) {
+				return fmt.Errorf("forwards[%d].address %q must differ from %s %q", i, f.Address, other.name, other.addr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateListenerClusters checks that every pinned listener refers to a
+// resolved cluster.
+func validateListenerClusters(listeners []ListenerConfig, clusters []ResolvedCluster) error {
+	known := make(map[string]bool, len(clusters))
+	for _, rc := range clusters {
+		known[rc.Name] = true
+	}
+
+	for i, l := range listeners {
+		if l.Cluster != "" && !known[l.Cluster] {
+			return fmt.Errorf("listeners[%d].cluster %q is not a known cluster", i, l.Cluster)
+		}
+	}
+
+	return nil
+}
+
+// validateSelectorClusters checks that the hostnames of selector targets end
+// in a known cluster, which routes them to the cluster.
+func validateSelectorClusters(targets []SelectorTargetConfig, clusters []ResolvedCluster) error {
+	known := make(map[string]bool, len(clusters))
+	for _, rc := range clusters {
+		known[rc.Name] = true
+	}
+
+	for i, st := range targets {
+		host := strings.ToLower(strings.TrimSuffix(st.Host, "."))
+		if cluster := host[strings.LastIndex(host, ".")+1:]; !known[cluster] {
+			return fmt.Errorf("selectorTargets[%d].host %q does not end in a known cluster", i, st.Host)
+		}
+	}
+
+	return nil
+}
+
+// validatePrewarmClusters checks that pre-warmed Services are in known
+// clusters.
+func validatePrewarmClusters(prewarm []PrewarmConfig, clusters []ResolvedCluster) error {
+	known := make(map[string]bool, len(clusters))
+	for _, rc := range clusters {
+		known[rc.Name] = true
+	}
+
+	for i, p := range prewarm {
+		if !known[p.Cluster] {
+			return fmt.Errorf("prewarm[%d].cluster %q is not a known cluster", i, p.Cluster)
+		}
+	}
+
+	return nil
+}
+
+func validateIngressClusters(names []string, clusters []ResolvedCluster) error {
+	known := make(map[string]bool, len(clusters))
+	for _, rc := range clusters {
+		known[rc.Name] = true
+	}
+
+	for i, name := range names {
+		if !known[name] {
+			return fmt.Errorf("ingressRouting.clusters[%d] %q is not a known cluster", i, name)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateSystemProxy() error {
+	if !c.SystemProxy.Enabled {
+		return nil
+	}
+
+	switch c.SystemProxy.Mode {
+	case "pac":
+		if c.PACListenAddress == "" {
+			return errors.New("mode pac requires pacListenAddress")
+		}
+	case "static":
+	default:
+		return fmt.Errorf("unknown mode %q (expected pac or static)", c.SystemProxy.Mode)
+	}
+
+	return nil
+}
+
+func (n NotificationsConfig) validate() error {
+	for _, event := range n.Events {
+		if !slices.Contains(notificationEvents, event) {
+			return fmt.Errorf("unknown event %q (must be one of %s)", event, strings.Join(notificationEvents, ", "))
+		}
+	}
+
+	for _, pattern := range n.Connections {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("connections: invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+func (a AuthConfig) validate() error {
+	providers := a.providers()
+	if len(providers) > 1 {
+		return fmt.Errorf("%s are mutually exclusive", strings.Join(providers, " and "))
+	}
+
+	if len(a.Namespaces) > 0 && len(providers) == 0 {
+		return errors.New("namespaces requires an authentication provider")
+	}
+
+	for user, ns := range a.Namespaces {
+		if ns == "" {
+			return fmt.Errorf("namespace for user %q must not be empty", user)
+		}
+	}
+
+	if a.OIDC.Issuer != "" {
+		if err := a.OIDC.validate(); err != nil {
+			return fmt.Errorf("oidc: %w", err)
+		}
+	}
+
+	if a.LDAP.URL != "" {
+		if err := a.LDAP.validate(); err != nil {
+			return fmt.Errorf("ldap: %w", err)
+		}
+	}
+
+	usernames := make(map[string]bool, len(a.Users))
+
+	for _, u := range a.Users {
+		if u.Username == "" {
+			return errors.New("username must not be empty")
+		}
+
+		if u.Password == "" {
+			return fmt.Errorf("password for user %q must not be empty", u.Username)
+		}
+
+		if usernames[u.Username] {
+			return fmt.Errorf("duplicate user %q", u.Username)
+		}
+
+		usernames[u.Username] = true
+	}
+
+	return nil
+}
+
+func (o OIDCConfig) validate() error {
+	u, err := url.Parse(o.Issuer)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("issuer %q must be an http(s) URL", o.Issuer)
+	}
+
+	if o.ClientID == "" {
+		return errors.New("clientID is required")
+	}
+
+	if o.UsernameClaim == "" {
+		return errors.New("usernameClaim must not be empty")
+	}
+
+	return nil
+}
+
+func (l LDAPConfig) validate() error {
+	u, err := url.Parse(l.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Hostname() == "" {
+		return fmt.Errorf("url %q must be ldap://host[:port] or ldaps://host[:port]", l.URL)
+	}
+
+	if l.InsecurePlaintext && u.Scheme == "ldaps" {
+		return errors.New("insecurePlaintext only applies to ldap:// urls")
+	}
+
+	if l.BaseDN == "" {
+		return errors.New("baseDN is required")
+	}
+
+	if l.UserAttribute == "" || l.GroupAttribute == "" {
+		return errors.New("userAttribute and groupAttribute must not be empty")
+	}
+
+	if l.CacheTTL < 0 {
+		return fmt.Errorf("cacheTTL %v must not be negative", l.CacheTTL)
+	}
+
+	return nil
+}
+
+func (t HTTPTransportConfig) validate() error {
+	if t.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("maxIdleConnsPerHost %d must not be negative", t.MaxIdleConnsPerHost)
+	}
+
+	if t.IdleConnTimeout < 0 {
+		return fmt.Errorf("idleConnTimeout %v must not be negative", t.IdleConnTimeout)
+	}
+
+	if t.ResponseHeaderTimeout < 0 {
+		return fmt.Errorf("responseHeaderTimeout %v must not be negative", t.ResponseHeaderTimeout)
+	}
+
+	return nil
+}
+
+func (l ConnectionLimitConfig) validate() error {
+	if l.Max < 0 {
+		return fmt.Errorf("max %d must not be negative", l.Max)
+	}
+
+	if l.Max == 0 {
+		return nil
+	}
+
+	if !slices.Contains(connectionLimitPolicies, l.Policy) {
+		return fmt.Errorf("policy %q must be queue, reject or shedIdle", l.Policy)
+	}
+
+	// a connection queued indefinitely would also hold up shutdown.
+	if l.QueueTimeout <= 0 {
+		return fmt.Errorf("queueTimeout %v must be positive", l.QueueTimeout)
+	}
+
+	if l.ShedIdle < 0 {
+		return fmt.Errorf("shedIdle %v must not be negative", l.ShedIdle)
+	}
+
+	return nil
+}
+
+func (a AdminConfig) validate() error {
+	usernames := make(map[string]bool, len(a.Users))
+
+	for _, u := range a.Users {
+		if u.Username == "" {
+			return errors.New("username must not be empty")
+		}
+
+		if u.Password == "" {
+			return fmt.Errorf("password for user %q must not be empty", u.Username)
+		}
+
+		if u.Role != "" && !slices.Contains(adminRoles, u.Role) {
+			return fmt.Errorf("role %q of user %q must be one of %s", u.Role, u.Username, strings.Join(adminRoles, ", "))
+		}
+
+		if usernames[u.Username] {
+			return fmt.Errorf("duplicate user %q", u.Username)
+		}
+
+		usernames[u.Username] = true
+	}
+
+	return nil
+}
+
+// listenAddressesOverlap reports whether two listen addresses would bind the
+// same port, treating an empty or unspecified host as every interface.
+func listenAddressesOverlap(a, b string) bool {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+
+	if errA != nil || errB != nil || portA != portB || portA == "0" {
+		return false
+	}
+
+	return hostA == hostB || isUnspecifiedHost(hostA) || isUnspecifiedHost(hostB)
+}
+
+func isUnspecifiedHost(host string) bool {
+	if host == "" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsUnspecified()
+}
+
+func (rw HostRewriteConfig) validate() error {
+	if rw.Match == "" || rw.Match == "*." {
+		return errors.New("match is required")
+	}
+
+	if rw.Host == "" {
+		return errors.New("host is required")
+	}
+
+	rest := rw.Host
+	for _, p := range hostPlaceholders {
+		rest = strings.ReplaceAll(rest, p, "")
+	}
+
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("host %q has an unknown placeholder (must be one of %s)", rw.Host, strings.Join(hostPlaceholders, ", "))
+	}
+
+	return nil
+}
+
+func (st SelectorTargetConfig) validate() error {
+	if st.Host == "" {
+		return errors.New("host is required")
+	}
+
+	if strings.Contains(st.Host, ":") || !strings.Contains(st.Host, ".") {
+		return fmt.Errorf("host %q must be <name>.<cluster> or <name>.<ns>.<cluster>, without a port", st.Host)
+	}
 
-// LogConfig holds logging configuration.
-type LogConfig struct {
-	Level     string `yaml:"level"`
-	File      string `yaml:"file"`
-	Formatter string `yaml:"formatter"`
-	Colors    bool   `yaml:"colors"`
-	Timestamp bool   `yaml:"timestamp"`
-}
+	if strings.TrimSpace(st.Selector) == "" {
+		return errors.New("selector is required")
+	}
 
-// Config holds the top-level application configuration.
-type Config struct {
-	ListenAddress         string    `yaml:"listenAddress"`
-	HTTPListenAddress     string    `yaml:"httpListenAddress"`
-	PACListenAddress      string    `yaml:"pacListenAddress"`
-	SkipDefaultKubeconfig bool      `yaml:"skipDefaultKubeconfig"`
-	SkipKubeconfigEnv     bool      `yaml:"skipKubeconfigEnv"`
-	Kubeconfigs           []string  `yaml:"kubeconfigs"`
-	Log                   LogConfig `yaml:"log"`
+	if _, err := labels.Parse(st.Selector); err != nil {
+		return fmt.Errorf("invalid selector: %w", err)
+	}
+
+	return nil
 }
 
-// defaultKubeconfigPathFunc returns the path to the default kubeconfig file.
-// overridden in tests to point at a temp file.
-var defaultKubeconfigPathFunc = func() string {
-	return expandTilde("~/.kube/config")
+// labelPattern matches the egress labels of passthrough routes, which end
+// up in metric labels and log lines.
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+
+func (r PassthroughRouteConfig) validate() error {
+	if r.Match == "" {
+		return errors.New("match is required")
+	}
+
+	if _, err := path.Match(r.Match, ""); err != nil {
+		return fmt.Errorf("invalid match %q: %w", r.Match, err)
+	}
+
+	for _, p := range slices.Concat(r.Listeners, r.Users) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+
+	if r.ProxyProtocol != "" {
+		if _, err := proxyproto.ParseVersion(r.ProxyProtocol); err != nil {
+			return fmt.Errorf("proxyProtocol: %w", err)
+		}
+	}
+
+	if !labelPattern.MatchString(r.Label) {
+		return fmt.Errorf("label %q may only contain letters, digits, '.', '_' and '-'", r.Label)
+	}
+
+	return nil
 }
 
-// ResolvedCluster holds per-cluster settings derived from kubeconfig contexts.
-type ResolvedCluster struct {
-	Name       string
-	Kubeconfig string
-	Context    string
-	Namespace  string
+func (r RouteConfig) validate() error {
+	if r.Match == "" {
+		return errors.New("match is required")
+	}
+
+	if _, err := path.Match(r.Match, ""); err != nil {
+		return fmt.Errorf("invalid match %q: %w", r.Match, err)
+	}
+
+	if r.Protocol != "" && !slices.Contains(routeProtocols, r.Protocol) {
+		return fmt.Errorf("unknown protocol %q (expected one of %s)", r.Protocol, strings.Join(routeProtocols, ", "))
+	}
+
+	t := r.TLS
+	if !t.Enabled && (t.ServerName != "" || t.CertificateAuthority != "" || t.InsecureSkipVerify) {
+		return errors.New("tls settings require tls.enabled")
+	}
+
+	if t.Enabled && (r.Protocol == "http" || r.Protocol == "h2c") {
+		return fmt.Errorf("tls.enabled with protocol %s, which is plain text upstream; use https", r.Protocol)
+	}
+
+	if t.InsecureSkipVerify && t.CertificateAuthority != "" {
+		return errors.New("tls.insecureSkipVerify and tls.certificateAuthority are mutually exclusive")
+	}
+
+	// TCP keepalive timers count whole seconds.
+	if k := r.Keepalive.Client; k != 0 && k < time.Second {
+		return fmt.Errorf("keepalive.client %v must be at least 1s", k)
+	}
+
+	if k := r.Keepalive.Upstream; k != 0 && k < time.Second {
+		return fmt.Errorf("keepalive.upstream %v must be at least 1s", k)
+	}
+
+	if len(r.PairedPorts) == 1 {
+		return errors.New("pairedPorts needs at least two ports")
+	}
+
+	for i, port := range r.PairedPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("pairedPorts[%d] %d out of range 1-65535", i, port)
+		}
+
+		if slices.Contains(r.PairedPorts[:i], port) {
+			return fmt.Errorf("duplicate port %d in pairedPorts", port)
+		}
+	}
+
+	return nil
 }
 
-// LoadConfig reads a YAML config file and returns a validated Config
-// along with the resolved clusters derived from kubeconfig discovery.
-func LoadConfig(path string) (*Config, []ResolvedCluster, error) {
-	var cfg Config
+func (s ClusterSettings) validate() error {
+	if s.QPS < 0 {
+		return fmt.Errorf("qps %v must not be negative", s.QPS)
+	}
 
-	// apply embedded defaults first
-	if err := yaml.Unmarshal(DefaultConfigData, &cfg); err != nil {
-		return nil, nil, fmt.Errorf("parsing default config: %w", err)
+	if s.Burst < 0 {
+		return fmt.Errorf("burst %d must not be negative", s.Burst)
 	}
 
-	data, err := os.ReadFile(path)
-	if err != nil && !os.IsNotExist(err) {
-		return nil, nil, fmt.Errorf("reading config file: %w", err)
+	if s.DialTimeout < 0 {
+		return fmt.Errorf("dialTimeout %v must not be negative", s.DialTimeout)
 	}
 
-	if len(data) > 0 {
-		// overlay user config on top of defaults
-		if err := yaml.Unmarshal(data, &cfg); err != nil {
-			return nil, nil, fmt.Errorf("parsing config file: %w", err)
+	if ttl := Value(s.NegativeCacheTTL); ttl < 0 {
+		return fmt.Errorf("negativeCacheTTL %v must not be negative", ttl)
+	}
+
+	if idle := Value(s.MultiplexIdleTimeout); idle < 0 {
+		return fmt.Errorf("multiplexIdleTimeout %v must not be negative", idle)
+	}
+
+	if after := Value(s.UnhealthyAfter); after < 0 {
+		return fmt.Errorf("unhealthyAfter %d must not be negative", after)
+	}
+
+	if failures := Value(s.CircuitBreaker.Failures); failures < 0 {
+		return fmt.Errorf("circuitBreaker.failures %d must not be negative", failures)
+	}
+
+	if cooldown := Value(s.CircuitBreaker.Cooldown); cooldown < 0 {
+		return fmt.Errorf("circuitBreaker.cooldown %v must not be negative", cooldown)
+	}
+
+	if s.LoadBalancing != "" && !slices.Contains(loadBalancingPolicies, s.LoadBalancing) {
+		return fmt.Errorf("loadBalancing %q must be one of %s", s.LoadBalancing, strings.Join(loadBalancingPolicies, ", "))
+	}
+
+	if s.PortForwardTransport != "" && !slices.Contains(portForwardTransports, s.PortForwardTransport) {
+		return fmt.Errorf("portForwardTransport %q must be one of %s", s.PortForwardTransport, strings.Join(portForwardTransports, ", "))
+	}
+
+	for i, p := range s.PortForwardProtocols {
+		if !slices.Contains(portForwardProtocols, p) {
+			return fmt.Errorf("portForwardProtocols: %q must be one of %s", p, strings.Join(portForwardProtocols, ", "))
+		}
+
+		if slices.Contains(s.PortForwardProtocols[:i], p) {
+			return fmt.Errorf("portForwardProtocols: duplicate %q", p)
 		}
 	}
 
-	// set up the global logger early so resolve output uses the configured logger
-	if err := SetupGlobalLogger(&cfg); err != nil {
-		return nil, nil, fmt.Errorf("setting up logger: %w", err)
+	for _, code := range s.Retry.StatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("retry.statusCodes: %d is not an HTTP status code", code)
+		}
 	}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	for _, class := range s.Retry.Fatal {
+		if !slices.Contains(retryClasses, class) {
+			return fmt.Errorf("retry.fatal: unknown error class %q (must be one of %s)", class, strings.Join(retryClasses, ", "))
+		}
+	}
+
+	if err := s.Access.validate(); err != nil {
+		return err
+	}
+
+	for _, cidr := range s.PodCIDRs {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			return fmt.Errorf("podCIDRs: %w", err)
+		}
+	}
+
+	if s.Vault.TTL < 0 {
+		return fmt.Errorf("vault.ttl %v must not be negative", s.Vault.TTL)
+	}
+
+	if s.CertificateAuthority != "" && s.CertificateAuthorityData != "" {
+		return errors.New("certificateAuthority and certificateAuthorityData are mutually exclusive")
+	}
+
+	if Enabled(s.InsecureSkipTLSVerify) && (s.CertificateAuthority != "" || s.CertificateAuthorityData != "") {
+		return errors.New("insecureSkipTLSVerify cannot be combined with a certificate authority")
+	}
+
+	if err := validateProxyURL(s.ProxyURL); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateProxyURL checks the proxyURL of cluster settings.
+func validateProxyURL(proxyURL string) error {
+	if proxyURL == "" || proxyURL == "direct" {
+		return nil
 	}
 
-	clusters, err := resolveKubeconfigs(&cfg)
+	u, err := url.Parse(proxyURL)
 	if err != nil {
-		return nil, nil, fmt.Errorf("resolving kubeconfigs: %w", err)
+		return fmt.Errorf("invalid proxyURL: %w", err)
 	}
 
-	if err := ValidateClusters(clusters); err != nil {
-		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("proxyURL %q must be an http, https or socks5 URL, or direct", u.Redacted())
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("proxyURL %q has no host", u.Redacted())
 	}
 
-	return &cfg, clusters, nil
+	return nil
 }
 
-// Validate checks that the static config fields are well-formed.
-func (c *Config) Validate() error {
-	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
-		return fmt.Errorf("invalid listenAddress %q: %w", c.ListenAddress, err)
+// Enabled reports whether the optional boolean setting b is set to true.
+func Enabled(b *bool) bool {
+	return b != nil && *b
+}
+
+// Value returns the optional setting p, or the zero value when it is unset.
+func Value[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
 	}
 
-	if c.HTTPListenAddress != "" {
-		if _, _, err := net.SplitHostPort(c.HTTPListenAddress); err != nil {
-			return fmt.Errorf("invalid httpListenAddress %q: %w", c.HTTPListenAddress, err)
-		}
+	return *p
+}
+
+// merge returns s with every non-zero field of override applied on top. Unset
+// boolean settings are nil, so an explicit false still overrides.
+func (s ClusterSettings) merge(override ClusterSettings) ClusterSettings {
+	if override.QPS != 0 {
+		s.QPS = override.QPS
 	}
 
-	if c.PACListenAddress != "" {
-		if _, _, err := net.SplitHostPort(c.PACListenAddress); err != nil {
-			return fmt.Errorf("invalid pacListenAddress %q: %w", c.PACListenAddress, err)
+	if override.Burst != 0 {
+		s.Burst = override.Burst
+	}
+
+	if override.DialTimeout != 0 {
+		s.DialTimeout = override.DialTimeout
+	}
+
+	if override.NegativeCacheTTL != nil {
+		s.NegativeCacheTTL = override.NegativeCacheTTL
+	}
+
+	if override.MultiplexIdleTimeout != nil {
+		s.MultiplexIdleTimeout = override.MultiplexIdleTimeout
+	}
+
+	if override.UnhealthyAfter != nil {
+		s.UnhealthyAfter = override.UnhealthyAfter
+	}
+
+	if override.CircuitBreaker.Failures != nil {
+		s.CircuitBreaker.Failures = override.CircuitBreaker.Failures
+	}
+
+	if override.CircuitBreaker.Cooldown != nil {
+		s.CircuitBreaker.Cooldown = override.CircuitBreaker.Cooldown
+	}
+
+	if override.Retry.Errors != nil {
+		s.Retry.Errors = override.Retry.Errors
+	}
+
+	if override.Retry.StatusCodes != nil {
+		s.Retry.StatusCodes = override.Retry.StatusCodes
+	}
+
+	if override.Retry.Fatal != nil {
+		s.Retry.Fatal = override.Retry.Fatal
+	}
+
+	// a CA set at either level replaces the other form entirely.
+	if override.CertificateAuthority != "" || override.CertificateAuthorityData != "" {
+		s.CertificateAuthority = override.CertificateAuthority
+		s.CertificateAuthorityData = override.CertificateAuthorityData
+	}
+
+	if override.TLSServerName != "" {
+		s.TLSServerName = override.TLSServerName
+	}
+
+	if override.InsecureSkipTLSVerify != nil {
+		s.InsecureSkipTLSVerify = override.InsecureSkipTLSVerify
+	}
+
+	if override.ProxyURL != "" {
+		s.ProxyURL = override.ProxyURL
+	}
+
+	if override.Access.Windows != nil {
+		s.Access.Windows = override.Access.Windows
+	}
+
+	if override.Access.OnCall != nil {
+		s.Access.OnCall = override.Access.OnCall
+	}
+
+	if override.Access.Timezone != "" {
+		s.Access.Timezone = override.Access.Timezone
+	}
+
+	s.Vault = s.Vault.merge(override.Vault)
+
+	if override.Impersonate != nil {
+		s.Impersonate = override.Impersonate
+	}
+
+	if override.Preflight != nil {
+		s.Preflight = override.Preflight
+	}
+
+	if override.LoadBalancing != "" {
+		s.LoadBalancing = override.LoadBalancing
+	}
+
+	if override.PortForwardTransport != "" {
+		s.PortForwardTransport = override.PortForwardTransport
+	}
+
+	if override.PortForwardProtocols != nil {
+		s.PortForwardProtocols = override.PortForwardProtocols
+	}
+
+	if override.EndpointCache != nil {
+		s.EndpointCache = override.EndpointCache
+	}
+
+	s.InCluster = override.InCluster
+
+	if override.Namespace != "" {
+		s.Namespace = override.Namespace
+	}
+
+	if override.PodCIDRs != nil {
+		s.PodCIDRs = override.PodCIDRs
+	}
+
+	return s
+}
+
+// validatePodCIDRs checks that no two clusters claim overlapping pod
+// networks, so a bare pod IP names one cluster. The settings must be valid.
+func validatePodCIDRs(clusters map[string]ClusterSettings) error {
+	names := make([]string, 0, len(clusters))
+	for name := range clusters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	owners := map[netip.Prefix]string{}
+
+	for _, name := range names {
+		for _, cidr := range clusters[name].PodCIDRs {
+			prefix := netip.MustParsePrefix(cidr).Masked()
+
+			for other, owner := range owners {
+				if owner != name && other.Overlaps(prefix) {
+					return fmt.Errorf("invalid clusters.%s: podCIDRs %s overlaps %s of cluster %s", name, cidr, other, owner)
+				}
+			}
+
+			owners[prefix] = name
 		}
 	}
 
 	return nil
 }
 
+// merge returns v with every non-zero field of override applied on top.
+func (v VaultConfig) merge(override VaultConfig) VaultConfig {
+	if override.Role != "" {
+		v.Role = override.Role
+	}
+
+	if override.Address != "" {
+		v.Address = override.Address
+	}
+
+	if override.Mount != "" {
+		v.Mount = override.Mount
+	}
+
+	if override.KubernetesNamespace != "" {
+		v.KubernetesNamespace = override.KubernetesNamespace
+	}
+
+	if override.TTL != 0 {
+		v.TTL = override.TTL
+	}
+
+	if override.TokenFile != "" {
+		v.TokenFile = override.TokenFile
+	}
+
+	return v
+}
+
+// applyClusterSettings resolves the effective settings of every cluster from
+// the defaults and per-cluster overrides. Overrides for unknown clusters are
+// reported but otherwise ignored, since contexts come and go with kubeconfigs.
+func applyClusterSettings(cfg *Config, clusters []ResolvedCluster) {
+	known := make(map[string]bool, len(clusters))
+
+	for i := range clusters {
+		known[clusters[i].Name] = true
+		clusters[i].Settings = cfg.ClusterDefaults.merge(cfg.Clusters[clusters[i].Name])
+
+		if ns := clusters[i].Settings.Namespace; ns != "" {
+			clusters[i].Namespace = ns
+		}
+	}
+
+	for name := range cfg.Clusters {
+		if !known[name] {
+			slog.Warn("settings configured for unknown cluster", "cluster", name)
+		}
+	}
+}
+
 // ValidateClusters checks that the resolved clusters are well-formed.
 func ValidateClusters(clusters []ResolvedCluster) error {
 	if len(clusters) == 0 {
@@ -147,6 +2049,8 @@ func ValidateClusters(clusters []ResolvedCluster) error {
 //  1. default kubeconfig (~/.kube/config) — unless SkipDefaultKubeconfig is set
 //  2. KUBECONFIG environment variable — unless SkipKubeconfigEnv is set
 //  3. explicit paths and globs from the Kubeconfigs config field
+//
+// Clusters declared with inCluster: true are appended after them.
 func resolveKubeconfigs(cfg *Config) ([]ResolvedCluster, error) {
 	seen := make(map[string]bool) // tracks files already loaded for deduplication
 
@@ -179,7 +2083,7 @@ func resolveKubeconfigs(cfg *Config) ([]ResolvedCluster, error) {
 		} else {
 			paths := strings.SplitSeq(kubeconfigEnv, string(os.PathListSeparator))
 			for p := range paths {
-				p = expandTilde(strings.TrimSpace(p))
+				p = ExpandTilde(strings.TrimSpace(p))
 				if p == "" {
 					continue
 				}
@@ -196,7 +2100,7 @@ func resolveKubeconfigs(cfg *Config) ([]ResolvedCluster, error) {
 
 	// phase 3: explicit paths and globs from config
 	for _, pattern := range cfg.Kubeconfigs {
-		pattern = expandTilde(pattern)
+		pattern = ExpandTilde(pattern)
 		isGlob := strings.ContainsAny(pattern, "*?[")
 
 		paths, err := expandGlobPattern(pattern)
@@ -219,6 +2123,16 @@ func resolveKubeconfigs(cfg *Config) ([]ResolvedCluster, error) {
 		}
 	}
 
+	// phase 4: clusters of the active Teleport profile
+	resolved, err := resolveTeleport(cfg, seen)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters = append(clusters, resolved...)
+
+	clusters = append(clusters, resolveInCluster(cfg)...)
+
 	if len(clusters) == 0 {
 		slog.Warn("no kubeconfig files matched any configured patterns")
 	}
@@ -226,6 +2140,51 @@ func resolveKubeconfigs(cfg *Config) ([]ResolvedCluster, error) {
 	return clusters, nil
 }
 
+// resolveInCluster returns the clusters declared with inCluster: true. Names
+// that clash with a kubeconfig context are rejected by ValidateClusters.
+func resolveInCluster(cfg *Config) []ResolvedCluster {
+	var clusters []ResolvedCluster
+
+	for name, cs := range cfg.Clusters {
+		if !cs.InCluster {
+			continue
+		}
+
+		ns := cs.Namespace
+		if ns == "" {
+			ns = podNamespace()
+		}
+
+		clusters = append(clusters, ResolvedCluster{
+			Name:      name,
+			Namespace: ns,
+			Source:    "inCluster",
+			InCluster: true,
+		})
+
+		slog.Info("found in-cluster entry", "cluster", name, "namespace", ns)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+
+	return clusters
+}
+
+// podNamespace returns the namespace of the pod podproxy runs in, or
+// "default" outside a pod.
+func podNamespace() string {
+	data, err := os.ReadFile(inClusterNamespaceFile)
+	if err != nil {
+		return "default"
+	}
+
+	if ns := strings.TrimSpace(string(data)); ns != "" {
+		return ns
+	}
+
+	return "default"
+}
+
 // loadKubeconfigFile loads a single kubeconfig file and returns the resolved
 // clusters from its contexts. Already-seen files are skipped entirely.
 func loadKubeconfigFile(path, source string, seenFiles map[string]bool) ([]ResolvedCluster, error) {
@@ -257,6 +2216,7 @@ func loadKubeconfigFile(path, source string, seenFiles map[string]bool) ([]Resol
 			Kubeconfig: path,
 			Context:    name,
 			Namespace:  ns,
+			Source:     source,
 		})
 
 		contextNames = append(contextNames, name)
@@ -278,12 +2238,29 @@ func expandGlobPattern(pattern string) ([]string, error) {
 		return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
 	}
 
-	sort.Strings(matches)
+	// skip directories and hidden entries, so a glob over a mounted Kubernetes
+	// Secret or ConfigMap doesn't pick up its ..data bookkeeping entries.
+	files := matches[:0]
+
+	for _, m := range matches {
+		if strings.HasPrefix(filepath.Base(m), ".") {
+			continue
+		}
+
+		if info, err := os.Stat(m); err == nil && info.IsDir() {
+			continue
+		}
+
+		files = append(files, m)
+	}
+
+	sort.Strings(files)
 
-	return matches, nil
+	return files, nil
 }
 
-func expandTilde(path string) string {
+// ExpandTilde replaces a leading "~" with the user's home directory.
+func ExpandTilde(path string) string {
 	if !strings.HasPrefix(path, "~") {
 		return path
 	}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // writeKubeconfig creates a minimal kubeconfig file with the given context→namespace mappings.
@@ -112,6 +113,10 @@ kubeconfigs:
 			if rc.Kubeconfig != kc1 {
 				t.Errorf("production.Kubeconfig = %q, want %q", rc.Kubeconfig, kc1)
 			}
+
+			if rc.Source != "config" {
+				t.Errorf("production.Source = %q, want %q", rc.Source, "config")
+			}
 		}
 	}
 
@@ -317,9 +322,9 @@ func TestExpandTilde(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got := expandTilde(tt.input)
+		got := ExpandTilde(tt.input)
 		if got != tt.want {
-			t.Errorf("expandTilde(%q) = %q, want %q", tt.input, got, tt.want)
+			t.Errorf("ExpandTilde(%q) = %q, want %q", tt.input, got, tt.want)
 		}
 	}
 }
@@ -371,6 +376,38 @@ func TestExpandGlobPattern(t *testing.T) {
 	}
 }
 
+func TestExpandGlobPatternMountedSecret(t *testing.T) {
+	dir := t.TempDir()
+
+	// layout of a Secret volume: data lives in a timestamped directory,
+	// linked through ..data.
+	dataDir := filepath.Join(dir, "..2026_01_02_03_04_05.000000001")
+	if err := os.Mkdir(dataDir, 0o700); err != nil {
+		t.Fatalf("creating data dir: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dataDir, "production"), []byte(""), 0o600); err != nil {
+		t.Fatalf("creating file: %v", err)
+	}
+
+	if err := os.Symlink(filepath.Base(dataDir), filepath.Join(dir, "..data")); err != nil {
+		t.Fatalf("creating ..data link: %v", err)
+	}
+
+	if err := os.Symlink(filepath.Join("..data", "production"), filepath.Join(dir, "production")); err != nil {
+		t.Fatalf("creating key link: %v", err)
+	}
+
+	matches, err := expandGlobPattern(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("expandGlobPattern() error: %v", err)
+	}
+
+	if len(matches) != 1 || filepath.Base(matches[0]) != testClusterProduction {
+		t.Errorf("matches = %v, want only the production key", matches)
+	}
+}
+
 func TestResolveGlobPattern(t *testing.T) {
 	isolateKubeconfigDiscovery(t)
 	dir := t.TempDir()
@@ -650,6 +687,731 @@ func TestResolveDeduplication(t *testing.T) {
 	}
 }
 
+func TestLoadConfigClusterSettings(t *testing.T) {
+	isolateKubeconfigDiscovery(t)
+	dir := t.TempDir()
+	kc := writeKubeconfig(t, dir, "test.yaml", map[string]string{
+		testClusterProduction: "",
+		"staging":             "",
+	})
+
+	configContent := fmt.Sprintf(`
+kubeconfigs:
+  - %q
+serviceDiscovery:
+  enabled: true
+clusterDefaults:
+  qps: 20
+  burst: 40
+  retry:
+    errors: ["stream error"]
+  insecureSkipTLSVerify: true
+  access:
+    onCall: true
+  impersonate: true
+  preflight: true
+  endpointCache: true
+clusters:
+  production:
+    qps: 100
+    insecureSkipTLSVerify: false
+    access:
+      onCall: false
+    impersonate: false
+    preflight: false
+    endpointCache: false
+    retry:
+      fatal: [connectionRefused]
+    vault:
+      role: production-viewer
+`, kc)
+
+	_, clusters, err := LoadConfig(writeTempConfig(t, configContent))
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+
+	for _, rc := range clusters {
+		wantQPS, wantFatal, wantRole := float32(20), 0, ""
+		if rc.Name == testClusterProduction {
+			wantQPS, wantFatal, wantRole = 100, 1, "production-viewer"
+		}
+
+		// production turns off the boolean defaults.
+		wantDefault := rc.Name != testClusterProduction
+
+		if rc.Settings.QPS != wantQPS {
+			t.Errorf("%s.Settings.QPS = %v, want %v", rc.Name, rc.Settings.QPS, wantQPS)
+		}
+
+		if rc.Settings.Burst != 40 {
+			t.Errorf("%s.Settings.Burst = %d, want 40", rc.Name, rc.Settings.Burst)
+		}
+
+		if got := rc.Settings.Retry.Errors; len(got) != 1 || got[0] != "stream error" {
+			t.Errorf("%s.Settings.Retry.Errors = %v, want [stream error]", rc.Name, got)
+		}
+
+		if got := rc.Settings.Retry.Fatal; len(got) != wantFatal {
+			t.Errorf("%s.Settings.Retry.Fatal = %v, want %d classes", rc.Name, got, wantFatal)
+		}
+
+		if v := rc.Settings.Vault; v.Role != wantRole || v.Mount != "kubernetes" {
+			t.Errorf("%s.Settings.Vault = %+v, want role %q on the default mount", rc.Name, v, wantRole)
+		}
+
+		if got := Enabled(rc.Settings.InsecureSkipTLSVerify); got != wantDefault {
+			t.Errorf("%s.Settings.InsecureSkipTLSVerify = %v, want %v", rc.Name, got, wantDefault)
+		}
+
+		if got := rc.Settings.Access.Restricted(); got != wantDefault {
+			t.Errorf("%s.Settings.Access.Restricted() = %v, want %v", rc.Name, got, wantDefault)
+		}
+
+		if got := Enabled(rc.Settings.Impersonate); got != wantDefault {
+			t.Errorf("%s.Settings.Impersonate = %v, want %v", rc.Name, got, wantDefault)
+		}
+
+		if got := Enabled(rc.Settings.Preflight); got != wantDefault {
+			t.Errorf("%s.Settings.Preflight = %v, want %v", rc.Name, got, wantDefault)
+		}
+
+		if got := Enabled(rc.Settings.EndpointCache); got != wantDefault {
+			t.Errorf("%s.Settings.EndpointCache = %v, want %v", rc.Name, got, wantDefault)
+		}
+	}
+}
+
+// TestLoadConfigClusterSettingsZero checks that a cluster can set numeric
+// settings of clusterDefaults back to zero.
+func TestLoadConfigClusterSettingsZero(t *testing.T) {
+	isolateKubeconfigDiscovery(t)
+	dir := t.TempDir()
+	kc := writeKubeconfig(t, dir, "test.yaml", map[string]string{
+		testClusterProduction: "",
+		"staging":             "",
+	})
+
+	configContent := fmt.Sprintf(`
+kubeconfigs:
+  - %q
+clusterDefaults:
+  circuitBreaker:
+    failures: 3
+  multiplexIdleTimeout: 1m
+clusters:
+  production:
+    circuitBreaker:
+      failures: 0
+    multiplexIdleTimeout: 0s
+    negativeCacheTTL: 0s
+    unhealthyAfter: 0
+`, kc)
+
+	_, clusters, err := LoadConfig(writeTempConfig(t, configContent))
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+
+	for _, rc := range clusters {
+		wantFailures, wantIdle, wantTTL, wantUnhealthy := 3, time.Minute, 10*time.Second, 5
+		if rc.Name == testClusterProduction {
+			wantFailures, wantIdle, wantTTL, wantUnhealthy = 0, 0, 0, 0
+		}
+
+		if got := Value(rc.Settings.CircuitBreaker.Failures); got != wantFailures {
+			t.Errorf("%s.Settings.CircuitBreaker.Failures = %d, want %d", rc.Name, got, wantFailures)
+		}
+
+		if got := Value(rc.Settings.CircuitBreaker.Cooldown); got != 30*time.Second {
+			t.Errorf("%s.Settings.CircuitBreaker.Cooldown = %v, want the default 30s", rc.Name, got)
+		}
+
+		if got := Value(rc.Settings.MultiplexIdleTimeout); got != wantIdle {
+			t.Errorf("%s.Settings.MultiplexIdleTimeout = %v, want %v", rc.Name, got, wantIdle)
+		}
+
+		if got := Value(rc.Settings.NegativeCacheTTL); got != wantTTL {
+			t.Errorf("%s.Settings.NegativeCacheTTL = %v, want %v", rc.Name, got, wantTTL)
+		}
+
+		if got := Value(rc.Settings.UnhealthyAfter); got != wantUnhealthy {
+			t.Errorf("%s.Settings.UnhealthyAfter = %d, want %d", rc.Name, got, wantUnhealthy)
+		}
+	}
+}
+
+func TestResolveInCluster(t *testing.T) {
+	isolateKubeconfigDiscovery(t)
+	dir := t.TempDir()
+	kc := writeKubeconfig(t, dir, "test.yaml", map[string]string{testClusterProduction: "apps"})
+
+	nsFile := filepath.Join(dir, "namespace")
+	if err := os.WriteFile(nsFile, []byte("gateway\n"), 0o600); err != nil {
+		t.Fatalf("writing namespace file: %v", err)
+	}
+
+	orig := inClusterNamespaceFile
+
+	t.Cleanup(func() { inClusterNamespaceFile = orig })
+
+	inClusterNamespaceFile = nsFile
+
+	configContent := fmt.Sprintf(`
+kubeconfigs:
+  - %q
+clusters:
+  local:
+    inCluster: true
+  tools:
+    inCluster: true
+    namespace: tooling
+  production:
+    namespace: web
+`, kc)
+
+	_, clusters, err := LoadConfig(writeTempConfig(t, configContent))
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+
+	want := map[string]struct {
+		namespace string
+		inCluster bool
+	}{
+		"local":               {"gateway", true},
+		"tools":               {"tooling", true},
+		testClusterProduction: {"web", false},
+	}
+
+	if len(clusters) != len(want) {
+		t.Fatalf("len(clusters) = %d, want %d", len(clusters), len(want))
+	}
+
+	for _, rc := range clusters {
+		w, ok := want[rc.Name]
+		if !ok {
+			t.Errorf("unexpected cluster %q", rc.Name)
+			continue
+		}
+
+		if rc.Namespace != w.namespace || rc.InCluster != w.inCluster {
+			t.Errorf("%s: namespace/inCluster = %q/%v, want %q/%v", rc.Name, rc.Namespace, rc.InCluster, w.namespace, w.inCluster)
+		}
+	}
+}
+
+func TestResolveInClusterNameClash(t *testing.T) {
+	isolateKubeconfigDiscovery(t)
+	kc := writeKubeconfig(t, t.TempDir(), "test.yaml", map[string]string{testClusterProduction: ""})
+
+	configContent := fmt.Sprintf(`
+kubeconfigs:
+  - %q
+clusters:
+  production:
+    inCluster: true
+`, kc)
+
+	if _, _, err := LoadConfig(writeTempConfig(t, configContent)); err == nil {
+		t.Error("expected duplicate cluster name error")
+	}
+}
+
+func TestLoadConfigListenerUnknownCluster(t *testing.T) {
+	isolateKubeconfigDiscovery(t)
+	kc := writeKubeconfig(t, t.TempDir(), "test.yaml", map[string]string{testClusterProduction: ""})
+
+	configContent := fmt.Sprintf(`
+kubeconfigs:
+  - %q
+listeners:
+  - address: "127.0.0.1:1081"
+    cluster: production
+  - address: "127.0.0.1:1082"
+    cluster: staging
+`, kc)
+
+	_, _, err := LoadConfig(writeTempConfig(t, configContent))
+	if err == nil || !strings.Contains(err.Error(), "staging") {
+		t.Errorf("LoadConfig() error = %v, want unknown cluster staging", err)
+	}
+}
+
+func TestLoadConfigIngressUnknownCluster(t *testing.T) {
+	isolateKubeconfigDiscovery(t)
+	kc := writeKubeconfig(t, t.TempDir(), "test.yaml", map[string]string{testClusterProduction: ""})
+
+	configContent := fmt.Sprintf(`
+kubeconfigs:
+  - %q
+ingressRouting:
+  enabled: true
+  clusters: [production, staging]
+`, kc)
+
+	_, _, err := LoadConfig(writeTempConfig(t, configContent))
+	if err == nil || !strings.Contains(err.Error(), "staging") {
+		t.Errorf("LoadConfig() error = %v, want unknown cluster staging", err)
+	}
+}
+
+func TestValidateClusterSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{
+			name: "negative default qps",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{QPS: -1}},
+		},
+		{
+			name: "negative cluster dial timeout",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"a": {DialTimeout: -time.Second}}},
+		},
+		{
+			name: "negative cluster burst",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"a": {Burst: -1}}},
+		},
+		{
+			name: "invalid retry status code",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{Retry: RetryConfig{StatusCodes: []int{5030}}}},
+		},
+		{
+			name: "unknown fatal retry class",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"a": {Retry: RetryConfig{Fatal: []string{"reset"}}}}},
+		},
+		{
+			name: "access window with unknown day",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"a": {Access: AccessConfig{
+				Windows: []AccessWindowConfig{{Days: []string{"monday"}, From: "09:00", To: "18:00"}},
+			}}}},
+		},
+		{
+			name: "access window with invalid time",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{Access: AccessConfig{
+				Windows: []AccessWindowConfig{{From: "9am", To: "18:00"}},
+			}}},
+		},
+		{
+			name: "unknown access timezone",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"a": {Access: AccessConfig{OnCall: new(true), Timezone: "Mars/Olympus"}}}},
+		},
+		{
+			name: "negative vault ttl",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"a": {Vault: VaultConfig{Role: "dev", TTL: -time.Minute}}}},
+		},
+		{
+			name: "both certificate authority forms",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{
+				CertificateAuthority: "/etc/ca.pem", CertificateAuthorityData: "pem",
+			}},
+		},
+		{
+			name: "insecure with certificate authority",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"a": {
+				CertificateAuthority: "/etc/ca.pem", InsecureSkipTLSVerify: new(true),
+			}}},
+		},
+		{
+			name: "proxy URL with unsupported scheme",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"a": {ProxyURL: "ftp://proxy.corp:21"}}},
+		},
+		{
+			name: "proxy URL without host",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{ProxyURL: "http://"}},
+		},
+		{
+			name: "auth user without password",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Auth: AuthConfig{Users: []AuthUserConfig{{Username: "alice"}}}},
+		},
+		{
+			name: "duplicate auth user",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Auth: AuthConfig{Users: []AuthUserConfig{
+				{Username: "alice", Password: "a"}, {Username: "alice", Password: "b"},
+			}}},
+		},
+		{
+			name: "ldap with static users",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Auth: AuthConfig{
+				Users: []AuthUserConfig{{Username: "alice", Password: "a"}},
+				LDAP:  LDAPConfig{URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com", UserAttribute: "uid", GroupAttribute: "memberOf"},
+			}},
+		},
+		{
+			name: "ldap with unsupported scheme",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Auth: AuthConfig{
+				LDAP: LDAPConfig{URL: "https://ldap.example.com", BaseDN: "dc=example,dc=com", UserAttribute: "uid", GroupAttribute: "memberOf"},
+			}},
+		},
+		{
+			name: "ldap plaintext with ldaps",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Auth: AuthConfig{
+				LDAP: LDAPConfig{URL: "ldaps://ldap.example.com", InsecurePlaintext: true, BaseDN: "dc=example,dc=com", UserAttribute: "uid", GroupAttribute: "memberOf"},
+			}},
+		},
+		{
+			name: "ldap without base DN",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Auth: AuthConfig{
+				LDAP: LDAPConfig{URL: "ldaps://ldap.example.com", UserAttribute: "uid", GroupAttribute: "memberOf"},
+			}},
+		},
+		{
+			name: "htpasswd with oidc",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Auth: AuthConfig{
+				Htpasswd: HtpasswdConfig{File: "/etc/podproxy/htpasswd"},
+				OIDC:     OIDCConfig{Issuer: "https://sso.example.com", ClientID: "podproxy", UsernameClaim: "email"},
+			}},
+		},
+		{
+			name: "oidc without client ID",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Auth: AuthConfig{
+				OIDC: OIDCConfig{Issuer: "https://sso.example.com", UsernameClaim: "email"},
+			}},
+		},
+		{
+			name: "user namespaces without auth",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Auth: AuthConfig{Namespaces: map[string]string{"alice": "team-a"}}},
+		},
+		{
+			name: "empty user namespace",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Auth: AuthConfig{
+				Users:      []AuthUserConfig{{Username: "alice", Password: "s3cret"}},
+				Namespaces: map[string]string{"alice": ""},
+			}},
+		},
+		{
+			name: "pushgateway without interval",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Metrics: MetricsConfig{
+				Pushgateway: PushgatewayConfig{URL: "http://gateway:9091", Job: "podproxy"},
+			}},
+		},
+		{
+			name: "shared rate limit without burst",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", SharedRateLimit: RateLimitConfig{QPS: 10}},
+		},
+		{
+			name: "admin user without password",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Admin: AdminConfig{Users: []AdminUserConfig{{Username: "ops"}}}},
+		},
+		{
+			name: "admin user with unknown role",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Admin: AdminConfig{Users: []AdminUserConfig{{Username: "support", Password: "s3cret", Role: "viewer"}}}},
+		},
+		{
+			name: "admin on the socks port",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", AdminListenAddress: "127.0.0.1:1080"},
+		},
+		{
+			name: "admin on a wildcard address sharing the pac port",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", PACListenAddress: "127.0.0.1:8081", AdminListenAddress: ":8081"},
+		},
+		{
+			name: "negative http transport idle timeout",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", HTTPTransport: HTTPTransportConfig{IdleConnTimeout: -time.Second}},
+		},
+		{
+			name: "negative drain timeout",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", DrainTimeout: -time.Second},
+		},
+		{
+			name: "client keepalive without count",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClientKeepAlive: KeepAliveConfig{Enabled: true, Idle: time.Minute, Interval: 15 * time.Second}},
+		},
+		{
+			name: "leak reaper without idle",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", LeakReaper: LeakReaperConfig{Enabled: true}},
+		},
+		{
+			name: "health check without interval",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", HealthCheck: HealthCheckConfig{Enabled: true}},
+		},
+		{
+			name: "prewarm without service",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Prewarm: []PrewarmConfig{{Cluster: "production", Namespace: "db"}}},
+		},
+		{
+			name: "unknown load balancing",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"production": {LoadBalancing: "leastLoaded"}}},
+		},
+		{
+			name: "negative multiplex idle timeout",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{MultiplexIdleTimeout: new(-time.Second)}},
+		},
+		{
+			name: "forward target without port",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Forwards: []ForwardConfig{{Address: "127.0.0.1:5432", Target: "postgres.db.production"}}},
+		},
+		{
+			name: "forward on the proxy port",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Forwards: []ForwardConfig{{Address: "0.0.0.0:1080", Target: "postgres.db.production:5432"}}},
+		},
+		{
+			name: "negative circuit breaker cooldown",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"production": {CircuitBreaker: CircuitBreakerConfig{Failures: new(3), Cooldown: new(-time.Second)}}}},
+		},
+		{
+			name: "localhost routing without port",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", LocalhostRouting: LocalhostRoutingConfig{Enabled: true}},
+		},
+		{
+			name: "localhost routing with auth",
+			cfg: Config{
+				ListenAddress:    "127.0.0.1:1080",
+				Auth:             AuthConfig{Users: []AuthUserConfig{{Username: "alice", Password: "a"}}},
+				LocalhostRouting: LocalhostRoutingConfig{Enabled: true, Port: 80},
+			},
+		},
+		{
+			name: "negative unhealthy after",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"production": {UnhealthyAfter: new(-1)}}},
+		},
+		{
+			name: "unknown port-forward transport",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{PortForwardTransport: "http2"}},
+		},
+		{
+			name: "unknown port-forward protocol",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"production": {PortForwardProtocols: []string{"websocket/v5"}}}},
+		},
+		{
+			name: "duplicate port-forward protocol",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{PortForwardProtocols: []string{"spdy/v1", "spdy/v1"}}},
+		},
+		{
+			name: "preflight without service discovery",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{Preflight: new(true)}},
+		},
+		{
+			name: "client rate limit without burst",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClientRateLimit: RateLimitConfig{QPS: 5}},
+		},
+		{
+			name: "unknown connection limit policy",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ConnectionLimit: ConnectionLimitConfig{Max: 100, Policy: "drop", QueueTimeout: time.Second}},
+		},
+		{
+			name: "connection limit queue without timeout",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ConnectionLimit: ConnectionLimitConfig{Max: 100, Policy: "queue"}},
+		},
+		{
+			name: "invalid fake IP range",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", FakeIP: FakeIPConfig{Enabled: true, Range: "198.18.0.0"}},
+		},
+		{
+			name: "negative fake IP ttl",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", FakeIP: FakeIPConfig{TTL: -time.Second}},
+		},
+		{
+			name: "state file shared with history",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", History: HistoryConfig{File: "/tmp/podproxy.db", Retention: time.Hour}, State: StateConfig{File: "/tmp/podproxy.db"}},
+		},
+		{
+			name: "negative session affinity timeout",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", SessionAffinity: SessionAffinityConfig{Enabled: true, Timeout: -time.Minute}},
+		},
+		{
+			name: "negative log buffer",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Log: LogConfig{Buffer: -1}},
+		},
+		{
+			name: "invalid log trace pattern",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Log: LogConfig{Trace: []string{"postgres.[.prod"}}},
+		},
+		{
+			name: "zero ingress refresh interval",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", IngressRouting: IngressRoutingConfig{Enabled: true}},
+		},
+		{
+			name: "invalid ingress service selector",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", IngressRouting: IngressRoutingConfig{ServiceSelector: "a in (b"}},
+		},
+		{
+			name: "http cache without size",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", HTTPCache: HTTPCacheConfig{Enabled: true, MaxEntrySizeKB: 1024}},
+		},
+		{
+			name: "passthrough route without match",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", PassthroughRoutes: []PassthroughRouteConfig{{ProxyProtocol: "v1"}}},
+		},
+		{
+			name: "passthrough route with unknown proxy protocol",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", PassthroughRoutes: []PassthroughRouteConfig{{Match: "*.internal", ProxyProtocol: "v3"}}},
+		},
+		{
+			name: "passthrough route with invalid user pattern",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", PassthroughRoutes: []PassthroughRouteConfig{{Match: "*", Users: []string{"[alice"}}}},
+		},
+		{
+			name: "passthrough route with invalid label",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", PassthroughRoutes: []PassthroughRouteConfig{{Match: "*", Label: "the internet"}}},
+		},
+		{
+			name: "route with unknown protocol",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Routes: []RouteConfig{{Match: "*.production", Protocol: "grpc"}}},
+		},
+		{
+			name: "route with negative client keepalive",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Routes: []RouteConfig{{Match: "*.production", Keepalive: RouteKeepaliveConfig{Client: -time.Second}}}},
+		},
+		{
+			name: "route with sub-second upstream keepalive",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Routes: []RouteConfig{{Match: "*.production", Keepalive: RouteKeepaliveConfig{Upstream: 500 * time.Millisecond}}}},
+		},
+		{
+			name: "route originating tls to a plain text protocol",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Routes: []RouteConfig{{Match: "*.production", Protocol: "h2c", TLS: RouteTLSConfig{Enabled: true}}}},
+		},
+		{
+			name: "route tls settings without tls",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Routes: []RouteConfig{{Match: "*.production", Protocol: "https", TLS: RouteTLSConfig{ServerName: "api.example.com"}}}},
+		},
+		{
+			name: "host rewrite without host",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", HostRewrites: []HostRewriteConfig{{Match: "*.production"}}},
+		},
+		{
+			name: "host rewrite with unknown placeholder",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", HostRewrites: []HostRewriteConfig{{Match: "*.production", Host: "{svc}.svc.cluster.local"}}},
+		},
+		{
+			name: "invalid pod CIDR",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{"a": {PodCIDRs: []string{"10.244.0.0/33"}}}},
+		},
+		{
+			name: "overlapping pod CIDRs",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Clusters: map[string]ClusterSettings{
+				"a": {PodCIDRs: []string{"10.244.0.0/16"}},
+				"b": {PodCIDRs: []string{"10.244.8.0/24"}},
+			}},
+		},
+		{
+			name: "pod CIDRs in cluster defaults",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{PodCIDRs: []string{"10.244.0.0/16"}}},
+		},
+		{
+			name: "single paired port",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Routes: []RouteConfig{{Match: "debug.*", PairedPorts: []int{5005}}}},
+		},
+		{
+			name: "duplicate paired port",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Routes: []RouteConfig{{Match: "debug.*", PairedPorts: []int{5005, 5006, 5005}}}},
+		},
+		{
+			name: "selector target with port",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", SelectorTargets: []SelectorTargetConfig{{Host: "debug-api.production:8080", Selector: "app=api"}}},
+		},
+		{
+			name: "selector target with invalid selector",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", SelectorTargets: []SelectorTargetConfig{{Host: "debug-api.production", Selector: "app in (api"}}},
+		},
+		{
+			name: "duplicate selector target",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", SelectorTargets: []SelectorTargetConfig{
+				{Host: "debug-api.production", Selector: "app=api"},
+				{Host: "Debug-API.production", Selector: "app=api,track=canary"},
+			}},
+		},
+		{
+			name: "docker bridge host name",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", DockerBridge: DockerBridgeConfig{Enabled: true, Address: "docker0"}},
+		},
+		{
+			name: "pac companion without pac listener",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", PACCompanion: true},
+		},
+		{
+			name: "pac system proxy without pac listener",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", SystemProxy: SystemProxyConfig{Enabled: true, Mode: "pac"}},
+		},
+		{
+			name: "unknown system proxy mode",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", SystemProxy: SystemProxyConfig{Enabled: true, Mode: "auto"}},
+		},
+		{
+			name: "no proxy entry with a comma",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", NoProxy: []string{"npmjs.org,github.com"}},
+		},
+		{
+			name: "invalid no proxy cidr",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", NoProxy: []string{"10.0.0.0/33"}},
+		},
+		{
+			name: "unknown notification event",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Notifications: NotificationsConfig{Events: []string{"podRestarted"}}},
+		},
+		{
+			name: "invalid notification connections pattern",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Notifications: NotificationsConfig{Connections: []string{"[prod"}}},
+		},
+		{
+			name: "listener with unknown protocol",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Listeners: []ListenerConfig{{Address: "127.0.0.1:1081", Protocol: "https"}}},
+		},
+		{
+			name: "sni suffix on a socks5 listener",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Listeners: []ListenerConfig{{Address: "127.0.0.1:1081", SNISuffix: "podproxy"}}},
+		},
+		{
+			name: "sni listener with auth",
+			cfg: Config{
+				ListenAddress: "127.0.0.1:1080",
+				Auth:          AuthConfig{Users: []AuthUserConfig{{Username: "alice", Password: "a"}}},
+				Listeners:     []ListenerConfig{{Address: "127.0.0.1:8443", Protocol: "sni"}},
+			},
+		},
+		{
+			name: "listener with cluster and clusters",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Listeners: []ListenerConfig{
+				{Address: "127.0.0.1:1081", Cluster: "production", Clusters: []string{"staging"}},
+			}},
+		},
+		{
+			name: "unpinned listener with namespace",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Listeners: []ListenerConfig{{Address: "127.0.0.1:1081", Namespace: "db"}}},
+		},
+		{
+			name: "listener with invalid namespace pattern",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Listeners: []ListenerConfig{{Address: "127.0.0.1:1081", Namespaces: []string{"team-["}}}},
+		},
+		{
+			name: "listener on the socks port",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", Listeners: []ListenerConfig{{Address: ":1080", Cluster: "production"}}},
+		},
+		{
+			name: "listeners sharing a port",
+			cfg: Config{ListenAddress: "127.0.0.1:1080", Listeners: []ListenerConfig{
+				{Address: "127.0.0.1:1081", Cluster: "production"},
+				{Address: "127.0.0.1:1081", Cluster: "staging"},
+			}},
+		},
+		{
+			name: "in-cluster default",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClusterDefaults: ClusterSettings{InCluster: true}},
+		},
+		{
+			name: "negative client init concurrency",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClientInit: ClientInitConfig{Concurrency: -1}},
+		},
+		{
+			name: "negative client init timeout",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", ClientInit: ClientInitConfig{Timeout: -time.Second}},
+		},
+		{
+			name: "negative startup probe timeout",
+			cfg:  Config{ListenAddress: "127.0.0.1:1080", StartupProbe: StartupProbeConfig{Timeout: -time.Second}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
 func writeTempConfig(t *testing.T, content string) string {
 	t.Helper()
 
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// forwardManifest is a YAML or JSON file of port-forwards as kept by team
+// tooling around kubectl port-forward, e.g.
+//
+//	forwards:
+//	  - context: production
+//	    namespace: db
+//	    resource: svc/postgres
+//	    ports: ["5432", "15432:5433"]
+//	    protocol: tcp
+type forwardManifest struct {
+	Forwards []manifestForward `yaml:"forwards"`
+}
+
+// manifestForward is a kubectl port-forward invocation:
+// kubectl --context CONTEXT -n NAMESPACE port-forward --address ADDRESS
+// RESOURCE PORTS...
+type manifestForward struct {
+	// Context is the kubeconfig context, which names the podproxy cluster.
+	Context string `yaml:"context"`
+	// Namespace defaults to the cluster's default namespace.
+	Namespace string `yaml:"namespace"`
+	// Resource is TYPE/NAME of a Service, Deployment or StatefulSet.
+	Resource string `yaml:"resource"`
+	// Ports are [LOCAL:]REMOTE port pairs.
+	Ports []string `yaml:"ports"`
+	// Address is the local address listened on, 127.0.0.1 by default.
+	Address string `yaml:"address"`
+	// Protocol, if set, declares the upstream protocol with a route.
+	Protocol string `yaml:"protocol"`
+}
+
+// manifestResources maps the resource types of kubectl port-forward to the
+// form of the address podproxy dials. Pods have no address of their own
+// outside a headless Service.
+var manifestResources = map[string]string{
+	"svc":         "",
+	"service":     "",
+	"services":    "",
+	"deploy":      "deployment/",
+	"deployment":  "deployment/",
+	"deployments": "deployment/",
+	"sts":         "statefulset/",
+	"statefulset": "statefulset/",
+}
+
+// importForwardManifest reads the forward manifest at path and returns its
+// forwards and the routes declaring their protocols.
+func importForwardManifest(path string) ([]ForwardConfig, []RouteConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// JSON is YAML, so both parse the same.
+	var manifest forwardManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("parsing: %w", err)
+	}
+
+	var (
+		forwards []ForwardConfig
+		routes   []RouteConfig
+	)
+
+	for i, mf := range manifest.Forwards {
+		host, err := mf.host()
+		if err != nil {
+			return nil, nil, fmt.Errorf("forwards[%d]: %w", i, err)
+		}
+
+		if len(mf.Ports) == 0 {
+			return nil, nil, fmt.Errorf("forwards[%d]: ports are required", i)
+		}
+
+		address := mf.Address
+		if address == "" {
+			address = "127.0.0.1"
+		}
+
+		for _, spec := range mf.Ports {
+			local, remote, err := parseManifestPorts(spec)
+			if err != nil {
+				return nil, nil, fmt.Errorf("forwards[%d]: %w", i, err)
+			}
+
+			target := net.JoinHostPort(host, remote)
+
+			forwards = append(forwards, ForwardConfig{Address: net.JoinHostPort(address, local), Target: target})
+
+			if mf.Protocol != "" {
+				routes = append(routes, RouteConfig{Match: target, Protocol: mf.Protocol})
+			}
+		}
+	}
+
+	return forwards, routes, nil
+}
+
+// host returns the podproxy hostname of the forward's resource, e.g.
+// postgres.db.production or deployment/api.web.production.
+func (mf manifestForward) host() (string, error) {
+	if mf.Context == "" {
+		return "", errors.New("context is required")
+	}
+
+	kind, name, found := strings.Cut(mf.Resource, "/")
+	if !found || name == "" {
+		return "", fmt.Errorf("resource %q must be TYPE/NAME of a service, deployment or statefulset", mf.Resource)
+	}
+
+	prefix, ok := manifestResources[strings.ToLower(kind)]
+	if !ok {
+		return "", fmt.Errorf("resource %q: type %s can't be forwarded, use the service, deployment or statefulset of the pod", mf.Resource, kind)
+	}
+
+	host := prefix + name
+	if mf.Namespace != "" {
+		host += "." + mf.Namespace
+	}
+
+	return host + "." + mf.Context, nil
+}
+
+// parseManifestPorts parses a "LOCAL:REMOTE" or "REMOTE" port pair. Unlike
+// with kubectl, the local port can't be left for the OS to pick, as
+// clients need to know it.
+func parseManifestPorts(spec string) (local, remote string, err error) {
+	local, remote, found := strings.Cut(spec, ":")
+	if !found {
+		remote = local
+	}
+
+	for _, port := range []string{local, remote} {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return "", "", fmt.Errorf("ports: %q must be [LOCAL:]REMOTE with ports 1-65535", spec)
+		}
+	}
+
+	return local, remote, nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadForwardManifests(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlManifest := filepath.Join(dir, "forwards.yaml")
+	if err := os.WriteFile(yamlManifest, []byte(`
+forwards:
+  - context: production
+    namespace: db
+    resource: svc/postgres
+    ports: ["5432", "15433:5433"]
+  - context: staging
+    resource: deploy/api
+    ports: [8080]
+    address: 0.0.0.0
+    protocol: http
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonManifest := filepath.Join(dir, "forwards.json")
+	if err := os.WriteFile(jsonManifest, []byte(`{"forwards": [{"context": "production", "namespace": "cache", "resource": "sts/redis", "ports": ["6379"]}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfgPath := writeTempConfig(t, fmt.Sprintf(`
+routes:
+  - match: "*.staging:8080"
+    protocol: h2c
+forwardManifests: [%q, %q]
+`, yamlManifest, jsonManifest))
+
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	want := []ForwardConfig{
+		{Address: "127.0.0.1:5432", Target: "postgres.db.production:5432"},
+		{Address: "127.0.0.1:15433", Target: "postgres.db.production:5433"},
+		{Address: "0.0.0.0:8080", Target: "deployment/api.staging:8080"},
+		{Address: "127.0.0.1:6379", Target: "statefulset/redis.cache.production:6379"},
+	}
+	if !slices.Equal(cfg.Forwards, want) {
+		t.Errorf("Forwards = %+v, want %+v", cfg.Forwards, want)
+	}
+
+	// the config file's routes come before the imported ones, so they win.
+	if len(cfg.Routes) != 2 || cfg.Routes[1].Match != "deployment/api.staging:8080" || cfg.Routes[1].Protocol != "http" {
+		t.Errorf("Routes = %+v", cfg.Routes)
+	}
+}
+
+func TestImportForwardManifestErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{"pod", `{"forwards": [{"context": "production", "resource": "pod/web-0", "ports": ["80"]}]}`, "can't be forwarded"},
+		{"bare name", `{"forwards": [{"context": "production", "resource": "web-0", "ports": ["80"]}]}`, "TYPE/NAME"},
+		{"no context", `{"forwards": [{"resource": "svc/web", "ports": ["80"]}]}`, "context is required"},
+		{"no ports", `{"forwards": [{"context": "production", "resource": "svc/web"}]}`, "ports are required"},
+		{"random local port", `{"forwards": [{"context": "production", "resource": "svc/web", "ports": [":80"]}]}`, "[LOCAL:]REMOTE"},
+		{"named port", `{"forwards": [{"context": "production", "resource": "svc/web", "ports": ["8080:http"]}]}`, "[LOCAL:]REMOTE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "forwards.json")
+			if err := os.WriteFile(path, []byte(tt.manifest), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err := importForwardManifest(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("importForwardManifest() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
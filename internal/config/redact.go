@@ -0,0 +1,47 @@
+package config
+
+import (
+	"net/url"
+	"slices"
+)
+
+// redacted replaces secrets in Redacted configs.
+const redacted = "REDACTED"
+
+// Redacted returns a copy of c with passwords replaced, for printing.
+func (c *Config) Redacted() *Config {
+	out := *c
+
+	out.Auth.Users = slices.Clone(c.Auth.Users)
+	for i := range out.Auth.Users {
+		out.Auth.Users[i].Password = redactSecret(out.Auth.Users[i].Password)
+	}
+
+	out.Admin.Users = slices.Clone(c.Admin.Users)
+	for i := range out.Admin.Users {
+		out.Admin.Users[i].Password = redactSecret(out.Admin.Users[i].Password)
+	}
+
+	out.Auth.LDAP.BindPassword = redactSecret(c.Auth.LDAP.BindPassword)
+	out.Metrics.Pushgateway.URL = redactURL(c.Metrics.Pushgateway.URL)
+
+	return &out
+}
+
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+// redactURL hides the password of a URL with credentials.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+
+	return u.Redacted()
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// durationPattern matches the values time.ParseDuration accepts.
+const durationPattern = `^(0|-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+)$`
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// Schema returns a JSON Schema (draft 2020-12) of the YAML config, derived
+// from the Config structs, with the embedded defaults as default values.
+// Unlike the loader, which ignores unknown keys, the schema rejects them, so
+// a misspelled key fails validation.
+func Schema() ([]byte, error) {
+	var defaults Config
+	if err := yaml.Unmarshal(DefaultConfigData, &defaults); err != nil {
+		return nil, fmt.Errorf("parsing default config: %w", err)
+	}
+
+	schema := schemaFor(reflect.TypeFor[Config](), reflect.ValueOf(defaults))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "podproxy configuration"
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// schemaFor returns the schema of t. def holds the default value, or is
+// invalid where there is none, as for map values and list items.
+func schemaFor(t reflect.Type, def reflect.Value) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		if def.IsValid() {
+			if def.IsNil() {
+				def = reflect.Value{}
+			} else {
+				def = def.Elem()
+			}
+		}
+
+		return schemaFor(t.Elem(), def)
+	}
+
+	if t == durationType {
+		schema := map[string]any{"type": "string", "pattern": durationPattern}
+		if def.IsValid() && def.Int() != 0 {
+			schema["default"] = time.Duration(def.Int()).String()
+		}
+
+		return schema
+	}
+
+	var schema map[string]any
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t, def)
+	case reflect.Slice:
+		schema = map[string]any{"type": "array", "items": schemaFor(t.Elem(), reflect.Value{})}
+	case reflect.Map:
+		schema = map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), reflect.Value{})}
+	case reflect.String:
+		schema = map[string]any{"type": "string"}
+	case reflect.Bool:
+		schema = map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema = map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		schema = map[string]any{"type": "number"}
+	default:
+		// types the YAML decoder fills in its own way; anything goes.
+		return map[string]any{}
+	}
+
+	if def.IsValid() && !def.IsZero() && ((t.Kind() != reflect.Slice && t.Kind() != reflect.Map) || def.Len() > 0) {
+		schema["default"] = def.Interface()
+	}
+
+	return schema
+}
+
+// structSchema returns the schema of a struct, with a property per field the
+// YAML decoder sets.
+func structSchema(t reflect.Type, def reflect.Value) map[string]any {
+	properties := make(map[string]any)
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			// the YAML decoder's default key.
+			name = strings.ToLower(f.Name)
+		}
+
+		var fieldDef reflect.Value
+		if def.IsValid() {
+			fieldDef = def.Field(i)
+		}
+
+		properties[name] = schemaFor(f.Type, fieldDef)
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSchema(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Schema() is not JSON: %v", err)
+	}
+
+	// every key of the defaults is described, so the schema accepts them.
+	var defaults map[string]any
+	if err := yaml.Unmarshal(DefaultConfigData, &defaults); err != nil {
+		t.Fatal(err)
+	}
+
+	checkSchemaKeys(t, "", schema, defaults)
+
+	logLevel := property(t, schema, "log", "level")
+	if logLevel["type"] != "string" || logLevel["default"] != "info" {
+		t.Errorf("log.level = %v, want a string defaulting to info", logLevel)
+	}
+
+	cacheTTL := property(t, schema, "auth", "ldap", "cacheTTL")
+	if cacheTTL["default"] != "5m0s" || !regexp.MustCompile(cacheTTL["pattern"].(string)).MatchString("1h30m") {
+		t.Errorf("auth.ldap.cacheTTL = %v, want a duration defaulting to 5m0s", cacheTTL)
+	}
+
+	if schema["additionalProperties"] != false {
+		t.Error("unknown top-level keys are allowed, want them rejected")
+	}
+
+	clusters := property(t, schema, "clusters")
+	if cluster, _ := clusters["additionalProperties"].(map[string]any); cluster["properties"].(map[string]any)["impersonate"] == nil {
+		t.Errorf("clusters values = %v, want cluster settings", cluster)
+	}
+}
+
+// property returns the schema of the property at path.
+func property(t *testing.T, schema map[string]any, path ...string) map[string]any {
+	t.Helper()
+
+	for _, name := range path {
+		props, _ := schema["properties"].(map[string]any)
+
+		next, ok := props[name].(map[string]any)
+		if !ok {
+			t.Fatalf("schema has no property %q in %v", name, path)
+		}
+
+		schema = next
+	}
+
+	return schema
+}
+
+func checkSchemaKeys(t *testing.T, prefix string, schema map[string]any, values map[string]any) {
+	t.Helper()
+
+	props, _ := schema["properties"].(map[string]any)
+
+	for key, value := range values {
+		sub, ok := props[key].(map[string]any)
+		if !ok {
+			t.Errorf("default key %s%s missing from the schema", prefix, key)
+			continue
+		}
+
+		if nested, ok := value.(map[string]any); ok && sub["properties"] != nil {
+			checkSchemaKeys(t, prefix+key+".", sub, nested)
+		}
+	}
+}
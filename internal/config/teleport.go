@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TeleportConfig discovers the Kubernetes clusters of the active Teleport
+// profile. tsh writes their contexts to a kubeconfig owned by podproxy, with
+// an exec credential plugin that re-invokes tsh whenever the short-lived
+// certificate expires.
+type TeleportConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Tsh is the tsh binary, looked up in PATH unless it contains a path
+	// separator.
+	Tsh string `yaml:"tsh"`
+	// Kubeconfig is the file tsh writes the contexts to, kept apart from the
+	// user's kubeconfig.
+	Kubeconfig string `yaml:"kubeconfig"`
+	// Timeout bounds the tsh invocation at startup.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// teleportContextName names each context after its Teleport kube cluster, so
+// cluster names don't carry the dots of the Teleport cluster name.
+const teleportContextName = "{{.KubeName}}"
+
+// runTsh runs tsh with KUBECONFIG pointing at kubeconfig. overridden in tests.
+var runTsh = func(ctx context.Context, tsh, kubeconfig string, args ...string) error {
+	cmd := exec.CommandContext(ctx, tsh, args...)
+	cmd.Env = append(os.Environ(), "KUBECONFIG="+kubeconfig)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %w: %s", tsh, err, msg)
+		}
+
+		return fmt.Errorf("%s: %w", tsh, err)
+	}
+
+	return nil
+}
+
+// resolveTeleport logs into all Kubernetes clusters of the active Teleport
+// profile and loads the resulting kubeconfig. When tsh fails, e.g. because
+// the Teleport session expired, the contexts of the previous run are used.
+func resolveTeleport(cfg *Config, seen map[string]bool) ([]ResolvedCluster, error) {
+	tc := cfg.Teleport
+	if !tc.Enabled {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(tc.Kubeconfig), 0o700); err != nil {
+		return nil, fmt.Errorf("creating teleport kubeconfig directory: %w", err)
+	}
+
+	ctx := context.Background()
+
+	if tc.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, tc.Timeout)
+		defer cancel()
+	}
+
+	err := runTsh(ctx, tc.Tsh, tc.Kubeconfig, "kube", "login", "--all", "--set-context-name="+teleportContextName)
+	if err != nil {
+		slog.Warn("teleport kube login failed; run tsh login to refresh the session", "error", err)
+	}
+
+	if _, statErr := os.Stat(tc.Kubeconfig); errors.Is(statErr, os.ErrNotExist) {
+		if err == nil {
+			slog.Info("teleport profile has no kubernetes clusters")
+		}
+
+		return nil, nil
+	}
+
+	return loadKubeconfigFile(tc.Kubeconfig, "teleport", seen)
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestResolveTeleport(t *testing.T) {
+	isolateKubeconfigDiscovery(t)
+
+	orig := runTsh
+	t.Cleanup(func() { runTsh = orig })
+
+	dir := t.TempDir()
+
+	var gotArgs []string
+
+	runTsh = func(_ context.Context, _, kubeconfig string, args ...string) error {
+		gotArgs = args
+		writeKubeconfig(t, filepath.Dir(kubeconfig), filepath.Base(kubeconfig), map[string]string{"prod-eu": "", "dev": "web"})
+
+		return nil
+	}
+
+	cfg := &Config{Teleport: TeleportConfig{Enabled: true, Tsh: "tsh", Kubeconfig: filepath.Join(dir, "teleport", "kubeconfig")}}
+
+	clusters, err := resolveKubeconfigs(cfg)
+	if err != nil {
+		t.Fatalf("resolveKubeconfigs() error: %v", err)
+	}
+
+	if !slices.Contains(gotArgs, "--all") {
+		t.Errorf("tsh args = %v, want kube login --all", gotArgs)
+	}
+
+	var names []string
+	for _, rc := range clusters {
+		names = append(names, rc.Name)
+	}
+
+	slices.Sort(names)
+
+	if !slices.Equal(names, []string{"dev", "prod-eu"}) {
+		t.Errorf("clusters = %v, want [dev prod-eu]", names)
+	}
+
+	// an expired session keeps the contexts of the previous login.
+	runTsh = func(context.Context, string, string, ...string) error {
+		return errors.New("ERROR: not logged in")
+	}
+
+	clusters, err = resolveKubeconfigs(cfg)
+	if err != nil {
+		t.Fatalf("resolveKubeconfigs() after failed login error: %v", err)
+	}
+
+	if len(clusters) != 2 {
+		t.Errorf("got %d clusters after failed login, want the previous 2", len(clusters))
+	}
+}
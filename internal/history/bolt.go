@@ -0,0 +1,180 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+)
+
+var connectionsBucket = []byte("connections")
+
+// BoltStore is a Store backed by an embedded bbolt database. Records are
+// keyed by start time so time-bounded queries and pruning are range scans.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens (or creates) the history database at path. With
+// readOnly set the database is opened with a shared lock, which fails after
+// a short timeout while a running instance holds it open for writing.
+func OpenBoltStore(path string, readOnly bool) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("opening history database %s: %w", path, err)
+	}
+
+	if !readOnly {
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(connectionsBucket)
+			return err
+		})
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("initializing history database: %w", err)
+		}
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Append stores r. Records appended after Close are dropped, so connections
+// still draining after the database was handed over to a replacement
+// instance don't fail.
+func (s *BoltStore) Append(r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encoding history record: %w", err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(connectionsBucket)
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return b.Put(recordKey(r.Start, seq), data)
+	})
+	if errors.Is(err, berrors.ErrDatabaseNotOpen) {
+		return nil
+	}
+
+	return err
+}
+
+// Query returns all records matching f, oldest first.
+func (s *BoltStore) Query(f Filter) ([]Record, error) {
+	var records []Record
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(connectionsBucket)
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+
+		for k, v := c.Seek(recordKey(f.Since, 0)); k != nil; k, v = c.Next() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				continue
+			}
+
+			if f.Match(r) {
+				records = append(records, r)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("querying history: %w", err)
+	}
+
+	return records, nil
+}
+
+// Prune deletes all records started before cutoff and returns how many
+// were removed.
+func (s *BoltStore) Prune(cutoff time.Time) (int, error) {
+	var removed int
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(connectionsBucket)
+		end := recordKey(cutoff, 0)
+
+		// collect first: deleting through a cursor while iterating skips keys.
+		var expired [][]byte
+
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+			expired = append(expired, k)
+		}
+
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		removed = len(expired)
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("pruning history: %w", err)
+	}
+
+	return removed, nil
+}
+
+// RunRetention prunes records older than retention every interval until ctx
+// is cancelled.
+func (s *BoltStore) RunRetention(ctx context.Context, retention, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if removed, err := s.Prune(time.Now().Add(-retention)); err != nil {
+			logger.Warn("history retention failed", "error", err)
+		} else if removed > 0 {
+			logger.Debug("pruned connection history", "records", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// recordKey encodes the start time and a sequence number so keys sort
+// chronologically and stay unique for records with identical start times.
+func recordKey(start time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+
+	var nanos int64
+	if !start.IsZero() {
+		nanos = start.UnixNano()
+	}
+
+	binary.BigEndian.PutUint64(key[:8], uint64(max(nanos, 0)))
+	binary.BigEndian.PutUint64(key[8:], seq)
+
+	return key
+}
@@ -0,0 +1,126 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *BoltStore {
+	t.Helper()
+
+	store, err := OpenBoltStore(filepath.Join(t.TempDir(), "history.db"), false)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error: %v", err)
+	}
+
+	t.Cleanup(func() { _ = store.Close() })
+
+	return store
+}
+
+func TestBoltStoreAppendAndQuery(t *testing.T) {
+	store := openTestStore(t)
+
+	now := time.Now()
+	records := []Record{
+		{Start: now.Add(-time.Minute), Cluster: "staging", Namespace: "web", User: "bob", Outcome: OutcomeError},
+		{Start: now.Add(-48 * time.Hour), Cluster: "production", Namespace: "db", Outcome: OutcomeOK},
+		{Start: now.Add(-time.Hour), Cluster: "production", Namespace: "db", User: "alice", Outcome: OutcomeOK},
+	}
+
+	for _, r := range records {
+		if err := store.Append(r); err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{name: "no filter", filter: Filter{}, want: 3},
+		{name: "since", filter: Filter{Since: now.Add(-24 * time.Hour)}, want: 2},
+		{name: "cluster", filter: Filter{Cluster: "production"}, want: 2},
+		{name: "namespace", filter: Filter{Namespace: "web"}, want: 1},
+		{name: "user", filter: Filter{User: "alice"}, want: 1},
+		{name: "combined", filter: Filter{Cluster: "production", User: "bob"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error: %v", err)
+			}
+
+			if len(got) != tt.want {
+				t.Errorf("len(Query()) = %d, want %d", len(got), tt.want)
+			}
+		})
+	}
+
+	all, _ := store.Query(Filter{})
+	for i := 1; i < len(all); i++ {
+		if all[i].Start.Before(all[i-1].Start) {
+			t.Fatal("Query() results are not ordered oldest first")
+		}
+	}
+}
+
+func TestBoltStoreSameStartTime(t *testing.T) {
+	store := openTestStore(t)
+	start := time.Now()
+
+	for range 3 {
+		if err := store.Append(Record{Start: start}); err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+	}
+
+	got, _ := store.Query(Filter{})
+	if len(got) != 3 {
+		t.Errorf("len(Query()) = %d, want 3", len(got))
+	}
+}
+
+func TestBoltStorePrune(t *testing.T) {
+	store := openTestStore(t)
+	now := time.Now()
+
+	for i := range 5 {
+		if err := store.Append(Record{Start: now.Add(-time.Duration(i) * 24 * time.Hour)}); err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+	}
+
+	removed, err := store.Prune(now.Add(-36 * time.Hour))
+	if err != nil {
+		t.Fatalf("Prune() error: %v", err)
+	}
+
+	if removed != 3 {
+		t.Errorf("Prune() removed %d, want 3", removed)
+	}
+
+	got, _ := store.Query(Filter{})
+	if len(got) != 2 {
+		t.Errorf("len(Query()) = %d, want 2", len(got))
+	}
+}
+
+func TestBoltStoreAppendAfterClose(t *testing.T) {
+	store, err := OpenBoltStore(filepath.Join(t.TempDir(), "history.db"), false)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error: %v", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	if err := store.Append(Record{Start: time.Now(), Outcome: OutcomeOK}); err != nil {
+		t.Errorf("Append() after Close error: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Outcome values recorded for each connection.
+const (
+	OutcomeOK    = "ok"
+	OutcomeError = "error"
+	// OutcomeDenied marks connections refused by a cluster's access policy.
+	OutcomeDenied = "denied"
+	// OutcomeRevoked marks connections closed by podproxy while open, e.g.
+	// through the admin API.
+	OutcomeRevoked = "revoked"
+)
+
+// Record describes a single completed (or failed) proxied connection.
+type Record struct {
+	Start        time.Time     `json:"start"`
+	Duration     time.Duration `json:"duration"`
+	Addr         string        `json:"addr"`
+	Cluster      string        `json:"cluster"`
+	Namespace    string        `json:"namespace"`
+	Target       string        `json:"target"`
+	User         string        `json:"user,omitempty"`
+	BytesRead    int64         `json:"rx"`
+	BytesWritten int64         `json:"tx"`
+	Outcome      string        `json:"outcome"`
+	Error        string        `json:"error,omitempty"`
+	// Egress is the label of the passthrough route of a connection to an
+	// address outside the clusters, which has no cluster.
+	Egress string `json:"egress,omitempty"`
+}
+
+// Filter selects records by time and connection metadata. Zero-valued
+// fields match everything.
+type Filter struct {
+	Since     time.Time
+	Cluster   string
+	Namespace string
+	User      string
+}
+
+// Match reports whether r satisfies the filter.
+func (f Filter) Match(r Record) bool {
+	if !f.Since.IsZero() && r.Start.Before(f.Since) {
+		return false
+	}
+
+	if f.Cluster != "" && r.Cluster != f.Cluster {
+		return false
+	}
+
+	if f.Namespace != "" && r.Namespace != f.Namespace {
+		return false
+	}
+
+	if f.User != "" && r.User != f.User {
+		return false
+	}
+
+	return true
+}
+
+// Store persists connection records and allows querying them back.
+type Store interface {
+	Append(r Record) error
+	// Query returns the records matching f, oldest first.
+	Query(f Filter) ([]Record, error)
+	Close() error
+}
+
+// WriteJSONL writes records as JSON lines.
+func WriteJSONL(w io.Writer, records []Record) error {
+	enc := json.NewEncoder(w)
+
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var csvHeader = []string{
+	"start", "duration_ms", "addr", "cluster", "namespace", "target",
+	"user", "rx", "tx", "outcome", "error", "egress",
+}
+
+// WriteCSV writes records as CSV with a header row.
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		row := []string{
+			r.Start.UTC().Format(time.RFC3339),
+			strconv.FormatInt(r.Duration.Milliseconds(), 10),
+			r.Addr,
+			r.Cluster,
+			r.Namespace,
+			r.Target,
+			r.User,
+			strconv.FormatInt(r.BytesRead, 10),
+			strconv.FormatInt(r.BytesWritten, 10),
+			r.Outcome,
+			r.Error,
+			r.Egress,
+		}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
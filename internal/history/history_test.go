@@ -0,0 +1,38 @@
+package history
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCSV(t *testing.T) {
+	records := []Record{{
+		Start:        time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration:     1500 * time.Millisecond,
+		Addr:         "redis.db.production:6379",
+		Cluster:      "production",
+		Namespace:    "db",
+		Target:       "db/redis-0:6379",
+		User:         "alice",
+		BytesRead:    10,
+		BytesWritten: 20,
+		Outcome:      OutcomeOK,
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, records); err != nil {
+		t.Fatalf("WriteCSV() error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+
+	want := "2026-01-02T03:04:05Z,1500,redis.db.production:6379,production,db,db/redis-0:6379,alice,10,20,ok,,"
+	if lines[1] != want {
+		t.Errorf("row = %q, want %q", lines[1], want)
+	}
+}
@@ -0,0 +1,156 @@
+package kube
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/proxyproto"
+)
+
+// SessionAffinity sends the connections of one client to a Service to the
+// same pod while it stays ready, like a Service with sessionAffinity
+// ClientIP, so tools opening parallel connections see one backend. Clients
+// are told apart by IP address and proxy user. It may be shared between
+// dialers.
+type SessionAffinity struct {
+	// Timeout is how long a client's pod is remembered after its last
+	// connection. Zero remembers it until the pod becomes unready.
+	Timeout time.Duration
+	// Strict keeps a client's pod after a failed connection while it stays
+	// ready, so the retries of paired connections stay on it.
+	Strict bool
+
+	mu   sync.Mutex
+	pods map[affinityKey]affinityEntry
+}
+
+type affinityKey struct {
+	client, cluster, namespace, service string
+}
+
+type affinityEntry struct {
+	pod  string
+	last time.Time
+}
+
+type affinityCtxKey struct{}
+
+// withAffinity returns a context whose service connections stick to a pod
+// per client, if a is set. An affinity already in ctx, set for paired ports,
+// takes precedence.
+func withAffinity(ctx context.Context, a *SessionAffinity) context.Context {
+	if a == nil || ctx.Value(affinityCtxKey{}) != nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, affinityCtxKey{}, a)
+}
+
+// sessionAffinity returns the session affinity of ctx and the client its
+// connection is dialed for, or nil if it has none or the client is unknown.
+func sessionAffinity(ctx context.Context) (*SessionAffinity, string) {
+	a, _ := ctx.Value(affinityCtxKey{}).(*SessionAffinity)
+
+	addr := proxyproto.ClientAddr(ctx)
+	if a == nil || addr == nil {
+		return nil, ""
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	return a, auth.UserFromContext(ctx) + "@" + host
+}
+
+// pick returns the pod of pods, the ready pods of the Service, that the
+// connections of key stick to. Clients without one, or whose pod is no
+// longer ready, get the pod balance picks. A nil a always uses balance.
+func (a *SessionAffinity) pick(key affinityKey, pods []string, now time.Time, balance func() string) string {
+	if a == nil {
+		return balance()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if e, ok := a.pods[key]; ok && (a.Timeout == 0 || now.Sub(e.last) < a.Timeout) && slices.Contains(pods, e.pod) {
+		a.pods[key] = affinityEntry{pod: e.pod, last: now}
+		return e.pod
+	}
+
+	if a.pods == nil {
+		a.pods = make(map[affinityKey]affinityEntry)
+	}
+
+	if a.Timeout > 0 {
+		for k, e := range a.pods {
+			if now.Sub(e.last) >= a.Timeout {
+				delete(a.pods, k)
+			}
+		}
+	}
+
+	pod := balance()
+	a.pods[key] = affinityEntry{pod: pod, last: now}
+
+	return pod
+}
+
+// forget drops the pod of key after a connection to pod failed, so the
+// retry may pick another one, unless a is strict.
+func (a *SessionAffinity) forget(key affinityKey, pod string) {
+	if a == nil || a.Strict {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pods[key].pod == pod {
+		delete(a.pods, key)
+	}
+}
+
+// PairPorts returns a DialMiddleware sending the connections of one client
+// to the paired ports of a route, such as the control and data ports of a
+// debugger, to the same pod of a Service or workload, also when they are
+// retried, while the pod stays ready. Pairing takes precedence over the
+// dialer's session affinity. The pods are shared by all dialers using the
+// returned middleware.
+func (r Routes) PairPorts() DialMiddleware {
+	pairs := make([]*SessionAffinity, len(r))
+	for i := range r {
+		if len(r[i].PairedPorts) > 0 {
+			pairs[i] = &SessionAffinity{Strict: true}
+		}
+	}
+
+	return func(next DialFunc) DialFunc {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if i := r.index(addr); i >= 0 && pairs[i] != nil && pairedPort(r[i].PairedPorts, addr) {
+				ctx = withAffinity(ctx, pairs[i])
+			}
+
+			return next(ctx, network, addr)
+		}
+	}
+}
+
+// pairedPort reports whether the port of addr is one of ports.
+func pairedPort(ports []int, addr string) bool {
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	port, err := strconv.Atoi(portStr)
+
+	return err == nil && slices.Contains(ports, port)
+}
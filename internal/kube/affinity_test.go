@@ -0,0 +1,150 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/proxyproto"
+)
+
+func TestSessionAffinityPick(t *testing.T) {
+	a := &SessionAffinity{Timeout: time.Hour}
+	now := time.Now()
+
+	next := 0
+	roundRobin := func(pods []string) func() string {
+		return func() string {
+			next++
+			return pods[next%len(pods)]
+		}
+	}
+
+	pods := []string{"api-0", "api-1", "api-2"}
+	alice := affinityKey{client: "@10.0.0.1", cluster: "production", namespace: "web", service: "api"}
+	bob := affinityKey{client: "@10.0.0.2", cluster: "production", namespace: "web", service: "api"}
+
+	first := a.pick(alice, pods, now, roundRobin(pods))
+	for range 3 {
+		if got := a.pick(alice, pods, now, roundRobin(pods)); got != first {
+			t.Fatalf("pick() = %s, want %s again", got, first)
+		}
+	}
+
+	if got := a.pick(bob, pods, now, roundRobin(pods)); got == first {
+		t.Errorf("second client stuck to %s as well", got)
+	}
+
+	// the pod became unready.
+	ready := slices.DeleteFunc(slices.Clone(pods), func(p string) bool { return p == first })
+
+	moved := a.pick(alice, ready, now, roundRobin(ready))
+	if moved == first {
+		t.Fatalf("pick() = %s, which is no longer ready", moved)
+	}
+
+	if got := a.pick(alice, pods, now, roundRobin(pods)); got != moved {
+		t.Errorf("pick() = %s after the old pod came back, want %s", got, moved)
+	}
+
+	a.forget(alice, moved)
+
+	if got := a.pick(alice, pods, now.Add(2*time.Hour), func() string { return "api-2" }); got != "api-2" {
+		t.Errorf("pick() = %s after forget, want a new pick", got)
+	}
+
+	if got := (*SessionAffinity)(nil).pick(alice, pods, now, func() string { return "api-1" }); got != "api-1" {
+		t.Errorf("nil pick() = %s, want the balanced pod", got)
+	}
+}
+
+func TestSessionAffinityClient(t *testing.T) {
+	a := &SessionAffinity{}
+	ctx := withAffinity(context.Background(), a)
+
+	if got, _ := sessionAffinity(ctx); got != nil {
+		t.Error("sessionAffinity() without a client address returned an affinity")
+	}
+
+	ctx = auth.WithUser(proxyproto.WithClientAddr(ctx, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 51234}), "alice")
+
+	if got, client := sessionAffinity(ctx); got != a || client != "alice@10.0.0.1" {
+		t.Errorf("sessionAffinity() = %p, %q, want %p, alice@10.0.0.1", got, client, a)
+	}
+}
+
+func TestRoutesPairPorts(t *testing.T) {
+	var (
+		dialed []string
+		fail   bool
+	)
+
+	fwd := &PortForwarder{
+		Name:          "production",
+		LoadBalancing: BalanceRoundRobin,
+		baseBackoff:   time.Millisecond,
+		resolveFunc: func(context.Context, string, string) ([]string, error) {
+			return []string{"jdwp-0", "jdwp-1", "jdwp-2"}, nil
+		},
+		targetPortFunc: func(_ context.Context, _, _, _ string, port int) (int, error) {
+			return port, nil
+		},
+		dialFunc: func(_, pod string, port int) (*StreamConn, error) {
+			dialed = append(dialed, fmt.Sprintf("%s:%d", pod, port))
+			if fail {
+				fail = false
+				return nil, fmt.Errorf("dial: %w", syscall.ECONNRESET)
+			}
+
+			return newTestStreamConn(), nil
+		},
+	}
+
+	routes := Routes{{Match: "debug.*.production", PairedPorts: []int{5005, 5006}}}
+
+	d := &ClusterDialer{Forwarders: map[string]*PortForwarder{"production": fwd}}
+	d.Use(routes.PairPorts())
+
+	ctx := proxyproto.WithClientAddr(context.Background(), &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 51234})
+
+	dial := func(addr string) string {
+		t.Helper()
+
+		dialed = nil
+
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			t.Fatalf("DialContext(%s): %v", addr, err)
+		}
+		conn.Close()
+
+		pod, _, _ := strings.Cut(dialed[len(dialed)-1], ":")
+
+		return pod
+	}
+
+	control := dial("debug.app.production:5005")
+
+	// the data connection fails once; the retry stays on the pod.
+	fail = true
+
+	if got := dial("debug.app.production:5006"); got != control || len(dialed) != 2 || !strings.HasPrefix(dialed[0], control+":") {
+		t.Errorf("data connection dialed %v, want %s twice", dialed, control)
+	}
+
+	// other ports are balanced as usual.
+	pods := map[string]bool{}
+	for range 3 {
+		pods[dial("debug.app.production:8080")] = true
+	}
+
+	if len(pods) != 3 {
+		t.Errorf("unpaired port dialed pods %v, want all of them", pods)
+	}
+}
@@ -0,0 +1,172 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	xproxy "golang.org/x/net/proxy"
+	"k8s.io/client-go/rest"
+)
+
+// apiServerAddr returns the host and port of the API server config talks to,
+// and the proxy it is reached through, if any.
+func apiServerAddr(config *rest.Config) (string, *url.URL, error) {
+	server, _, err := rest.DefaultServerUrlFor(config)
+	if err != nil {
+		return "", nil, fmt.Errorf("building API server URL: %w", err)
+	}
+
+	port := server.Port()
+	if port == "" {
+		port = "443"
+		if server.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	proxier := http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		proxier = config.Proxy
+	}
+
+	proxyURL, err := proxier(&http.Request{URL: server})
+	if err != nil {
+		return "", nil, fmt.Errorf("looking up API server proxy: %w", err)
+	}
+
+	return net.JoinHostPort(server.Hostname(), port), proxyURL, nil
+}
+
+// dialAPIServer tunnels a connection to kubernetes.default of the cluster
+// to its API server as given by the rest config, through the proxy the
+// cluster's API traffic takes. The client speaks TLS with the API server
+// itself, so its own credentials apply.
+func (k *PortForwarder) dialAPIServer(ctx context.Context, originalAddr string, target Target, user string, connID uint64, start time.Time) (net.Conn, error) {
+	restCfg, _ := k.Clients()
+
+	addr, proxyURL, err := apiServerAddr(restCfg)
+	if err == nil {
+		if k.DialTimeout > 0 {
+			var cancel context.CancelFunc
+
+			ctx, cancel = context.WithTimeout(ctx, k.DialTimeout)
+			defer cancel()
+		}
+
+		var conn net.Conn
+
+		conn, err = dialVia(ctx, proxyURL, addr)
+		if err == nil {
+			if k.Logger != nil {
+				k.Logger.Info("connect", "addr", originalAddr, "apiserver", addr, "user", user, "conn", connID)
+			}
+
+			return k.track(ctx, newNetConn(conn), start, user, originalAddr, target, addr, connID, nil), nil
+		}
+	}
+
+	if k.Logger != nil {
+		k.Logger.Error("failed to connect", "addr", originalAddr, "apiserver", addr, "error", err, "conn", connID)
+	}
+
+	err = fmt.Errorf("API server of cluster %s: %w", k.Name, err)
+	k.recordFailed(start, user, originalAddr, target, err)
+
+	return nil, err
+}
+
+// dialVia dials addr through proxyURL, an http, https or socks5 proxy, or
+// directly if proxyURL is nil.
+func dialVia(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+
+	if proxyURL == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		p, err := xproxy.FromURL(proxyURL, dialer)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %s: %w", proxyURL.Redacted(), err)
+		}
+
+		return p.(xproxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	case "http", "https":
+		return dialConnect(ctx, dialer, proxyURL, addr)
+	default:
+		return nil, fmt.Errorf("proxy %s: unsupported scheme %q", proxyURL.Redacted(), proxyURL.Scheme)
+	}
+}
+
+// dialConnect opens a tunnel to addr with an HTTP CONNECT request to the
+// proxy at proxyURL.
+func dialConnect(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), map[string]string{"http": "80", "https": "443"}[proxyURL.Scheme])
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", proxyURL.Redacted(), err)
+	}
+
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy %s: %w", proxyURL.Redacted(), err)
+		}
+
+		conn = tlsConn
+	}
+
+	// the request and response must not outlive ctx.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxyURL.Redacted(), err)
+	}
+
+	// the API server doesn't speak before the client's TLS hello, so
+	// nothing past the response is buffered, and the body of a successful
+	// response is the tunnel.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxyURL.Redacted(), err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: CONNECT %s: %s", proxyURL.Redacted(), addr, resp.Status)
+	}
+
+	if !stop() {
+		return nil, fmt.Errorf("proxy %s: %w", proxyURL.Redacted(), ctx.Err())
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,92 @@
+package kube
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestDialTarget_APIServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	traffic := &Traffic{}
+
+	fwd := &PortForwarder{
+		Name:    "production",
+		Config:  &rest.Config{Host: "https://" + ln.Addr().String()},
+		Traffic: traffic,
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			t.Error("the API server was port-forwarded to")
+			return nil, io.EOF
+		},
+	}
+
+	target, err := ParseTarget("kubernetes.default.production:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := fwd.dialTarget(context.Background(), "kubernetes.default.production:443", target)
+	if err != nil {
+		t.Fatalf("dialTarget: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("read %q, %v, want the echo of the API server", buf, err)
+	}
+
+	if open := traffic.Open(); len(open) != 1 || open[0].Target != ln.Addr().String() || open[0].BytesWritten != 4 {
+		t.Errorf("Open() = %+v, want the tunnel to %s", open, ln.Addr())
+	}
+
+	if n := traffic.Revoke(func(OpenConn) error { return io.EOF }); n != 1 {
+		t.Errorf("Revoke() = %d, want 1", n)
+	}
+
+	if _, err := conn.Read(buf); err == nil {
+		t.Error("Read() succeeded on a revoked tunnel")
+	}
+}
+
+func TestAPIServerAddr(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"https://api.production.example.com:6443", "api.production.example.com:6443"},
+		{"https://api.production.example.com", "api.production.example.com:443"},
+		{"http://127.0.0.1", "127.0.0.1:80"},
+	}
+
+	for _, tt := range tests {
+		addr, _, err := apiServerAddr(&rest.Config{Host: tt.host, Proxy: func(*http.Request) (*url.URL, error) { return nil, nil }})
+		if err != nil || addr != tt.want {
+			t.Errorf("apiServerAddr(%q) = %q, %v, want %q", tt.host, addr, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package kube
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
+// LoadBalancing selects which ready pod of a Service a connection is
+// forwarded to.
+type LoadBalancing string
+
+const (
+	// BalanceFirst forwards every connection to the first ready pod the API
+	// lists.
+	BalanceFirst LoadBalancing = "first"
+	// BalanceRoundRobin cycles through the ready pods, in name order.
+	BalanceRoundRobin LoadBalancing = "roundRobin"
+	// BalanceRandom picks a ready pod at random.
+	BalanceRandom LoadBalancing = "random"
+	// BalanceLeastConnections picks the ready pod with the fewest open
+	// connections through the forwarder, the first one on a tie.
+	BalanceLeastConnections LoadBalancing = "leastConnections"
+)
+
+// podBalancer holds the state of the load balancing strategies: the
+// round-robin position per Service and the open connections per pod.
+type podBalancer struct {
+	mu     sync.Mutex
+	next   map[string]int
+	active map[string]int
+}
+
+// pick returns the pod of pods, the ready pods of service in namespace, the
+// next connection goes to. pods must not be empty.
+func (b *podBalancer) pick(policy LoadBalancing, namespace, service string, pods []string) string {
+	switch policy {
+	case BalanceRoundRobin:
+		// the API doesn't guarantee an order; sorting keeps the cycle
+		// stable across lookups.
+		pods = slices.Sorted(slices.Values(pods))
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if b.next == nil {
+			b.next = make(map[string]int)
+		}
+
+		key := namespace + "/" + service
+		i := b.next[key] % len(pods)
+		b.next[key] = i + 1
+
+		return pods[i]
+	case BalanceRandom:
+		return pods[rand.IntN(len(pods))]
+	case BalanceLeastConnections:
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		best := pods[0]
+		for _, pod := range pods[1:] {
+			if b.active[namespace+"/"+pod] < b.active[namespace+"/"+best] {
+				best = pod
+			}
+		}
+
+		return best
+	default:
+		return pods[0]
+	}
+}
+
+// opened counts a connection to pod in namespace and returns the func that
+// uncounts it when the connection closes.
+func (b *podBalancer) opened(namespace, pod string) func() {
+	key := namespace + "/" + pod
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.active == nil {
+		b.active = make(map[string]int)
+	}
+
+	b.active[key]++
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if b.active[key]--; b.active[key] <= 0 {
+			delete(b.active, key)
+		}
+	}
+}
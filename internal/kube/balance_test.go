@@ -0,0 +1,70 @@
+package kube
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPodBalancerRoundRobin(t *testing.T) {
+	var b podBalancer
+
+	var got []string
+	for range 4 {
+		// the API's order may change between lookups.
+		got = append(got, b.pick(BalanceRoundRobin, "ns", "api", []string{"api-1", "api-0"}))
+	}
+
+	if want := []string{"api-0", "api-1", "api-0", "api-1"}; !slices.Equal(got, want) {
+		t.Errorf("round robin picked %v, want %v", got, want)
+	}
+
+	// services cycle independently.
+	if pod := b.pick(BalanceRoundRobin, "ns", "db", []string{"db-0", "db-1"}); pod != "db-0" {
+		t.Errorf("first pick for another service = %s, want db-0", pod)
+	}
+}
+
+func TestPodBalancerLeastConnections(t *testing.T) {
+	var b podBalancer
+
+	pods := []string{"api-0", "api-1", "api-2"}
+
+	release0 := b.opened("ns", "api-0")
+	b.opened("ns", "api-1")
+
+	if pod := b.pick(BalanceLeastConnections, "ns", "api", pods); pod != "api-2" {
+		t.Errorf("picked %s, want the idle api-2", pod)
+	}
+
+	b.opened("ns", "api-2")
+	release0()
+
+	if pod := b.pick(BalanceLeastConnections, "ns", "api", pods); pod != "api-0" {
+		t.Errorf("picked %s after api-0 closed, want api-0", pod)
+	}
+
+	if len(b.active) != 2 {
+		t.Errorf("active = %v, want closed pods dropped", b.active)
+	}
+}
+
+func TestPodBalancerFirstAndRandom(t *testing.T) {
+	var b podBalancer
+
+	pods := []string{"api-1", "api-0"}
+
+	for _, policy := range []LoadBalancing{"", BalanceFirst} {
+		if pod := b.pick(policy, "ns", "api", pods); pod != "api-1" {
+			t.Errorf("pick(%q) = %s, want the first listed pod", policy, pod)
+		}
+	}
+
+	seen := map[string]bool{}
+	for range 100 {
+		seen[b.pick(BalanceRandom, "ns", "api", pods)] = true
+	}
+
+	if len(seen) != 2 {
+		t.Errorf("random picked %v, want both pods", seen)
+	}
+}
@@ -0,0 +1,141 @@
+package kube
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is wrapped by the errors of connections failed fast because
+// their target's circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerState is a target whose circuit breaker tripped.
+type BreakerState struct {
+	Namespace string
+	// Target is the Service, pod, workload or selector dialed, e.g.
+	// service/redis.
+	Target string
+	// Failures counts the failed connections in a row.
+	Failures int
+	// Opened is when the breaker last tripped, and Until when it lets the
+	// next connection through to try the target again.
+	Opened    time.Time
+	Until     time.Time
+	LastError string
+}
+
+// circuitBreaker fails connections to a target fast for a cooldown after
+// its connections failed a number of times in a row, instead of spending
+// the whole retry loop on each. The first connection after the cooldown is
+// a trial: while it runs, the others keep failing fast; if it fails, the
+// breaker trips again right away, and if it succeeds, the breaker resets.
+type circuitBreaker struct {
+	mu      sync.Mutex
+	targets map[string]*breakerEntry
+}
+
+type breakerEntry struct {
+	failures int
+	opened   time.Time
+	until    time.Time
+	err      error
+}
+
+// allow returns an error wrapping ErrCircuitOpen if key's breaker is open
+// at now. Once the cooldown is over, it lets one trial connection through
+// and keeps the breaker open for the others for another cooldown.
+func (b *circuitBreaker) allow(key string, now time.Time, cooldown time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.targets[key]
+	if e == nil || e.until.IsZero() {
+		return nil
+	}
+
+	if now.Before(e.until) {
+		return fmt.Errorf("%w for %s until %s: %w", ErrCircuitOpen, key, e.until.Format(time.TimeOnly), e.err)
+	}
+
+	e.until = now.Add(cooldown)
+
+	return nil
+}
+
+// failed counts a failed connection to key and reports whether it tripped
+// the breaker, which happens at threshold failures in a row and on every
+// failed trial after.
+func (b *circuitBreaker) failed(key string, err error, now time.Time, threshold int, cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.targets == nil {
+		b.targets = make(map[string]*breakerEntry)
+	}
+
+	e := b.targets[key]
+	if e == nil {
+		e = &breakerEntry{}
+		b.targets[key] = e
+	}
+
+	e.failures++
+	e.err = err
+
+	if e.failures < threshold {
+		return false
+	}
+
+	e.opened = now
+	e.until = now.Add(cooldown)
+
+	return true
+}
+
+// succeeded resets key's breaker and reports whether it had tripped.
+func (b *circuitBreaker) succeeded(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.targets[key]
+	delete(b.targets, key)
+
+	return e != nil && !e.until.IsZero()
+}
+
+// Breakers returns the targets whose circuit breaker tripped and hasn't
+// reset yet, sorted by namespace and target. Their Until may have passed
+// while no connection tried the target.
+func (k *PortForwarder) Breakers() []BreakerState {
+	k.breaker.mu.Lock()
+	defer k.breaker.mu.Unlock()
+
+	var out []BreakerState
+
+	for key, e := range k.breaker.targets {
+		if e.until.IsZero() {
+			continue
+		}
+
+		namespace, target, _ := strings.Cut(key, "/")
+		out = append(out, BreakerState{
+			Namespace: namespace,
+			Target:    target,
+			Failures:  e.failures,
+			Opened:    e.opened,
+			Until:     e.until,
+			LastError: e.err.Error(),
+		})
+	}
+
+	slices.SortFunc(out, func(a, b BreakerState) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Target, b.Target))
+	})
+
+	return out
+}
@@ -0,0 +1,92 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var b circuitBreaker
+
+	now := time.Now()
+	errDown := errors.New("connection refused")
+
+	if b.failed("cache/service/redis", errDown, now, 2, time.Minute) {
+		t.Fatal("failed() tripped below the threshold")
+	}
+
+	if err := b.allow("cache/service/redis", now, time.Minute); err != nil {
+		t.Fatalf("allow() below the threshold = %v", err)
+	}
+
+	if !b.failed("cache/service/redis", errDown, now, 2, time.Minute) {
+		t.Fatal("failed() didn't trip at the threshold")
+	}
+
+	if err := b.allow("cache/service/redis", now.Add(30*time.Second), time.Minute); !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, errDown) {
+		t.Errorf("allow() during cooldown = %v, want %v wrapping the last error", err, ErrCircuitOpen)
+	}
+
+	if err := b.allow("cache/service/other", now, time.Minute); err != nil {
+		t.Errorf("allow() of another target = %v", err)
+	}
+
+	// after the cooldown one trial goes through, the others fail fast.
+	trial := now.Add(time.Minute)
+
+	if err := b.allow("cache/service/redis", trial, time.Minute); err != nil {
+		t.Fatalf("allow() after cooldown = %v, want the trial through", err)
+	}
+
+	if err := b.allow("cache/service/redis", trial, time.Minute); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("allow() during trial = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	if !b.failed("cache/service/redis", errDown, trial, 2, time.Minute) {
+		t.Error("failed trial didn't trip the breaker again")
+	}
+
+	if !b.succeeded("cache/service/redis") {
+		t.Error("succeeded() = false for a tripped breaker")
+	}
+
+	if err := b.allow("cache/service/redis", trial, time.Minute); err != nil {
+		t.Errorf("allow() after success = %v", err)
+	}
+}
+
+func TestDialTarget_CircuitBreakerFailsFast(t *testing.T) {
+	var attempts int
+
+	fwd := &PortForwarder{
+		Name:             "production",
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			attempts++
+			return nil, errors.New("permission denied")
+		},
+	}
+
+	for range 2 {
+		if _, err := fwd.dialTarget(context.Background(), "mypod.ns.cluster:8080", directPodTarget); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("dialTarget() = %v before the breaker tripped", err)
+		}
+	}
+
+	_, err := fwd.dialTarget(context.Background(), "mypod.ns.cluster:8080", directPodTarget)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("dialTarget() = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2 (no dial while the breaker is open)", attempts)
+	}
+
+	breakers := fwd.Breakers()
+	if len(breakers) != 1 || breakers[0].Namespace != "ns" || breakers[0].Target != "pod/mypod" || breakers[0].Failures != 2 {
+		t.Errorf("Breakers() = %+v", breakers)
+	}
+}
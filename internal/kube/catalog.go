@@ -0,0 +1,162 @@
+package kube
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ServiceInfo describes a Service of a cluster.
+type ServiceInfo struct {
+	Cluster   string
+	Namespace string
+	Name      string
+	Ports     []ServicePortInfo
+}
+
+// Addr returns the podproxy hostname of the Service.
+func (s ServiceInfo) Addr() string {
+	return s.Name + "." + s.Namespace + "." + s.Cluster
+}
+
+// ServicePortInfo is a port of a Service.
+type ServicePortInfo struct {
+	Name     string
+	Port     int
+	Protocol string
+}
+
+// ServiceCatalog keeps the Services of every cluster in an informer cache,
+// so they can be listed without an API call per request.
+type ServiceCatalog struct {
+	Forwarders map[string]*PortForwarder
+
+	mu      sync.Mutex
+	listers map[string]serviceCache
+}
+
+type serviceCache struct {
+	lister corev1listers.ServiceLister
+	synced cache.InformerSynced
+}
+
+// Start starts a Service informer per cluster, which is restarted when the
+// cluster's client is rebuilt. The informers stop when ctx is cancelled.
+func (c *ServiceCatalog) Start(ctx context.Context) {
+	c.mu.Lock()
+	c.listers = make(map[string]serviceCache, len(c.Forwarders))
+	c.mu.Unlock()
+
+	for name, fwd := range c.Forwarders {
+		fwd.watchClients(ctx, func(ctx context.Context, clientset kubernetes.Interface) {
+			factory := informers.NewSharedInformerFactory(clientset, 0)
+			services := factory.Core().V1().Services()
+
+			c.mu.Lock()
+			c.listers[name] = serviceCache{
+				lister: services.Lister(),
+				synced: services.Informer().HasSynced,
+			}
+			c.mu.Unlock()
+
+			factory.Start(ctx.Done())
+		})
+	}
+}
+
+// Synced reports whether the Services of cluster have been listed.
+func (c *ServiceCatalog) Synced(cluster string) bool {
+	c.mu.Lock()
+	sc, ok := c.listers[cluster]
+	c.mu.Unlock()
+
+	return ok && sc.synced()
+}
+
+// Clusters returns the names of the clusters in the catalog, sorted.
+func (c *ServiceCatalog) Clusters() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.listers))
+	for name := range c.listers {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// Services returns the cached Services of cluster, optionally restricted to
+// namespace, sorted by namespace and name. Clusters whose cache has not
+// synced yet return nothing.
+func (c *ServiceCatalog) Services(cluster, namespace string) []ServiceInfo {
+	c.mu.Lock()
+	sc, ok := c.listers[cluster]
+	c.mu.Unlock()
+
+	if !ok || !sc.synced() {
+		return nil
+	}
+
+	var (
+		services []*corev1.Service
+		err      error
+	)
+
+	if namespace != "" {
+		services, err = sc.lister.Services(namespace).List(labels.Everything())
+	} else {
+		services, err = sc.lister.List(labels.Everything())
+	}
+
+	if err != nil {
+		return nil
+	}
+
+	infos := make([]ServiceInfo, 0, len(services))
+
+	for _, svc := range services {
+		info := ServiceInfo{Cluster: cluster, Namespace: svc.Namespace, Name: svc.Name}
+
+		for _, p := range svc.Spec.Ports {
+			info.Ports = append(info.Ports, ServicePortInfo{Name: p.Name, Port: int(p.Port), Protocol: string(p.Protocol)})
+		}
+
+		infos = append(infos, info)
+	}
+
+	slices.SortFunc(infos, func(a, b ServiceInfo) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+	})
+
+	return infos
+}
+
+// service returns the cached Service of cluster, or nil if it isn't cached
+// or the cache hasn't synced yet.
+func (c *ServiceCatalog) service(cluster, namespace, name string) *corev1.Service {
+	c.mu.Lock()
+	sc, ok := c.listers[cluster]
+	c.mu.Unlock()
+
+	if !ok || !sc.synced() {
+		return nil
+	}
+
+	svc, err := sc.lister.Services(namespace).Get(name)
+	if err != nil {
+		return nil
+	}
+
+	return svc
+}
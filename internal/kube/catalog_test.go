@@ -0,0 +1,68 @@
+package kube
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestServiceCatalog(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "cache"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "redis", Port: 6379, Protocol: corev1.ProtocolTCP}}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "postgres", Namespace: "db"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 5432, Protocol: corev1.ProtocolTCP}}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "cache"},
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	catalog := &ServiceCatalog{Forwarders: map[string]*PortForwarder{"production": {Name: "production", Clientset: clientset}}}
+	catalog.Start(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !catalog.Synced("production") {
+		if time.Now().After(deadline) {
+			t.Fatal("catalog did not sync")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	services := catalog.Services("production", "")
+	if len(services) != 3 {
+		t.Fatalf("Services() returned %d services, want 3", len(services))
+	}
+
+	if got := services[0].Addr() + " " + services[1].Addr() + " " + services[2].Addr(); got != "api.cache.production redis.cache.production postgres.db.production" {
+		t.Errorf("Services() order = %s", got)
+	}
+
+	if p := services[1].Ports; len(p) != 1 || p[0].Port != 6379 || p[0].Name != "redis" || p[0].Protocol != "TCP" {
+		t.Errorf("redis ports = %+v", p)
+	}
+
+	if got := catalog.Services("production", "db"); len(got) != 1 || got[0].Name != "postgres" {
+		t.Errorf("Services(db) = %+v, want postgres", got)
+	}
+
+	if got := catalog.Services("staging", ""); got != nil {
+		t.Errorf("Services(staging) = %+v, want nil", got)
+	}
+
+	if got := catalog.Suggest("production", "db", "postgress"); !slices.Equal(got, []string{"postgres.db.production"}) {
+		t.Errorf("Suggest(postgress.db) = %v, want [postgres.db.production]", got)
+	}
+}
@@ -2,23 +2,56 @@ package kube
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
 	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
+// ClientOptions tunes the clients built by NewKubeClient.
+type ClientOptions struct {
+	// QPS and Burst override client-go's default API rate limits when non-zero.
+	QPS   float32
+	Burst int
+	// RateLimiter, if set, is used instead of a per-client limiter derived
+	// from QPS and Burst. It may be shared between clusters.
+	RateLimiter flowcontrol.RateLimiter
+
+	// TLS overrides applied on top of the kubeconfig. CAData takes precedence
+	// over CAFile; Insecure clears any configured certificate authority.
+	CAFile     string
+	CAData     []byte
+	ServerName string
+	Insecure   bool
+
+	// ProxyURL, if set, replaces the kubeconfig's proxy-url as the proxy API
+	// requests and port-forwards are sent through: an http, https or socks5
+	// URL, or ProxyDirect for none. Without either, the HTTPS_PROXY and
+	// NO_PROXY environment variables apply.
+	ProxyURL string
+
+	// Vault, if set, replaces the kubeconfig's credentials with service
+	// account tokens issued by Vault.
+	Vault *VaultCredentials
+}
+
 // NewKubeClient builds a *rest.Config and *kubernetes.Clientset from the given
 // kubeconfig path and optional context. If kubeconfigPath is empty, it falls
 // back to the default location (~/.kube/config) or in-cluster config.
 // If kubeContext is empty, the kubeconfig's current-context is used.
-func NewKubeClient(kubeconfigPath, kubeContext string) (*rest.Config, *kubernetes.Clientset, error) {
+func NewKubeClient(kubeconfigPath, kubeContext string, opts ClientOptions) (*rest.Config, *kubernetes.Clientset, error) {
 	if kubeconfigPath == "" {
 		kubeconfigPath = defaultKubeconfig()
 	}
@@ -37,6 +70,44 @@ func NewKubeClient(kubeconfigPath, kubeContext string) (*rest.Config, *kubernete
 		}
 	}
 
+	return newClient(config, opts)
+}
+
+// NewInClusterClient builds a *rest.Config and *kubernetes.Clientset for the
+// cluster podproxy runs in, authenticated with the pod's service account.
+func NewInClusterClient(opts ClientOptions) (*rest.Config, *kubernetes.Clientset, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading in-cluster config: %w", err)
+	}
+
+	return newClient(config, opts)
+}
+
+// newClient applies opts to config and creates its clientset.
+func newClient(config *rest.Config, opts ClientOptions) (*rest.Config, *kubernetes.Clientset, error) {
+	if opts.QPS != 0 {
+		config.QPS = opts.QPS
+	}
+
+	if opts.Burst != 0 {
+		config.Burst = opts.Burst
+	}
+
+	if opts.RateLimiter != nil {
+		config.RateLimiter = opts.RateLimiter
+	}
+
+	applyTLSOverrides(config, opts)
+
+	if err := applyProxyOverride(config, opts.ProxyURL); err != nil {
+		return nil, nil, err
+	}
+
+	if opts.Vault != nil {
+		opts.Vault.apply(config)
+	}
+
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, nil, fmt.Errorf("creating kubernetes client: %w", err)
@@ -45,10 +116,34 @@ func NewKubeClient(kubeconfigPath, kubeContext string) (*rest.Config, *kubernete
 	return config, clientset, nil
 }
 
+// Service resolution failures that say nothing about the API server's health.
+// They are cached by PortForwarder.NegativeCacheTTL.
+var (
+	// ErrServiceNotFound means the service has no EndpointSlices, i.e. it
+	// doesn't exist or has no selector.
+	ErrServiceNotFound = errors.New("service not found")
+	// ErrNoReadyEndpoints means the service exists but none of its pods is
+	// ready, e.g. during a restart.
+	ErrNoReadyEndpoints = errors.New("no ready pod endpoints")
+)
+
 // ResolveServiceToPod resolves a Kubernetes service to the name of its first
 // ready pod endpoint. This is used when the SOCKS5 destination is a service
 // rather than a direct pod address.
-func ResolveServiceToPod(ctx context.Context, clientset *kubernetes.Clientset, namespace, serviceName string) (string, error) {
+func ResolveServiceToPod(ctx context.Context, clientset kubernetes.Interface, namespace, serviceName string) (string, error) {
+	pods, err := ResolveServicePods(ctx, clientset, namespace, serviceName)
+	if err != nil {
+		return "", err
+	}
+
+	return pods[0], nil
+}
+
+// ResolveServicePods returns the names of the ready pod endpoints of a
+// Kubernetes service, in the order the API lists them, or an error if there
+// are none. Clusters that don't serve EndpointSlices, or where they aren't
+// readable, are resolved via the core/v1 Endpoints API.
+func ResolveServicePods(ctx context.Context, clientset kubernetes.Interface, namespace, serviceName string) ([]string, error) {
 	// apply a default timeout when the caller hasn't set a deadline
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
@@ -57,35 +152,149 @@ func ResolveServiceToPod(ctx context.Context, clientset *kubernetes.Clientset, n
 		defer cancel()
 	}
 
-	slices, err := clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+	list, err := clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
 		LabelSelector: discoveryv1.LabelServiceName + "=" + serviceName,
 	})
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		return resolveServiceViaEndpoints(ctx, clientset, namespace, serviceName)
+	}
+
 	if err != nil {
-		return "", fmt.Errorf("listing endpoint slices for service %s/%s: %w", namespace, serviceName, err)
+		return nil, fmt.Errorf("listing endpoint slices for service %s/%s: %w", namespace, serviceName, err)
 	}
 
-	for _, slice := range slices.Items {
-		for _, ep := range slice.Endpoints {
-			// nil Ready means the endpoint is ready per the API spec
-			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
-				continue
-			}
+	if len(list.Items) == 0 {
+		return nil, externalNameOr(ctx, clientset, namespace, serviceName, fmt.Errorf("%w: %s/%s has no endpoint slices", ErrServiceNotFound, namespace, serviceName))
+	}
 
-			if ep.Conditions.Serving != nil && !*ep.Conditions.Serving {
-				continue
-			}
+	var pods []string
 
-			if ep.Conditions.Terminating != nil && *ep.Conditions.Terminating {
-				continue
-			}
+	for _, slice := range list.Items {
+		pods = appendReadyPods(pods, slice.Endpoints)
+	}
+
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("%w found for service %s/%s", ErrNoReadyEndpoints, namespace, serviceName)
+	}
+
+	return pods, nil
+}
 
-			if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
-				return ep.TargetRef.Name, nil
+// appendReadyPods appends the pods of the ready endpoints that aren't in
+// pods yet.
+func appendReadyPods(pods []string, endpoints []discoveryv1.Endpoint) []string {
+	for _, ep := range endpoints {
+		// nil Ready means the endpoint is ready per the API spec
+		if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+			continue
+		}
+
+		if ep.Conditions.Serving != nil && !*ep.Conditions.Serving {
+			continue
+		}
+
+		if ep.Conditions.Terminating != nil && *ep.Conditions.Terminating {
+			continue
+		}
+
+		// dual-stack services list each pod in a slice per address family.
+		if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" && !slices.Contains(pods, ep.TargetRef.Name) {
+			pods = append(pods, ep.TargetRef.Name)
+		}
+	}
+
+	return pods
+}
+
+// resolveServiceViaEndpoints resolves a service from its core/v1 Endpoints
+// object, for clusters without EndpointSlice access.
+func resolveServiceViaEndpoints(ctx context.Context, clientset kubernetes.Interface, namespace, serviceName string) ([]string, error) {
+	//nolint:staticcheck // Endpoints is deprecated, but the only option where EndpointSlices aren't readable.
+	endpoints, err := clientset.CoreV1().Endpoints(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, externalNameOr(ctx, clientset, namespace, serviceName, fmt.Errorf("%w: %s/%s has no endpoints", ErrServiceNotFound, namespace, serviceName))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("getting endpoints for service %s/%s: %w", namespace, serviceName, err)
+	}
+
+	var pods []string
+
+	// Addresses only lists ready endpoints; NotReadyAddresses are skipped.
+	for _, subset := range endpoints.Subsets {
+		for _, addr := range subset.Addresses {
+			if addr.TargetRef != nil && addr.TargetRef.Kind == "Pod" && !slices.Contains(pods, addr.TargetRef.Name) {
+				pods = append(pods, addr.TargetRef.Name)
 			}
 		}
 	}
 
-	return "", fmt.Errorf("no ready pod endpoints found for service %s/%s", namespace, serviceName)
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("%w found for service %s/%s", ErrNoReadyEndpoints, namespace, serviceName)
+	}
+
+	return pods, nil
+}
+
+// applyTLSOverrides replaces the kubeconfig's TLS verification settings with
+// the ones from opts, leaving client certificates untouched.
+func applyTLSOverrides(config *rest.Config, opts ClientOptions) {
+	switch {
+	case len(opts.CAData) > 0:
+		config.CAData = opts.CAData
+		config.CAFile = ""
+	case opts.CAFile != "":
+		config.CAFile = opts.CAFile
+		config.CAData = nil
+	}
+
+	if opts.ServerName != "" {
+		config.ServerName = opts.ServerName
+	}
+
+	if opts.Insecure {
+		config.Insecure = true
+		config.CAFile = ""
+		config.CAData = nil
+	}
+}
+
+// ProxyDirect as ClientOptions.ProxyURL connects to the API server without a
+// proxy, even if the kubeconfig or the environment names one.
+const ProxyDirect = "direct"
+
+// applyProxyOverride replaces the proxy of config with proxyURL, if set.
+func applyProxyOverride(config *rest.Config, proxyURL string) error {
+	switch proxyURL {
+	case "":
+		return nil
+	case ProxyDirect:
+		config.Proxy = func(*http.Request) (*url.URL, error) { return nil, nil }
+		return nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL: %w", err)
+	}
+
+	config.Proxy = http.ProxyURL(u)
+
+	return nil
+}
+
+// ProxyFor returns the proxy requests with config are sent through to the
+// API server: the kubeconfig's proxy-url or its override, or else the one
+// the environment names for the server. It returns an empty string for
+// direct connections.
+func ProxyFor(config *rest.Config) string {
+	_, proxyURL, err := apiServerAddr(config)
+	if err != nil || proxyURL == nil {
+		return ""
+	}
+
+	return proxyURL.Redacted()
 }
 
 func defaultKubeconfig() string {
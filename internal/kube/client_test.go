@@ -0,0 +1,168 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://production.example.com
+  name: production
+contexts:
+- context:
+    cluster: production
+    user: production
+  name: production
+current-context: production
+users:
+- name: production
+  user:
+    token: fake-token
+`
+
+func writeTestKubeconfig(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatalf("writing kubeconfig: %v", err)
+	}
+
+	return path
+}
+
+func TestNewKubeClientRateLimits(t *testing.T) {
+	cfg, _, err := NewKubeClient(writeTestKubeconfig(t), "production", ClientOptions{QPS: 42, Burst: 84})
+	if err != nil {
+		t.Fatalf("NewKubeClient() error: %v", err)
+	}
+
+	if cfg.QPS != 42 || cfg.Burst != 84 {
+		t.Errorf("QPS/Burst = %v/%d, want 42/84", cfg.QPS, cfg.Burst)
+	}
+}
+
+func TestApplyTLSOverrides(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       ClientOptions
+		wantCAFile string
+		wantCAData string
+		wantServer string
+		wantInsec  bool
+	}{
+		{
+			name:       "no overrides keeps kubeconfig",
+			opts:       ClientOptions{},
+			wantCAData: "cert",
+		},
+		{
+			name:       "ca file replaces ca data",
+			opts:       ClientOptions{CAFile: "/etc/ca.pem"},
+			wantCAFile: "/etc/ca.pem",
+		},
+		{
+			name:       "ca data and server name",
+			opts:       ClientOptions{CAData: []byte("other"), ServerName: "api.internal"},
+			wantCAData: "other",
+			wantServer: "api.internal",
+		},
+		{
+			name:      "insecure clears ca",
+			opts:      ClientOptions{Insecure: true},
+			wantInsec: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: []byte("cert")}}
+			applyTLSOverrides(cfg, tt.opts)
+
+			if cfg.CAFile != tt.wantCAFile || string(cfg.CAData) != tt.wantCAData ||
+				cfg.ServerName != tt.wantServer || cfg.Insecure != tt.wantInsec {
+				t.Errorf("TLS config = {CAFile:%q CAData:%q ServerName:%q Insecure:%v}",
+					cfg.CAFile, cfg.CAData, cfg.ServerName, cfg.Insecure)
+			}
+		})
+	}
+}
+
+func TestNewKubeClientProxy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	kubeconfig := strings.Replace(testKubeconfig, "    server: https://production.example.com\n",
+		"    server: https://production.example.com\n    proxy-url: http://proxy.corp:3128\n", 1)
+
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatalf("writing kubeconfig: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		proxyURL string
+		want     string
+	}{
+		{name: "kubeconfig proxy-url", want: "http://proxy.corp:3128"},
+		{name: "override", proxyURL: "socks5://127.0.0.1:1080", want: "socks5://127.0.0.1:1080"},
+		{name: "direct", proxyURL: ProxyDirect, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := NewKubeClient(path, "production", ClientOptions{ProxyURL: tt.proxyURL})
+			if err != nil {
+				t.Fatalf("NewKubeClient() error: %v", err)
+			}
+
+			if got := ProxyFor(cfg); got != tt.want {
+				t.Errorf("ProxyFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+//nolint:staticcheck // the Endpoints API is deprecated but still served.
+func TestResolveServiceToPodEndpointsFallback(t *testing.T) {
+	clientset := fake.NewClientset(&corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "db"},
+		Subsets: []corev1.EndpointSubset{{
+			NotReadyAddresses: []corev1.EndpointAddress{{TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "redis-1"}}},
+			Addresses:         []corev1.EndpointAddress{{TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "redis-0"}}},
+		}},
+	})
+
+	// EndpointSlices are not readable with the proxy's RBAC.
+	clientset.PrependReactor("list", "endpointslices", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "discovery.k8s.io", Resource: "endpointslices"}, "", errors.New("rbac"))
+	})
+
+	pod, err := ResolveServiceToPod(context.Background(), clientset, "db", "redis")
+	if err != nil {
+		t.Fatalf("ResolveServiceToPod() error: %v", err)
+	}
+
+	if pod != "redis-0" {
+		t.Errorf("pod = %q, want the ready endpoint redis-0", pod)
+	}
+
+	_, err = ResolveServiceToPod(context.Background(), clientset, "db", "missing")
+	if !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("error for missing service = %v, want ErrServiceNotFound", err)
+	}
+}
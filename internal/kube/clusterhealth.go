@@ -0,0 +1,158 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/entwico/podproxy/internal/metrics"
+)
+
+// ErrClusterUnreachable is wrapped by the errors of connections failed fast
+// because the last health check couldn't reach the cluster's API server.
+var ErrClusterUnreachable = errors.New("cluster unreachable")
+
+// ClusterHealth is the reachability of a cluster's API server.
+type ClusterHealth struct {
+	Cluster   string
+	Reachable bool
+	// Since is when the cluster last turned reachable or unreachable, zero
+	// if it never changed.
+	Since time.Time
+	// Checked is when a HealthChecker last probed the API server, zero if it
+	// never did, and Latency how long the probe took.
+	Checked   time.Time
+	Latency   time.Duration
+	LastError string
+}
+
+// HealthChecker requests /version from the API server of each forwarder's
+// cluster every Interval, marking clusters that don't answer unreachable and
+// those that do reachable again. While a cluster is unreachable, new
+// connections to it fail fast instead of spending the retry loop on an API
+// server that is down.
+type HealthChecker struct {
+	Forwarders []*PortForwarder
+	Interval   time.Duration
+	// Timeout is how long a probe may take before the API server counts as
+	// unreachable. Zero means Interval.
+	Timeout time.Duration
+
+	// test override — if nil, PortForwarder.Probe is used.
+	probe func(ctx context.Context, k *PortForwarder) ProbeResult
+}
+
+// Run checks the clusters right away and then every Interval until ctx is
+// done. Connections only fail fast while Run is running.
+func (h *HealthChecker) Run(ctx context.Context) {
+	for _, k := range h.Forwarders {
+		k.healthChecked.Store(true)
+		defer k.healthChecked.Store(false)
+	}
+
+	ticker := time.NewTicker(h.Interval)
+	defer ticker.Stop()
+
+	for {
+		h.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check probes the API servers of all clusters in parallel, so one that
+// doesn't answer doesn't hold up the others.
+func (h *HealthChecker) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, k := range h.Forwarders {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			h.check(ctx, k)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// check probes the API server of k's cluster and records the outcome.
+func (h *HealthChecker) check(ctx context.Context, k *PortForwarder) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = h.Interval
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	probe := h.probe
+	if probe == nil {
+		probe = func(ctx context.Context, k *PortForwarder) ProbeResult { return k.Probe(ctx) }
+	}
+
+	res := probe(ctx, k)
+
+	// shutting down says nothing about the cluster.
+	if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return
+	}
+
+	k.reach.Lock()
+	k.probed = time.Now()
+	k.probeLatency = res.Latency
+	k.reach.Unlock()
+
+	// any answer, even an authentication error, means the API server is
+	// reachable.
+	if res.Err != nil && (isUnreachableError(res.Err) || errors.Is(res.Err, context.DeadlineExceeded)) {
+		k.unreachableFailed(res.Err)
+		metrics.ClusterReachable.WithLabelValues(k.Name).Set(0)
+
+		return
+	}
+
+	k.reachable()
+	metrics.ClusterReachable.WithLabelValues(k.Name).Set(1)
+}
+
+// unreachableErr returns an error wrapping ErrClusterUnreachable if the
+// cluster is unreachable, or nil.
+func (k *PortForwarder) unreachableErr() error {
+	k.reach.Lock()
+	defer k.reach.Unlock()
+
+	if !k.unreachable {
+		return nil
+	}
+
+	return fmt.Errorf("%w: cluster %s: %w", ErrClusterUnreachable, k.Name, k.reachErr)
+}
+
+// Reachability returns whether the cluster's API server is reachable, as
+// last seen by a connection or a HealthChecker.
+func (k *PortForwarder) Reachability() ClusterHealth {
+	k.reach.Lock()
+	defer k.reach.Unlock()
+
+	h := ClusterHealth{
+		Cluster:   k.Name,
+		Reachable: !k.unreachable,
+		Since:     k.reachSince,
+		Checked:   k.probed,
+		Latency:   k.probeLatency,
+	}
+
+	if k.reachErr != nil {
+		h.LastError = k.reachErr.Error()
+	}
+
+	return h
+}
@@ -0,0 +1,118 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckerFailsFastWhileUnreachable(t *testing.T) {
+	var dials int
+
+	fwd := &PortForwarder{
+		Name: "production",
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			dials++
+			return newTestStreamConn(), nil
+		},
+	}
+	fwd.healthChecked.Store(true)
+
+	probeErr := error(&net.DNSError{Err: "no such host", Name: "api.production.example.com", IsNotFound: true})
+
+	checker := &HealthChecker{
+		Forwarders: []*PortForwarder{fwd},
+		Interval:   time.Minute,
+		probe: func(_ context.Context, k *PortForwarder) ProbeResult {
+			return ProbeResult{Cluster: k.Name, Reachable: probeErr == nil, Latency: time.Millisecond, Err: probeErr}
+		},
+	}
+
+	target := Target{Namespace: "db", PodName: "postgres-0", Port: 5432}
+
+	checker.Check(context.Background())
+
+	if h := fwd.Reachability(); h.Reachable || h.Checked.IsZero() || h.LastError == "" {
+		t.Fatalf("Reachability() = %+v after a failed probe, want unreachable", h)
+	}
+
+	if _, err := fwd.dialTarget(context.Background(), "postgres-0.postgres.db.production:5432", target); !errors.Is(err, ErrClusterUnreachable) {
+		t.Fatalf("dialTarget error = %v, want ErrClusterUnreachable", err)
+	}
+
+	if dials != 0 {
+		t.Fatalf("dialed %d times while the cluster was unreachable, want 0", dials)
+	}
+
+	probeErr = nil
+	checker.Check(context.Background())
+
+	if h := fwd.Reachability(); !h.Reachable || h.LastError != "" || h.Since.IsZero() {
+		t.Fatalf("Reachability() = %+v after a successful probe, want reachable", h)
+	}
+
+	conn, err := fwd.dialTarget(context.Background(), "postgres-0.postgres.db.production:5432", target)
+	if err != nil {
+		t.Fatalf("dialTarget: %v", err)
+	}
+	conn.Close()
+}
+
+func TestHealthCheckerAnswerMeansReachable(t *testing.T) {
+	fwd := &PortForwarder{Name: "production"}
+
+	checker := &HealthChecker{
+		Forwarders: []*PortForwarder{fwd},
+		Interval:   time.Minute,
+		probe: func(_ context.Context, k *PortForwarder) ProbeResult {
+			return ProbeResult{Cluster: k.Name, Err: errors.New("Unauthorized")}
+		},
+	}
+
+	checker.Check(context.Background())
+
+	if h := fwd.Reachability(); !h.Reachable {
+		t.Errorf("Reachability() = %+v after the API server answered, want reachable", h)
+	}
+}
+
+func TestHealthCheckerTimeout(t *testing.T) {
+	fwd := &PortForwarder{Name: "production"}
+
+	checker := &HealthChecker{
+		Forwarders: []*PortForwarder{fwd},
+		Interval:   time.Minute,
+		Timeout:    10 * time.Millisecond,
+		probe: func(ctx context.Context, k *PortForwarder) ProbeResult {
+			<-ctx.Done()
+			return ProbeResult{Cluster: k.Name, Err: ctx.Err()}
+		},
+	}
+
+	checker.Check(context.Background())
+
+	if fwd.Reachability().Reachable {
+		t.Error("cluster reachable after its probe timed out")
+	}
+}
+
+func TestHealthCheckerDialsWithoutRun(t *testing.T) {
+	fwd := &PortForwarder{
+		Name: "production",
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return newTestStreamConn(), nil
+		},
+	}
+
+	// a cluster marked unreachable by a failed connection is still dialed
+	// without a running health checker to mark it reachable again.
+	fwd.unreachableFailed(&net.DNSError{Err: "no such host", Name: "api.production.example.com", IsNotFound: true})
+
+	conn, err := fwd.dialTarget(context.Background(), "postgres-0.postgres.db.production:5432", Target{Namespace: "db", PodName: "postgres-0", Port: 5432})
+	if err != nil {
+		t.Fatalf("dialTarget: %v", err)
+	}
+	conn.Close()
+}
@@ -18,8 +18,13 @@ type StreamConn struct {
 	errorStream  httpstream.Stream
 	spdyConn     httpstream.Connection
 	remoteTarget string
+	protocol     PortForwardProtocol
+	// release, if set, ends the forward on a pooled connection, which is
+	// then left open for other forwards.
+	release func(healthy bool)
 
 	closeOnce   sync.Once
+	closed      atomic.Bool
 	remoteErrMu sync.Mutex
 	remoteErr   error
 	errDone     chan struct{}
@@ -27,6 +32,8 @@ type StreamConn struct {
 	createdAt    time.Time
 	bytesRead    atomic.Int64
 	bytesWritten atomic.Int64
+	// lastActive is the time of the last read or write in Unix nanoseconds.
+	lastActive atomic.Int64
 }
 
 // NewStreamConn creates a StreamConn that reads/writes via the data stream and
@@ -40,6 +47,7 @@ func NewStreamConn(data, errStream httpstream.Stream, conn httpstream.Connection
 		errDone:      make(chan struct{}),
 		createdAt:    time.Now(),
 	}
+	sc.lastActive.Store(sc.createdAt.UnixNano())
 	go sc.monitorErrors()
 
 	return sc
@@ -48,6 +56,7 @@ func NewStreamConn(data, errStream httpstream.Stream, conn httpstream.Connection
 func (sc *StreamConn) Read(b []byte) (int, error) {
 	n, err := sc.dataStream.Read(b)
 	sc.bytesRead.Add(int64(n))
+	sc.touch(n)
 
 	if err == io.EOF {
 		// wait for the error monitor to finish, with a timeout to prevent
@@ -57,12 +66,10 @@ func (sc *StreamConn) Read(b []byte) (int, error) {
 		case <-time.After(5 * time.Second):
 			return n, err
 		}
+	}
 
-		sc.remoteErrMu.Lock()
-		remoteErr := sc.remoteErr
-		sc.remoteErrMu.Unlock()
-
-		if remoteErr != nil {
+	if err != nil {
+		if remoteErr := sc.RemoteErr(); remoteErr != nil {
 			return n, remoteErr
 		}
 	}
@@ -73,18 +80,66 @@ func (sc *StreamConn) Read(b []byte) (int, error) {
 func (sc *StreamConn) Write(b []byte) (int, error) {
 	n, err := sc.dataStream.Write(b)
 	sc.bytesWritten.Add(int64(n))
+	sc.touch(n)
+
+	if err != nil {
+		if remoteErr := sc.RemoteErr(); remoteErr != nil {
+			return n, remoteErr
+		}
+	}
 
 	return n, err
 }
 
+// Protocol returns the port-forward protocol the connection negotiated, or
+// an empty string if unknown.
+func (sc *StreamConn) Protocol() PortForwardProtocol {
+	return sc.protocol
+}
+
+// RemoteErr returns the error reported by the kubelet on the error stream,
+// e.g. that the pod isn't running, or nil.
+func (sc *StreamConn) RemoteErr() error {
+	sc.remoteErrMu.Lock()
+	defer sc.remoteErrMu.Unlock()
+
+	return sc.remoteErr
+}
+
+// alive reports whether the forward can still carry data: its port-forward
+// connection is open and the kubelet reported no error.
+func (sc *StreamConn) alive() bool {
+	select {
+	case <-sc.spdyConn.CloseChan():
+		return false
+	default:
+	}
+
+	return sc.RemoteErr() == nil
+}
+
 func (sc *StreamConn) BytesRead() int64        { return sc.bytesRead.Load() }
 func (sc *StreamConn) BytesWritten() int64     { return sc.bytesWritten.Load() }
 func (sc *StreamConn) Duration() time.Duration { return time.Since(sc.createdAt) }
 
+// Idle returns how long no data was read or written.
+func (sc *StreamConn) Idle() time.Duration {
+	return time.Since(time.Unix(0, sc.lastActive.Load()))
+}
+
+// touch records activity when n bytes were transferred.
+func (sc *StreamConn) touch(n int) {
+	if n > 0 {
+		sc.lastActive.Store(time.Now().UnixNano())
+	}
+}
+
 func (sc *StreamConn) Close() error {
 	var err error
 
 	sc.closeOnce.Do(func() {
+		sc.closed.Store(true)
+
 		// close the data stream first so the remote side sees EOF.
 		err = sc.dataStream.Close()
 		// explicitly close the error stream before the SPDY connection to
@@ -92,6 +147,12 @@ func (sc *StreamConn) Close() error {
 		if closeErr := sc.errorStream.Close(); err == nil {
 			err = closeErr
 		}
+		if sc.release != nil {
+			sc.spdyConn.RemoveStreams(sc.dataStream, sc.errorStream)
+			sc.release(sc.RemoteErr() == nil)
+
+			return
+		}
 		// close the SPDY connection to release remaining resources and its
 		// monitoring goroutine, preventing a connection and goroutine leak.
 		sc.spdyConn.Close()
@@ -115,24 +176,54 @@ func (sc *StreamConn) SetDeadline(_ time.Time) error      { return nil }
 func (sc *StreamConn) SetReadDeadline(_ time.Time) error  { return nil }
 func (sc *StreamConn) SetWriteDeadline(_ time.Time) error { return nil }
 
+// monitorErrors reads the error stream until it ends. The kubelet only
+// writes to it when forwarding failed, e.g. because the pod isn't running,
+// so the first message resets the data stream: reads and writes blocked on
+// it return the message right away instead of when the API server gives up
+// on the stream.
 func (sc *StreamConn) monitorErrors() {
 	defer close(sc.errDone)
 
 	// cap the read to prevent unbounded memory usage from a large error response.
 	const maxErrorBytes = 4096
 
-	buf, err := io.ReadAll(io.LimitReader(sc.errorStream, maxErrorBytes))
+	var (
+		msg   []byte
+		chunk = make([]byte, 512)
+	)
 
-	sc.remoteErrMu.Lock()
-	defer sc.remoteErrMu.Unlock()
+	for len(msg) < maxErrorBytes {
+		n, err := sc.errorStream.Read(chunk[:min(len(chunk), maxErrorBytes-len(msg))])
+		if n > 0 {
+			msg = append(msg, chunk[:n]...)
+			sc.setRemoteErr(newRemoteError(string(msg)))
+		}
 
-	if err != nil {
-		sc.remoteErr = fmt.Errorf("reading error stream: %w", err)
-		return
+		if err == io.EOF {
+			return
+		}
+
+		if err != nil {
+			// neither a failed read after the message nor one caused by
+			// closing the connection is the remote's error.
+			if len(msg) == 0 && !sc.closed.Load() {
+				sc.setRemoteErr(fmt.Errorf("reading error stream: %w", err))
+			}
+
+			return
+		}
 	}
+}
+
+// setRemoteErr records err, resetting the data stream on the first one.
+func (sc *StreamConn) setRemoteErr(err error) {
+	sc.remoteErrMu.Lock()
+	first := sc.remoteErr == nil
+	sc.remoteErr = err
+	sc.remoteErrMu.Unlock()
 
-	if len(buf) > 0 {
-		sc.remoteErr = fmt.Errorf("remote error: %s", string(buf))
+	if first {
+		_ = sc.dataStream.Reset()
 	}
 }
 
@@ -142,5 +233,79 @@ type stubAddr string
 func (s stubAddr) Network() string { return "spdy" }
 func (s stubAddr) String() string  { return string(s) }
 
-// verify StreamConn satisfies net.Conn.
-var _ net.Conn = (*StreamConn)(nil)
+// tunnel is an established connection to a cluster target, as tracked by
+// logOnCloseConn: a port-forward StreamConn or a metered netConn.
+type tunnel interface {
+	net.Conn
+	BytesRead() int64
+	BytesWritten() int64
+	Duration() time.Duration
+	Idle() time.Duration
+	RemoteErr() error
+	alive() bool
+}
+
+// netConn meters a connection to a cluster target that isn't port-forwarded,
+// e.g. the tunnel to the API server, like a StreamConn.
+type netConn struct {
+	net.Conn
+
+	createdAt    time.Time
+	bytesRead    atomic.Int64
+	bytesWritten atomic.Int64
+	// lastActive is the time of the last read or write in Unix nanoseconds.
+	lastActive atomic.Int64
+}
+
+func newNetConn(conn net.Conn) *netConn {
+	nc := &netConn{Conn: conn, createdAt: time.Now()}
+	nc.lastActive.Store(nc.createdAt.UnixNano())
+
+	return nc
+}
+
+func (nc *netConn) Read(b []byte) (int, error) {
+	n, err := nc.Conn.Read(b)
+	nc.bytesRead.Add(int64(n))
+	nc.touch(n)
+
+	return n, err
+}
+
+func (nc *netConn) Write(b []byte) (int, error) {
+	n, err := nc.Conn.Write(b)
+	nc.bytesWritten.Add(int64(n))
+	nc.touch(n)
+
+	return n, err
+}
+
+func (nc *netConn) BytesRead() int64        { return nc.bytesRead.Load() }
+func (nc *netConn) BytesWritten() int64     { return nc.bytesWritten.Load() }
+func (nc *netConn) Duration() time.Duration { return time.Since(nc.createdAt) }
+
+// Idle returns how long no data was read or written.
+func (nc *netConn) Idle() time.Duration {
+	return time.Since(time.Unix(0, nc.lastActive.Load()))
+}
+
+// touch records activity when n bytes were transferred.
+func (nc *netConn) touch(n int) {
+	if n > 0 {
+		nc.lastActive.Store(time.Now().UnixNano())
+	}
+}
+
+// RemoteErr returns nil: failures of plain connections are returned by
+// their reads and writes.
+func (nc *netConn) RemoteErr() error { return nil }
+
+// alive reports true, as a plain connection has no stream that dies
+// separately from it; it leaks only with its proxy client.
+func (nc *netConn) alive() bool { return true }
+
+// verify StreamConn and netConn satisfy tunnel.
+var (
+	_ tunnel = (*StreamConn)(nil)
+	_ tunnel = (*netConn)(nil)
+)
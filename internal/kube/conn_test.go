@@ -0,0 +1,163 @@
+package kube
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// pipeStream is an httpstream.Stream backed by one end of a net.Pipe.
+type pipeStream struct {
+	net.Conn
+}
+
+func (s pipeStream) Reset() error         { return s.Close() }
+func (s pipeStream) Headers() http.Header { return http.Header{} }
+func (s pipeStream) Identifier() uint32   { return 0 }
+
+// fakeConnection is a no-op httpstream.Connection.
+type fakeConnection struct {
+	closed chan bool
+}
+
+func (c *fakeConnection) CreateStream(http.Header) (httpstream.Stream, error) {
+	return nil, io.ErrClosedPipe
+}
+
+func (c *fakeConnection) Close() error {
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+
+	return nil
+}
+
+func (c *fakeConnection) CloseChan() <-chan bool             { return c.closed }
+func (c *fakeConnection) SetIdleTimeout(time.Duration)       {}
+func (c *fakeConnection) RemoveStreams(...httpstream.Stream) {}
+
+// newTestStreamConnPipes returns a StreamConn plus the remote ends of its data
+// and error streams.
+func newTestStreamConnPipes() (*StreamConn, net.Conn, net.Conn) {
+	dataLocal, dataRemote := net.Pipe()
+	errLocal, errRemote := net.Pipe()
+
+	sc := NewStreamConn(pipeStream{dataLocal}, pipeStream{errLocal}, &fakeConnection{closed: make(chan bool)}, "ns/pod:80")
+
+	return sc, dataRemote, errRemote
+}
+
+// newTestStreamConn returns a StreamConn whose remote side is never used.
+func newTestStreamConn() *StreamConn {
+	sc, _, _ := newTestStreamConnPipes()
+	return sc
+}
+
+func TestStreamConnRemoteErrorOnEOF(t *testing.T) {
+	sc, dataRemote, errRemote := newTestStreamConnPipes()
+	defer sc.Close()
+
+	go func() {
+		_, _ = errRemote.Write([]byte("unable to forward port"))
+		_ = errRemote.Close()
+		_ = dataRemote.Close()
+	}()
+
+	_, err := io.ReadAll(sc)
+	if err == nil || !strings.Contains(err.Error(), "unable to forward port") {
+		t.Fatalf("ReadAll() error = %v, want remote error", err)
+	}
+}
+
+func TestStreamConnCountsBytes(t *testing.T) {
+	sc, dataRemote, errRemote := newTestStreamConnPipes()
+	defer sc.Close()
+	defer errRemote.Close()
+
+	go func() {
+		buf := make([]byte, 5)
+		_, _ = io.ReadFull(dataRemote, buf)
+		_, _ = dataRemote.Write([]byte("pong!!"))
+	}()
+
+	if _, err := sc.Write([]byte("ping!")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(sc, buf); err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+
+	if sc.BytesWritten() != 5 || sc.BytesRead() != 6 {
+		t.Errorf("bytes written/read = %d/%d, want 5/6", sc.BytesWritten(), sc.BytesRead())
+	}
+}
+
+func TestStreamConnRemoteErrorAbortsRead(t *testing.T) {
+	sc, dataRemote, errRemote := newTestStreamConnPipes()
+	defer sc.Close()
+	defer dataRemote.Close()
+
+	// the data stream stays open: the read must not wait for it to end.
+	go func() {
+		_, _ = errRemote.Write([]byte("pod is not running"))
+	}()
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := sc.Read(make([]byte, 16))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "pod is not running") {
+			t.Fatalf("Read() error = %v, want remote error", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Read() still blocked after a remote error")
+	}
+
+	if _, err := sc.Write([]byte("x")); err == nil || !strings.Contains(err.Error(), "pod is not running") {
+		t.Errorf("Write() error = %v, want remote error", err)
+	}
+}
+
+func TestStreamConnCloseIsNoRemoteError(t *testing.T) {
+	sc, dataRemote, errRemote := newTestStreamConnPipes()
+	defer dataRemote.Close()
+	defer errRemote.Close()
+
+	sc.Close()
+	<-sc.errDone
+
+	if err := sc.RemoteErr(); err != nil {
+		t.Errorf("RemoteErr() after Close = %v, want nil", err)
+	}
+}
+
+func TestStreamConnClassifiesRemoteError(t *testing.T) {
+	sc, dataRemote, errRemote := newTestStreamConnPipes()
+	defer sc.Close()
+	defer dataRemote.Close()
+
+	go func() {
+		_, _ = errRemote.Write([]byte("dial tcp4 127.0.0.1:8080: connect: connection refused"))
+		_ = errRemote.Close()
+	}()
+
+	<-sc.errDone
+
+	if kind := RemoteErrorKind(sc.RemoteErr()); kind != RemotePortNotListening {
+		t.Errorf("RemoteErrorKind = %q, want %q", kind, RemotePortNotListening)
+	}
+}
@@ -1,54 +1,197 @@
 package kube
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
-	"syscall"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"k8s.io/apimachinery/pkg/util/httpstream"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/transport/spdy"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/history"
+	"github.com/entwico/podproxy/internal/metrics"
+	"github.com/entwico/podproxy/internal/proxyproto"
 )
 
 // ClusterDialer routes connections to the correct cluster's KubePortForwarder
 // based on the cluster name extracted from the DNS address.
 type ClusterDialer struct {
 	Forwarders map[string]*PortForwarder
+	// FakeIPs, if set, maps connections to assigned fake IPs back to the
+	// hostname they were handed out for.
+	FakeIPs *FakeIPPool
+	// Visibility, if set, restricts the clusters and namespaces that can be
+	// dialed.
+	Visibility *Visibility
+	// Routes adjust how passthrough addresses are dialed; the first match
+	// wins.
+	Routes []PassthroughRoute
+	// UserNamespace, if set, returns the default namespace of an
+	// authenticated proxy user, which replaces the cluster's default for
+	// addresses without one. An empty result keeps the cluster's default.
+	UserNamespace func(user string) string
+	// SessionAffinity, if set, sends the connections of a client to a
+	// Service to the same pod while it stays ready.
+	SessionAffinity *SessionAffinity
+	// Selectors maps virtual hostnames, <name>.<cluster> or
+	// <name>.<ns>.<cluster>, to the label selectors of the pods they dial.
+	Selectors map[string]SelectorTarget
+	// Listener is the address of the listener the dialer serves, which
+	// passthrough routes can be restricted to.
+	Listener string
+	// Logger and History, if set, log and record passthrough connections of
+	// labeled routes.
+	Logger  *slog.Logger
+	History history.Store
+
+	middleware []DialMiddleware
 }
 
 // DialContext routes the connection based on the destination address. If the
 // address matches a known cluster name, it dials via Kubernetes port-forwarding.
 // Otherwise it falls through to a direct TCP connection (passthrough).
 func (d *ClusterDialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
-	if cluster := d.clusterSuffix(addr); cluster != "" {
-		target, err := ParseTarget(addr)
+	addr, err := d.FakeIPs.Translate(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return chain(d.dial, d.middleware)(ctx, network, addr)
+}
+
+// dial routes a translated address, behind the middleware.
+func (d *ClusterDialer) dial(ctx context.Context, network string, addr string) (net.Conn, error) {
+	if cluster := d.cluster(addr); cluster != "" {
+		fwd, target, err := d.target(ctx, cluster, addr)
 		if err != nil {
 			return nil, err
 		}
 
-		fwd := d.Forwarders[cluster]
-		if fwd == nil {
-			return nil, fmt.Errorf("cluster %q not found in forwarders map", cluster)
-		}
+		return fwd.dialTarget(withAffinity(ctx, d.SessionAffinity), addr, target)
+	}
 
-		// fill in cluster's default namespace when not specified in the address.
-		if target.Namespace == "" {
-			target.Namespace = fwd.DefaultNamespace
+	// passthrough: address does not match any known cluster, dial directly.
+	conn, err := d.dialPassthrough(ctx, network, addr)
+
+	// a hostname that doesn't resolve may have a misspelled cluster name.
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		if s := d.suggestCluster(addr); s != "" {
+			err = fmt.Errorf("%w (did you mean %s?)", err, s)
 		}
+	}
 
-		return fwd.dialTarget(ctx, addr, target)
+	return conn, err
+}
+
+// CheckTarget makes the checks DialContext makes before dialing addr,
+// without dialing: the address must parse, its namespace be visible and the
+// cluster's access policy allow connections. Malformed cluster addresses
+// return an error wrapping ErrInvalidTarget. Passthrough addresses always
+// pass.
+func (d *ClusterDialer) CheckTarget(ctx context.Context, addr string) error {
+	addr, err := d.FakeIPs.Translate(addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTarget, err)
 	}
 
-	// passthrough: address does not match any known cluster, dial directly.
-	return (&net.Dialer{}).DialContext(ctx, network, addr)
+	cluster := d.cluster(addr)
+	if cluster == "" {
+		return nil
+	}
+
+	fwd, target, err := d.target(ctx, cluster, addr)
+	if err != nil {
+		return err
+	}
+
+	return fwd.checkPolicy(ctx, addr, target)
+}
+
+// IsClusterTarget reports whether addr is a well-formed address of a
+// cluster target, as opposed to a passthrough address.
+func (d *ClusterDialer) IsClusterTarget(addr string) bool {
+	cluster := d.cluster(addr)
+	if cluster == "" {
+		return false
+	}
+
+	if _, ok, err := parseBarePodIP(addr, cluster); ok {
+		return err == nil
+	}
+
+	_, err := ParseTarget(addr)
+
+	return err == nil
+}
+
+// target parses addr of cluster, filling in the default namespace, and
+// checks its visibility.
+func (d *ClusterDialer) target(ctx context.Context, cluster, addr string) (*PortForwarder, Target, error) {
+	// bare IPs only reach a cluster through its pod CIDRs.
+	target, ok, err := parseBarePodIP(addr, cluster)
+	if !ok {
+		target, err = ParseTarget(addr)
+	}
+
+	if err != nil {
+		return nil, Target{}, fmt.Errorf("%w: %w", ErrInvalidTarget, err)
+	}
+
+	fwd := d.Forwarders[cluster]
+	if fwd == nil {
+		return nil, Target{}, fmt.Errorf("cluster %q not found in forwarders map", cluster)
+	}
+
+	if sel, ok := selectorTarget(d.Selectors, addr, target); ok {
+		target = sel
+	}
+
+	target, err = fwd.resolvePodIP(ctx, target)
+	if err != nil {
+		return nil, Target{}, err
+	}
+
+	// fill in the user's or else the cluster's default namespace when not
+	// specified in the address. Nodes are cluster-scoped.
+	if target.Namespace == "" && target.Node == "" {
+		target.Namespace = cmp.Or(userNamespace(ctx, d.UserNamespace), fwd.DefaultNamespace)
+	}
+
+	if err := d.Visibility.checkTarget(cluster, target); err != nil {
+		return nil, Target{}, err
+	}
+
+	return fwd, target, nil
+}
+
+// cluster returns the cluster addr is dialed in: the one its hostname ends
+// in, or the one whose pod CIDRs contain its IP. Returns empty string for
+// passthrough addresses.
+func (d *ClusterDialer) cluster(addr string) string {
+	if cluster := d.clusterSuffix(addr); cluster != "" {
+		return cluster
+	}
+
+	return d.podNetworkCluster(addr)
 }
 
 // clusterSuffix extracts the cluster name from addr if it matches a known
@@ -75,62 +218,531 @@ func (d *ClusterDialer) clusterSuffix(addr string) string {
 	return ""
 }
 
-// ensure ClusterDialer.DialContext matches the expected signature.
-var _ func(context.Context, string, string) (net.Conn, error) = (*ClusterDialer)(nil).DialContext
+// PinnedDialer routes every connection to a single cluster, for listeners
+// whose clients address targets without the cluster segment. There is no
+// passthrough.
+type PinnedDialer struct {
+	Forwarder *PortForwarder
+	// Namespace, if set, replaces the cluster's default namespace for
+	// addresses without one.
+	Namespace string
+	// FakeIPs, if set, maps connections to assigned fake IPs back to the
+	// hostname they were handed out for.
+	FakeIPs *FakeIPPool
+	// Visibility, if set, restricts the namespaces that can be dialed.
+	Visibility *Visibility
+	// UserNamespace, if set, returns the default namespace of an
+	// authenticated proxy user, used for addresses without one when
+	// Namespace is empty.
+	UserNamespace func(user string) string
+	// SessionAffinity, if set, sends the connections of a client to a
+	// Service to the same pod while it stays ready.
+	SessionAffinity *SessionAffinity
+
+	middleware []DialMiddleware
+}
+
+// DialContext dials addr in the pinned cluster via port-forwarding.
+func (d *PinnedDialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	addr, err := d.FakeIPs.Translate(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return chain(d.dial, d.middleware)(ctx, network, addr)
+}
+
+// dial dials a translated address, behind the middleware.
+func (d *PinnedDialer) dial(ctx context.Context, _ string, addr string) (net.Conn, error) {
+	target, err := d.target(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Forwarder.dialTarget(withAffinity(ctx, d.SessionAffinity), addr, target)
+}
+
+// CheckTarget makes the checks DialContext makes before dialing addr,
+// without dialing, like ClusterDialer.CheckTarget.
+func (d *PinnedDialer) CheckTarget(ctx context.Context, addr string) error {
+	addr, err := d.FakeIPs.Translate(addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTarget, err)
+	}
+
+	target, err := d.target(ctx, addr)
+	if err != nil {
+		return err
+	}
+
+	return d.Forwarder.checkPolicy(ctx, addr, target)
+}
+
+// IsClusterTarget reports whether addr is a well-formed address of the
+// cluster. Pinned listeners have no passthrough.
+func (d *PinnedDialer) IsClusterTarget(addr string) bool {
+	_, err := ParsePinnedTarget(addr, d.Forwarder.Name)
+	return err == nil
+}
+
+// target parses addr, filling in the default namespace, and checks its
+// visibility.
+func (d *PinnedDialer) target(ctx context.Context, addr string) (Target, error) {
+	target, err := ParsePinnedTarget(addr, d.Forwarder.Name)
+	if err != nil {
+		return Target{}, fmt.Errorf("%w: %w", ErrInvalidTarget, err)
+	}
+
+	target, err = d.Forwarder.resolvePodIP(ctx, target)
+	if err != nil {
+		return Target{}, err
+	}
+
+	// nodes are cluster-scoped.
+	if target.Namespace == "" && target.Node == "" {
+		target.Namespace = cmp.Or(d.Namespace, userNamespace(ctx, d.UserNamespace), d.Forwarder.DefaultNamespace)
+	}
+
+	if err := d.Visibility.checkTarget(d.Forwarder.Name, target); err != nil {
+		return Target{}, err
+	}
+
+	return target, nil
+}
+
+// userNamespace returns the default namespace lookup assigns to the proxy
+// user of ctx, or "" for unauthenticated connections.
+func userNamespace(ctx context.Context, lookup func(user string) string) string {
+	user := auth.UserFromContext(ctx)
+	if lookup == nil || user == "" {
+		return ""
+	}
+
+	return lookup(user)
+}
+
+// ensure ClusterDialer.DialContext and PinnedDialer.DialContext match the
+// expected signature.
+var (
+	_ func(context.Context, string, string) (net.Conn, error) = (*ClusterDialer)(nil).DialContext
+	_ func(context.Context, string, string) (net.Conn, error) = (*PinnedDialer)(nil).DialContext
+)
 
-// PortForwarder dials Kubernetes pods via SPDY port-forwarding.
+// PortForwarder dials Kubernetes pods via port-forwarding.
 type PortForwarder struct {
+	Name             string
 	Config           *rest.Config
-	Clientset        *kubernetes.Clientset
+	Clientset        kubernetes.Interface
 	DefaultNamespace string
 	Logger           *slog.Logger
 
+	// History, if set, receives a record for every completed or failed connection.
+	History history.Store
+
+	// Impersonate, if set, maps an authenticated proxy user to the Kubernetes
+	// identity used for API calls and port-forwards made on their behalf.
+	Impersonate func(user string) rest.ImpersonationConfig
+
+	// Reauthenticate, if set, rebuilds the cluster's rest config and
+	// clientset, e.g. from the kubeconfig, after the API server rejected
+	// their credentials, such as an expired token of an exec credential
+	// plugin. The failed connection is retried once with the new clients,
+	// which replace Config and Clientset for later ones.
+	Reauthenticate func() (*rest.Config, kubernetes.Interface, error)
+
+	// DialTimeout bounds the protocol upgrade and stream creation of each dial
+	// attempt. Zero leaves only the OS connect and TCP timeouts.
+	DialTimeout time.Duration
+
+	// NegativeCacheTTL, if set, is how long a service that failed to resolve
+	// because it is missing or has no ready pods fails new connections
+	// immediately, without API calls or retries.
+	NegativeCacheTTL time.Duration
+
+	// Retry adjusts which dial and resolve errors are retried.
+	Retry RetryPolicy
+
+	// Traffic, if set, accounts the bytes transferred by namespace. It may be
+	// shared between forwarders.
+	Traffic *Traffic
+
+	// Trace lists glob patterns of addresses, with or without the port, whose
+	// connections log every read and write on the tunnel. Tracing can also
+	// be turned on for an open connection through Traffic.SetTrace.
+	Trace []string
+
+	// Policy, if set, limits when connections to the cluster are allowed.
+	// Denied connections are recorded in the history with outcome denied.
+	Policy *AccessPolicy
+
+	// OnLoginRequired, if set, is called when the cluster's credentials start
+	// to need an interactive login, e.g. to show a desktop notification.
+	OnLoginRequired func(cluster string, state LoginState)
+
+	// OnUnreachable, if set, is called when connections to the cluster start
+	// to fail because its API server can't be reached.
+	OnUnreachable func(cluster string, err error)
+
+	// OnConnect, if set, is called for each opened connection with the
+	// address the client asked for and the pod it was forwarded to.
+	OnConnect func(cluster, addr, target, user string)
+
+	// Catalog, if set, suggests similarly named Services when a service
+	// target doesn't exist.
+	Catalog *ServiceCatalog
+
+	// Preflight fails service targets missing from Catalog before dialing.
+	Preflight bool
+
+	// Endpoints, if set, resolves service targets from memory instead of
+	// with an API call per dial.
+	Endpoints *EndpointCache
+
+	// LoadBalancing picks the ready pod of a service target each connection
+	// goes to. Empty means BalanceFirst.
+	LoadBalancing LoadBalancing
+
+	// PodCIDRs are the pod networks of the cluster, whose bare IPs the
+	// ClusterDialer dials as the pod with the IP.
+	PodCIDRs []netip.Prefix
+
+	// Transport is the protocol port-forwards are opened with. Empty means
+	// TransportAuto.
+	Transport PortForwardTransport
+
+	// Protocols, if set, replaces Transport with the protocols offered, in
+	// order: a dial whose upgrade fails tries the next one. Unlike with
+	// TransportAuto, a fallback isn't remembered.
+	Protocols []PortForwardProtocol
+
+	// MultiplexIdleTimeout, if set, opens the forwards to a pod as stream
+	// pairs on one shared connection, kept open for this long after its
+	// last forward closes. Zero opens a connection per forward.
+	MultiplexIdleTimeout time.Duration
+
+	// UnhealthyAfter, if set, is how many attempts to connect to a target
+	// fail in a row before it is logged as unhealthy once and listed by
+	// Unhealthy, with its further retries logged at debug level.
+	UnhealthyAfter int
+
+	// BreakerThreshold, if set, is how many connections to a target fail in
+	// a row before new connections to it fail fast for BreakerCooldown,
+	// without dialing. The first connection after the cooldown tries the
+	// target again.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	negative     negativeCache
+	login        loginGate
+	balancer     podBalancer
+	spdyFallback atomic.Bool
+	pool         connPool
+	health       targetHealth
+	breaker      circuitBreaker
+
+	reach        sync.Mutex
+	unreachable  bool
+	reachErr     error
+	reachSince   time.Time
+	probed       time.Time
+	probeLatency time.Duration
+	// healthChecked is set while a HealthChecker probes the cluster, so
+	// connections fail fast while it is unreachable.
+	healthChecked atomic.Bool
+
+	authMu        sync.Mutex
+	authConfig    *rest.Config
+	authClientset kubernetes.Interface
+	authRebuilt   time.Time
+	// authChanged is closed when the clients are rebuilt.
+	authChanged chan struct{}
+
+	userClientsMu sync.Mutex
+	userClients   map[string]userClient
+
 	// test overrides — if nil/zero, the real implementations and defaults are used.
-	dialFunc    func(namespace, pod string, port int) (*StreamConn, error)
-	resolveFunc func(ctx context.Context, namespace, serviceName string) (string, error)
-	baseBackoff time.Duration
+	dialFunc       func(namespace, pod string, port int) (*StreamConn, error)
+	resolveFunc    func(ctx context.Context, namespace, serviceName string) ([]string, error)
+	targetPortFunc func(ctx context.Context, namespace, serviceName, pod string, port int) (int, error)
+	baseBackoff    time.Duration
 }
 
+// connSeq numbers connections, so log lines of one connection can be told
+// apart from others to the same target.
+var connSeq atomic.Uint64
+
 const (
 	dialMaxAttempts  = 6
 	dialBaseBackoff  = 1 * time.Second
 	dialBackoffScale = 2
 )
 
+// userClient holds the impersonating rest config and clientset for one user.
+type userClient struct {
+	// base is the config the impersonating copy was made of.
+	base      *rest.Config
+	config    *rest.Config
+	clientset kubernetes.Interface
+}
+
+// clientsFor returns the rest config and clientset to use for user. Without
+// impersonation (or for unauthenticated connections) the forwarder's own
+// clients are returned; otherwise an impersonating copy is built per user and
+// forwarder client, and rebuilt when the user's identity changes, e.g. after
+// a login with other directory groups.
+func (k *PortForwarder) clientsFor(user string) (*rest.Config, kubernetes.Interface, error) {
+	base, baseClientset := k.Clients()
+
+	if k.Impersonate == nil || user == "" {
+		return base, baseClientset, nil
+	}
+
+	imp := k.Impersonate(user)
+
+	k.userClientsMu.Lock()
+	defer k.userClientsMu.Unlock()
+
+	if uc, ok := k.userClients[user]; ok && uc.base == base && sameImpersonation(uc.config.Impersonate, imp) {
+		return uc.config, uc.clientset, nil
+	}
+
+	cfg := rest.CopyConfig(base)
+	cfg.Impersonate = imp
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating impersonating client for user %q: %w", user, err)
+	}
+
+	if k.userClients == nil {
+		k.userClients = make(map[string]userClient)
+	}
+
+	k.userClients[user] = userClient{base: base, config: cfg, clientset: clientset}
+
+	return cfg, clientset, nil
+}
+
+// sameImpersonation reports whether a and b impersonate the same identity.
+func sameImpersonation(a, b rest.ImpersonationConfig) bool {
+	return a.UserName == b.UserName && a.UID == b.UID && slices.Equal(a.Groups, b.Groups) &&
+		maps.EqualFunc(a.Extra, b.Extra, slices.Equal[[]string])
+}
+
 // dialTarget resolves the pre-parsed target and dials the pod with retries.
-// For service targets, each retry re-resolves the service to pick a different
-// ready pod (e.g. after a rolling restart). This gives the retry loop a ~31s
-// window (1s + 2s + 4s + 8s + 16s) which covers most pod restart scenarios.
+// For service targets, each retry re-resolves the service to pick a ready pod
+// from the current endpoints (e.g. after a rolling restart). This gives the
+// retry loop a ~31s window on average (1s + 2s + 4s + 8s + 16s, each
+// jittered) which covers most pod restart scenarios. Which of the ready pods
+// is dialed follows LoadBalancing. A service that still fails to resolve is
+// kept in the negative cache for NegativeCacheTTL.
 func (k *PortForwarder) dialTarget(ctx context.Context, originalAddr string, target Target) (net.Conn, error) {
+	user := auth.UserFromContext(ctx)
+	connID := connSeq.Add(1)
+
+	clientsAt := time.Now()
+
+	restCfg, clientset, err := k.clientsFor(user)
+	if err != nil {
+		return nil, err
+	}
+
 	dial := k.dialFunc
 	if dial == nil {
-		dial = k.dialPod
+		dial = func(namespace, pod string, port int) (*StreamConn, error) {
+			return k.dialPod(ctx, restCfg, namespace, pod, port, upstreamKeepalive(ctx))
+		}
 	}
 
 	resolve := k.resolveFunc
 	if resolve == nil {
-		resolve = func(ctx context.Context, ns, svc string) (string, error) {
-			return ResolveServiceToPod(ctx, k.Clientset, ns, svc)
+		resolve = func(ctx context.Context, ns, svc string) ([]string, error) {
+			return k.resolveServicePods(ctx, clientset, user, ns, svc)
+		}
+	}
+
+	targetPort := k.targetPortFunc
+	if targetPort == nil {
+		targetPort = func(ctx context.Context, ns, svc, pod string, port int) (int, error) {
+			return k.serviceTargetPort(ctx, clientset, user, ns, svc, pod, port)
+		}
+	}
+
+	// failures count towards the target as addressed, before a member or
+	// workload target replaces it.
+	health, healthName := target, targetName(target)
+	unhealthy := false
+
+	// failed counts a failed attempt towards the target's health and returns
+	// the level its retry is logged at: once the target is unhealthy, its
+	// warning stands in for them.
+	failed := func(err error) slog.Level {
+		if unhealthy = k.connectFailed(clientset, health, healthName, err); unhealthy {
+			return slog.LevelDebug
+		}
+
+		return slog.LevelWarn
+	}
+
+	reauthenticated := false
+
+	// reauth rebuilds the clients once per connection after the API server
+	// rejected their credentials, reporting whether to retry right away.
+	reauth := func(err error) bool {
+		if k.Reauthenticate == nil || reauthenticated || !isUnauthorized(err) {
+			return false
+		}
+
+		reauthenticated = true
+
+		cfg, cs, rerr := k.reauthenticate(user, clientsAt)
+		if rerr != nil {
+			if k.Logger != nil {
+				k.Logger.Warn("failed to rebuild cluster client", "error", rerr)
+			}
+
+			return false
+		}
+
+		// clients rebuilt within reauthInterval are kept, and would be
+		// rejected alike.
+		if cfg == restCfg {
+			return false
 		}
+
+		restCfg, clientset, clientsAt = cfg, cs, time.Now()
+
+		return true
+	}
+
+	start := time.Now()
+
+	if err := k.Policy.check(k.Name, start); err != nil {
+		k.deny(start, user, originalAddr, target, connID, err)
+		return nil, err
+	}
+
+	if target.APIServer {
+		return k.dialAPIServer(ctx, originalAddr, target, user, connID, start)
+	}
+
+	if target.Node != "" {
+		return k.dialNode(ctx, originalAddr, target, user, connID, start)
 	}
 
 	var lastErr error
 
-	for attempt := range dialMaxAttempts {
-		podName := target.PodName
+	attempts := dialMaxAttempts
+	cacheKey := target.Namespace + "/" + target.ServiceName
+
+	if target.IsService && k.NegativeCacheTTL > 0 {
+		if cached := k.negative.get(cacheKey, start); cached != nil {
+			lastErr = fmt.Errorf("%w (cached)", cached)
+			attempts = 0
+		}
+	}
+
+	if state := k.login.check(start); state != nil {
+		lastErr = loginError(k.Name, state)
+		attempts = 0
+	}
+
+	if attempts > 0 && k.healthChecked.Load() {
+		if err := k.unreachableErr(); err != nil {
+			lastErr = err
+			attempts = 0
+		}
+	}
+
+	breakerKey := health.Namespace + "/" + healthName
+
+	if attempts > 0 && k.BreakerThreshold > 0 {
+		if err := k.breaker.allow(breakerKey, start, k.BreakerCooldown); err != nil {
+			lastErr = err
+			attempts = 0
+
+			metrics.CircuitBreakerRejectedTotal.WithLabelValues(k.Name).Inc()
+		}
+	}
+
+	if attempts > 0 {
+		if err := k.preflight(target); err != nil {
+			if member, ok := memberTarget(ctx, clientset, target); ok {
+				target = member
+			} else if workload, ok := workloadTarget(target); ok {
+				target = workload
+			} else {
+				lastErr = err
+				attempts = 0
+			}
+		}
+	}
+
+	affinity, client := sessionAffinity(ctx)
+	session := affinityKey{client: client, cluster: k.Name, namespace: target.Namespace, service: target.ServiceName}
+
+	for attempt := range attempts {
+		podName, port := target.PodName, target.Port
 
 		if target.IsService {
-			var err error
+			pods, err := resolve(ctx, target.Namespace, target.ServiceName)
+
+			var ext *ExternalNameError
+			if errors.As(err, &ext) {
+				return k.dialExternalName(ctx, originalAddr, ext, target, user, connID, start)
+			}
+
+			if errors.Is(err, ErrServiceNotFound) {
+				if member, ok := memberTarget(ctx, clientset, target); ok {
+					target = member
+					continue
+				}
+
+				if workload, ok := workloadTarget(target); ok {
+					target = workload
+					continue
+				}
+			}
+
+			if err != nil {
+				lastErr = err
+
+				if reauth(err) {
+					continue
+				}
+
+				level := failed(err)
+
+				if !k.Retry.retriable(err) {
+					break
+				}
+
+				if ok := k.waitBackoff(ctx, attempt, level, target.Namespace, target.ServiceName, 0, err); !ok {
+					return nil, fmt.Errorf("dial retry cancelled: %w", ctx.Err())
+				}
+
+				continue
+			}
+
+			podName = affinity.pick(session, pods, time.Now(), func() string {
+				return k.balancer.pick(k.LoadBalancing, target.Namespace, target.ServiceName, pods)
+			})
 
-			podName, err = resolve(ctx, target.Namespace, target.ServiceName)
+			port, err = targetPort(ctx, target.Namespace, target.ServiceName, podName, target.Port)
 			if err != nil {
 				lastErr = err
 
-				if !isRetriableError(err) {
+				if reauth(err) {
+					continue
+				}
+
+				level := failed(err)
+
+				if !k.Retry.retriable(err) {
 					break
 				}
 
-				if ok := k.waitBackoff(ctx, attempt, target.Namespace, target.ServiceName, 0, err); !ok {
+				if ok := k.waitBackoff(ctx, attempt, level, target.Namespace, podName, target.Port, err); !ok {
 					return nil, fmt.Errorf("dial retry cancelled: %w", ctx.Err())
 				}
 
@@ -138,47 +750,231 @@ func (k *PortForwarder) dialTarget(ctx context.Context, originalAddr string, tar
 			}
 
 			if attempt == 0 && k.Logger != nil {
-				k.Logger.Info("resolved service to pod", "namespace", target.Namespace, "service", target.ServiceName, "pod", podName)
+				k.Logger.Info("resolved service to pod", "namespace", target.Namespace, "service", target.ServiceName, "pod", podName, "port", port, "ready", len(pods))
+			}
+		}
+
+		if target.Workload.Kind != "" || target.Selector != "" {
+			pods, name, err := selectedPods(ctx, clientset, target)
+			if err != nil {
+				lastErr = err
+
+				if reauth(err) {
+					continue
+				}
+
+				level := failed(err)
+
+				if !k.Retry.retriable(err) {
+					break
+				}
+
+				if ok := k.waitBackoff(ctx, attempt, level, target.Namespace, name, 0, err); !ok {
+					return nil, fmt.Errorf("dial retry cancelled: %w", ctx.Err())
+				}
+
+				continue
+			}
+
+			session = affinityKey{client: client, cluster: k.Name, namespace: target.Namespace, service: name}
+			podName = affinity.pick(session, pods, time.Now(), func() string {
+				return k.balancer.pick(k.LoadBalancing, target.Namespace, name, pods)
+			})
+
+			if attempt == 0 && k.Logger != nil {
+				k.Logger.Info("resolved workload to pod", "namespace", target.Namespace, "workload", name, "pod", podName, "ready", len(pods))
+			}
+		}
+
+		conn, err := dial(target.Namespace, podName, port)
+		if err == nil {
+			// the kubelet reports forwarding failures asynchronously; one
+			// that already arrived fails the dial, so it is retried or
+			// reported instead of handing out a dead tunnel.
+			if remoteErr := conn.RemoteErr(); remoteErr != nil {
+				_ = conn.Close()
+				err = remoteErr
 			}
 		}
 
-		conn, err := dial(target.Namespace, podName, target.Port)
 		if err == nil {
-			resolvedTarget := fmt.Sprintf("%s/%s:%d", target.Namespace, podName, target.Port)
+			resolvedTarget := fmt.Sprintf("%s/%s:%d", target.Namespace, podName, port)
 
 			if k.Logger != nil {
-				k.Logger.Info("connect", "addr", originalAddr, "target", resolvedTarget)
+				k.Logger.Info("connect", "addr", originalAddr, "target", resolvedTarget, "user", user, "conn", connID, "protocol", conn.Protocol())
 			}
 
-			return &logOnCloseConn{
-				StreamConn: conn,
-				logger:     k.Logger,
-				origAddr:   originalAddr,
-				resolved:   resolvedTarget,
-			}, nil
+			k.loginSucceeded()
+			k.reachable()
+			k.connectSucceeded(health.Namespace, healthName)
+
+			if k.breaker.succeeded(breakerKey) && k.Logger != nil {
+				k.Logger.Info("circuit breaker closed", "namespace", health.Namespace, "target", healthName)
+			}
+
+			return k.track(ctx, conn, start, user, originalAddr, target, resolvedTarget, connID, k.balancer.opened(target.Namespace, podName)), nil
 		}
 
 		lastErr = err
 
-		if !isRetriableError(err) {
+		if reauth(err) {
+			continue
+		}
+
+		countRemoteError(k.Name, err)
+		level := failed(err)
+
+		// the pods of service, workload and selector targets are picked.
+		if target.PodName == "" {
+			affinity.forget(session, podName)
+		}
+
+		if !k.Retry.retriable(err) {
 			break
 		}
 
-		if ok := k.waitBackoff(ctx, attempt, target.Namespace, podName, target.Port, err); !ok {
+		if ok := k.waitBackoff(ctx, attempt, level, target.Namespace, podName, port, err); !ok {
 			return nil, fmt.Errorf("dial retry cancelled: %w", ctx.Err())
 		}
 	}
 
+	if attempts > 0 && isLoginError(lastErr) {
+		k.loginFailed(lastErr, time.Now())
+	}
+
+	if attempts > 0 && isUnreachableError(lastErr) {
+		k.unreachableFailed(lastErr)
+	}
+
+	if attempts > 0 && target.IsService && k.Catalog != nil && errors.Is(lastErr, ErrServiceNotFound) {
+		if s := k.Catalog.Suggest(k.Name, target.Namespace, target.ServiceName); len(s) > 0 {
+			lastErr = fmt.Errorf("%w (did you mean %s?)", lastErr, strings.Join(s, " or "))
+		}
+	}
+
+	if attempts > 0 && k.BreakerThreshold > 0 && k.breaker.failed(breakerKey, lastErr, time.Now(), k.BreakerThreshold, k.BreakerCooldown) {
+		metrics.CircuitBreakerTripsTotal.WithLabelValues(k.Name).Inc()
+
+		if k.Logger != nil {
+			k.Logger.Warn("circuit breaker open", "namespace", health.Namespace, "target", healthName, "cooldown", k.BreakerCooldown, "error", lastErr)
+		}
+	}
+
+	if attempts > 0 && target.IsService && k.NegativeCacheTTL > 0 && isNegativeResolution(lastErr) {
+		now := time.Now()
+		k.negative.put(cacheKey, lastErr, now, now.Add(k.NegativeCacheTTL))
+	}
+
 	if k.Logger != nil {
-		k.Logger.Error("failed to connect", "addr", originalAddr, "error", lastErr)
+		level := slog.LevelError
+		if unhealthy {
+			level = slog.LevelDebug
+		}
+
+		k.Logger.Log(ctx, level, "failed to connect", "addr", originalAddr, "error", lastErr, "conn", connID)
 	}
 
+	k.recordFailed(start, user, originalAddr, target, lastErr)
+
 	return nil, lastErr
 }
 
-// waitBackoff sleeps for the exponential backoff duration, logging the retry.
-// Returns false if the context was cancelled during the wait.
-func (k *PortForwarder) waitBackoff(ctx context.Context, attempt int, namespace, name string, port int, err error) bool {
+// track wraps conn, established to target as resolved, so it is logged,
+// recorded in the history and metrics when closed, and can be listed and
+// revoked through Traffic while open. release, if set, is called on close.
+func (k *PortForwarder) track(ctx context.Context, conn tunnel, start time.Time, user, originalAddr string, target Target, resolved string, connID uint64, release func()) *logOnCloseConn {
+	if k.OnConnect != nil {
+		k.OnConnect(k.Name, originalAddr, resolved, user)
+	}
+
+	metrics.ConnectionsTotal.WithLabelValues(k.Name, history.OutcomeOK).Inc()
+	metrics.ConnectionsActive.WithLabelValues(k.Name).Inc()
+	metrics.DialDuration.WithLabelValues(k.Name).Observe(time.Since(start).Seconds())
+
+	c := &logOnCloseConn{
+		tunnel:   conn,
+		logger:   k.Logger,
+		connID:   connID,
+		origAddr: originalAddr,
+		resolved: resolved,
+		history:  k.History,
+		traffic:  k.Traffic,
+		record:   k.historyRecord(start, user, originalAddr, target, resolved),
+		release:  release,
+		client:   proxyproto.ClientAddr(ctx),
+	}
+	c.trace.Store(k.traced(originalAddr))
+	k.Traffic.track(c)
+
+	return c
+}
+
+// recordFailed records a connection to target that failed with err in the
+// history and metrics.
+func (k *PortForwarder) recordFailed(start time.Time, user, originalAddr string, target Target, err error) {
+	metrics.ConnectionsTotal.WithLabelValues(k.Name, history.OutcomeError).Inc()
+
+	if k.History != nil {
+		rec := k.historyRecord(start, user, originalAddr, target, "")
+		rec.Duration = time.Since(start)
+		rec.Outcome = history.OutcomeError
+		rec.Error = err.Error()
+		k.appendHistory(rec)
+	}
+}
+
+// checkPolicy returns an error wrapping ErrAccessDenied, recording the
+// refused connection, unless the access policy allows connecting to target
+// now.
+func (k *PortForwarder) checkPolicy(ctx context.Context, originalAddr string, target Target) error {
+	now := time.Now()
+
+	if err := k.Policy.check(k.Name, now); err != nil {
+		k.deny(now, auth.UserFromContext(ctx), originalAddr, target, connSeq.Add(1), err)
+		return err
+	}
+
+	return nil
+}
+
+// deny records a connection refused by the access policy.
+func (k *PortForwarder) deny(start time.Time, user, originalAddr string, target Target, connID uint64, err error) {
+	if k.Logger != nil {
+		k.Logger.Warn("connection denied", "addr", originalAddr, "user", user, "error", err, "conn", connID)
+	}
+
+	metrics.ConnectionsTotal.WithLabelValues(k.Name, history.OutcomeDenied).Inc()
+
+	if k.History != nil {
+		rec := k.historyRecord(start, user, originalAddr, target, "")
+		rec.Outcome = history.OutcomeDenied
+		rec.Error = err.Error()
+		k.appendHistory(rec)
+	}
+}
+
+// historyRecord builds the connection history record template for target.
+func (k *PortForwarder) historyRecord(start time.Time, user, originalAddr string, target Target, resolved string) history.Record {
+	return history.Record{
+		Start:     start,
+		Addr:      originalAddr,
+		Cluster:   k.Name,
+		Namespace: target.Namespace,
+		Target:    resolved,
+		User:      user,
+		Outcome:   history.OutcomeOK,
+	}
+}
+
+func (k *PortForwarder) appendHistory(rec history.Record) {
+	if err := k.History.Append(rec); err != nil && k.Logger != nil {
+		k.Logger.Warn("failed to record connection history", "error", err)
+	}
+}
+
+// waitBackoff sleeps for the exponential backoff duration, logging the retry
+// at level. Returns false if the context was cancelled during the wait.
+func (k *PortForwarder) waitBackoff(ctx context.Context, attempt int, level slog.Level, namespace, name string, port int, err error) bool {
 	// don't sleep after the last attempt
 	if attempt == dialMaxAttempts-1 {
 		return true
@@ -189,10 +985,12 @@ func (k *PortForwarder) waitBackoff(ctx context.Context, attempt int, namespace,
 		base = dialBaseBackoff
 	}
 
-	backoff := base * time.Duration(pow(dialBackoffScale, attempt))
+	backoff := jitter(base * time.Duration(pow(dialBackoffScale, attempt)))
+
+	metrics.DialRetriesTotal.WithLabelValues(k.Name).Inc()
 
 	if k.Logger != nil {
-		k.Logger.Warn("retrying connection",
+		k.Logger.Log(ctx, level, "retrying connection",
 			"namespace", namespace, "target", name, "port", port,
 			"attempt", attempt+1, "backoff", backoff, "error", err,
 		)
@@ -206,6 +1004,13 @@ func (k *PortForwarder) waitBackoff(ctx context.Context, attempt int, namespace,
 	}
 }
 
+// jitter randomizes d to between half and one and a half times its value, so
+// connections that failed together (e.g. during a pod restart) don't retry
+// in synchronized waves.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d)
+}
+
 func pow(base, exp int) int {
 	result := 1
 	for range exp {
@@ -215,112 +1020,324 @@ func pow(base, exp int) int {
 	return result
 }
 
-// isRetriableError returns true for transient errors that are safe to retry.
-// This includes network errors (broken pipe, connection reset, refused, EOF,
-// timeouts) and service resolution failures (no ready pods during a restart).
-func isRetriableError(err error) bool {
-	if errors.Is(err, syscall.EPIPE) ||
-		errors.Is(err, syscall.ECONNRESET) ||
-		errors.Is(err, syscall.ECONNREFUSED) ||
-		errors.Is(err, io.EOF) ||
-		errors.Is(err, io.ErrUnexpectedEOF) {
-		return true
+// dialPod establishes a port-forward connection to the given pod and port
+// using restCfg for authentication (the forwarder's own config, or an
+// impersonating copy of it). The dial stops when ctx is done, e.g. because
+// the client that asked for the connection went away. With DialTimeout set,
+// a dial that has not completed in time fails with a retriable timeout
+// error. An abandoned dial is left to finish in the background and its
+// connection is closed.
+func (k *PortForwarder) dialPod(ctx context.Context, restCfg *rest.Config, namespace, pod string, port int, pingPeriod time.Duration) (*StreamConn, error) {
+	var cancel context.CancelFunc
+
+	if k.DialTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, k.DialTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
 	}
+	defer cancel()
 
-	var netErr net.Error
-	if errors.As(err, &netErr) && netErr.Timeout() {
-		return true
+	type result struct {
+		conn *StreamConn
+		err  error
 	}
 
-	// "no ready pod endpoints" happens when a service's pods are restarting
-	if strings.Contains(err.Error(), "no ready pod endpoints") {
-		return true
+	done := make(chan result, 1)
+
+	go func() {
+		conn, err := k.dialPodStreams(ctx, restCfg, namespace, pod, port, pingPeriod)
+		done <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+
+		return nil, fmt.Errorf("port-forward dial to %s/%s: %w", namespace, pod, ctx.Err())
 	}
+}
+
+// dialPodStreams creates the port-forward streams, on the pod's pooled
+// connection if it has one, kept by MultiplexIdleTimeout or Prewarm, or
+// else on a new connection opened with the first of the forwarder's
+// protocols the API server accepts. ctx cancels connecting to the API
+// server, the TLS handshake and the creation of the streams. A non-zero
+// pingPeriod replaces the default interval of SPDY pings.
+func (k *PortForwarder) dialPodStreams(ctx context.Context, restCfg *rest.Config, namespace, pod string, port int, pingPeriod time.Duration) (*StreamConn, error) {
+	key := poolKey{config: restCfg, namespace: namespace, pod: pod, pingPeriod: pingPeriod}
+
+	if pc := k.pool.get(key); pc != nil {
+		// a connection that fails to create streams is dropped from the
+		// pool, and a new one is dialed.
+		if sc, err := pc.forward(ctx, port); err == nil || ctx.Err() != nil {
+			return sc, err
+		}
+	}
+
+	conn, protocol, err := k.negotiate(ctx, restCfg, namespace, pod, pingPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.MultiplexIdleTimeout > 0 {
+		return k.pool.add(key, conn, protocol, k.MultiplexIdleTimeout).forward(ctx, port)
+	}
+
+	// the connection is this dial's own, so closing it aborts a stream
+	// creation waiting for the kubelet.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	sc, err := newPortForwardStreams(ctx, conn, "0", namespace, pod, port)
+	if !stop() || err != nil {
+		conn.Close()
 
-	return false
+		if err == nil {
+			err = fmt.Errorf("creating port-forward streams: %w", ctx.Err())
+		}
+
+		return nil, err
+	}
+
+	sc.protocol = protocol
+
+	return sc, nil
+}
+
+// negotiate opens a port-forward connection to pod with the first of the
+// forwarder's protocols the API server accepts.
+func (k *PortForwarder) negotiate(ctx context.Context, restCfg *rest.Config, namespace, pod string, pingPeriod time.Duration) (httpstream.Connection, PortForwardProtocol, error) {
+	protocols := k.protocols()
+
+	for i, p := range protocols {
+		var (
+			conn httpstream.Connection
+			err  error
+		)
+
+		if p == ProtocolWebSocketV2 {
+			conn, err = dialWebSocket(ctx, restCfg, namespace, pod, pingPeriod)
+		} else {
+			conn, err = dialSPDY(ctx, restCfg, namespace, pod, pingPeriod)
+		}
+
+		if err == nil {
+			return conn, p, nil
+		}
+
+		if i == len(protocols)-1 || !k.upgradeFailed(p, err) {
+			return nil, "", err
+		}
+	}
+
+	return nil, "", fmt.Errorf("no port-forward protocols to offer")
 }
 
-// dialPod establishes an SPDY port-forward connection to the given pod and port.
-func (k *PortForwarder) dialPod(namespace, pod string, port int) (*StreamConn, error) {
-	reqURL := k.Clientset.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Namespace(namespace).
-		Name(pod).
-		SubResource("portforward").
-		URL()
+// dialSPDY upgrades a port-forward request to SPDY.
+func dialSPDY(ctx context.Context, restCfg *rest.Config, namespace, pod string, pingPeriod time.Duration) (httpstream.Connection, error) {
+	reqURL, err := portForwardURL(restCfg, namespace, pod)
+	if err != nil {
+		return nil, err
+	}
 
 	// create the SPDY transport using the rest config (handles auth, TLS, etc).
-	transport, upgrader, err := spdy.RoundTripperFor(k.Config)
+	transport, upgrader, err := spdyRoundTripperFor(restCfg, pingPeriod)
 	if err != nil {
 		return nil, fmt.Errorf("creating SPDY round tripper: %w", err)
 	}
 
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, reqURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating port-forward request: %w", err)
+	}
 
-	spdyConn, protocol, err := dialer.Dial(portForwardProtocolV1)
+	spdyConn, protocol, err := spdy.Negotiate(upgrader, &http.Client{Transport: transport}, req, portForwardProtocolV1)
 	if err != nil {
 		return nil, fmt.Errorf("SPDY dial to %s/%s: %w", namespace, pod, err)
 	}
 
 	_ = protocol // expected to be "portforward.k8s.io"
 
+	return spdyConn, nil
+}
+
+// newPortForwardStreams creates the error and data streams of a
+// port-forward to port on conn under requestID, unless ctx is done before a
+// stream is created. Forwards multiplexed over a connection need distinct
+// request IDs.
+func newPortForwardStreams(ctx context.Context, conn httpstream.Connection, requestID, namespace, pod string, port int) (*StreamConn, error) {
 	// both streams share the same requestID and port.
-	requestID := "0"
 	headers := http.Header{}
 	headers.Set("Streamtype", "error")
 	headers.Set("Port", strconv.Itoa(port))
 	headers.Set("Requestid", requestID)
 
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("creating error stream: %w", err)
+	}
+
 	// error stream must be created first (Kubernetes protocol requirement).
-	errorStream, err := spdyConn.CreateStream(headers)
+	errorStream, err := conn.CreateStream(headers)
 	if err != nil {
-		spdyConn.Close()
 		return nil, fmt.Errorf("creating error stream: %w", err)
 	}
 
+	if err := ctx.Err(); err != nil {
+		errorStream.Reset()
+		conn.RemoveStreams(errorStream)
+
+		return nil, fmt.Errorf("creating data stream: %w", err)
+	}
+
 	headers.Set("Streamtype", "data")
 
-	dataStream, err := spdyConn.CreateStream(headers)
+	dataStream, err := conn.CreateStream(headers)
 	if err != nil {
-		errorStream.Close()
-		spdyConn.Close()
+		errorStream.Reset()
+		conn.RemoveStreams(errorStream)
 
 		return nil, fmt.Errorf("creating data stream: %w", err)
 	}
 
 	target := fmt.Sprintf("%s/%s:%d", namespace, pod, port)
 
-	return NewStreamConn(dataStream, errorStream, spdyConn, target), nil
+	return NewStreamConn(dataStream, errorStream, conn, target), nil
 }
 
 const portForwardProtocolV1 = "portforward.k8s.io"
 
-// logOnCloseConn wraps a StreamConn and logs connection metrics on close.
+// portForwardURL builds the pods/portforward subresource URL from the rest
+// config directly, so any kubernetes.Interface (including fakes) can be used
+// as the forwarder's clientset.
+func portForwardURL(config *rest.Config, namespace, pod string) (*url.URL, error) {
+	host, _, err := rest.DefaultServerUrlFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("building API server URL: %w", err)
+	}
+
+	host.Path = path.Join(host.Path, "/api/v1/namespaces", namespace, "pods", pod, "portforward")
+
+	return host, nil
+}
+
+// logOnCloseConn wraps a tunnel and logs connection metrics on close.
 type logOnCloseConn struct {
-	*StreamConn
+	tunnel
 
 	logger   *slog.Logger
+	connID   uint64
 	origAddr string
 	resolved string
+	history  history.Store
+	traffic  *Traffic
+	record   history.Record
+
+	// trace logs every read and write while set.
+	trace atomic.Bool
+
+	// release, if set, uncounts the connection for load balancing.
+	release func()
+
+	// client is the address of the proxy client's connection, if known.
+	client net.Addr
+
+	// ctx is the connection's registration in traffic, done once it is
+	// closed. Revoke cancels it with the reason before closing. Nil for
+	// untracked connections.
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	closeOnce sync.Once
 }
 
 func (c *logOnCloseConn) Close() error {
-	err := c.StreamConn.Close()
+	err := c.tunnel.Close()
+
+	// callers may close more than once (e.g. relay plus a deferred Close);
+	// only log and record the first one.
+	c.closeOnce.Do(func() {
+		c.logClose()
+
+		if c.release != nil {
+			c.release()
+		}
+
+		if c.cancel != nil {
+			c.cancel(nil)
+		}
+	})
+
+	return err
+}
+
+// revoked returns why the connection was revoked, or nil.
+func (c *logOnCloseConn) revoked() error {
+	if c.ctx == nil || c.ctx.Err() == nil {
+		return nil
+	}
+
+	return context.Cause(c.ctx)
+}
+
+func (c *logOnCloseConn) logClose() {
+	metrics.ConnectionsActive.WithLabelValues(c.record.Cluster).Dec()
+	metrics.BytesTotal.WithLabelValues(c.record.Cluster, "rx").Add(float64(c.BytesRead()))
+	metrics.BytesTotal.WithLabelValues(c.record.Cluster, "tx").Add(float64(c.BytesWritten()))
+	metrics.NamespaceBytesTotal.WithLabelValues(c.record.Cluster, c.record.Namespace, "rx").Add(float64(c.BytesRead()))
+	metrics.NamespaceBytesTotal.WithLabelValues(c.record.Cluster, c.record.Namespace, "tx").Add(float64(c.BytesWritten()))
+	c.traffic.untrack(c)
+
+	remoteErr := c.RemoteErr()
+	countRemoteError(c.record.Cluster, remoteErr)
+
+	revokeErr := c.revoked()
+
+	if c.history != nil {
+		rec := c.record
+		rec.Duration = c.Duration()
+		rec.BytesRead = c.BytesRead()
+		rec.BytesWritten = c.BytesWritten()
+
+		switch {
+		case revokeErr != nil:
+			rec.Outcome = history.OutcomeRevoked
+			rec.Error = revokeErr.Error()
+		case remoteErr != nil:
+			rec.Outcome = history.OutcomeError
+			rec.Error = remoteErr.Error()
+		}
+
+		if appendErr := c.history.Append(rec); appendErr != nil && c.logger != nil {
+			c.logger.Warn("failed to record connection history", "error", appendErr)
+		}
+	}
 
 	if c.logger != nil {
-		c.logger.Info("closed",
+		attrs := []any{
 			"addr", c.origAddr,
 			"target", c.resolved,
-			"duration", c.Duration().Round(100*time.Millisecond).String(),
-			"rx", formatBytes(c.BytesRead()),
-			"tx", formatBytes(c.BytesWritten()),
-		)
-	}
+			"duration", c.Duration().Round(100 * time.Millisecond).String(),
+			"rx", FormatBytes(c.BytesRead()),
+			"tx", FormatBytes(c.BytesWritten()),
+			"conn", c.connID,
+		}
 
-	return err
+		if err := cmp.Or(revokeErr, remoteErr); err != nil {
+			c.logger.Warn("closed", append(attrs, "error", err)...)
+			return
+		}
+
+		c.logger.Info("closed", attrs...)
+	}
 }
 
-func formatBytes(n int64) string {
+// FormatBytes formats a byte count with a binary unit, e.g. 1.5MB.
+func FormatBytes(n int64) string {
 	switch {
 	case n >= 1<<30:
 		return fmt.Sprintf("%.1fGB", float64(n)/float64(1<<30))
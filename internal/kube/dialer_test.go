@@ -5,9 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/history"
 )
 
 func TestClusterSuffix(t *testing.T) {
@@ -112,6 +123,216 @@ func TestDialTarget_Success(t *testing.T) {
 	}
 }
 
+func TestPinnedDialer(t *testing.T) {
+	var gotNamespace, gotService string
+
+	fwd := &PortForwarder{
+		Clientset:        fake.NewClientset(),
+		Name:             "production",
+		DefaultNamespace: "default",
+		resolveFunc: func(_ context.Context, namespace, serviceName string) ([]string, error) {
+			gotNamespace, gotService = namespace, serviceName
+			return []string{"redis-0"}, nil
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return &StreamConn{errDone: make(chan struct{})}, nil
+		},
+	}
+
+	dialer := &PinnedDialer{Forwarder: fwd, Namespace: "cache"}
+
+	if _, err := dialer.DialContext(context.Background(), "tcp", "redis:6379"); err != nil {
+		t.Fatalf("DialContext() error: %v", err)
+	}
+
+	if gotNamespace != "cache" || gotService != "redis" {
+		t.Errorf("resolved %s/%s, want cache/redis", gotNamespace, gotService)
+	}
+
+	// no passthrough: hostnames are always cluster targets.
+	if _, err := dialer.DialContext(context.Background(), "tcp", "api.github:443"); err != nil {
+		t.Fatalf("DialContext() error: %v", err)
+	}
+
+	if gotNamespace != "github" || gotService != "api" {
+		t.Errorf("resolved %s/%s, want github/api", gotNamespace, gotService)
+	}
+}
+
+func TestClusterDialerFakeIP(t *testing.T) {
+	var gotNamespace, gotService string
+
+	fwd := &PortForwarder{
+		Clientset:        fake.NewClientset(),
+		Name:             "production",
+		DefaultNamespace: "default",
+		resolveFunc: func(_ context.Context, namespace, serviceName string) ([]string, error) {
+			gotNamespace, gotService = namespace, serviceName
+			return []string{"postgres-0"}, nil
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return &StreamConn{errDone: make(chan struct{})}, nil
+		},
+	}
+
+	pool, _ := NewFakeIPPool("198.18.0.0/15", time.Hour)
+	ip, _ := pool.IP("postgres.db.production")
+
+	dialer := &ClusterDialer{Forwarders: map[string]*PortForwarder{"production": fwd}, FakeIPs: pool}
+
+	if _, err := dialer.DialContext(context.Background(), "tcp", net.JoinHostPort(ip.String(), "5432")); err != nil {
+		t.Fatalf("DialContext() error: %v", err)
+	}
+
+	if gotNamespace != "db" || gotService != "postgres" {
+		t.Errorf("resolved %s/%s, want db/postgres", gotNamespace, gotService)
+	}
+
+	if _, err := dialer.DialContext(context.Background(), "tcp", "198.18.0.99:5432"); err == nil {
+		t.Error("expected error for unassigned fake IP")
+	}
+}
+
+func TestClusterDialerIsClusterTarget(t *testing.T) {
+	dialer := &ClusterDialer{Forwarders: map[string]*PortForwarder{"production": {Name: "production"}}}
+
+	for addr, want := range map[string]bool{
+		"grafana.monitoring.production:80":    true,
+		"node-worker-1.nodes.production:9100": true,
+		"evil.com:80":                         false,
+		"169.254.169.254:80":                  false,
+		"a.b.c.d.e.production:80":             false,
+	} {
+		if got := dialer.IsClusterTarget(addr); got != want {
+			t.Errorf("IsClusterTarget(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestClusterDialerUserNamespace(t *testing.T) {
+	var gotNamespace string
+
+	fwd := &PortForwarder{
+		Clientset:        fake.NewClientset(),
+		Name:             "production",
+		DefaultNamespace: "default",
+		resolveFunc: func(_ context.Context, namespace, _ string) ([]string, error) {
+			gotNamespace = namespace
+			return []string{"api-0"}, nil
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return &StreamConn{errDone: make(chan struct{})}, nil
+		},
+	}
+
+	namespaces := map[string]string{"alice": "team-a"}
+
+	dialer := &ClusterDialer{
+		Forwarders:    map[string]*PortForwarder{"production": fwd},
+		UserNamespace: func(user string) string { return namespaces[user] },
+	}
+
+	tests := []struct {
+		user string
+		addr string
+		want string
+	}{
+		{"alice", "api.production:8080", "team-a"},
+		{"alice", "api.billing.production:8080", "billing"},
+		{"bob", "api.production:8080", "default"},
+		{"", "api.production:8080", "default"},
+	}
+
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.user != "" {
+			ctx = auth.WithUser(ctx, tt.user)
+		}
+
+		if _, err := dialer.DialContext(ctx, "tcp", tt.addr); err != nil {
+			t.Fatalf("DialContext(%s as %q) error: %v", tt.addr, tt.user, err)
+		}
+
+		if gotNamespace != tt.want {
+			t.Errorf("DialContext(%s as %q) resolved in %q, want %q", tt.addr, tt.user, gotNamespace, tt.want)
+		}
+	}
+
+	// a pinned listener's namespace takes precedence over the user's.
+	pinned := &PinnedDialer{Forwarder: fwd, UserNamespace: dialer.UserNamespace}
+
+	if _, err := pinned.DialContext(auth.WithUser(context.Background(), "alice"), "tcp", "api:8080"); err != nil {
+		t.Fatalf("DialContext() error: %v", err)
+	}
+
+	if gotNamespace != "team-a" {
+		t.Errorf("pinned dial resolved in %q, want team-a", gotNamespace)
+	}
+
+	pinned.Namespace = "cache"
+
+	if _, err := pinned.DialContext(auth.WithUser(context.Background(), "alice"), "tcp", "api:8080"); err != nil {
+		t.Fatalf("DialContext() error: %v", err)
+	}
+
+	if gotNamespace != "cache" {
+		t.Errorf("pinned dial resolved in %q, want cache", gotNamespace)
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	dialed := false
+
+	fwd := &PortForwarder{
+		Name:             "production",
+		DefaultNamespace: "default",
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			dialed = true
+			return &StreamConn{errDone: make(chan struct{})}, nil
+		},
+	}
+	closed := &PortForwarder{Name: "staging", Policy: &AccessPolicy{OnCall: func() bool { return false }}}
+
+	dialer := &ClusterDialer{
+		Forwarders: map[string]*PortForwarder{"production": fwd, "staging": closed},
+		Visibility: &Visibility{Namespaces: []string{"default", "team-*"}},
+	}
+
+	tests := []struct {
+		addr string
+		want error
+	}{
+		{"api.production:8080", nil},
+		{"api.team-a.production:8080", nil},
+		{"example.com:443", nil},
+		{"api.secret.production:8080", ErrNotVisible},
+		{"a.b.c.d.production:8080", ErrInvalidTarget},
+		{"api.production:0", ErrInvalidTarget},
+		{"api.default.staging:8080", ErrAccessDenied},
+	}
+
+	for _, tt := range tests {
+		err := dialer.CheckTarget(context.Background(), tt.addr)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("CheckTarget(%s) = %v, want %v", tt.addr, err, tt.want)
+		}
+	}
+
+	pinned := &PinnedDialer{Forwarder: fwd, Visibility: &Visibility{Namespaces: []string{"default"}}}
+
+	if err := pinned.CheckTarget(context.Background(), "api:8080"); err != nil {
+		t.Errorf("pinned CheckTarget(api:8080) = %v", err)
+	}
+
+	if err := pinned.CheckTarget(context.Background(), "api.secret:8080"); !errors.Is(err, ErrNotVisible) {
+		t.Errorf("pinned CheckTarget(api.secret:8080) = %v, want %v", err, ErrNotVisible)
+	}
+
+	if dialed {
+		t.Error("CheckTarget dialed")
+	}
+}
+
 func TestDialTarget_RetriesOnTransientDialError(t *testing.T) {
 	var attempts int
 
@@ -216,10 +437,11 @@ func TestDialTarget_ReResolvesServiceOnRetry(t *testing.T) {
 	var resolveAttempts, dialAttempts int
 
 	fwd := &PortForwarder{
+		Clientset:   fake.NewClientset(),
 		baseBackoff: time.Millisecond,
-		resolveFunc: func(_ context.Context, _, _ string) (string, error) {
+		resolveFunc: func(_ context.Context, _, _ string) ([]string, error) {
 			resolveAttempts++
-			return fmt.Sprintf("pod-%d", resolveAttempts), nil
+			return []string{fmt.Sprintf("pod-%d", resolveAttempts)}, nil
 		},
 		dialFunc: func(_, pod string, _ int) (*StreamConn, error) {
 			dialAttempts++
@@ -254,14 +476,15 @@ func TestDialTarget_RetriesOnNoReadyPodEndpoints(t *testing.T) {
 	var resolveAttempts int
 
 	fwd := &PortForwarder{
+		Clientset:   fake.NewClientset(),
 		baseBackoff: time.Millisecond,
-		resolveFunc: func(_ context.Context, _, _ string) (string, error) {
+		resolveFunc: func(_ context.Context, _, _ string) ([]string, error) {
 			resolveAttempts++
 			if resolveAttempts < 3 {
-				return "", errors.New("no ready pod endpoints found for service ns/mysvc")
+				return nil, errors.New("no ready pod endpoints found for service ns/mysvc")
 			}
 
-			return "ready-pod", nil
+			return []string{"ready-pod"}, nil
 		},
 		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
 			return &StreamConn{errDone: make(chan struct{})}, nil
@@ -286,9 +509,9 @@ func TestDialTarget_NoRetryOnNonTransientResolveError(t *testing.T) {
 	var resolveAttempts int
 
 	fwd := &PortForwarder{
-		resolveFunc: func(_ context.Context, _, _ string) (string, error) {
+		resolveFunc: func(_ context.Context, _, _ string) ([]string, error) {
 			resolveAttempts++
-			return "", errors.New("forbidden")
+			return nil, errors.New("forbidden")
 		},
 		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
 			t.Fatal("dialFunc should not be called when resolve fails with non-transient error")
@@ -305,3 +528,300 @@ func TestDialTarget_NoRetryOnNonTransientResolveError(t *testing.T) {
 		t.Errorf("resolveAttempts = %d, want 1", resolveAttempts)
 	}
 }
+
+func TestDialTarget_CachesNegativeResolution(t *testing.T) {
+	var resolveAttempts int
+
+	fwd := &PortForwarder{
+		Clientset:        fake.NewClientset(),
+		NegativeCacheTTL: time.Minute,
+		resolveFunc: func(_ context.Context, ns, svc string) ([]string, error) {
+			resolveAttempts++
+			return nil, fmt.Errorf("%w: %s/%s has no endpoint slices", ErrServiceNotFound, ns, svc)
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			t.Fatal("dialFunc should not be called when resolve fails")
+			return nil, nil
+		},
+	}
+
+	for range 3 {
+		_, err := fwd.dialTarget(context.Background(), "mysvc.ns.cluster:8080", serviceTarget)
+		if !errors.Is(err, ErrServiceNotFound) {
+			t.Fatalf("error = %v, want ErrServiceNotFound", err)
+		}
+	}
+
+	if resolveAttempts != 1 {
+		t.Errorf("resolveAttempts = %d, want 1 (later dials should hit the cache)", resolveAttempts)
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	const d = time.Second
+
+	seen := map[time.Duration]bool{}
+
+	for range 100 {
+		got := jitter(d)
+		if got < d/2 || got >= d*3/2 {
+			t.Fatalf("jitter(%v) = %v, want within [%v, %v)", d, got, d/2, d*3/2)
+		}
+
+		seen[got] = true
+	}
+
+	if len(seen) < 2 {
+		t.Error("jitter should randomize the backoff")
+	}
+}
+
+func TestDialPod_Timeout(t *testing.T) {
+	// an API server that accepts connections but never answers.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	fwd := &PortForwarder{DialTimeout: 200 * time.Millisecond}
+
+	start := time.Now()
+
+	_, err = fwd.dialPod(context.Background(), &rest.Config{Host: "http://" + ln.Addr().String()}, "default", "web-0", 8080, 0)
+	if err == nil {
+		t.Fatal("expected dial to a blackholed API server to fail")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("dial took %v, want about the 200ms timeout", elapsed)
+	}
+
+	if !(RetryPolicy{}).retriable(err) {
+		t.Errorf("timeout error %v should be retriable", err)
+	}
+}
+
+func TestDialPod_Cancelled(t *testing.T) {
+	// an API server that accepts connections but never answers.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// no DialTimeout: only the client's context ends the dial.
+	fwd := &PortForwarder{}
+
+	start := time.Now()
+
+	_, err = fwd.dialPod(ctx, &rest.Config{Host: "http://" + ln.Addr().String()}, "default", "web-0", 8080, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("dialPod() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("dial took %v, want about the 200ms until cancellation", elapsed)
+	}
+}
+
+func TestClientsForImpersonation(t *testing.T) {
+	base := &rest.Config{Host: "https://production.example.com"}
+
+	fwd := &PortForwarder{
+		Config: base,
+		Impersonate: func(user string) rest.ImpersonationConfig {
+			return rest.ImpersonationConfig{UserName: user + "@example.com"}
+		},
+	}
+
+	cfg, _, err := fwd.clientsFor("")
+	if err != nil {
+		t.Fatalf("clientsFor() error: %v", err)
+	}
+
+	if cfg != base {
+		t.Error("unauthenticated connections should use the forwarder's own config")
+	}
+
+	cfg, clientset, err := fwd.clientsFor("alice")
+	if err != nil {
+		t.Fatalf("clientsFor() error: %v", err)
+	}
+
+	if cfg.Impersonate.UserName != "alice@example.com" {
+		t.Errorf("Impersonate.UserName = %q, want %q", cfg.Impersonate.UserName, "alice@example.com")
+	}
+
+	if base.Impersonate.UserName != "" {
+		t.Error("base config must not be modified")
+	}
+
+	cfg2, clientset2, _ := fwd.clientsFor("alice")
+	if cfg2 != cfg || clientset2 != clientset {
+		t.Error("expected cached clients for the same user")
+	}
+}
+
+func TestDialTargetImpersonationFollowsGroups(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		groups [][]string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		groups = append(groups, r.Header.Values("Impersonate-Group"))
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"kind":"Node","apiVersion":"v1","metadata":{"name":"worker-1"}}`)
+	}))
+	defer srv.Close()
+
+	// the groups of alice's latest login, as an LDAP or OIDC provider
+	// records them.
+	current := []string{"platform-admins"}
+
+	fwd := &PortForwarder{
+		Name:   "production",
+		Config: &rest.Config{Host: srv.URL},
+		Impersonate: func(user string) rest.ImpersonationConfig {
+			return rest.ImpersonationConfig{UserName: user, Groups: current}
+		},
+	}
+
+	ctx := auth.WithUser(context.Background(), "alice")
+	target := Target{Cluster: "production", Node: "worker-1", Port: 10250}
+
+	for _, g := range [][]string{{"platform-admins"}, {"developers"}} {
+		current = g
+
+		conn, err := fwd.dialTarget(ctx, "node-worker-1.nodes.production:10250", target)
+		if err != nil {
+			t.Fatalf("dialTarget: %v", err)
+		}
+
+		conn.Close()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(groups) != 2 || !slices.Equal(groups[0], []string{"platform-admins"}) || !slices.Equal(groups[1], []string{"developers"}) {
+		t.Errorf("Impersonate-Group headers = %v, want [platform-admins] then [developers]", groups)
+	}
+}
+
+func TestDialTarget_RecordsUser(t *testing.T) {
+	store := &memoryHistory{}
+
+	fwd := &PortForwarder{
+		History: store,
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return newTestStreamConn(), nil
+		},
+	}
+
+	conn, err := fwd.dialTarget(auth.WithUser(context.Background(), "alice"), "mypod.ns.production:8080", directPodTarget)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_ = conn.Close()
+
+	if len(store.records) != 1 || store.records[0].User != "alice" {
+		t.Errorf("records = %+v, want one record for alice", store.records)
+	}
+}
+
+// memoryHistory is an in-memory history.Store for tests.
+type memoryHistory struct {
+	records []history.Record
+}
+
+func (m *memoryHistory) Append(r history.Record) error {
+	m.records = append(m.records, r)
+	return nil
+}
+
+func (m *memoryHistory) Query(history.Filter) ([]history.Record, error) { return m.records, nil }
+func (m *memoryHistory) Close() error                                   { return nil }
+
+func TestDialTarget_RecordsHistory(t *testing.T) {
+	store := &memoryHistory{}
+
+	fwd := &PortForwarder{
+		Name:    "production",
+		History: store,
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return newTestStreamConn(), nil
+		},
+	}
+
+	conn, err := fwd.dialTarget(context.Background(), "mypod.ns.production:8080", directPodTarget)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_ = conn.Close()
+	_ = conn.Close()
+
+	if len(store.records) != 1 {
+		t.Fatalf("len(records) = %d, want 1", len(store.records))
+	}
+
+	rec := store.records[0]
+	if rec.Cluster != "production" || rec.Namespace != "ns" || rec.Target != "ns/mypod:8080" || rec.Outcome != history.OutcomeOK {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+}
+
+func TestDialTarget_RecordsFailedHistory(t *testing.T) {
+	store := &memoryHistory{}
+
+	fwd := &PortForwarder{
+		Name:    "production",
+		History: store,
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return nil, errors.New("forbidden")
+		},
+	}
+
+	if _, err := fwd.dialTarget(context.Background(), "mypod.ns.production:8080", directPodTarget); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if len(store.records) != 1 {
+		t.Fatalf("len(records) = %d, want 1", len(store.records))
+	}
+
+	if rec := store.records[0]; rec.Outcome != history.OutcomeError || rec.Error != "forbidden" {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+}
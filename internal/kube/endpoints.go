@@ -0,0 +1,117 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	discoveryv1listers "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// EndpointCache keeps the EndpointSlices of every cluster in an informer
+// cache, so service targets resolve without an API call per dial. The watch
+// keeps the cache current as pods become ready or go away.
+type EndpointCache struct {
+	Forwarders map[string]*PortForwarder
+
+	mu      sync.Mutex
+	listers map[string]endpointSliceCache
+}
+
+type endpointSliceCache struct {
+	lister discoveryv1listers.EndpointSliceLister
+	synced cache.InformerSynced
+}
+
+// Start starts an EndpointSlice informer per cluster, which is restarted
+// when the cluster's client is rebuilt. The informers stop when ctx is
+// cancelled.
+func (c *EndpointCache) Start(ctx context.Context) {
+	c.mu.Lock()
+	c.listers = make(map[string]endpointSliceCache, len(c.Forwarders))
+	c.mu.Unlock()
+
+	for name, fwd := range c.Forwarders {
+		fwd.watchClients(ctx, func(ctx context.Context, clientset kubernetes.Interface) {
+			factory := informers.NewSharedInformerFactory(clientset, 0)
+			endpointSlices := factory.Discovery().V1().EndpointSlices()
+
+			c.mu.Lock()
+			c.listers[name] = endpointSliceCache{
+				lister: endpointSlices.Lister(),
+				synced: endpointSlices.Informer().HasSynced,
+			}
+			c.mu.Unlock()
+
+			factory.Start(ctx.Done())
+		})
+	}
+}
+
+// Synced reports whether the EndpointSlices of cluster have been listed.
+func (c *EndpointCache) Synced(cluster string) bool {
+	c.mu.Lock()
+	ec, ok := c.listers[cluster]
+	c.mu.Unlock()
+
+	return ok && ec.synced()
+}
+
+// ServicePods returns the ready pods of a Service from the cache of cluster,
+// in the order ResolveServicePods returns them. ok is false if the cache
+// can't answer: the cluster isn't cached, hasn't synced yet, or has no
+// EndpointSlices for the Service, which may just not have reached the watch.
+// The caller then asks the API.
+func (c *EndpointCache) ServicePods(cluster, namespace, service string) (pods []string, ok bool) {
+	c.mu.Lock()
+	ec, cached := c.listers[cluster]
+	c.mu.Unlock()
+
+	if !cached || !ec.synced() {
+		return nil, false
+	}
+
+	list, err := ec.lister.EndpointSlices(namespace).List(labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service}))
+	if err != nil || len(list) == 0 {
+		return nil, false
+	}
+
+	// the API lists slices by name; the cache in no particular order.
+	slices.SortFunc(list, func(a, b *discoveryv1.EndpointSlice) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	for _, slice := range list {
+		pods = appendReadyPods(pods, slice.Endpoints)
+	}
+
+	return pods, true
+}
+
+// resolveServicePods resolves a service target from Endpoints when it can
+// answer for the cluster, and otherwise through the API with clientset.
+func (k *PortForwarder) resolveServicePods(ctx context.Context, clientset kubernetes.Interface, user, namespace, service string) ([]string, error) {
+	// the cache is read with the forwarder's own credentials, so
+	// impersonated users resolve through the API, where their RBAC applies.
+	if k.Endpoints == nil || (k.Impersonate != nil && user != "") {
+		return ResolveServicePods(ctx, clientset, namespace, service)
+	}
+
+	pods, ok := k.Endpoints.ServicePods(k.Name, namespace, service)
+	if !ok {
+		return ResolveServicePods(ctx, clientset, namespace, service)
+	}
+
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("%w found for service %s/%s", ErrNoReadyEndpoints, namespace, service)
+	}
+
+	return pods, nil
+}
@@ -0,0 +1,120 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func endpointSlice(name, service string, ready map[string]bool) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "cache",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+	}
+
+	for pod, r := range ready {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Conditions: discoveryv1.EndpointConditions{Ready: &r},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: pod},
+		})
+	}
+
+	return slice
+}
+
+func TestEndpointCache(t *testing.T) {
+	clientset := fake.NewClientset(
+		endpointSlice("redis-b", "redis", map[string]bool{"redis-1": true}),
+		endpointSlice("redis-a", "redis", map[string]bool{"redis-0": true, "redis-2": false}),
+		endpointSlice("api-a", "api", map[string]bool{"api-0": false}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fwd := &PortForwarder{Name: "production", Clientset: clientset}
+	cache := &EndpointCache{Forwarders: map[string]*PortForwarder{"production": fwd}}
+
+	if _, ok := cache.ServicePods("production", "cache", "redis"); ok {
+		t.Fatal("ServicePods() answered before Start")
+	}
+
+	cache.Start(ctx)
+	fwd.Endpoints = cache
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cache.Synced("production") {
+		if time.Now().After(deadline) {
+			t.Fatal("endpoint cache did not sync")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if pods, ok := cache.ServicePods("production", "cache", "redis"); !ok || !slices.Equal(pods, []string{"redis-0", "redis-1"}) {
+		t.Errorf("ServicePods(redis) = %v, %v, want [redis-0 redis-1]", pods, ok)
+	}
+
+	if _, ok := cache.ServicePods("production", "cache", "missing"); ok {
+		t.Error("ServicePods(missing) answered from the cache, want the API")
+	}
+
+	if _, ok := cache.ServicePods("staging", "cache", "redis"); ok {
+		t.Error("ServicePods() answered for a cluster that isn't cached")
+	}
+
+	if _, err := fwd.resolveServicePods(ctx, clientset, "", "cache", "api"); !errors.Is(err, ErrNoReadyEndpoints) {
+		t.Errorf("resolveServicePods(api) error = %v, want ErrNoReadyEndpoints", err)
+	}
+
+	// a Service the watch hasn't delivered yet is resolved through the API.
+	if _, err := fwd.resolveServicePods(ctx, clientset, "", "cache", "missing"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("resolveServicePods(missing) error = %v, want ErrServiceNotFound", err)
+	}
+
+	ready := true
+
+	_, err := clientset.DiscoveryV1().EndpointSlices("cache").Update(ctx, &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api-a",
+			Namespace: "cache",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "api"},
+		},
+		Endpoints: []discoveryv1.Endpoint{{
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: "api-0"},
+		}},
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+
+	for {
+		pods, err := fwd.resolveServicePods(ctx, clientset, "", "cache", "api")
+		if err == nil {
+			if !slices.Equal(pods, []string{"api-0"}) {
+				t.Errorf("resolveServicePods(api) after update = %v, want [api-0]", pods)
+			}
+
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("update did not reach the cache: %v", err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,64 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ExternalNameError is returned when resolving a Service of type
+// ExternalName, which has no pods but aliases a hostname outside the
+// cluster.
+type ExternalNameError struct {
+	Namespace string
+	Service   string
+	// Host is the externalName of the Service.
+	Host string
+}
+
+func (e *ExternalNameError) Error() string {
+	return fmt.Sprintf("service %s/%s is an ExternalName for %s", e.Namespace, e.Service, e.Host)
+}
+
+// externalNameOr returns an ExternalNameError if serviceName is an
+// ExternalName Service, and err otherwise. It is checked when a Service has
+// no endpoints, since ExternalName Services never do.
+func externalNameOr(ctx context.Context, clientset kubernetes.Interface, namespace, serviceName string, err error) error {
+	svc, getErr := clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if getErr != nil || svc.Spec.Type != corev1.ServiceTypeExternalName || svc.Spec.ExternalName == "" {
+		return err
+	}
+
+	return &ExternalNameError{Namespace: namespace, Service: serviceName, Host: strings.TrimSuffix(svc.Spec.ExternalName, ".")}
+}
+
+// dialExternalName dials the host of an ExternalName Service directly on
+// the port of target, as a passthrough connection.
+func (k *PortForwarder) dialExternalName(ctx context.Context, originalAddr string, ext *ExternalNameError, target Target, user string, connID uint64, start time.Time) (net.Conn, error) {
+	addr := net.JoinHostPort(ext.Host, strconv.Itoa(target.Port))
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		if k.Logger != nil {
+			k.Logger.Error("failed to connect", "addr", originalAddr, "external", addr, "error", err, "conn", connID)
+		}
+
+		err = fmt.Errorf("%w: %w", ext, err)
+		k.recordFailed(start, user, originalAddr, target, err)
+
+		return nil, err
+	}
+
+	if k.Logger != nil {
+		k.Logger.Info("connect", "addr", originalAddr, "external", addr, "user", user, "conn", connID)
+	}
+
+	return k.track(ctx, newNetConn(conn), start, user, originalAddr, target, addr, connID, nil), nil
+}
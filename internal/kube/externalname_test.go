@@ -0,0 +1,83 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResolveExternalName(t *testing.T) {
+	clientset := fake.NewClientset(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "billing", Namespace: "payments"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "billing.example.com."},
+	})
+
+	_, err := ResolveServicePods(context.Background(), clientset, "payments", "billing")
+
+	var ext *ExternalNameError
+	if !errors.As(err, &ext) || ext.Host != "billing.example.com" {
+		t.Fatalf("ResolveServicePods() error = %v, want an ExternalNameError for billing.example.com", err)
+	}
+
+	if _, err := ResolveServicePods(context.Background(), clientset, "payments", "missing"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("ResolveServicePods(missing) error = %v, want ErrServiceNotFound", err)
+	}
+}
+
+func TestDialTargetExternalName(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Write([]byte("ok"))
+			conn.Close()
+		}
+	}()
+
+	host, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	traffic := &Traffic{}
+
+	fwd := &PortForwarder{
+		Name:    "production",
+		Traffic: traffic,
+		resolveFunc: func(_ context.Context, ns, svc string) ([]string, error) {
+			return nil, &ExternalNameError{Namespace: ns, Service: svc, Host: host}
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			t.Fatal("dialFunc called for an ExternalName service")
+			return nil, nil
+		},
+	}
+
+	conn, err := fwd.dialTarget(context.Background(), "billing.payments.production:"+portStr, Target{
+		Namespace:   "payments",
+		ServiceName: "billing",
+		Port:        port,
+		IsService:   true,
+	})
+	if err != nil {
+		t.Fatalf("dialTarget: %v", err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 2)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "ok" {
+		t.Errorf("read %q, %v, want ok from the external host", buf, err)
+	}
+
+	if open := traffic.Open(); len(open) != 1 || open[0].Namespace != "payments" || open[0].Target != ln.Addr().String() {
+		t.Errorf("Open() = %+v, want the connection to %s", open, ln.Addr())
+	}
+}
@@ -0,0 +1,302 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/entwico/podproxy/internal/state"
+)
+
+// fakeIPBucket is the state bucket of the fake IP assignments.
+const fakeIPBucket = "fakeip"
+
+// ErrFakeIPsExhausted is returned when every address of a FakeIPPool is
+// assigned to a hostname.
+var ErrFakeIPsExhausted = errors.New("fake IP range exhausted")
+
+// FakeIPPool hands out a unique synthetic IP from a fixed range per hostname
+// and keeps a NAT table of the assignments, so clients that insist on
+// resolving a name before connecting can still reach cluster targets, and
+// connections to an assigned IP are mapped back to the hostname before
+// dialing. Assignments unused for longer than the TTL expire and their
+// addresses are reused.
+type FakeIPPool struct {
+	prefix netip.Prefix
+	ttl    time.Duration
+
+	mu     sync.Mutex
+	next   netip.Addr
+	byHost map[string]netip.Addr
+	byIP   map[netip.Addr]*fakeIPEntry
+
+	// test override — if nil, time.Now is used.
+	now func() time.Time
+}
+
+type fakeIPEntry struct {
+	host     string
+	lastUsed time.Time
+}
+
+// NewFakeIPPool creates a pool handing out addresses from cidr, starting at
+// the first address after the network address. With a positive ttl,
+// assignments not used for that long are removed by Expire.
+func NewFakeIPPool(cidr string, ttl time.Duration) (*FakeIPPool, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fake IP range: %w", err)
+	}
+
+	prefix = prefix.Masked()
+
+	return &FakeIPPool{
+		prefix: prefix,
+		ttl:    ttl,
+		next:   prefix.Addr().Next(),
+		byHost: make(map[string]netip.Addr),
+		byIP:   make(map[netip.Addr]*fakeIPEntry),
+	}, nil
+}
+
+// IP returns the address assigned to host, assigning the next free one on
+// first use. Hostnames are case-insensitive and may be fully qualified.
+func (p *FakeIPPool) IP(host string) (net.IP, error) {
+	host = normalizeHost(host)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if addr, ok := p.byHost[host]; ok {
+		p.byIP[addr].lastUsed = p.clock()
+		return addr.AsSlice(), nil
+	}
+
+	addr, ok := p.allocate()
+	if !ok {
+		return nil, ErrFakeIPsExhausted
+	}
+
+	p.byHost[host] = addr
+	p.byIP[addr] = &fakeIPEntry{host: host, lastUsed: p.clock()}
+
+	return addr.AsSlice(), nil
+}
+
+// allocate returns the next unassigned address after the last one handed
+// out, wrapping around at the end of the range. The network address is never
+// handed out. p.mu must be held.
+func (p *FakeIPPool) allocate() (netip.Addr, bool) {
+	first := p.prefix.Addr().Next()
+	if !p.prefix.Contains(first) {
+		return netip.Addr{}, false
+	}
+
+	start := p.next
+
+	for {
+		addr := p.next
+
+		p.next = addr.Next()
+		if !p.next.IsValid() || !p.prefix.Contains(p.next) {
+			p.next = first
+		}
+
+		if _, used := p.byIP[addr]; !used {
+			return addr, true
+		}
+
+		if p.next == start {
+			return netip.Addr{}, false
+		}
+	}
+}
+
+// Host returns the hostname ip is assigned to and marks the assignment used.
+func (p *FakeIPPool) Host(ip net.IP) (string, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return "", false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.byIP[addr.Unmap()]
+	if !ok {
+		return "", false
+	}
+
+	entry.lastUsed = p.clock()
+
+	return entry.host, true
+}
+
+// Contains reports whether ip lies within the pool's range.
+func (p *FakeIPPool) Contains(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	return ok && p.prefix.Contains(addr.Unmap())
+}
+
+// Translate maps a host:port address whose host is an assigned fake IP back
+// to the hostname. Other addresses are returned unchanged; an unassigned
+// address in the pool's range, e.g. one that expired, is an error. A nil pool
+// translates nothing.
+func (p *FakeIPPool) Translate(addr string) (string, error) {
+	if p == nil {
+		return addr, nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !p.Contains(ip) {
+		return addr, nil
+	}
+
+	name, ok := p.Host(ip)
+	if !ok {
+		return "", fmt.Errorf("fake IP %s is not assigned to a host", host)
+	}
+
+	return net.JoinHostPort(name, port), nil
+}
+
+// Expire removes assignments not used since now minus the TTL and returns
+// how many were removed. It does nothing without a TTL.
+func (p *FakeIPPool) Expire(now time.Time) int {
+	if p.ttl <= 0 {
+		return 0
+	}
+
+	cutoff := now.Add(-p.ttl)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	removed := 0
+
+	for addr, entry := range p.byIP {
+		if entry.lastUsed.Before(cutoff) {
+			delete(p.byIP, addr)
+			delete(p.byHost, entry.host)
+
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// RunExpiry removes expired assignments every interval until ctx is
+// cancelled.
+func (p *FakeIPPool) RunExpiry(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if removed := p.Expire(now); removed > 0 {
+				logger.Debug("expired fake IPs", "count", removed)
+			}
+		}
+	}
+}
+
+// savedFakeIP is an assignment as kept in a state store, keyed by hostname.
+type savedFakeIP struct {
+	IP       netip.Addr `json:"ip"`
+	LastUsed time.Time  `json:"lastUsed"`
+}
+
+// Save writes the assignments to store, replacing the ones saved before.
+func (p *FakeIPPool) Save(store state.Store) error {
+	p.mu.Lock()
+
+	entries := make(map[string][]byte, len(p.byIP))
+
+	for addr, entry := range p.byIP {
+		data, err := json.Marshal(savedFakeIP{IP: addr, LastUsed: entry.lastUsed})
+		if err != nil {
+			p.mu.Unlock()
+			return err
+		}
+
+		entries[entry.host] = data
+	}
+
+	p.mu.Unlock()
+
+	return store.Replace(fakeIPBucket, entries)
+}
+
+// Load restores the assignments saved to store, so clients that cached a
+// fake IP keep reaching its hostname after a restart. Assignments outside
+// the pool's range, expired ones, and ones whose address or hostname is
+// taken already are skipped. It returns how many were restored.
+func (p *FakeIPPool) Load(store state.Store) (int, error) {
+	entries, err := store.All(fakeIPBucket)
+	if err != nil {
+		return 0, err
+	}
+
+	now := p.clock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	restored := 0
+
+	for host, data := range entries {
+		var saved savedFakeIP
+		if err := json.Unmarshal(data, &saved); err != nil {
+			continue
+		}
+
+		if !p.prefix.Contains(saved.IP) || saved.IP == p.prefix.Addr() {
+			continue
+		}
+
+		if p.ttl > 0 && now.Sub(saved.LastUsed) > p.ttl {
+			continue
+		}
+
+		_, hostTaken := p.byHost[host]
+		_, ipTaken := p.byIP[saved.IP]
+
+		if hostTaken || ipTaken {
+			continue
+		}
+
+		p.byHost[host] = saved.IP
+		p.byIP[saved.IP] = &fakeIPEntry{host: host, lastUsed: saved.LastUsed}
+		restored++
+	}
+
+	return restored, nil
+}
+
+func (p *FakeIPPool) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+
+	return time.Now()
+}
+
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
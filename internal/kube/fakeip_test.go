@@ -0,0 +1,179 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/entwico/podproxy/internal/state"
+)
+
+func TestFakeIPPool(t *testing.T) {
+	pool, err := NewFakeIPPool("198.18.0.0/15", 0)
+	if err != nil {
+		t.Fatalf("NewFakeIPPool() error: %v", err)
+	}
+
+	first, err := pool.IP("postgres.production")
+	if err != nil {
+		t.Fatalf("IP() error: %v", err)
+	}
+
+	if !first.Equal(net.ParseIP("198.18.0.1")) {
+		t.Errorf("IP() = %v, want 198.18.0.1", first)
+	}
+
+	again, _ := pool.IP("Postgres.Production.")
+	if !again.Equal(first) {
+		t.Errorf("IP() for same host = %v, want %v", again, first)
+	}
+
+	second, _ := pool.IP("redis.production")
+	if !second.Equal(net.ParseIP("198.18.0.2")) {
+		t.Errorf("IP() = %v, want 198.18.0.2", second)
+	}
+
+	if host, ok := pool.Host(net.ParseIP("198.18.0.2")); !ok || host != "redis.production" {
+		t.Errorf("Host() = %q, %v, want redis.production, true", host, ok)
+	}
+
+	if _, ok := pool.Host(net.ParseIP("198.18.0.3")); ok {
+		t.Error("Host() of unassigned address should fail")
+	}
+
+	if !pool.Contains(net.ParseIP("198.19.255.255")) || pool.Contains(net.ParseIP("10.0.0.1")) {
+		t.Error("Contains() does not match the range")
+	}
+}
+
+func TestFakeIPPoolExhausted(t *testing.T) {
+	pool, err := NewFakeIPPool("10.0.0.0/31", 0)
+	if err != nil {
+		t.Fatalf("NewFakeIPPool() error: %v", err)
+	}
+
+	if _, err := pool.IP("a.production"); err != nil {
+		t.Fatalf("IP() error: %v", err)
+	}
+
+	if _, err := pool.IP("b.production"); !errors.Is(err, ErrFakeIPsExhausted) {
+		t.Errorf("IP() error = %v, want ErrFakeIPsExhausted", err)
+	}
+}
+
+func TestFakeIPPoolTranslate(t *testing.T) {
+	pool, _ := NewFakeIPPool("198.18.0.0/15", 0)
+	ip, _ := pool.IP("postgres.production")
+
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{net.JoinHostPort(ip.String(), "5432"), "postgres.production:5432", false},
+		{"10.0.0.1:5432", "10.0.0.1:5432", false},
+		{"postgres.production:5432", "postgres.production:5432", false},
+		{"198.18.0.99:5432", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := pool.Translate(tt.addr)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Translate(%q) = %q, %v, want %q (error: %v)", tt.addr, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if got, err := (*FakeIPPool)(nil).Translate("198.18.0.1:5432"); err != nil || got != "198.18.0.1:5432" {
+		t.Errorf("nil pool Translate() = %q, %v", got, err)
+	}
+}
+
+func TestFakeIPPoolExpire(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	pool, _ := NewFakeIPPool("10.0.0.0/30", time.Hour)
+	pool.now = func() time.Time { return now }
+
+	stale, _ := pool.IP("stale.production")
+
+	now = now.Add(30 * time.Minute)
+	fresh, _ := pool.IP("fresh.production")
+
+	if removed := pool.Expire(now.Add(45 * time.Minute)); removed != 1 {
+		t.Fatalf("Expire() removed %d, want 1", removed)
+	}
+
+	if _, ok := pool.Host(stale); ok {
+		t.Error("expired assignment still mapped")
+	}
+
+	if host, ok := pool.Host(fresh); !ok || host != "fresh.production" {
+		t.Errorf("Host() = %q, %v, want fresh.production, true", host, ok)
+	}
+
+	// the range wraps around and reuses the expired address.
+	third, _ := pool.IP("third.production")
+
+	reused, err := pool.IP("reused.production")
+	if err != nil {
+		t.Fatalf("IP() error: %v", err)
+	}
+
+	if !reused.Equal(stale) || third.Equal(stale) {
+		t.Errorf("IP() = %v after %v, want expired %v reused last", reused, third, stale)
+	}
+
+	if _, err := pool.IP("full.production"); !errors.Is(err, ErrFakeIPsExhausted) {
+		t.Errorf("IP() error = %v, want ErrFakeIPsExhausted", err)
+	}
+}
+
+func TestFakeIPPoolSaveLoad(t *testing.T) {
+	store := &state.Memory{}
+
+	pool, _ := NewFakeIPPool("198.18.0.0/15", time.Hour)
+	pool.IP("postgres.production")
+	pool.IP("redis.production")
+
+	if err := pool.Save(store); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	restarted, _ := NewFakeIPPool("198.18.0.0/15", time.Hour)
+
+	if n, err := restarted.Load(store); err != nil || n != 2 {
+		t.Fatalf("Load() = %d, %v, want 2", n, err)
+	}
+
+	if host, ok := restarted.Host(net.ParseIP("198.18.0.2")); !ok || host != "redis.production" {
+		t.Errorf("Host() after Load = %q, %v, want redis.production", host, ok)
+	}
+
+	// new hostnames don't get a restored address.
+	if ip, _ := restarted.IP("api.production"); ip.Equal(net.ParseIP("198.18.0.1")) || ip.Equal(net.ParseIP("198.18.0.2")) {
+		t.Errorf("IP() = %v, which is restored already", ip)
+	}
+
+	// a changed range drops the assignments outside of it.
+	moved, _ := NewFakeIPPool("100.64.0.0/10", time.Hour)
+
+	if n, _ := moved.Load(store); n != 0 {
+		t.Errorf("Load() into another range restored %d assignments, want 0", n)
+	}
+}
+
+func TestResolverFakeIPs(t *testing.T) {
+	_, ip, err := Resolver{}.Resolve(context.Background(), "postgres.production")
+	if err != nil || ip != nil {
+		t.Errorf("Resolve() without pool = %v, %v, want nil, nil", ip, err)
+	}
+
+	pool, _ := NewFakeIPPool("198.18.0.0/15", 0)
+
+	_, ip, err = Resolver{FakeIPs: pool}.Resolve(context.Background(), "postgres.production")
+	if err != nil || !ip.Equal(net.ParseIP("198.18.0.1")) {
+		t.Errorf("Resolve() with pool = %v, %v, want 198.18.0.1", ip, err)
+	}
+}
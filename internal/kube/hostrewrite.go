@@ -0,0 +1,100 @@
+package kube
+
+import (
+	"net"
+	"strings"
+)
+
+// HostRewriteRule sets the Host header of plain HTTP requests to matching
+// hosts, for in-cluster services that route by virtual host and reject the
+// podproxy hostname.
+type HostRewriteRule struct {
+	// Match is a hostname, or "*." followed by a suffix that matches every
+	// hostname ending in it (e.g. "*.production").
+	Match string
+	// Host is the Host header sent instead. {service}, {namespace} and
+	// {cluster} expand to the parts of the request's cluster target, e.g.
+	// "{service}.{namespace}.svc.cluster.local".
+	Host string
+}
+
+// HostRewriter applies the first matching rule to the Host header of plain
+// HTTP requests.
+type HostRewriter struct {
+	Forwarders map[string]*PortForwarder
+	Rules      []HostRewriteRule
+}
+
+// RewriteHost returns the Host header to send for a request to host, which
+// may include a port. The port is kept. Rules with placeholders only apply to
+// cluster targets.
+func (r *HostRewriter) RewriteHost(host string) (string, bool) {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, ""
+	}
+
+	name = normalizeHost(name)
+
+	for _, rule := range r.Rules {
+		if !matchHostPattern(rule.Match, name) {
+			continue
+		}
+
+		rewritten, ok := r.expand(rule.Host, name)
+		if !ok {
+			continue
+		}
+
+		if port != "" {
+			rewritten = net.JoinHostPort(rewritten, port)
+		}
+
+		return rewritten, true
+	}
+
+	return "", false
+}
+
+// expand replaces the placeholders of template with the parts of the cluster
+// target name addresses. It fails if template has placeholders and name is
+// not a cluster target.
+func (r *HostRewriter) expand(template, name string) (string, bool) {
+	if !strings.Contains(template, "{") {
+		return template, true
+	}
+
+	// the port is irrelevant to the parts that are substituted.
+	target, err := ParseTarget(net.JoinHostPort(name, "80"))
+	if err != nil {
+		return "", false
+	}
+
+	fwd, ok := r.Forwarders[target.Cluster]
+	if !ok {
+		return "", false
+	}
+
+	namespace := target.Namespace
+	if namespace == "" {
+		namespace = fwd.DefaultNamespace
+	}
+
+	return strings.NewReplacer(
+		"{service}", target.ServiceName,
+		"{namespace}", namespace,
+		"{cluster}", target.Cluster,
+	).Replace(template), true
+}
+
+// matchHostPattern reports whether host matches pattern, a hostname or "*."
+// followed by a suffix.
+func matchHostPattern(pattern, host string) bool {
+	pattern = normalizeHost(pattern)
+
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+
+	return host == pattern
+}
@@ -0,0 +1,38 @@
+package kube
+
+import "testing"
+
+func TestHostRewriter(t *testing.T) {
+	rewriter := &HostRewriter{
+		Forwarders: map[string]*PortForwarder{
+			"production": {Name: "production", DefaultNamespace: "default"},
+			"staging":    {Name: "staging"},
+		},
+		Rules: []HostRewriteRule{
+			{Match: "legacy.web.production", Host: "legacy.example.com"},
+			{Match: "*.production", Host: "{service}.{namespace}.svc.cluster.local"},
+			{Match: "*.example.com", Host: "{service}.{cluster}"},
+		},
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"legacy.web.production", "legacy.example.com"},
+		{"api.web.production:8080", "api.web.svc.cluster.local:8080"},
+		{"API.production", "api.default.svc.cluster.local"},
+		{"redis-0.redis.cache.production", "redis.cache.svc.cluster.local"},
+		{"api.web.staging", ""},
+		{"production", ""},
+		// placeholders need a cluster target.
+		{"www.example.com", ""},
+	}
+
+	for _, tt := range tests {
+		got, ok := rewriter.RewriteHost(tt.host)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("RewriteHost(%q) = %q, %v, want %q", tt.host, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IngressRoute is a host and path that an Ingress routes to a Service port.
+type IngressRoute struct {
+	Cluster string
+	// Host is the rule's hostname. It may start with "*." to match a single
+	// leading label.
+	Host      string
+	Path      string
+	Exact     bool
+	Namespace string
+	Service   string
+	Port      int
+}
+
+// Addr returns the podproxy address of the route's backend Service.
+func (r IngressRoute) Addr() string {
+	return net.JoinHostPort(r.Service+"."+r.Namespace+"."+r.Cluster, strconv.Itoa(r.Port))
+}
+
+// matchHost reports whether the route applies to host, and whether it does
+// through an exact rather than a wildcard hostname.
+func (r IngressRoute) matchHost(host string) (matched, exact bool) {
+	if suffix, ok := strings.CutPrefix(r.Host, "*"); ok {
+		label, rest, found := strings.Cut(host, ".")
+		return found && label != "" && "."+rest == suffix, false
+	}
+
+	return r.Host == host, true
+}
+
+// matchPath reports whether the route applies to path, following the
+// Ingress rules: Prefix paths match element-wise, so /foo matches /foo/bar
+// but not /foobar.
+func (r IngressRoute) matchPath(path string) bool {
+	if r.Exact {
+		return path == r.Path
+	}
+
+	prefix := strings.TrimSuffix(r.Path, "/")
+
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// externalDNSHostnameAnnotation lists the hostnames external-dns publishes
+// for a Service, comma-separated.
+const externalDNSHostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+
+// IngressRouter maps HTTP hostnames to the Services that cluster Ingress
+// resources route them to, so plain HTTP requests for application hostnames
+// can be forwarded the way the cluster's ingress controller would. Ingresses
+// are listed lazily and reused for RefreshInterval.
+type IngressRouter struct {
+	Forwarders map[string]*PortForwarder
+	// Clusters limits routing to these clusters. Empty routes all of them.
+	Clusters        []string
+	RefreshInterval time.Duration
+	Logger          *slog.Logger
+
+	// ServiceSelector, if set, is a label selector of Services that are
+	// routed under the hostnames of their external-dns hostname annotation,
+	// on port 80 or else their first port.
+	ServiceSelector string
+
+	mu     sync.Mutex
+	caches map[string]*ingressCache
+}
+
+type ingressCache struct {
+	routes  []IngressRoute
+	fetched time.Time
+}
+
+// Route returns the backend address for a request to host and path. When
+// several routes match, an exact hostname wins over a wildcard, then the
+// longest path, then an Exact path over a Prefix one.
+func (r *IngressRouter) Route(ctx context.Context, host, path string) (string, bool) {
+	host = normalizeHost(host)
+	if path == "" {
+		path = "/"
+	}
+
+	var (
+		best      IngressRoute
+		bestScore []int
+	)
+
+	for _, route := range r.Routes(ctx) {
+		hostMatched, exactHost := route.matchHost(host)
+		if !hostMatched || !route.matchPath(path) {
+			continue
+		}
+
+		score := []int{boolInt(exactHost), len(route.Path), boolInt(route.Exact)}
+		if bestScore == nil || slices.Compare(score, bestScore) > 0 {
+			best, bestScore = route, score
+		}
+	}
+
+	if bestScore == nil {
+		return "", false
+	}
+
+	return best.Addr(), true
+}
+
+// Hostnames returns the distinct hostnames of all routes, sorted.
+func (r *IngressRouter) Hostnames(ctx context.Context) []string {
+	var hosts []string
+
+	for _, route := range r.Routes(ctx) {
+		hosts = append(hosts, route.Host)
+	}
+
+	slices.Sort(hosts)
+
+	return slices.Compact(hosts)
+}
+
+// Routes returns the routes of every routed cluster, listing the Ingresses of
+// clusters whose cached routes are older than RefreshInterval again.
+func (r *IngressRouter) Routes(ctx context.Context) []IngressRoute {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.caches == nil {
+		r.caches = make(map[string]*ingressCache)
+	}
+
+	var routes []IngressRoute
+
+	for _, cluster := range r.clusters() {
+		cache := r.caches[cluster]
+		if cache == nil || time.Since(cache.fetched) >= r.RefreshInterval {
+			cache = r.refresh(ctx, cluster, cache)
+			r.caches[cluster] = cache
+		}
+
+		routes = append(routes, cache.routes...)
+	}
+
+	return routes
+}
+
+func (r *IngressRouter) clusters() []string {
+	if len(r.Clusters) > 0 {
+		return r.Clusters
+	}
+
+	names := make([]string, 0, len(r.Forwarders))
+	for name := range r.Forwarders {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// refresh lists the Ingresses of cluster. On failure the previous routes are
+// kept until the next refresh.
+func (r *IngressRouter) refresh(ctx context.Context, cluster string, previous *ingressCache) *ingressCache {
+	cache := &ingressCache{fetched: time.Now()}
+
+	fwd := r.Forwarders[cluster]
+	if fwd == nil {
+		return cache
+	}
+
+	routes, err := listIngressRoutes(ctx, fwd, cluster)
+	if err == nil && r.ServiceSelector != "" {
+		var serviceRoutes []IngressRoute
+
+		serviceRoutes, err = listServiceRoutes(ctx, fwd, cluster, r.ServiceSelector)
+		routes = append(routes, serviceRoutes...)
+	}
+
+	if err != nil {
+		if r.Logger != nil {
+			r.Logger.Warn("listing ingresses failed", "cluster", cluster, "error", err)
+		}
+
+		if previous != nil {
+			cache.routes = previous.routes
+		}
+
+		return cache
+	}
+
+	cache.routes = routes
+
+	return cache
+}
+
+// listIngressRoutes lists the Ingresses of all namespaces and flattens their
+// rules into routes. Backends referring to a named Service port are resolved
+// to the port number; backends that are not Services are skipped.
+func listIngressRoutes(ctx context.Context, fwd *PortForwarder, cluster string) ([]IngressRoute, error) {
+	_, clientset := fwd.Clients()
+
+	ingresses, err := clientset.NetworkingV1().Ingresses(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing ingresses: %w", err)
+	}
+
+	ports := namedPortResolver{fwd: fwd}
+
+	var routes []IngressRoute
+
+	for _, ing := range ingresses.Items {
+		for _, rule := range ing.Spec.Rules {
+			if rule.Host == "" || rule.HTTP == nil {
+				continue
+			}
+
+			for _, p := range rule.HTTP.Paths {
+				if p.Backend.Service == nil {
+					continue
+				}
+
+				port, ok := ports.port(ctx, ing.Namespace, p.Backend.Service)
+				if !ok {
+					continue
+				}
+
+				path := p.Path
+				if path == "" {
+					path = "/"
+				}
+
+				routes = append(routes, IngressRoute{
+					Cluster:   cluster,
+					Host:      normalizeHost(rule.Host),
+					Path:      path,
+					Exact:     p.PathType != nil && *p.PathType == networkingv1.PathTypeExact,
+					Namespace: ing.Namespace,
+					Service:   p.Backend.Service.Name,
+					Port:      port,
+				})
+			}
+		}
+	}
+
+	return routes, nil
+}
+
+// listServiceRoutes lists the Services matching selector in all namespaces
+// and routes the hostnames of their external-dns annotation to them.
+func listServiceRoutes(ctx context.Context, fwd *PortForwarder, cluster, selector string) ([]IngressRoute, error) {
+	_, clientset := fwd.Clients()
+
+	services, err := clientset.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("listing services: %w", err)
+	}
+
+	var routes []IngressRoute
+
+	for _, svc := range services.Items {
+		annotation := svc.Annotations[externalDNSHostnameAnnotation]
+		if annotation == "" || len(svc.Spec.Ports) == 0 {
+			continue
+		}
+
+		port := httpServicePort(svc.Spec.Ports)
+
+		for host := range strings.SplitSeq(annotation, ",") {
+			if host = normalizeHost(strings.TrimSpace(host)); host == "" {
+				continue
+			}
+
+			routes = append(routes, IngressRoute{
+				Cluster:   cluster,
+				Host:      host,
+				Path:      "/",
+				Namespace: svc.Namespace,
+				Service:   svc.Name,
+				Port:      port,
+			})
+		}
+	}
+
+	return routes, nil
+}
+
+// httpServicePort returns port 80 if the Service has it, else its first port.
+func httpServicePort(ports []corev1.ServicePort) int {
+	for _, p := range ports {
+		if p.Port == 80 {
+			return 80
+		}
+	}
+
+	return int(ports[0].Port)
+}
+
+// namedPortResolver looks up the numbers of named Service ports, fetching
+// each Service at most once.
+type namedPortResolver struct {
+	fwd      *PortForwarder
+	services map[string]map[string]int
+}
+
+func (n *namedPortResolver) port(ctx context.Context, namespace string, backend *networkingv1.IngressServiceBackend) (int, bool) {
+	if backend.Port.Name == "" {
+		return int(backend.Port.Number), backend.Port.Number > 0
+	}
+
+	key := namespace + "/" + backend.Name
+
+	if n.services == nil {
+		n.services = make(map[string]map[string]int)
+	}
+
+	ports, ok := n.services[key]
+	if !ok {
+		ports = make(map[string]int)
+
+		_, clientset := n.fwd.Clients()
+
+		svc, err := clientset.CoreV1().Services(namespace).Get(ctx, backend.Name, metav1.GetOptions{})
+		if err == nil {
+			for _, sp := range svc.Spec.Ports {
+				ports[sp.Name] = int(sp.Port)
+			}
+		}
+
+		n.services[key] = ports
+	}
+
+	port, ok := ports[backend.Port.Name]
+
+	return port, ok
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,102 @@
+package kube
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func ingressPath(path string, pathType networkingv1.PathType, service string, port networkingv1.ServiceBackendPort) networkingv1.HTTPIngressPath {
+	return networkingv1.HTTPIngressPath{
+		Path:     path,
+		PathType: &pathType,
+		Backend: networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{Name: service, Port: port},
+		},
+	}
+}
+
+func TestIngressRouter(t *testing.T) {
+	clientset := fake.NewClientset(
+		&networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "web"},
+			Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{
+				{
+					Host: "myapp.dev.example.com",
+					IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{
+						ingressPath("/", networkingv1.PathTypePrefix, "frontend", networkingv1.ServiceBackendPort{Number: 80}),
+						ingressPath("/api", networkingv1.PathTypePrefix, "api", networkingv1.ServiceBackendPort{Name: "http"}),
+						ingressPath("/api/health", networkingv1.PathTypeExact, "health", networkingv1.ServiceBackendPort{Number: 8081}),
+					}}},
+				},
+				{
+					Host: "*.dev.example.com",
+					IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{
+						ingressPath("/", networkingv1.PathTypePrefix, "catchall", networkingv1.ServiceBackendPort{Number: 80}),
+					}}},
+				},
+			}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "web"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 8080}}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "grafana",
+				Namespace:   "monitoring",
+				Labels:      map[string]string{"podproxy/route": "true"},
+				Annotations: map[string]string{externalDNSHostnameAnnotation: "grafana.example.com, metrics.example.com"},
+			},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 3000}}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "unselected",
+				Namespace:   "monitoring",
+				Annotations: map[string]string{externalDNSHostnameAnnotation: "unselected.example.com"},
+			},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+	)
+
+	router := &IngressRouter{
+		Forwarders:      map[string]*PortForwarder{"production": {Name: "production", Clientset: clientset}},
+		RefreshInterval: time.Minute,
+		ServiceSelector: "podproxy/route=true",
+	}
+
+	tests := []struct {
+		host, path string
+		want       string
+	}{
+		{"myapp.dev.example.com", "/", "frontend.web.production:80"},
+		{"MyApp.dev.example.com", "/apis", "frontend.web.production:80"},
+		{"myapp.dev.example.com", "/api/users", "api.web.production:8080"},
+		{"myapp.dev.example.com", "/api/health", "health.web.production:8081"},
+		{"myapp.dev.example.com", "/api/health/deep", "api.web.production:8080"},
+		{"other.dev.example.com", "/", "catchall.web.production:80"},
+		{"a.b.dev.example.com", "/", ""},
+		{"metrics.example.com", "/d/home", "grafana.monitoring.production:3000"},
+		{"unselected.example.com", "/", ""},
+		{"github.com", "/", ""},
+	}
+
+	for _, tt := range tests {
+		got, ok := router.Route(context.Background(), tt.host, tt.path)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("Route(%q, %q) = %q, %v, want %q", tt.host, tt.path, got, ok, tt.want)
+		}
+	}
+
+	want := []string{"*.dev.example.com", "grafana.example.com", "metrics.example.com", "myapp.dev.example.com"}
+	if got := router.Hostnames(context.Background()); !slices.Equal(got, want) {
+		t.Errorf("Hostnames() = %v, want %v", got, want)
+	}
+}
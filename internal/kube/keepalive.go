@@ -0,0 +1,100 @@
+package kube
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	streamspdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport/spdy"
+
+	"github.com/entwico/podproxy/internal/proxyproto"
+)
+
+// ClientKeepaliveFunc enables TCP keepalive probes every period on the
+// connection of the proxy client at client, e.g. ConnTracker.SetKeepAlive.
+type ClientKeepaliveFunc func(client net.Addr, period time.Duration) bool
+
+// Keepalive returns a DialMiddleware keeping connections matching a route
+// with keepalive periods alive while idle: upstream, with SPDY pings on
+// port-forwards and TCP keepalive probes on passthrough connections, and
+// toward the client through client. Clients are only known for SOCKS5
+// connections and HTTP CONNECT tunnels.
+func (r Routes) Keepalive(client ClientKeepaliveFunc) DialMiddleware {
+	return func(next DialFunc) DialFunc {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			route := r.match(addr)
+			if route == nil {
+				return next(ctx, network, addr)
+			}
+
+			if route.UpstreamKeepalive > 0 {
+				ctx = context.WithValue(ctx, upstreamKeepaliveKey{}, route.UpstreamKeepalive)
+			}
+
+			conn, err := next(ctx, network, addr)
+
+			if c := proxyproto.ClientAddr(ctx); err == nil && route.ClientKeepalive > 0 && c != nil && client != nil {
+				client(c, route.ClientKeepalive)
+			}
+
+			return conn, err
+		}
+	}
+}
+
+type upstreamKeepaliveKey struct{}
+
+// upstreamKeepalive returns the keepalive period of the upstream connection
+// dialed with ctx, or zero for the default.
+func upstreamKeepalive(ctx context.Context) time.Duration {
+	period, _ := ctx.Value(upstreamKeepaliveKey{}).(time.Duration)
+	return period
+}
+
+// keepaliveDialer returns a dialer for passthrough connections sending TCP
+// keepalive probes after period of idleness and every period after. Zero
+// keeps Go's defaults.
+func keepaliveDialer(period time.Duration) *net.Dialer {
+	if period <= 0 {
+		return &net.Dialer{}
+	}
+
+	return &net.Dialer{KeepAliveConfig: net.KeepAliveConfig{Enable: true, Idle: period, Interval: period}}
+}
+
+// spdyRoundTripperFor is spdy.RoundTripperFor pinging the API server every
+// pingPeriod instead of client-go's 5 seconds. Zero keeps the default.
+func spdyRoundTripperFor(config *rest.Config, pingPeriod time.Duration) (http.RoundTripper, spdy.Upgrader, error) {
+	if pingPeriod <= 0 {
+		return spdy.RoundTripperFor(config)
+	}
+
+	tlsConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proxier := http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		proxier = config.Proxy
+	}
+
+	upgrader, err := streamspdy.NewRoundTripperWithConfig(streamspdy.RoundTripperConfig{
+		TLS:        tlsConfig,
+		Proxier:    proxier,
+		PingPeriod: pingPeriod,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrapper, err := rest.HTTPWrappersForConfig(config, upgrader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return wrapper, upgrader, nil
+}
@@ -0,0 +1,78 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/entwico/podproxy/internal/proxyproto"
+)
+
+func TestRoutesKeepalive(t *testing.T) {
+	routes := Routes{
+		{Match: "db.*.production:5432", ClientKeepalive: 30 * time.Second, UpstreamKeepalive: time.Minute},
+		{Match: "*.production"},
+	}
+
+	var (
+		upstream time.Duration
+		client   net.Addr
+		period   time.Duration
+		dialErr  error
+	)
+
+	dial := routes.Keepalive(func(c net.Addr, p time.Duration) bool {
+		client, period = c, p
+		return true
+	})(func(ctx context.Context, _, _ string) (net.Conn, error) {
+		upstream = upstreamKeepalive(ctx)
+		if dialErr != nil {
+			return nil, dialErr
+		}
+
+		return newTestStreamConn(), nil
+	})
+
+	clientAddr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000}
+	ctx := proxyproto.WithClientAddr(context.Background(), clientAddr)
+
+	conn, err := dial(ctx, "tcp", "db.app.production:5432")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close()
+
+	if upstream != time.Minute {
+		t.Errorf("upstream keepalive = %s, want 1m", upstream)
+	}
+
+	if client != clientAddr || period != 30*time.Second {
+		t.Errorf("client keepalive = %v every %s, want %v every 30s", client, period, clientAddr)
+	}
+
+	// routes without keepalive periods keep the defaults.
+	client, period = nil, 0
+
+	conn, err = dial(ctx, "tcp", "redis.cache.production:6379")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close()
+
+	if upstream != 0 || client != nil {
+		t.Errorf("unconfigured route: upstream keepalive = %s, client = %v; want defaults", upstream, client)
+	}
+
+	// a failed dial leaves the client connection alone.
+	dialErr = errors.New("connection refused")
+
+	if _, err := dial(ctx, "tcp", "db.app.production:5432"); !errors.Is(err, dialErr) {
+		t.Fatalf("dial error = %v, want %v", err, dialErr)
+	}
+
+	if client != nil {
+		t.Errorf("client keepalive enabled for %v after failed dial", client)
+	}
+}
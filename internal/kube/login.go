@@ -0,0 +1,125 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLoginRequired means the cluster's credentials need an interactive
+// login, e.g. because the OIDC refresh token of kubelogin expired.
+var ErrLoginRequired = errors.New("login required")
+
+// loginProbeInterval is how often a connection is let through to a cluster
+// awaiting login, to notice that the login has completed.
+const loginProbeInterval = 10 * time.Second
+
+// LoginState describes a cluster whose credentials need an interactive login.
+type LoginState struct {
+	Since time.Time
+	// Error is the authentication error that started the wait.
+	Error string
+	// LoginURL is the URL the credential plugin asked to open, if any.
+	LoginURL string
+}
+
+// loginURLPattern finds the URL credential plugins such as kubelogin print
+// for the user to open.
+var loginURLPattern = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+// loginGate fails connections fast while a cluster awaits login, instead of
+// sending every connection into the same authentication error.
+type loginGate struct {
+	mu        sync.Mutex
+	state     *LoginState
+	nextProbe time.Time
+}
+
+// check returns the pending login, if any. One connection per
+// loginProbeInterval passes as a probe and gets nil.
+func (g *loginGate) check(now time.Time) *LoginState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == nil {
+		return nil
+	}
+
+	if !now.Before(g.nextProbe) {
+		g.nextProbe = now.Add(loginProbeInterval)
+		return nil
+	}
+
+	state := *g.state
+
+	return &state
+}
+
+// LoginRequired returns the pending login of the cluster, if its credentials
+// need an interactive login.
+func (k *PortForwarder) LoginRequired() (LoginState, bool) {
+	k.login.mu.Lock()
+	defer k.login.mu.Unlock()
+
+	if k.login.state == nil {
+		return LoginState{}, false
+	}
+
+	return *k.login.state, true
+}
+
+// loginFailed records that err means the cluster awaits login. The first
+// failure is logged and reported to OnLoginRequired.
+func (k *PortForwarder) loginFailed(err error, now time.Time) {
+	k.login.mu.Lock()
+
+	if k.login.state != nil {
+		k.login.mu.Unlock()
+		return
+	}
+
+	state := LoginState{Since: now, Error: err.Error(), LoginURL: loginURLPattern.FindString(err.Error())}
+	k.login.state = &state
+	k.login.nextProbe = now.Add(loginProbeInterval)
+	k.login.mu.Unlock()
+
+	if k.Logger != nil {
+		k.Logger.Warn("cluster requires login; connections fail until it completes", "login_url", state.LoginURL, "error", err)
+	}
+
+	if k.OnLoginRequired != nil {
+		k.OnLoginRequired(k.Name, state)
+	}
+}
+
+// loginSucceeded ends a pending login after a connection got through.
+func (k *PortForwarder) loginSucceeded() {
+	k.login.mu.Lock()
+	pending := k.login.state != nil
+	k.login.state = nil
+	k.login.mu.Unlock()
+
+	if pending && k.Logger != nil {
+		k.Logger.Info("cluster login completed; resuming connections")
+	}
+}
+
+// loginError is the error of connections failed fast while state is pending.
+func loginError(cluster string, state *LoginState) error {
+	hint := "log in with the cluster's credential plugin, e.g. kubectl oidc-login"
+	if state.LoginURL != "" {
+		hint = "open " + state.LoginURL + " to log in"
+	}
+
+	return fmt.Errorf("%w: cluster %s: %s", ErrLoginRequired, cluster, hint)
+}
+
+// isLoginError reports whether err means the cluster rejected or couldn't
+// obtain credentials, as opposed to a network or authorization failure.
+func isLoginError(err error) bool {
+	// exec credential plugin failures and 401s, also on the SPDY upgrade.
+	return isUnauthorized(err) || strings.Contains(err.Error(), "getting credentials")
+}
@@ -0,0 +1,91 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDialTarget_LoginRequired(t *testing.T) {
+	var (
+		dials    int
+		loggedIn bool
+		notified []LoginState
+	)
+
+	fwd := &PortForwarder{
+		Name: "prod",
+		OnLoginRequired: func(cluster string, state LoginState) {
+			if cluster != "prod" {
+				t.Errorf("cluster = %q, want prod", cluster)
+			}
+
+			notified = append(notified, state)
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			dials++
+			if !loggedIn {
+				return nil, errors.New("getting credentials: exec: error: open http://localhost:8000/login?state=abc in your browser")
+			}
+
+			return &StreamConn{errDone: make(chan struct{})}, nil
+		},
+	}
+
+	if _, err := fwd.dialTarget(context.Background(), "mypod.ns.prod:8080", directPodTarget); err == nil {
+		t.Fatal("expected error")
+	}
+
+	state, ok := fwd.LoginRequired()
+	if !ok {
+		t.Fatal("LoginRequired() = false after a credentials error")
+	}
+
+	if want := "http://localhost:8000/login?state=abc"; state.LoginURL != want {
+		t.Errorf("LoginURL = %q, want %q", state.LoginURL, want)
+	}
+
+	// until the next probe, dials fail fast with an actionable error.
+	_, err := fwd.dialTarget(context.Background(), "mypod.ns.prod:8080", directPodTarget)
+	if !errors.Is(err, ErrLoginRequired) {
+		t.Fatalf("error = %v, want ErrLoginRequired", err)
+	}
+
+	if dials != 1 {
+		t.Errorf("dials = %d, want 1 (should fail fast while awaiting login)", dials)
+	}
+
+	if len(notified) != 1 {
+		t.Errorf("OnLoginRequired called %d times, want 1", len(notified))
+	}
+
+	loggedIn = true
+	fwd.login.nextProbe = time.Time{}
+
+	if _, err := fwd.dialTarget(context.Background(), "mypod.ns.prod:8080", directPodTarget); err != nil {
+		t.Fatalf("probe after login: %v", err)
+	}
+
+	if _, ok := fwd.LoginRequired(); ok {
+		t.Error("LoginRequired() = true after a successful dial")
+	}
+}
+
+func TestIsLoginError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("getting credentials: exec: executable kubelogin failed with exit code 1"), true},
+		{errors.New("error upgrading connection: Unauthorized"), true},
+		{errors.New("pods \"x\" is forbidden"), false},
+		{errors.New("connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isLoginError(tt.err); got != tt.want {
+			t.Errorf("isLoginError(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ErrNotHeadless is returned when enumerating the members of a Service that
+// has a cluster IP.
+var ErrNotHeadless = errors.New("service is not headless")
+
+// Member is a pod behind a headless Service, e.g. a StatefulSet replica.
+type Member struct {
+	Pod string
+	// Hostname is the hostname the pod has in the Service's DNS records, if
+	// it sets one.
+	Hostname string
+	Ready    bool
+}
+
+// ServiceMembers lists the pods behind the headless Service serviceName,
+// ready or not, sorted by name. Each is reachable as
+// <pod>.<service>.<namespace>.<cluster>.
+func ServiceMembers(ctx context.Context, clientset kubernetes.Interface, namespace, serviceName string) ([]Member, error) {
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrServiceNotFound, namespace, serviceName)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("getting service %s/%s: %w", namespace, serviceName, err)
+	}
+
+	if svc.Spec.ClusterIP != corev1.ClusterIPNone {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotHeadless, namespace, serviceName)
+	}
+
+	list, err := clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + serviceName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing endpoint slices for service %s/%s: %w", namespace, serviceName, err)
+	}
+
+	var members []Member
+
+	for _, slice := range list.Items {
+		for _, ep := range slice.Endpoints {
+			if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+				continue
+			}
+
+			// dual-stack services list each pod in a slice per address family.
+			if slices.ContainsFunc(members, func(m Member) bool { return m.Pod == ep.TargetRef.Name }) {
+				continue
+			}
+
+			m := Member{Pod: ep.TargetRef.Name, Ready: ep.Conditions.Ready == nil || *ep.Conditions.Ready}
+			if ep.Hostname != nil {
+				m.Hostname = *ep.Hostname
+			}
+
+			members = append(members, m)
+		}
+	}
+
+	slices.SortFunc(members, func(a, b Member) int { return strings.Compare(a.Pod, b.Pod) })
+
+	return members, nil
+}
+
+// Members lists the pods behind the headless Service service of the cluster.
+// An empty namespace is the cluster's default.
+func (k *PortForwarder) Members(ctx context.Context, namespace, service string) ([]Member, error) {
+	if namespace == "" {
+		namespace = k.DefaultNamespace
+	}
+
+	_, clientset := k.Clients()
+
+	return ServiceMembers(ctx, clientset, namespace, service)
+}
+
+// memberTarget returns the pod target for a service target that names a
+// member pod of a headless Service instead, such as mongo-0.db.production
+// for the StatefulSet pod mongo-0 of the Service mongo. The pod's subdomain
+// names the Service.
+func memberTarget(ctx context.Context, clientset kubernetes.Interface, target Target) (Target, bool) {
+	pod, err := clientset.CoreV1().Pods(target.Namespace).Get(ctx, target.ServiceName, metav1.GetOptions{})
+	if err != nil || pod.Spec.Subdomain == "" {
+		return target, false
+	}
+
+	members, err := ServiceMembers(ctx, clientset, target.Namespace, pod.Spec.Subdomain)
+	if err != nil || !slices.ContainsFunc(members, func(m Member) bool { return m.Pod == pod.Name }) {
+		return target, false
+	}
+
+	return Target{
+		Cluster:     target.Cluster,
+		PodName:     pod.Name,
+		ServiceName: pod.Spec.Subdomain,
+		Namespace:   target.Namespace,
+		Port:        target.Port,
+	}, true
+}
@@ -0,0 +1,94 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func headlessFixture() *fake.Clientset {
+	pod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cache"},
+			Spec:       corev1.PodSpec{Hostname: name, Subdomain: "mongo"},
+		}
+	}
+
+	return fake.NewClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "mongo", Namespace: "cache"},
+			Spec:       corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "cache"},
+			Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.10"},
+		},
+		endpointSlice("mongo-v4", "mongo", map[string]bool{"mongo-1": false}),
+		endpointSlice("mongo-v6", "mongo", map[string]bool{"mongo-0": true, "mongo-1": false}),
+		pod("mongo-0"),
+		pod("mongo-1"),
+	)
+}
+
+func TestServiceMembers(t *testing.T) {
+	clientset := headlessFixture()
+
+	members, err := ServiceMembers(context.Background(), clientset, "cache", "mongo")
+	if err != nil {
+		t.Fatalf("ServiceMembers() error: %v", err)
+	}
+
+	want := []Member{{Pod: "mongo-0", Ready: true}, {Pod: "mongo-1", Ready: false}}
+	if !slices.Equal(members, want) {
+		t.Errorf("ServiceMembers() = %+v, want %+v", members, want)
+	}
+
+	if _, err := ServiceMembers(context.Background(), clientset, "cache", "redis"); !errors.Is(err, ErrNotHeadless) {
+		t.Errorf("ServiceMembers(redis) error = %v, want ErrNotHeadless", err)
+	}
+
+	if _, err := ServiceMembers(context.Background(), clientset, "cache", "missing"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("ServiceMembers(missing) error = %v, want ErrServiceNotFound", err)
+	}
+}
+
+func TestDialTargetMemberWithoutService(t *testing.T) {
+	var dialed string
+
+	fwd := &PortForwarder{
+		Name:      "production",
+		Clientset: headlessFixture(),
+		resolveFunc: func(_ context.Context, ns, svc string) ([]string, error) {
+			return nil, fmt.Errorf("%w: %s/%s has no endpoint slices", ErrServiceNotFound, ns, svc)
+		},
+		dialFunc: func(_, pod string, _ int) (*StreamConn, error) {
+			dialed = pod
+			return newTestStreamConn(), nil
+		},
+	}
+
+	// mongo-1.cache.production names the pod, not a Service.
+	target, _ := ParseTarget("mongo-1.cache.production:27017")
+
+	conn, err := fwd.dialTarget(context.Background(), "mongo-1.cache.production:27017", target)
+	if err != nil {
+		t.Fatalf("dialTarget: %v", err)
+	}
+	conn.Close()
+
+	if dialed != "mongo-1" {
+		t.Errorf("dialed pod %q, want mongo-1", dialed)
+	}
+
+	target, _ = ParseTarget("mongo-2.cache.production:27017")
+
+	if _, err := fwd.dialTarget(context.Background(), "mongo-2.cache.production:27017", target); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("dialTarget(mongo-2) error = %v, want ErrServiceNotFound", err)
+	}
+}
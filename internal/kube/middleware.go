@@ -0,0 +1,38 @@
+package kube
+
+import (
+	"context"
+	"net"
+)
+
+// DialFunc dials addr, like net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// DialMiddleware wraps a DialFunc with cross-cutting behavior such as
+// checks, quotas, metrics or address rewrites. It may call next with a
+// different address, return an error without calling it, or wrap the
+// connection it returns.
+type DialMiddleware func(next DialFunc) DialFunc
+
+// chain returns dial wrapped in middleware, the first one outermost.
+func chain(dial DialFunc, middleware []DialMiddleware) DialFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		dial = middleware[i](dial)
+	}
+
+	return dial
+}
+
+// Use registers middleware around every dial, in order: the first one
+// registered sees the address first. Middleware sees addresses with fake IPs
+// already translated back to hostnames, and runs before the cluster is
+// picked, so a rewrite may move a connection to another cluster or to
+// passthrough. Use must not be called concurrently with DialContext.
+func (d *ClusterDialer) Use(middleware ...DialMiddleware) {
+	d.middleware = append(d.middleware, middleware...)
+}
+
+// Use registers middleware around every dial, like ClusterDialer.Use.
+func (d *PinnedDialer) Use(middleware ...DialMiddleware) {
+	d.middleware = append(d.middleware, middleware...)
+}
@@ -0,0 +1,87 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+
+	record := func(name string) DialMiddleware {
+		return func(next DialFunc) DialFunc {
+			return func(ctx context.Context, network, addr string) (net.Conn, error) {
+				calls = append(calls, name+" "+addr)
+				return next(ctx, network, addr+"/"+name)
+			}
+		}
+	}
+
+	dial := chain(func(_ context.Context, _, addr string) (net.Conn, error) {
+		calls = append(calls, "dial "+addr)
+		return nil, nil
+	}, []DialMiddleware{record("a"), record("b")})
+
+	_, _ = dial(context.Background(), "tcp", "x")
+
+	if want := []string{"a x", "b x/a", "dial x/a/b"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestClusterDialerMiddleware(t *testing.T) {
+	var gotService string
+
+	fwd := &PortForwarder{
+		Clientset:        fake.NewClientset(),
+		Name:             "production",
+		DefaultNamespace: "default",
+		resolveFunc: func(_ context.Context, _, serviceName string) ([]string, error) {
+			gotService = serviceName
+			return []string{"redis-0"}, nil
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return &StreamConn{errDone: make(chan struct{})}, nil
+		},
+	}
+
+	dialer := &ClusterDialer{Forwarders: map[string]*PortForwarder{"production": fwd}}
+
+	errBlocked := errors.New("blocked")
+
+	// an alias rewritten into a cluster address, and a denylist.
+	dialer.Use(
+		func(next DialFunc) DialFunc {
+			return func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return next(ctx, network, strings.Replace(addr, "cache.internal", "redis.default.production", 1))
+			}
+		},
+		func(next DialFunc) DialFunc {
+			return func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if strings.HasPrefix(addr, "admin.") {
+					return nil, errBlocked
+				}
+
+				return next(ctx, network, addr)
+			}
+		},
+	)
+
+	if _, err := dialer.DialContext(context.Background(), "tcp", "cache.internal:6379"); err != nil {
+		t.Fatalf("DialContext(cache.internal) error: %v", err)
+	}
+
+	if gotService != "redis" {
+		t.Errorf("resolved service %q, want redis", gotService)
+	}
+
+	if _, err := dialer.DialContext(context.Background(), "tcp", "admin.default.production:80"); !errors.Is(err, errBlocked) {
+		t.Errorf("DialContext(admin) error = %v, want the middleware's error", err)
+	}
+}
@@ -0,0 +1,58 @@
+package kube
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// negativeCache remembers failed service resolutions, so clients retrying a
+// missing or unready service don't trigger an EndpointSlice list and a full
+// retry loop on every connection.
+type negativeCache struct {
+	mu      sync.Mutex
+	entries map[string]negativeEntry
+}
+
+type negativeEntry struct {
+	err     error
+	expires time.Time
+}
+
+// get returns the cached error for key, or nil if there is none or it expired.
+func (c *negativeCache) get(key string, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		return nil
+	}
+
+	return entry.err
+}
+
+// put caches err for key until expires, dropping expired entries so the
+// cache stays bounded by the services failing within one TTL.
+func (c *negativeCache) put(key string, err error, now, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]negativeEntry)
+	}
+
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = negativeEntry{err: err, expires: expires}
+}
+
+// isNegativeResolution reports whether err means the service is missing or
+// has no ready pods, as opposed to an API or network failure.
+func isNegativeResolution(err error) bool {
+	return errors.Is(err, ErrServiceNotFound) || errors.Is(err, ErrNoReadyEndpoints)
+}
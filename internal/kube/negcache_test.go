@@ -0,0 +1,53 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNegativeCacheExpiry(t *testing.T) {
+	var c negativeCache
+
+	now := time.Now()
+	errMissing := fmt.Errorf("%w: ns/svc has no endpoint slices", ErrServiceNotFound)
+
+	c.put("ns/svc", errMissing, now, now.Add(time.Second))
+
+	if err := c.get("ns/svc", now.Add(500*time.Millisecond)); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("get() before expiry = %v, want cached error", err)
+	}
+
+	if err := c.get("ns/svc", now.Add(time.Second)); err != nil {
+		t.Errorf("get() after expiry = %v, want nil", err)
+	}
+
+	if err := c.get("ns/other", now); err != nil {
+		t.Errorf("get() for unknown key = %v, want nil", err)
+	}
+
+	// expired entries are dropped when new ones are added.
+	c.put("ns/other", errMissing, now.Add(2*time.Second), now.Add(3*time.Second))
+
+	if _, ok := c.entries["ns/svc"]; ok {
+		t.Error("expired entry should have been pruned")
+	}
+}
+
+func TestIsNegativeResolution(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("%w found for service ns/svc", ErrNoReadyEndpoints), true},
+		{fmt.Errorf("%w: ns/svc has no endpoint slices", ErrServiceNotFound), true},
+		{errors.New("forbidden"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isNegativeResolution(tt.err); got != tt.want {
+			t.Errorf("isNegativeResolution(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
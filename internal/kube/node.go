@@ -0,0 +1,186 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// nodePrefix marks the first label of node addresses, node-<name>.nodes.
+const nodePrefix = "node-"
+
+// ErrNodeNotFound means the node of a node address doesn't exist.
+var ErrNodeNotFound = errors.New("node not found")
+
+// hopHeaders are removed from requests forwarded to the node proxy, as they
+// only apply to the connection they arrived on (RFC 9110 section 7.6.1).
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// dialNode returns a connection to port on the node of target through the
+// API server's node proxy, e.g. to reach the kubelet or a host-network
+// agent that no pod forwards to. The node proxy only carries HTTP, so the
+// connection serves the HTTP/1.1 requests written to it one at a time;
+// upgrades such as WebSockets are refused.
+func (k *PortForwarder) dialNode(ctx context.Context, originalAddr string, target Target, user string, connID uint64, start time.Time) (net.Conn, error) {
+	restCfg, clientset, err := k.clientsFor(user)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, server, err := nodeProxyTransport(restCfg)
+
+	// nodes/proxy may be granted without get on nodes, so only a node
+	// known to be missing fails the dial.
+	if err == nil {
+		if _, getErr := clientset.CoreV1().Nodes().Get(ctx, target.Node, metav1.GetOptions{}); apierrors.IsNotFound(getErr) {
+			err = fmt.Errorf("%w: %s", ErrNodeNotFound, target.Node)
+		}
+	}
+
+	if err != nil {
+		if k.Logger != nil {
+			k.Logger.Error("failed to connect", "addr", originalAddr, "node", target.Node, "error", err, "conn", connID)
+		}
+
+		k.recordFailed(start, user, originalAddr, target, err)
+
+		return nil, err
+	}
+
+	// the API server reaches the kubelet's own port over HTTPS by itself.
+	resolved := target.Node + ":" + strconv.Itoa(target.Port)
+	server.Path = path.Join(server.Path, "/api/v1/nodes", resolved, "proxy")
+
+	client, conn := net.Pipe()
+
+	logger := k.Logger
+	if logger != nil {
+		logger = logger.With("addr", originalAddr, "node", target.Node, "conn", connID)
+		logger.Info("connect", "user", user)
+	}
+
+	go serveNodeProxy(conn, transport, server, logger)
+
+	return k.track(ctx, newNetConn(client), start, user, originalAddr, target, "node/"+resolved, connID, nil), nil
+}
+
+// nodeProxyTransport returns the transport and URL of the API server of
+// restCfg.
+func nodeProxyTransport(restCfg *rest.Config) (http.RoundTripper, *url.URL, error) {
+	server, _, err := rest.DefaultServerUrlFor(restCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("building API server URL: %w", err)
+	}
+
+	transport, err := rest.TransportFor(restCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating node proxy transport: %w", err)
+	}
+
+	return transport, server, nil
+}
+
+// serveNodeProxy reads HTTP requests from conn and writes the responses of
+// the node proxy at base to them, until conn or the node proxy closes.
+func serveNodeProxy(conn net.Conn, transport http.RoundTripper, base *url.URL, logger *slog.Logger) {
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := bufio.NewReader(conn)
+
+	for {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) && logger != nil {
+				logger.Warn("failed to read node proxy request", "error", err)
+			}
+
+			return
+		}
+
+		resp := forwardNodeRequest(ctx, transport, base, req, logger)
+		err = resp.Write(conn)
+		resp.Body.Close()
+
+		// the next request starts after the body, even if it wasn't sent.
+		_, _ = io.Copy(io.Discard, req.Body)
+
+		if err != nil || req.Close || resp.Close {
+			return
+		}
+	}
+}
+
+// forwardNodeRequest sends req to the node proxy at base, answering with an
+// error response if it can't be sent.
+func forwardNodeRequest(ctx context.Context, transport http.RoundTripper, base *url.URL, req *http.Request, logger *slog.Logger) *http.Response {
+	if req.Header.Get("Upgrade") != "" {
+		return nodeProxyError(req, http.StatusNotImplemented, "upgrades are not supported through the node proxy")
+	}
+
+	target := *base
+	target.Path = path.Join(base.Path, req.URL.Path)
+	target.RawQuery = req.URL.RawQuery
+
+	// path.Join drops the trailing slash directory listings rely on.
+	if len(req.URL.Path) > 1 && req.URL.Path[len(req.URL.Path)-1] == '/' {
+		target.Path += "/"
+	}
+
+	out, err := http.NewRequestWithContext(ctx, req.Method, target.String(), req.Body)
+	if err != nil {
+		return nodeProxyError(req, http.StatusBadRequest, err.Error())
+	}
+
+	out.Header = req.Header.Clone()
+	out.ContentLength = req.ContentLength
+
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		if logger != nil {
+			logger.Warn("node proxy request failed", "path", req.URL.Path, "error", err)
+		}
+
+		return nodeProxyError(req, http.StatusBadGateway, err.Error())
+	}
+
+	return resp
+}
+
+// nodeProxyError is a plain text response with status to req.
+func nodeProxyError(req *http.Request, status int, msg string) *http.Response {
+	body := msg + "\n"
+
+	return &http.Response{
+		StatusCode:    status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Request:       req,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
@@ -0,0 +1,79 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestDialNode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.RequestURI())
+	}))
+	defer srv.Close()
+
+	traffic := &Traffic{}
+
+	fwd := &PortForwarder{
+		Name:      "production",
+		Config:    &rest.Config{Host: srv.URL},
+		Clientset: fake.NewClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}),
+		Traffic:   traffic,
+	}
+
+	conn, err := fwd.dialTarget(context.Background(), "node-worker-1.nodes.production:9100", Target{Cluster: "production", Node: "worker-1", Port: 9100})
+	if err != nil {
+		t.Fatalf("dialTarget: %v", err)
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	for _, tt := range []struct{ path, want string }{
+		{"/metrics", "/api/v1/nodes/worker-1:9100/proxy/metrics"},
+		{"/logs/?tail=10", "/api/v1/nodes/worker-1:9100/proxy/logs/?tail=10"},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://node-worker-1.nodes.production:9100"+tt.path, nil)
+		if err := req.Write(conn); err != nil {
+			t.Fatalf("writing request: %v", err)
+		}
+
+		resp, err := http.ReadResponse(r, req)
+		if err != nil {
+			t.Fatalf("reading response: %v", err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || string(body) != tt.want {
+			t.Errorf("GET %s = %d %q, want 200 %q", tt.path, resp.StatusCode, body, tt.want)
+		}
+	}
+
+	if open := traffic.Open(); len(open) != 1 || open[0].Target != "node/worker-1:9100" || open[0].BytesRead == 0 {
+		t.Errorf("Open() = %+v, want the node connection", open)
+	}
+}
+
+func TestDialNodeNotFound(t *testing.T) {
+	fwd := &PortForwarder{
+		Name:      "production",
+		Config:    &rest.Config{Host: "https://api.production.example.com"},
+		Clientset: fake.NewClientset(),
+	}
+
+	_, err := fwd.dialTarget(context.Background(), "node-worker-9.nodes.production:9100", Target{Cluster: "production", Node: "worker-9", Port: 9100})
+	if !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("dialTarget error = %v, want ErrNodeNotFound", err)
+	}
+}
@@ -0,0 +1,170 @@
+package kube
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/history"
+	"github.com/entwico/podproxy/internal/metrics"
+	"github.com/entwico/podproxy/internal/proxyproto"
+)
+
+// EgressDirect is the egress label of passthrough connections whose route
+// has no label, or that match no route.
+const EgressDirect = "direct"
+
+// PassthroughRoute adjusts how passthrough connections to matching addresses
+// are dialed.
+type PassthroughRoute struct {
+	// Match is a glob pattern of the address, with or without the port.
+	Match string
+	// Listeners and Users, if set, restrict the route to connections
+	// received on listeners with matching addresses and from matching proxy
+	// users. Entries are glob patterns.
+	Listeners []string
+	Users     []string
+	// ProxyProtocol, if set, is the version of the PROXY protocol header sent
+	// ahead of the client's data, for upstreams such as HAProxy that expect
+	// it.
+	ProxyProtocol proxyproto.Version
+	// Label, if set, is the egress label of the connections, counted in
+	// metrics, logged and recorded to the connection history, e.g.
+	// "internet".
+	Label string
+}
+
+// route returns the first route matching addr, the dialer's listener and
+// user, or nil.
+func (d *ClusterDialer) route(addr, user string) *PassthroughRoute {
+	for i := range d.Routes {
+		r := &d.Routes[i]
+		if matchesAddr([]string{r.Match}, addr) && matchesAny(r.Listeners, d.Listener) && matchesAny(r.Users, user) {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// dialPassthrough dials addr directly, sending the PROXY protocol header of
+// its route, if any, with the proxy client's address from ctx. Connections
+// of labeled routes are logged and recorded to the connection history.
+func (d *ClusterDialer) dialPassthrough(ctx context.Context, network, addr string) (net.Conn, error) {
+	user := auth.UserFromContext(ctx)
+	r := d.route(addr, user)
+
+	egress := EgressDirect
+	if r != nil && r.Label != "" {
+		egress = r.Label
+	}
+
+	audit := egress != EgressDirect
+	start := time.Now()
+
+	conn, err := keepaliveDialer(upstreamKeepalive(ctx)).DialContext(ctx, network, addr)
+	if err == nil && r != nil && r.ProxyProtocol != 0 {
+		if err = proxyproto.WriteHeader(conn, r.ProxyProtocol, proxyproto.ClientAddr(ctx), conn.RemoteAddr()); err != nil {
+			conn.Close()
+		}
+	}
+
+	rec := history.Record{Start: start, Addr: addr, User: user, Outcome: history.OutcomeOK, Egress: egress}
+
+	if err != nil {
+		metrics.PassthroughConnectionsTotal.WithLabelValues(egress, history.OutcomeError).Inc()
+
+		if audit && d.Logger != nil {
+			d.Logger.Error("failed to connect", "addr", addr, "egress", egress, "listener", d.Listener, "user", user, "error", err)
+		}
+
+		if audit && d.History != nil {
+			rec.Duration = time.Since(start)
+			rec.Outcome = history.OutcomeError
+			rec.Error = err.Error()
+			d.appendHistory(rec)
+		}
+
+		return nil, err
+	}
+
+	metrics.PassthroughConnectionsTotal.WithLabelValues(egress, history.OutcomeOK).Inc()
+
+	if audit && d.Logger != nil {
+		d.Logger.Info("connect", "addr", addr, "egress", egress, "listener", d.Listener, "user", user)
+	}
+
+	rec.Target = conn.RemoteAddr().String()
+
+	c := &passthroughConn{Conn: conn, record: rec}
+	if audit {
+		c.history = d.History
+		c.logger = d.Logger
+	}
+
+	return c, nil
+}
+
+func (d *ClusterDialer) appendHistory(rec history.Record) {
+	if err := d.History.Append(rec); err != nil && d.Logger != nil {
+		d.Logger.Warn("failed to record connection history", "error", err)
+	}
+}
+
+// passthroughConn counts the bytes of a passthrough connection and records
+// them when it is closed.
+type passthroughConn struct {
+	net.Conn
+
+	record  history.Record
+	history history.Store
+	logger  *slog.Logger
+
+	read      atomic.Int64
+	written   atomic.Int64
+	closeOnce sync.Once
+}
+
+func (c *passthroughConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(int64(n))
+
+	return n, err
+}
+
+func (c *passthroughConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+
+	return n, err
+}
+
+func (c *passthroughConn) Close() error {
+	err := c.Conn.Close()
+
+	c.closeOnce.Do(func() {
+		rx, tx := c.read.Load(), c.written.Load()
+
+		metrics.PassthroughBytesTotal.WithLabelValues(c.record.Egress, "rx").Add(float64(rx))
+		metrics.PassthroughBytesTotal.WithLabelValues(c.record.Egress, "tx").Add(float64(tx))
+
+		if c.history == nil {
+			return
+		}
+
+		rec := c.record
+		rec.Duration = time.Since(rec.Start)
+		rec.BytesRead = rx
+		rec.BytesWritten = tx
+
+		if err := c.history.Append(rec); err != nil && c.logger != nil {
+			c.logger.Warn("failed to record connection history", "error", err)
+		}
+	})
+
+	return err
+}
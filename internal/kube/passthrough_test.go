@@ -0,0 +1,162 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/history"
+	"github.com/entwico/podproxy/internal/proxyproto"
+)
+
+func TestDialPassthroughProxyProtocol(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	d := &ClusterDialer{Routes: []PassthroughRoute{
+		{Match: "10.*"},
+		{Match: "127.0.0.1", ProxyProtocol: proxyproto.V1},
+	}}
+
+	client := &net.TCPAddr{IP: net.ParseIP("192.0.2.7"), Port: 40000}
+	ctx := proxyproto.WithClientAddr(context.Background(), client)
+
+	conn, err := d.DialContext(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("DialContext() error: %v", err)
+	}
+	defer conn.Close()
+
+	want := "PROXY TCP4 192.0.2.7 127.0.0.1 40000 " + port + "\r\n"
+	if got := <-received; got != want {
+		t.Errorf("upstream received %q, want %q", got, want)
+	}
+}
+
+func TestPassthroughRoute(t *testing.T) {
+	d := &ClusterDialer{Routes: []PassthroughRoute{
+		{Match: "db.internal:5432", ProxyProtocol: proxyproto.V2},
+		{Match: "*.internal", ProxyProtocol: proxyproto.V1},
+	}}
+
+	tests := []struct {
+		addr string
+		want proxyproto.Version
+	}{
+		{"db.internal:5432", proxyproto.V2},
+		{"db.internal:6432", proxyproto.V1},
+		{"example.com:443", 0},
+	}
+
+	for _, tt := range tests {
+		var got proxyproto.Version
+		if r := d.route(tt.addr, ""); r != nil {
+			got = r.ProxyProtocol
+		}
+
+		if got != tt.want {
+			t.Errorf("route(%q).ProxyProtocol = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestPassthroughRouteListenersAndUsers(t *testing.T) {
+	routes := []PassthroughRoute{
+		{Match: "*", Listeners: []string{"*:1081"}, Label: "vpn"},
+		{Match: "*", Users: []string{"ci-*"}, Label: "ci"},
+		{Match: "*", Label: "internet"},
+	}
+
+	tests := []struct {
+		listener string
+		user     string
+		want     string
+	}{
+		{"127.0.0.1:1081", "alice", "vpn"},
+		{"127.0.0.1:1080", "ci-runner", "ci"},
+		{"127.0.0.1:1080", "alice", "internet"},
+		{"127.0.0.1:1080", "", "internet"},
+	}
+
+	for _, tt := range tests {
+		d := &ClusterDialer{Routes: routes, Listener: tt.listener}
+
+		if r := d.route("example.com:443", tt.user); r == nil || r.Label != tt.want {
+			t.Errorf("route() on %s for %q = %+v, want label %s", tt.listener, tt.user, r, tt.want)
+		}
+	}
+}
+
+func TestDialPassthroughRecordsEgress(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Write([]byte("hello"))
+			conn.Close()
+		}
+	}()
+
+	store := &memoryHistory{}
+	d := &ClusterDialer{
+		Routes:   []PassthroughRoute{{Match: "127.0.0.1", Label: "internet"}},
+		Listener: "127.0.0.1:1080",
+		History:  store,
+	}
+
+	conn, err := d.DialContext(auth.WithUser(context.Background(), "alice"), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("DialContext() error: %v", err)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+
+	conn.Close()
+
+	if len(store.records) != 1 {
+		t.Fatalf("records = %+v, want one", store.records)
+	}
+
+	rec := store.records[0]
+	if rec.Egress != "internet" || rec.User != "alice" || rec.Cluster != "" || rec.BytesRead != 5 || rec.Outcome != history.OutcomeOK {
+		t.Errorf("record = %+v, want an ok internet record of alice with 5 bytes read", rec)
+	}
+
+	// unlabeled passthrough traffic is only counted.
+	d.Routes = nil
+
+	if _, err := d.DialContext(context.Background(), "tcp", "127.0.0.1:1"); err == nil {
+		t.Fatal("DialContext() to a closed port succeeded")
+	}
+
+	if len(store.records) != 1 {
+		t.Errorf("records = %+v, want no record of direct traffic", store.records)
+	}
+}
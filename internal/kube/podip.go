@@ -0,0 +1,167 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/entwico/podproxy/internal/auth"
+)
+
+// ErrPodIPNotFound means no running pod has the IP of a pod IP target.
+var ErrPodIPNotFound = errors.New("no pod with IP")
+
+// parsePodIP parses the first label of a pod DNS name, the pod's IP with
+// its dots or colons replaced by dashes, e.g. 10-244-1-5 or fd00--5.
+func parsePodIP(label string) (netip.Addr, bool) {
+	if !strings.Contains(label, "-") {
+		return netip.Addr{}, false
+	}
+
+	if ip, err := netip.ParseAddr(strings.ReplaceAll(label, "-", ".")); err == nil && ip.Is4() {
+		return ip, true
+	}
+
+	if ip, err := netip.ParseAddr(strings.ReplaceAll(label, "-", ":")); err == nil && ip.Is6() {
+		return ip, true
+	}
+
+	return netip.Addr{}, false
+}
+
+// parseBarePodIP parses addr as a bare pod IP of cluster with a port, e.g.
+// 10.244.1.5:8080.
+func parseBarePodIP(addr, cluster string) (Target, bool, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return Target{}, false, nil
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return Target{}, false, nil
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return Target{}, true, fmt.Errorf("invalid port %q", portStr)
+	}
+
+	return Target{Cluster: cluster, PodIP: ip.Unmap(), Port: port}, true, nil
+}
+
+// podNetworkCluster returns the cluster whose pod CIDRs contain the bare IP
+// address addr, or an empty string.
+func (d *ClusterDialer) podNetworkCluster(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+
+	for name, fwd := range d.Forwarders {
+		for _, prefix := range fwd.PodCIDRs {
+			if prefix.Contains(ip.Unmap()) {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
+
+// resolvePodIP turns a pod IP target into a target of the pod with the IP,
+// in the target's namespace if it has one. Other targets are returned
+// unchanged.
+func (k *PortForwarder) resolvePodIP(ctx context.Context, target Target) (Target, error) {
+	if !target.PodIP.IsValid() {
+		return target, nil
+	}
+
+	_, clientset, err := k.clientsFor(auth.UserFromContext(ctx))
+	if err != nil {
+		return Target{}, err
+	}
+
+	pod, err := PodByIP(ctx, clientset, target.Namespace, target.PodIP)
+	if err != nil {
+		return Target{}, err
+	}
+
+	return Target{
+		Cluster:   target.Cluster,
+		PodName:   pod.Name,
+		Namespace: pod.Namespace,
+		Port:      target.Port,
+	}, nil
+}
+
+// PodByIP returns the running pod that has ip, searching all namespaces
+// when namespace is empty. Pods on the host network share the node's IP and
+// are only returned if no other pod has it.
+func PodByIP(ctx context.Context, clientset kubernetes.Interface, namespace string, ip netip.Addr) (*corev1.Pod, error) {
+	// apply a default timeout when the caller hasn't set a deadline
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+
+	list, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "status.podIP=" + ip.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing pods with IP %s: %w", ip, err)
+	}
+
+	var hostNetwork *corev1.Pod
+
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning || !hasPodIP(pod, ip) {
+			continue
+		}
+
+		if !pod.Spec.HostNetwork {
+			return pod, nil
+		}
+
+		if hostNetwork == nil {
+			hostNetwork = pod
+		}
+	}
+
+	if hostNetwork != nil {
+		return hostNetwork, nil
+	}
+
+	return nil, fmt.Errorf("%w %s", ErrPodIPNotFound, ip)
+}
+
+// hasPodIP reports whether ip is one of the pod's IPs, since not every
+// client honors the field selector of the list.
+func hasPodIP(pod *corev1.Pod, ip netip.Addr) bool {
+	for _, podIP := range pod.Status.PodIPs {
+		if a, err := netip.ParseAddr(podIP.IP); err == nil && a == ip {
+			return true
+		}
+	}
+
+	a, err := netip.ParseAddr(pod.Status.PodIP)
+
+	return err == nil && a == ip
+}
@@ -0,0 +1,130 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseTargetPodIP(t *testing.T) {
+	ip := netip.MustParseAddr("10.244.1.5")
+
+	tests := []struct {
+		addr string
+		want Target
+	}{
+		{"10-244-1-5.web.pod.production:8080", Target{Cluster: "production", PodIP: ip, Namespace: "web", Port: 8080}},
+		{"10-244-1-5.pod.production:8080", Target{Cluster: "production", PodIP: ip, Port: 8080}},
+		{"fd00--5.web.pod.production:8080", Target{Cluster: "production", PodIP: netip.MustParseAddr("fd00::5"), Namespace: "web", Port: 8080}},
+		// a Service named like an IP is still a Service.
+		{"10-244-1-5.web.production:8080", Target{Cluster: "production", IsService: true, ServiceName: "10-244-1-5", Namespace: "web", Port: 8080}},
+	}
+
+	for _, tt := range tests {
+		if got, err := ParseTarget(tt.addr); err != nil || got != tt.want {
+			t.Errorf("ParseTarget(%q) = %+v, %v, want %+v", tt.addr, got, err, tt.want)
+		}
+	}
+
+	got, err := ParsePinnedTarget("10.244.1.5:8080", "production")
+	want := Target{Cluster: "production", PodIP: ip, Port: 8080}
+
+	if err != nil || got != want {
+		t.Errorf("ParsePinnedTarget() = %+v, %v, want %+v", got, err, want)
+	}
+}
+
+func podIPFixture() *fake.Clientset {
+	pod := func(namespace, name, ip string, hostNetwork bool, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.PodSpec{HostNetwork: hostNetwork},
+			Status:     corev1.PodStatus{Phase: phase, PodIP: ip, PodIPs: []corev1.PodIP{{IP: ip}}},
+		}
+	}
+
+	return fake.NewClientset(
+		pod("web", "api-7d9f-x2", "10.244.1.5", false, corev1.PodRunning),
+		pod("web", "api-7d9f-old", "10.244.1.6", false, corev1.PodSucceeded),
+		pod("kube-system", "kube-proxy-abc", "192.168.0.10", true, corev1.PodRunning),
+		pod("monitoring", "exporter-0", "192.168.0.10", false, corev1.PodRunning),
+	)
+}
+
+func TestPodByIP(t *testing.T) {
+	clientset := podIPFixture()
+
+	tests := []struct {
+		namespace string
+		ip        string
+		want      string
+	}{
+		{"", "10.244.1.5", "web/api-7d9f-x2"},
+		{"web", "10.244.1.5", "web/api-7d9f-x2"},
+		// pods on the node's network come last.
+		{"", "192.168.0.10", "monitoring/exporter-0"},
+		{"kube-system", "192.168.0.10", "kube-system/kube-proxy-abc"},
+	}
+
+	for _, tt := range tests {
+		pod, err := PodByIP(context.Background(), clientset, tt.namespace, netip.MustParseAddr(tt.ip))
+		if err != nil {
+			t.Errorf("PodByIP(%q, %s) error: %v", tt.namespace, tt.ip, err)
+			continue
+		}
+
+		if got := pod.Namespace + "/" + pod.Name; got != tt.want {
+			t.Errorf("PodByIP(%q, %s) = %s, want %s", tt.namespace, tt.ip, got, tt.want)
+		}
+	}
+
+	for _, ip := range []string{"10.244.1.6", "10.244.1.7"} {
+		if _, err := PodByIP(context.Background(), clientset, "", netip.MustParseAddr(ip)); !errors.Is(err, ErrPodIPNotFound) {
+			t.Errorf("PodByIP(%s) error = %v, want ErrPodIPNotFound", ip, err)
+		}
+	}
+
+	if _, err := PodByIP(context.Background(), clientset, "cache", netip.MustParseAddr("10.244.1.5")); !errors.Is(err, ErrPodIPNotFound) {
+		t.Errorf("PodByIP(cache) error = %v, want ErrPodIPNotFound", err)
+	}
+}
+
+func TestClusterDialerPodIP(t *testing.T) {
+	var dialed string
+
+	fwd := &PortForwarder{
+		Name:             "production",
+		DefaultNamespace: "default",
+		Clientset:        podIPFixture(),
+		PodCIDRs:         []netip.Prefix{netip.MustParsePrefix("10.244.0.0/16")},
+		dialFunc: func(ns, pod string, _ int) (*StreamConn, error) {
+			dialed = ns + "/" + pod
+			return newTestStreamConn(), nil
+		},
+	}
+
+	d := &ClusterDialer{Forwarders: map[string]*PortForwarder{"production": fwd}}
+
+	for _, addr := range []string{"10.244.1.5:8080", "10-244-1-5.web.pod.production:8080"} {
+		dialed = ""
+
+		conn, err := d.DialContext(context.Background(), "tcp", addr)
+		if err != nil {
+			t.Fatalf("DialContext(%s): %v", addr, err)
+		}
+		conn.Close()
+
+		if dialed != "web/api-7d9f-x2" {
+			t.Errorf("DialContext(%s) dialed %q, want web/api-7d9f-x2", addr, dialed)
+		}
+	}
+
+	if got := d.cluster("10.96.0.1:443"); got != "" {
+		t.Errorf("cluster(10.96.0.1:443) = %q, want passthrough", got)
+	}
+}
@@ -0,0 +1,111 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrAccessDenied means the cluster's access policy doesn't allow
+// connections at the moment.
+var ErrAccessDenied = errors.New("access denied by policy")
+
+// AccessWindow is a recurring time of the week during which a cluster is
+// reachable.
+type AccessWindow struct {
+	// Days the window starts on. Empty means every day.
+	Days []time.Weekday
+	// From and To are offsets from midnight. A window whose To is before its
+	// From ends on the next day.
+	From, To time.Duration
+}
+
+// contains reports whether t, in the policy's location, is in the window.
+func (w AccessWindow) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := t.Weekday()
+
+	if w.From <= w.To {
+		return w.startsOn(day) && offset >= w.From && offset < w.To
+	}
+
+	// overnight: the evening of a listed day or the morning after it.
+	return (w.startsOn(day) && offset >= w.From) || (w.startsOn((day+6)%7) && offset < w.To)
+}
+
+func (w AccessWindow) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AccessPolicy limits when connections to a cluster are allowed: during one
+// of the windows, or at any time while OnCall reports true.
+type AccessPolicy struct {
+	Windows []AccessWindow
+	// Location the windows are evaluated in. Nil means local time.
+	Location *time.Location
+	// OnCall, if set, allows connections outside the windows while it
+	// reports true.
+	OnCall func() bool
+}
+
+// check returns an error wrapping ErrAccessDenied unless the policy allows
+// connections to cluster at now. It is safe to call on a nil policy, which
+// allows everything.
+func (p *AccessPolicy) check(cluster string, now time.Time) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.OnCall != nil && p.OnCall() {
+		return nil
+	}
+
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	now = now.In(loc)
+
+	for _, w := range p.Windows {
+		if w.contains(now) {
+			return nil
+		}
+	}
+
+	switch {
+	case len(p.Windows) == 0:
+		return fmt.Errorf("%w: cluster %s is only reachable while on call", ErrAccessDenied, cluster)
+	case p.OnCall != nil:
+		return fmt.Errorf("%w: cluster %s is outside its access windows and not on call", ErrAccessDenied, cluster)
+	default:
+		return fmt.Errorf("%w: cluster %s is outside its access windows", ErrAccessDenied, cluster)
+	}
+}
+
+// OnCallFlag is the switch toggled through the admin API that opens clusters
+// whose access policy allows on-call access.
+type OnCallFlag struct {
+	on atomic.Bool
+}
+
+// OnCall reports whether the flag is set.
+func (f *OnCallFlag) OnCall() bool {
+	return f.on.Load()
+}
+
+// SetOnCall sets or clears the flag.
+func (f *OnCallFlag) SetOnCall(on bool) {
+	f.on.Store(on)
+}
@@ -0,0 +1,87 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/entwico/podproxy/internal/history"
+)
+
+func TestAccessPolicyCheck(t *testing.T) {
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	onCall := false
+
+	policy := &AccessPolicy{
+		Windows: []AccessWindow{
+			{Days: weekdays, From: 9 * time.Hour, To: 18 * time.Hour},
+			// maintenance from Saturday 22:00 to Sunday 02:00.
+			{Days: []time.Weekday{time.Saturday}, From: 22 * time.Hour, To: 2 * time.Hour},
+		},
+		Location: time.UTC,
+		OnCall:   func() bool { return onCall },
+	}
+
+	tests := []struct {
+		at      string
+		allowed bool
+	}{
+		{"2025-03-03T09:00:00Z", true},  // Monday
+		{"2025-03-03T17:59:59Z", true},  // Monday
+		{"2025-03-03T18:00:00Z", false}, // Monday
+		{"2025-03-04T08:59:00Z", false}, // Tuesday
+		{"2025-03-08T12:00:00Z", false}, // Saturday
+		{"2025-03-08T23:00:00Z", true},  // Saturday night
+		{"2025-03-09T01:30:00Z", true},  // Sunday morning
+		{"2025-03-09T02:00:00Z", false}, // Sunday
+		{"2025-03-10T01:30:00Z", false}, // Monday morning
+	}
+
+	for _, tt := range tests {
+		at, _ := time.Parse(time.RFC3339, tt.at)
+
+		err := policy.check("production", at)
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("check(%s) = %v, want allowed %v", tt.at, err, tt.allowed)
+		}
+
+		if err != nil && !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("check(%s) = %v, want ErrAccessDenied", tt.at, err)
+		}
+	}
+
+	onCall = true
+
+	saturday, _ := time.Parse(time.RFC3339, "2025-03-08T12:00:00Z")
+	if err := policy.check("production", saturday); err != nil {
+		t.Errorf("check() while on call = %v, want nil", err)
+	}
+
+	if err := (*AccessPolicy)(nil).check("production", saturday); err != nil {
+		t.Errorf("nil policy: check() = %v, want nil", err)
+	}
+}
+
+func TestDialTarget_DeniedByPolicy(t *testing.T) {
+	store := &memoryHistory{}
+
+	fwd := &PortForwarder{
+		Name:    "production",
+		History: store,
+		Policy:  &AccessPolicy{OnCall: func() bool { return false }},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			t.Fatal("dialFunc should not be called when the policy denies access")
+			return nil, nil
+		},
+	}
+
+	_, err := fwd.dialTarget(context.Background(), "mypod.ns.production:8080", directPodTarget)
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("error = %v, want ErrAccessDenied", err)
+	}
+
+	if len(store.records) != 1 || store.records[0].Outcome != history.OutcomeDenied {
+		t.Errorf("records = %+v, want one denied record", store.records)
+	}
+}
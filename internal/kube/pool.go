@@ -0,0 +1,182 @@
+package kube
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/rest"
+)
+
+// connPool keeps one port-forward connection per pod open while forwards
+// use it and for an idle timeout after, so further forwards to the pod are
+// opened as new stream pairs on it instead of with another upgrade round
+// trip. A connection is dropped from the pool when it closes, e.g. because
+// its SPDY pings failed, when creating streams on it fails, and when a
+// forward on it reports a remote error.
+type connPool struct {
+	mu    sync.Mutex
+	conns map[poolKey]*pooledConn
+}
+
+// poolKey identifies the connections that can be shared: those to the same
+// pod made with the same credentials and ping period.
+type poolKey struct {
+	config     *rest.Config
+	namespace  string
+	pod        string
+	pingPeriod time.Duration
+}
+
+// pooledConn is a port-forward connection shared by the forwards to a pod.
+type pooledConn struct {
+	pool     *connPool
+	key      poolKey
+	conn     httpstream.Connection
+	protocol PortForwardProtocol
+
+	// guarded by pool.mu
+	nextID  int
+	active  int
+	pooled  bool
+	idle    time.Duration
+	idleEnd *time.Timer
+}
+
+// get returns the open pooled connection for key, or nil.
+func (p *connPool) get(key poolKey) *pooledConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc := p.conns[key]
+	if pc == nil {
+		return nil
+	}
+
+	select {
+	case <-pc.conn.CloseChan():
+		p.unpoolLocked(pc)
+		return nil
+	default:
+	}
+
+	return pc
+}
+
+// add pools conn as the connection for key, closing it after idle without
+// forwards. If another dial pooled a connection for key first, conn is
+// closed with its last forward instead.
+func (p *connPool) add(key poolKey, conn httpstream.Connection, protocol PortForwardProtocol, idle time.Duration) *pooledConn {
+	pc := &pooledConn{pool: p, key: key, conn: conn, protocol: protocol, idle: idle}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.conns[key]; !ok {
+		if p.conns == nil {
+			p.conns = make(map[poolKey]*pooledConn)
+		}
+
+		p.conns[key] = pc
+		pc.pooled = true
+
+		go func() {
+			<-conn.CloseChan()
+
+			p.mu.Lock()
+			p.unpoolLocked(pc)
+			p.mu.Unlock()
+		}()
+	}
+
+	return pc
+}
+
+// unpoolLocked drops pc from the pool, so no new forwards use it.
+func (p *connPool) unpoolLocked(pc *pooledConn) {
+	if !pc.pooled {
+		return
+	}
+
+	pc.pooled = false
+	delete(p.conns, pc.key)
+
+	if pc.idleEnd != nil {
+		pc.idleEnd.Stop()
+		pc.idleEnd = nil
+	}
+}
+
+// forward opens the stream pair of a forward to port on the connection,
+// under the next request ID, unless ctx is done first.
+func (pc *pooledConn) forward(ctx context.Context, port int) (*StreamConn, error) {
+	pc.pool.mu.Lock()
+	id := pc.nextID
+	pc.nextID++
+	pc.active++
+
+	if pc.idleEnd != nil {
+		pc.idleEnd.Stop()
+		pc.idleEnd = nil
+	}
+	pc.pool.mu.Unlock()
+
+	sc, err := newPortForwardStreams(ctx, pc.conn, strconv.Itoa(id), pc.key.namespace, pc.key.pod, port)
+	if err != nil {
+		// a cancelled forward says nothing about the connection.
+		pc.release(ctx.Err() != nil)
+		return nil, err
+	}
+
+	sc.protocol = pc.protocol
+	sc.release = pc.release
+
+	return sc, nil
+}
+
+// hold keeps the connection open without a forward until it is released,
+// for pre-warming.
+func (pc *pooledConn) hold() {
+	pc.pool.mu.Lock()
+	defer pc.pool.mu.Unlock()
+
+	pc.active++
+
+	if pc.idleEnd != nil {
+		pc.idleEnd.Stop()
+		pc.idleEnd = nil
+	}
+}
+
+// release ends a forward on the connection, dropping the connection from
+// the pool unless it is healthy. The last forward of a connection that is
+// no longer pooled closes it; that of a pooled one starts its idle timeout.
+func (pc *pooledConn) release(healthy bool) {
+	pc.pool.mu.Lock()
+	defer pc.pool.mu.Unlock()
+
+	pc.active--
+
+	if !healthy {
+		pc.pool.unpoolLocked(pc)
+	}
+
+	switch {
+	case pc.active > 0:
+	case !pc.pooled:
+		// closing can block on the network, and the pool lock is held.
+		go pc.conn.Close()
+	default:
+		pc.idleEnd = time.AfterFunc(pc.idle, func() {
+			pc.pool.mu.Lock()
+			defer pc.pool.mu.Unlock()
+
+			if pc.active == 0 && pc.pooled {
+				pc.pool.unpoolLocked(pc)
+				go pc.conn.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// poolTestConn is an httpstream.Connection creating pipe streams and
+// recording the request IDs of its data streams.
+type poolTestConn struct {
+	fakeConnection
+
+	mu   sync.Mutex
+	ids  []string
+	fail bool
+}
+
+func newPoolTestConn() *poolTestConn {
+	return &poolTestConn{fakeConnection: fakeConnection{closed: make(chan bool)}}
+}
+
+func (c *poolTestConn) CreateStream(headers http.Header) (httpstream.Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fail {
+		return nil, io.ErrClosedPipe
+	}
+
+	if headers.Get("Streamtype") == "data" {
+		c.ids = append(c.ids, headers.Get("Requestid"))
+	}
+
+	local, _ := net.Pipe()
+
+	return pipeStream{local}, nil
+}
+
+func waitClosed(t *testing.T, conn httpstream.Connection) {
+	t.Helper()
+
+	select {
+	case <-conn.CloseChan():
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection was not closed")
+	}
+}
+
+func TestConnPoolMultiplexes(t *testing.T) {
+	var pool connPool
+
+	conn := newPoolTestConn()
+	key := poolKey{namespace: "shop", pod: "web-0"}
+
+	first, err := pool.add(key, conn, ProtocolWebSocketV2, 50*time.Millisecond).forward(context.Background(), 8080)
+	if err != nil {
+		t.Fatalf("forward() error: %v", err)
+	}
+
+	pc := pool.get(key)
+	if pc == nil {
+		t.Fatal("get() = nil, want the pooled connection")
+	}
+
+	second, err := pc.forward(context.Background(), 9090)
+	if err != nil {
+		t.Fatalf("forward() error: %v", err)
+	}
+
+	if got := second.Protocol(); got != ProtocolWebSocketV2 {
+		t.Errorf("Protocol() = %q, want %q", got, ProtocolWebSocketV2)
+	}
+
+	conn.mu.Lock()
+	ids := slices.Clone(conn.ids)
+	conn.mu.Unlock()
+
+	if !slices.Equal(ids, []string{"0", "1"}) {
+		t.Errorf("request IDs = %v, want [0 1]", ids)
+	}
+
+	first.Close()
+	second.Close()
+
+	if pool.get(key) == nil {
+		t.Error("get() = nil before the idle timeout, want the pooled connection")
+	}
+
+	waitClosed(t, conn)
+
+	if pool.get(key) != nil {
+		t.Error("get() returned a connection closed after the idle timeout")
+	}
+}
+
+func TestConnPoolDropsUnhealthy(t *testing.T) {
+	var pool connPool
+
+	conn := newPoolTestConn()
+	key := poolKey{namespace: "shop", pod: "web-0"}
+	pc := pool.add(key, conn, ProtocolSPDYV1, time.Hour)
+
+	conn.mu.Lock()
+	conn.fail = true
+	conn.mu.Unlock()
+
+	if _, err := pc.forward(context.Background(), 8080); err == nil {
+		t.Fatal("forward() error = nil, want stream creation error")
+	}
+
+	if pool.get(key) != nil {
+		t.Error("get() returned a connection that failed to create streams")
+	}
+
+	waitClosed(t, conn)
+}
+
+func TestConnPoolKeepsConnectionOfCancelledForward(t *testing.T) {
+	var pool connPool
+
+	conn := newPoolTestConn()
+	key := poolKey{namespace: "shop", pod: "web-0"}
+	pc := pool.add(key, conn, ProtocolSPDYV1, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := pc.forward(ctx, 8080); !errors.Is(err, context.Canceled) {
+		t.Fatalf("forward() error = %v, want %v", err, context.Canceled)
+	}
+
+	if pool.get(key) != pc {
+		t.Error("get() dropped the connection of a cancelled forward")
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if len(conn.ids) != 0 {
+		t.Errorf("streams created for a cancelled forward: %v", conn.ids)
+	}
+}
+
+func TestConnPoolSecondConnectionNotPooled(t *testing.T) {
+	var pool connPool
+
+	key := poolKey{namespace: "shop", pod: "web-0"}
+	pool.add(key, newPoolTestConn(), ProtocolSPDYV1, time.Hour)
+
+	conn := newPoolTestConn()
+
+	sc, err := pool.add(key, conn, ProtocolSPDYV1, time.Hour).forward(context.Background(), 8080)
+	if err != nil {
+		t.Fatalf("forward() error: %v", err)
+	}
+
+	sc.Close()
+
+	// the connection raced another dial into the pool, so it closes with its
+	// only forward.
+	waitClosed(t, conn)
+}
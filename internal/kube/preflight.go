@@ -0,0 +1,44 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+)
+
+// preflightError is a service target missing from the catalog. It matches
+// ErrServiceNotFound.
+type preflightError struct {
+	msg string
+}
+
+func (e *preflightError) Error() string { return e.msg }
+func (e *preflightError) Unwrap() error { return ErrServiceNotFound }
+
+// preflight checks that the Service of a service target exists in the
+// catalog, so an address typo fails at once instead of after the retry
+// window. Pod targets aren't cached and always pass, as do clusters whose
+// catalog hasn't synced yet.
+func (k *PortForwarder) preflight(target Target) error {
+	if !k.Preflight || !target.IsService || k.Catalog == nil || !k.Catalog.Synced(k.Name) {
+		return nil
+	}
+
+	services := k.Catalog.Services(k.Name, target.Namespace)
+	for _, svc := range services {
+		if svc.Name == target.ServiceName {
+			return nil
+		}
+	}
+
+	msg := fmt.Sprintf("service %s not found in namespace %s", target.ServiceName, target.Namespace)
+
+	if len(services) == 0 {
+		msg += " (the namespace has no services)"
+	}
+
+	if s := k.Catalog.Suggest(k.Name, target.Namespace, target.ServiceName); len(s) > 0 {
+		msg += fmt.Sprintf(" (did you mean %s?)", strings.Join(s, " or "))
+	}
+
+	return &preflightError{msg: msg}
+}
@@ -0,0 +1,77 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPreflight(t *testing.T) {
+	clientset := fake.NewClientset(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "cache"},
+	})
+
+	var resolves int
+
+	fwd := &PortForwarder{
+		Name:      "production",
+		Clientset: clientset,
+		Preflight: true,
+		resolveFunc: func(context.Context, string, string) ([]string, error) {
+			resolves++
+			return []string{"redis-0"}, nil
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return &StreamConn{errDone: make(chan struct{})}, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fwd.Catalog = &ServiceCatalog{Forwarders: map[string]*PortForwarder{"production": fwd}}
+	fwd.Catalog.Start(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !fwd.Catalog.Synced("production") {
+		if time.Now().After(deadline) {
+			t.Fatal("catalog did not sync")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	dialer := &PinnedDialer{Forwarder: fwd, Namespace: "default"}
+
+	if _, err := dialer.DialContext(ctx, "tcp", "redis.cache:6379"); err != nil {
+		t.Fatalf("DialContext(redis.cache) error: %v", err)
+	}
+
+	tests := []struct {
+		addr, want string
+	}{
+		{"rediss.cache:6379", "service rediss not found in namespace cache (did you mean redis.cache.production?)"},
+		{"redis.cahce:6379", "service redis not found in namespace cahce (the namespace has no services) (did you mean redis.cache.production?)"},
+	}
+
+	for _, tt := range tests {
+		_, err := dialer.DialContext(ctx, "tcp", tt.addr)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("DialContext(%s) error = %v, want %q", tt.addr, err, tt.want)
+		}
+
+		if !errors.Is(err, ErrServiceNotFound) {
+			t.Errorf("DialContext(%s) error doesn't match ErrServiceNotFound", tt.addr)
+		}
+	}
+
+	if resolves != 1 {
+		t.Errorf("resolved %d times, want 1: missing services must not be looked up", resolves)
+	}
+}
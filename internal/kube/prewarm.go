@@ -0,0 +1,115 @@
+package kube
+
+import (
+	"context"
+	"time"
+)
+
+// prewarmInterval is how often pre-warmed Services are resolved again, so
+// their connections follow the pods across restarts and scaling.
+const prewarmInterval = 30 * time.Second
+
+// Prewarm keeps a port-forward connection open to every ready pod of a
+// Service until ctx is done, so the first connections of interactive tools
+// to it are opened as new streams on a pooled connection instead of waiting
+// for the upgrade round trip. Connections are made with the forwarder's own
+// credentials, so forwards of impersonated users don't use them. An empty
+// namespace means DefaultNamespace.
+func (k *PortForwarder) Prewarm(ctx context.Context, namespace, service string) {
+	if namespace == "" {
+		namespace = k.DefaultNamespace
+	}
+
+	held := make(map[string]*pooledConn)
+
+	defer func() {
+		for _, pc := range held {
+			pc.release(true)
+		}
+	}()
+
+	for {
+		k.prewarm(ctx, namespace, service, held)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(prewarmInterval):
+		}
+	}
+}
+
+// prewarm opens the missing connections to the ready pods of service and
+// releases those to pods that are no longer ready. held maps pod names to
+// the connections kept open.
+func (k *PortForwarder) prewarm(ctx context.Context, namespace, service string, held map[string]*pooledConn) {
+	restCfg, clientset := k.Clients()
+
+	pods, err := k.resolveServicePods(ctx, clientset, "", namespace, service)
+	if err != nil {
+		if k.Logger != nil {
+			k.Logger.Warn("failed to resolve pre-warmed service", "namespace", namespace, "service", service, "error", err)
+		}
+
+		return
+	}
+
+	ready := make(map[string]bool, len(pods))
+
+	for _, pod := range pods {
+		ready[pod] = true
+		key := poolKey{config: restCfg, namespace: namespace, pod: pod}
+
+		pc := k.pool.get(key)
+		if pc != nil && pc == held[pod] {
+			continue
+		}
+
+		// the held connection closed or was dropped from the pool.
+		if old := held[pod]; old != nil {
+			old.release(true)
+			delete(held, pod)
+		}
+
+		if pc == nil {
+			if pc, err = k.prewarmPod(ctx, key); err != nil {
+				if k.Logger != nil {
+					k.Logger.Warn("failed to pre-warm connection", "namespace", namespace, "service", service, "pod", pod, "error", err)
+				}
+
+				continue
+			}
+		}
+
+		pc.hold()
+		held[pod] = pc
+	}
+
+	for pod, pc := range held {
+		if !ready[pod] {
+			pc.release(true)
+			delete(held, pod)
+		}
+	}
+}
+
+// prewarmPod opens the pooled connection for key within DialTimeout.
+func (k *PortForwarder) prewarmPod(ctx context.Context, key poolKey) (*pooledConn, error) {
+	if k.DialTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, k.DialTimeout)
+		defer cancel()
+	}
+
+	conn, protocol, err := k.negotiate(ctx, key.config, key.namespace, key.pod, key.pingPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.Logger != nil {
+		k.Logger.Debug("pre-warmed connection", "namespace", key.namespace, "pod", key.pod, "protocol", protocol)
+	}
+
+	return k.pool.add(key, conn, protocol, k.MultiplexIdleTimeout), nil
+}
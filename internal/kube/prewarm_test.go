@@ -0,0 +1,52 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestPrewarmHoldsPooledConnection(t *testing.T) {
+	fwd := &PortForwarder{
+		Config:               &rest.Config{Host: "https://production.example.com"},
+		Clientset:            headlessFixture(),
+		MultiplexIdleTimeout: time.Millisecond,
+	}
+
+	conn := newPoolTestConn()
+	key := poolKey{config: fwd.Config, namespace: "cache", pod: "mongo-0"}
+	pc := fwd.pool.add(key, conn, ProtocolSPDYV1, fwd.MultiplexIdleTimeout)
+
+	held := make(map[string]*pooledConn)
+	fwd.prewarm(context.Background(), "cache", "mongo", held)
+
+	if held["mongo-0"] != pc || len(held) != 1 {
+		t.Fatalf("held = %v, want the pooled connection of the ready pod mongo-0", held)
+	}
+
+	sc, err := pc.forward(context.Background(), 27017)
+	if err != nil {
+		t.Fatalf("forward() error: %v", err)
+	}
+
+	sc.Close()
+	time.Sleep(20 * time.Millisecond)
+
+	select {
+	case <-conn.CloseChan():
+		t.Fatal("pre-warmed connection closed after its idle timeout")
+	default:
+	}
+
+	// resolving again keeps the same connection.
+	fwd.prewarm(context.Background(), "cache", "mongo", held)
+
+	if held["mongo-0"] != pc {
+		t.Errorf("held = %v after resolving again, want the same connection", held)
+	}
+
+	pc.release(true)
+	waitClosed(t, conn)
+}
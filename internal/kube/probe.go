@@ -0,0 +1,55 @@
+package kube
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// ProbeResult is the outcome of a connectivity probe against a cluster's API
+// server.
+type ProbeResult struct {
+	Cluster    string
+	Reachable  bool
+	Latency    time.Duration
+	AuthMethod string
+	// Proxy is the proxy the API server is reached through, if any.
+	Proxy string
+	Err   error
+}
+
+// Probe requests /version from the cluster's API server to check that it is
+// reachable and accepts the configured credentials. Port-forwards are not
+// exercised.
+func (f *PortForwarder) Probe(ctx context.Context) ProbeResult {
+	restCfg, clientset := f.Clients()
+	res := ProbeResult{Cluster: f.Name, AuthMethod: AuthMethod(restCfg), Proxy: ProxyFor(restCfg)}
+
+	start := time.Now()
+	res.Err = clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+	res.Latency = time.Since(start)
+	res.Reachable = res.Err == nil
+
+	return res
+}
+
+// AuthMethod describes how a client built from config authenticates to the
+// API server, e.g. "token" or "exec:kubelogin".
+func AuthMethod(config *rest.Config) string {
+	switch {
+	case config.ExecProvider != nil:
+		return "exec:" + path.Base(config.ExecProvider.Command)
+	case config.AuthProvider != nil:
+		return "auth-provider:" + config.AuthProvider.Name
+	case config.BearerToken != "" || config.BearerTokenFile != "":
+		return "token"
+	case len(config.CertData) > 0 || config.CertFile != "":
+		return "client-cert"
+	case config.Username != "":
+		return "basic"
+	default:
+		return "none"
+	}
+}
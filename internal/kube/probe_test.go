@@ -0,0 +1,75 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major":"1","minor":"33","gitVersion":"v1.33.0"}`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		token         string
+		wantReachable bool
+	}{
+		{"good", true},
+		{"bad", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			config := &rest.Config{Host: srv.URL, BearerToken: tt.token}
+
+			clientset, err := kubernetes.NewForConfig(config)
+			if err != nil {
+				t.Fatalf("NewForConfig() error: %v", err)
+			}
+
+			fwd := &PortForwarder{Name: "production", Config: config, Clientset: clientset}
+
+			res := fwd.Probe(context.Background())
+			if res.Reachable != tt.wantReachable {
+				t.Errorf("Reachable = %v, want %v (err: %v)", res.Reachable, tt.wantReachable, res.Err)
+			}
+
+			if res.Cluster != "production" || res.AuthMethod != "token" {
+				t.Errorf("Cluster/AuthMethod = %q/%q, want production/token", res.Cluster, res.AuthMethod)
+			}
+		})
+	}
+}
+
+func TestAuthMethod(t *testing.T) {
+	tests := []struct {
+		config *rest.Config
+		want   string
+	}{
+		{&rest.Config{ExecProvider: &clientcmdapi.ExecConfig{Command: "/usr/local/bin/kubelogin"}}, "exec:kubelogin"},
+		{&rest.Config{AuthProvider: &clientcmdapi.AuthProviderConfig{Name: "oidc"}}, "auth-provider:oidc"},
+		{&rest.Config{BearerTokenFile: "/var/run/token"}, "token"},
+		{&rest.Config{TLSClientConfig: rest.TLSClientConfig{CertData: []byte("cert")}}, "client-cert"},
+		{&rest.Config{Username: "admin"}, "basic"},
+		{&rest.Config{}, "none"},
+	}
+
+	for _, tt := range tests {
+		if got := AuthMethod(tt.config); got != tt.want {
+			t.Errorf("AuthMethod() = %q, want %q", got, tt.want)
+		}
+	}
+}
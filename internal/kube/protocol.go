@@ -0,0 +1,86 @@
+package kube
+
+import (
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// PortForwardTransport is the protocol port-forwards are opened with.
+type PortForwardTransport string
+
+const (
+	// TransportAuto tunnels port-forwards over WebSockets and falls back to
+	// SPDY when the API server doesn't support them.
+	TransportAuto PortForwardTransport = "auto"
+	// TransportWebSocket always tunnels port-forwards over WebSockets,
+	// which proxies and load balancers in front of the API server forward
+	// more reliably than SPDY upgrades.
+	TransportWebSocket PortForwardTransport = "websocket"
+	// TransportSPDY always upgrades port-forward requests to SPDY.
+	TransportSPDY PortForwardTransport = "spdy"
+)
+
+// PortForwardProtocol is a version of the port-forward protocol offered to
+// the API server.
+type PortForwardProtocol string
+
+const (
+	// ProtocolSPDYV1 upgrades the port-forward request to SPDY, negotiating
+	// portforward.k8s.io.
+	ProtocolSPDYV1 PortForwardProtocol = "spdy/v1"
+	// ProtocolWebSocketV2 tunnels SPDY over a WebSocket, negotiating
+	// SPDY/3.1+portforward.k8s.io.
+	ProtocolWebSocketV2 PortForwardProtocol = "websocket/v2"
+)
+
+// protocols returns the protocols the next dial offers, in order.
+func (k *PortForwarder) protocols() []PortForwardProtocol {
+	if len(k.Protocols) > 0 {
+		return k.Protocols
+	}
+
+	switch k.Transport {
+	case TransportSPDY:
+		return []PortForwardProtocol{ProtocolSPDYV1}
+	case TransportWebSocket:
+		return []PortForwardProtocol{ProtocolWebSocketV2}
+	}
+
+	if k.spdyFallback.Load() {
+		return []PortForwardProtocol{ProtocolSPDYV1}
+	}
+
+	return []PortForwardProtocol{ProtocolWebSocketV2, ProtocolSPDYV1}
+}
+
+// upgradeFailed reports whether a dial offering p failed to negotiate it, so
+// the next protocol should be tried. With TransportAuto, later dials go
+// straight to SPDY, unless the upgrade was rejected for the credentials:
+// RBAC may allow SPDY (create on pods/portforward instead of get) and
+// differs between impersonated users.
+func (k *PortForwarder) upgradeFailed(p PortForwardProtocol, err error) bool {
+	if !httpstream.IsUpgradeFailure(err) && !httpstream.IsHTTPSProxyError(err) {
+		return false
+	}
+
+	if k.Logger != nil {
+		k.Logger.Debug("port-forward protocol rejected", "protocol", p, "error", err)
+	}
+
+	if len(k.Protocols) > 0 || p != ProtocolWebSocketV2 {
+		return true
+	}
+
+	var upgradeErr *httpstream.UpgradeFailureError
+	if errors.As(err, &upgradeErr) && (apierrors.IsForbidden(upgradeErr.Cause) || apierrors.IsUnauthorized(upgradeErr.Cause)) {
+		return true
+	}
+
+	if !k.spdyFallback.Swap(true) && k.Logger != nil {
+		k.Logger.Info("API server doesn't support WebSocket port-forwards, falling back to SPDY", "error", err)
+	}
+
+	return true
+}
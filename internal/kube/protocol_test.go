@@ -0,0 +1,87 @@
+package kube
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+func TestProtocols(t *testing.T) {
+	upgradeErr := &httpstream.UpgradeFailureError{Cause: errors.New("bad handshake (404 Not Found)")}
+	forbiddenErr := &httpstream.UpgradeFailureError{Cause: apierrors.NewForbidden(schema.GroupResource{Resource: "pods/portforward"}, "web-0", errors.New("denied"))}
+
+	tests := []struct {
+		name      string
+		fwd       *PortForwarder
+		failed    error
+		want      []PortForwardProtocol
+		wantAfter []PortForwardProtocol
+	}{
+		{
+			name:      "auto remembers fallback",
+			fwd:       &PortForwarder{},
+			failed:    upgradeErr,
+			want:      []PortForwardProtocol{ProtocolWebSocketV2, ProtocolSPDYV1},
+			wantAfter: []PortForwardProtocol{ProtocolSPDYV1},
+		},
+		{
+			name:      "auto retries websocket after forbidden upgrade",
+			fwd:       &PortForwarder{Transport: TransportAuto},
+			failed:    forbiddenErr,
+			want:      []PortForwardProtocol{ProtocolWebSocketV2, ProtocolSPDYV1},
+			wantAfter: []PortForwardProtocol{ProtocolWebSocketV2, ProtocolSPDYV1},
+		},
+		{
+			name:      "spdy",
+			fwd:       &PortForwarder{Transport: TransportSPDY},
+			want:      []PortForwardProtocol{ProtocolSPDYV1},
+			wantAfter: []PortForwardProtocol{ProtocolSPDYV1},
+		},
+		{
+			name:      "websocket",
+			fwd:       &PortForwarder{Transport: TransportWebSocket},
+			want:      []PortForwardProtocol{ProtocolWebSocketV2},
+			wantAfter: []PortForwardProtocol{ProtocolWebSocketV2},
+		},
+		{
+			name:      "explicit protocols replace transport",
+			fwd:       &PortForwarder{Transport: TransportWebSocket, Protocols: []PortForwardProtocol{ProtocolSPDYV1, ProtocolWebSocketV2}},
+			failed:    upgradeErr,
+			want:      []PortForwardProtocol{ProtocolSPDYV1, ProtocolWebSocketV2},
+			wantAfter: []PortForwardProtocol{ProtocolSPDYV1, ProtocolWebSocketV2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.fwd.protocols()
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("protocols() = %v, want %v", got, tt.want)
+			}
+
+			if tt.failed != nil && !tt.fwd.upgradeFailed(got[0], tt.failed) {
+				t.Fatalf("upgradeFailed(%v) = false, want true", tt.failed)
+			}
+
+			if got := tt.fwd.protocols(); !slices.Equal(got, tt.wantAfter) {
+				t.Errorf("protocols() after failure = %v, want %v", got, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestUpgradeFailedOtherErrors(t *testing.T) {
+	fwd := &PortForwarder{}
+
+	if fwd.upgradeFailed(ProtocolWebSocketV2, errors.New("connection refused")) {
+		t.Error("upgradeFailed() = true for a network error, want false")
+	}
+
+	if got := fwd.protocols(); len(got) != 2 {
+		t.Errorf("protocols() = %v, want the fallback not remembered", got)
+	}
+}
@@ -0,0 +1,93 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/entwico/podproxy/internal/metrics"
+)
+
+// ErrLeaked is wrapped by the cause of connections closed by a Reaper.
+var ErrLeaked = errors.New("connection leaked")
+
+// Causes of leaked connections, as counted in metrics.
+const (
+	leakTunnel = "tunnel"
+	leakClient = "client"
+)
+
+// Reaper closes cluster connections that leaked: connections left open after
+// their port-forward stream died, or after the proxy client that opened them
+// went away without closing them, e.g. a killed process whose half-open
+// socket the client keepalives dropped. Such connections would otherwise
+// hold their streams, goroutines and load balancing slots until podproxy
+// exits.
+type Reaper struct {
+	Traffic *Traffic
+	// Idle is how long a connection transfers no data before it is probed,
+	// and the interval between scans.
+	Idle time.Duration
+	// ClientConnected, if set, reports whether the proxy client connection
+	// from client is still open, e.g. ConnTracker.Connected. Clients are
+	// only known for SOCKS5 connections and HTTP CONNECT tunnels.
+	ClientConnected func(client net.Addr) bool
+	Logger          *slog.Logger
+}
+
+// Run scans for leaked connections every Idle until ctx is done.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Idle)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Reap()
+		}
+	}
+}
+
+// Reap closes the leaked connections idle for at least Idle and returns how
+// many it closed.
+func (r *Reaper) Reap() int {
+	return r.Traffic.revoke(ErrLeaked, func(c *logOnCloseConn) error {
+		if c.Idle() < r.Idle {
+			return nil
+		}
+
+		cause := r.leak(c)
+		if cause == "" {
+			return nil
+		}
+
+		metrics.LeakedConnectionsTotal.WithLabelValues(c.record.Cluster, cause).Inc()
+
+		if r.Logger != nil {
+			r.Logger.Warn("closing leaked connection", "cluster", c.record.Cluster, "addr", c.origAddr, "target", c.resolved, "user", c.record.User, "conn", c.connID, "cause", cause)
+		}
+
+		if cause == leakTunnel {
+			return errors.New("port-forward stream closed")
+		}
+
+		return errors.New("proxy client disconnected")
+	})
+}
+
+// leak returns why c leaked, or an empty string if it is alive.
+func (r *Reaper) leak(c *logOnCloseConn) string {
+	if !c.alive() {
+		return leakTunnel
+	}
+
+	if c.client != nil && r.ClientConnected != nil && !r.ClientConnected(c.client) {
+		return leakClient
+	}
+
+	return ""
+}
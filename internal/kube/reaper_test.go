@@ -0,0 +1,106 @@
+package kube
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/entwico/podproxy/internal/history"
+	"github.com/entwico/podproxy/internal/proxyproto"
+)
+
+func TestReaper(t *testing.T) {
+	store := &memoryHistory{}
+	traffic := &Traffic{}
+
+	var dead *StreamConn
+
+	fwd := &PortForwarder{
+		Name:    "production",
+		History: store,
+		Traffic: traffic,
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			sc := newTestStreamConn()
+			if dead == nil {
+				dead = sc
+			}
+
+			return sc, nil
+		},
+	}
+
+	gone := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000}
+	connected := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 50000}
+
+	// the first connection's port-forward connection dies.
+	tunnel, err := fwd.dialTarget(proxyproto.WithClientAddr(context.Background(), connected), "mypod.ns.production:8080", directPodTarget)
+	if err != nil {
+		t.Fatalf("dialTarget() error: %v", err)
+	}
+
+	dead.spdyConn.Close()
+
+	client, err := fwd.dialTarget(proxyproto.WithClientAddr(context.Background(), gone), "mypod.ns.production:8080", directPodTarget)
+	if err != nil {
+		t.Fatalf("dialTarget() error: %v", err)
+	}
+
+	alive, err := fwd.dialTarget(proxyproto.WithClientAddr(context.Background(), connected), "mypod.ns.production:8080", directPodTarget)
+	if err != nil {
+		t.Fatalf("dialTarget() error: %v", err)
+	}
+	defer alive.Close()
+
+	// connections without a known client are only probed on the tunnel.
+	unknown, err := fwd.dialTarget(context.Background(), "mypod.ns.production:8080", directPodTarget)
+	if err != nil {
+		t.Fatalf("dialTarget() error: %v", err)
+	}
+	defer unknown.Close()
+
+	reaper := &Reaper{
+		Traffic: traffic,
+		Idle:    time.Nanosecond,
+		ClientConnected: func(client net.Addr) bool {
+			return client.String() == connected.String()
+		},
+	}
+
+	if n := reaper.Reap(); n != 2 {
+		t.Errorf("Reap() = %d, want 2", n)
+	}
+
+	if open := traffic.Open(); len(open) != 2 {
+		t.Errorf("Open() = %+v, want the two live connections", open)
+	}
+
+	for _, c := range []net.Conn{tunnel, client} {
+		if _, err := c.Read(make([]byte, 1)); err == nil {
+			t.Error("Read() on a reaped connection succeeded")
+		}
+	}
+
+	want := map[string]bool{
+		"connection leaked: port-forward stream closed": true,
+		"connection leaked: proxy client disconnected":  true,
+	}
+
+	for _, rec := range store.records {
+		if rec.Outcome != history.OutcomeRevoked || !want[rec.Error] {
+			t.Errorf("record = %+v, want a leaked connection", rec)
+		}
+
+		delete(want, rec.Error)
+	}
+
+	if len(want) != 0 {
+		t.Errorf("missing records for %v", want)
+	}
+
+	reaper.Idle = time.Hour
+
+	if n := reaper.Reap(); n != 0 {
+		t.Errorf("Reap() = %d for recently active connections, want 0", n)
+	}
+}
@@ -0,0 +1,118 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// reauthInterval is the minimum time between rebuilds of a cluster's client,
+// so credentials the API server keeps rejecting don't run the credential
+// plugin for every connection.
+const reauthInterval = 10 * time.Second
+
+// isUnauthorized reports whether err is the API server rejecting the
+// client's credentials, on an API call or the port-forward upgrade.
+func isUnauthorized(err error) bool {
+	return apierrors.IsUnauthorized(err) || strings.Contains(err.Error(), "Unauthorized")
+}
+
+// Clients returns the forwarder's own rest config and clientset: those last
+// built by Reauthenticate, or else Config and Clientset.
+func (k *PortForwarder) Clients() (*rest.Config, kubernetes.Interface) {
+	k.authMu.Lock()
+	defer k.authMu.Unlock()
+
+	if k.authConfig != nil {
+		return k.authConfig, k.authClientset
+	}
+
+	return k.Config, k.Clientset
+}
+
+// rebuilt returns a channel that is closed when Reauthenticate next rebuilds
+// the clients.
+func (k *PortForwarder) rebuilt() <-chan struct{} {
+	k.authMu.Lock()
+	defer k.authMu.Unlock()
+
+	if k.authChanged == nil {
+		k.authChanged = make(chan struct{})
+	}
+
+	return k.authChanged
+}
+
+// watchClients calls start with the forwarder's clientset, and again with
+// the new one whenever Reauthenticate rebuilds it, cancelling the context
+// of the previous call, until ctx is cancelled. Informers use it to keep
+// watching with current credentials.
+func (k *PortForwarder) watchClients(ctx context.Context, start func(ctx context.Context, clientset kubernetes.Interface)) {
+	if k.Reauthenticate == nil {
+		_, clientset := k.Clients()
+		start(ctx, clientset)
+
+		return
+	}
+
+	changed := k.rebuilt()
+	_, clientset := k.Clients()
+
+	startCtx, cancel := context.WithCancel(ctx)
+	start(startCtx, clientset)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				cancel()
+				return
+			case <-changed:
+			}
+
+			cancel()
+
+			changed = k.rebuilt()
+			_, clientset = k.Clients()
+
+			startCtx, cancel = context.WithCancel(ctx)
+			start(startCtx, clientset)
+		}
+	}()
+}
+
+// reauthenticate rebuilds the cluster's client with Reauthenticate after
+// the API server rejected the credentials of clients obtained at since, and
+// returns the clients for user. Clients another connection rebuilt after
+// since are returned as they are.
+func (k *PortForwarder) reauthenticate(user string, since time.Time) (*rest.Config, kubernetes.Interface, error) {
+	k.authMu.Lock()
+
+	if k.authRebuilt.Before(since) && time.Since(k.authRebuilt) >= reauthInterval {
+		cfg, clientset, err := k.Reauthenticate()
+		if err != nil {
+			k.authMu.Unlock()
+			return nil, nil, fmt.Errorf("rebuilding client: %w", err)
+		}
+
+		k.authConfig, k.authClientset, k.authRebuilt = cfg, clientset, time.Now()
+
+		if k.authChanged != nil {
+			close(k.authChanged)
+			k.authChanged = nil
+		}
+
+		if k.Logger != nil {
+			k.Logger.Info("rebuilt cluster client after its credentials were rejected")
+		}
+	}
+
+	k.authMu.Unlock()
+
+	return k.clientsFor(user)
+}
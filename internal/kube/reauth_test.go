@@ -0,0 +1,171 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestDialTarget_ReauthenticatesOnUnauthorized(t *testing.T) {
+	var (
+		rebuilds int
+		resolves int
+	)
+
+	rebuilt := &rest.Config{Host: "https://api.prod.example.com", BearerToken: "fresh"}
+
+	fwd := &PortForwarder{
+		Name:      "prod",
+		Config:    &rest.Config{Host: "https://api.prod.example.com", BearerToken: "expired"},
+		Clientset: fake.NewClientset(),
+		Reauthenticate: func() (*rest.Config, kubernetes.Interface, error) {
+			rebuilds++
+			return rebuilt, fake.NewClientset(), nil
+		},
+		resolveFunc: func(_ context.Context, _, _ string) ([]string, error) {
+			resolves++
+			if rebuilds == 0 {
+				return nil, apierrors.NewUnauthorized("Unauthorized")
+			}
+
+			return []string{"pod-1"}, nil
+		},
+		targetPortFunc: func(_ context.Context, _, _, _ string, port int) (int, error) {
+			return port, nil
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return newTestStreamConn(), nil
+		},
+	}
+
+	conn, err := fwd.dialTarget(context.Background(), "mysvc.ns.prod:8080", serviceTarget)
+	if err != nil {
+		t.Fatalf("dialTarget: %v", err)
+	}
+	conn.Close()
+
+	if rebuilds != 1 || resolves != 2 {
+		t.Errorf("rebuilds = %d, resolves = %d, want 1 and 2", rebuilds, resolves)
+	}
+
+	if cfg, _, _ := fwd.clientsFor(""); cfg != rebuilt {
+		t.Error("clientsFor() didn't return the rebuilt config")
+	}
+
+	if _, ok := fwd.LoginRequired(); ok {
+		t.Error("LoginRequired() = true after the retry succeeded")
+	}
+}
+
+func TestDialTarget_ReauthenticatesOncePerInterval(t *testing.T) {
+	var rebuilds, dials int
+
+	fwd := &PortForwarder{
+		Name:      "prod",
+		Config:    &rest.Config{Host: "https://api.prod.example.com"},
+		Clientset: fake.NewClientset(),
+		Reauthenticate: func() (*rest.Config, kubernetes.Interface, error) {
+			rebuilds++
+			return &rest.Config{Host: "https://api.prod.example.com"}, fake.NewClientset(), nil
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			dials++
+			return nil, errors.New("unable to upgrade connection: Unauthorized")
+		},
+	}
+
+	if _, err := fwd.dialTarget(context.Background(), "mypod.ns.prod:8080", directPodTarget); err == nil {
+		t.Fatal("dialTarget succeeded with rejected credentials")
+	}
+
+	// the rejected credentials fail the connection once they were rebuilt.
+	if rebuilds != 1 || dials != 2 {
+		t.Fatalf("rebuilds = %d, dials = %d, want 1 and 2", rebuilds, dials)
+	}
+
+	fwd.login.nextProbe = time.Time{}
+
+	if _, err := fwd.dialTarget(context.Background(), "mypod.ns.prod:8080", directPodTarget); err == nil {
+		t.Fatal("dialTarget succeeded with rejected credentials")
+	}
+
+	// the clients kept within the interval aren't retried.
+	if rebuilds != 1 || dials != 3 {
+		t.Errorf("rebuilds = %d, dials = %d within the reauth interval, want 1 and 3", rebuilds, dials)
+	}
+}
+
+func TestWatchClientsRestartsOnRebuild(t *testing.T) {
+	rebuilt := fake.NewClientset()
+
+	fwd := &PortForwarder{
+		Name:      "prod",
+		Config:    &rest.Config{Host: "https://api.prod.example.com"},
+		Clientset: fake.NewClientset(),
+		Reauthenticate: func() (*rest.Config, kubernetes.Interface, error) {
+			return &rest.Config{Host: "https://api.prod.example.com"}, rebuilt, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan kubernetes.Interface, 2)
+	stopped := make(chan struct{}, 2)
+
+	fwd.watchClients(ctx, func(ctx context.Context, clientset kubernetes.Interface) {
+		started <- clientset
+
+		go func() {
+			<-ctx.Done()
+			stopped <- struct{}{}
+		}()
+	})
+
+	if cs := <-started; cs != fwd.Clientset {
+		t.Fatal("watchClients didn't start with the forwarder's clientset")
+	}
+
+	if _, _, err := fwd.reauthenticate("", time.Now()); err != nil {
+		t.Fatalf("reauthenticate: %v", err)
+	}
+
+	select {
+	case cs := <-started:
+		if cs != rebuilt {
+			t.Error("watchClients restarted with another clientset than the rebuilt one")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchClients didn't restart after the rebuild")
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the context of the previous start wasn't cancelled")
+	}
+}
+
+func TestIsUnauthorized(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{apierrors.NewUnauthorized("Unauthorized"), true},
+		{errors.New("unable to upgrade connection: Unauthorized"), true},
+		{errors.New("pods \"x\" is forbidden"), false},
+		{errors.New("getting credentials: exec: executable aws failed with exit code 255"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isUnauthorized(tt.err); got != tt.want {
+			t.Errorf("isUnauthorized(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
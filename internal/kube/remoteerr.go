@@ -0,0 +1,78 @@
+package kube
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/entwico/podproxy/internal/metrics"
+)
+
+// Kinds of errors the kubelet reports on the error stream of a port-forward.
+const (
+	// RemotePortNotListening means the pod refused the connection: nothing
+	// listens on the port.
+	RemotePortNotListening = "portNotListening"
+	// RemotePodNotFound means the pod or its sandbox is gone, e.g. deleted
+	// during a rollout.
+	RemotePodNotFound = "podNotFound"
+	// RemoteContainerNotRunning means the pod exists but isn't running.
+	RemoteContainerNotRunning = "containerNotRunning"
+	// RemoteOther is any other error.
+	RemoteOther = "other"
+)
+
+// RemoteError is an error reported by the kubelet for a port-forward, such
+// as "connection refused" from inside the pod's network namespace.
+type RemoteError struct {
+	Kind    string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.Message
+}
+
+// remoteErrorPatterns maps lowercase substrings of kubelet and container
+// runtime messages to kinds, checked in order: a refused connection to a
+// pod that is otherwise fine is reported with runtime details that may
+// contain the other patterns.
+var remoteErrorPatterns = []struct {
+	substr, kind string
+}{
+	{"connection refused", RemotePortNotListening},
+	{"not running", RemoteContainerNotRunning},
+	{"not found", RemotePodNotFound},
+	{"does not exist", RemotePodNotFound},
+	{"failed to find sandbox", RemotePodNotFound},
+}
+
+// newRemoteError classifies a message read from the error stream.
+func newRemoteError(msg string) *RemoteError {
+	lower := strings.ToLower(msg)
+
+	for _, p := range remoteErrorPatterns {
+		if strings.Contains(lower, p.substr) {
+			return &RemoteError{Kind: p.kind, Message: msg}
+		}
+	}
+
+	return &RemoteError{Kind: RemoteOther, Message: msg}
+}
+
+// RemoteErrorKind returns the kind of the RemoteError in err's chain, or ""
+// if there is none.
+func RemoteErrorKind(err error) string {
+	var remote *RemoteError
+	if errors.As(err, &remote) {
+		return remote.Kind
+	}
+
+	return ""
+}
+
+// countRemoteError counts err in the metrics if it is a RemoteError.
+func countRemoteError(cluster string, err error) {
+	if kind := RemoteErrorKind(err); kind != "" {
+		metrics.RemoteErrorsTotal.WithLabelValues(cluster, kind).Inc()
+	}
+}
@@ -0,0 +1,42 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewRemoteError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{
+			`error forwarding port 8080 to pod 4f2a, uid : failed to execute portforward in network namespace "/var/run/netns/cni-1": ` +
+				`failed to connect to localhost:8080 inside namespace "4f2a", IPv4: dial tcp4 127.0.0.1:8080: connect: connection refused`,
+			RemotePortNotListening,
+		},
+		{`error forwarding port 8080 to pod 4f2a, uid : failed to find sandbox "4f2a" in store: not found`, RemotePodNotFound},
+		{`error forwarding port 8080 to pod 4f2a, uid : sandbox container "4f2a" is not running`, RemoteContainerNotRunning},
+		{"Pod web-0 does not exist", RemotePodNotFound},
+		{"timed out waiting for the condition", RemoteOther},
+	}
+
+	for _, tt := range tests {
+		if got := newRemoteError(tt.msg).Kind; got != tt.want {
+			t.Errorf("newRemoteError(%q).Kind = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteErrorKind(t *testing.T) {
+	err := fmt.Errorf("relay: %w", newRemoteError("container not running"))
+
+	if got := RemoteErrorKind(err); got != RemoteContainerNotRunning {
+		t.Errorf("RemoteErrorKind(wrapped) = %q, want %q", got, RemoteContainerNotRunning)
+	}
+
+	if got := RemoteErrorKind(errors.New("connection refused")); got != "" {
+		t.Errorf("RemoteErrorKind(plain error) = %q, want empty", got)
+	}
+}
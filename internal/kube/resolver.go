@@ -2,8 +2,10 @@ package kube
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/netip"
 	"strconv"
 	"strings"
 )
@@ -12,12 +14,27 @@ import (
 // The go-socks5 library resolves hostnames via system DNS by default, which
 // fails for Kubernetes service names. This resolver skips DNS so the FQDN
 // is passed through to our DialContext where we handle Kubernetes resolution.
-type Resolver struct{}
+//
+// With FakeIPs set, the resolver returns a synthetic IP per hostname instead
+// of none, for clients that refuse to proceed without one. The SOCKS server
+// must then dial the original FQDN rather than the resolved IP.
+type Resolver struct {
+	FakeIPs *FakeIPPool
+}
+
+func (r Resolver) Resolve(ctx context.Context, name string) (context.Context, net.IP, error) {
+	if r.FakeIPs == nil {
+		return ctx, nil, nil
+	}
+
+	ip, err := r.FakeIPs.IP(name)
 
-func (r Resolver) Resolve(ctx context.Context, _ string) (context.Context, net.IP, error) {
-	return ctx, nil, nil
+	return ctx, ip, err
 }
 
+// ErrInvalidTarget means an address of a known cluster is malformed.
+var ErrInvalidTarget = errors.New("invalid cluster address")
+
 // Target represents a resolved Kubernetes destination for port-forwarding.
 type Target struct {
 	Cluster     string
@@ -26,6 +43,21 @@ type Target struct {
 	PodName     string
 	Namespace   string
 	Port        int
+	// Workload, if set, names the Deployment or StatefulSet whose ready
+	// pods are dialed.
+	Workload Workload
+	// Selector, if set, is the label selector of the pods dialed, for
+	// virtual hostnames configured as selector targets.
+	Selector string
+	// PodIP, if set, is the IP of the pod dialed, which is looked up before
+	// dialing.
+	PodIP netip.Addr
+	// APIServer is set for kubernetes.default, which is tunneled to the
+	// cluster's API server instead of port-forwarded.
+	APIServer bool
+	// Node, if set, is the node whose host port is reached through the API
+	// server's node proxy.
+	Node string
 }
 
 // ParseTarget parses a SOCKS5 destination address into a Kubernetes Target.
@@ -36,6 +68,15 @@ type Target struct {
 //	<svc>.<cluster>:<port>                → service in cluster's default namespace
 //	<svc>.<ns>.<cluster>:<port>           → service in namespace <ns>
 //	<pod>.<svc>.<ns>.<cluster>:<port>     → direct pod (StatefulSet pattern)
+//	<kind>/<name>.<ns>.<cluster>:<port>   → ready pod of a Deployment or StatefulSet
+//	<ip>.<ns>.pod.<cluster>:<port>        → pod with the IP, e.g. 10-244-1-5
+//	kubernetes.default.<cluster>:<port>   → the cluster's API server
+//	node-<name>.nodes.<cluster>:<port>    → host port of a node, HTTP only
+//
+// The namespace may be omitted from workload and pod IP addresses as from
+// service ones. Node addresses take precedence over service ones, so a
+// Service named node-<x> in a namespace named nodes can't be reached by its
+// name.
 func ParseTarget(addr string) (Target, error) {
 	host, portStr, err := net.SplitHostPort(addr)
 	if err != nil {
@@ -57,6 +98,54 @@ func ParseTarget(addr string) (Target, error) {
 
 	parts := strings.Split(host, ".")
 
+	if w, ok, err := parseWorkload(parts[0]); ok {
+		if err != nil {
+			return Target{}, err
+		}
+
+		target := Target{Cluster: parts[len(parts)-1], Workload: w, Port: port}
+
+		switch len(parts) {
+		case 2:
+		case 3:
+			target.Namespace = parts[1]
+		default:
+			return Target{}, fmt.Errorf("unsupported address format %q: expected <kind>/<name>[.<ns>].<cluster>", host)
+		}
+
+		return target, nil
+	}
+
+	if ip, ok := parsePodIP(parts[0]); ok && len(parts) >= 3 && parts[len(parts)-2] == "pod" {
+		target := Target{Cluster: parts[len(parts)-1], PodIP: ip, Port: port}
+
+		switch len(parts) {
+		case 3:
+		case 4:
+			target.Namespace = parts[1]
+		default:
+			return Target{}, fmt.Errorf("unsupported address format %q: expected <ip>[.<ns>].pod.<cluster>", host)
+		}
+
+		return target, nil
+	}
+
+	// node names may contain dots, e.g. ip-10-0-1-5.ec2.internal.
+	if len(parts) >= 3 && parts[len(parts)-2] == "nodes" && strings.HasPrefix(parts[0], nodePrefix) {
+		node := strings.TrimPrefix(strings.Join(parts[:len(parts)-2], "."), nodePrefix)
+		if node == "" {
+			return Target{}, fmt.Errorf("unsupported address format %q: expected %s<name>.nodes.<cluster>", host, nodePrefix)
+		}
+
+		return Target{Cluster: parts[len(parts)-1], Node: node, Port: port}, nil
+	}
+
+	// the endpoints of the kubernetes Service are the API servers, which
+	// can't be port-forwarded to.
+	if len(parts) == 3 && parts[0] == "kubernetes" && parts[1] == "default" {
+		return Target{Cluster: parts[2], ServiceName: "kubernetes", Namespace: "default", Port: port, APIServer: true}, nil
+	}
+
 	switch len(parts) {
 	case 2:
 		// <svc>.<cluster>:<port>
@@ -89,3 +178,35 @@ func ParseTarget(addr string) (Target, error) {
 		return Target{}, fmt.Errorf("unsupported address format %q: expected 2-4 dot-separated components", host)
 	}
 }
+
+// ParsePinnedTarget parses a destination address received on a listener pinned
+// to cluster. The cluster segment may be omitted, so the supported formats are
+// those of ParseTarget without the trailing <cluster>:
+//
+//	<svc>:<port>                → service in the default namespace
+//	<svc>.<ns>:<port>           → service in namespace <ns>
+//	<pod>.<svc>.<ns>:<port>     → direct pod (StatefulSet pattern)
+//	<kind>/<name>[.<ns>]:<port> → ready pod of a Deployment or StatefulSet
+//	<ip>[.<ns>].pod:<port>      → pod with the IP, e.g. 10-244-1-5
+//	<ip>:<port>                 → pod with the IP, e.g. 10.244.1.5
+func ParsePinnedTarget(addr, cluster string) (Target, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return Target{}, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+
+	// every IP reaching a pinned listener is one of its cluster's pods.
+	if target, ok, err := parseBarePodIP(addr, cluster); ok {
+		return target, err
+	}
+
+	host = strings.TrimSuffix(host, ".svc.cluster.local")
+	host = strings.TrimSuffix(host, ".svc")
+
+	// a single label is always a service, even if it is named like the cluster.
+	if !strings.HasSuffix(host, "."+cluster) {
+		host += "." + cluster
+	}
+
+	return ParseTarget(net.JoinHostPort(host, port))
+}
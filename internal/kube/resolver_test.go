@@ -105,6 +105,9 @@ func TestParseTargetErrors(t *testing.T) {
 		{"port zero", "redis.production:0"},
 		{"negative port", "redis.production:-1"},
 		{"port too large", "redis.production:65536"},
+		{"workload pod", "deployment/web.default.production.extra:80"},
+		{"unsupported workload kind", "daemonset/agent.production:80"},
+		{"workload without name", "deploy/.production:80"},
 	}
 
 	for _, tt := range tests {
@@ -116,3 +119,89 @@ func TestParseTargetErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTargetAPIServer(t *testing.T) {
+	target, err := ParseTarget("kubernetes.default.production:443")
+	if err != nil {
+		t.Fatalf("ParseTarget() error: %v", err)
+	}
+
+	if !target.APIServer || target.IsService || target.Cluster != "production" || target.Port != 443 {
+		t.Errorf("ParseTarget() = %+v, want the API server of production", target)
+	}
+
+	// only the default namespace's kubernetes Service is the API server.
+	if target, err := ParseTarget("kubernetes.monitoring.production:443"); err != nil || target.APIServer {
+		t.Errorf("ParseTarget() = %+v, %v, want a service target", target, err)
+	}
+
+	if target, err := ParsePinnedTarget("kubernetes.default.svc.cluster.local:443", "production"); err != nil || !target.APIServer {
+		t.Errorf("ParsePinnedTarget() = %+v, %v, want the API server", target, err)
+	}
+}
+
+func TestParseTargetNode(t *testing.T) {
+	tests := []struct {
+		addr     string
+		wantNode string
+		wantPort int
+	}{
+		{addr: "node-worker-1.nodes.production:9100", wantNode: "worker-1", wantPort: 9100},
+		{addr: "node-ip-10-0-1-5.ec2.internal.nodes.production:10250", wantNode: "ip-10-0-1-5.ec2.internal", wantPort: 10250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			target, err := ParseTarget(tt.addr)
+			if err != nil {
+				t.Fatalf("ParseTarget() error: %v", err)
+			}
+
+			if target.Node != tt.wantNode || target.Cluster != "production" || target.Port != tt.wantPort || target.IsService {
+				t.Errorf("ParseTarget() = %+v, want node %s port %d of production", target, tt.wantNode, tt.wantPort)
+			}
+		})
+	}
+
+	if _, err := ParseTarget("node-.nodes.production:80"); err == nil {
+		t.Error("ParseTarget() accepted a node address without a name")
+	}
+}
+
+func TestParsePinnedTarget(t *testing.T) {
+	tests := []struct {
+		addr        string
+		wantService bool
+		wantSvcName string
+		wantPod     string
+		wantNS      string
+	}{
+		{addr: "redis:6379", wantService: true, wantSvcName: "redis"},
+		{addr: "redis.cache:6379", wantService: true, wantSvcName: "redis", wantNS: "cache"},
+		{addr: "redis-0.redis.cache:6379", wantSvcName: "redis", wantPod: "redis-0", wantNS: "cache"},
+		{addr: "redis.cache.svc.cluster.local:6379", wantService: true, wantSvcName: "redis", wantNS: "cache"},
+		{addr: "redis.cache.production:6379", wantService: true, wantSvcName: "redis", wantNS: "cache"},
+		{addr: "production:6379", wantService: true, wantSvcName: "production"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			target, err := ParsePinnedTarget(tt.addr, "production")
+			if err != nil {
+				t.Fatalf("ParsePinnedTarget() error: %v", err)
+			}
+
+			if target.Cluster != "production" {
+				t.Errorf("Cluster = %q, want production", target.Cluster)
+			}
+
+			if target.IsService != tt.wantService || target.ServiceName != tt.wantSvcName || target.PodName != tt.wantPod || target.Namespace != tt.wantNS {
+				t.Errorf("target = %+v, want service=%v svc=%q pod=%q ns=%q", target, tt.wantService, tt.wantSvcName, tt.wantPod, tt.wantNS)
+			}
+		})
+	}
+
+	if _, err := ParsePinnedTarget("a.b.c.d:6379", "production"); err == nil {
+		t.Error("expected error for too many components")
+	}
+}
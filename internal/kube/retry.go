@@ -0,0 +1,107 @@
+package kube
+
+import (
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"syscall"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Error classes retried by default. RetryPolicy.Fatal names the ones that
+// should fail immediately instead.
+const (
+	RetryBrokenPipe        = "brokenPipe"
+	RetryConnectionReset   = "connectionReset"
+	RetryConnectionRefused = "connectionRefused"
+	RetryEOF               = "eof"
+	RetryTimeout           = "timeout"
+	RetryNoReadyEndpoints  = "noReadyEndpoints"
+	RetryPodGone           = "podGone"
+)
+
+// RetryClasses lists the error classes retried by default.
+var RetryClasses = []string{
+	RetryBrokenPipe,
+	RetryConnectionReset,
+	RetryConnectionRefused,
+	RetryEOF,
+	RetryTimeout,
+	RetryNoReadyEndpoints,
+	RetryPodGone,
+}
+
+// RetryPolicy adjusts which dial and resolve errors are retried, since
+// clusters and CNIs fail transiently in different ways. The zero value
+// retries the default classes only.
+type RetryPolicy struct {
+	// Errors are error message substrings that are retried in addition to
+	// the default classes.
+	Errors []string
+	// StatusCodes are API server response codes that are retried, e.g. from
+	// a failed SPDY upgrade or EndpointSlice lookup.
+	StatusCodes []int
+	// Fatal lists default classes that are not retried.
+	Fatal []string
+}
+
+// retriable reports whether err is transient and safe to retry.
+func (p RetryPolicy) retriable(err error) bool {
+	if class := retryClass(err); class != "" {
+		return !slices.Contains(p.Fatal, class)
+	}
+
+	msg := err.Error()
+
+	for _, s := range p.Errors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+
+	var status apierrors.APIStatus
+	if len(p.StatusCodes) > 0 && errors.As(err, &status) {
+		return slices.Contains(p.StatusCodes, int(status.Status().Code))
+	}
+
+	return false
+}
+
+// retryClass returns the default class err belongs to: network errors
+// (broken pipe, connection reset, refused, EOF, timeouts), service
+// resolution failures (no ready pods during a restart) and pods the kubelet
+// reports gone or stopped, which a retry may resolve to a replacement. Other
+// errors, including a pod not listening on the port, return "".
+func retryClass(err error) string {
+	var (
+		netErr net.Error
+		remote *RemoteError
+	)
+
+	switch {
+	case errors.As(err, &remote):
+		if remote.Kind == RemotePodNotFound || remote.Kind == RemoteContainerNotRunning {
+			return RetryPodGone
+		}
+
+		return ""
+	case errors.Is(err, syscall.EPIPE):
+		return RetryBrokenPipe
+	case errors.Is(err, syscall.ECONNRESET):
+		return RetryConnectionReset
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return RetryConnectionRefused
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return RetryEOF
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return RetryTimeout
+	// "no ready pod endpoints" happens when a service's pods are restarting
+	case strings.Contains(err.Error(), "no ready pod endpoints"):
+		return RetryNoReadyEndpoints
+	}
+
+	return ""
+}
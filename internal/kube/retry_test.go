@@ -0,0 +1,50 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{
+		Errors:      []string{"stream error: stream ID"},
+		StatusCodes: []int{503},
+		Fatal:       []string{RetryConnectionRefused},
+	}
+
+	tests := []struct {
+		name           string
+		err            error
+		wantDefault    bool
+		wantWithPolicy bool
+	}{
+		{"connection reset", fmt.Errorf("dial: %w", syscall.ECONNRESET), true, true},
+		{"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true, false},
+		{"eof", io.ErrUnexpectedEOF, true, true},
+		{"no ready pods", fmt.Errorf("%w for cache/redis", ErrNoReadyEndpoints), true, true},
+		{"custom message", errors.New("stream error: stream ID 3; INTERNAL_ERROR"), false, true},
+		{"unavailable", apierrors.NewServiceUnavailable("upgrading"), false, true},
+		{"forbidden", apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "web-0", errors.New("denied")), false, false},
+		{"other", errors.New("pod not found"), false, false},
+		{"pod gone", newRemoteError(`failed to find sandbox "4f2a" in store: not found`), true, true},
+		{"port not listening", newRemoteError("dial tcp4 127.0.0.1:8080: connect: connection refused"), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (RetryPolicy{}).retriable(tt.err); got != tt.wantDefault {
+				t.Errorf("default retriable(%v) = %v, want %v", tt.err, got, tt.wantDefault)
+			}
+
+			if got := policy.retriable(tt.err); got != tt.wantWithPolicy {
+				t.Errorf("policy retriable(%v) = %v, want %v", tt.err, got, tt.wantWithPolicy)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Protocol is the application protocol an upstream speaks.
+type Protocol string
+
+const (
+	// ProtocolTCP is an opaque byte stream, the default.
+	ProtocolTCP Protocol = "tcp"
+	// ProtocolHTTP is HTTP/1.1 in plain text.
+	ProtocolHTTP Protocol = "http"
+	// ProtocolHTTPS is HTTP over TLS.
+	ProtocolHTTPS Protocol = "https"
+	// ProtocolH2C is HTTP/2 in plain text with prior knowledge, as gRPC
+	// servers without TLS speak it.
+	ProtocolH2C Protocol = "h2c"
+)
+
+// Route declares the protocol of the upstream behind matching addresses and
+// whether podproxy originates TLS toward it.
+type Route struct {
+	// Match is a glob pattern of the address, with or without the port.
+	Match    string
+	Protocol Protocol
+	// TLS, if set, wraps connections in TLS toward the upstream, so clients
+	// can speak plain text to upstreams that require TLS. An empty
+	// ServerName is filled in with the host of the address.
+	TLS *tls.Config
+	// ClientKeepalive and UpstreamKeepalive, if set, are the idle periods
+	// after which keepalives are sent toward the client and the upstream.
+	// See Routes.Keepalive.
+	ClientKeepalive   time.Duration
+	UpstreamKeepalive time.Duration
+	// PairedPorts, if set, are ports whose connections from one client go
+	// to the same pod. See Routes.PairPorts.
+	PairedPorts []int
+}
+
+// Routes holds the routes of the proxy; the first match wins.
+type Routes []Route
+
+// match returns the first route matching addr, or nil.
+func (r Routes) match(addr string) *Route {
+	if i := r.index(addr); i >= 0 {
+		return &r[i]
+	}
+
+	return nil
+}
+
+// index returns the index of the first route matching addr, or -1.
+func (r Routes) index(addr string) int {
+	for i := range r {
+		if matchesAddr([]string{r[i].Match}, addr) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Protocol returns the protocol of the upstream behind addr, ProtocolTCP
+// unless a route declares another one.
+func (r Routes) Protocol(addr string) Protocol {
+	if route := r.match(addr); route != nil && route.Protocol != "" {
+		return route.Protocol
+	}
+
+	return ProtocolTCP
+}
+
+// OriginateTLS is a DialMiddleware that completes a TLS handshake with the
+// upstream of connections matching a route with TLS, and returns the
+// encrypted connection.
+func (r Routes) OriginateTLS(next DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		route := r.match(addr)
+		if route == nil || route.TLS == nil {
+			return conn, nil
+		}
+
+		cfg := route.TLS
+		if cfg.ServerName == "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+
+		// the handshake closes conn if ctx ends first, since tunnels don't
+		// support deadlines.
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("tls handshake with %s: %w", addr, err)
+		}
+
+		return tlsConn, nil
+	}
+}
@@ -0,0 +1,98 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutesProtocol(t *testing.T) {
+	routes := Routes{
+		{Match: "grpc.*.production:9090", Protocol: ProtocolH2C},
+		{Match: "*.production"},
+	}
+
+	tests := []struct {
+		addr string
+		want Protocol
+	}{
+		{"grpc.api.production:9090", ProtocolH2C},
+		{"grpc.api.production:8080", ProtocolTCP},
+		{"redis.cache.production:6379", ProtocolTCP},
+		{"github.com:443", ProtocolTCP},
+	}
+
+	for _, tt := range tests {
+		if got := routes.Protocol(tt.addr); got != tt.want {
+			t.Errorf("Protocol(%s) = %s, want %s", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestRoutesOriginateTLS(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.ServerName)
+	}))
+	defer backend.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(backend.Certificate())
+
+	routes := Routes{{
+		Match:    "api.web.production:8443",
+		Protocol: ProtocolHTTPS,
+		// the test certificate is issued for example.com.
+		TLS: &tls.Config{RootCAs: roots, ServerName: "example.com", MinVersion: tls.VersionTLS12},
+	}}
+
+	dial := routes.OriginateTLS(func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, backend.Listener.Addr().String())
+	})
+
+	conn, err := dial(context.Background(), "tcp", "api.web.production:8443")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	// the client speaks plain HTTP; the route encrypts it.
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: api.web.production:8443\r\nConnection: close\r\n\r\n")
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var sni string
+	fmt.Fscan(resp.Body, &sni)
+
+	if sni != "example.com" {
+		t.Errorf("backend saw SNI %q, want example.com", sni)
+	}
+
+	// other addresses are passed through untouched, and a failed
+	// verification fails the dial.
+	plain, err := dial(context.Background(), "tcp", "other.web.production:8443")
+	if err != nil {
+		t.Fatalf("dial unrouted: %v", err)
+	}
+	plain.Close()
+
+	if _, ok := plain.(*tls.Conn); ok {
+		t.Error("unrouted connection was wrapped in TLS")
+	}
+
+	routes[0].TLS = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+
+	if conn, err := dial(context.Background(), "tcp", "api.web.production:8443"); err == nil {
+		conn.Close()
+		t.Error("dial succeeded with a server name the certificate isn't issued for")
+	}
+}
@@ -0,0 +1,73 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SelectorTarget is a virtual hostname whose connections go to a ready pod
+// matching a label selector, for pods that no Service or workload name
+// picks out, such as the canary replicas of a Deployment.
+type SelectorTarget struct {
+	// Namespace, if set, is the namespace of the pods. The namespace of the
+	// hostname, or else the user's or the cluster's default, applies
+	// otherwise.
+	Namespace string
+	// Selector is a label selector, e.g. "app=api,track=canary".
+	Selector string
+}
+
+// selectorTarget returns the selector target for addr, whose cluster target
+// was parsed as target, if its hostname is one of selectors.
+func selectorTarget(selectors map[string]SelectorTarget, addr string, target Target) (Target, bool) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return target, false
+	}
+
+	s, ok := selectors[normalizeHost(host)]
+	if !ok {
+		return target, false
+	}
+
+	namespace := s.Namespace
+	if namespace == "" {
+		namespace = target.Namespace
+	}
+
+	return Target{
+		Cluster:   target.Cluster,
+		Namespace: namespace,
+		Selector:  s.Selector,
+		Port:      target.Port,
+	}, true
+}
+
+// SelectorPods returns the names of the ready pods of namespace matching
+// the label selector, sorted by name, or an error if there are none. Pods
+// that are being deleted are left out.
+func SelectorPods(ctx context.Context, clientset kubernetes.Interface, namespace, selector string) ([]string, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid selector %q: %w", ErrInvalidTarget, selector, err)
+	}
+
+	return readyPods(ctx, clientset, namespace, sel, fmt.Sprintf("selector %q in namespace %s", selector, namespace))
+}
+
+// selectedPods returns the ready pods of a workload or selector target, and
+// the name they are balanced and logged under.
+func selectedPods(ctx context.Context, clientset kubernetes.Interface, target Target) ([]string, string, error) {
+	if target.Selector != "" {
+		pods, err := SelectorPods(ctx, clientset, target.Namespace, target.Selector)
+		return pods, "selector/" + target.Selector, err
+	}
+
+	pods, err := WorkloadPods(ctx, clientset, target.Namespace, target.Workload)
+
+	return pods, target.Workload.String(), err
+}
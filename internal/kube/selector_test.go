@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSelectorPods(t *testing.T) {
+	clientset := workloadFixture()
+
+	pods, err := SelectorPods(context.Background(), clientset, "shop", "app=web")
+	if err != nil {
+		t.Fatalf("SelectorPods() error: %v", err)
+	}
+
+	if want := []string{"web-a", "web-b"}; !slices.Equal(pods, want) {
+		t.Errorf("SelectorPods() = %v, want %v", pods, want)
+	}
+
+	if _, err := SelectorPods(context.Background(), clientset, "shop", "app=queue"); !errors.Is(err, ErrNoReadyEndpoints) {
+		t.Errorf("SelectorPods(app=queue) error = %v, want ErrNoReadyEndpoints", err)
+	}
+
+	if _, err := SelectorPods(context.Background(), clientset, "shop", "app in web"); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("SelectorPods(invalid) error = %v, want ErrInvalidTarget", err)
+	}
+}
+
+func TestClusterDialerSelector(t *testing.T) {
+	var dialed []string
+
+	fwd := &PortForwarder{
+		Name:             "production",
+		DefaultNamespace: "default",
+		Clientset:        workloadFixture(),
+		dialFunc: func(ns, pod string, _ int) (*StreamConn, error) {
+			dialed = append(dialed, ns+"/"+pod)
+			return newTestStreamConn(), nil
+		},
+	}
+
+	d := &ClusterDialer{
+		Forwarders: map[string]*PortForwarder{"production": fwd},
+		Selectors: map[string]SelectorTarget{
+			"debug-web.production": {Namespace: "shop", Selector: "app=web"},
+			"web.shop.production":  {Selector: "app=web"},
+		},
+	}
+
+	for _, addr := range []string{"debug-web.production:8080", "Web.shop.production:8080"} {
+		dialed = nil
+
+		conn, err := d.DialContext(context.Background(), "tcp", addr)
+		if err != nil {
+			t.Fatalf("DialContext(%s): %v", addr, err)
+		}
+		conn.Close()
+
+		if len(dialed) != 1 || (dialed[0] != "shop/web-a" && dialed[0] != "shop/web-b") {
+			t.Errorf("DialContext(%s) dialed %v, want a ready pod matching app=web", addr, dialed)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package kube
+
+import (
+	"cmp"
+	"net"
+	"slices"
+	"strings"
+)
+
+// maxSuggestions is how many alternatives a "did you mean" hint lists.
+const maxSuggestions = 3
+
+// suggest returns up to maxSuggestions candidates within a small edit
+// distance of input, closest first. Exact matches are not suggestions.
+func suggest(input string, candidates []string) []string {
+	type match struct {
+		candidate string
+		distance  int
+	}
+
+	limit := max(1, len(input)/3)
+
+	var matches []match
+
+	for _, c := range candidates {
+		if d := levenshtein(input, c); d > 0 && d <= limit {
+			matches = append(matches, match{c, d})
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b match) int {
+		return cmp.Or(cmp.Compare(a.distance, b.distance), cmp.Compare(a.candidate, b.candidate))
+	})
+
+	out := make([]string, 0, min(len(matches), maxSuggestions))
+	for _, m := range matches[:min(len(matches), maxSuggestions)] {
+		out = append(out, m.candidate)
+	}
+
+	return out
+}
+
+// levenshtein returns the number of single-byte insertions, deletions and
+// substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// Suggest returns the addresses of cached Services of cluster whose
+// namespace and name are close to the given ones, for "did you mean" hints.
+func (c *ServiceCatalog) Suggest(cluster, namespace, name string) []string {
+	services := c.Services(cluster, "")
+
+	candidates := make([]string, 0, len(services))
+	for _, svc := range services {
+		candidates = append(candidates, svc.Name+"."+svc.Namespace)
+	}
+
+	suggestions := suggest(name+"."+namespace, candidates)
+	for i, s := range suggestions {
+		suggestions[i] = s + "." + cluster
+	}
+
+	return suggestions
+}
+
+// suggestCluster returns addr's hostname with its last label replaced by the
+// closest cluster name, or "" if no cluster name is close.
+func (d *ClusterDialer) suggestCluster(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+
+	i := strings.LastIndexByte(host, '.')
+	if i < 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(d.Forwarders))
+	for name := range d.Forwarders {
+		if d.Visibility == nil || matchesAny(d.Visibility.Clusters, name) {
+			names = append(names, name)
+		}
+	}
+
+	s := suggest(host[i+1:], names)
+	if len(s) == 0 {
+		return ""
+	}
+
+	return host[:i+1] + s[0]
+}
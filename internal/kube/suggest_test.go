@@ -0,0 +1,47 @@
+package kube
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"redis", "redis", 0},
+		{"redsi", "redis", 2},
+		{"redis", "", 5},
+		{"postgres", "postgrs", 1},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"redis.db", "redis.cache", "postgres.db", "api.web", "apis.web"}
+
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"reddis.db", []string{"redis.db"}},
+		{"redis.dbs", []string{"redis.db"}},
+		{"redis.db", nil},
+		{"api.webb", []string{"api.web", "apis.web"}},
+		{"mysql.db", nil},
+	}
+
+	for _, tt := range tests {
+		if got := suggest(tt.input, candidates); !slices.Equal(got, tt.want) {
+			t.Errorf("suggest(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ServiceTargetPort returns the container port of pod that a connection to
+// port of a Service goes to: the targetPort of the Service port declaring
+// port, looked up among the pod's container ports if it is named. Ports the
+// Service doesn't declare, and Services that can't be read, keep port, so
+// clients addressing container ports directly keep working.
+func ServiceTargetPort(ctx context.Context, clientset kubernetes.Interface, namespace, serviceName, pod string, port int) (int, error) {
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		return port, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("getting service %s/%s: %w", namespace, serviceName, err)
+	}
+
+	return targetPort(ctx, clientset, svc, pod, port)
+}
+
+// targetPort maps port of svc to the container port of pod.
+func targetPort(ctx context.Context, clientset kubernetes.Interface, svc *corev1.Service, pod string, port int) (int, error) {
+	target, ok := declaredTargetPort(svc, port)
+	if !ok {
+		return port, nil
+	}
+
+	if target.Type == intstr.Int {
+		return target.IntValue(), nil
+	}
+
+	p, err := clientset.CoreV1().Pods(svc.Namespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("getting pod %s/%s for named port %q: %w", svc.Namespace, pod, target.StrVal, err)
+	}
+
+	for _, c := range p.Spec.Containers {
+		for _, cp := range c.Ports {
+			if cp.Name == target.StrVal && (cp.Protocol == "" || cp.Protocol == corev1.ProtocolTCP) {
+				return int(cp.ContainerPort), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("%w: pod %s/%s has no container port named %q", ErrInvalidTarget, svc.Namespace, pod, target.StrVal)
+}
+
+// declaredTargetPort returns the targetPort of the TCP port of svc that
+// declares port. A zero targetPort means the same port, as in the API.
+func declaredTargetPort(svc *corev1.Service, port int) (intstr.IntOrString, bool) {
+	for _, sp := range svc.Spec.Ports {
+		if int(sp.Port) != port || (sp.Protocol != "" && sp.Protocol != corev1.ProtocolTCP) {
+			continue
+		}
+
+		if sp.TargetPort.Type == intstr.Int && sp.TargetPort.IntVal == 0 {
+			return intstr.FromInt32(sp.Port), true
+		}
+
+		return sp.TargetPort, true
+	}
+
+	return intstr.IntOrString{}, false
+}
+
+// serviceTargetPort maps port of a service target to the container port of
+// pod, reading the Service from Catalog when it has it.
+func (k *PortForwarder) serviceTargetPort(ctx context.Context, clientset kubernetes.Interface, user, namespace, service, pod string, port int) (int, error) {
+	// like Endpoints, the catalog is read with the forwarder's own
+	// credentials.
+	if k.Catalog != nil && (k.Impersonate == nil || user == "") {
+		if svc := k.Catalog.service(k.Name, namespace, service); svc != nil {
+			return targetPort(ctx, clientset, svc, pod, port)
+		}
+	}
+
+	return ServiceTargetPort(ctx, clientset, namespace, service, pod, port)
+}
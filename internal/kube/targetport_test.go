@@ -0,0 +1,93 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestServiceTargetPort(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "web"},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt32(8080)},
+				{Port: 443, TargetPort: intstr.FromString("https")},
+				{Port: 9000, TargetPort: intstr.FromString("missing")},
+				{Port: 9090},
+				{Port: 53, Protocol: corev1.ProtocolUDP, TargetPort: intstr.FromInt32(5353)},
+			}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-0", Namespace: "web"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "api",
+				Ports: []corev1.ContainerPort{{Name: "https", ContainerPort: 8443}},
+			}}},
+		},
+	)
+
+	tests := []struct {
+		service string
+		port    int
+		want    int
+	}{
+		{"api", 80, 8080},
+		{"api", 443, 8443},
+		{"api", 9090, 9090},
+		{"api", 53, 53},
+		// ports the Service doesn't declare, and unknown Services, are
+		// dialed as is.
+		{"api", 8080, 8080},
+		{"missing", 80, 80},
+	}
+
+	for _, tt := range tests {
+		got, err := ServiceTargetPort(context.Background(), clientset, "web", tt.service, "api-0", tt.port)
+		if err != nil || got != tt.want {
+			t.Errorf("ServiceTargetPort(%s:%d) = %d, %v, want %d", tt.service, tt.port, got, err, tt.want)
+		}
+	}
+
+	if _, err := ServiceTargetPort(context.Background(), clientset, "web", "api", "api-0", 9000); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("ServiceTargetPort(api:9000) error = %v, want ErrInvalidTarget", err)
+	}
+}
+
+func TestDialTargetMapsServicePort(t *testing.T) {
+	var gotPort int
+
+	fwd := &PortForwarder{
+		Name: "production",
+		resolveFunc: func(context.Context, string, string) ([]string, error) {
+			return []string{"api-0"}, nil
+		},
+		targetPortFunc: func(_ context.Context, _, _, _ string, port int) (int, error) {
+			return port + 8000, nil
+		},
+		dialFunc: func(_, _ string, port int) (*StreamConn, error) {
+			gotPort = port
+			return newTestStreamConn(), nil
+		},
+	}
+
+	conn, err := fwd.dialTarget(context.Background(), "api.web.production:80", Target{
+		Namespace:   "web",
+		ServiceName: "api",
+		Port:        80,
+		IsService:   true,
+	})
+	if err != nil {
+		t.Fatalf("dialTarget: %v", err)
+	}
+	conn.Close()
+
+	if gotPort != 8080 {
+		t.Errorf("dialed port %d, want 8080", gotPort)
+	}
+}
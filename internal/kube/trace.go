@@ -0,0 +1,81 @@
+package kube
+
+import "time"
+
+// traced reports whether connections to addr are traced from the start:
+// addr, or its host without the port, matches one of the Trace patterns.
+func (k *PortForwarder) traced(addr string) bool {
+	return len(k.Trace) > 0 && matchesAddr(k.Trace, addr)
+}
+
+// Read reads from the tunnel, logging the size and wait of every read while
+// the connection is traced.
+func (c *logOnCloseConn) Read(b []byte) (int, error) {
+	if !c.trace.Load() {
+		return c.tunnel.Read(b)
+	}
+
+	start := time.Now()
+	n, err := c.tunnel.Read(b)
+	c.traceIO("read", start, n, err)
+
+	return n, err
+}
+
+// Write writes to the tunnel, logging the size and wait of every write while
+// the connection is traced.
+func (c *logOnCloseConn) Write(b []byte) (int, error) {
+	if !c.trace.Load() {
+		return c.tunnel.Write(b)
+	}
+
+	start := time.Now()
+	n, err := c.tunnel.Write(b)
+	c.traceIO("write", start, n, err)
+
+	return n, err
+}
+
+// traceIO logs one traced read or write. wait is how long the call blocked,
+// at its start as an offset into the connection, so stalls such as a client
+// waiting on a half-close show up as a long read wait.
+func (c *logOnCloseConn) traceIO(op string, start time.Time, n int, err error) {
+	if c.logger == nil {
+		return
+	}
+
+	attrs := []any{
+		"op", op,
+		"bytes", n,
+		"wait", time.Since(start).String(),
+		"at", start.Sub(c.record.Start).Round(time.Millisecond).String(),
+		"conn", c.connID,
+	}
+
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+
+	c.logger.Info("trace", attrs...)
+}
+
+// SetTrace turns tracing of the open connection with the given ID on or off.
+// It reports false if no such connection is open.
+func (t *Traffic) SetTrace(id uint64, on bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for c := range t.open {
+		if c.connID == id {
+			c.trace.Store(on)
+
+			if c.logger != nil {
+				c.logger.Info("connection tracing changed", "trace", on, "addr", c.origAddr, "conn", id)
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
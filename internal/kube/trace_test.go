@@ -0,0 +1,81 @@
+package kube
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestTraced(t *testing.T) {
+	k := &PortForwarder{Trace: []string{"postgres.*.prod", "*.cache.prod:6379"}}
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"postgres.db.prod:5432", true},
+		{"redis.cache.prod:6379", true},
+		{"redis.cache.prod:6380", false},
+		{"api.web.prod:80", false},
+	}
+
+	for _, tt := range tests {
+		if got := k.traced(tt.addr); got != tt.want {
+			t.Errorf("traced(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+
+	if (&PortForwarder{}).traced("postgres.db.prod:5432") {
+		t.Error("traced() without patterns = true, want false")
+	}
+}
+
+func TestTraceConn(t *testing.T) {
+	var logs bytes.Buffer
+
+	sc, remote, _ := newTestStreamConnPipes()
+	defer sc.Close()
+
+	c := &logOnCloseConn{
+		tunnel: sc,
+		logger: slog.New(slog.NewTextHandler(&logs, nil)),
+		connID: 7,
+	}
+
+	traffic := &Traffic{}
+	traffic.track(c)
+
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, err := remote.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	if _, err := c.Write([]byte("untraced")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	if strings.Contains(logs.String(), "msg=trace") {
+		t.Fatalf("untraced write logged: %s", logs.String())
+	}
+
+	if !traffic.SetTrace(7, true) {
+		t.Fatal("SetTrace(7) = false, want true")
+	}
+
+	if traffic.SetTrace(8, true) {
+		t.Error("SetTrace(8) for an unknown connection = true, want false")
+	}
+
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	if out := logs.String(); !strings.Contains(out, "msg=trace op=write bytes=5") || !strings.Contains(out, "conn=7") {
+		t.Errorf("traced write not logged: %s", out)
+	}
+}
@@ -0,0 +1,235 @@
+package kube
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrRevoked is wrapped by the cause of connections closed by Revoke.
+var ErrRevoked = errors.New("connection revoked")
+
+// NamespaceTraffic is the traffic of one namespace of a cluster since
+// podproxy started, including connections that are still open.
+type NamespaceTraffic struct {
+	Cluster      string
+	Namespace    string
+	BytesRead    int64
+	BytesWritten int64
+	// Connections counts all connections, Active the open ones.
+	Connections int64
+	Active      int
+}
+
+// Traffic accounts the bytes transferred through cluster connections by
+// cluster and namespace. It is shared by the forwarders of all clusters.
+type Traffic struct {
+	mu     sync.Mutex
+	closed map[trafficKey]*NamespaceTraffic
+	open   map[*logOnCloseConn]struct{}
+}
+
+type trafficKey struct {
+	cluster, namespace string
+}
+
+// track registers an established connection, giving it the context Revoke
+// cancels. It is safe to call on a nil Traffic.
+func (t *Traffic) track(c *logOnCloseConn) {
+	if t == nil {
+		return
+	}
+
+	c.ctx, c.cancel = context.WithCancelCause(context.Background())
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.open == nil {
+		t.open = make(map[*logOnCloseConn]struct{})
+	}
+
+	t.open[c] = struct{}{}
+}
+
+// untrack moves the final byte counts of c into the namespace totals. It is
+// safe to call on a nil Traffic.
+func (t *Traffic) untrack(c *logOnCloseConn) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.open, c)
+
+	nt := t.totals(c.record.Cluster, c.record.Namespace)
+	nt.BytesRead += c.BytesRead()
+	nt.BytesWritten += c.BytesWritten()
+	nt.Connections++
+}
+
+// totals returns the entry of a namespace, creating it. t.mu must be held.
+func (t *Traffic) totals(cluster, namespace string) *NamespaceTraffic {
+	if t.closed == nil {
+		t.closed = make(map[trafficKey]*NamespaceTraffic)
+	}
+
+	key := trafficKey{cluster, namespace}
+
+	nt := t.closed[key]
+	if nt == nil {
+		nt = &NamespaceTraffic{Cluster: cluster, Namespace: namespace}
+		t.closed[key] = nt
+	}
+
+	return nt
+}
+
+// Namespaces returns the traffic of every namespace connected to, most bytes
+// first.
+func (t *Traffic) Namespaces() []NamespaceTraffic {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byKey := make(map[trafficKey]NamespaceTraffic, len(t.closed))
+	for key, nt := range t.closed {
+		byKey[key] = *nt
+	}
+
+	for c := range t.open {
+		key := trafficKey{c.record.Cluster, c.record.Namespace}
+
+		nt := byKey[key]
+		nt.Cluster, nt.Namespace = key.cluster, key.namespace
+		nt.BytesRead += c.BytesRead()
+		nt.BytesWritten += c.BytesWritten()
+		nt.Connections++
+		nt.Active++
+		byKey[key] = nt
+	}
+
+	out := make([]NamespaceTraffic, 0, len(byKey))
+	for _, nt := range byKey {
+		out = append(out, nt)
+	}
+
+	slices.SortFunc(out, func(a, b NamespaceTraffic) int {
+		return cmp.Or(
+			cmp.Compare(b.BytesRead+b.BytesWritten, a.BytesRead+a.BytesWritten),
+			cmp.Compare(a.Cluster, b.Cluster),
+			cmp.Compare(a.Namespace, b.Namespace),
+		)
+	})
+
+	return out
+}
+
+// OpenConn is a snapshot of an open cluster connection.
+type OpenConn struct {
+	ID        uint64
+	Cluster   string
+	Namespace string
+	// Addr is the address the client asked for, Target the pod or Service
+	// address it was forwarded to.
+	Addr         string
+	Target       string
+	User         string
+	Start        time.Time
+	BytesRead    int64
+	BytesWritten int64
+	// Idle is how long no data was transferred.
+	Idle time.Duration
+}
+
+// Open returns the open connections, oldest first.
+func (t *Traffic) Open() []OpenConn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]OpenConn, 0, len(t.open))
+	for c := range t.open {
+		out = append(out, c.snapshot())
+	}
+
+	slices.SortFunc(out, func(a, b OpenConn) int {
+		return cmp.Or(a.Start.Compare(b.Start), cmp.Compare(a.ID, b.ID))
+	})
+
+	return out
+}
+
+// Revoke closes the open connections for which reason returns an error,
+// recording it as the cause, and returns how many it closed. The clients'
+// tunnels end with them.
+func (t *Traffic) Revoke(reason func(OpenConn) error) int {
+	return t.revoke(ErrRevoked, func(c *logOnCloseConn) error {
+		return reason(c.snapshot())
+	})
+}
+
+// revoke closes the open connections for which reason returns an error,
+// recording kind and the error as the cause, and returns how many it closed.
+func (t *Traffic) revoke(kind error, reason func(*logOnCloseConn) error) int {
+	type revocation struct {
+		conn  *logOnCloseConn
+		cause error
+	}
+
+	var revoked []revocation
+
+	t.mu.Lock()
+
+	for c := range t.open {
+		if err := reason(c); err != nil {
+			revoked = append(revoked, revocation{c, err})
+		}
+	}
+
+	t.mu.Unlock()
+
+	// closing untracks the connections, which takes t.mu.
+	for _, r := range revoked {
+		r.conn.cancel(fmt.Errorf("%w: %w", kind, r.cause))
+		_ = r.conn.Close()
+	}
+
+	return len(revoked)
+}
+
+// RevokeDenied closes the open connections to clusters whose access policy
+// doesn't allow connections any more, e.g. after the on-call flag was
+// cleared, and returns how many it closed.
+func (t *Traffic) RevokeDenied(forwarders map[string]*PortForwarder) int {
+	now := time.Now()
+
+	return t.Revoke(func(c OpenConn) error {
+		fwd := forwarders[c.Cluster]
+		if fwd == nil {
+			return nil
+		}
+
+		return fwd.Policy.check(c.Cluster, now)
+	})
+}
+
+// snapshot returns the current state of c.
+func (c *logOnCloseConn) snapshot() OpenConn {
+	return OpenConn{
+		ID:           c.connID,
+		Cluster:      c.record.Cluster,
+		Namespace:    c.record.Namespace,
+		Addr:         c.origAddr,
+		Target:       c.resolved,
+		User:         c.record.User,
+		Start:        c.record.Start,
+		BytesRead:    c.BytesRead(),
+		BytesWritten: c.BytesWritten(),
+		Idle:         c.Idle(),
+	}
+}
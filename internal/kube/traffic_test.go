@@ -0,0 +1,203 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/history"
+)
+
+func trafficConn(cluster, namespace string, read, written int64) *logOnCloseConn {
+	sc := &StreamConn{errDone: make(chan struct{})}
+	sc.bytesRead.Add(read)
+	sc.bytesWritten.Add(written)
+	sc.lastActive.Store(time.Now().UnixNano())
+
+	c := &logOnCloseConn{
+		tunnel: sc,
+		record: history.Record{Cluster: cluster, Namespace: namespace},
+	}
+
+	return c
+}
+
+func TestTrafficNamespaces(t *testing.T) {
+	traffic := &Traffic{}
+
+	done := trafficConn("prod", "billing", 100, 50)
+	traffic.track(done)
+	traffic.untrack(done)
+
+	traffic.track(trafficConn("prod", "billing", 10, 0))
+	traffic.track(trafficConn("dev", "apps", 1000, 0))
+
+	got := traffic.Namespaces()
+	want := []NamespaceTraffic{
+		{Cluster: "dev", Namespace: "apps", BytesRead: 1000, Connections: 1, Active: 1},
+		{Cluster: "prod", Namespace: "billing", BytesRead: 110, BytesWritten: 50, Connections: 2, Active: 1},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Namespaces() = %+v, want %+v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Namespaces()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTrafficNil(t *testing.T) {
+	var traffic *Traffic
+
+	c := trafficConn("prod", "billing", 1, 1)
+	traffic.track(c)
+	traffic.untrack(c)
+}
+
+func TestTrafficOpen(t *testing.T) {
+	traffic := &Traffic{}
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	newer := trafficConn("prod", "billing", 10, 20)
+	newer.connID = 2
+	newer.origAddr = "api.billing.prod:8080"
+	newer.record.Start = start.Add(time.Second)
+
+	older := trafficConn("dev", "apps", 1, 2)
+	older.connID = 1
+	older.record.Start = start
+
+	closed := trafficConn("dev", "apps", 5, 5)
+
+	for _, c := range []*logOnCloseConn{newer, older, closed} {
+		traffic.track(c)
+	}
+
+	traffic.untrack(closed)
+
+	got := traffic.Open()
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+		t.Fatalf("Open() = %+v, want connections 1 and 2", got)
+	}
+
+	want := OpenConn{
+		ID:           2,
+		Cluster:      "prod",
+		Namespace:    "billing",
+		Addr:         "api.billing.prod:8080",
+		Start:        start.Add(time.Second),
+		BytesRead:    10,
+		BytesWritten: 20,
+	}
+
+	// the connection was active when the fixture was built.
+	if got[1].Idle < 0 || got[1].Idle > time.Minute {
+		t.Errorf("Open()[1].Idle = %v, want about 0", got[1].Idle)
+	}
+
+	got[1].Idle = 0
+	if got[1] != want {
+		t.Errorf("Open()[1] = %+v, want %+v", got[1], want)
+	}
+}
+
+func TestTrafficRevoke(t *testing.T) {
+	store := &memoryHistory{}
+	traffic := &Traffic{}
+
+	fwd := &PortForwarder{
+		Name:    "production",
+		History: store,
+		Traffic: traffic,
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			return newTestStreamConn(), nil
+		},
+	}
+
+	alice, err := fwd.dialTarget(auth.WithUser(context.Background(), "alice"), "mypod.ns.production:8080", directPodTarget)
+	if err != nil {
+		t.Fatalf("dialTarget() error: %v", err)
+	}
+
+	bob, err := fwd.dialTarget(auth.WithUser(context.Background(), "bob"), "mypod.ns.production:8080", directPodTarget)
+	if err != nil {
+		t.Fatalf("dialTarget() error: %v", err)
+	}
+	defer bob.Close()
+
+	n := traffic.Revoke(func(c OpenConn) error {
+		if c.User == "alice" {
+			return errors.New("user removed")
+		}
+
+		return nil
+	})
+	if n != 1 {
+		t.Errorf("Revoke() = %d, want 1", n)
+	}
+
+	if open := traffic.Open(); len(open) != 1 || open[0].User != "bob" {
+		t.Errorf("Open() = %+v, want bob's connection", open)
+	}
+
+	if _, err := alice.Read(make([]byte, 1)); err == nil {
+		t.Error("Read() on a revoked connection succeeded")
+	}
+
+	if len(store.records) != 1 || store.records[0].Outcome != history.OutcomeRevoked || store.records[0].Error != "connection revoked: user removed" {
+		t.Errorf("records = %+v, want alice's revoked connection", store.records)
+	}
+
+	// closing a revoked connection again doesn't record it twice.
+	_ = alice.Close()
+
+	if len(store.records) != 1 {
+		t.Errorf("records = %+v, want one", store.records)
+	}
+}
+
+func TestTrafficRevokeDenied(t *testing.T) {
+	traffic := &Traffic{}
+	onCall := &OnCallFlag{}
+	onCall.SetOnCall(true)
+
+	forwarders := map[string]*PortForwarder{}
+
+	for _, name := range []string{"production", "staging"} {
+		forwarders[name] = &PortForwarder{
+			Name:    name,
+			Traffic: traffic,
+			dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+				return newTestStreamConn(), nil
+			},
+		}
+	}
+
+	forwarders["production"].Policy = &AccessPolicy{OnCall: onCall.OnCall}
+
+	for _, fwd := range forwarders {
+		if _, err := fwd.dialTarget(context.Background(), "mypod.ns."+fwd.Name+":8080", directPodTarget); err != nil {
+			t.Fatalf("dialTarget() error: %v", err)
+		}
+	}
+
+	if n := traffic.RevokeDenied(forwarders); n != 0 {
+		t.Errorf("RevokeDenied() while on call = %d, want 0", n)
+	}
+
+	onCall.SetOnCall(false)
+
+	if n := traffic.RevokeDenied(forwarders); n != 1 {
+		t.Errorf("RevokeDenied() = %d, want 1", n)
+	}
+
+	if open := traffic.Open(); len(open) != 1 || open[0].Cluster != "staging" {
+		t.Errorf("Open() = %+v, want the staging connection", open)
+	}
+}
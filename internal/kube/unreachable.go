@@ -0,0 +1,82 @@
+package kube
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// isUnreachableError reports whether err means the cluster's API server
+// couldn't be reached at all, as opposed to a failure inside the cluster.
+func isUnreachableError(err error) bool {
+	var (
+		dnsErr *net.DNSError
+		opErr  *net.OpError
+		remote *RemoteError
+	)
+
+	switch {
+	case errors.As(err, &remote):
+		// the kubelet answered, so the API server was reached.
+		return false
+	case errors.As(err, &dnsErr):
+		return true
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH)
+}
+
+// Unreachable reports whether the last connection to the cluster failed
+// because its API server couldn't be reached.
+func (k *PortForwarder) Unreachable() bool {
+	k.reach.Lock()
+	defer k.reach.Unlock()
+
+	return k.unreachable
+}
+
+// unreachableFailed records that err means the cluster is unreachable. The
+// first failure is reported to OnUnreachable.
+func (k *PortForwarder) unreachableFailed(err error) {
+	k.reach.Lock()
+	was := k.unreachable
+	k.unreachable = true
+	k.reachErr = err
+
+	if !was {
+		k.reachSince = time.Now()
+	}
+	k.reach.Unlock()
+
+	if was {
+		return
+	}
+
+	if k.Logger != nil {
+		k.Logger.Warn("cluster unreachable", "error", err)
+	}
+
+	if k.OnUnreachable != nil {
+		k.OnUnreachable(k.Name, err)
+	}
+}
+
+// reachable ends an unreachable period after a connection got through.
+func (k *PortForwarder) reachable() {
+	k.reach.Lock()
+	was := k.unreachable
+	k.unreachable = false
+	k.reachErr = nil
+
+	if was {
+		k.reachSince = time.Now()
+	}
+	k.reach.Unlock()
+
+	if was && k.Logger != nil {
+		k.Logger.Info("cluster reachable again")
+	}
+}
@@ -0,0 +1,74 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestIsUnreachableError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&net.DNSError{Err: "no such host", Name: "api.production.example.com", IsNotFound: true}, true},
+		{fmt.Errorf("upgrade: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ETIMEDOUT}), true},
+		{syscall.EHOSTUNREACH, true},
+		{&RemoteError{Kind: RemotePortNotListening, Message: "connect: connection refused"}, false},
+		{ErrServiceNotFound, false},
+		{errors.New("Unauthorized"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isUnreachableError(tt.err); got != tt.want {
+			t.Errorf("isUnreachableError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDialTargetReportsUnreachable(t *testing.T) {
+	var reported []string
+
+	down := true
+
+	fwd := &PortForwarder{
+		Name: "production",
+		OnUnreachable: func(cluster string, _ error) {
+			reported = append(reported, cluster)
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			if down {
+				return nil, &net.DNSError{Err: "no such host", Name: "api.production.example.com", IsNotFound: true}
+			}
+
+			return newTestStreamConn(), nil
+		},
+	}
+
+	target := Target{Namespace: "db", PodName: "postgres-0", Port: 5432}
+
+	for range 2 {
+		if _, err := fwd.dialTarget(context.Background(), "postgres-0.postgres.db.production:5432", target); err == nil {
+			t.Fatal("dialTarget succeeded while the cluster was down")
+		}
+	}
+
+	if len(reported) != 1 || !fwd.Unreachable() {
+		t.Fatalf("reported %v, Unreachable() = %v, want one report", reported, fwd.Unreachable())
+	}
+
+	down = false
+
+	conn, err := fwd.dialTarget(context.Background(), "postgres-0.postgres.db.production:5432", target)
+	if err != nil {
+		t.Fatalf("dialTarget: %v", err)
+	}
+	conn.Close()
+
+	if fwd.Unreachable() {
+		t.Error("Unreachable() after a connection got through")
+	}
+}
@@ -0,0 +1,263 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// vaultRetryInterval is how long VaultCredentials.Run waits after a failed
+// renewal before trying again.
+const vaultRetryInterval = 30 * time.Second
+
+// VaultCredentials issues short-lived service account tokens for a cluster
+// from the Kubernetes secrets engine of HashiCorp Vault, and renews them once
+// two thirds of their lease have passed.
+type VaultCredentials struct {
+	// Address of Vault, e.g. https://vault.example.com:8200.
+	Address string
+	// Mount is the path the secrets engine is mounted at.
+	Mount string
+	Role  string
+	// Namespace is the Kubernetes namespace the token is issued for.
+	Namespace string
+	// TTL requested for the token. Zero uses the role's default.
+	TTL time.Duration
+	// TokenFile holds the Vault token, as written by `vault login`. The
+	// VAULT_TOKEN environment variable takes precedence.
+	TokenFile string
+
+	HTTPClient *http.Client
+	Logger     *slog.Logger
+
+	fetchMu sync.Mutex // serializes requests to Vault
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	renewAt time.Time
+
+	// test override — if nil, time.Now is used.
+	now func() time.Time
+}
+
+// vaultCredsResponse is the part of a secrets engine response podproxy uses.
+type vaultCredsResponse struct {
+	LeaseDuration int `json:"lease_duration"`
+	Data          struct {
+		ServiceAccountToken string `json:"service_account_token"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// Token returns a valid service account token, requesting a new one from
+// Vault when the current one is due for renewal. While Vault is unreachable,
+// the current token is used until it expires.
+func (v *VaultCredentials) Token(ctx context.Context) (string, error) {
+	if token, ok := v.cached(false); ok {
+		return token, nil
+	}
+
+	v.fetchMu.Lock()
+	defer v.fetchMu.Unlock()
+
+	// another caller may have renewed the token meanwhile.
+	if token, ok := v.cached(false); ok {
+		return token, nil
+	}
+
+	if err := v.renew(ctx); err != nil {
+		if token, ok := v.cached(true); ok {
+			if v.Logger != nil {
+				v.Logger.Warn("renewing vault credentials failed; using current token until it expires", "error", err)
+			}
+
+			return token, nil
+		}
+
+		return "", err
+	}
+
+	token, _ := v.cached(true)
+
+	return token, nil
+}
+
+// Run renews the token in the background whenever it is due, so connections
+// don't wait for Vault, and retries failed renewals every 30 seconds. It
+// returns when ctx is cancelled.
+func (v *VaultCredentials) Run(ctx context.Context) {
+	for {
+		wait := vaultRetryInterval
+
+		if _, err := v.Token(ctx); err != nil {
+			if v.Logger != nil {
+				v.Logger.Warn("requesting vault credentials failed", "error", err)
+			}
+		} else if _, ok := v.cached(false); ok {
+			v.mu.Lock()
+			wait = v.renewAt.Sub(v.clock())
+			v.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// cached returns the current token if it doesn't need renewal yet, or with
+// expired set, if it hasn't expired.
+func (v *VaultCredentials) cached(expired bool) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	deadline := v.renewAt
+	if expired {
+		deadline = v.expires
+	}
+
+	return v.token, v.token != "" && v.clock().Before(deadline)
+}
+
+// renew requests a new token from Vault.
+func (v *VaultCredentials) renew(ctx context.Context) error {
+	vaultToken, err := v.vaultToken()
+	if err != nil {
+		return err
+	}
+
+	params := map[string]string{"kubernetes_namespace": v.Namespace}
+	if v.TTL > 0 {
+		params["ttl"] = v.TTL.String()
+	}
+
+	body, _ := json.Marshal(params)
+
+	endpoint := strings.TrimRight(v.Address, "/") + "/v1/" + strings.Trim(v.Mount, "/") + "/creds/" + url.PathEscape(v.Role)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("vault request: %w", err)
+	}
+
+	req.Header.Set("X-Vault-Token", vaultToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := v.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	start := v.clock()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var creds vaultCredsResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&creds); err != nil && resp.StatusCode == http.StatusOK {
+		return fmt.Errorf("decoding vault response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault returned %s for role %q: %s", resp.Status, v.Role, strings.Join(creds.Errors, "; "))
+	}
+
+	if creds.Data.ServiceAccountToken == "" {
+		return fmt.Errorf("vault response for role %q has no service account token", v.Role)
+	}
+
+	lease := time.Duration(creds.LeaseDuration) * time.Second
+
+	v.mu.Lock()
+	v.token = creds.Data.ServiceAccountToken
+	v.expires = start.Add(lease)
+	v.renewAt = start.Add(lease * 2 / 3)
+	v.mu.Unlock()
+
+	if v.Logger != nil {
+		v.Logger.Debug("issued vault credentials", "role", v.Role, "lease", lease)
+	}
+
+	return nil
+}
+
+// vaultToken returns the token podproxy authenticates to Vault with.
+func (v *VaultCredentials) vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	data, err := os.ReadFile(v.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading vault token (run vault login): %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("vault token file is empty (run vault login)")
+	}
+
+	return token, nil
+}
+
+func (v *VaultCredentials) clock() time.Time {
+	if v.now != nil {
+		return v.now()
+	}
+
+	return time.Now()
+}
+
+// apply replaces the credentials of config with the Vault-issued token.
+func (v *VaultCredentials) apply(config *rest.Config) {
+	config.BearerToken = ""
+	config.BearerTokenFile = ""
+	config.Username = ""
+	config.Password = ""
+	config.CertFile = ""
+	config.CertData = nil
+	config.KeyFile = ""
+	config.KeyData = nil
+	config.ExecProvider = nil
+	config.AuthProvider = nil
+
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &vaultRoundTripper{creds: v, next: rt}
+	})
+}
+
+// vaultRoundTripper authenticates requests with the Vault-issued token.
+type vaultRoundTripper struct {
+	creds *VaultCredentials
+	next  http.RoundTripper
+}
+
+func (rt *vaultRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := rt.creds.Token(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("getting credentials: %w", err)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return rt.next.RoundTrip(req)
+}
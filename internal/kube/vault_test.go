@@ -0,0 +1,168 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeVault serves the creds endpoint of a Kubernetes secrets engine mounted
+// at kubernetes, issuing token-1, token-2, … with the given lease.
+func fakeVault(t *testing.T, lease int, fail *bool) (*httptest.Server, *int) {
+	t.Helper()
+
+	issued := new(int)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/kubernetes/creds/viewer" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Header.Get("X-Vault-Token") != "s.vault" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+
+			return
+		}
+
+		var params map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil || params["kubernetes_namespace"] != "apps" || params["ttl"] != "1h0m0s" {
+			t.Errorf("params = %v, err = %v", params, err)
+		}
+
+		if fail != nil && *fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		*issued++
+		fmt.Fprintf(w, `{"lease_duration":%d,"data":{"service_account_token":"token-%d"}}`, lease, *issued)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, issued
+}
+
+func writeVaultToken(t *testing.T, token string) string {
+	t.Helper()
+	t.Setenv("VAULT_TOKEN", "")
+
+	path := filepath.Join(t.TempDir(), ".vault-token")
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		t.Fatalf("writing token file: %v", err)
+	}
+
+	return path
+}
+
+func TestVaultCredentialsRenewal(t *testing.T) {
+	fail := false
+	srv, issued := fakeVault(t, 3600, &fail)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	v := &VaultCredentials{
+		Address:   srv.URL,
+		Mount:     "kubernetes",
+		Role:      "viewer",
+		Namespace: "apps",
+		TTL:       time.Hour,
+		TokenFile: writeVaultToken(t, "s.vault"),
+		now:       func() time.Time { return now },
+	}
+
+	for range 2 {
+		token, err := v.Token(context.Background())
+		if err != nil || token != "token-1" {
+			t.Fatalf("Token() = %q, %v, want token-1", token, err)
+		}
+	}
+
+	// two thirds into the lease the token is renewed.
+	now = now.Add(41 * time.Minute)
+
+	if token, _ := v.Token(context.Background()); token != "token-2" {
+		t.Errorf("Token() after 41m = %q, want token-2", token)
+	}
+
+	// while Vault is down the current token is used until it expires.
+	fail = true
+	now = now.Add(50 * time.Minute)
+
+	if token, err := v.Token(context.Background()); err != nil || token != "token-2" {
+		t.Errorf("Token() with Vault down = %q, %v, want token-2", token, err)
+	}
+
+	now = now.Add(20 * time.Minute)
+
+	if _, err := v.Token(context.Background()); err == nil {
+		t.Error("Token() after expiry with Vault down: want error")
+	}
+
+	if *issued != 2 {
+		t.Errorf("issued = %d, want 2", *issued)
+	}
+}
+
+func TestVaultCredentialsDenied(t *testing.T) {
+	srv, _ := fakeVault(t, 3600, nil)
+
+	v := &VaultCredentials{
+		Address:   srv.URL,
+		Mount:     "kubernetes",
+		Role:      "viewer",
+		Namespace: "apps",
+		TTL:       time.Hour,
+		TokenFile: writeVaultToken(t, "s.expired"),
+	}
+
+	_, err := v.Token(context.Background())
+	if err == nil {
+		t.Fatal("Token() with a rejected Vault token: want error")
+	}
+
+	if want := `vault returned 403 Forbidden for role "viewer": permission denied`; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestVaultRoundTripper(t *testing.T) {
+	srv, _ := fakeVault(t, 3600, nil)
+
+	v := &VaultCredentials{
+		Address:   srv.URL,
+		Mount:     "kubernetes",
+		Role:      "viewer",
+		Namespace: "apps",
+		TTL:       time.Hour,
+		TokenFile: writeVaultToken(t, "s.vault"),
+	}
+
+	var auth string
+
+	api := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer api.Close()
+
+	client := &http.Client{Transport: &vaultRoundTripper{creds: v, next: http.DefaultTransport}}
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, api.URL, nil)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+
+	resp.Body.Close()
+
+	if auth != "Bearer token-1" {
+		t.Errorf("Authorization = %q, want %q", auth, "Bearer token-1")
+	}
+}
@@ -0,0 +1,84 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+)
+
+// ErrNotVisible means the target's cluster or namespace is hidden from the
+// listener the connection arrived on.
+var ErrNotVisible = errors.New("not available on this listener")
+
+// Visibility restricts the clusters and namespaces a listener can reach.
+// Entries are path.Match patterns, e.g. "team-*". An empty list allows all.
+type Visibility struct {
+	Clusters   []string
+	Namespaces []string
+}
+
+// check returns an error wrapping ErrNotVisible unless the namespace of
+// cluster is visible. It is safe to call on a nil Visibility, which allows
+// everything.
+func (v *Visibility) check(cluster, namespace string) error {
+	if v == nil {
+		return nil
+	}
+
+	if !matchesAny(v.Clusters, cluster) {
+		return fmt.Errorf("cluster %s: %w", cluster, ErrNotVisible)
+	}
+
+	if !matchesAny(v.Namespaces, namespace) {
+		return fmt.Errorf("namespace %s.%s: %w", namespace, cluster, ErrNotVisible)
+	}
+
+	return nil
+}
+
+// checkTarget is check for the namespace of target. Nodes belong to no
+// namespace, so they are hidden from listeners limited to namespaces.
+func (v *Visibility) checkTarget(cluster string, target Target) error {
+	if v == nil || target.Node == "" {
+		return v.check(cluster, target.Namespace)
+	}
+
+	if !matchesAny(v.Clusters, cluster) {
+		return fmt.Errorf("cluster %s: %w", cluster, ErrNotVisible)
+	}
+
+	if len(v.Namespaces) > 0 {
+		return fmt.Errorf("node %s.%s: %w", target.Node, cluster, ErrNotVisible)
+	}
+
+	return nil
+}
+
+// matchesAny reports whether name matches one of patterns, or patterns is
+// empty.
+func matchesAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesAddr reports whether addr, or its host without the port, matches
+// one of patterns, or patterns is empty.
+func matchesAddr(patterns []string, addr string) bool {
+	if matchesAny(patterns, addr) {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+
+	return err == nil && matchesAny(patterns, host)
+}
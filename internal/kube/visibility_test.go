@@ -0,0 +1,92 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVisibilityCheck(t *testing.T) {
+	v := &Visibility{Clusters: []string{"production"}, Namespaces: []string{"db", "team-*"}}
+
+	tests := []struct {
+		cluster, namespace string
+		visible            bool
+	}{
+		{"production", "db", true},
+		{"production", "team-a", true},
+		{"production", "kube-system", false},
+		{"staging", "db", false},
+	}
+
+	for _, tt := range tests {
+		err := v.check(tt.cluster, tt.namespace)
+		if visible := err == nil; visible != tt.visible {
+			t.Errorf("check(%q, %q) = %v, want visible %v", tt.cluster, tt.namespace, err, tt.visible)
+		}
+
+		if err != nil && !errors.Is(err, ErrNotVisible) {
+			t.Errorf("check(%q, %q) = %v, want ErrNotVisible", tt.cluster, tt.namespace, err)
+		}
+	}
+
+	if err := (*Visibility)(nil).check("staging", "kube-system"); err != nil {
+		t.Errorf("nil Visibility: check() = %v, want nil", err)
+	}
+}
+
+func TestVisibilityCheckNode(t *testing.T) {
+	node := Target{Cluster: "production", Node: "worker-1", Port: 9100}
+
+	if err := (&Visibility{Clusters: []string{"production"}}).checkTarget("production", node); err != nil {
+		t.Errorf("checkTarget() = %v without namespace limits, want nil", err)
+	}
+
+	// a namespace pattern matching everything still limits the listener to
+	// namespaced targets.
+	for _, v := range []*Visibility{{Namespaces: []string{"db"}}, {Namespaces: []string{"*"}}, {Clusters: []string{"staging"}}} {
+		if err := v.checkTarget("production", node); !errors.Is(err, ErrNotVisible) {
+			t.Errorf("%+v: checkTarget() = %v, want ErrNotVisible", v, err)
+		}
+	}
+}
+
+func TestClusterDialerVisibility(t *testing.T) {
+	dials := 0
+	newForwarder := func(name string) *PortForwarder {
+		return &PortForwarder{
+			Name:             name,
+			DefaultNamespace: "default",
+			dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+				dials++
+				return &StreamConn{errDone: make(chan struct{})}, nil
+			},
+		}
+	}
+
+	dialer := &ClusterDialer{
+		Forwarders: map[string]*PortForwarder{"production": newForwarder("production"), "staging": newForwarder("staging")},
+		Visibility: &Visibility{Clusters: []string{"staging"}, Namespaces: []string{"db", "default"}},
+	}
+
+	for addr, visible := range map[string]bool{
+		"postgres-0.postgres.db.staging:5432":    true,
+		"web-0.web.default.staging:80":           true,
+		"postgres-0.postgres.db.production:5432": false,
+		"etcd-0.etcd.kube-system.staging:2379":   false,
+		"node-worker-1.nodes.staging:10250":      false,
+	} {
+		_, err := dialer.DialContext(context.Background(), "tcp", addr)
+		if visible && err != nil {
+			t.Errorf("DialContext(%q) error: %v", addr, err)
+		}
+
+		if !visible && !errors.Is(err, ErrNotVisible) {
+			t.Errorf("DialContext(%q) = %v, want ErrNotVisible", addr, err)
+		}
+	}
+
+	if dials != 2 {
+		t.Errorf("dials = %d, want 2 (hidden targets must not be dialed)", dials)
+	}
+}
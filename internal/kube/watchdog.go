@@ -0,0 +1,242 @@
+package kube
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// maxHealthClasses is how many error classes of the last failed attempts an
+// UnhealthyTarget keeps.
+const maxHealthClasses = 5
+
+// UnhealthyTarget is a target whose last UnhealthyAfter or more attempts to
+// connect all failed.
+type UnhealthyTarget struct {
+	Cluster   string
+	Namespace string
+	// Target is the Service, pod, workload or selector dialed, e.g.
+	// service/redis or pod/mongo-0.
+	Target string
+	// Failures counts the failed attempts since Since.
+	Failures  int
+	Since     time.Time
+	LastError string
+	// Classes are the error classes of the last failed attempts, oldest
+	// first: a retry class such as connectionRefused, a kubelet error kind
+	// such as portNotListening, or other.
+	Classes []string
+	// Endpoints are the pods of a Service target's EndpointSlices when it
+	// turned unhealthy.
+	Endpoints []EndpointState
+}
+
+// EndpointState is a pod in a Service's EndpointSlices.
+type EndpointState struct {
+	Pod         string
+	Ready       bool
+	Terminating bool
+}
+
+// targetHealth tracks the consecutive failed attempts to connect per
+// target.
+type targetHealth struct {
+	mu      sync.Mutex
+	targets map[string]*UnhealthyTarget
+}
+
+// targetName returns the name failures of target are tracked under.
+func targetName(target Target) string {
+	switch {
+	case target.Selector != "":
+		return "selector/" + target.Selector
+	case target.Workload.Kind != "":
+		return target.Workload.String()
+	case target.IsService:
+		return "service/" + target.ServiceName
+	case target.PodIP.IsValid():
+		return "pod/" + target.PodIP.String()
+	default:
+		return "pod/" + target.PodName
+	}
+}
+
+// errorClass returns the class of a failed connection's error.
+func errorClass(err error) string {
+	return cmp.Or(RemoteErrorKind(err), retryClass(err), "other")
+}
+
+// connectFailed counts a failed attempt to connect to target and reports
+// whether the target is unhealthy. When the target reaches UnhealthyAfter
+// failures in a row, a single warning with the error classes and, for
+// Services, the EndpointSlices read with clientset is logged.
+func (k *PortForwarder) connectFailed(clientset kubernetes.Interface, target Target, name string, err error) bool {
+	if k.UnhealthyAfter <= 0 {
+		return false
+	}
+
+	key := target.Namespace + "/" + name
+
+	k.health.mu.Lock()
+
+	if k.health.targets == nil {
+		k.health.targets = make(map[string]*UnhealthyTarget)
+	}
+
+	t := k.health.targets[key]
+	if t == nil {
+		t = &UnhealthyTarget{Cluster: k.Name, Namespace: target.Namespace, Target: name, Since: time.Now()}
+		k.health.targets[key] = t
+	}
+
+	t.Failures++
+	t.LastError = err.Error()
+	t.Classes = append(t.Classes, errorClass(err))
+
+	if len(t.Classes) > maxHealthClasses {
+		t.Classes = t.Classes[len(t.Classes)-maxHealthClasses:]
+	}
+
+	failures := t.Failures
+	k.health.mu.Unlock()
+
+	if failures != k.UnhealthyAfter {
+		return failures > k.UnhealthyAfter
+	}
+
+	var endpoints []EndpointState
+
+	if target.IsService {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		endpoints, err = serviceEndpoints(ctx, clientset, target.Namespace, target.ServiceName)
+		if err != nil && k.Logger != nil {
+			k.Logger.Warn("failed to read endpoints of unhealthy target", "namespace", target.Namespace, "target", name, "error", err)
+		}
+	}
+
+	k.health.mu.Lock()
+	t.Endpoints = endpoints
+	snapshot := *t
+	k.health.mu.Unlock()
+
+	if k.Logger != nil {
+		k.Logger.Warn("target unhealthy",
+			"namespace", snapshot.Namespace, "target", name, "failures", snapshot.Failures,
+			"since", snapshot.Since, "classes", snapshot.Classes, "error", snapshot.LastError,
+			"endpoints", endpointSummary(endpoints, target.IsService),
+		)
+	}
+
+	return true
+}
+
+// connectSucceeded ends the failure streak of a target, logging its
+// recovery if it was unhealthy.
+func (k *PortForwarder) connectSucceeded(namespace, name string) {
+	if k.UnhealthyAfter <= 0 {
+		return
+	}
+
+	key := namespace + "/" + name
+
+	k.health.mu.Lock()
+	t := k.health.targets[key]
+	delete(k.health.targets, key)
+	k.health.mu.Unlock()
+
+	if t != nil && t.Failures >= k.UnhealthyAfter && k.Logger != nil {
+		k.Logger.Info("target recovered", "namespace", namespace, "target", name, "failures", t.Failures, "down", time.Since(t.Since).Round(time.Second))
+	}
+}
+
+// Unhealthy returns the targets whose last UnhealthyAfter or more attempts
+// to connect failed, sorted by namespace and target.
+func (k *PortForwarder) Unhealthy() []UnhealthyTarget {
+	k.health.mu.Lock()
+	defer k.health.mu.Unlock()
+
+	var out []UnhealthyTarget
+
+	for _, t := range k.health.targets {
+		if k.UnhealthyAfter > 0 && t.Failures >= k.UnhealthyAfter {
+			u := *t
+			u.Classes = slices.Clone(t.Classes)
+			out = append(out, u)
+		}
+	}
+
+	slices.SortFunc(out, func(a, b UnhealthyTarget) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Target, b.Target))
+	})
+
+	return out
+}
+
+// serviceEndpoints lists the pods in the EndpointSlices of a Service, ready
+// or not, sorted by name.
+func serviceEndpoints(ctx context.Context, clientset kubernetes.Interface, namespace, service string) ([]EndpointState, error) {
+	list, err := clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + service,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing endpoint slices for service %s/%s: %w", namespace, service, err)
+	}
+
+	var out []EndpointState
+
+	for _, slice := range list.Items {
+		for _, ep := range slice.Endpoints {
+			if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+				continue
+			}
+
+			// dual-stack services list each pod in a slice per address family.
+			if slices.ContainsFunc(out, func(s EndpointState) bool { return s.Pod == ep.TargetRef.Name }) {
+				continue
+			}
+
+			out = append(out, EndpointState{
+				Pod:         ep.TargetRef.Name,
+				Ready:       ep.Conditions.Ready == nil || *ep.Conditions.Ready,
+				Terminating: ep.Conditions.Terminating != nil && *ep.Conditions.Terminating,
+			})
+		}
+	}
+
+	slices.SortFunc(out, func(a, b EndpointState) int { return cmp.Compare(a.Pod, b.Pod) })
+
+	return out, nil
+}
+
+// endpointSummary describes endpoints for the unhealthy warning, e.g.
+// "0 ready, 2 not ready, 1 terminating".
+func endpointSummary(endpoints []EndpointState, service bool) slog.Value {
+	if !service {
+		return slog.StringValue("n/a")
+	}
+
+	var ready, notReady, terminating int
+
+	for _, ep := range endpoints {
+		switch {
+		case ep.Terminating:
+			terminating++
+		case ep.Ready:
+			ready++
+		default:
+			notReady++
+		}
+	}
+
+	return slog.StringValue(fmt.Sprintf("%d ready, %d not ready, %d terminating", ready, notReady, terminating))
+}
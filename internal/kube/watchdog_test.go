@@ -0,0 +1,108 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDialTarget_LogsUnhealthyTargetOnce(t *testing.T) {
+	var logs bytes.Buffer
+
+	failing := true
+	target := Target{IsService: true, ServiceName: "redis", Namespace: "cache", Port: 6379}
+
+	fwd := &PortForwarder{
+		Name:           "production",
+		Clientset:      fake.NewClientset(endpointSlice("redis-a", "redis", map[string]bool{"redis-0": false})),
+		Logger:         slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		UnhealthyAfter: 3,
+		baseBackoff:    time.Millisecond,
+		resolveFunc: func(_ context.Context, _, _ string) ([]string, error) {
+			return []string{"redis-0"}, nil
+		},
+		targetPortFunc: func(_ context.Context, _, _, _ string, port int) (int, error) {
+			return port, nil
+		},
+		dialFunc: func(_, _ string, _ int) (*StreamConn, error) {
+			if failing {
+				return nil, fmt.Errorf("dial: %w", syscall.ECONNREFUSED)
+			}
+
+			return newTestStreamConn(), nil
+		},
+	}
+
+	if _, err := fwd.dialTarget(context.Background(), "redis.cache.production:6379", target); err == nil {
+		t.Fatal("expected error after exhausting retries")
+	}
+
+	out := logs.String()
+
+	// the retries before the target turned unhealthy warn, the rest don't.
+	if n := strings.Count(out, `level=WARN msg="retrying connection"`); n != 2 {
+		t.Errorf("retry warnings = %d, want 2:\n%s", n, out)
+	}
+
+	if n := strings.Count(out, `msg="target unhealthy"`); n != 1 {
+		t.Errorf("unhealthy warnings = %d, want 1:\n%s", n, out)
+	}
+
+	if strings.Contains(out, `level=ERROR msg="failed to connect"`) {
+		t.Errorf("failure of an unhealthy target logged as error:\n%s", out)
+	}
+
+	unhealthy := fwd.Unhealthy()
+	if len(unhealthy) != 1 {
+		t.Fatalf("Unhealthy() = %+v, want one target", unhealthy)
+	}
+
+	u := unhealthy[0]
+	if u.Target != "service/redis" || u.Failures != dialMaxAttempts || u.Classes[0] != RetryConnectionRefused {
+		t.Errorf("Unhealthy() = %+v", u)
+	}
+
+	if len(u.Endpoints) != 1 || u.Endpoints[0].Pod != "redis-0" || u.Endpoints[0].Ready {
+		t.Errorf("Endpoints = %+v, want redis-0 not ready", u.Endpoints)
+	}
+
+	failing = false
+
+	conn, err := fwd.dialTarget(context.Background(), "redis.cache.production:6379", target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	if !strings.Contains(logs.String(), `msg="target recovered"`) {
+		t.Errorf("recovery not logged:\n%s", logs.String())
+	}
+
+	if unhealthy := fwd.Unhealthy(); len(unhealthy) != 0 {
+		t.Errorf("Unhealthy() after recovery = %+v", unhealthy)
+	}
+}
+
+func TestTargetName(t *testing.T) {
+	tests := []struct {
+		target Target
+		want   string
+	}{
+		{Target{IsService: true, ServiceName: "redis"}, "service/redis"},
+		{Target{PodName: "mongo-0"}, "pod/mongo-0"},
+		{Target{Selector: "app=api"}, "selector/app=api"},
+	}
+
+	for _, tt := range tests {
+		if got := targetName(tt.target); got != tt.want {
+			t.Errorf("targetName(%+v) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	streamspdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	portforwardconst "k8s.io/apimachinery/pkg/util/portforward"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/websocket"
+)
+
+// dialWebSocket opens a port-forward connection tunneling SPDY over a
+// WebSocket, as kubectl does since Kubernetes 1.31. ctx cancels connecting
+// to the API server and the TLS handshake. A non-zero pingPeriod replaces
+// the default interval of SPDY pings.
+func dialWebSocket(ctx context.Context, restCfg *rest.Config, namespace, pod string, pingPeriod time.Duration) (httpstream.Connection, error) {
+	reqURL, err := portForwardURL(restCfg, namespace, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, holder, err := websocket.RoundTripperFor(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating WebSocket round tripper: %w", err)
+	}
+
+	// WebSockets require GET (RFC 6455 section 4.1).
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating port-forward request: %w", err)
+	}
+
+	wsConn, err := websocket.Negotiate(transport, holder, req, portforwardconst.WebsocketsSPDYTunnelingPrefix+portForwardProtocolV1)
+	if err != nil {
+		return nil, fmt.Errorf("WebSocket dial to %s/%s: %w", namespace, pod, err)
+	}
+
+	if pingPeriod <= 0 {
+		pingPeriod = portforward.PingPeriod
+	}
+
+	conn, err := streamspdy.NewClientConnectionWithPings(portforward.NewTunnelingConnection("client", wsConn), pingPeriod)
+	if err != nil {
+		wsConn.Close()
+		return nil, fmt.Errorf("WebSocket dial to %s/%s: %w", namespace, pod, err)
+	}
+
+	return conn, nil
+}
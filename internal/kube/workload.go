@@ -0,0 +1,177 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Workload kinds a target can name instead of a Service.
+const (
+	WorkloadDeployment  = "deployment"
+	WorkloadStatefulSet = "statefulset"
+)
+
+// ErrWorkloadNotFound means the Deployment or StatefulSet of a workload
+// target doesn't exist.
+var ErrWorkloadNotFound = errors.New("workload not found")
+
+// workloadKinds maps the kinds and short names accepted in addresses, as
+// in kubectl, to the workload kind.
+var workloadKinds = map[string]string{
+	"deployment":  WorkloadDeployment,
+	"deploy":      WorkloadDeployment,
+	"statefulset": WorkloadStatefulSet,
+	"sts":         WorkloadStatefulSet,
+}
+
+// Workload is a Deployment or StatefulSet whose selector picks the pod to
+// dial, for workloads without a Service.
+type Workload struct {
+	Kind string
+	Name string
+}
+
+func (w Workload) String() string {
+	return w.Kind + "/" + w.Name
+}
+
+// parseWorkload parses the explicit <kind>/<name> form of a workload, e.g.
+// deployment/myapp or sts/mongo.
+func parseWorkload(s string) (Workload, bool, error) {
+	kind, name, found := strings.Cut(s, "/")
+	if !found {
+		return Workload{}, false, nil
+	}
+
+	w := Workload{Kind: workloadKinds[kind], Name: name}
+	if w.Kind == "" || name == "" {
+		return Workload{}, true, fmt.Errorf("unsupported workload %q: expected deployment/<name> or statefulset/<name>", s)
+	}
+
+	return w, true, nil
+}
+
+// workloadPrefixes are the Service name prefixes that name a workload
+// instead, as in deploy-myapp.web.production.
+var workloadPrefixes = []struct {
+	prefix string
+	kind   string
+}{
+	{"deploy-", WorkloadDeployment},
+	{"sts-", WorkloadStatefulSet},
+}
+
+// workloadTarget returns the workload target for a service target whose
+// Service doesn't exist but whose name carries a workload prefix. A Service
+// of that name takes precedence, so it is only checked after resolving the
+// Service failed.
+func workloadTarget(target Target) (Target, bool) {
+	for _, p := range workloadPrefixes {
+		if name, ok := strings.CutPrefix(target.ServiceName, p.prefix); ok && name != "" {
+			return Target{
+				Cluster:   target.Cluster,
+				Workload:  Workload{Kind: p.kind, Name: name},
+				Namespace: target.Namespace,
+				Port:      target.Port,
+			}, true
+		}
+	}
+
+	return target, false
+}
+
+// WorkloadPods returns the names of the ready pods matching the selector of
+// a Deployment or StatefulSet, sorted by name, or an error if there are
+// none. Pods that are being deleted are left out.
+func WorkloadPods(ctx context.Context, clientset kubernetes.Interface, namespace string, w Workload) ([]string, error) {
+	// apply a default timeout when the caller hasn't set a deadline
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+
+	var (
+		selector *metav1.LabelSelector
+		err      error
+	)
+
+	switch w.Kind {
+	case WorkloadDeployment:
+		deploy, getErr := clientset.AppsV1().Deployments(namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			selector = deploy.Spec.Selector
+		}
+	case WorkloadStatefulSet:
+		sts, getErr := clientset.AppsV1().StatefulSets(namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			selector = sts.Spec.Selector
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported workload kind %q", ErrInvalidTarget, w.Kind)
+	}
+
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s %s/%s", ErrWorkloadNotFound, w.Kind, namespace, w.Name)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("getting %s %s/%s: %w", w.Kind, namespace, w.Name, err)
+	}
+
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of %s %s/%s: %w", w.Kind, namespace, w.Name, err)
+	}
+
+	return readyPods(ctx, clientset, namespace, sel, fmt.Sprintf("%s %s/%s", w.Kind, namespace, w.Name))
+}
+
+// readyPods returns the names of the ready pods of namespace matching sel,
+// sorted by name, or an error naming what selected them if there are none.
+// Pods that are being deleted are left out.
+func readyPods(ctx context.Context, clientset kubernetes.Interface, namespace string, sel labels.Selector, what string) ([]string, error) {
+	list, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return nil, fmt.Errorf("listing pods of %s: %w", what, err)
+	}
+
+	var pods []string
+
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if pod.DeletionTimestamp == nil && PodReady(pod) {
+			pods = append(pods, pod.Name)
+		}
+	}
+
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("%w found for %s", ErrNoReadyEndpoints, what)
+	}
+
+	slices.Sort(pods)
+
+	return pods, nil
+}
+
+// PodReady reports whether the Ready condition of pod is true.
+func PodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
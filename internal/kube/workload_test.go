@@ -0,0 +1,128 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseTargetWorkload(t *testing.T) {
+	tests := []struct {
+		addr string
+		want Target
+	}{
+		{"deployment/web.shop.production:8080", Target{Cluster: "production", Workload: Workload{Kind: WorkloadDeployment, Name: "web"}, Namespace: "shop", Port: 8080}},
+		{"deploy/web.production:8080", Target{Cluster: "production", Workload: Workload{Kind: WorkloadDeployment, Name: "web"}, Port: 8080}},
+		{"sts/mongo.db.production:27017", Target{Cluster: "production", Workload: Workload{Kind: WorkloadStatefulSet, Name: "mongo"}, Namespace: "db", Port: 27017}},
+	}
+
+	for _, tt := range tests {
+		if got, err := ParseTarget(tt.addr); err != nil || got != tt.want {
+			t.Errorf("ParseTarget(%q) = %+v, %v, want %+v", tt.addr, got, err, tt.want)
+		}
+	}
+
+	got, err := ParsePinnedTarget("statefulset/mongo.db:27017", "production")
+	want := Target{Cluster: "production", Workload: Workload{Kind: WorkloadStatefulSet, Name: "mongo"}, Namespace: "db", Port: 27017}
+
+	if err != nil || got != want {
+		t.Errorf("ParsePinnedTarget() = %+v, %v, want %+v", got, err, want)
+	}
+}
+
+func workloadFixture() *fake.Clientset {
+	pod := func(name string, ready, deleted bool) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", Labels: map[string]string{"app": "web"}},
+		}
+
+		if ready {
+			p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		}
+
+		if deleted {
+			p.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		}
+
+		return p
+	}
+
+	return fake.NewClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "queue", Namespace: "shop"},
+			Spec:       appsv1.StatefulSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "queue"}}},
+		},
+		pod("web-b", true, false),
+		pod("web-a", true, false),
+		pod("web-c", false, false),
+		pod("web-d", true, true),
+	)
+}
+
+func TestWorkloadPods(t *testing.T) {
+	clientset := workloadFixture()
+
+	pods, err := WorkloadPods(context.Background(), clientset, "shop", Workload{Kind: WorkloadDeployment, Name: "web"})
+	if err != nil {
+		t.Fatalf("WorkloadPods() error: %v", err)
+	}
+
+	if want := []string{"web-a", "web-b"}; !slices.Equal(pods, want) {
+		t.Errorf("WorkloadPods() = %v, want %v", pods, want)
+	}
+
+	if _, err := WorkloadPods(context.Background(), clientset, "shop", Workload{Kind: WorkloadStatefulSet, Name: "queue"}); !errors.Is(err, ErrNoReadyEndpoints) {
+		t.Errorf("WorkloadPods(queue) error = %v, want ErrNoReadyEndpoints", err)
+	}
+
+	if _, err := WorkloadPods(context.Background(), clientset, "shop", Workload{Kind: WorkloadDeployment, Name: "missing"}); !errors.Is(err, ErrWorkloadNotFound) {
+		t.Errorf("WorkloadPods(missing) error = %v, want ErrWorkloadNotFound", err)
+	}
+}
+
+func TestDialTargetWorkloadPrefix(t *testing.T) {
+	var dialed []string
+
+	fwd := &PortForwarder{
+		Name:      "production",
+		Clientset: workloadFixture(),
+		resolveFunc: func(_ context.Context, ns, svc string) ([]string, error) {
+			return nil, fmt.Errorf("%w: %s/%s has no endpoint slices", ErrServiceNotFound, ns, svc)
+		},
+		dialFunc: func(_, pod string, _ int) (*StreamConn, error) {
+			dialed = append(dialed, pod)
+			return newTestStreamConn(), nil
+		},
+	}
+
+	// no Service deploy-web exists, so the prefix names the Deployment web.
+	target, _ := ParseTarget("deploy-web.shop.production:8080")
+
+	conn, err := fwd.dialTarget(context.Background(), "deploy-web.shop.production:8080", target)
+	if err != nil {
+		t.Fatalf("dialTarget: %v", err)
+	}
+	conn.Close()
+
+	if len(dialed) != 1 || (dialed[0] != "web-a" && dialed[0] != "web-b") {
+		t.Errorf("dialed %v, want a ready pod of the deployment", dialed)
+	}
+
+	target, _ = ParseTarget("deploy-api.shop.production:8080")
+
+	if _, err := fwd.dialTarget(context.Background(), "deploy-api.shop.production:8080", target); !errors.Is(err, ErrWorkloadNotFound) {
+		t.Errorf("dialTarget(deploy-api) error = %v, want ErrWorkloadNotFound", err)
+	}
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Registry holds all podproxy metrics plus the Go runtime and process
+// collectors. It is used for both scraping and Pushgateway pushes.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// ConnectionsTotal counts cluster connection attempts by outcome.
+	ConnectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "connections_total",
+		Help:      "Cluster connections by cluster and outcome (ok, error, denied).",
+	}, []string{"cluster", "outcome"})
+
+	// ConnectionsActive tracks currently open cluster connections.
+	ConnectionsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "podproxy",
+		Name:      "connections_active",
+		Help:      "Currently open cluster connections.",
+	}, []string{"cluster"})
+
+	// BytesTotal counts bytes transferred through closed cluster connections.
+	BytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "bytes_total",
+		Help:      "Bytes transferred through cluster connections by direction (rx, tx).",
+	}, []string{"cluster", "direction"})
+
+	// NamespaceBytesTotal counts bytes transferred through closed cluster
+	// connections by namespace, to attribute port-forward traffic to teams.
+	NamespaceBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "namespace_bytes_total",
+		Help:      "Bytes transferred through cluster connections by namespace and direction (rx, tx).",
+	}, []string{"cluster", "namespace", "direction"})
+
+	// DialDuration observes the time to establish a cluster connection,
+	// including service resolution and retries.
+	DialDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "podproxy",
+		Name:      "dial_duration_seconds",
+		Help:      "Time to establish cluster connections, including retries.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"cluster"})
+
+	// DialRetriesTotal counts retried dial and resolution attempts.
+	DialRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "dial_retries_total",
+		Help:      "Retried dial and service resolution attempts.",
+	}, []string{"cluster"})
+
+	// ClientConnectionsActive tracks open client connections of the proxy
+	// listeners, ClientConnectionsLimit the limit on them.
+	ClientConnectionsActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "podproxy",
+		Name:      "client_connections_active",
+		Help:      "Currently open client connections of the SOCKS5 and HTTP proxy listeners.",
+	})
+
+	ClientConnectionsLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "podproxy",
+		Name:      "client_connections_limit",
+		Help:      "Limit on open client connections, 0 when unlimited.",
+	})
+
+	// ClientConnectionsPending tracks accepted client connections waiting
+	// for a slot under the queue policy.
+	ClientConnectionsPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "podproxy",
+		Name:      "client_connections_pending",
+		Help:      "Accepted client connections waiting for a free slot at the connection limit.",
+	})
+
+	// ClientConnectionsRejected counts client connections turned away at the
+	// connection limit.
+	ClientConnectionsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "client_connections_rejected_total",
+		Help:      "Client connections rejected at the connection limit by reason (limit, queueTimeout).",
+	}, []string{"reason"})
+
+	// ClientConnectionsShed counts idle client connections closed to make
+	// room at the connection limit.
+	ClientConnectionsShed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "client_connections_shed_total",
+		Help:      "Idle client connections closed to make room at the connection limit.",
+	})
+
+	// RemoteErrorsTotal counts port-forward errors reported by the kubelet,
+	// classified by kind.
+	RemoteErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "remote_errors_total",
+		Help:      "Port-forward errors reported by the kubelet by kind (portNotListening, podNotFound, containerNotRunning, other).",
+	}, []string{"cluster", "kind"})
+
+	// LeakedConnectionsTotal counts cluster connections closed because they
+	// were left open after their tunnel or client went away.
+	LeakedConnectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "leaked_connections_total",
+		Help:      "Leaked cluster connections closed by the reaper, by cause (tunnel, client).",
+	}, []string{"cluster", "cause"})
+
+	// CircuitBreakerTripsTotal counts the circuit breakers of targets that
+	// opened after their connections kept failing.
+	CircuitBreakerTripsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "circuit_breaker_trips_total",
+		Help:      "Circuit breakers of targets opened after repeated connection failures.",
+	}, []string{"cluster"})
+
+	// CircuitBreakerRejectedTotal counts connections failed fast by an open
+	// circuit breaker.
+	CircuitBreakerRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "circuit_breaker_rejected_total",
+		Help:      "Connections failed fast by an open circuit breaker, without dialing.",
+	}, []string{"cluster"})
+
+	// ClusterReachable is 1 for clusters whose API server answered the last
+	// health check and 0 for those it failed for.
+	ClusterReachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "podproxy",
+		Name:      "cluster_reachable",
+		Help:      "Whether the cluster's API server answered the last health check.",
+	}, []string{"cluster"})
+
+	// PassthroughConnectionsTotal counts connections to addresses outside
+	// the clusters by the egress label of their passthrough route.
+	PassthroughConnectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "passthrough_connections_total",
+		Help:      "Passthrough connections by egress label and outcome (ok, error).",
+	}, []string{"egress", "outcome"})
+
+	// PassthroughBytesTotal counts bytes transferred through closed
+	// passthrough connections.
+	PassthroughBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "passthrough_bytes_total",
+		Help:      "Bytes transferred through passthrough connections by egress label and direction (rx, tx).",
+	}, []string{"egress", "direction"})
+
+	// RateLimitedTotal counts proxy requests rejected because their client
+	// opened connections faster than the configured limit.
+	RateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "podproxy",
+		Name:      "rate_limited_total",
+		Help:      "Proxy requests rejected by the per-client connection rate limit, by listener (socks, http).",
+	}, []string{"listener"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ConnectionsTotal,
+		ConnectionsActive,
+		BytesTotal,
+		NamespaceBytesTotal,
+		DialDuration,
+		DialRetriesTotal,
+		RemoteErrorsTotal,
+		LeakedConnectionsTotal,
+		CircuitBreakerTripsTotal,
+		CircuitBreakerRejectedTotal,
+		ClusterReachable,
+		RateLimitedTotal,
+		PassthroughConnectionsTotal,
+		PassthroughBytesTotal,
+		ClientConnectionsActive,
+		ClientConnectionsLimit,
+		ClientConnectionsPending,
+		ClientConnectionsRejected,
+		ClientConnectionsShed,
+	)
+}
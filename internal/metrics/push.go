@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Pusher periodically pushes the Registry to a Prometheus Pushgateway, for
+// instances that cannot be scraped.
+type Pusher struct {
+	URL      string
+	Job      string
+	Interval time.Duration
+	Logger   *slog.Logger
+}
+
+// Run pushes on every interval until ctx is cancelled, then pushes a final
+// time so the gateway holds the values at shutdown.
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			finalCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			p.push(finalCtx)
+			cancel()
+
+			return
+		case <-ticker.C:
+			p.push(ctx)
+		}
+	}
+}
+
+func (p *Pusher) push(ctx context.Context) {
+	pusher := push.New(p.URL, p.Job).Gatherer(Registry)
+
+	if host, err := os.Hostname(); err == nil {
+		pusher = pusher.Grouping("instance", host)
+	}
+
+	if err := pusher.PushContext(ctx); err != nil {
+		p.Logger.Warn("pushing metrics failed", "url", p.URL, "error", err)
+	}
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPusherPushesOnIntervalAndShutdown(t *testing.T) {
+	var pushes atomic.Int32
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || !strings.HasPrefix(r.URL.Path, "/metrics/job/podproxy") {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		pushes.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	pusher := &Pusher{
+		URL:      gateway.URL,
+		Job:      "podproxy",
+		Interval: 10 * time.Millisecond,
+		Logger:   slog.New(slog.DiscardHandler),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		pusher.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pushes.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	before := pushes.Load()
+	if before < 3 {
+		t.Errorf("pushes = %d, want at least 2 interval pushes plus the final push", before)
+	}
+}
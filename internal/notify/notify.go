@@ -0,0 +1,9 @@
+// Package notify shows desktop notifications, e.g. to ask the user to log in
+// to a cluster again. Linux desktops (notify-send), macOS (osascript) and
+// Windows (toast notifications through PowerShell) are supported.
+package notify
+
+// Send shows a desktop notification with title and body.
+func Send(title, body string) error {
+	return send(title, body)
+}
@@ -0,0 +1,26 @@
+//go:build darwin
+
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// run executes a notification tool. overridden in tests.
+var run = func(name string, args ...string) error {
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, out)
+	}
+
+	return nil
+}
+
+func send(title, body string) error {
+	// strconv.Quote escapes quotes and backslashes the way AppleScript
+	// string literals expect.
+	script := "display notification " + strconv.Quote(body) + " with title " + strconv.Quote(title)
+
+	return run("osascript", "-e", script)
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// run executes a notification tool. overridden in tests.
+var run = func(name string, args ...string) error {
+	if _, err := exec.Command(name, args...).Output(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+func send(title, body string) error {
+	return run("notify-send", "--app-name=podproxy", "--", title, body)
+}
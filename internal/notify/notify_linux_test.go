@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSend(t *testing.T) {
+	var got []string
+
+	origRun := run
+
+	t.Cleanup(func() { run = origRun })
+
+	run = func(name string, args ...string) error {
+		got = append([]string{name}, args...)
+		return nil
+	}
+
+	if err := Send("podproxy", "-log in to prod"); err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	want := []string{"notify-send", "--app-name=podproxy", "--", "podproxy", "-log in to prod"}
+	if !slices.Equal(got, want) {
+		t.Errorf("command = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !windows
+
+package notify
+
+import (
+	"errors"
+	"fmt"
+)
+
+func send(_, _ string) error {
+	return fmt.Errorf("desktop notifications: %w", errors.ErrUnsupported)
+}
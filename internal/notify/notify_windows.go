@@ -0,0 +1,56 @@
+//go:build windows
+
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// run executes a notification tool. overridden in tests.
+var run = func(name string, args ...string) error {
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// toastScript shows a toast notification under the AppUserModelID of
+// PowerShell, since toasts of unregistered applications are dropped.
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode(%s)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode(%s)) > $null
+$app = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($app).Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+
+func send(title, body string) error {
+	script := fmt.Sprintf(toastScript, quote(title), quote(body))
+
+	return run("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script)
+}
+
+// quote returns s as a verbatim PowerShell string literal, which only
+// escapes quotes by doubling them; PowerShell also treats the typographic
+// single quotes as quotes.
+func quote(s string) string {
+	var b strings.Builder
+
+	b.WriteByte('\'')
+
+	for _, r := range s {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			b.WriteRune(r)
+		}
+
+		b.WriteRune(r)
+	}
+
+	b.WriteByte('\'')
+
+	return b.String()
+}
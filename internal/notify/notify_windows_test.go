@@ -0,0 +1,19 @@
+package notify
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"login required", "'login required'"},
+		{"it's $env:USERNAME", "'it''s $env:USERNAME'"},
+		{"’; Remove-Item", "'’’; Remove-Item'"},
+	}
+
+	for _, tt := range tests {
+		if got := quote(tt.in); got != tt.want {
+			t.Errorf("quote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
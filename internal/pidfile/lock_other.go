@@ -0,0 +1,34 @@
+//go:build !unix && !windows
+
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var errWouldBlock = errors.New("pid file locked")
+
+// lockFile fails: without file locks the PID file can't tell a running
+// instance from a stale file, so start, stop and status couldn't work.
+func lockFile(_ *os.File) error {
+	return fmt.Errorf("pid files are not supported on this platform: %w", errors.ErrUnsupported)
+}
+
+func release(f *os.File, path string) error {
+	return errors.Join(os.Remove(path), f.Close())
+}
+
+func stopRequests() (<-chan struct{}, error) {
+	return nil, nil
+}
+
+func terminate(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	return p.Kill()
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package pidfile
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var errWouldBlock = syscall.EWOULDBLOCK
+
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// release removes path before closing f, so a concurrently starting
+// instance never locks a file that is about to disappear.
+func release(f *os.File, path string) error {
+	removeErr := os.Remove(path)
+	closeErr := f.Close()
+
+	return errors.Join(removeErr, closeErr)
+}
+
+// stopRequests returns nil: Stop sends SIGTERM, which the process handles
+// like any other.
+func stopRequests() (<-chan struct{}, error) {
+	return nil, nil
+}
+
+func terminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
@@ -0,0 +1,82 @@
+//go:build windows
+
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var errWouldBlock = windows.ERROR_LOCK_VIOLATION
+
+// lockFile locks a byte far past the end of f. Windows locks are mandatory,
+// so locking the PID itself would keep other processes from reading it.
+func lockFile(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: 0x7fffffff}
+
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+}
+
+// release closes f before removing path, as Windows doesn't remove open
+// files.
+func release(f *os.File, path string) error {
+	closeErr := f.Close()
+	removeErr := os.Remove(path)
+
+	return errors.Join(removeErr, closeErr)
+}
+
+// stopEventName names the event the process with pid waits on for Stop.
+func stopEventName(pid int) string {
+	return fmt.Sprintf(`Local\podproxy-stop-%d`, pid)
+}
+
+// stopRequests returns a channel closed when Stop signals the event of the
+// current process. Windows has no signal another process can send to ask
+// for a graceful shutdown.
+func stopRequests() (<-chan struct{}, error) {
+	name, err := windows.UTF16PtrFromString(stopEventName(os.Getpid()))
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := windows.CreateEvent(nil, 1, 0, name)
+	if err != nil {
+		return nil, fmt.Errorf("creating stop event: %w", err)
+	}
+
+	stop := make(chan struct{})
+
+	// the event lives as long as the process.
+	go func() {
+		if _, err := windows.WaitForSingleObject(event, windows.INFINITE); err == nil {
+			close(stop)
+		}
+	}()
+
+	return stop, nil
+}
+
+// terminate signals the stop event of pid, or kills it if it has none.
+func terminate(pid int) error {
+	name, err := windows.UTF16PtrFromString(stopEventName(pid))
+	if err != nil {
+		return err
+	}
+
+	event, err := windows.OpenEvent(windows.EVENT_MODIFY_STATE, false, name)
+	if err != nil {
+		p, err := os.FindProcess(pid)
+		if err != nil {
+			return err
+		}
+
+		return p.Kill()
+	}
+	defer windows.CloseHandle(event)
+
+	return windows.SetEvent(event)
+}
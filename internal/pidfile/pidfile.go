@@ -0,0 +1,208 @@
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockedError is returned by Acquire when another process holds the lock.
+type LockedError struct {
+	Path string
+	// PID is the process recorded in the file, or 0 if it could not be read.
+	PID int
+}
+
+func (e *LockedError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("another instance is running (pid %d, lock %s)", e.PID, e.Path)
+	}
+
+	return "another instance is running (lock " + e.Path + ")"
+}
+
+// File is an exclusively locked PID file. The lock is held by the open file
+// descriptor, so it is released by the OS if the process dies.
+type File struct {
+	path string
+	f    *os.File
+	stop <-chan struct{}
+}
+
+// Acquire creates the PID file at path, takes an exclusive lock on it and
+// writes the current process ID. It fails with *LockedError when another
+// process holds the lock.
+func Acquire(path string) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating pid file directory: %w", err)
+	}
+
+	f, err := openLocked(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing pid file: %w", err)
+	}
+
+	stop, err := stopRequests()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing pid file: %w", err)
+	}
+
+	return &File{path: path, f: f, stop: stop}, nil
+}
+
+// openLocked opens and locks the file at path. If the previous holder removed
+// the file between our open and lock, the now-unlinked file is discarded and
+// the open is retried.
+func openLocked(path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening pid file: %w", err)
+		}
+
+		if err := lockFile(f); err != nil {
+			f.Close()
+
+			if errors.Is(err, errWouldBlock) {
+				pid, _ := ReadPID(path)
+				return nil, &LockedError{Path: path, PID: pid}
+			}
+
+			return nil, fmt.Errorf("locking pid file: %w", err)
+		}
+
+		opened, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("locking pid file: %w", err)
+		}
+
+		current, err := os.Stat(path)
+		if err == nil && os.SameFile(opened, current) {
+			return f, nil
+		}
+
+		f.Close()
+	}
+}
+
+// Takeover acquires the PID file like Acquire, but if another process holds
+// it, stops that process first (see Stop).
+func Takeover(path string, timeout time.Duration) (*File, error) {
+	pf, err := Acquire(path)
+
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		return pf, err
+	}
+
+	if err := Stop(path, timeout); err != nil && !errors.Is(err, ErrNotRunning) {
+		return nil, err
+	}
+
+	return Acquire(path)
+}
+
+// ErrNotRunning is returned by Stop when no process holds the PID file.
+var ErrNotRunning = errors.New("not running")
+
+// Running returns the PID of the process holding the lock on the PID file at
+// path. ok is false when the file is missing or not locked, e.g. left behind
+// by a crashed process.
+func Running(path string) (pid int, ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+
+		return 0, false, fmt.Errorf("opening pid file: %w", err)
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		if !errors.Is(err, errWouldBlock) {
+			return 0, false, fmt.Errorf("locking pid file: %w", err)
+		}
+
+		pid, err := ReadPID(path)
+		if err != nil {
+			return 0, false, err
+		}
+
+		return pid, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// Stop asks the process holding the PID file at path to terminate and waits
+// up to timeout for it to release the lock.
+func Stop(path string, timeout time.Duration) error {
+	pid, ok, err := Running(path)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrNotRunning
+	}
+
+	if err := terminate(pid); err != nil {
+		return fmt.Errorf("stopping pid %d: %w", pid, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+
+		if _, ok, err := Running(path); err != nil || !ok {
+			return err
+		}
+	}
+
+	return fmt.Errorf("pid %d did not exit within %s", pid, timeout)
+}
+
+// Release removes the PID file and releases the lock.
+func (p *File) Release() error {
+	return release(p.f, p.path)
+}
+
+// StopRequested returns a channel that is closed when Stop asks the process
+// to terminate without a signal, as on Windows. It is nil where Stop sends
+// SIGTERM.
+func (p *File) StopRequested() <-chan struct{} {
+	return p.stop
+}
+
+// ReadPID returns the process ID recorded in the PID file at path.
+func ReadPID(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid file %s", path)
+	}
+
+	return pid, nil
+}
@@ -0,0 +1,131 @@
+package pidfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireWritesPID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "podproxy.pid")
+
+	pf, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	pid, err := ReadPID(path)
+	if err != nil {
+		t.Fatalf("ReadPID: %v", err)
+	}
+
+	if pid != os.Getpid() {
+		t.Errorf("pid = %d, want %d", pid, os.Getpid())
+	}
+
+	if err := pf.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("pid file still exists after Release: %v", err)
+	}
+}
+
+func TestAcquireLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "podproxy.pid")
+
+	pf, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	_, err = Acquire(path)
+
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("second Acquire error = %v, want *LockedError", err)
+	}
+
+	if locked.PID != os.Getpid() {
+		t.Errorf("LockedError.PID = %d, want %d", locked.PID, os.Getpid())
+	}
+
+	if err := pf.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	pf, err = Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+
+	_ = pf.Release()
+}
+
+func TestAcquireStaleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "podproxy.pid")
+
+	// a PID file left behind by a crashed process is not locked.
+	if err := os.WriteFile(path, []byte("999999\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pf, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer pf.Release()
+
+	pid, err := ReadPID(path)
+	if err != nil {
+		t.Fatalf("ReadPID: %v", err)
+	}
+
+	if pid != os.Getpid() {
+		t.Errorf("pid = %d, want %d", pid, os.Getpid())
+	}
+}
+
+func TestRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "podproxy.pid")
+
+	if _, ok, err := Running(path); err != nil || ok {
+		t.Fatalf("Running on missing file = %v, %v; want false, nil", ok, err)
+	}
+
+	pf, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	pid, ok, err := Running(path)
+	if err != nil || !ok {
+		t.Fatalf("Running = %v, %v; want true, nil", ok, err)
+	}
+
+	if pid != os.Getpid() {
+		t.Errorf("pid = %d, want %d", pid, os.Getpid())
+	}
+
+	// Running must not steal the lock from the holder.
+	if _, err := Acquire(path); err == nil {
+		t.Error("Acquire succeeded while the lock is held")
+	}
+
+	_ = pf.Release()
+
+	if err := os.WriteFile(path, []byte("999999\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := Running(path); err != nil || ok {
+		t.Errorf("Running on stale file = %v, %v; want false, nil", ok, err)
+	}
+
+	if err := Stop(path, time.Second); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Stop on stale file = %v, want ErrNotRunning", err)
+	}
+}
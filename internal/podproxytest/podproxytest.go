@@ -0,0 +1,261 @@
+// Package podproxytest provides an in-memory Kubernetes API fake that speaks
+// the pods/portforward SPDY protocol, so the dial path can be exercised end to
+// end without a real cluster.
+package podproxytest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/entwico/podproxy/internal/kube"
+)
+
+// Handler serves a single forwarded connection. The stream is closed after
+// the handler returns.
+type Handler func(stream io.ReadWriter)
+
+// EchoHandler writes everything it reads back to the client.
+func EchoHandler(stream io.ReadWriter) {
+	_, _ = io.Copy(stream, stream)
+}
+
+// Server is a fake Kubernetes API server that handles pods/portforward
+// requests via SPDY and dispatches each forwarded port to a registered Handler.
+// Other API resources are served by the fake clientset returned by Clientset.
+type Server struct {
+	t         testing.TB
+	server    *httptest.Server
+	clientset *fake.Clientset
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	dials    map[string]int
+}
+
+// NewServer starts a fake API server that is shut down when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		t:         t,
+		clientset: fake.NewClientset(),
+		handlers:  make(map[string]Handler),
+		dials:     make(map[string]int),
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// Config returns a rest config pointing at the fake server.
+func (s *Server) Config() *rest.Config {
+	return &rest.Config{Host: s.server.URL}
+}
+
+// Clientset returns the fake clientset holding the server's API objects.
+func (s *Server) Clientset() *fake.Clientset {
+	return s.clientset
+}
+
+// Forwarder returns a PortForwarder wired to the fake server.
+func (s *Server) Forwarder(name string) *kube.PortForwarder {
+	return &kube.PortForwarder{
+		Name:             name,
+		Config:           s.Config(),
+		Clientset:        s.clientset,
+		DefaultNamespace: "default",
+		Logger:           slog.New(slog.DiscardHandler),
+	}
+}
+
+// HandlePod registers h to serve connections forwarded to port on pod.
+// Forwards to ports without a handler fail like a pod that isn't listening.
+func (s *Server) HandlePod(namespace, pod string, port int, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[podKey(namespace, pod, port)] = h
+}
+
+// AddPod creates a pod object in the fake clientset.
+func (s *Server) AddPod(namespace, name string, labels map[string]string) {
+	s.t.Helper()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+
+	if _, err := s.clientset.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		s.t.Fatalf("creating pod %s/%s: %v", namespace, name, err)
+	}
+}
+
+// AddService creates a ClusterIP service and an EndpointSlice whose ready
+// endpoints reference the given pods.
+func (s *Server) AddService(namespace, name string, pods ...string) {
+	s.t.Helper()
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+	}
+
+	if _, err := s.clientset.CoreV1().Services(namespace).Create(context.Background(), svc, metav1.CreateOptions{}); err != nil {
+		s.t.Fatalf("creating service %s/%s: %v", namespace, name, err)
+	}
+
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name + "-slice",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: name},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+	}
+
+	for i, pod := range pods {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses: []string{fmt.Sprintf("10.0.0.%d", i+1)},
+			TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: namespace, Name: pod},
+		})
+	}
+
+	if _, err := s.clientset.DiscoveryV1().EndpointSlices(namespace).Create(context.Background(), slice, metav1.CreateOptions{}); err != nil {
+		s.t.Fatalf("creating endpoint slice for %s/%s: %v", namespace, name, err)
+	}
+}
+
+// Dials returns how many port-forward streams were opened to port on pod.
+func (s *Server) Dials(namespace, pod string, port int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dials[podKey(namespace, pod, port)]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	namespace, pod, ok := parsePortForwardPath(r.URL.Path)
+	if !ok || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	if _, err := httpstream.Handshake(r, w, []string{"portforward.k8s.io"}); err != nil {
+		return
+	}
+
+	streams := make(chan httpstream.Stream, 4)
+
+	conn := spdy.NewResponseUpgrader().UpgradeResponse(w, r, func(stream httpstream.Stream, _ <-chan struct{}) error {
+		streams <- stream
+		return nil
+	})
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+
+	conn.SetIdleTimeout(time.Minute)
+
+	pairs := make(map[string]*streamPair)
+
+	for {
+		select {
+		case <-conn.CloseChan():
+			return
+		case stream := <-streams:
+			id := stream.Headers().Get(corev1.PortForwardRequestIDHeader)
+
+			pair := pairs[id]
+			if pair == nil {
+				pair = &streamPair{}
+				pairs[id] = pair
+			}
+
+			switch stream.Headers().Get(corev1.StreamType) {
+			case corev1.StreamTypeError:
+				pair.errorStream = stream
+			case corev1.StreamTypeData:
+				pair.dataStream = stream
+			}
+
+			if pair.errorStream != nil && pair.dataStream != nil {
+				delete(pairs, id)
+
+				go s.forward(namespace, pod, pair)
+			}
+		}
+	}
+}
+
+func (s *Server) forward(namespace, pod string, pair *streamPair) {
+	defer pair.errorStream.Close()
+	defer pair.dataStream.Close()
+
+	port, err := strconv.Atoi(pair.dataStream.Headers().Get(corev1.PortHeader))
+	if err != nil {
+		_, _ = fmt.Fprintf(pair.errorStream, "invalid port %q", pair.dataStream.Headers().Get(corev1.PortHeader))
+		return
+	}
+
+	key := podKey(namespace, pod, port)
+
+	s.mu.Lock()
+	h := s.handlers[key]
+	s.dials[key]++
+	s.mu.Unlock()
+
+	if h == nil {
+		_, _ = fmt.Fprintf(pair.errorStream,
+			"error forwarding port %d to pod %s, uid : failed to connect to localhost:%d inside namespace %q: connection refused",
+			port, pod, port, namespace)
+
+		return
+	}
+
+	h(pair.dataStream)
+}
+
+type streamPair struct {
+	dataStream  httpstream.Stream
+	errorStream httpstream.Stream
+}
+
+// parsePortForwardPath extracts namespace and pod from
+// /api/v1/namespaces/<ns>/pods/<pod>/portforward.
+func parsePortForwardPath(p string) (string, string, bool) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) != 7 || parts[0] != "api" || parts[1] != "v1" || parts[2] != "namespaces" ||
+		parts[4] != "pods" || parts[6] != "portforward" {
+		return "", "", false
+	}
+
+	return parts[3], parts[5], true
+}
+
+func podKey(namespace, pod string, port int) string {
+	return fmt.Sprintf("%s/%s:%d", namespace, pod, port)
+}
@@ -0,0 +1,113 @@
+package podproxytest
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/entwico/podproxy/internal/kube"
+)
+
+func TestDialServiceEndToEnd(t *testing.T) {
+	srv := NewServer(t)
+	srv.AddPod("db", "redis-0", nil)
+	srv.AddService("db", "redis", "redis-0")
+	srv.HandlePod("db", "redis-0", 6379, EchoHandler)
+
+	dialer := &kube.ClusterDialer{Forwarders: map[string]*kube.PortForwarder{
+		"production": srv.Forwarder("production"),
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, "tcp", "redis.db.production:6379")
+	if err != nil {
+		t.Fatalf("DialContext() error: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("PING")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+
+	if string(buf) != "PING" {
+		t.Errorf("echoed %q, want %q", buf, "PING")
+	}
+
+	if got := srv.Dials("db", "redis-0", 6379); got != 1 {
+		t.Errorf("Dials() = %d, want 1", got)
+	}
+}
+
+func TestDialPodNotListening(t *testing.T) {
+	srv := NewServer(t)
+	srv.AddPod("db", "redis-0", nil)
+
+	dialer := &kube.ClusterDialer{Forwarders: map[string]*kube.PortForwarder{
+		"production": srv.Forwarder("production"),
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, "tcp", "redis-0.redis.db.production:6379")
+	if err != nil {
+		t.Fatalf("DialContext() error: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = io.ReadAll(conn)
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("ReadAll() error = %v, want remote connection refused", err)
+	}
+}
+
+func TestDialTransport(t *testing.T) {
+	// the fake server only speaks SPDY, like API servers before WebSocket
+	// port-forwards.
+	tests := []struct {
+		transport kube.PortForwardTransport
+		wantErr   bool
+	}{
+		{transport: "", wantErr: false},
+		{transport: kube.TransportAuto, wantErr: false},
+		{transport: kube.TransportSPDY, wantErr: false},
+		{transport: kube.TransportWebSocket, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.transport), func(t *testing.T) {
+			srv := NewServer(t)
+			srv.AddPod("db", "redis-0", nil)
+			srv.HandlePod("db", "redis-0", 6379, EchoHandler)
+
+			fwd := srv.Forwarder("production")
+			fwd.Transport = tt.transport
+
+			dialer := &kube.ClusterDialer{Forwarders: map[string]*kube.PortForwarder{"production": fwd}}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// dial twice, so auto also dials after remembering the fallback.
+			for range 2 {
+				conn, err := dialer.DialContext(ctx, "tcp", "redis-0.redis.db.production:6379")
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("DialContext() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if conn != nil {
+					conn.Close()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryCacheStore keeps cache entries in memory, evicting the least recently
+// used ones beyond MaxBytes.
+type MemoryCacheStore struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *memoryEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCacheStore returns an empty store holding up to maxBytes of
+// entries.
+func NewMemoryCacheStore(maxBytes int64) *MemoryCacheStore {
+	return &MemoryCacheStore{maxBytes: maxBytes, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (s *MemoryCacheStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	s.lru.MoveToFront(el)
+
+	return el.Value.(*memoryEntry).value, true
+}
+
+func (s *MemoryCacheStore) Set(key string, value []byte) {
+	if int64(len(value)) > s.maxBytes {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+
+	s.entries[key] = s.lru.PushFront(&memoryEntry{key: key, value: value})
+	s.size += int64(len(value))
+
+	for s.size > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *MemoryCacheStore) remove(el *list.Element) {
+	entry := s.lru.Remove(el).(*memoryEntry)
+	delete(s.entries, entry.key)
+	s.size -= int64(len(entry.value))
+}
+
+// DiskCacheStore keeps cache entries as files in a directory, so they
+// survive restarts. Beyond MaxBytes the least recently written files are
+// removed.
+type DiskCacheStore struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	files map[string]diskFile
+}
+
+type diskFile struct {
+	size    int64
+	written time.Time
+}
+
+// NewDiskCacheStore opens dir as a store holding up to maxBytes of entries,
+// creating it if needed. Entries left by a previous run are kept.
+func NewDiskCacheStore(dir string, maxBytes int64) (*DiskCacheStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading cache directory: %w", err)
+	}
+
+	s := &DiskCacheStore{dir: dir, maxBytes: maxBytes, files: make(map[string]diskFile)}
+
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		s.files[e.Name()] = diskFile{size: info.Size(), written: info.ModTime()}
+		s.size += info.Size()
+	}
+
+	s.mu.Lock()
+	s.evict()
+	s.mu.Unlock()
+
+	return s, nil
+}
+
+func (s *DiskCacheStore) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(filepath.Join(s.dir, diskFileName(key)))
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+func (s *DiskCacheStore) Set(key string, value []byte) {
+	if int64(len(value)) > s.maxBytes {
+		return
+	}
+
+	name := diskFileName(key)
+
+	// write to a temp file first so readers never see a partial entry.
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+
+	_, err = tmp.Write(value)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.size -= s.files[name].size
+	s.files[name] = diskFile{size: int64(len(value)), written: time.Now()}
+	s.size += int64(len(value))
+
+	s.evict()
+}
+
+// evict removes the oldest files until the store fits maxBytes. The caller
+// holds mu.
+func (s *DiskCacheStore) evict() {
+	if s.size <= s.maxBytes {
+		return
+	}
+
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+
+	slices.SortFunc(names, func(a, b string) int {
+		return s.files[a].written.Compare(s.files[b].written)
+	})
+
+	for _, name := range names {
+		if s.size <= s.maxBytes {
+			return
+		}
+
+		os.Remove(filepath.Join(s.dir, name))
+		s.size -= s.files[name].size
+		delete(s.files, name)
+	}
+}
+
+// diskFileName maps a cache key to a file name.
+func diskFileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+)
+
+// companionHeader must be sent with requests that change state, so web pages
+// can't toggle the PAC file cross-origin: a custom header requires a CORS
+// preflight, which the companion never answers.
+const companionHeader = "X-Podproxy-Companion"
+
+// CompanionStatus is the JSON status served to browser companions.
+type CompanionStatus struct {
+	Version string `json:"version"`
+	// Enabled is false while the PAC file sends all traffic DIRECT.
+	Enabled     bool     `json:"enabled"`
+	PACURL      string   `json:"pacURL"`
+	Clusters    []string `json:"clusters"`
+	Connections int      `json:"connections"`
+}
+
+// Companion serves endpoints for a browser extension or bookmarklet next to
+// the PAC file: a JSON status, a page showing it, and switches that turn the
+// PAC routing off and on. All other requests are served the PAC file.
+//
+//	GET  /companion          status page with a bookmarklet
+//	GET  /companion/status   CompanionStatus as JSON
+//	POST /companion/enable   route cluster hostnames through the proxy again
+//	POST /companion/disable  serve a PAC file that sends everything DIRECT
+type Companion struct {
+	PAC     *PACServer
+	Version string
+	// PACURL is the address browsers load the PAC file from.
+	PACURL string
+	// Connections, if set, returns the number of open proxy connections.
+	Connections func() int
+}
+
+func (c *Companion) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/companion":
+		c.handlePage(w, r)
+	case "/companion/status":
+		c.handleStatus(w, r)
+	case "/companion/enable", "/companion/disable":
+		c.handleToggle(w, r)
+	default:
+		c.PAC.ServeHTTP(w, r)
+	}
+}
+
+func (c *Companion) status() CompanionStatus {
+	s := CompanionStatus{
+		Version:  c.Version,
+		Enabled:  c.PAC.Enabled(),
+		PACURL:   c.PACURL,
+		Clusters: c.PAC.ClusterNames,
+	}
+
+	if s.Clusters == nil {
+		s.Clusters = []string{}
+	}
+
+	if c.Connections != nil {
+		s.Connections = c.Connections()
+	}
+
+	return s
+}
+
+func (c *Companion) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(c.status())
+}
+
+func (c *Companion) handleToggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Header.Get(companionHeader) == "" {
+		http.Error(w, companionHeader+" header required", http.StatusForbidden)
+		return
+	}
+
+	c.PAC.SetEnabled(r.URL.Path == "/companion/enable")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Companion) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := struct {
+		CompanionStatus
+		Header      string
+		Bookmarklet template.URL
+	}{
+		CompanionStatus: c.status(),
+		Header:          companionHeader,
+		// the bookmarklet opens this page from any tab.
+		Bookmarklet: template.URL("javascript:void(window.open('http://" + template.JSEscapeString(r.Host) + "/companion','podproxy'))"),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = companionPage.Execute(w, data)
+}
+
+var companionPage = template.Must(template.New("companion").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>podproxy</title>
+<style>body{font-family:sans-serif;margin:2em;max-width:40em}code{background:#eee;padding:0 .2em}</style>
+</head>
+<body>
+<h1>podproxy {{.Version}}</h1>
+<p>Routing is <strong>{{if .Enabled}}on{{else}}off{{end}}</strong>.
+<button id="toggle" data-path="/companion/{{if .Enabled}}disable{{else}}enable{{end}}">{{if .Enabled}}Turn off{{else}}Turn on{{end}}</button></p>
+<p>{{.Connections}} open connections.</p>
+<p>PAC URL: <code>{{.PACURL}}</code></p>
+<h2>Clusters</h2>
+<ul>{{range .Clusters}}<li><code>*.{{.}}</code></li>{{else}}<li>none</li>{{end}}</ul>
+<p>Drag this link to the bookmarks bar to open this page from any tab: <a href="{{.Bookmarklet}}">podproxy</a></p>
+<script>
+document.getElementById("toggle").addEventListener("click", async (e) => {
+  await fetch(e.target.dataset.path, {method: "POST", headers: {"{{.Header}}": "1"}});
+  location.reload();
+});
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompanion(t *testing.T) {
+	companion := &Companion{
+		PAC:         &PACServer{ClusterNames: []string{"production"}, SOCKSAddress: "127.0.0.1:1080"},
+		Version:     "v1.2.3",
+		PACURL:      "http://127.0.0.1:8081/proxy.pac",
+		Connections: func() int { return 4 },
+	}
+
+	do := func(method, path string, header bool) (int, string) {
+		t.Helper()
+
+		req := httptest.NewRequest(method, path, nil)
+		if header {
+			req.Header.Set(companionHeader, "1")
+		}
+
+		rec := httptest.NewRecorder()
+		companion.ServeHTTP(rec, req)
+
+		resp := rec.Result()
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+
+		return resp.StatusCode, string(body)
+	}
+
+	status := func() CompanionStatus {
+		t.Helper()
+
+		_, body := do(http.MethodGet, "/companion/status", false)
+
+		var s CompanionStatus
+		if err := json.Unmarshal([]byte(body), &s); err != nil {
+			t.Fatalf("decoding status %q: %v", body, err)
+		}
+
+		return s
+	}
+
+	s := status()
+	if !s.Enabled || s.Version != "v1.2.3" || s.Connections != 4 || len(s.Clusters) != 1 || s.Clusters[0] != "production" {
+		t.Errorf("status = %+v", s)
+	}
+
+	if code, _ := do(http.MethodPost, "/companion/disable", false); code != http.StatusForbidden {
+		t.Errorf("disable without header: status %d, want 403", code)
+	}
+
+	if code, _ := do(http.MethodPost, "/companion/disable", true); code != http.StatusNoContent {
+		t.Fatalf("disable: status %d, want 204", code)
+	}
+
+	if status().Enabled {
+		t.Error("status should report routing disabled")
+	}
+
+	if _, pac := do(http.MethodGet, "/proxy.pac", false); strings.Contains(pac, "production") || !strings.Contains(pac, "DIRECT") {
+		t.Errorf("disabled PAC should send everything DIRECT:\n%s", pac)
+	}
+
+	do(http.MethodPost, "/companion/enable", true)
+
+	if _, pac := do(http.MethodGet, "/proxy.pac", false); !strings.Contains(pac, "*.production") {
+		t.Errorf("enabled PAC should route the cluster:\n%s", pac)
+	}
+
+	if _, page := do(http.MethodGet, "/companion", false); !strings.Contains(page, "http://127.0.0.1:8081/proxy.pac") || !strings.Contains(page, "javascript:") {
+		t.Errorf("companion page lacks the PAC URL or bookmarklet:\n%s", page)
+	}
+}
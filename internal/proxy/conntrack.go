@@ -0,0 +1,351 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/entwico/podproxy/internal/metrics"
+)
+
+// LimitPolicy decides what happens to a connection accepted while the
+// ConnTracker is at its limit.
+type LimitPolicy string
+
+const (
+	// LimitQueue holds the connection until another one closes, or rejects
+	// it after QueueTimeout. Later connections wait in the listen backlog.
+	LimitQueue LimitPolicy = "queue"
+	// LimitReject rejects the connection right away.
+	LimitReject LimitPolicy = "reject"
+	// LimitShedIdle closes the tunnel idle for the longest time, at least
+	// ShedIdle, to make room, and rejects the connection if there is none.
+	LimitShedIdle LimitPolicy = "shedIdle"
+)
+
+// ConnTracker counts client connections accepted through its listeners, so
+// shutdown can wait for open tunnels to finish instead of severing them. With
+// Limit set, it also caps them.
+type ConnTracker struct {
+	// Limit, when positive, is the number of connections that may be open at
+	// once; Policy, queue by default, handles connections beyond it.
+	Limit        int
+	Policy       LimitPolicy
+	QueueTimeout time.Duration
+	ShedIdle     time.Duration
+	Logger       *slog.Logger
+
+	active atomic.Int64
+
+	mu        sync.Mutex
+	conns     map[*trackedConn]struct{}
+	freed     chan struct{}
+	saturated bool
+}
+
+// RejectFunc answers a connection turned away at the limit with an error the
+// client understands, then closes it.
+type RejectFunc func(net.Conn)
+
+// Listener wraps l so every accepted connection is counted until closed.
+// Hijacked HTTP connections are the accepted ones, so CONNECT tunnels are
+// tracked as well. reject, if set, answers connections rejected at the
+// limit; they are closed without a word otherwise.
+func (t *ConnTracker) Listener(l net.Listener, reject RejectFunc) net.Listener {
+	if t.Limit > 0 {
+		metrics.ClientConnectionsLimit.Set(float64(t.Limit))
+	}
+
+	return &trackingListener{Listener: l, tracker: t, reject: reject}
+}
+
+// Active returns the number of open connections.
+func (t *ConnTracker) Active() int {
+	return int(t.active.Load())
+}
+
+// Wait blocks until all tracked connections are closed or ctx is done.
+func (t *ConnTracker) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for t.Active() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// admit registers c, applying the policy while at the limit, and reports
+// whether it was admitted.
+func (t *ConnTracker) admit(c *trackedConn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conns == nil {
+		t.conns = make(map[*trackedConn]struct{})
+		t.freed = make(chan struct{})
+	}
+
+	if t.Limit > 0 && len(t.conns) >= t.Limit {
+		t.warnSaturated()
+
+		switch t.policy() {
+		case LimitReject:
+			metrics.ClientConnectionsRejected.WithLabelValues("limit").Inc()
+			return false
+		case LimitShedIdle:
+			if !t.shedIdle() {
+				metrics.ClientConnectionsRejected.WithLabelValues("limit").Inc()
+				return false
+			}
+		case LimitQueue:
+			if !t.waitForSlot() {
+				metrics.ClientConnectionsRejected.WithLabelValues("queueTimeout").Inc()
+				return false
+			}
+		}
+	}
+
+	t.conns[c] = struct{}{}
+	t.active.Add(1)
+	metrics.ClientConnectionsActive.Inc()
+
+	return true
+}
+
+// SetKeepAlive enables TCP keepalive probes on the open client connection
+// from addr, sent once it is idle for period and every period after, so NATs
+// keep long-idle sessions. It reports whether the connection was found.
+func (t *ConnTracker) SetKeepAlive(addr net.Addr, period time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for c := range t.conns {
+		if c.RemoteAddr().String() != addr.String() {
+			continue
+		}
+
+		tc, ok := c.Conn.(interface {
+			SetKeepAliveConfig(config net.KeepAliveConfig) error
+		})
+
+		return ok && tc.SetKeepAliveConfig(net.KeepAliveConfig{Enable: true, Idle: period, Interval: period}) == nil
+	}
+
+	return false
+}
+
+// Connected reports whether a client connection from addr is open.
+func (t *ConnTracker) Connected(addr net.Addr) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for c := range t.conns {
+		if c.RemoteAddr().String() == addr.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// waitForSlot waits up to QueueTimeout, or indefinitely when zero, for a
+// connection to close. t.mu must be held; it is released while waiting.
+func (t *ConnTracker) waitForSlot() bool {
+	metrics.ClientConnectionsPending.Inc()
+	defer metrics.ClientConnectionsPending.Dec()
+
+	var timeout <-chan time.Time
+
+	if t.QueueTimeout > 0 {
+		timer := time.NewTimer(t.QueueTimeout)
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	for len(t.conns) >= t.Limit {
+		freed := t.freed
+
+		t.mu.Unlock()
+
+		select {
+		case <-freed:
+			t.mu.Lock()
+		case <-timeout:
+			t.mu.Lock()
+			return false
+		}
+	}
+
+	return true
+}
+
+// shedIdle closes the connection idle for the longest time, if idle for at
+// least ShedIdle. t.mu must be held.
+func (t *ConnTracker) shedIdle() bool {
+	var (
+		oldest     *trackedConn
+		oldestSeen int64
+	)
+
+	for c := range t.conns {
+		if seen := c.lastActive.Load(); oldest == nil || seen < oldestSeen {
+			oldest, oldestSeen = c, seen
+		}
+	}
+
+	if oldest == nil || time.Since(time.Unix(0, oldestSeen)) < t.ShedIdle {
+		return false
+	}
+
+	t.release(oldest)
+	metrics.ClientConnectionsShed.Inc()
+
+	if t.Logger != nil {
+		t.Logger.Info("closing idle connection at the connection limit", "client", oldest.RemoteAddr(), "idle", time.Since(time.Unix(0, oldestSeen)).Round(time.Second))
+	}
+
+	// the connection is already released; closing it only ends the tunnel.
+	_ = oldest.Conn.Close()
+
+	return true
+}
+
+// release unregisters c and wakes connections waiting for a slot. t.mu must
+// be held.
+func (t *ConnTracker) release(c *trackedConn) {
+	if _, ok := t.conns[c]; !ok {
+		return
+	}
+
+	delete(t.conns, c)
+	t.active.Add(-1)
+	metrics.ClientConnectionsActive.Dec()
+
+	close(t.freed)
+	t.freed = make(chan struct{})
+
+	// leave saturation with some headroom, so a tracker hovering at the
+	// limit doesn't warn on every connection.
+	if t.saturated && len(t.conns) <= t.Limit*9/10 {
+		t.saturated = false
+	}
+}
+
+// warnSaturated logs reaching the limit once per saturation. t.mu must be
+// held.
+func (t *ConnTracker) warnSaturated() {
+	if t.saturated {
+		return
+	}
+
+	t.saturated = true
+
+	if t.Logger != nil {
+		t.Logger.Warn("client connection limit reached", "limit", t.Limit, "policy", t.policy())
+	}
+}
+
+func (t *ConnTracker) policy() LimitPolicy {
+	if t.Policy == "" {
+		return LimitQueue
+	}
+
+	return t.Policy
+}
+
+type trackingListener struct {
+	net.Listener
+	tracker *ConnTracker
+	reject  RejectFunc
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		c := &trackedConn{Conn: conn, tracker: l.tracker}
+		c.touch()
+
+		if l.tracker.admit(c) {
+			return c, nil
+		}
+
+		if l.reject != nil {
+			go l.reject(conn)
+		} else {
+			_ = conn.Close()
+		}
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *ConnTracker
+	// lastActive is the time of the last read or write in Unix nanoseconds.
+	lastActive atomic.Int64
+	closeOnce  sync.Once
+}
+
+func (c *trackedConn) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+func (c *trackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.touch()
+	}
+
+	return n, err
+}
+
+func (c *trackedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.touch()
+	}
+
+	return n, err
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.tracker.mu.Lock()
+		c.tracker.release(c)
+		c.tracker.mu.Unlock()
+	})
+
+	return c.Conn.Close()
+}
+
+// rejectTimeout bounds the exchange with a rejected client.
+const rejectTimeout = 5 * time.Second
+
+// RejectHTTP answers an HTTP proxy connection with 503 Service Unavailable.
+func RejectHTTP(conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(rejectTimeout))
+
+	const body = "podproxy is at its connection limit, try again later\n"
+
+	_, _ = conn.Write([]byte("HTTP/1.1 503 Service Unavailable\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Connection: close\r\n" +
+		"Retry-After: 1\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body))
+}
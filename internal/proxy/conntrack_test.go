@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestConnTrackerWaitsForOpenConnections(t *testing.T) {
+	var tracker ConnTracker
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	tl := tracker.Listener(ln, nil)
+	defer tl.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	server, err := tl.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+
+	if got := tracker.Active(); got != 1 {
+		t.Fatalf("Active() = %d, want 1", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	if err := tracker.Wait(ctx); err == nil {
+		t.Fatal("Wait returned before the connection was closed")
+	}
+
+	// closing twice must only be counted once.
+	server.Close()
+	server.Close()
+
+	if got := tracker.Active(); got != 0 {
+		t.Fatalf("Active() after close = %d, want 0", got)
+	}
+
+	if err := tracker.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
+
+// limitedListener returns a listener of tracker and a function dialing it and
+// returning both ends, or a nil server end when the connection is rejected
+// within a second.
+func limitedListener(t *testing.T, tracker *ConnTracker, reject RejectFunc) func() (client, server net.Conn) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	tl := tracker.Listener(ln, reject)
+	t.Cleanup(func() { tl.Close() })
+
+	accepted := make(chan net.Conn)
+
+	go func() {
+		for {
+			conn, err := tl.Accept()
+			if err != nil {
+				return
+			}
+
+			accepted <- conn
+		}
+	}()
+
+	return func() (net.Conn, net.Conn) {
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+
+		t.Cleanup(func() { client.Close() })
+
+		select {
+		case server := <-accepted:
+			t.Cleanup(func() { server.Close() })
+			return client, server
+		case <-time.After(time.Second):
+			return client, nil
+		}
+	}
+}
+
+func TestConnTrackerLimitReject(t *testing.T) {
+	tracker := &ConnTracker{Limit: 1, Policy: LimitReject}
+	dial := limitedListener(t, tracker, RejectHTTP)
+
+	if _, server := dial(); server == nil {
+		t.Fatal("first connection rejected")
+	}
+
+	client, server := dial()
+	if server != nil {
+		t.Fatal("connection beyond the limit accepted")
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatalf("reading rejection: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("rejection status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestConnTrackerLimitQueue(t *testing.T) {
+	tracker := &ConnTracker{Limit: 1, QueueTimeout: 5 * time.Second}
+	dial := limitedListener(t, tracker, nil)
+
+	_, first := dial()
+	if first == nil {
+		t.Fatal("first connection rejected")
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		first.Close()
+	}()
+
+	if _, server := dial(); server == nil {
+		t.Fatal("queued connection not accepted after a slot freed")
+	}
+
+	if got := tracker.Active(); got != 1 {
+		t.Errorf("Active() = %d, want 1", got)
+	}
+}
+
+func TestConnTrackerLimitQueueTimeout(t *testing.T) {
+	tracker := &ConnTracker{Limit: 1, QueueTimeout: 100 * time.Millisecond}
+	dial := limitedListener(t, tracker, nil)
+
+	dial()
+
+	client, server := dial()
+	if server != nil {
+		t.Fatal("connection beyond the limit accepted")
+	}
+
+	// the rejected connection is closed after the queue timeout.
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("read from rejected connection = %v, want EOF", err)
+	}
+}
+
+func TestConnTrackerLimitShedIdle(t *testing.T) {
+	tracker := &ConnTracker{Limit: 2, Policy: LimitShedIdle, ShedIdle: 100 * time.Millisecond}
+	dial := limitedListener(t, tracker, nil)
+
+	idleClient, _ := dial()
+	_, busy := dial()
+
+	time.Sleep(200 * time.Millisecond)
+
+	if _, err := busy.Write([]byte("x")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if _, server := dial(); server == nil {
+		t.Fatal("connection rejected although an idle one could be shed")
+	}
+
+	_ = idleClient.SetReadDeadline(time.Now().Add(time.Second))
+
+	if _, err := idleClient.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("read from shed connection = %v, want EOF", err)
+	}
+
+	if got := tracker.Active(); got != 2 {
+		t.Errorf("Active() = %d, want 2", got)
+	}
+
+	// none of the remaining connections has been idle long enough.
+	if _, server := dial(); server != nil {
+		t.Error("connection accepted without an idle one to shed")
+	}
+}
+
+func TestConnTrackerSetKeepAlive(t *testing.T) {
+	var tracker ConnTracker
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	tl := tracker.Listener(ln, nil)
+	defer tl.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	server, err := tl.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	defer server.Close()
+
+	if !tracker.SetKeepAlive(client.LocalAddr(), 30*time.Second) {
+		t.Error("SetKeepAlive() didn't find the client connection")
+	}
+
+	if tracker.SetKeepAlive(&net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1}, 30*time.Second) {
+		t.Error("SetKeepAlive() found a connection of an unknown client")
+	}
+}
+
+func TestConnTrackerConnected(t *testing.T) {
+	var tracker ConnTracker
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	tl := tracker.Listener(ln, nil)
+	defer tl.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	server, err := tl.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+
+	if !tracker.Connected(client.LocalAddr()) {
+		t.Error("Connected() = false for an open client connection")
+	}
+
+	server.Close()
+
+	if tracker.Connected(client.LocalAddr()) {
+		t.Error("Connected() = true after the connection was closed")
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// LocalForward accepts connections on a local listener and tunnels each one
+// to a fixed target address, like kubectl port-forward.
+type LocalForward struct {
+	// Target is the host:port dialed for every accepted connection.
+	Target      string
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	Logger      *slog.Logger
+}
+
+// Serve accepts connections on ln until ctx is cancelled or the listener
+// fails. It closes ln and waits for active connections before returning.
+func (f *LocalForward) Serve(ctx context.Context, ln net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stop := context.AfterFunc(ctx, func() {
+		ln.Close()
+	})
+	defer stop()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			f.handle(ctx, conn)
+		}()
+	}
+}
+
+func (f *LocalForward) handle(ctx context.Context, client net.Conn) {
+	defer client.Close()
+
+	upstream, err := f.DialContext(ctx, "tcp", f.Target)
+	if err != nil {
+		f.Logger.Error("forward dial failed", "target", f.Target, "client", client.RemoteAddr(), "error", err)
+		return
+	}
+	defer upstream.Close()
+
+	// unblock the relay when the forward is stopped.
+	stop := context.AfterFunc(ctx, func() {
+		client.Close()
+		upstream.Close()
+	})
+	defer stop()
+
+	relay(client, upstream)
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLocalForwardRelays(t *testing.T) {
+	upstreamClient, serverConn := net.Pipe()
+
+	var dialed string
+
+	fwd := &LocalForward{
+		Target: "postgres.db.production:5432",
+		DialContext: func(_ context.Context, _, addr string) (net.Conn, error) {
+			dialed = addr
+			return serverConn, nil
+		},
+		Logger: slog.New(slog.DiscardHandler),
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- fwd.Serve(ctx, ln)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	const msg = "ping"
+
+	if _, err := fmt.Fprint(conn, msg); err != nil {
+		t.Fatalf("client write: %v", err)
+	}
+
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(upstreamClient, buf); err != nil {
+		t.Fatalf("upstream read: %v", err)
+	}
+
+	if string(buf) != msg {
+		t.Errorf("upstream received %q, want %q", buf, msg)
+	}
+
+	if dialed != fwd.Target {
+		t.Errorf("dialed %q, want %q", dialed, fwd.Target)
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve = %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return after cancel")
+	}
+}
+
+func TestLocalForwardDialFailureClosesClient(t *testing.T) {
+	fwd := &LocalForward{
+		Target: "missing.default:80",
+		DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+		Logger: slog.New(slog.DiscardHandler),
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = fwd.Serve(ctx, ln)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("Read error = %v, want EOF", err)
+	}
+}
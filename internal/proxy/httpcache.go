@@ -0,0 +1,272 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/entwico/podproxy/internal/auth"
+)
+
+// defaultMaxEntrySize is the largest response body cached when
+// HTTPCache.MaxEntrySize is zero.
+const defaultMaxEntrySize = 1 << 20
+
+// CacheStore holds encoded cache entries by key.
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+// HTTPCache caches responses to plain HTTP GET requests for as long as their
+// Cache-Control max-age or Expires header allows. Entries are kept per proxy
+// user, or shared by all clients without proxy authentication, and never
+// revalidated, so a stale entry is simply fetched again. Responses that
+// set cookies or answer requests with cookies or credentials aren't stored,
+// nor private ones shared by all clients.
+type HTTPCache struct {
+	Store CacheStore
+	// Hosts limits caching to requests for these hostnames. "*." followed by
+	// a suffix matches every hostname ending in it. Empty caches all hosts.
+	Hosts []string
+	// MaxEntrySize is the largest response body that is cached. Zero
+	// defaults to 1 MiB.
+	MaxEntrySize int64
+
+	// test override — if nil, time.Now is used.
+	now func() time.Time
+}
+
+// cacheEntry is a stored response. Vary holds the request header values the
+// response was selected by.
+type cacheEntry struct {
+	Stored   time.Time
+	Expires  time.Time
+	Vary     map[string]string
+	Response []byte
+}
+
+// lookup returns a fresh cached response to r, or nil. It is safe to call on
+// a nil cache.
+func (c *HTTPCache) lookup(r *http.Request) *http.Response {
+	if !c.cacheable(r) || bypassesCache(r.Header) {
+		return nil
+	}
+
+	data, ok := c.Store.Get(cacheKey(r))
+	if !ok {
+		return nil
+	}
+
+	var entry cacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		return nil
+	}
+
+	now := c.clock()
+	if !now.Before(entry.Expires) {
+		return nil
+	}
+
+	for name, value := range entry.Vary {
+		if r.Header.Get(name) != value {
+			return nil
+		}
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(entry.Response)), r)
+	if err != nil {
+		return nil
+	}
+
+	resp.Header.Set("Age", strconv.Itoa(int(now.Sub(entry.Stored).Seconds())))
+
+	return resp
+}
+
+// store caches resp, the response to r, if it is cacheable, and returns a
+// response equivalent to resp for the caller to forward. It is safe to call
+// on a nil cache.
+func (c *HTTPCache) store(r *http.Request, resp *http.Response) *http.Response {
+	if !c.cacheable(r) || hasDirective(r.Header, "no-store") || !shareable(r, resp) {
+		return resp
+	}
+
+	now := c.clock()
+
+	expires, ok := freshUntil(resp, now)
+	if !ok {
+		return resp
+	}
+
+	vary := map[string]string{}
+
+	for _, field := range resp.Header.Values("Vary") {
+		for name := range strings.SplitSeq(field, ",") {
+			if name = strings.TrimSpace(name); name == "*" {
+				return resp
+			} else if name != "" {
+				vary[name] = r.Header.Get(name)
+			}
+		}
+	}
+
+	maxSize := c.MaxEntrySize
+	if maxSize <= 0 {
+		maxSize = defaultMaxEntrySize
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil || int64(len(body)) > maxSize {
+		// forward what was read followed by the rest, uncached.
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp
+	}
+
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// DumpResponse leaves resp with an unread copy of the body.
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return resp
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cacheEntry{Stored: now, Expires: expires, Vary: vary, Response: dump}); err == nil {
+		c.Store.Set(cacheKey(r), buf.Bytes())
+	}
+
+	return resp
+}
+
+// cacheable reports whether r is a request the cache applies to.
+func (c *HTTPCache) cacheable(r *http.Request) bool {
+	if c == nil || r.Method != http.MethodGet || r.URL.Scheme != "http" {
+		return false
+	}
+
+	if len(c.Hosts) == 0 {
+		return true
+	}
+
+	host := strings.ToLower(r.URL.Hostname())
+
+	for _, pattern := range c.Hosts {
+		pattern = strings.ToLower(pattern)
+
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *HTTPCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+
+	return time.Now()
+}
+
+// cacheKey identifies the cached response to r. Entries are kept per proxy
+// user, since responses may depend on the user's cookies or credentials.
+func cacheKey(r *http.Request) string {
+	return auth.UserFromContext(r.Context()) + " " + r.URL.String()
+}
+
+// shareable reports whether resp, the response to r, may be served to the
+// other clients sharing the cache entries of r: those of the same proxy
+// user, or all clients if r is unauthenticated.
+func shareable(r *http.Request, resp *http.Response) bool {
+	if r.Header.Get("Cookie") != "" || r.Header.Get("Authorization") != "" || resp.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	if auth.UserFromContext(r.Context()) != "" {
+		return true
+	}
+
+	// private="field" only keeps the field private, but is rare enough to
+	// treat like private.
+	for _, field := range resp.Header.Values("Cache-Control") {
+		for d := range strings.SplitSeq(field, ",") {
+			if name, _, _ := strings.Cut(strings.TrimSpace(d), "="); strings.EqualFold(name, "private") {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// bypassesCache reports whether request headers ask for a response from the
+// origin, e.g. on a browser reload.
+func bypassesCache(h http.Header) bool {
+	return hasDirective(h, "no-cache") || hasDirective(h, "no-store") ||
+		hasDirective(h, "max-age=0") || h.Get("Pragma") == "no-cache"
+}
+
+// freshUntil returns when resp, received at now, becomes stale. Responses
+// that must not be stored or reused without revalidation are not cacheable.
+func freshUntil(resp *http.Response, now time.Time) (time.Time, bool) {
+	if resp.StatusCode != http.StatusOK ||
+		hasDirective(resp.Header, "no-store") || hasDirective(resp.Header, "no-cache") {
+		return time.Time{}, false
+	}
+
+	for field := range strings.SplitSeq(resp.Header.Get("Cache-Control"), ",") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(field), "max-age="); ok {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds <= 0 {
+				return time.Time{}, false
+			}
+
+			return now.Add(time.Duration(seconds) * time.Second), true
+		}
+	}
+
+	expires, err := http.ParseTime(resp.Header.Get("Expires"))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// Expires is relative to the origin's clock.
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		expires = now.Add(expires.Sub(date))
+	}
+
+	return expires, expires.After(now)
+}
+
+// hasDirective reports whether the Cache-Control header of h contains
+// directive.
+func hasDirective(h http.Header, directive string) bool {
+	for _, field := range h.Values("Cache-Control") {
+		for d := range strings.SplitSeq(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(d), directive) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// readCloser reads from Reader and closes Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
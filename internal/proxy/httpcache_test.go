@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPProxyCache(t *testing.T) {
+	var hits int
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		switch r.URL.Path {
+		case "/app.js":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		case "/expires":
+			w.Header().Set("Expires", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/session":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Set-Cookie", "session=abc")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/profile":
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+
+		fmt.Fprintf(w, "%s #%d", r.URL.Path, hits)
+	}))
+	defer backend.Close()
+
+	now := time.Now()
+
+	proxy := &HTTPProxy{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, backend.Listener.Addr().String())
+		},
+		Cache: &HTTPCache{
+			Store: NewMemoryCacheStore(1 << 20),
+			Hosts: []string{"*.production"},
+			now:   func() time.Time { return now },
+		},
+	}
+
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	get := func(target string, header http.Header) string {
+		t.Helper()
+
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s through proxy: %v", target, err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+
+		return string(body)
+	}
+
+	steps := []struct {
+		name   string
+		target string
+		header http.Header
+		want   string
+	}{
+		{"first fetch", "http://web.frontend.production/app.js", nil, "/app.js #1"},
+		{"cached", "http://web.frontend.production/app.js", nil, "/app.js #1"},
+		{"reload bypasses", "http://web.frontend.production/app.js", http.Header{"Cache-Control": {"no-cache"}}, "/app.js #2"},
+		{"reload refreshes", "http://web.frontend.production/app.js", nil, "/app.js #2"},
+		{"expires", "http://web.frontend.production/expires", nil, "/expires #3"},
+		{"expires cached", "http://web.frontend.production/expires", nil, "/expires #3"},
+		{"no-store", "http://web.frontend.production/no-store", nil, "/no-store #4"},
+		{"no-store not cached", "http://web.frontend.production/no-store", nil, "/no-store #5"},
+		{"vary first", "http://web.frontend.production/vary", http.Header{"Accept-Language": {"en"}}, "/vary #6"},
+		{"vary other value", "http://web.frontend.production/vary", http.Header{"Accept-Language": {"de"}}, "/vary #7"},
+		{"vary same value", "http://web.frontend.production/vary", http.Header{"Accept-Language": {"de"}}, "/vary #7"},
+		{"host not cached", "http://example.com/app.js", nil, "/app.js #8"},
+		{"host not cached again", "http://example.com/app.js", nil, "/app.js #9"},
+		{"set-cookie", "http://web.frontend.production/session", nil, "/session #10"},
+		{"set-cookie not cached", "http://web.frontend.production/session", nil, "/session #11"},
+		{"private", "http://web.frontend.production/private", nil, "/private #12"},
+		{"private not shared", "http://web.frontend.production/private", nil, "/private #13"},
+		{"cookie", "http://web.frontend.production/profile", http.Header{"Cookie": {"session=abc"}}, "/profile #14"},
+		{"authorization", "http://web.frontend.production/profile", http.Header{"Authorization": {"Bearer abc"}}, "/profile #15"},
+		{"credentials not cached", "http://web.frontend.production/profile", nil, "/profile #16"},
+	}
+
+	for _, s := range steps {
+		if got := get(s.target, s.header); got != s.want {
+			t.Errorf("%s: got %q, want %q", s.name, got, s.want)
+		}
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	if got := get("http://web.frontend.production/app.js", nil); got != "/app.js #17" {
+		t.Errorf("after expiry: got %q, want a fresh response", got)
+	}
+}
+
+func TestMemoryCacheStoreEvicts(t *testing.T) {
+	store := NewMemoryCacheStore(10)
+
+	store.Set("a", []byte("1234"))
+	store.Set("b", []byte("1234"))
+	store.Get("a")
+	store.Set("c", []byte("1234"))
+
+	if _, ok := store.Get("b"); ok {
+		t.Error("least recently used entry b should have been evicted")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, ok := store.Get(key); !ok {
+			t.Errorf("entry %s should be kept", key)
+		}
+	}
+}
+
+func TestDiskCacheStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewDiskCacheStore(dir, 10)
+	if err != nil {
+		t.Fatalf("NewDiskCacheStore() error: %v", err)
+	}
+
+	store.Set("a", []byte("1234"))
+	store.Set("b", []byte("5678"))
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, diskFileName("a")), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// a reopened store finds the entries of the previous one.
+	store, err = NewDiskCacheStore(dir, 10)
+	if err != nil {
+		t.Fatalf("NewDiskCacheStore() error: %v", err)
+	}
+
+	if got, ok := store.Get("b"); !ok || string(got) != "5678" {
+		t.Errorf("Get(b) = %q, %v, want 5678", got, ok)
+	}
+
+	store.Set("c", []byte("9012"))
+
+	if _, ok := store.Get("c"); !ok {
+		t.Error("entry c should be kept")
+	}
+
+	if _, ok := store.Get("a"); ok {
+		t.Error("oldest entry a should have been evicted")
+	}
+}
@@ -8,8 +8,16 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/metrics"
+	"github.com/entwico/podproxy/internal/proxyproto"
 )
 
 // hopByHopHeaders are removed from forwarded requests and responses per RFC 7230.
@@ -25,19 +33,154 @@ var hopByHopHeaders = []string{
 	"Upgrade",
 }
 
+// CredentialStore validates proxy credentials. It matches the go-socks5
+// interface so the same store can back both listeners.
+type CredentialStore interface {
+	Valid(user, password, userAddr string) bool
+}
+
+// TransportOptions tunes the transport used to forward plain HTTP requests.
+// Zero values keep the defaults.
+type TransportOptions struct {
+	// MaxIdleConnsPerHost defaults to 10.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout defaults to 30s.
+	IdleConnTimeout time.Duration
+	// ResponseHeaderTimeout limits the wait for upstream response headers.
+	// Zero means no limit.
+	ResponseHeaderTimeout time.Duration
+	DisableCompression    bool
+}
+
+// HostRouter maps the host and path of plain HTTP requests to another
+// address to send them to, e.g. the backend of a cluster Ingress.
+type HostRouter interface {
+	Route(ctx context.Context, host, path string) (addr string, ok bool)
+}
+
+// HostRewriter picks the Host header sent with plain HTTP requests to host,
+// which may include a port.
+type HostRewriter interface {
+	RewriteHost(host string) (rewritten string, ok bool)
+}
+
+// UpstreamProtocols reports the application protocol the upstream behind an
+// address speaks, e.g. "h2c" for HTTP/2 in plain text.
+type UpstreamProtocols interface {
+	UpstreamProtocol(addr string) string
+}
+
+// ErrTargetDenied is wrapped by TargetChecker errors for well-formed targets
+// the connection isn't allowed to reach.
+var ErrTargetDenied = errors.New("target not allowed")
+
+// TargetChecker validates the target of a CONNECT request before it is
+// dialed. Errors wrapping ErrTargetDenied are answered with 403 Forbidden,
+// other errors with 400 Bad Request.
+type TargetChecker interface {
+	CheckTarget(ctx context.Context, addr string) error
+}
+
+// ClusterTargets tells the addresses of cluster targets from passthrough
+// ones.
+type ClusterTargets interface {
+	IsClusterTarget(addr string) bool
+}
+
 // HTTPProxy handles HTTP CONNECT requests (HTTPS tunneling) and forwards
 // plain HTTP requests to the upstream via a pluggable DialContext function.
 type HTTPProxy struct {
 	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
 	Logger      *slog.Logger
 
-	initOnce     sync.Once
-	transportMu  sync.RWMutex
-	transport    *http.Transport
-	roundTripper http.RoundTripper
+	// Credentials, if set, requires Basic proxy authentication on every
+	// request. The authenticated username is stored in the request context.
+	Credentials CredentialStore
+
+	// Transport tunes forwarding of plain HTTP requests. It is read on the
+	// first forwarded request.
+	Transport TransportOptions
+
+	// Router, if set, is consulted for plain HTTP requests on port 80. Routed
+	// requests are sent to the returned address with their Host header
+	// unchanged.
+	Router HostRouter
+
+	// HostRewriter, if set, replaces the Host header of plain HTTP requests,
+	// e.g. for upstreams that route by virtual host. Applied after Router.
+	HostRewriter HostRewriter
+
+	// Cache, if set, answers plain HTTP GET requests with fresh cached
+	// responses and stores cacheable ones.
+	Cache *HTTPCache
+
+	// Limiter, if set, answers tunnels and requests of clients opening them
+	// too fast with 429 Too Many Requests.
+	Limiter *ConnRateLimiter
+
+	// TargetChecker, if set, rejects CONNECT targets that can't be dialed
+	// before dialing, so clients get a 403 or 400 instead of a 502.
+	TargetChecker TargetChecker
+
+	// LocalhostPort, if set, forwards requests to *.localhost names sent to
+	// the listener directly, as browsers do without proxy settings, to the
+	// name before .localhost, on the port of a leading numeric label or else
+	// on LocalhostPort. The Host header is kept, so the upstream's redirects
+	// and cookies stay on the localhost name.
+	LocalhostPort int
+
+	// LocalhostTargets limits LocalhostPort to names of cluster targets, so
+	// pages in the browser can't reach other hosts through the proxy. No
+	// *.localhost name is forwarded without it.
+	LocalhostTargets ClusterTargets
+
+	// Protocols, if set, picks how plain HTTP requests are forwarded:
+	// upstreams speaking h2c get HTTP/2 with prior knowledge, others
+	// HTTP/1.1.
+	Protocols UpstreamProtocols
+
+	initOnce        sync.Once
+	transportMu     sync.RWMutex
+	transport       *http.Transport
+	roundTripper    http.RoundTripper
+	h2cTransport    *http.Transport
+	h2cRoundTripper http.RoundTripper
 }
 
 func (p *HTTPProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var user string
+
+	if p.Credentials != nil {
+		var (
+			password string
+			ok       bool
+		)
+
+		user, password, ok = auth.ParseProxyAuthorization(r.Header.Get("Proxy-Authorization"))
+		if !ok || !p.Credentials.Valid(user, password, r.RemoteAddr) {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="podproxy"`)
+			http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+
+			return
+		}
+
+		r = r.WithContext(auth.WithUser(r.Context(), user))
+	}
+
+	if ok, retryAfter := p.Limiter.Allow(RateLimitKey(user, r.RemoteAddr)); !ok {
+		metrics.RateLimitedTotal.WithLabelValues("http").Inc()
+
+		if p.Logger != nil {
+			p.Logger.Debug("connection rate limited", "client", r.RemoteAddr, "user", user, "retry_after", retryAfter)
+		}
+
+		// round up, so a client honoring Retry-After finds a token.
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		http.Error(w, "too many new connections, slow down", http.StatusTooManyRequests)
+
+		return
+	}
+
 	if r.Method == http.MethodConnect {
 		p.handleConnect(w, r)
 		return
@@ -49,16 +192,48 @@ func (p *HTTPProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // Close shuts down the proxy's HTTP transport, releasing idle connections.
 func (p *HTTPProxy) Close() {
 	p.transportMu.RLock()
-	t := p.transport
+	t, h2c := p.transport, p.h2cTransport
 	p.transportMu.RUnlock()
 
 	if t != nil {
 		t.CloseIdleConnections()
+		h2c.CloseIdleConnections()
 	}
 }
 
 func (p *HTTPProxy) handleConnect(w http.ResponseWriter, r *http.Request) {
-	upstream, err := p.DialContext(r.Context(), "tcp", r.Host)
+	ctx := r.Context()
+
+	// plain HTTP requests share pooled upstream connections, so only tunnels
+	// carry the client's address, e.g. for a PROXY protocol header.
+	if client, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		ctx = proxyproto.WithClientAddr(ctx, net.TCPAddrFromAddrPort(client))
+	}
+
+	addr, err := normalizeConnectTarget(r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if p.TargetChecker != nil {
+		if err := p.TargetChecker.CheckTarget(ctx, addr); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrTargetDenied) {
+				status = http.StatusForbidden
+			}
+
+			if p.Logger != nil {
+				p.Logger.Debug("CONNECT target rejected", "addr", addr, "status", status, "error", err)
+			}
+
+			http.Error(w, err.Error(), status)
+
+			return
+		}
+	}
+
+	upstream, err := p.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("dial upstream: %v", err), http.StatusBadGateway)
 		return
@@ -96,45 +271,123 @@ func (p *HTTPProxy) handleConnect(w http.ResponseWriter, r *http.Request) {
 	relay(client, upstream)
 }
 
-func (p *HTTPProxy) httpTransport() http.RoundTripper {
+// normalizeConnectTarget checks that target, the authority of a CONNECT
+// request, is host:port, and returns it with the host lowercased and without
+// a trailing dot, as the dialers match cluster names.
+func normalizeConnectTarget(target string) (string, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid CONNECT target %q: %w", target, err)
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return "", fmt.Errorf("invalid CONNECT target %q: missing host", target)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid CONNECT target %q: port must be 1-65535", target)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(n)), nil
+}
+
+// httpTransport returns the round tripper for requests to addr.
+func (p *HTTPProxy) httpTransport(addr string) http.RoundTripper {
 	p.initOnce.Do(func() {
+		opts := p.Transport
+
+		if opts.MaxIdleConnsPerHost == 0 {
+			opts.MaxIdleConnsPerHost = 10
+		}
+
+		if opts.IdleConnTimeout == 0 {
+			opts.IdleConnTimeout = 30 * time.Second
+		}
+
 		t := &http.Transport{
 			DialContext:           p.DialContext,
-			MaxIdleConns:          100,
-			MaxIdleConnsPerHost:   10,
-			IdleConnTimeout:       30 * time.Second,
+			MaxIdleConns:          max(100, opts.MaxIdleConnsPerHost),
+			MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+			IdleConnTimeout:       opts.IdleConnTimeout,
+			ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+			DisableCompression:    opts.DisableCompression,
 			TLSHandshakeTimeout:   10 * time.Second,
 			ExpectContinueTimeout: 1 * time.Second,
 		}
 
-		rt := &retryTransport{base: t}
+		h2c := t.Clone()
+		h2c.Protocols = new(http.Protocols)
+		h2c.Protocols.SetUnencryptedHTTP2(true)
 
 		p.transportMu.Lock()
-		p.transport = t
-		p.roundTripper = rt
+		p.transport, p.roundTripper = t, &retryTransport{base: t}
+		p.h2cTransport, p.h2cRoundTripper = h2c, &retryTransport{base: h2c}
 		p.transportMu.Unlock()
 	})
 
 	p.transportMu.RLock()
 	defer p.transportMu.RUnlock()
 
+	if p.Protocols != nil && p.Protocols.UpstreamProtocol(addr) == "h2c" {
+		return p.h2cRoundTripper
+	}
+
 	return p.roundTripper
 }
 
 func (p *HTTPProxy) handleHTTP(w http.ResponseWriter, r *http.Request) {
 	if !r.URL.IsAbs() {
-		http.Error(w, "request URI must be absolute", http.StatusBadRequest)
-		return
+		addr, ok := localhostTarget(r.Host, p.LocalhostPort)
+		if p.LocalhostPort == 0 || p.LocalhostTargets == nil || !ok || !p.LocalhostTargets.IsClusterTarget(addr) {
+			http.Error(w, "request URI must be absolute", http.StatusBadRequest)
+			return
+		}
+
+		if crossSite(r) {
+			http.Error(w, "cross-site requests to *.localhost names are not forwarded", http.StatusForbidden)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.URL.Scheme, r.URL.Host = "http", addr
 	}
 
 	outReq := r.Clone(r.Context())
 	outReq.RequestURI = ""
 	removeHopByHopHeaders(outReq.Header)
 
-	resp, err := p.httpTransport().RoundTrip(outReq)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("forwarding request: %v", err), http.StatusBadGateway)
-		return
+	if p.Router != nil && r.URL.Scheme == "http" && (r.URL.Port() == "" || r.URL.Port() == "80") {
+		if addr, ok := p.Router.Route(r.Context(), r.URL.Hostname(), r.URL.Path); ok {
+			// the URL host picks the dialed address and the idle connection
+			// pool; the Host header keeps the original name.
+			outReq.Host = r.Host
+			outReq.URL.Host = addr
+
+			if p.Logger != nil {
+				p.Logger.Debug("routed request", "host", r.URL.Hostname(), "path", r.URL.Path, "addr", addr)
+			}
+		}
+	}
+
+	if p.HostRewriter != nil {
+		if host, ok := p.HostRewriter.RewriteHost(r.Host); ok {
+			outReq.Host = host
+		}
+	}
+
+	resp := p.Cache.lookup(r)
+	if resp == nil {
+		var err error
+
+		resp, err = p.httpTransport(requestAddr(outReq.URL)).RoundTrip(outReq)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("forwarding request: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		resp = p.Cache.store(r, resp)
 	}
 	defer resp.Body.Close()
 
@@ -153,6 +406,20 @@ func (p *HTTPProxy) handleHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// requestAddr returns the address a request to u is sent to, with the
+// scheme's default port if u has none.
+func requestAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
 func removeHopByHopHeaders(h http.Header) {
 	for _, key := range hopByHopHeaders {
 		h.Del(key)
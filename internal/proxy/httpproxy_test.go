@@ -3,6 +3,7 @@ package proxy
 import (
 	"bufio"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +13,10 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/proxyproto"
 )
 
 func TestHTTPProxyNonAbsoluteURL(t *testing.T) {
@@ -33,6 +38,54 @@ func TestHTTPProxyNonAbsoluteURL(t *testing.T) {
 	}
 }
 
+func TestHTTPProxyRequiresAuth(t *testing.T) {
+	proxy := &HTTPProxy{
+		Credentials: auth.Users{"alice": {Password: "secret"}},
+		DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+			t.Fatal("DialContext should not be called without valid credentials")
+			return nil, nil
+		},
+	}
+
+	for _, header := range []string{"", "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:wrong"))} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodConnect, "example.com:443", nil)
+		req.Header.Set("Proxy-Authorization", header)
+
+		proxy.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusProxyAuthRequired {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusProxyAuthRequired)
+		}
+
+		if rec.Header().Get("Proxy-Authenticate") == "" {
+			t.Error("expected Proxy-Authenticate header")
+		}
+	}
+}
+
+func TestHTTPProxyAuthStoresUser(t *testing.T) {
+	var gotUser string
+
+	proxy := &HTTPProxy{
+		Credentials: auth.Users{"alice": {Password: "secret"}},
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			gotUser = auth.UserFromContext(ctx)
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodConnect, "example.com:443", nil)
+	req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("alice:secret")))
+
+	proxy.ServeHTTP(rec, req)
+
+	if gotUser != "alice" {
+		t.Errorf("user in dial context = %q, want %q", gotUser, "alice")
+	}
+}
+
 func TestHTTPConnectDialFailure(t *testing.T) {
 	proxy := &HTTPProxy{
 		DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
@@ -50,6 +103,118 @@ func TestHTTPConnectDialFailure(t *testing.T) {
 	}
 }
 
+type targetCheckerFunc func(ctx context.Context, addr string) error
+
+func (f targetCheckerFunc) CheckTarget(ctx context.Context, addr string) error {
+	return f(ctx, addr)
+}
+
+func TestHTTPConnectTargetChecker(t *testing.T) {
+	var dialed []string
+
+	proxy := &HTTPProxy{
+		DialContext: func(_ context.Context, _, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return nil, errors.New("connection refused")
+		},
+		TargetChecker: targetCheckerFunc(func(_ context.Context, addr string) error {
+			switch addr {
+			case "api.secret.production:443":
+				return fmt.Errorf("%w: namespace secret.production: not available on this listener", ErrTargetDenied)
+			case "a.b.c.d.production:443":
+				return errors.New("invalid cluster address")
+			}
+
+			return nil
+		}),
+	}
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"api.secret.production:443", http.StatusForbidden},
+		{"A.B.C.D.Production.:443", http.StatusBadRequest},
+		{"api.production", http.StatusBadRequest},
+		{"api.production:0", http.StatusBadRequest},
+		{":443", http.StatusBadRequest},
+		{"API.Production.:443", http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodConnect, "http://proxy/", nil)
+		req.Host = tt.target
+
+		proxy.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("CONNECT %s status = %d, want %d", tt.target, rec.Code, tt.want)
+		}
+	}
+
+	// only the allowed target is dialed, normalized.
+	if len(dialed) != 1 || dialed[0] != "api.production:443" {
+		t.Errorf("dialed %v, want [api.production:443]", dialed)
+	}
+}
+
+func TestHTTPConnectClientAddr(t *testing.T) {
+	var client net.Addr
+
+	proxy := &HTTPProxy{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			client = proxyproto.ClientAddr(ctx)
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodConnect, "example.com:443", nil)
+	req.RemoteAddr = "192.0.2.7:40000"
+
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	if client == nil || client.String() != "192.0.2.7:40000" {
+		t.Errorf("client address = %v, want 192.0.2.7:40000", client)
+	}
+}
+
+func TestHTTPProxyRateLimit(t *testing.T) {
+	proxy := &HTTPProxy{
+		DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+		Limiter: &ConnRateLimiter{Rate: 0.5, Burst: 1},
+	}
+
+	connect := func(remoteAddr string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodConnect, "example.com:443", nil)
+		req.RemoteAddr = remoteAddr
+
+		proxy.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	if rec := connect("192.0.2.7:40000"); rec.Code != http.StatusBadGateway {
+		t.Fatalf("first CONNECT status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+
+	rec := connect("192.0.2.7:40001")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second CONNECT status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+
+	if rec := connect("192.0.2.8:40000"); rec.Code != http.StatusBadGateway {
+		t.Errorf("CONNECT from another client status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
 func TestHTTPConnectSuccess(t *testing.T) {
 	// upstream is the mock backend; serverConn is what the proxy writes to
 	upstreamClient, serverConn := net.Pipe()
@@ -164,6 +329,275 @@ func TestHTTPProxyForwardGET(t *testing.T) {
 	}
 }
 
+// staticRouter routes one host to addr.
+type staticRouter struct {
+	host, addr string
+}
+
+func (r staticRouter) Route(_ context.Context, host, _ string) (string, bool) {
+	return r.addr, host == r.host
+}
+
+func TestHTTPProxyRouter(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	}))
+	defer backend.Close()
+
+	var dialed []string
+
+	proxy := &HTTPProxy{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return (&net.Dialer{}).DialContext(ctx, network, backend.Listener.Addr().String())
+		},
+		Router: staticRouter{host: "myapp.dev.example.com", addr: "web.myapp.production:8080"},
+	}
+
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	for _, target := range []string{"http://myapp.dev.example.com/", "http://other.example.com/"} {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, target, nil)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s through proxy: %v", target, err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if want := strings.TrimSuffix(strings.TrimPrefix(target, "http://"), "/"); string(body) != want {
+			t.Errorf("backend saw Host %q, want %q", body, want)
+		}
+	}
+
+	if len(dialed) != 2 || dialed[0] != "web.myapp.production:8080" || dialed[1] != "other.example.com:80" {
+		t.Errorf("dialed %v, want [web.myapp.production:8080 other.example.com:80]", dialed)
+	}
+}
+
+type staticRewriter map[string]string
+
+func (s staticRewriter) RewriteHost(host string) (string, bool) {
+	rewritten, ok := s[host]
+	return rewritten, ok
+}
+
+// clusterTargets treats the names ending in its cluster as cluster targets.
+type clusterTargets string
+
+func (c clusterTargets) IsClusterTarget(addr string) bool {
+	host, _, _ := net.SplitHostPort(addr)
+	return strings.HasSuffix(host, "."+string(c))
+}
+
+func TestHTTPProxyLocalhost(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host+r.URL.Path)
+	}))
+	defer backend.Close()
+
+	var dialed []string
+
+	proxy := &HTTPProxy{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return (&net.Dialer{}).DialContext(ctx, network, backend.Listener.Addr().String())
+		},
+		LocalhostPort:    80,
+		LocalhostTargets: clusterTargets("production"),
+	}
+
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	_, port, _ := net.SplitHostPort(proxyServer.Listener.Addr().String())
+
+	// a browser sends origin-form requests to *.localhost, with the name in
+	// the Host header.
+	for _, host := range []string{"grafana.monitoring.production.localhost", "3000.grafana.monitoring.production.localhost"} {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, proxyServer.URL+"/d/home", nil)
+		req.Host = net.JoinHostPort(host, port)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", host, err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if want := req.Host + "/d/home"; string(body) != want {
+			t.Errorf("backend saw %q, want %q", body, want)
+		}
+	}
+
+	if len(dialed) != 2 || dialed[0] != "grafana.monitoring.production:80" || dialed[1] != "grafana.monitoring.production:3000" {
+		t.Errorf("dialed %v, want [grafana.monitoring.production:80 grafana.monitoring.production:3000]", dialed)
+	}
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, proxyServer.URL+"/", nil)
+	req.Host = "example.com"
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET example.com: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("origin-form request to example.com: status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		host   string
+		header http.Header
+		want   int
+	}{
+		{"not a cluster target", http.MethodGet, "169.254.169.254.localhost", nil, http.StatusBadRequest},
+		{"passthrough host", http.MethodGet, "evil.com.localhost", nil, http.StatusBadRequest},
+		{"cross-site fetch", http.MethodGet, "grafana.monitoring.production.localhost", http.Header{"Sec-Fetch-Site": {"cross-site"}, "Sec-Fetch-Mode": {"cors"}}, http.StatusForbidden},
+		{"cross-site form", http.MethodPost, "grafana.monitoring.production.localhost", http.Header{"Sec-Fetch-Site": {"cross-site"}, "Sec-Fetch-Mode": {"navigate"}}, http.StatusForbidden},
+		{"foreign origin", http.MethodPost, "grafana.monitoring.production.localhost", http.Header{"Origin": {"https://evil.com"}}, http.StatusForbidden},
+		{"cross-site link", http.MethodGet, "grafana.monitoring.production.localhost", http.Header{"Sec-Fetch-Site": {"cross-site"}, "Sec-Fetch-Mode": {"navigate"}}, http.StatusOK},
+		{"same-site fetch", http.MethodPost, "grafana.monitoring.production.localhost", http.Header{"Sec-Fetch-Site": {"same-site"}, "Origin": {"http://prometheus.monitoring.production.localhost"}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequestWithContext(context.Background(), tt.method, proxyServer.URL+"/", nil)
+		req.Host = net.JoinHostPort(tt.host, port)
+
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestHTTPProxyHostRewriter(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	}))
+	defer backend.Close()
+
+	var dialed []string
+
+	proxy := &HTTPProxy{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return (&net.Dialer{}).DialContext(ctx, network, backend.Listener.Addr().String())
+		},
+		HostRewriter: staticRewriter{"api.web.production:8080": "api.web.svc.cluster.local:8080"},
+	}
+
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	tests := []struct {
+		target   string
+		wantHost string
+	}{
+		{"http://api.web.production:8080/users", "api.web.svc.cluster.local:8080"},
+		{"http://other.example.com/", "other.example.com"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tt.target, nil)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s through proxy: %v", tt.target, err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != tt.wantHost {
+			t.Errorf("GET %s: backend saw Host %q, want %q", tt.target, body, tt.wantHost)
+		}
+	}
+
+	// the rewritten Host header must not change the dialed address.
+	if len(dialed) != 2 || dialed[0] != "api.web.production:8080" {
+		t.Errorf("dialed %v, want api.web.production:8080 first", dialed)
+	}
+}
+
+// staticProtocols declares the protocol of the upstreams behind addresses.
+type staticProtocols map[string]string
+
+func (p staticProtocols) UpstreamProtocol(addr string) string {
+	return p[addr]
+}
+
+func TestHTTPProxyH2CUpstream(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	}))
+	backend.Config.Protocols = new(http.Protocols)
+	backend.Config.Protocols.SetHTTP1(true)
+	backend.Config.Protocols.SetUnencryptedHTTP2(true)
+	backend.Start()
+	defer backend.Close()
+
+	proxy := &HTTPProxy{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, backend.Listener.Addr().String())
+		},
+		Protocols: staticProtocols{"grpc.api.production:80": "h2c"},
+	}
+	defer proxy.Close()
+
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	tests := []struct {
+		target    string
+		wantProto string
+	}{
+		{"http://grpc.api.production/", "HTTP/2.0"},
+		{"http://web.api.production/", "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tt.target, nil)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s through proxy: %v", tt.target, err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != tt.wantProto {
+			t.Errorf("GET %s: backend saw %q, want %q", tt.target, body, tt.wantProto)
+		}
+	}
+}
+
 func TestHTTPProxyForwardPOST(t *testing.T) {
 	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		body, _ := io.ReadAll(r.Body)
@@ -280,3 +714,28 @@ func TestHTTPProxyForwardDialFailure(t *testing.T) {
 		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadGateway)
 	}
 }
+
+func TestHTTPProxyTransportOptions(t *testing.T) {
+	proxy := &HTTPProxy{
+		Transport: TransportOptions{
+			MaxIdleConnsPerHost:   200,
+			ResponseHeaderTimeout: 5 * time.Second,
+			DisableCompression:    true,
+		},
+	}
+
+	proxy.httpTransport("example.com:80")
+
+	tr := proxy.transport
+	if tr.MaxIdleConnsPerHost != 200 || tr.MaxIdleConns < 200 {
+		t.Errorf("MaxIdleConnsPerHost = %d, MaxIdleConns = %d, want 200 and at least 200", tr.MaxIdleConnsPerHost, tr.MaxIdleConns)
+	}
+
+	if tr.IdleConnTimeout != 30*time.Second {
+		t.Errorf("IdleConnTimeout = %v, want default 30s", tr.IdleConnTimeout)
+	}
+
+	if tr.ResponseHeaderTimeout != 5*time.Second || !tr.DisableCompression {
+		t.Errorf("ResponseHeaderTimeout = %v, DisableCompression = %v, want 5s and true", tr.ResponseHeaderTimeout, tr.DisableCompression)
+	}
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// localhostSuffix is the domain browsers resolve to the loopback address
+// themselves (RFC 6761), so its names reach a local listener without DNS or
+// proxy settings.
+const localhostSuffix = ".localhost"
+
+// localhostTarget returns the address an origin-form request with the Host
+// header host is sent to when host is a *.localhost name: the name before
+// .localhost, e.g. grafana.monitoring.production, on the port of a leading
+// numeric label, as in 3000.grafana.monitoring.production.localhost, or
+// else on defaultPort. The port of host is the listener's and is ignored.
+func localhostTarget(host string, defaultPort int) (string, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	name, ok := strings.CutSuffix(strings.ToLower(strings.TrimSuffix(host, ".")), localhostSuffix)
+	if !ok || name == "" {
+		return "", false
+	}
+
+	port := defaultPort
+
+	if label, rest, found := strings.Cut(name, "."); found {
+		if n, err := strconv.Atoi(label); err == nil {
+			if n < 1 || n > 65535 {
+				return "", false
+			}
+
+			name, port = rest, n
+		}
+	}
+
+	return net.JoinHostPort(name, strconv.Itoa(port)), true
+}
+
+// crossSite reports whether r was sent by a page of another site other than
+// by following a link, e.g. a form posted or a fetch made by a page on the
+// internet, which must not reach cluster targets through the browser's
+// access to the loopback address. Browsers without fetch metadata are
+// judged by the Origin they send with such requests.
+func crossSite(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "same-site", "none":
+		return false
+	case "":
+	default:
+		return r.Header.Get("Sec-Fetch-Mode") != "navigate" || (r.Method != http.MethodGet && r.Method != http.MethodHead)
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return true
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	return host != "localhost" && !strings.HasSuffix(host, localhostSuffix)
+}
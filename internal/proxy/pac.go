@@ -2,15 +2,28 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
 	"text/template"
 )
 
 const pacTemplateString = `function FindProxyForURL(url, host) {
+{{- range .Bypass}}
+  if ({{.}})
+    return "DIRECT";
+{{- end}}
 {{- range .ClusterNames}}
   if (shExpMatch(host, "*.{{.}}"))
     return "{{$.ProxyDirective}}";
+{{- end}}
+{{- range .Hostnames}}
+  if (shExpMatch(host, "{{.}}"))
+    return "{{$.HostnameDirective}}";
 {{- end}}
   return "DIRECT";
 }
@@ -24,25 +37,105 @@ type PACServer struct {
 	ClusterNames     []string
 	SOCKSAddress     string
 	HTTPProxyAddress string
+
+	// Hostnames, if set, returns further hostnames, possibly "*." wildcards,
+	// that are sent to the HTTP proxy, e.g. the hosts of cluster Ingresses.
+	// It is called for every request and ignored without HTTPProxyAddress.
+	Hostnames func(ctx context.Context) []string
+
+	// Bypass lists hosts and domains, in NO_PROXY syntax, that are sent
+	// DIRECT ahead of every other rule. CIDR entries are left out, since
+	// matching them in a PAC file takes a DNS lookup per request.
+	Bypass []string
+
+	hostnames []string
+	disabled  atomic.Bool
+}
+
+// SetEnabled turns routing through the proxy on or off. While off, the PAC
+// file sends all traffic DIRECT.
+func (s *PACServer) SetEnabled(enabled bool) {
+	s.disabled.Store(!enabled)
+}
+
+// Enabled reports whether the PAC file routes traffic through the proxy.
+func (s *PACServer) Enabled() bool {
+	return !s.disabled.Load()
 }
 
-func (s *PACServer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+// ServeHTTP serves the PAC file. The host query parameter replaces the host of
+// the proxy addresses, for clients that reach podproxy under another name,
+// e.g. host.docker.internal from containers.
+func (s *PACServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pac := &PACServer{
+		ClusterNames:     s.ClusterNames,
+		SOCKSAddress:     s.SOCKSAddress,
+		HTTPProxyAddress: s.HTTPProxyAddress,
+		Bypass:           s.Bypass,
+	}
+
+	if !s.Enabled() {
+		pac.ClusterNames = nil
+	}
+
+	if host := r.URL.Query().Get("host"); host != "" {
+		if !pacHostPattern.MatchString(host) {
+			http.Error(w, "invalid host", http.StatusBadRequest)
+			return
+		}
+
+		pac.SOCKSAddress = replaceHost(s.SOCKSAddress, host)
+		pac.HTTPProxyAddress = replaceHost(s.HTTPProxyAddress, host)
+	}
+
+	if s.Hostnames != nil && s.HTTPProxyAddress != "" && s.Enabled() {
+		for _, h := range s.Hostnames(r.Context()) {
+			if pacHostnamePattern.MatchString(h) {
+				pac.hostnames = append(pac.hostnames, h)
+			}
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
 	w.Header().Set("Content-Disposition", "inline; filename=\"proxy.pac\"")
-	_, _ = fmt.Fprint(w, s.generatePAC())
+	_, _ = fmt.Fprint(w, pac.generatePAC())
+}
+
+// pacHostPattern matches host names and IPv4 addresses safe to embed in the
+// generated JavaScript.
+var pacHostPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*$`)
+
+// pacHostnamePattern additionally allows a leading wildcard label.
+var pacHostnamePattern = regexp.MustCompile(`^(\*\.)?[A-Za-z0-9][A-Za-z0-9.-]*$`)
+
+// replaceHost returns addr with its host replaced. Empty and malformed
+// addresses are returned unchanged.
+func replaceHost(addr, host string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return net.JoinHostPort(host, port)
 }
 
 func (s *PACServer) generatePAC() string {
-	if len(s.ClusterNames) == 0 {
+	if len(s.ClusterNames) == 0 && len(s.hostnames) == 0 {
 		return "function FindProxyForURL(url, host) {\n  return \"DIRECT\";\n}\n"
 	}
 
 	data := struct {
-		ClusterNames   []string
-		ProxyDirective string
+		Bypass            []string
+		ClusterNames      []string
+		ProxyDirective    string
+		Hostnames         []string
+		HostnameDirective string
 	}{
-		ClusterNames:   s.ClusterNames,
-		ProxyDirective: s.proxyDirective(),
+		Bypass:            bypassConditions(s.Bypass),
+		ClusterNames:      s.ClusterNames,
+		ProxyDirective:    s.proxyDirective(),
+		Hostnames:         s.hostnames,
+		HostnameDirective: fmt.Sprintf("PROXY %s; DIRECT", s.HTTPProxyAddress),
 	}
 
 	var buf bytes.Buffer
@@ -53,6 +146,33 @@ func (s *PACServer) generatePAC() string {
 	return buf.String()
 }
 
+// bypassConditions returns the PAC conditions matching the NO_PROXY entries:
+// addresses exactly, domains with their subdomains. Entries that can't be
+// embedded safely are skipped.
+func bypassConditions(entries []string) []string {
+	var conditions []string
+
+	for _, e := range entries {
+		if strings.Contains(e, "/") {
+			continue
+		}
+
+		domain := strings.TrimPrefix(strings.TrimPrefix(e, "*"), ".")
+		if !pacHostPattern.MatchString(domain) {
+			continue
+		}
+
+		if net.ParseIP(domain) != nil {
+			conditions = append(conditions, `host == "`+domain+`"`)
+			continue
+		}
+
+		conditions = append(conditions, `host == "`+domain+`" || dnsDomainIs(host, ".`+domain+`")`)
+	}
+
+	return conditions
+}
+
 func (s *PACServer) proxyDirective() string {
 	if s.HTTPProxyAddress != "" {
 		return fmt.Sprintf("PROXY %s; SOCKS5 %s; DIRECT", s.HTTPProxyAddress, s.SOCKSAddress)
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -89,3 +90,96 @@ func TestPACServerHTTPHandler(t *testing.T) {
 		t.Error("response body should contain PAC function")
 	}
 }
+
+func TestPACServerHostParameter(t *testing.T) {
+	s := &PACServer{
+		ClusterNames:     []string{"production"},
+		SOCKSAddress:     "127.0.0.1:1080",
+		HTTPProxyAddress: "127.0.0.1:8080",
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy.pac?host=host.docker.internal", nil))
+
+	if want := "PROXY host.docker.internal:8080; SOCKS5 host.docker.internal:1080"; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("PAC does not contain %q:\n%s", want, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, `/proxy.pac?host=x%22%29%2Balert%281%29`, nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status for unsafe host = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPACServerHostnames(t *testing.T) {
+	s := &PACServer{
+		ClusterNames:     []string{"production"},
+		SOCKSAddress:     "127.0.0.1:1080",
+		HTTPProxyAddress: "127.0.0.1:8080",
+		Hostnames: func(context.Context) []string {
+			return []string{"myapp.dev.example.com", "*.apps.example.com", `evil");alert(1);("`}
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy.pac", nil))
+
+	pac := rec.Body.String()
+
+	for _, want := range []string{
+		`shExpMatch(host, "myapp.dev.example.com"))
+    return "PROXY 127.0.0.1:8080; DIRECT"`,
+		`shExpMatch(host, "*.apps.example.com")`,
+	} {
+		if !strings.Contains(pac, want) {
+			t.Errorf("PAC does not contain %q:\n%s", want, pac)
+		}
+	}
+
+	if strings.Contains(pac, "alert") {
+		t.Errorf("PAC contains unsafe hostname:\n%s", pac)
+	}
+
+	s.HTTPProxyAddress = ""
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy.pac", nil))
+
+	if strings.Contains(rec.Body.String(), "myapp") {
+		t.Errorf("PAC without HTTP proxy contains hostnames:\n%s", rec.Body.String())
+	}
+}
+
+func TestGeneratePACBypass(t *testing.T) {
+	s := &PACServer{
+		ClusterNames: []string{"production"},
+		SOCKSAddress: "127.0.0.1:1080",
+		Bypass:       []string{"localhost", "127.0.0.1", "::1", ".npmjs.org", "*.corp.example.com", "10.0.0.0/8", `evil");alert("`},
+	}
+
+	pac := s.generatePAC()
+
+	for _, want := range []string{
+		`if (host == "localhost" || dnsDomainIs(host, ".localhost"))`,
+		`if (host == "127.0.0.1")`,
+		`if (host == "npmjs.org" || dnsDomainIs(host, ".npmjs.org"))`,
+		`if (host == "corp.example.com" || dnsDomainIs(host, ".corp.example.com"))`,
+	} {
+		if !strings.Contains(pac, want) {
+			t.Errorf("PAC should contain %s:\n%s", want, pac)
+		}
+	}
+
+	for _, unwanted := range []string{"::1", "10.0.0.0", "alert"} {
+		if strings.Contains(pac, unwanted) {
+			t.Errorf("PAC should skip %s:\n%s", unwanted, pac)
+		}
+	}
+
+	// bypass rules come first, so they win over the cluster rules.
+	if strings.Index(pac, "npmjs.org") > strings.Index(pac, "*.production") {
+		t.Errorf("bypass rules should precede the cluster rules:\n%s", pac)
+	}
+}
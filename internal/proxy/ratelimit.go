@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// ConnRateLimiter limits how fast each client may open new connections, with
+// a token bucket per client. It protects the Kubernetes API servers from
+// clients that reconnect in a tight loop. A nil ConnRateLimiter allows
+// everything.
+type ConnRateLimiter struct {
+	// Rate is the sustained number of connections per second, Burst the
+	// number a client may open at once.
+	Rate  float64
+	Burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitSweepInterval is how often buckets that have refilled completely,
+// and so are indistinguishable from new ones, are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// Allow takes a token from the bucket of client and reports whether it had
+// one. When it didn't, retryAfter is the time until the next token.
+func (l *ConnRateLimiter) Allow(client string) (ok bool, retryAfter time.Duration) {
+	if l == nil || l.Rate <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	if l.now != nil {
+		now = l.now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+		l.lastSweep = now
+	}
+
+	burst := float64(max(l.Burst, 1))
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		for key, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= burst {
+				delete(l.buckets, key)
+			}
+		}
+
+		l.lastSweep = now
+	}
+
+	b := l.buckets[client]
+	if b == nil {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// RateLimitKey identifies the client of a connection: the authenticated
+// user, so a user is limited across addresses, or else the IP of
+// remoteAddr.
+func RateLimitKey(user, remoteAddr string) string {
+	if user != "" {
+		return "user:" + user
+	}
+
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return "ip:" + host
+	}
+
+	return "ip:" + remoteAddr
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnRateLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := &ConnRateLimiter{Rate: 2, Burst: 3, now: func() time.Time { return now }}
+
+	for i := range 3 {
+		if ok, _ := l.Allow("ip:192.0.2.7"); !ok {
+			t.Fatalf("connection %d within the burst rejected", i+1)
+		}
+	}
+
+	ok, retryAfter := l.Allow("ip:192.0.2.7")
+	if ok {
+		t.Fatal("connection beyond the burst allowed")
+	}
+
+	if retryAfter != 500*time.Millisecond {
+		t.Errorf("retryAfter = %v, want 500ms", retryAfter)
+	}
+
+	if ok, _ := l.Allow("ip:192.0.2.8"); !ok {
+		t.Error("another client rejected")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+
+	if ok, _ := l.Allow("ip:192.0.2.7"); !ok {
+		t.Error("connection after a refill rejected")
+	}
+
+	if ok, _ := l.Allow("ip:192.0.2.7"); ok {
+		t.Error("second connection after a single refill allowed")
+	}
+}
+
+func TestConnRateLimiterSweep(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := &ConnRateLimiter{Rate: 1, Burst: 1, now: func() time.Time { return now }}
+
+	l.Allow("ip:192.0.2.7")
+
+	now = now.Add(2 * rateLimitSweepInterval)
+
+	l.Allow("ip:192.0.2.8")
+
+	if _, ok := l.buckets["ip:192.0.2.7"]; ok {
+		t.Error("refilled bucket kept after a sweep")
+	}
+}
+
+func TestConnRateLimiterNil(t *testing.T) {
+	var l *ConnRateLimiter
+
+	if ok, _ := l.Allow("ip:192.0.2.7"); !ok {
+		t.Error("nil limiter rejected a connection")
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		user, remoteAddr, want string
+	}{
+		{"alice", "192.0.2.7:40000", "user:alice"},
+		{"", "192.0.2.7:40000", "ip:192.0.2.7"},
+		{"", "[2001:db8::1]:40000", "ip:2001:db8::1"},
+		{"", "", "ip:"},
+	}
+
+	for _, tt := range tests {
+		if got := RateLimitKey(tt.user, tt.remoteAddr); got != tt.want {
+			t.Errorf("RateLimitKey(%q, %q) = %q, want %q", tt.user, tt.remoteAddr, got, tt.want)
+		}
+	}
+}
@@ -4,11 +4,17 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"strings"
 	"syscall"
+	"time"
 )
 
+// retryMaxJitter bounds the random delay before the retry, so clients whose
+// requests failed on the same dropped connection don't retry in lockstep.
+const retryMaxJitter = 100 * time.Millisecond
+
 // roundTripCloser combines RoundTrip with the ability to close idle connections.
 // Both *http.Transport and test mocks satisfy this interface.
 type roundTripCloser interface {
@@ -16,9 +22,10 @@ type roundTripCloser interface {
 	CloseIdleConnections()
 }
 
-// retryTransport wraps a transport and retries once on broken pipe or connection
-// reset errors. This handles the case where the transport's connection pool
-// contains a stale connection whose underlying SPDY stream was closed server-side.
+// retryTransport wraps a transport and retries once, after a short random
+// delay, on broken pipe or connection reset errors. This handles the case where
+// the transport's connection pool contains a stale connection whose underlying
+// SPDY stream was closed server-side.
 type retryTransport struct {
 	base roundTripCloser
 }
@@ -47,6 +54,12 @@ func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	// evict stale connections and retry with a fresh one
 	t.base.CloseIdleConnections()
 
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-time.After(rand.N(retryMaxJitter)):
+	}
+
 	if bodyBytes != nil {
 		req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 	}
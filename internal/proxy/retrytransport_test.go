@@ -192,3 +192,28 @@ func TestRetryTransport_PreservesRequestBody(t *testing.T) {
 		t.Errorf("retry call body = %q, want %q", mock.bodies[1], body)
 	}
 }
+
+func TestRetryTransport_CancelledDuringJitter(t *testing.T) {
+	mock := &mockRoundTripCloser{errors: []error{syscall.EPIPE}}
+
+	rt := &retryTransport{base: mock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+
+	resp, err := rt.RoundTrip(req)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("expected error")
+	}
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+
+	if mock.calls != 1 {
+		t.Errorf("calls = %d, want 1 (no retry after cancellation)", mock.calls)
+	}
+}
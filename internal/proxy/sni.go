@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sniHelloTimeout bounds the wait for the ClientHello of a connection.
+const sniHelloTimeout = 10 * time.Second
+
+// errHelloRead stops the handshake once the ClientHello has been parsed.
+var errHelloRead = errors.New("client hello read")
+
+// SNIProxy accepts TLS connections and tunnels each one, still encrypted, to
+// the host named by the server name (SNI) of its ClientHello. It serves
+// clients that can use neither a proxy nor a PAC file but connect to custom
+// hostnames that local DNS resolves to podproxy.
+type SNIProxy struct {
+	// Suffix, if set, is a domain the server names must end in, e.g.
+	// "podproxy"; it is stripped before dialing, so
+	// pg.db.production.podproxy dials pg.db.production. Connections for
+	// other names are closed.
+	Suffix string
+	// Port is the port dialed on the target. Zero dials the port the client
+	// connected to.
+	Port        int
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	Logger      *slog.Logger
+}
+
+// Serve accepts connections on ln until ctx is cancelled or the listener
+// fails. It closes ln and waits for active connections before returning.
+func (p *SNIProxy) Serve(ctx context.Context, ln net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stop := context.AfterFunc(ctx, func() {
+		ln.Close()
+	})
+	defer stop()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			p.handle(ctx, conn)
+		}()
+	}
+}
+
+func (p *SNIProxy) handle(ctx context.Context, client net.Conn) {
+	defer client.Close()
+
+	_ = client.SetReadDeadline(time.Now().Add(sniHelloTimeout))
+
+	serverName, hello, err := readServerName(client)
+	if err != nil {
+		p.Logger.Debug("reading tls client hello", "client", client.RemoteAddr(), "error", err)
+		return
+	}
+
+	_ = client.SetReadDeadline(time.Time{})
+
+	addr, err := p.target(serverName, client.LocalAddr())
+	if err != nil {
+		p.Logger.Debug("rejected sni connection", "client", client.RemoteAddr(), "error", err)
+		return
+	}
+
+	upstream, err := p.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		p.Logger.Error("sni dial failed", "target", addr, "client", client.RemoteAddr(), "error", err)
+		return
+	}
+	defer upstream.Close()
+
+	// the ClientHello was consumed to read the server name; the upstream
+	// still has to see it.
+	if _, err := upstream.Write(hello); err != nil {
+		p.Logger.Debug("forwarding tls client hello", "target", addr, "error", err)
+		return
+	}
+
+	// unblock the relay when the proxy is stopped.
+	stop := context.AfterFunc(ctx, func() {
+		client.Close()
+		upstream.Close()
+	})
+	defer stop()
+
+	relay(client, upstream)
+}
+
+// target returns the address to dial for serverName, received on local.
+func (p *SNIProxy) target(serverName string, local net.Addr) (string, error) {
+	host := strings.TrimSuffix(strings.ToLower(serverName), ".")
+
+	if p.Suffix != "" {
+		var ok bool
+
+		host, ok = strings.CutSuffix(host, "."+strings.Trim(strings.ToLower(p.Suffix), "."))
+		if !ok || host == "" {
+			return "", fmt.Errorf("server name %q is not below %s", serverName, p.Suffix)
+		}
+	}
+
+	port := p.Port
+	if port == 0 {
+		if tcp, ok := local.(*net.TCPAddr); ok {
+			port = tcp.Port
+		}
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// readServerName reads the ClientHello from r and returns its server name
+// along with the bytes read, which have to be replayed to the upstream.
+func readServerName(r io.Reader) (string, []byte, error) {
+	var (
+		buf        bytes.Buffer
+		serverName string
+	)
+
+	err := tls.Server(helloConn{r: io.TeeReader(r, &buf)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if !errors.Is(err, errHelloRead) {
+		return "", nil, fmt.Errorf("not a tls client hello: %w", err)
+	}
+
+	if serverName == "" {
+		return "", nil, errors.New("client hello has no server name")
+	}
+
+	return serverName, buf.Bytes(), nil
+}
+
+// helloConn feeds the ClientHello to a TLS server handshake and discards
+// what the server would answer.
+type helloConn struct {
+	r io.Reader
+}
+
+func (c helloConn) Read(b []byte) (int, error)     { return c.r.Read(b) }
+func (helloConn) Write([]byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (helloConn) Close() error                     { return nil }
+func (helloConn) LocalAddr() net.Addr              { return nil }
+func (helloConn) RemoteAddr() net.Addr             { return nil }
+func (helloConn) SetDeadline(time.Time) error      { return nil }
+func (helloConn) SetReadDeadline(time.Time) error  { return nil }
+func (helloConn) SetWriteDeadline(time.Time) error { return nil }
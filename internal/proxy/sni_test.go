@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSNIProxyRoutesByServerName(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.ServerName))
+	}))
+	defer backend.Close()
+
+	dialed := make(chan string, 1)
+
+	sni := &SNIProxy{
+		Suffix: "podproxy",
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed <- addr
+			return (&net.Dialer{}).DialContext(ctx, network, backend.Listener.Addr().String())
+		},
+		Logger: slog.New(slog.DiscardHandler),
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- sni.Serve(ctx, ln)
+	}()
+
+	defer func() {
+		cancel()
+
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, ln.Addr().String())
+		},
+		// TLS ends at the backend, whose test certificate isn't for this
+		// name.
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // test backend
+	}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("https://pg.db.production.podproxy/")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := <-dialed; got != "pg.db.production:"+port {
+		t.Errorf("dialed %s, want pg.db.production:%s", got, port)
+	}
+
+	var body [64]byte
+	n, _ := resp.Body.Read(body[:])
+
+	if got := string(body[:n]); got != "pg.db.production.podproxy" {
+		t.Errorf("backend saw server name %q, want the original one", got)
+	}
+}
+
+func TestSNIProxyTarget(t *testing.T) {
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5432}
+
+	tests := []struct {
+		suffix     string
+		port       int
+		serverName string
+		want       string
+		wantErr    bool
+	}{
+		{"podproxy", 0, "pg.db.production.podproxy", "pg.db.production:5432", false},
+		{".podproxy.", 0, "PG.db.production.podproxy.", "pg.db.production:5432", false},
+		{"podproxy", 6432, "pg.db.production.podproxy", "pg.db.production:6432", false},
+		{"", 0, "pg.db.production", "pg.db.production:5432", false},
+		{"podproxy", 0, "pg.db.production", "", true},
+		{"podproxy", 0, "podproxy", "", true},
+	}
+
+	for _, tt := range tests {
+		p := &SNIProxy{Suffix: tt.suffix, Port: tt.port}
+
+		got, err := p.target(tt.serverName, local)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("target(%q) with suffix %q = %q, %v, want %q", tt.serverName, tt.suffix, got, err, tt.want)
+		}
+	}
+}
+
+func TestReadServerNameRejectsPlainText(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		client.Write([]byte("GET / HTTP/1.1\r\nHost: pg.db.production\r\n\r\n"))
+		client.Close()
+	}()
+
+	if _, _, err := readServerName(server); err == nil {
+		t.Error("readServerName accepted a plain HTTP request")
+	}
+}
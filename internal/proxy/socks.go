@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/things-go/go-socks5"
+	"github.com/things-go/go-socks5/statute"
+
+	"github.com/entwico/podproxy/internal/auth"
+	"github.com/entwico/podproxy/internal/metrics"
+	"github.com/entwico/podproxy/internal/proxyproto"
+)
+
+// SOCKSRules permits all SOCKS5 commands and stores the username from
+// username/password authentication and the client's address in the request
+// context, where the dialer picks them up. go-socks5 only exposes the auth context on the request, not to
+// WithDial callbacks.
+type SOCKSRules struct {
+	// Limiter, if set, rejects requests of clients opening connections too
+	// fast with "connection not allowed by ruleset".
+	Limiter *ConnRateLimiter
+	Logger  *slog.Logger
+}
+
+func (r SOCKSRules) Allow(ctx context.Context, req *socks5.Request) (context.Context, bool) {
+	var user string
+
+	if req.AuthContext != nil {
+		if user = req.AuthContext.Payload["username"]; user != "" {
+			ctx = auth.WithUser(ctx, user)
+		}
+	}
+
+	var remoteAddr string
+	if req.RemoteAddr != nil {
+		remoteAddr = req.RemoteAddr.String()
+	}
+
+	if ok, retryAfter := r.Limiter.Allow(RateLimitKey(user, remoteAddr)); !ok {
+		metrics.RateLimitedTotal.WithLabelValues("socks").Inc()
+
+		if r.Logger != nil {
+			r.Logger.Debug("connection rate limited", "client", remoteAddr, "user", user, "retry_after", retryAfter)
+		}
+
+		return ctx, false
+	}
+
+	if req.RemoteAddr != nil {
+		ctx = proxyproto.WithClientAddr(ctx, req.RemoteAddr)
+	}
+
+	return ctx, true
+}
+
+// SOCKSRewriter makes requests that named a host dial that name, even when
+// the resolver handed out an IP for it. go-socks5 otherwise dials the
+// resolved IP, which is synthetic when fake IPs are enabled.
+type SOCKSRewriter struct{}
+
+func (SOCKSRewriter) Rewrite(ctx context.Context, req *socks5.Request) (context.Context, *statute.AddrSpec) {
+	if req.RawDestAddr.FQDN == "" {
+		return ctx, req.RawDestAddr
+	}
+
+	return ctx, &statute.AddrSpec{FQDN: req.RawDestAddr.FQDN, Port: req.RawDestAddr.Port}
+}
+
+// RejectSOCKS answers a SOCKS5 connection with "general SOCKS server
+// failure". The reply is only defined for requests, so it negotiates up to
+// the request first, accepting any username and password.
+func RejectSOCKS(conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(rejectTimeout))
+
+	r := bufio.NewReader(conn)
+
+	methods, err := statute.ParseMethodRequest(r)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case slices.Contains(methods.Methods, statute.MethodNoAuth):
+		_, _ = conn.Write([]byte{statute.VersionSocks5, statute.MethodNoAuth})
+	case slices.Contains(methods.Methods, statute.MethodUserPassAuth):
+		_, _ = conn.Write([]byte{statute.VersionSocks5, statute.MethodUserPassAuth})
+
+		if _, err := statute.ParseUserPassRequest(r); err != nil {
+			return
+		}
+
+		_, _ = conn.Write([]byte{statute.UserPassAuthVersion, statute.AuthSuccess})
+	default:
+		_, _ = conn.Write([]byte{statute.VersionSocks5, statute.MethodNoAcceptable})
+		return
+	}
+
+	if _, err := statute.ParseRequest(r); err != nil {
+		return
+	}
+
+	_ = socks5.SendReply(conn, statute.RepServerFailure, nil)
+}
+
+// verify SOCKSRules and SOCKSRewriter satisfy the go-socks5 interfaces.
+var (
+	_ socks5.RuleSet         = SOCKSRules{}
+	_ socks5.AddressRewriter = SOCKSRewriter{}
+)
@@ -0,0 +1,113 @@
+// Package proxyproto writes HAProxy PROXY protocol headers, which tell an
+// upstream the address of the client a proxied connection originates from.
+package proxyproto
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Version is a PROXY protocol version.
+type Version int
+
+const (
+	// V1 is the human-readable text header.
+	V1 Version = 1
+	// V2 is the binary header.
+	V2 Version = 2
+)
+
+// v2Signature starts every version 2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ParseVersion parses "v1" or "v2".
+func ParseVersion(s string) (Version, error) {
+	switch s {
+	case "v1":
+		return V1, nil
+	case "v2":
+		return V2, nil
+	default:
+		return 0, fmt.Errorf("unknown PROXY protocol version %q (want v1 or v2)", s)
+	}
+}
+
+// Header returns the header announcing a connection from src to dst. When
+// either address is unknown or not TCP, or they are of different address
+// families, the header says so (UNKNOWN in v1, LOCAL in v2) and the upstream
+// uses the connection's own addresses.
+func Header(v Version, src, dst net.Addr) []byte {
+	srcTCP, _ := src.(*net.TCPAddr)
+	dstTCP, _ := dst.(*net.TCPAddr)
+
+	known := srcTCP != nil && dstTCP != nil && (srcTCP.IP.To4() == nil) == (dstTCP.IP.To4() == nil)
+
+	if v == V1 {
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+
+		family := "TCP4"
+		if srcTCP.IP.To4() == nil {
+			family = "TCP6"
+		}
+
+		return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n", family, srcTCP.IP, dstTCP.IP, srcTCP.Port, dstTCP.Port)
+	}
+
+	var b bytes.Buffer
+
+	b.Write(v2Signature)
+
+	if !known {
+		// version 2, LOCAL command, no address block.
+		b.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return b.Bytes()
+	}
+
+	// version 2, PROXY command; TCP over IPv4 or IPv6.
+	b.WriteByte(0x21)
+
+	srcIP, dstIP := srcTCP.IP.To4(), dstTCP.IP.To4()
+	if srcIP != nil {
+		b.WriteByte(0x11)
+	} else {
+		srcIP, dstIP = srcTCP.IP.To16(), dstTCP.IP.To16()
+		b.WriteByte(0x21)
+	}
+
+	_ = binary.Write(&b, binary.BigEndian, uint16(2*len(srcIP)+4))
+	b.Write(srcIP)
+	b.Write(dstIP)
+	_ = binary.Write(&b, binary.BigEndian, uint16(srcTCP.Port))
+	_ = binary.Write(&b, binary.BigEndian, uint16(dstTCP.Port))
+
+	return b.Bytes()
+}
+
+// WriteHeader writes the header for a connection from src to dst to w.
+func WriteHeader(w io.Writer, v Version, src, dst net.Addr) error {
+	if _, err := w.Write(Header(v, src, dst)); err != nil {
+		return fmt.Errorf("writing PROXY protocol header: %w", err)
+	}
+
+	return nil
+}
+
+type clientAddrKey struct{}
+
+// WithClientAddr returns a context carrying the address of the proxy client
+// a connection is dialed for.
+func WithClientAddr(ctx context.Context, addr net.Addr) context.Context {
+	return context.WithValue(ctx, clientAddrKey{}, addr)
+}
+
+// ClientAddr returns the proxy client's address, or nil when unknown.
+func ClientAddr(ctx context.Context) net.Addr {
+	addr, _ := ctx.Value(clientAddrKey{}).(net.Addr)
+	return addr
+}
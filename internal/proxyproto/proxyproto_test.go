@@ -0,0 +1,97 @@
+package proxyproto
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+)
+
+func TestHeaderV1(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst net.Addr
+		want     string
+	}{
+		{
+			name: "ipv4",
+			src:  &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 51234},
+			dst:  &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 5432},
+			want: "PROXY TCP4 192.168.1.10 10.0.0.5 51234 5432\r\n",
+		},
+		{
+			name: "ipv6",
+			src:  &net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 51234},
+			dst:  &net.TCPAddr{IP: net.ParseIP("fd00::2"), Port: 443},
+			want: "PROXY TCP6 fd00::1 fd00::2 51234 443\r\n",
+		},
+		{
+			name: "unknown client",
+			dst:  &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 5432},
+			want: "PROXY UNKNOWN\r\n",
+		},
+		{
+			name: "mixed families",
+			src:  &net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 51234},
+			dst:  &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 5432},
+			want: "PROXY UNKNOWN\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Header(V1, tt.src, tt.dst)); got != tt.want {
+				t.Errorf("Header() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderV2(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 51234}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 5432}
+
+	want := append(append([]byte{}, v2Signature...),
+		0x21, 0x11, 0x00, 0x0c,
+		192, 168, 1, 10,
+		10, 0, 0, 5,
+		0xc8, 0x22,
+		0x15, 0x38,
+	)
+
+	if got := Header(V2, src, dst); !bytes.Equal(got, want) {
+		t.Errorf("Header() = %x, want %x", got, want)
+	}
+
+	local := append(append([]byte{}, v2Signature...), 0x20, 0x00, 0x00, 0x00)
+	if got := Header(V2, nil, dst); !bytes.Equal(got, local) {
+		t.Errorf("Header() without client = %x, want %x", got, local)
+	}
+
+	if got := Header(V2, &net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 1}, &net.TCPAddr{IP: net.ParseIP("fd00::2"), Port: 2}); len(got) != 16+36 || got[13] != 0x21 {
+		t.Errorf("Header() for ipv6 = %x, want a 52 byte TCP6 header", got)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for s, want := range map[string]Version{"v1": V1, "v2": V2} {
+		if v, err := ParseVersion(s); err != nil || v != want {
+			t.Errorf("ParseVersion(%q) = %v, %v, want %v", s, v, err, want)
+		}
+	}
+
+	if _, err := ParseVersion("2"); err == nil {
+		t.Error(`ParseVersion("2"): want error`)
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	if addr := ClientAddr(context.Background()); addr != nil {
+		t.Errorf("ClientAddr() without address = %v, want nil", addr)
+	}
+
+	addr := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 51234}
+	if got := ClientAddr(WithClientAddr(context.Background(), addr)); got != addr {
+		t.Errorf("ClientAddr() = %v, want %v", got, addr)
+	}
+}
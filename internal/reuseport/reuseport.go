@@ -0,0 +1,24 @@
+// Package reuseport opens TCP listeners with SO_REUSEPORT set, so a
+// replacement process can bind the same address while the current one is
+// still serving it.
+package reuseport
+
+import (
+	"context"
+	"net"
+)
+
+// Listen announces on the local network address like net.Listen, with
+// SO_REUSEPORT set on the socket. It fails on platforms without
+// SO_REUSEPORT.
+func Listen(network, address string) (net.Listener, error) {
+	return ListenWith(net.ListenConfig{}, network, address)
+}
+
+// ListenWith is like Listen, keeping the other settings of lc such as its
+// keepalive configuration.
+func ListenWith(lc net.ListenConfig, network, address string) (net.Listener, error) {
+	lc.Control = control
+
+	return lc.Listen(context.Background(), network, address)
+}
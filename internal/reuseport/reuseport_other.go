@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package reuseport
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Supported reports whether SO_REUSEPORT is available on this platform.
+const Supported = false
+
+func control(_, _ string, _ syscall.RawConn) error {
+	return fmt.Errorf("SO_REUSEPORT: %w", errors.ErrUnsupported)
+}
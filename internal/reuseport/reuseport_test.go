@@ -0,0 +1,57 @@
+package reuseport
+
+import (
+	"net"
+	"testing"
+)
+
+func TestListenSharesAddress(t *testing.T) {
+	if !Supported {
+		t.Skip("SO_REUSEPORT not supported on this platform")
+	}
+
+	first, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("first Listen: %v", err)
+	}
+	defer first.Close()
+
+	second, err := Listen("tcp", first.Addr().String())
+	if err != nil {
+		t.Fatalf("second Listen on %s: %v", first.Addr(), err)
+	}
+	defer second.Close()
+
+	// closing the first listener must leave the address served by the second.
+	first.Close()
+
+	conn, err := net.Dial("tcp", second.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial after closing first listener: %v", err)
+	}
+	defer conn.Close()
+
+	accepted, err := second.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+
+	accepted.Close()
+}
+
+func TestListenWithoutReusePortConflicts(t *testing.T) {
+	if !Supported {
+		t.Skip("SO_REUSEPORT not supported on this platform")
+	}
+
+	plain, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer plain.Close()
+
+	if l, err := Listen("tcp", plain.Addr().String()); err == nil {
+		l.Close()
+		t.Fatal("expected Listen to fail on an address bound without SO_REUSEPORT")
+	}
+}
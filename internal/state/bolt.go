@@ -0,0 +1,129 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStore is a Store backed by an embedded bbolt database, so state
+// survives restarts.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens (or creates) the state database at path. It fails
+// after a short timeout while another instance holds the database open.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening state database %s: %w", path, err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Get returns the value of key in bucket, or ErrNotFound.
+func (s *BoltStore) Get(bucket, key string) ([]byte, error) {
+	var value []byte
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrNotFound
+		}
+
+		v := b.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+
+		// values are only valid during the transaction.
+		value = clone(v)
+
+		return nil
+	})
+
+	return value, err
+}
+
+// Put sets key in bucket to value.
+func (s *BoltStore) Put(bucket, key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(key), value)
+	})
+}
+
+// Delete removes key from bucket.
+func (s *BoltStore) Delete(bucket, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete([]byte(key))
+	})
+}
+
+// All returns the keys and values of bucket.
+func (s *BoltStore) All(bucket string) (map[string][]byte, error) {
+	entries := make(map[string][]byte)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			entries[string(k)] = clone(v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading state %s: %w", bucket, err)
+	}
+
+	return entries, nil
+}
+
+// Replace replaces the contents of bucket with entries in one transaction.
+func (s *BoltStore) Replace(bucket string, entries map[string][]byte) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(bucket)) != nil {
+			if err := tx.DeleteBucket([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+
+		b, err := tx.CreateBucket([]byte(bucket))
+		if err != nil {
+			return err
+		}
+
+		for k, v := range entries {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("writing state %s: %w", bucket, err)
+	}
+
+	return nil
+}
+
+// Close closes the database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
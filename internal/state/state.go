@@ -0,0 +1,114 @@
+// Package state keeps small pieces of operational state, such as the fake IP
+// assignments, in a key-value store that can outlive a restart.
+package state
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned by Store.Get for a missing key.
+var ErrNotFound = errors.New("state: key not found")
+
+// Store is a key-value store partitioned into buckets, one per kind of
+// state.
+type Store interface {
+	// Get returns the value of key in bucket, or ErrNotFound.
+	Get(bucket, key string) ([]byte, error)
+	// Put sets key in bucket to value.
+	Put(bucket, key string, value []byte) error
+	// Delete removes key from bucket. A missing key is not an error.
+	Delete(bucket, key string) error
+	// All returns the keys and values of bucket.
+	All(bucket string) (map[string][]byte, error)
+	// Replace atomically replaces the contents of bucket with entries.
+	Replace(bucket string, entries map[string][]byte) error
+	Close() error
+}
+
+// Memory is a Store that keeps state in memory, so it lasts as long as the
+// process. The zero value is ready to use.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+// Get returns the value of key in bucket, or ErrNotFound.
+func (m *Memory) Get(bucket, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v, ok := m.buckets[bucket][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return clone(v), nil
+}
+
+// Put sets key in bucket to value.
+func (m *Memory) Put(bucket, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.buckets == nil {
+		m.buckets = make(map[string]map[string][]byte)
+	}
+
+	if m.buckets[bucket] == nil {
+		m.buckets[bucket] = make(map[string][]byte)
+	}
+
+	m.buckets[bucket][key] = clone(value)
+
+	return nil
+}
+
+// Delete removes key from bucket.
+func (m *Memory) Delete(bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.buckets[bucket], key)
+
+	return nil
+}
+
+// All returns the keys and values of bucket.
+func (m *Memory) All(bucket string) (map[string][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make(map[string][]byte, len(m.buckets[bucket]))
+	for k, v := range m.buckets[bucket] {
+		entries[k] = clone(v)
+	}
+
+	return entries, nil
+}
+
+// Replace replaces the contents of bucket with entries.
+func (m *Memory) Replace(bucket string, entries map[string][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.buckets == nil {
+		m.buckets = make(map[string]map[string][]byte)
+	}
+
+	m.buckets[bucket] = make(map[string][]byte, len(entries))
+	for k, v := range entries {
+		m.buckets[bucket][k] = clone(v)
+	}
+
+	return nil
+}
+
+// Close does nothing; the state is dropped with the Memory.
+func (m *Memory) Close() error {
+	return nil
+}
+
+func clone(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,86 @@
+package state
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(*testing.T) Store { return &Memory{} },
+		"bolt": func(t *testing.T) Store {
+			store, err := OpenBoltStore(filepath.Join(t.TempDir(), "state.db"))
+			if err != nil {
+				t.Fatalf("OpenBoltStore() error: %v", err)
+			}
+
+			return store
+		},
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			defer store.Close()
+
+			if _, err := store.Get("fakeip", "redis.production"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get() from an empty store error = %v, want ErrNotFound", err)
+			}
+
+			if err := store.Put("fakeip", "redis.production", []byte("198.18.0.1")); err != nil {
+				t.Fatalf("Put() error: %v", err)
+			}
+
+			if v, err := store.Get("fakeip", "redis.production"); err != nil || string(v) != "198.18.0.1" {
+				t.Errorf("Get() = %q, %v, want 198.18.0.1", v, err)
+			}
+
+			if err := store.Replace("fakeip", map[string][]byte{"pg.production": []byte("198.18.0.2")}); err != nil {
+				t.Fatalf("Replace() error: %v", err)
+			}
+
+			all, err := store.All("fakeip")
+			if err != nil || len(all) != 1 || string(all["pg.production"]) != "198.18.0.2" {
+				t.Errorf("All() after Replace = %q, %v, want only pg.production", all, err)
+			}
+
+			if err := store.Delete("fakeip", "pg.production"); err != nil {
+				t.Fatalf("Delete() error: %v", err)
+			}
+
+			if err := store.Delete("other", "missing"); err != nil {
+				t.Errorf("Delete() of a missing key error: %v", err)
+			}
+
+			if all, _ := store.All("fakeip"); len(all) != 0 {
+				t.Errorf("All() after Delete = %q, want none", all)
+			}
+		})
+	}
+}
+
+func TestBoltStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error: %v", err)
+	}
+
+	if err := store.Put("fakeip", "redis.production", []byte("198.18.0.1")); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+
+	store.Close()
+
+	store, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer store.Close()
+
+	if v, err := store.Get("fakeip", "redis.production"); err != nil || string(v) != "198.18.0.1" {
+		t.Errorf("Get() after reopening = %q, %v, want 198.18.0.1", v, err)
+	}
+}
@@ -0,0 +1,52 @@
+// Package sysproxy points the per-user system proxy settings at podproxy, so
+// browsers and other applications honouring them use it without manual
+// configuration. Windows (Internet Settings) and Linux desktops (GNOME
+// gsettings, KDE kioslaverc) are supported.
+package sysproxy
+
+import (
+	"net"
+)
+
+// Settings is the proxy configuration to apply. When PACURL is set, proxy
+// auto-configuration is used; otherwise HTTPProxy, or SOCKSProxy when there
+// is no HTTP proxy, is configured statically for all traffic.
+type Settings struct {
+	PACURL     string
+	HTTPProxy  string
+	SOCKSProxy string
+}
+
+// Apply configures the system proxy and returns a function restoring the
+// settings that were in place before. Settings are only restored by calling
+// it, so they stay applied if the process is killed.
+func Apply(s Settings) (restore func() error, err error) {
+	return apply(s)
+}
+
+// Disable switches the system proxy off. Unlike the function returned by
+// Apply, it doesn't restore earlier settings.
+func Disable() error {
+	return disable()
+}
+
+// ClientAddress returns the address clients use to reach a listener bound to
+// listenAddr. Wildcard hosts are replaced by loopback.
+func ClientAddress(listenAddr string) string {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return listenAddr
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+
+	return listenAddr
+}
+
+// PACURL returns the URL of the PAC file served by a listener bound to
+// pacListenAddr.
+func PACURL(pacListenAddr string) string {
+	return "http://" + ClientAddress(pacListenAddr) + "/proxy.pac"
+}
@@ -0,0 +1,301 @@
+//go:build linux
+
+package sysproxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// run executes a settings tool and returns its trimmed output. overridden in
+// tests.
+var run = func(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// lookPath reports whether a tool is installed. overridden in tests.
+var lookPath = func(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// backend configures the proxy settings of one desktop environment.
+type backend interface {
+	// snapshot returns a function restoring the current settings.
+	snapshot() (func() error, error)
+	apply(s Settings) error
+	disable() error
+}
+
+// detect picks the backend of the running desktop environment. KDE is
+// identified by XDG_CURRENT_DESKTOP; everything else with gsettings (GNOME,
+// Cinnamon, MATE, Budgie, ...) uses the GNOME proxy schema.
+func detect() (backend, error) {
+	if strings.Contains(strings.ToUpper(os.Getenv("XDG_CURRENT_DESKTOP")), "KDE") {
+		for _, v := range []string{"6", "5"} {
+			if lookPath("kwriteconfig" + v) {
+				return kde{write: "kwriteconfig" + v, read: "kreadconfig" + v}, nil
+			}
+		}
+	}
+
+	if lookPath("gsettings") {
+		return gnome{}, nil
+	}
+
+	return nil, fmt.Errorf("no supported desktop environment (GNOME or KDE) found: %w", errors.ErrUnsupported)
+}
+
+func apply(s Settings) (func() error, error) {
+	b, err := detect()
+	if err != nil {
+		return nil, err
+	}
+
+	restore, err := b.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.apply(s); err != nil {
+		// best effort: don't leave a half-applied configuration behind.
+		_ = restore()
+		return nil, err
+	}
+
+	return restore, nil
+}
+
+func disable() error {
+	b, err := detect()
+	if err != nil {
+		return err
+	}
+
+	return b.disable()
+}
+
+// gnome configures the org.gnome.system.proxy schema with gsettings.
+type gnome struct{}
+
+// gnomeKeys are the settings gnome writes, as schema and key.
+var gnomeKeys = [][2]string{
+	{"org.gnome.system.proxy", "mode"},
+	{"org.gnome.system.proxy", "autoconfig-url"},
+	{"org.gnome.system.proxy.http", "host"},
+	{"org.gnome.system.proxy.http", "port"},
+	{"org.gnome.system.proxy.https", "host"},
+	{"org.gnome.system.proxy.https", "port"},
+	{"org.gnome.system.proxy.socks", "host"},
+	{"org.gnome.system.proxy.socks", "port"},
+}
+
+func (gnome) snapshot() (func() error, error) {
+	// gsettings get prints GVariant text, which gsettings set accepts back.
+	saved := make([]string, len(gnomeKeys))
+
+	for i, k := range gnomeKeys {
+		v, err := run("gsettings", "get", k[0], k[1])
+		if err != nil {
+			return nil, err
+		}
+
+		saved[i] = v
+	}
+
+	return func() error {
+		var errs []error
+
+		for i, k := range gnomeKeys {
+			if _, err := run("gsettings", "set", k[0], k[1], saved[i]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	}, nil
+}
+
+func (gnome) apply(s Settings) error {
+	if s.PACURL != "" {
+		return gsettingsSet(
+			[3]string{"org.gnome.system.proxy", "autoconfig-url", s.PACURL},
+			[3]string{"org.gnome.system.proxy", "mode", "auto"},
+		)
+	}
+
+	var values [][3]string
+
+	if s.HTTPProxy != "" {
+		host, port, err := net.SplitHostPort(s.HTTPProxy)
+		if err != nil {
+			return err
+		}
+
+		values = append(values,
+			[3]string{"org.gnome.system.proxy.http", "host", host},
+			[3]string{"org.gnome.system.proxy.http", "port", port},
+			[3]string{"org.gnome.system.proxy.https", "host", host},
+			[3]string{"org.gnome.system.proxy.https", "port", port},
+		)
+	}
+
+	if s.SOCKSProxy != "" {
+		host, port, err := net.SplitHostPort(s.SOCKSProxy)
+		if err != nil {
+			return err
+		}
+
+		values = append(values,
+			[3]string{"org.gnome.system.proxy.socks", "host", host},
+			[3]string{"org.gnome.system.proxy.socks", "port", port},
+		)
+	}
+
+	return gsettingsSet(append(values, [3]string{"org.gnome.system.proxy", "mode", "manual"})...)
+}
+
+func (gnome) disable() error {
+	return gsettingsSet([3]string{"org.gnome.system.proxy", "mode", "none"})
+}
+
+// gsettingsSet sets schema, key, value triples in order.
+func gsettingsSet(values ...[3]string) error {
+	for _, v := range values {
+		if _, err := run("gsettings", "set", v[0], v[1], v[2]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// kde configures the [Proxy Settings] group of kioslaverc.
+type kde struct {
+	write, read string
+}
+
+// kdeKeys are the kioslaverc keys kde writes.
+var kdeKeys = []string{"ProxyType", "Proxy Config Script", "httpProxy", "httpsProxy", "socksProxy"}
+
+// KDE ProxyType values.
+const (
+	kdeNoProxy     = "0"
+	kdeManualProxy = "1"
+	kdePACProxy    = "2"
+)
+
+func (k kde) snapshot() (func() error, error) {
+	saved := make([]string, len(kdeKeys))
+
+	for i, key := range kdeKeys {
+		v, err := run(k.read, "--file", "kioslaverc", "--group", "Proxy Settings", "--key", key)
+		if err != nil {
+			return nil, err
+		}
+
+		saved[i] = v
+	}
+
+	return func() error {
+		var errs []error
+
+		for i, key := range kdeKeys {
+			args := []string{"--file", "kioslaverc", "--group", "Proxy Settings", "--key", key}
+			if saved[i] == "" {
+				args = append(args, "--delete")
+			} else {
+				args = append(args, saved[i])
+			}
+
+			if _, err := run(k.write, args...); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		k.reload()
+
+		return errors.Join(errs...)
+	}, nil
+}
+
+func (k kde) apply(s Settings) error {
+	values := map[string]string{"ProxyType": kdePACProxy, "Proxy Config Script": s.PACURL}
+
+	if s.PACURL == "" {
+		values = map[string]string{"ProxyType": kdeManualProxy}
+
+		// KDE separates host and port with a space.
+		if s.HTTPProxy != "" {
+			host, port, err := net.SplitHostPort(s.HTTPProxy)
+			if err != nil {
+				return err
+			}
+
+			values["httpProxy"] = "http://" + host + " " + port
+			values["httpsProxy"] = "http://" + host + " " + port
+		}
+
+		if s.SOCKSProxy != "" {
+			host, port, err := net.SplitHostPort(s.SOCKSProxy)
+			if err != nil {
+				return err
+			}
+
+			values["socksProxy"] = "socks://" + host + " " + port
+		}
+	}
+
+	// write ProxyType last, so the mode only switches once its settings are in
+	// place.
+	for _, key := range kdeKeys[1:] {
+		if v, ok := values[key]; ok {
+			if err := k.set(key, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := k.set("ProxyType", values["ProxyType"]); err != nil {
+		return err
+	}
+
+	k.reload()
+
+	return nil
+}
+
+func (k kde) disable() error {
+	if err := k.set("ProxyType", kdeNoProxy); err != nil {
+		return err
+	}
+
+	k.reload()
+
+	return nil
+}
+
+func (k kde) set(key, value string) error {
+	_, err := run(k.write, "--file", "kioslaverc", "--group", "Proxy Settings", "--key", key, value)
+	return err
+}
+
+// reload tells running KDE applications to re-read kioslaverc. Failures are
+// ignored: without a session bus, applications read it on their next start.
+func (kde) reload() {
+	_, _ = run("dbus-send", "--type=signal", "/KIO/Scheduler", "org.kde.KIO.Scheduler.reparseSlaveConfiguration", "string:")
+}
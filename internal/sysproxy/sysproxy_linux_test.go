@@ -0,0 +1,105 @@
+package sysproxy
+
+import (
+	"strings"
+	"testing"
+)
+
+// fakeTools records the commands run and answers reads from values.
+func fakeTools(t *testing.T, installed ...string) (commands *[]string, values map[string]string) {
+	t.Helper()
+
+	commands = &[]string{}
+	values = map[string]string{}
+
+	origRun, origLookPath := run, lookPath
+
+	t.Cleanup(func() { run, lookPath = origRun, origLookPath })
+
+	run = func(name string, args ...string) (string, error) {
+		cmd := name + " " + strings.Join(args, " ")
+		*commands = append(*commands, cmd)
+
+		return values[cmd], nil
+	}
+
+	lookPath = func(name string) bool {
+		for _, tool := range installed {
+			if tool == name {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return commands, values
+}
+
+func TestApplyGNOME(t *testing.T) {
+	t.Setenv("XDG_CURRENT_DESKTOP", "ubuntu:GNOME")
+
+	commands, values := fakeTools(t, "gsettings")
+	values["gsettings get org.gnome.system.proxy mode"] = "'none'"
+
+	restore, err := Apply(Settings{HTTPProxy: "127.0.0.1:9081", SOCKSProxy: "127.0.0.1:9080"})
+	if err != nil {
+		t.Fatalf("Apply() error: %v", err)
+	}
+
+	applied := strings.Join(*commands, "\n")
+	for _, want := range []string{
+		"gsettings set org.gnome.system.proxy.https host 127.0.0.1",
+		"gsettings set org.gnome.system.proxy.socks port 9080",
+		"gsettings set org.gnome.system.proxy mode manual",
+	} {
+		if !strings.Contains(applied, want) {
+			t.Errorf("missing %q in:\n%s", want, applied)
+		}
+	}
+
+	// the mode is switched once the proxies are configured.
+	if last := (*commands)[len(*commands)-1]; last != "gsettings set org.gnome.system.proxy mode manual" {
+		t.Errorf("last command = %q, want the mode switch", last)
+	}
+
+	*commands = nil
+
+	if err := restore(); err != nil {
+		t.Fatalf("restore() error: %v", err)
+	}
+
+	if !strings.Contains(strings.Join(*commands, "\n"), "gsettings set org.gnome.system.proxy mode 'none'") {
+		t.Errorf("restore did not reset the mode: %v", *commands)
+	}
+}
+
+func TestApplyKDE(t *testing.T) {
+	t.Setenv("XDG_CURRENT_DESKTOP", "KDE")
+
+	commands, _ := fakeTools(t, "gsettings", "kwriteconfig6")
+
+	if _, err := Apply(Settings{PACURL: "http://127.0.0.1:9082/proxy.pac"}); err != nil {
+		t.Fatalf("Apply() error: %v", err)
+	}
+
+	applied := strings.Join(*commands, "\n")
+	for _, want := range []string{
+		"kreadconfig6 --file kioslaverc --group Proxy Settings --key ProxyType",
+		"kwriteconfig6 --file kioslaverc --group Proxy Settings --key Proxy Config Script http://127.0.0.1:9082/proxy.pac",
+		"kwriteconfig6 --file kioslaverc --group Proxy Settings --key ProxyType 2",
+	} {
+		if !strings.Contains(applied, want) {
+			t.Errorf("missing %q in:\n%s", want, applied)
+		}
+	}
+}
+
+func TestDetectUnsupported(t *testing.T) {
+	t.Setenv("XDG_CURRENT_DESKTOP", "")
+	fakeTools(t)
+
+	if err := Disable(); err == nil {
+		t.Error("expected an error without a supported desktop environment")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows && !linux
+
+package sysproxy
+
+import (
+	"errors"
+	"fmt"
+)
+
+func apply(_ Settings) (func() error, error) {
+	return nil, fmt.Errorf("system proxy configuration: %w", errors.ErrUnsupported)
+}
+
+func disable() error {
+	return fmt.Errorf("system proxy configuration: %w", errors.ErrUnsupported)
+}
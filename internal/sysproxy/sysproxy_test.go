@@ -0,0 +1,28 @@
+package sysproxy
+
+import "testing"
+
+func TestClientAddress(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   string
+	}{
+		{"127.0.0.1:9082", "127.0.0.1:9082"},
+		{"0.0.0.0:9082", "127.0.0.1:9082"},
+		{"[::]:9082", "127.0.0.1:9082"},
+		{":9082", "127.0.0.1:9082"},
+		{"192.168.1.10:9082", "192.168.1.10:9082"},
+	}
+
+	for _, tt := range tests {
+		if got := ClientAddress(tt.listen); got != tt.want {
+			t.Errorf("ClientAddress(%q) = %q, want %q", tt.listen, got, tt.want)
+		}
+	}
+}
+
+func TestPACURL(t *testing.T) {
+	if got, want := PACURL(":9082"), "http://127.0.0.1:9082/proxy.pac"; got != want {
+		t.Errorf("PACURL() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,190 @@
+//go:build windows
+
+package sysproxy
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// internetSettingsKey holds the per-user WinINet proxy settings, which are
+// also used by WinHTTP clients importing them, Edge and Chrome.
+const internetSettingsKey = `Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+const (
+	internetOptionSettingsChanged = 39
+	internetOptionRefresh         = 37
+)
+
+var procInternetSetOptionW = windows.NewLazySystemDLL("wininet.dll").NewProc("InternetSetOptionW")
+
+// registryValue is a saved registry value; nil fields mean it was absent.
+type registryValue struct {
+	str   *string
+	dword *uint32
+}
+
+var (
+	stringValues = []string{"AutoConfigURL", "ProxyServer", "ProxyOverride"}
+	dwordValues  = []string{"ProxyEnable"}
+)
+
+func apply(s Settings) (func() error, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("opening internet settings: %w", err)
+	}
+	defer key.Close()
+
+	saved, err := snapshot(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := write(key, s); err != nil {
+		// best effort: don't leave a half-applied configuration behind.
+		_ = restore(key, saved)
+		return nil, err
+	}
+
+	notifySettingsChanged()
+
+	return func() error {
+		key, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.SET_VALUE)
+		if err != nil {
+			return fmt.Errorf("opening internet settings: %w", err)
+		}
+		defer key.Close()
+
+		err = restore(key, saved)
+		notifySettingsChanged()
+
+		return err
+	}, nil
+}
+
+func disable() error {
+	key, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("opening internet settings: %w", err)
+	}
+	defer key.Close()
+
+	if err := key.DeleteValue("AutoConfigURL"); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return fmt.Errorf("removing AutoConfigURL: %w", err)
+	}
+
+	if err := key.SetDWordValue("ProxyEnable", 0); err != nil {
+		return fmt.Errorf("setting ProxyEnable: %w", err)
+	}
+
+	notifySettingsChanged()
+
+	return nil
+}
+
+func snapshot(key registry.Key) (map[string]registryValue, error) {
+	saved := make(map[string]registryValue, len(stringValues)+len(dwordValues))
+
+	for _, name := range stringValues {
+		v, _, err := key.GetStringValue(name)
+
+		switch {
+		case errors.Is(err, registry.ErrNotExist):
+			saved[name] = registryValue{}
+		case err != nil:
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		default:
+			saved[name] = registryValue{str: &v}
+		}
+	}
+
+	for _, name := range dwordValues {
+		v, _, err := key.GetIntegerValue(name)
+
+		switch {
+		case errors.Is(err, registry.ErrNotExist):
+			saved[name] = registryValue{}
+		case err != nil:
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		default:
+			dword := uint32(v)
+			saved[name] = registryValue{dword: &dword}
+		}
+	}
+
+	return saved, nil
+}
+
+func write(key registry.Key, s Settings) error {
+	if s.PACURL != "" {
+		if err := key.SetStringValue("AutoConfigURL", s.PACURL); err != nil {
+			return fmt.Errorf("setting AutoConfigURL: %w", err)
+		}
+
+		if err := key.SetDWordValue("ProxyEnable", 0); err != nil {
+			return fmt.Errorf("setting ProxyEnable: %w", err)
+		}
+
+		return nil
+	}
+
+	server := s.HTTPProxy
+	if server == "" {
+		server = "socks=" + s.SOCKSProxy
+	}
+
+	// an auto-configuration URL would take precedence over the static proxy.
+	if err := key.DeleteValue("AutoConfigURL"); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return fmt.Errorf("removing AutoConfigURL: %w", err)
+	}
+
+	if err := key.SetStringValue("ProxyServer", server); err != nil {
+		return fmt.Errorf("setting ProxyServer: %w", err)
+	}
+
+	if err := key.SetStringValue("ProxyOverride", "<local>"); err != nil {
+		return fmt.Errorf("setting ProxyOverride: %w", err)
+	}
+
+	if err := key.SetDWordValue("ProxyEnable", 1); err != nil {
+		return fmt.Errorf("setting ProxyEnable: %w", err)
+	}
+
+	return nil
+}
+
+func restore(key registry.Key, saved map[string]registryValue) error {
+	var errs []error
+
+	for name, v := range saved {
+		var err error
+
+		switch {
+		case v.str != nil:
+			err = key.SetStringValue(name, *v.str)
+		case v.dword != nil:
+			err = key.SetDWordValue(name, *v.dword)
+		default:
+			if err = key.DeleteValue(name); errors.Is(err, registry.ErrNotExist) {
+				err = nil
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restoring %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// notifySettingsChanged makes running WinINet applications reload the proxy
+// settings.
+func notifySettingsChanged() {
+	_, _, _ = procInternetSetOptionW.Call(0, internetOptionSettingsChanged, 0, 0)
+	_, _, _ = procInternetSetOptionW.Call(0, internetOptionRefresh, 0, 0)
+}